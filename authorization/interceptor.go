@@ -0,0 +1,383 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+	"github.com/cogment/cogment-model-registry/logging"
+	"github.com/cogment/cogment-model-registry/namespaces"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthorizationMetadataKey is the gRPC metadata key holding the token of a client, as `Bearer <token>`
+const AuthorizationMetadataKey = "authorization"
+
+// Methods of the gRPC reflection service, they only require a known token
+const reflectionMethodPrefix = "/grpc.reflection."
+
+// Methods of the gRPC health service, they don't require any token for orchestrators to probe the registry
+const healthMethodPrefix = "/grpc.health."
+
+// requirement defines what a method requires from the token of a client
+type requirement struct {
+	scope Scope
+	// modelIDPrefixes extracts the prefixes of the models a received message operates on, a message not bound to a model
+	// returns nil. Requirements without it only need the scope on any model.
+	modelIDPrefixes func(message interface{}) []string
+}
+
+// everyModel is used by the methods operating on every model
+func everyModel(message interface{}) []string {
+	return []string{""}
+}
+
+func createVersionRequestChunkModelIDs(message interface{}) []string {
+	if header := message.(*grpcapi.CreateVersionRequestChunk).GetHeader(); header != nil {
+		return []string{header.GetVersionInfo().GetModelId()}
+	}
+	return nil
+}
+
+var requirements = map[string]requirement{
+	"/cogmentAPI.ModelRegistrySP/CreateOrUpdateModel": {WriteScope, func(message interface{}) []string {
+		return []string{message.(*grpcapi.CreateOrUpdateModelRequest).GetModelInfo().GetModelId()}
+	}},
+	"/cogmentAPI.ModelRegistrySP/DeleteModel": {DeleteScope, func(message interface{}) []string {
+		return []string{message.(*grpcapi.DeleteModelRequest).GetModelId()}
+	}},
+	"/cogmentAPI.ModelRegistrySP/RetrieveModels": {ReadScope, func(message interface{}) []string {
+		if modelIDs := message.(*grpcapi.RetrieveModelsRequest).GetModelIds(); len(modelIDs) > 0 {
+			return modelIDs
+		}
+		return everyModel(message)
+	}},
+	"/cogmentAPI.ModelRegistrySP/CreateVersion": {WriteScope, createVersionRequestChunkModelIDs},
+	"/cogmentAPI.ModelRegistrySP/RetrieveVersionInfos": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*grpcapi.RetrieveVersionInfosRequest).GetModelId()}
+	}},
+	"/cogmentAPI.ModelRegistrySP/RetrieveVersionData": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*grpcapi.RetrieveVersionDataRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/CreateModel": {WriteScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.CreateModelRequest).GetModelInfo().GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/UpdateModel": {WriteScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.UpdateModelRequest).GetModelInfo().GetModelId()}
+	}},
+	// A single scope is checked, cloning requires writing the source model as well as the created one
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/CloneModel": {WriteScope, func(message interface{}) []string {
+		req := message.(*extensionsapi.CloneModelRequest)
+		return []string{req.GetSourceModelId(), req.GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RetrieveLatestVersion": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.RetrieveLatestVersionRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RetrieveLatestVersionDataIfChanged": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.RetrieveLatestVersionDataIfChangedRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RetrieveVersionDataRange": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.RetrieveVersionDataRangeRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RetrieveVersionDataURL": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.RetrieveVersionDataURLRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/QueryModels": {ReadScope, func(message interface{}) []string {
+		return []string{namespaces.ModelIDPrefix(message.(*extensionsapi.QueryModelsRequest).GetNamespace())}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/QueryVersionInfos": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.QueryVersionInfosRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/CreateVersions": {WriteScope, createVersionRequestChunkModelIDs},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/CreateVersionWithArtifacts": {WriteScope, func(message interface{}) []string {
+		if header := message.(*extensionsapi.CreateVersionWithArtifactsRequestChunk).GetHeader(); header != nil {
+			return []string{header.GetVersionInfo().GetModelId()}
+		}
+		return nil
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RetrieveArtifactData": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.RetrieveArtifactDataRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/BeginUpload": {WriteScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.BeginUploadRequest).GetVersionInfo().GetModelId()}
+	}},
+	// The model of an upload is only known by the handler, it checks it with AuthorizeModel
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/AppendChunk":  {WriteScope, nil},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/CommitUpload": {WriteScope, nil},
+	// A cascading deletion can delete the dependents of the version in any model
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/DeleteVersion": {DeleteScope, func(message interface{}) []string {
+		if message.(*extensionsapi.DeleteVersionRequest).GetCascade() {
+			return everyModel(message)
+		}
+		return []string{message.(*extensionsapi.DeleteVersionRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/ArchiveVersion": {WriteScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.ArchiveVersionRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/UnarchiveVersion": {WriteScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.UnarchiveVersionRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/LockVersion": {WriteScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.LockVersionRequest).GetModelId()}
+	}},
+	// Unlocking lets the versions referenced by deployments be deleted or changed again
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/UnlockVersion": {AdminScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.UnlockVersionRequest).GetModelId()}
+	}},
+	// Leasing a version prevents its deletion
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/AcquireVersionLease": {WriteScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.AcquireVersionLeaseRequest).GetModelId()}
+	}},
+	// The model of a lease is only known by the handler, it checks it with AuthorizeModel
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RenewVersionLease":   {WriteScope, nil},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/ReleaseVersionLease": {WriteScope, nil},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/ListVersionLeases": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.ListVersionLeasesRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RestoreVersion": {WriteScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.RestoreVersionRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/UpdateVersionInfo": {WriteScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.UpdateVersionInfoRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RetrieveLineage": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.RetrieveLineageRequest).GetModelId()}
+	}},
+	// The dependencies and dependents of a version can be in any model
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RetrieveDependencyGraph": {ReadScope, func(message interface{}) []string {
+		if message.(*extensionsapi.RetrieveDependencyGraphRequest).GetIncludeDependents() {
+			return everyModel(message)
+		}
+		return []string{message.(*extensionsapi.RetrieveDependencyGraphRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RetrieveVersionManifest": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.RetrieveVersionManifestRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/SetVersionAlias": {WriteScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.SetVersionAliasRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/TransitionVersionStage": {WriteScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.TransitionVersionStageRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RetrieveVersionStage": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.RetrieveVersionStageRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RetrieveStorageInfo": {ReadScope, func(message interface{}) []string {
+		return []string{namespaces.ModelIDPrefix(message.(*extensionsapi.RetrieveStorageInfoRequest).GetNamespace())}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/WatchVersions": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.WatchVersionsRequest).GetModelId()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/WatchModels": {ReadScope, func(message interface{}) []string {
+		return []string{message.(*extensionsapi.WatchModelsRequest).GetModelIdPrefix()}
+	}},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/WatchRegistry":        {ReadScope, everyModel},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RunGarbageCollection": {DeleteScope, everyModel},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/ExportRegistry": {ReadScope, func(message interface{}) []string {
+		if modelIDs := message.(*extensionsapi.ExportRegistryRequest).GetModelIds(); len(modelIDs) > 0 {
+			return modelIDs
+		}
+		return everyModel(message)
+	}},
+	// The imported models are only known once the archive is read
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/ImportRegistry": {WriteScope, everyModel},
+	// Saving a snapshot reads every model but writes a file on the server
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/SaveSnapshot":   {WriteScope, everyModel},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/LoadSnapshot":   {DeleteScope, everyModel},
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/SetMaintenance": {DeleteScope, everyModel},
+	// Checking can repair the versions
+	"/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/RunFsck": {WriteScope, func(message interface{}) []string {
+		if modelIDs := message.(*extensionsapi.RunFsckRequest).GetModelIds(); len(modelIDs) > 0 {
+			return modelIDs
+		}
+		return everyModel(message)
+	}},
+}
+
+// RequiredScope retrieves the scope required by a method, false for the methods not requiring any, e.g. the reflection ones
+func RequiredScope(method string) (Scope, bool) {
+	requirement, ok := requirements[method]
+	return requirement.scope, ok
+}
+
+type authorizer struct {
+	policies *PolicyStore
+}
+
+// bearerToken retrieves the token presented in the metadata of an incoming RPC
+func bearerToken(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(AuthorizationMetadataKey)
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimPrefix(values[0], "Bearer "), true
+}
+
+// authenticate retrieves the token presented by the client of an RPC from a policy and adds its name to the logged fields
+func (a *authorizer) authenticate(ctx context.Context, policy *Policy) (context.Context, *Token, error) {
+	presentedToken, ok := bearerToken(ctx)
+	if !ok {
+		return ctx, nil, status.Errorf(codes.Unauthenticated, "missing %q metadata, expecting \"Bearer <token>\"", AuthorizationMetadataKey)
+	}
+	token, ok := policy.LookupToken(presentedToken)
+	if !ok {
+		return ctx, nil, status.Errorf(codes.Unauthenticated, "unknown token")
+	}
+	fields := logrus.Fields{"token": token.Name}
+	if token.Tenant != "" {
+		fields["tenant"] = strings.ToLower(token.Tenant)
+	}
+	ctx = context.WithValue(ctx, grantKey{}, &grant{authorizer: a, policy: policy, token: token})
+	return logging.WithFields(ctx, fields), token, nil
+}
+
+// grant is the token of the client of an RPC, kept in its context for the handler to check the models only it knows
+type grant struct {
+	authorizer *authorizer
+	policy     *Policy
+	token      *Token
+}
+
+type grantKey struct{}
+
+// AuthorizeModel checks that the client of an RPC is allowed a scope on a model only known by the handler, e.g. the
+// model of an upload, it returns a `PERMISSION_DENIED` status error otherwise. The RPCs of a registry without
+// authorization are always allowed.
+func AuthorizeModel(ctx context.Context, scope Scope, modelID string) error {
+	g, ok := ctx.Value(grantKey{}).(*grant)
+	if !ok {
+		return nil
+	}
+	if !g.policy.Allows(g.token, scope, modelID) {
+		return g.authorizer.deny(ctx, scope, fmt.Sprintf("model %q", modelID))
+	}
+	return nil
+}
+
+// authorize checks whether a token satisfies, in a policy, the requirement of a method for a received message
+func (a *authorizer) authorize(ctx context.Context, policy *Policy, token *Token, method string, message interface{}) error {
+	if strings.HasPrefix(method, reflectionMethodPrefix) {
+		return nil
+	}
+	requirement, ok := requirements[method]
+	if !ok {
+		return status.Errorf(codes.PermissionDenied, "method %q is not allowed", method)
+	}
+	if requirement.modelIDPrefixes == nil {
+		if !policy.AllowsAny(token, requirement.scope) {
+			return a.deny(ctx, requirement.scope, "any model")
+		}
+		return nil
+	}
+	for _, modelIDPrefix := range requirement.modelIDPrefixes(message) {
+		if !policy.Allows(token, requirement.scope, modelIDPrefix) {
+			if modelIDPrefix == "" {
+				return a.deny(ctx, requirement.scope, "every model")
+			}
+			return a.deny(ctx, requirement.scope, fmt.Sprintf("model %q", modelIDPrefix))
+		}
+	}
+	return nil
+}
+
+func (a *authorizer) deny(ctx context.Context, scope Scope, target string) error {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"scope": scope, "target": target}).Warn("Permission denied")
+	return status.Errorf(codes.PermissionDenied, "%q scope required on %s", scope, target)
+}
+
+// UnaryServerInterceptor rejects the unary RPCs whose token doesn't allow the scope required on the requested models
+func UnaryServerInterceptor(policy *Policy) grpc.UnaryServerInterceptor {
+	return UnaryServerInterceptorFromStore(CreatePolicyStore(policy))
+}
+
+// UnaryServerInterceptorFromStore is UnaryServerInterceptor checking the RPCs against the current policy of a store
+func UnaryServerInterceptorFromStore(policies *PolicyStore) grpc.UnaryServerInterceptor {
+	a := &authorizer{policies: policies}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, healthMethodPrefix) {
+			return handler(ctx, req)
+		}
+		policy := a.policies.Policy()
+		ctx, token, err := a.authenticate(ctx, policy)
+		if err != nil {
+			return nil, err
+		}
+		err = a.authorize(ctx, policy, token, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// serverStream checks every received message before it reaches the handler
+type serverStream struct {
+	grpc.ServerStream
+	ctx        context.Context
+	authorizer *authorizer
+	policy     *Policy // Policy at the start of the stream
+	token      *Token
+	method     string
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(message interface{}) error {
+	err := s.ServerStream.RecvMsg(message)
+	if err != nil {
+		return err
+	}
+	return s.authorizer.authorize(s.ctx, s.policy, s.token, s.method, message)
+}
+
+// StreamServerInterceptor rejects the streaming RPCs whose token doesn't allow the scope required on the requested models,
+// every received message is checked, e.g. each version header of a CreateVersions stream
+func StreamServerInterceptor(policy *Policy) grpc.StreamServerInterceptor {
+	return StreamServerInterceptorFromStore(CreatePolicyStore(policy))
+}
+
+// StreamServerInterceptorFromStore is StreamServerInterceptor checking the RPCs against the current policy of a store
+func StreamServerInterceptorFromStore(policies *PolicyStore) grpc.StreamServerInterceptor {
+	a := &authorizer{policies: policies}
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if strings.HasPrefix(info.FullMethod, healthMethodPrefix) {
+			return handler(srv, stream)
+		}
+		policy := a.policies.Policy()
+		ctx, token, err := a.authenticate(stream.Context(), policy)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{
+			ServerStream: stream,
+			ctx:          ctx,
+			authorizer:   a,
+			policy:       policy,
+			token:        token,
+			method:       info.FullMethod,
+		})
+	}
+}
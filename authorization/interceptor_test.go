@@ -0,0 +1,365 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpchealth "google.golang.org/grpc/health"
+	healthapi "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+type testContext struct {
+	client           grpcapi.ModelRegistrySPClient
+	extensionsClient extensionsapi.ModelRegistryExtensionsSPClient
+	healthClient     healthapi.HealthClient
+	destroy          func()
+}
+
+func createContext(t *testing.T, policies *PolicyStore) testContext {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptorFromStore(policies)),
+		grpc.ChainStreamInterceptor(StreamServerInterceptorFromStore(policies)),
+	)
+	modelRegistryServer, err := grpcservers.RegisterModelRegistryServer(server, grpcservers.ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 1024 * 1024,
+		PaginationSecret:              []byte("secret"),
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		UploadSessionTimeout:          time.Minute,
+		AuthorizeModel: func(ctx context.Context, modelID string) error {
+			return AuthorizeModel(ctx, WriteScope, modelID)
+		},
+	})
+	assert.NoError(t, err)
+	healthapi.RegisterHealthServer(server, grpchealth.NewServer())
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	modelRegistryServer.SetBackend(b)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	connection, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithInsecure(),
+	)
+	assert.NoError(t, err)
+	return testContext{
+		client:           grpcapi.NewModelRegistrySPClient(connection),
+		extensionsClient: extensionsapi.NewModelRegistryExtensionsSPClient(connection),
+		healthClient:     healthapi.NewHealthClient(connection),
+		destroy: func() {
+			connection.Close()
+			server.Stop()
+			b.Destroy()
+		},
+	}
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), AuthorizationMetadataKey, "Bearer "+token)
+}
+
+func createVersion(client grpcapi.ModelRegistrySPClient, grpcCtx context.Context, modelID string) error {
+	stream, err := client.CreateVersion(grpcCtx)
+	if err != nil {
+		return err
+	}
+	err = stream.Send(&grpcapi.CreateVersionRequestChunk{
+		Msg: &grpcapi.CreateVersionRequestChunk_Header_{
+			Header: &grpcapi.CreateVersionRequestChunk_Header{
+				VersionInfo: &grpcapi.ModelVersionInfo{
+					ModelId:  modelID,
+					Archived: true,
+					DataHash: backend.ComputeSHA256Hash(data),
+					DataSize: uint64(len(data)),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{
+		DataChunk: data,
+	}}})
+	if err != nil {
+		return err
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+func TestInterceptors(t *testing.T) {
+	policy, err := CreatePolicy(
+		map[string][]Permission{
+			"reader":  {{Scopes: []Scope{ReadScope}}},
+			"trainer": {{ModelIDPrefix: "team_a_", Scopes: []Scope{ReadScope, WriteScope}}},
+			"admin":   {{Scopes: []Scope{ReadScope, WriteScope, DeleteScope}}},
+		},
+		[]Token{
+			{Name: "dashboard", SHA256: HashToken("dashboard_token"), Roles: []string{"reader"}},
+			{Name: "trainer", SHA256: HashToken("trainer_token"), Roles: []string{"trainer"}},
+			{Name: "admin", SHA256: HashToken("admin_token"), Roles: []string{"admin"}},
+		},
+	)
+	assert.NoError(t, err)
+	ctx := createContext(t, CreatePolicyStore(policy))
+	defer ctx.destroy()
+
+	dashboardCtx, trainerCtx, adminCtx := withToken("dashboard_token"), withToken("trainer_token"), withToken("admin_token")
+
+	_, err = ctx.client.RetrieveModels(context.Background(), &grpcapi.RetrieveModelsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = ctx.client.RetrieveModels(withToken("unknown_token"), &grpcapi.RetrieveModelsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	for _, modelID := range []string{"team_a_foo", "team_b_foo"} {
+		_, err = ctx.client.CreateOrUpdateModel(dashboardCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID}})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		_, err = ctx.client.CreateOrUpdateModel(adminCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID}})
+		assert.NoError(t, err)
+	}
+
+	// Versions can only be created by the trainer in its models
+	assert.NoError(t, createVersion(ctx.client, trainerCtx, "team_a_foo"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(createVersion(ctx.client, trainerCtx, "team_b_foo")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(createVersion(ctx.client, dashboardCtx, "team_a_foo")))
+	rep, err := ctx.client.RetrieveVersionInfos(adminCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "team_b_foo"})
+	assert.NoError(t, err)
+	assert.Len(t, rep.VersionInfos, 0)
+
+	// Listing every model requires reading every model
+	_, err = ctx.client.RetrieveModels(trainerCtx, &grpcapi.RetrieveModelsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = ctx.client.RetrieveModels(trainerCtx, &grpcapi.RetrieveModelsRequest{ModelIds: []string{"team_a_foo"}})
+	assert.NoError(t, err)
+	_, err = ctx.client.RetrieveModels(dashboardCtx, &grpcapi.RetrieveModelsRequest{})
+	assert.NoError(t, err)
+
+	// Server streaming requests are checked
+	stream, err := ctx.client.RetrieveVersionData(trainerCtx, &grpcapi.RetrieveVersionDataRequest{ModelId: "team_b_foo", VersionNumber: -1})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = ctx.client.DeleteModel(trainerCtx, &grpcapi.DeleteModelRequest{ModelId: "team_a_foo"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = ctx.client.DeleteModel(adminCtx, &grpcapi.DeleteModelRequest{ModelId: "team_a_foo"})
+	assert.NoError(t, err)
+}
+
+func TestHealthWithoutToken(t *testing.T) {
+	policy, err := CreatePolicy(map[string][]Permission{}, []Token{})
+	assert.NoError(t, err)
+	ctx := createContext(t, CreatePolicyStore(policy))
+	defer ctx.destroy()
+
+	rep, err := ctx.healthClient.Check(context.Background(), &healthapi.HealthCheckRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, healthapi.HealthCheckResponse_SERVING, rep.Status)
+	_, err = ctx.extensionsClient.RetrieveStorageInfo(context.Background(), &extensionsapi.RetrieveStorageInfoRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestNamespaceInterceptors(t *testing.T) {
+	policy, err := CreatePolicy(
+		map[string][]Permission{
+			"team_a": {{Namespace: "team_a", Scopes: []Scope{ReadScope, WriteScope}}},
+		},
+		[]Token{{Name: "team_a", SHA256: HashToken("team_a_token"), Roles: []string{"team_a"}}},
+	)
+	assert.NoError(t, err)
+	ctx := createContext(t, CreatePolicyStore(policy))
+	defer ctx.destroy()
+	teamACtx := withToken("team_a_token")
+
+	_, err = ctx.client.CreateOrUpdateModel(teamACtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "team_a.foo"}})
+	assert.NoError(t, err)
+	_, err = ctx.client.CreateOrUpdateModel(teamACtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "team_b.foo"}})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// The models of the namespace can be listed without reading every model
+	_, err = ctx.extensionsClient.QueryModels(teamACtx, &extensionsapi.QueryModelsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	rep, err := ctx.extensionsClient.QueryModels(teamACtx, &extensionsapi.QueryModelsRequest{Namespace: "team_a"})
+	assert.NoError(t, err)
+	assert.Len(t, rep.ModelInfos, 1)
+	_, err = ctx.extensionsClient.QueryModels(teamACtx, &extensionsapi.QueryModelsRequest{Namespace: "team_b"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = ctx.extensionsClient.RetrieveStorageInfo(teamACtx, &extensionsapi.RetrieveStorageInfoRequest{Namespace: "team_a"})
+	assert.NoError(t, err)
+	_, err = ctx.extensionsClient.RetrieveStorageInfo(teamACtx, &extensionsapi.RetrieveStorageInfoRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestUploadAndLeaseModelsAuthorization(t *testing.T) {
+	policy, err := CreatePolicy(
+		map[string][]Permission{
+			"team_a": {{ModelIDPrefix: "team_a_", Scopes: []Scope{ReadScope, WriteScope}}},
+			"team_b": {{ModelIDPrefix: "team_b_", Scopes: []Scope{ReadScope, WriteScope}}},
+		},
+		[]Token{
+			{Name: "team_a", SHA256: HashToken("team_a_token"), Roles: []string{"team_a"}},
+			{Name: "team_b", SHA256: HashToken("team_b_token"), Roles: []string{"team_b"}},
+		},
+	)
+	assert.NoError(t, err)
+	ctx := createContext(t, CreatePolicyStore(policy))
+	defer ctx.destroy()
+	teamACtx := withToken("team_a_token")
+	teamBCtx := withToken("team_b_token")
+	_, err = ctx.client.CreateOrUpdateModel(teamACtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "team_a_foo"}})
+	assert.NoError(t, err)
+	assert.NoError(t, createVersion(ctx.client, teamACtx, "team_a_foo"))
+
+	// The upload id doesn't grant writing its model
+	beginRep, err := ctx.extensionsClient.BeginUpload(teamACtx, &extensionsapi.BeginUploadRequest{VersionInfo: &grpcapi.ModelVersionInfo{
+		ModelId:  "team_a_foo",
+		DataHash: backend.ComputeSHA256Hash(data),
+		DataSize: uint64(len(data)),
+	}})
+	assert.NoError(t, err)
+	_, err = ctx.extensionsClient.AppendChunk(teamBCtx, &extensionsapi.AppendChunkRequest{UploadId: beginRep.UploadId, DataChunk: data})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = ctx.extensionsClient.AppendChunk(teamACtx, &extensionsapi.AppendChunkRequest{UploadId: beginRep.UploadId, DataChunk: data})
+	assert.NoError(t, err)
+	_, err = ctx.extensionsClient.CommitUpload(teamBCtx, &extensionsapi.CommitUploadRequest{UploadId: beginRep.UploadId})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = ctx.extensionsClient.CommitUpload(teamACtx, &extensionsapi.CommitUploadRequest{UploadId: beginRep.UploadId})
+	assert.NoError(t, err)
+
+	// Neither does the lease id
+	leaseRep, err := ctx.extensionsClient.AcquireVersionLease(teamACtx, &extensionsapi.AcquireVersionLeaseRequest{ModelId: "team_a_foo", VersionNumber: 1, Holder: "orchestrator"})
+	assert.NoError(t, err)
+	_, err = ctx.extensionsClient.RenewVersionLease(teamBCtx, &extensionsapi.RenewVersionLeaseRequest{LeaseId: leaseRep.Lease.LeaseId})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = ctx.extensionsClient.ReleaseVersionLease(teamBCtx, &extensionsapi.ReleaseVersionLeaseRequest{LeaseId: leaseRep.Lease.LeaseId})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = ctx.extensionsClient.RenewVersionLease(teamACtx, &extensionsapi.RenewVersionLeaseRequest{LeaseId: leaseRep.Lease.LeaseId})
+	assert.NoError(t, err)
+	_, err = ctx.extensionsClient.ReleaseVersionLease(teamACtx, &extensionsapi.ReleaseVersionLeaseRequest{LeaseId: leaseRep.Lease.LeaseId})
+	assert.NoError(t, err)
+}
+
+func TestPolicyStore(t *testing.T) {
+	roles := map[string][]Permission{"admin": {{Scopes: []Scope{ReadScope, WriteScope, DeleteScope}}}}
+	policy, err := CreatePolicy(roles, []Token{{Name: "old", SHA256: HashToken("old_token"), Roles: []string{"admin"}}})
+	assert.NoError(t, err)
+	policies := CreatePolicyStore(policy)
+	ctx := createContext(t, policies)
+	defer ctx.destroy()
+
+	_, err = ctx.client.CreateOrUpdateModel(withToken("old_token"), &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	rotatedPolicy, err := CreatePolicy(roles, []Token{{Name: "new", SHA256: HashToken("new_token"), Roles: []string{"admin"}}})
+	assert.NoError(t, err)
+	policies.SetPolicy(rotatedPolicy)
+	assert.Equal(t, rotatedPolicy, policies.Policy())
+
+	_, err = ctx.client.RetrieveModels(withToken("old_token"), &grpcapi.RetrieveModelsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = ctx.client.RetrieveModels(withToken("new_token"), &grpcapi.RetrieveModelsRequest{})
+	assert.NoError(t, err)
+}
+
+// testServerStream receives a single create version header
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testServerStream) RecvMsg(message interface{}) error {
+	message.(*grpcapi.CreateVersionRequestChunk).Msg = &grpcapi.CreateVersionRequestChunk_Header_{
+		Header: &grpcapi.CreateVersionRequestChunk_Header{VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo"}},
+	}
+	return nil
+}
+
+func TestPolicyStoreKeepsStreamPolicy(t *testing.T) {
+	roles := map[string][]Permission{"writer": {{Scopes: []Scope{WriteScope}}}}
+	policy, err := CreatePolicy(roles, []Token{{Name: "old", SHA256: HashToken("old_token"), Roles: []string{"writer"}}})
+	assert.NoError(t, err)
+	policies := CreatePolicyStore(policy)
+	interceptor := StreamServerInterceptorFromStore(policies)
+
+	incomingCtx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AuthorizationMetadataKey, "Bearer old_token"))
+	err = interceptor(nil, &testServerStream{ctx: incomingCtx}, &grpc.StreamServerInfo{FullMethod: "/cogmentAPI.ModelRegistrySP/CreateVersion"}, func(srv interface{}, stream grpc.ServerStream) error {
+		// A stream started before the replacement keeps the previous policy
+		rotatedPolicy, err := CreatePolicy(roles, []Token{})
+		assert.NoError(t, err)
+		policies.SetPolicy(rotatedPolicy)
+		return stream.RecvMsg(&grpcapi.CreateVersionRequestChunk{})
+	})
+	assert.NoError(t, err)
+}
+
+func TestRequirementsCoverEveryMethod(t *testing.T) {
+	for _, serviceDesc := range []grpc.ServiceDesc{grpcapi.ModelRegistrySP_ServiceDesc, extensionsapi.ModelRegistryExtensionsSP_ServiceDesc} {
+		for _, method := range serviceDesc.Methods {
+			assert.Contains(t, requirements, "/"+serviceDesc.ServiceName+"/"+method.MethodName)
+		}
+		for _, stream := range serviceDesc.Streams {
+			assert.Contains(t, requirements, "/"+serviceDesc.ServiceName+"/"+stream.StreamName)
+		}
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	scope, ok := RequiredScope("/cogmentAPI.ModelRegistrySP/RetrieveModels")
+	assert.True(t, ok)
+	assert.Equal(t, ReadScope, scope)
+
+	scope, ok = RequiredScope("/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/DeleteVersion")
+	assert.True(t, ok)
+	assert.Equal(t, DeleteScope, scope)
+
+	scope, ok = RequiredScope("/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/UnlockVersion")
+	assert.True(t, ok)
+	assert.Equal(t, AdminScope, scope)
+
+	_, ok = RequiredScope("/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo")
+	assert.False(t, ok)
+}
+
+func TestCascadingDeletionRequiresEveryModel(t *testing.T) {
+	modelIDPrefixes := requirements["/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/DeleteVersion"].modelIDPrefixes
+	assert.Equal(t, []string{"team_a_foo"}, modelIDPrefixes(&extensionsapi.DeleteVersionRequest{ModelId: "team_a_foo"}))
+	assert.Equal(t, []string{""}, modelIDPrefixes(&extensionsapi.DeleteVersionRequest{ModelId: "team_a_foo", Cascade: true}))
+}
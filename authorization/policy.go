@@ -0,0 +1,221 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/cogment/cogment-model-registry/namespaces"
+)
+
+// Scope is a kind of operation a permission allows
+type Scope string
+
+const (
+	ReadScope   Scope = "read"   // Retrieve, query and watch models and versions
+	WriteScope  Scope = "write"  // Create and update models and versions
+	DeleteScope Scope = "delete" // Delete models and versions
+	AdminScope  Scope = "admin"  // Unlock versions
+)
+
+// Permission allows some scopes on the models whose id starts with a prefix, an empty prefix matches every model
+//
+// A permission with a namespace only applies to the models of this namespace, its prefix is then relative to it.
+type Permission struct {
+	Namespace     string  `yaml:"namespace"`
+	ModelIDPrefix string  `yaml:"model_id_prefix"`
+	Scopes        []Scope `yaml:"scopes"`
+}
+
+// modelIDPrefix is the prefix of the ids of the models the permission applies to
+func (p Permission) modelIDPrefix() string {
+	return namespaces.ModelIDPrefix(p.Namespace) + p.ModelIDPrefix
+}
+
+// Token grants roles to the clients presenting it, only the SHA-256 hash of the token is stored
+type Token struct {
+	Name   string   `yaml:"name"`
+	SHA256 string   `yaml:"sha256"`
+	Roles  []string `yaml:"roles"`
+	Tenant string   `yaml:"tenant"` // Tenant whose backend serves the requests presenting the token, the default one when empty
+}
+
+// Policy defines the roles and the tokens granting them
+type Policy struct {
+	Roles  map[string][]Permission `yaml:"roles"`
+	Tokens []Token                 `yaml:"tokens"`
+
+	tokensBySHA256 map[string]*Token
+}
+
+// InvalidPolicyError is raised when a policy is inconsistent
+type InvalidPolicyError struct {
+	Reason string
+}
+
+func (e *InvalidPolicyError) Error() string {
+	return fmt.Sprintf("invalid authorization policy, %s", e.Reason)
+}
+
+// LoadPolicy loads a policy from a YAML file
+func LoadPolicy(filename string) (*Policy, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the authorization policy from %q: %w", filename, err)
+	}
+	policy := &Policy{}
+	err = yaml.UnmarshalStrict(content, policy)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the authorization policy from %q: %w", filename, err)
+	}
+	err = policy.index()
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// CreatePolicy creates a policy from roles and tokens
+func CreatePolicy(roles map[string][]Permission, tokens []Token) (*Policy, error) {
+	policy := &Policy{Roles: roles, Tokens: tokens}
+	err := policy.index()
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (p *Policy) index() error {
+	for role, permissions := range p.Roles {
+		for _, permission := range permissions {
+			if permission.Namespace != "" {
+				if err := namespaces.ValidateName(permission.Namespace); err != nil {
+					return &InvalidPolicyError{Reason: fmt.Sprintf("role %q has an %s", role, err)}
+				}
+			}
+			for _, scope := range permission.Scopes {
+				if scope != ReadScope && scope != WriteScope && scope != DeleteScope && scope != AdminScope {
+					return &InvalidPolicyError{Reason: fmt.Sprintf("role %q has unknown scope %q, expecting %q, %q, %q or %q", role, scope, ReadScope, WriteScope, DeleteScope, AdminScope)}
+				}
+			}
+		}
+	}
+	p.tokensBySHA256 = make(map[string]*Token)
+	for i := range p.Tokens {
+		token := &p.Tokens[i]
+		hash := strings.ToLower(token.SHA256)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+			return &InvalidPolicyError{Reason: fmt.Sprintf("token %q has an invalid sha256 %q", token.Name, token.SHA256)}
+		}
+		if _, ok := p.tokensBySHA256[hash]; ok {
+			return &InvalidPolicyError{Reason: fmt.Sprintf("token %q is defined twice", token.Name)}
+		}
+		for _, role := range token.Roles {
+			if _, ok := p.Roles[role]; !ok {
+				return &InvalidPolicyError{Reason: fmt.Sprintf("token %q has unknown role %q", token.Name, role)}
+			}
+		}
+		p.tokensBySHA256[hash] = token
+	}
+	return nil
+}
+
+// PolicyStore holds a policy that can be replaced while the RPCs using it are running
+type PolicyStore struct {
+	policy atomic.Value
+}
+
+// CreatePolicyStore creates a store holding a policy
+func CreatePolicyStore(policy *Policy) *PolicyStore {
+	store := &PolicyStore{}
+	store.SetPolicy(policy)
+	return store
+}
+
+// Policy retrieves the current policy
+func (s *PolicyStore) Policy() *Policy {
+	return s.policy.Load().(*Policy)
+}
+
+// SetPolicy replaces the current policy for the RPCs started afterward, the streams in progress keep the previous one
+func (s *PolicyStore) SetPolicy(policy *Policy) {
+	s.policy.Store(policy)
+}
+
+// Tenant resolves the tenant of the token presented in the metadata of an incoming RPC, case insensitive, empty for
+// the default tenant or when the token is missing or unknown, the authorization then rejects the RPC anyway
+func (s *PolicyStore) Tenant(ctx context.Context) string {
+	presentedToken, ok := bearerToken(ctx)
+	if !ok {
+		return ""
+	}
+	token, ok := s.Policy().LookupToken(presentedToken)
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(token.Tenant)
+}
+
+// HashToken computes the hash of a token as stored in a policy
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// LookupToken retrieves the token definition matching a token presented by a client
+func (p *Policy) LookupToken(token string) (*Token, bool) {
+	definition, ok := p.tokensBySHA256[HashToken(token)]
+	return definition, ok
+}
+
+// AllowsAny checks whether the roles of a token allow a scope on at least some models, in any namespace
+func (p *Policy) AllowsAny(token *Token, scope Scope) bool {
+	for _, role := range token.Roles {
+		for _, permission := range p.Roles[role] {
+			for _, permissionScope := range permission.Scopes {
+				if permissionScope == scope {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Allows checks whether the roles of a token allow a scope on every model whose id starts with the given prefix,
+// use a model id as the prefix to check a single model.
+func (p *Policy) Allows(token *Token, scope Scope, modelIDPrefix string) bool {
+	for _, role := range token.Roles {
+		for _, permission := range p.Roles[role] {
+			if !strings.HasPrefix(modelIDPrefix, permission.modelIDPrefix()) {
+				continue
+			}
+			for _, permissionScope := range permission.Scopes {
+				if permissionScope == scope {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
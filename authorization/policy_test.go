@@ -0,0 +1,136 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	err := os.WriteFile(filename, []byte(`
+roles:
+  reader:
+    - scopes: [read]
+  trainer:
+    - model_id_prefix: "team_a/"
+      scopes: [read, write]
+  operator:
+    - scopes: [admin]
+tokens:
+  - name: dashboard
+    sha256: `+HashToken("dashboard_token")+`
+    roles: [reader]
+  - name: trainer
+    sha256: `+HashToken("trainer_token")+`
+    roles: [trainer]
+  - name: operator
+    sha256: `+HashToken("operator_token")+`
+    roles: [operator]
+`), 0600)
+	assert.NoError(t, err)
+
+	policy, err := LoadPolicy(filename)
+	assert.NoError(t, err)
+
+	_, ok := policy.LookupToken("unknown_token")
+	assert.False(t, ok)
+
+	dashboard, ok := policy.LookupToken("dashboard_token")
+	assert.True(t, ok)
+	assert.Equal(t, "dashboard", dashboard.Name)
+	assert.True(t, policy.Allows(dashboard, ReadScope, ""))
+	assert.True(t, policy.Allows(dashboard, ReadScope, "team_b/foo"))
+	assert.False(t, policy.Allows(dashboard, WriteScope, "team_a/foo"))
+	assert.False(t, policy.AllowsAny(dashboard, WriteScope))
+
+	trainer, ok := policy.LookupToken("trainer_token")
+	assert.True(t, ok)
+	assert.True(t, policy.Allows(trainer, WriteScope, "team_a/foo"))
+	assert.True(t, policy.Allows(trainer, ReadScope, "team_a/"))
+	assert.False(t, policy.Allows(trainer, ReadScope, "team_b/foo"))
+	assert.False(t, policy.Allows(trainer, ReadScope, ""))
+	assert.False(t, policy.Allows(trainer, DeleteScope, "team_a/foo"))
+	assert.True(t, policy.AllowsAny(trainer, WriteScope))
+	assert.False(t, policy.AllowsAny(trainer, AdminScope))
+
+	operator, ok := policy.LookupToken("operator_token")
+	assert.True(t, ok)
+	assert.True(t, policy.Allows(operator, AdminScope, "team_a/foo"))
+	assert.False(t, policy.Allows(operator, DeleteScope, "team_a/foo"))
+}
+
+func TestNamespacePermissions(t *testing.T) {
+	policy, err := CreatePolicy(map[string][]Permission{
+		"team_a": {{Namespace: "team_a", Scopes: []Scope{ReadScope, WriteScope}}},
+		"tuner":  {{Namespace: "team_b", ModelIDPrefix: "tuned_", Scopes: []Scope{WriteScope}}},
+	}, []Token{
+		{Name: "team_a", SHA256: HashToken("team_a_token"), Roles: []string{"team_a"}},
+		{Name: "tuner", SHA256: HashToken("tuner_token"), Roles: []string{"tuner"}},
+	})
+	assert.NoError(t, err)
+
+	teamA, _ := policy.LookupToken("team_a_token")
+	assert.True(t, policy.Allows(teamA, WriteScope, "team_a.foo"))
+	assert.True(t, policy.Allows(teamA, ReadScope, "team_a."))
+	assert.False(t, policy.Allows(teamA, ReadScope, "team_ab.foo"))
+	assert.False(t, policy.Allows(teamA, ReadScope, "foo"))
+	assert.False(t, policy.Allows(teamA, ReadScope, ""))
+
+	tuner, _ := policy.LookupToken("tuner_token")
+	assert.True(t, policy.Allows(tuner, WriteScope, "team_b.tuned_foo"))
+	assert.False(t, policy.Allows(tuner, WriteScope, "team_b.foo"))
+	assert.False(t, policy.Allows(tuner, WriteScope, "tuned_foo"))
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		roles  map[string][]Permission
+		tokens []Token
+	}{
+		{
+			name:  "unknown scope",
+			roles: map[string][]Permission{"admin": {{Scopes: []Scope{"everything"}}}},
+		},
+		{
+			name:   "unknown role",
+			roles:  map[string][]Permission{"admin": {{Scopes: []Scope{ReadScope}}}},
+			tokens: []Token{{Name: "foo", SHA256: HashToken("foo"), Roles: []string{"reader"}}},
+		},
+		{
+			name:  "invalid namespace",
+			roles: map[string][]Permission{"team": {{Namespace: "team.a", Scopes: []Scope{ReadScope}}}},
+		},
+		{
+			name:   "invalid hash",
+			tokens: []Token{{Name: "foo", SHA256: "foo"}},
+		},
+		{
+			name:   "duplicated token",
+			tokens: []Token{{Name: "foo", SHA256: HashToken("foo")}, {Name: "bar", SHA256: HashToken("foo")}},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := CreatePolicy(c.roles, c.tokens)
+			assert.Error(t, err)
+			assert.IsType(t, &InvalidPolicyError{}, err)
+		})
+	}
+}
@@ -0,0 +1,550 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bbolt
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	modelsBucketName   = []byte("models")
+	modelInfoKey       = []byte("info")
+	versionsBucketName = []byte("versions")
+	dataBucketName     = []byte("data")
+)
+
+type bboltModelInfo struct {
+	ModelID  string            `json:"model_id"`
+	UserData map[string]string `json:"user_data"`
+}
+
+type bboltVersionInfo struct {
+	ModelID           string            `json:"model_id"`
+	VersionNumber     uint              `json:"version_number"`
+	CreationTimestamp time.Time         `json:"creation_timestamp"`
+	Archived          bool              `json:"archived"`
+	DataHash          string            `json:"data_hash"`
+	DataSize          int               `json:"data_size"`
+	UserData          map[string]string `json:"user_data"`
+}
+
+func (v bboltVersionInfo) toVersionInfo() backend.VersionInfo {
+	return backend.VersionInfo{
+		ModelID:           v.ModelID,
+		VersionNumber:     v.VersionNumber,
+		CreationTimestamp: v.CreationTimestamp,
+		Archived:          v.Archived,
+		DataHash:          v.DataHash,
+		DataSize:          v.DataSize,
+		UserData:          v.UserData,
+	}
+}
+
+type bboltBackend struct {
+	db *bolt.DB
+}
+
+// CreateBackend creates a new backend storing models and versions in a single bbolt database file
+//
+// Each model has its own bucket, nested in the `models` bucket, holding:
+// - the model info at the `info` key,
+// - the versions info in the nested `versions` bucket, keyed by version number,
+// - the versions data in the nested `data` bucket, keyed by version number.
+func CreateBackend(filename string) (backend.Backend, error) {
+	err := os.MkdirAll(filepath.Dir(filename), 0750)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create bbolt backend in %q: %w", filename, err)
+	}
+	db, err := bolt.Open(filename, 0640, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create bbolt backend in %q: %w", filename, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(modelsBucketName)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to create bbolt backend in %q: %w", filename, err)
+	}
+	return &bboltBackend{
+		db: db,
+	}, nil
+}
+
+// Destroy terminates the underlying storage
+func (b *bboltBackend) Destroy() {
+	b.db.Close()
+}
+
+// BindContext returns the backend itself, its transactions on the local database file aren't interrupted
+func (b *bboltBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	return b, true
+}
+
+func (b *bboltBackend) Ping() error {
+	// Fails once the database is closed
+	return b.db.View(func(tx *bolt.Tx) error { return nil })
+}
+
+func encodeVersionNumber(versionNumber uint) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(versionNumber))
+	return key
+}
+
+func decodeVersionNumber(key []byte) uint {
+	return uint(binary.BigEndian.Uint64(key))
+}
+
+func modelBucket(tx *bolt.Tx, modelID string) *bolt.Bucket {
+	return tx.Bucket(modelsBucketName).Bucket([]byte(modelID))
+}
+
+func loadModelInfo(bucket *bolt.Bucket) (backend.ModelInfo, error) {
+	modelInfo := bboltModelInfo{}
+	err := json.Unmarshal(bucket.Get(modelInfoKey), &modelInfo)
+	if err != nil {
+		return backend.ModelInfo{}, fmt.Errorf("unable to deserialize model info: %w", err)
+	}
+	return backend.ModelInfo{
+		ModelID:  modelInfo.ModelID,
+		UserData: modelInfo.UserData,
+	}, nil
+}
+
+func loadVersionInfo(serializedVersionInfo []byte) (backend.VersionInfo, error) {
+	versionInfo := bboltVersionInfo{}
+	err := json.Unmarshal(serializedVersionInfo, &versionInfo)
+	if err != nil {
+		return backend.VersionInfo{}, fmt.Errorf("unable to deserialize version info: %w", err)
+	}
+	return versionInfo.toVersionInfo(), nil
+}
+
+// resolveVersionKey retrieves the key of a version in the given model bucket, negative version numbers denote the nth to last version
+func resolveVersionKey(bucket *bolt.Bucket, modelID string, versionNumber int) ([]byte, error) {
+	if versionNumber == 0 {
+		return nil, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	if bucket == nil {
+		if versionNumber > 0 {
+			return nil, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return nil, &backend.UnknownModelError{ModelID: modelID}
+	}
+	versionsBucket := bucket.Bucket(versionsBucketName)
+	if versionNumber > 0 {
+		key := encodeVersionNumber(uint(versionNumber))
+		if versionsBucket.Get(key) == nil {
+			return nil, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return key, nil
+	}
+	// Retrieve the nth to last version
+	cursor := versionsBucket.Cursor()
+	key, _ := cursor.Last()
+	for i := 0; key != nil && i < -versionNumber-1; i++ {
+		key, _ = cursor.Prev()
+	}
+	if key == nil {
+		return nil, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	return key, nil
+}
+
+func (b *bboltBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	modelInfo := backend.ModelInfo{
+		ModelID:  modelArgs.ModelID,
+		UserData: modelArgs.UserData,
+	}
+	serializedModelInfo, err := json.Marshal(bboltModelInfo{
+		ModelID:  modelInfo.ModelID,
+		UserData: modelInfo.UserData,
+	})
+	if err != nil {
+		return backend.ModelInfo{}, fmt.Errorf("unable to save model %q: json serialization failed %w", modelInfo.ModelID, err)
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(modelsBucketName).CreateBucketIfNotExists([]byte(modelInfo.ModelID))
+		if err != nil {
+			return err
+		}
+		_, err = bucket.CreateBucketIfNotExists(versionsBucketName)
+		if err != nil {
+			return err
+		}
+		_, err = bucket.CreateBucketIfNotExists(dataBucketName)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(modelInfoKey, serializedModelInfo)
+	})
+	if err != nil {
+		return backend.ModelInfo{}, fmt.Errorf("unable to save model %q: %w", modelInfo.ModelID, err)
+	}
+	return modelInfo, nil
+}
+
+func (b *bboltBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	var modelInfo backend.ModelInfo
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := modelBucket(tx, modelID)
+		if bucket == nil {
+			return &backend.UnknownModelError{ModelID: modelID}
+		}
+		var err error
+		modelInfo, err = loadModelInfo(bucket)
+		return err
+	})
+	if err != nil {
+		return backend.ModelInfo{}, err
+	}
+	return modelInfo, nil
+}
+
+func (b *bboltBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	var latestVersionNumber uint
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := modelBucket(tx, modelID)
+		if bucket == nil {
+			return &backend.UnknownModelError{ModelID: modelID}
+		}
+		key, _ := bucket.Bucket(versionsBucketName).Cursor().Last()
+		if key != nil {
+			latestVersionNumber = decodeVersionNumber(key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return latestVersionNumber, nil
+}
+
+// HasModel checks if a model exists
+func (b *bboltBackend) HasModel(modelID string) (bool, error) {
+	hasModel := false
+	err := b.db.View(func(tx *bolt.Tx) error {
+		hasModel = modelBucket(tx, modelID) != nil
+		return nil
+	})
+	return hasModel, err
+}
+
+// DeleteModel deletes a model with a given id from the storage
+func (b *bboltBackend) DeleteModel(modelID string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(modelsBucketName).DeleteBucket([]byte(modelID))
+		if err == bolt.ErrBucketNotFound {
+			return &backend.UnknownModelError{ModelID: modelID}
+		}
+		if err != nil {
+			return fmt.Errorf("unable to delete model %q: %w", modelID, err)
+		}
+		return nil
+	})
+}
+
+// ListModels list models ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *bboltBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	models := []backend.ModelInfo{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		modelsBucket := tx.Bucket(modelsBucketName)
+		cursor := modelsBucket.Cursor()
+		modelIdx := 0
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			if value != nil {
+				// Not a bucket
+				continue
+			}
+			if modelIdx < offset {
+				modelIdx++
+				continue
+			}
+			modelInfo, err := loadModelInfo(modelsBucket.Bucket(key))
+			if err != nil {
+				return err
+			}
+			models = append(models, modelInfo)
+			modelIdx++
+			if limit > 0 && len(models) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return []backend.ModelInfo{}, fmt.Errorf("unable to list models: %w", err)
+	}
+	return models, nil
+}
+
+// QueryModels list models selected by the filter ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *bboltBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return backend.QueryModelsByListing(b, filter, offset, limit)
+}
+
+// CreateOrUpdateModelVersion creates and store a new version for a model and returns its info, including the version number
+//
+// The version info and data are stored in a single transaction
+func (b *bboltBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	versionInfo := bboltVersionInfo{
+		ModelID:           modelID,
+		VersionNumber:     versionArgs.VersionNumber,
+		CreationTimestamp: versionArgs.CreationTimestamp,
+		Archived:          versionArgs.Archived,
+		DataHash:          versionArgs.DataHash,
+		DataSize:          len(versionArgs.Data),
+		UserData:          versionArgs.UserData,
+	}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := modelBucket(tx, modelID)
+		if bucket == nil {
+			return &backend.UnknownModelError{ModelID: modelID}
+		}
+		versionsBucket := bucket.Bucket(versionsBucketName)
+		if versionInfo.VersionNumber == 0 {
+			// Create a new version after the last one
+			versionInfo.VersionNumber = 1
+			if key, _ := versionsBucket.Cursor().Last(); key != nil {
+				versionInfo.VersionNumber = decodeVersionNumber(key) + 1
+			}
+		}
+		key := encodeVersionNumber(versionInfo.VersionNumber)
+		if existingSerializedVersionInfo := versionsBucket.Get(key); existingSerializedVersionInfo != nil {
+			// Update an existing version
+			existingVersionInfo, err := loadVersionInfo(existingSerializedVersionInfo)
+			if err != nil {
+				return err
+			}
+			versionInfo.CreationTimestamp = existingVersionInfo.CreationTimestamp
+		}
+		serializedVersionInfo, err := json.Marshal(versionInfo)
+		if err != nil {
+			return fmt.Errorf("json serialization failed %w", err)
+		}
+		err = versionsBucket.Put(key, serializedVersionInfo)
+		if err != nil {
+			return err
+		}
+		return bucket.Bucket(dataBucketName).Put(key, versionArgs.Data)
+	})
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return backend.VersionInfo{}, err
+		}
+		return backend.VersionInfo{}, fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+	}
+	return versionInfo.toVersionInfo(), nil
+}
+
+// CreateOrUpdateModelVersionStream creates a writer accumulating the data in memory, it is stored in a single transaction on commit
+func (b *bboltBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	hasModel, err := b.HasModel(modelID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasModel {
+		return nil, &backend.UnknownModelError{ModelID: modelID}
+	}
+	return backend.CreateBufferedVersionDataWriter(b, modelID, versionArgs), nil
+}
+
+// RetrieveModelVersionInfo retrieves a given model version info
+func (b *bboltBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := modelBucket(tx, modelID)
+		key, err := resolveVersionKey(bucket, modelID, versionNumber)
+		if err != nil {
+			return err
+		}
+		versionInfo, err = loadVersionInfo(bucket.Bucket(versionsBucketName).Get(key))
+		return err
+	})
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return versionInfo, nil
+}
+
+// RetrieveModelVersionData retrieves a given model version data
+func (b *bboltBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	var versionData []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := modelBucket(tx, modelID)
+		key, err := resolveVersionKey(bucket, modelID, versionNumber)
+		if err != nil {
+			return err
+		}
+		// Values are only valid during the transaction
+		versionData = append([]byte{}, bucket.Bucket(dataBucketName).Get(key)...)
+		return nil
+	})
+	if err != nil {
+		return []byte{}, err
+	}
+	return versionData, nil
+}
+
+// RetrieveModelVersionDataRange retrieves a range of a given model version data
+func (b *bboltBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	var versionData []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := modelBucket(tx, modelID)
+		key, err := resolveVersionKey(bucket, modelID, versionNumber)
+		if err != nil {
+			return err
+		}
+		// Values are only valid during the transaction, only the range is copied
+		versionData, err = backend.SliceDataRange(modelID, versionNumber, bucket.Bucket(dataBucketName).Get(key), offset, length)
+		return err
+	})
+	if err != nil {
+		return []byte{}, err
+	}
+	return versionData, nil
+}
+
+// DeleteModelVersion deletes a given model version
+// UpdateModelVersionArchived changes whether a given model version is archived, its data is left untouched
+func (b *bboltBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := modelBucket(tx, modelID)
+		key, err := resolveVersionKey(bucket, modelID, versionNumber)
+		if err != nil {
+			return err
+		}
+		versionsBucket := bucket.Bucket(versionsBucketName)
+		storedVersionInfo := bboltVersionInfo{}
+		err = json.Unmarshal(versionsBucket.Get(key), &storedVersionInfo)
+		if err != nil {
+			return fmt.Errorf("unable to deserialize version info: %w", err)
+		}
+		storedVersionInfo.Archived = archived
+		serializedVersionInfo, err := json.Marshal(storedVersionInfo)
+		if err != nil {
+			return fmt.Errorf("json serialization failed %w", err)
+		}
+		versionInfo = storedVersionInfo.toVersionInfo()
+		return versionsBucket.Put(key, serializedVersionInfo)
+	})
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return backend.VersionInfo{}, err
+		}
+		return backend.VersionInfo{}, fmt.Errorf(`unable to update model %q version "%d": %w`, modelID, versionNumber, err)
+	}
+	return versionInfo, nil
+}
+
+// UpdateModelVersionUserData replaces the user data of a given model version, its data is left untouched
+func (b *bboltBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := modelBucket(tx, modelID)
+		key, err := resolveVersionKey(bucket, modelID, versionNumber)
+		if err != nil {
+			return err
+		}
+		versionsBucket := bucket.Bucket(versionsBucketName)
+		storedVersionInfo := bboltVersionInfo{}
+		err = json.Unmarshal(versionsBucket.Get(key), &storedVersionInfo)
+		if err != nil {
+			return fmt.Errorf("unable to deserialize version info: %w", err)
+		}
+		storedVersionInfo.UserData = userData
+		serializedVersionInfo, err := json.Marshal(storedVersionInfo)
+		if err != nil {
+			return fmt.Errorf("json serialization failed %w", err)
+		}
+		versionInfo = storedVersionInfo.toVersionInfo()
+		return versionsBucket.Put(key, serializedVersionInfo)
+	})
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return backend.VersionInfo{}, err
+		}
+		return backend.VersionInfo{}, fmt.Errorf(`unable to update model %q version "%d": %w`, modelID, versionNumber, err)
+	}
+	return versionInfo, nil
+}
+
+func (b *bboltBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := modelBucket(tx, modelID)
+		key, err := resolveVersionKey(bucket, modelID, versionNumber)
+		if err != nil {
+			return err
+		}
+		err = bucket.Bucket(versionsBucketName).Delete(key)
+		if err != nil {
+			return fmt.Errorf(`unable to delete model %q version "%d" info: %w`, modelID, decodeVersionNumber(key), err)
+		}
+		err = bucket.Bucket(dataBucketName).Delete(key)
+		if err != nil {
+			return fmt.Errorf(`unable to delete model %q version "%d" data: %w`, modelID, decodeVersionNumber(key), err)
+		}
+		return nil
+	})
+}
+
+func (b *bboltBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	versions := []backend.VersionInfo{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := modelBucket(tx, modelID)
+		if bucket == nil {
+			return &backend.UnknownModelError{ModelID: modelID}
+		}
+		cursor := bucket.Bucket(versionsBucketName).Cursor()
+		for key, value := cursor.Seek(encodeVersionNumber(initialVersionNumber)); key != nil; key, value = cursor.Next() {
+			versionInfo, err := loadVersionInfo(value)
+			if err != nil {
+				return fmt.Errorf("unable to list versions of model %q: %w", modelID, err)
+			}
+			versions = append(versions, versionInfo)
+			if limit > 0 && len(versions) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+	return versions, nil
+}
+
+// QueryModelVersionInfos lists the versions selected by the filter ordered by version number from the given initial version number, it returns at most the given limit number of versions
+func (b *bboltBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return backend.QueryModelVersionInfosByListing(b, modelID, filter, initialVersionNumber, limit)
+}
+
+// RetrieveStorageCapacity retrieves the capacity of the filesystem holding the database file
+func (b *bboltBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return backend.RetrieveFilesystemCapacity(b.db.Path())
+}
@@ -0,0 +1,437 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package circuitBreaker
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/sirupsen/logrus"
+)
+
+// Metrics published by every circuit breaker under `/debug/vars`
+var (
+	openedMetric   = expvar.NewInt("backend_circuit_opened")
+	rejectedMetric = expvar.NewInt("backend_circuit_rejected_operations")
+)
+
+type Configuration struct {
+	FailureThreshold int           // Number of consecutive failed operations opening the circuit
+	OpenDuration     time.Duration // Delay during which the operations are rejected once the circuit is open
+	SlowCallDuration time.Duration // Operations lasting longer count as failed, 0 means they never do
+}
+
+type state int
+
+const (
+	closed   state = iota // The operations reach the backend
+	open                  // The operations are rejected until the end of the open duration
+	halfOpen              // A single trial operation reaches the backend, closing the circuit if it succeeds
+)
+
+// OpenCircuitError is raised by the operations rejected while the circuit is open
+type OpenCircuitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OpenCircuitError) Error() string {
+	return fmt.Sprintf("the backend is failing, its operations are rejected for %s", e.RetryAfter.Round(time.Millisecond))
+}
+
+// Breaker tracks the failures of the operations of a backend and opens the circuit when it is failing hard
+type Breaker struct {
+	configuration Configuration
+
+	mutex               sync.Mutex
+	state               state
+	consecutiveFailures int
+	openedAt            time.Time
+	trialInFlight       bool
+}
+
+// CreateBreaker creates a closed circuit breaker
+//
+// The circuit opens after the configured number of consecutive operations failing with a transient error, as classified
+// by `backend.IsTransient`, or lasting longer than the slow call duration. The operations are then rejected with an
+// `OpenCircuitError` during the open duration, after which a single trial operation is let through, closing the circuit
+// if it succeeds and opening it again otherwise.
+func CreateBreaker(configuration Configuration) *Breaker {
+	return &Breaker{configuration: configuration}
+}
+
+// State returns the state of the circuit, "closed", "open" or "half-open"
+func (b *Breaker) State() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case open:
+		return "open"
+	case halfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// RetryAfter returns how long the operations are going to be rejected, 0 when they can be attempted
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.retryAfter()
+}
+
+func (b *Breaker) retryAfter() time.Duration {
+	switch b.state {
+	case open:
+		retryAfter := time.Until(b.openedAt.Add(b.configuration.OpenDuration))
+		if retryAfter < 0 {
+			return 0
+		}
+		return retryAfter
+	case halfOpen:
+		if b.trialInFlight {
+			return b.configuration.OpenDuration
+		}
+	}
+	return 0
+}
+
+// begin lets an operation through or rejects it, done is to be called with the result of the operation
+func (b *Breaker) begin() (func(err error), error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if retryAfter := b.retryAfter(); retryAfter > 0 {
+		rejectedMetric.Add(1)
+		return nil, &OpenCircuitError{RetryAfter: retryAfter}
+	}
+	trial := false
+	if b.state != closed {
+		b.state = halfOpen
+		b.trialInFlight = true
+		trial = true
+	}
+
+	var slowCallTimer *time.Timer
+	if b.configuration.SlowCallDuration > 0 {
+		slowCallTimer = time.AfterFunc(b.configuration.SlowCallDuration, func() {
+			b.record(true, trial)
+		})
+	}
+	return func(err error) {
+		if slowCallTimer != nil && !slowCallTimer.Stop() {
+			// Already recorded as failed
+			return
+		}
+		b.record(backend.IsTransient(err), trial)
+	}, nil
+}
+
+// record updates the state of the circuit from the result of an operation
+func (b *Breaker) record(failed bool, trial bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if trial {
+		b.trialInFlight = false
+		if failed {
+			b.trip()
+		} else {
+			logrus.Info("Backend circuit closed, the trial operation succeeded")
+			b.state = closed
+			b.consecutiveFailures = 0
+		}
+		return
+	}
+	// The results of the operations started before the circuit opened don't change it
+	if b.state != closed {
+		return
+	}
+	if !failed {
+		b.consecutiveFailures = 0
+		return
+	}
+	b.consecutiveFailures++
+	if b.consecutiveFailures >= b.configuration.FailureThreshold {
+		b.trip()
+	}
+}
+
+func (b *Breaker) trip() {
+	logrus.WithFields(logrus.Fields{"consecutive_failures": b.consecutiveFailures, "open_duration": b.configuration.OpenDuration}).Warn("Backend circuit opened, its operations are rejected")
+	openedMetric.Add(1)
+	b.state = open
+	b.openedAt = time.Now()
+}
+
+type circuitBreakerBackend struct {
+	backend backend.Backend
+	breaker *Breaker
+}
+
+// CreateBackend creates a new backend whose operations go through a circuit breaker
+//
+// Pings aren't rejected nor recorded, the health checks always reach the backend. The underlying backend is not
+// destroyed with the created backend.
+func CreateBackend(b backend.Backend, breaker *Breaker) (backend.Backend, error) {
+	return &circuitBreakerBackend{
+		backend: b,
+		breaker: breaker,
+	}, nil
+}
+
+func (b *circuitBreakerBackend) Destroy() {
+}
+
+// BindContext binds the underlying backend to the context, the bound operations go through the same circuit
+func (b *circuitBreakerBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	boundBackend, ok := backend.BindContext(b.backend, ctx)
+	if !ok {
+		return nil, false
+	}
+	return &circuitBreakerBackend{backend: boundBackend, breaker: b.breaker}, true
+}
+
+func (b *circuitBreakerBackend) call(do func() error) error {
+	done, err := b.breaker.begin()
+	if err != nil {
+		return err
+	}
+	err = do()
+	done(err)
+	return err
+}
+
+func (b *circuitBreakerBackend) Ping() error {
+	return b.backend.Ping()
+}
+
+func (b *circuitBreakerBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	var modelInfo backend.ModelInfo
+	err := b.call(func() error {
+		var err error
+		modelInfo, err = b.backend.CreateOrUpdateModel(modelArgs)
+		return err
+	})
+	return modelInfo, err
+}
+
+func (b *circuitBreakerBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	var modelInfo backend.ModelInfo
+	err := b.call(func() error {
+		var err error
+		modelInfo, err = b.backend.RetrieveModelInfo(modelID)
+		return err
+	})
+	return modelInfo, err
+}
+
+func (b *circuitBreakerBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	var versionNumber uint
+	err := b.call(func() error {
+		var err error
+		versionNumber, err = b.backend.RetrieveModelLatestVersionNumber(modelID)
+		return err
+	})
+	return versionNumber, err
+}
+
+func (b *circuitBreakerBackend) HasModel(modelID string) (bool, error) {
+	var hasModel bool
+	err := b.call(func() error {
+		var err error
+		hasModel, err = b.backend.HasModel(modelID)
+		return err
+	})
+	return hasModel, err
+}
+
+func (b *circuitBreakerBackend) DeleteModel(modelID string) error {
+	return b.call(func() error {
+		return b.backend.DeleteModel(modelID)
+	})
+}
+
+func (b *circuitBreakerBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	var modelInfos []backend.ModelInfo
+	err := b.call(func() error {
+		var err error
+		modelInfos, err = b.backend.ListModels(offset, limit)
+		return err
+	})
+	return modelInfos, err
+}
+
+func (b *circuitBreakerBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	var modelInfos []backend.ModelInfo
+	err := b.call(func() error {
+		var err error
+		modelInfos, err = b.backend.QueryModels(filter, offset, limit)
+		return err
+	})
+	return modelInfos, err
+}
+
+func (b *circuitBreakerBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	err := b.call(func() error {
+		var err error
+		versionInfo, err = b.backend.CreateOrUpdateModelVersion(modelID, versionArgs)
+		return err
+	})
+	return versionInfo, err
+}
+
+func (b *circuitBreakerBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	var writer backend.VersionDataWriter
+	err := b.call(func() error {
+		var err error
+		writer, err = b.backend.CreateOrUpdateModelVersionStream(modelID, versionArgs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &circuitBreakerVersionDataWriter{VersionDataWriter: writer, breaker: b.breaker}, nil
+}
+
+// circuitBreakerVersionDataWriter records the commit of the written version as well
+type circuitBreakerVersionDataWriter struct {
+	backend.VersionDataWriter
+	breaker *Breaker
+}
+
+func (w *circuitBreakerVersionDataWriter) Commit() (backend.VersionInfo, error) {
+	done, err := w.breaker.begin()
+	if err != nil {
+		_ = w.VersionDataWriter.Abort()
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := w.VersionDataWriter.Commit()
+	done(err)
+	return versionInfo, err
+}
+
+func (b *circuitBreakerBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	err := b.call(func() error {
+		var err error
+		versionInfo, err = b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+		return err
+	})
+	return versionInfo, err
+}
+
+func (b *circuitBreakerBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	var data []byte
+	err := b.call(func() error {
+		var err error
+		data, err = b.backend.RetrieveModelVersionData(modelID, versionNumber)
+		return err
+	})
+	return data, err
+}
+
+func (b *circuitBreakerBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	var data []byte
+	err := b.call(func() error {
+		var err error
+		data, err = b.backend.RetrieveModelVersionDataRange(modelID, versionNumber, offset, length)
+		return err
+	})
+	return data, err
+}
+
+func (b *circuitBreakerBackend) OpenModelVersionData(modelID string, versionNumber int) (backend.VersionInfo, backend.VersionDataReader, bool, error) {
+	var versionInfo backend.VersionInfo
+	var reader backend.VersionDataReader
+	var opened bool
+	err := b.call(func() error {
+		var err error
+		versionInfo, reader, opened, err = backend.OpenModelVersionData(b.backend, modelID, versionNumber)
+		return err
+	})
+	return versionInfo, reader, opened, err
+}
+
+func (b *circuitBreakerBackend) PresignModelVersionData(modelID string, versionNumber int, expiration time.Duration) (backend.VersionInfo, string, bool, error) {
+	var versionInfo backend.VersionInfo
+	var url string
+	var presigned bool
+	err := b.call(func() error {
+		var err error
+		versionInfo, url, presigned, err = backend.PresignModelVersionData(b.backend, modelID, versionNumber, expiration)
+		return err
+	})
+	return versionInfo, url, presigned, err
+}
+
+func (b *circuitBreakerBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	err := b.call(func() error {
+		var err error
+		versionInfo, err = b.backend.UpdateModelVersionArchived(modelID, versionNumber, archived)
+		return err
+	})
+	return versionInfo, err
+}
+
+func (b *circuitBreakerBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	err := b.call(func() error {
+		var err error
+		versionInfo, err = b.backend.UpdateModelVersionUserData(modelID, versionNumber, userData)
+		return err
+	})
+	return versionInfo, err
+}
+
+func (b *circuitBreakerBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	return b.call(func() error {
+		return b.backend.DeleteModelVersion(modelID, versionNumber)
+	})
+}
+
+func (b *circuitBreakerBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	var versionInfos []backend.VersionInfo
+	err := b.call(func() error {
+		var err error
+		versionInfos, err = b.backend.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+		return err
+	})
+	return versionInfos, err
+}
+
+func (b *circuitBreakerBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	var versionInfos []backend.VersionInfo
+	err := b.call(func() error {
+		var err error
+		versionInfos, err = b.backend.QueryModelVersionInfos(modelID, filter, initialVersionNumber, limit)
+		return err
+	})
+	return versionInfos, err
+}
+
+func (b *circuitBreakerBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	var capacity backend.StorageCapacity
+	err := b.call(func() error {
+		var err error
+		capacity, err = b.backend.RetrieveStorageCapacity()
+		return err
+	})
+	return capacity, err
+}
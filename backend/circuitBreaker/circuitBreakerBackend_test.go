@@ -0,0 +1,142 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package circuitBreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuiteCircuitBreakerBackend(t *testing.T) {
+	underlyingBackends := make(map[backend.Backend]backend.Backend)
+	test.RunSuite(t, func() backend.Backend {
+		underlyingBackend, err := fs.CreateBackend(t.TempDir())
+		assert.NoError(t, err)
+		b, err := CreateBackend(underlyingBackend, CreateBreaker(Configuration{FailureThreshold: 5, OpenDuration: time.Second, SlowCallDuration: time.Minute}))
+		assert.NoError(t, err)
+		underlyingBackends[b] = underlyingBackend
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+		underlyingBackends[b].Destroy()
+		delete(underlyingBackends, b)
+	})
+}
+
+// failingBackend fails the model retrievals with its error when defined, they wait for the gate to be open if defined
+type failingBackend struct {
+	backend.Backend
+	err   error
+	gate  chan struct{}
+	calls int
+}
+
+func (b *failingBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	b.calls++
+	if b.gate != nil {
+		<-b.gate
+	}
+	if b.err != nil {
+		return backend.ModelInfo{}, b.err
+	}
+	return b.Backend.RetrieveModelInfo(modelID)
+}
+
+func createFailingBackend(t *testing.T, configuration Configuration) (backend.Backend, *failingBackend, *Breaker) {
+	underlyingBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(underlyingBackend.Destroy)
+	_, err = underlyingBackend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	failing := &failingBackend{Backend: underlyingBackend}
+	breaker := CreateBreaker(configuration)
+	b, err := CreateBackend(failing, breaker)
+	assert.NoError(t, err)
+	return b, failing, breaker
+}
+
+func TestCircuit(t *testing.T) {
+	b, failing, breaker := createFailingBackend(t, Configuration{FailureThreshold: 3, OpenDuration: 100 * time.Millisecond})
+
+	// Only the consecutive transient failures count
+	failing.err = &backend.TransientError{Err: errors.New("connection reset")}
+	for i := 0; i < 2; i++ {
+		_, err := b.RetrieveModelInfo("foo")
+		assert.True(t, backend.IsTransient(err))
+	}
+	failing.err = nil
+	_, err := b.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	_, err = b.RetrieveModelInfo("bar")
+	assert.IsType(t, &backend.UnknownModelError{}, err)
+	assert.Equal(t, time.Duration(0), breaker.RetryAfter())
+	assert.Equal(t, "closed", breaker.State())
+
+	failing.err = &backend.TransientError{Err: errors.New("connection reset")}
+	for i := 0; i < 3; i++ {
+		_, err := b.RetrieveModelInfo("foo")
+		assert.True(t, backend.IsTransient(err))
+	}
+	assert.Greater(t, int64(breaker.RetryAfter()), int64(0))
+	assert.Equal(t, "open", breaker.State())
+	failing.calls = 0
+	_, err = b.RetrieveModelInfo("foo")
+	assert.IsType(t, &OpenCircuitError{}, err)
+	assert.Equal(t, 0, failing.calls)
+
+	// A failed trial opens the circuit again
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, time.Duration(0), breaker.RetryAfter())
+	_, err = b.RetrieveModelInfo("foo")
+	assert.True(t, backend.IsTransient(err))
+	assert.Equal(t, 1, failing.calls)
+	_, err = b.RetrieveModelInfo("foo")
+	assert.IsType(t, &OpenCircuitError{}, err)
+
+	// A successful one closes it
+	time.Sleep(100 * time.Millisecond)
+	failing.err = nil
+	_, err = b.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	_, err = b.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), breaker.RetryAfter())
+}
+
+func TestSlowCalls(t *testing.T) {
+	b, failing, breaker := createFailingBackend(t, Configuration{FailureThreshold: 1, OpenDuration: time.Hour, SlowCallDuration: 10 * time.Millisecond})
+
+	// A hanging operation opens the circuit before it ends
+	failing.gate = make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := b.RetrieveModelInfo("foo")
+		done <- err
+	}()
+	assert.Eventually(t, func() bool { return breaker.RetryAfter() > 0 }, time.Second, 5*time.Millisecond)
+	_, err := b.ListModels(0, -1)
+	assert.IsType(t, &OpenCircuitError{}, err)
+
+	close(failing.gate)
+	assert.NoError(t, <-done)
+	// Its late success doesn't close the circuit
+	assert.Greater(t, int64(breaker.RetryAfter()), int64(0))
+}
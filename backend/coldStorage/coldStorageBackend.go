@@ -0,0 +1,452 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coldStorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/sirupsen/logrus"
+)
+
+// Reserved user data keys recording where the data of a version is stored, they all share the same prefix
+const (
+	userDataKeyPrefix   = "cogment_model_registry.cold_storage."
+	movedUserDataKey    = userDataKeyPrefix + "moved"       // The data is in the cold backend, the primary one holds a stub
+	dataHashUserDataKey = userDataKeyPrefix + "data_hash"   // Hash of the moved data
+	dataSizeUserDataKey = userDataKeyPrefix + "data_size"   // Size of the moved data
+	restoredUserDataKey = userDataKeyPrefix + "restored_at" // Time the data was last restored to the primary backend
+)
+
+// Backend is a backend able to move the data of its versions to a cold backend and to restore it
+type Backend interface {
+	backend.Backend
+	// MoveModelVersion moves the data of an archived version created, or restored, before a given time to the cold
+	// backend and returns whether it was moved
+	MoveModelVersion(modelID string, versionNumber uint, before time.Time) (bool, error)
+	// RestoreModelVersion moves the data of a version back to the primary backend and returns whether it was restored
+	RestoreModelVersion(modelID string, versionNumber uint) (bool, error)
+}
+
+type coldStorageBackend struct {
+	primary backend.Backend
+	cold    backend.Backend
+}
+
+// CreateBackend creates a new backend storing the versions in a primary backend and able to move their data to a
+// cheaper cold backend
+//
+// The primary backend keeps the info of the moved versions with an empty data, the hash and the size of the data being
+// recorded in reserved entries of their user data. They are removed when the versions are retrieved and the data of
+// the moved versions is transparently retrieved from the cold backend. The underlying backends are not destroyed with
+// the created backend.
+func CreateBackend(primary backend.Backend, cold backend.Backend) (Backend, error) {
+	return &coldStorageBackend{
+		primary: primary,
+		cold:    cold,
+	}, nil
+}
+
+func (b *coldStorageBackend) Destroy() {
+}
+
+// BindContext binds both underlying backends to the context
+func (b *coldStorageBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	boundPrimary, ok := backend.BindContext(b.primary, ctx)
+	if !ok {
+		return nil, false
+	}
+	boundCold, ok := backend.BindContext(b.cold, ctx)
+	if !ok {
+		return nil, false
+	}
+	return &coldStorageBackend{primary: boundPrimary, cold: boundCold}, true
+}
+
+func (b *coldStorageBackend) Ping() error {
+	if err := b.primary.Ping(); err != nil {
+		return err
+	}
+	return b.cold.Ping()
+}
+
+func isMoved(versionInfo backend.VersionInfo) bool {
+	_, ok := versionInfo.UserData[movedUserDataKey]
+	return ok
+}
+
+// restoreVersionInfo converts the info stored in the primary backend to the info of the version
+func restoreVersionInfo(versionInfo backend.VersionInfo) (backend.VersionInfo, error) {
+	hasReservedKeys := false
+	for key := range versionInfo.UserData {
+		if strings.HasPrefix(key, userDataKeyPrefix) {
+			hasReservedKeys = true
+			break
+		}
+	}
+	if !hasReservedKeys {
+		return versionInfo, nil
+	}
+	if isMoved(versionInfo) {
+		dataSize, err := strconv.Atoi(versionInfo.UserData[dataSizeUserDataKey])
+		if err != nil {
+			return backend.VersionInfo{}, fmt.Errorf(`unable to read the data size of model %q version "%d": %w`, versionInfo.ModelID, versionInfo.VersionNumber, err)
+		}
+		versionInfo.DataHash = versionInfo.UserData[dataHashUserDataKey]
+		versionInfo.DataSize = dataSize
+	}
+	versionInfo.UserData = withoutReservedKeys(versionInfo.UserData)
+	return versionInfo, nil
+}
+
+func restoreVersionInfos(versionInfos []backend.VersionInfo) ([]backend.VersionInfo, error) {
+	restoredVersionInfos := make([]backend.VersionInfo, 0, len(versionInfos))
+	for _, versionInfo := range versionInfos {
+		restoredVersionInfo, err := restoreVersionInfo(versionInfo)
+		if err != nil {
+			return []backend.VersionInfo{}, err
+		}
+		restoredVersionInfos = append(restoredVersionInfos, restoredVersionInfo)
+	}
+	return restoredVersionInfos, nil
+}
+
+func withoutReservedKeys(userData map[string]string) map[string]string {
+	filteredUserData := make(map[string]string, len(userData))
+	for key, value := range userData {
+		if !strings.HasPrefix(key, userDataKeyPrefix) {
+			filteredUserData[key] = value
+		}
+	}
+	return filteredUserData
+}
+
+// deleteColdVersion deletes the data of a version from the cold backend, e.g. once outdated, the failures are only logged
+func (b *coldStorageBackend) deleteColdVersion(modelID string, versionNumber uint) {
+	err := b.cold.DeleteModelVersion(modelID, int(versionNumber))
+	if err != nil && !errors.Is(err, backend.ErrNotFound) {
+		logrus.WithFields(logrus.Fields{"model_id": modelID, "version_number": versionNumber}).WithError(err).Warn("unable to delete a version from the cold backend")
+	}
+}
+
+// ensureColdModel makes sure the model exists in the cold backend, creating it from the primary backend if needed
+func (b *coldStorageBackend) ensureColdModel(modelID string) error {
+	hasModel, err := b.cold.HasModel(modelID)
+	if err != nil || hasModel {
+		return err
+	}
+	modelInfo, err := b.primary.RetrieveModelInfo(modelID)
+	if err != nil {
+		return err
+	}
+	_, err = b.cold.CreateOrUpdateModel(modelInfo)
+	return err
+}
+
+// MoveModelVersion copies the data of a version to the cold backend then replaces the version of the primary backend
+// by a stub, the version is left untouched if it changes in between
+func (b *coldStorageBackend) MoveModelVersion(modelID string, versionNumber uint, before time.Time) (bool, error) {
+	storedVersionInfo, err := b.primary.RetrieveModelVersionInfo(modelID, int(versionNumber))
+	if err != nil {
+		return false, err
+	}
+	if !storedVersionInfo.Archived || isMoved(storedVersionInfo) || !movedAt(storedVersionInfo).Before(before) {
+		return false, nil
+	}
+	data, err := b.primary.RetrieveModelVersionData(modelID, int(versionNumber))
+	if err != nil {
+		return false, err
+	}
+	if err := b.ensureColdModel(modelID); err != nil {
+		return false, fmt.Errorf(`unable to create model %q in the cold backend: %w`, modelID, err)
+	}
+	userData := withoutReservedKeys(storedVersionInfo.UserData)
+	_, err = b.cold.CreateOrUpdateModelVersion(modelID, backend.VersionArgs{
+		VersionNumber:     versionNumber,
+		CreationTimestamp: storedVersionInfo.CreationTimestamp,
+		Archived:          true,
+		DataHash:          storedVersionInfo.DataHash,
+		Data:              data,
+		UserData:          userData,
+	})
+	if err != nil {
+		return false, fmt.Errorf(`unable to copy model %q version "%d" to the cold backend: %w`, modelID, versionNumber, err)
+	}
+
+	currentVersionInfo, err := b.primary.RetrieveModelVersionInfo(modelID, int(versionNumber))
+	if err != nil || !sameVersion(currentVersionInfo, storedVersionInfo) {
+		b.deleteColdVersion(modelID, versionNumber)
+		return false, err
+	}
+	stubUserData := make(map[string]string, len(userData)+3)
+	for key, value := range userData {
+		stubUserData[key] = value
+	}
+	stubUserData[movedUserDataKey] = "true"
+	stubUserData[dataHashUserDataKey] = storedVersionInfo.DataHash
+	stubUserData[dataSizeUserDataKey] = strconv.Itoa(storedVersionInfo.DataSize)
+	_, err = b.primary.CreateOrUpdateModelVersion(modelID, backend.VersionArgs{
+		VersionNumber:     versionNumber,
+		CreationTimestamp: storedVersionInfo.CreationTimestamp,
+		Archived:          storedVersionInfo.Archived,
+		UserData:          stubUserData,
+	})
+	if err != nil {
+		return false, fmt.Errorf(`unable to replace model %q version "%d" by a stub: %w`, modelID, versionNumber, err)
+	}
+	return true, nil
+}
+
+// RestoreModelVersion copies the data of a moved version back to the primary backend then deletes it from the cold
+// backend, the version is then only moved again once it is old enough since its restoration
+func (b *coldStorageBackend) RestoreModelVersion(modelID string, versionNumber uint) (bool, error) {
+	storedVersionInfo, err := b.primary.RetrieveModelVersionInfo(modelID, int(versionNumber))
+	if err != nil {
+		return false, err
+	}
+	if !isMoved(storedVersionInfo) {
+		return false, nil
+	}
+	data, err := b.cold.RetrieveModelVersionData(modelID, int(versionNumber))
+	if err != nil {
+		return false, fmt.Errorf(`unable to retrieve model %q version "%d" from the cold backend: %w`, modelID, versionNumber, err)
+	}
+
+	currentVersionInfo, err := b.primary.RetrieveModelVersionInfo(modelID, int(versionNumber))
+	if err != nil {
+		return false, err
+	}
+	if !sameVersion(currentVersionInfo, storedVersionInfo) {
+		return false, nil
+	}
+	versionInfo, err := restoreVersionInfo(currentVersionInfo)
+	if err != nil {
+		return false, err
+	}
+	userData := make(map[string]string, len(versionInfo.UserData)+1)
+	for key, value := range versionInfo.UserData {
+		userData[key] = value
+	}
+	userData[restoredUserDataKey] = time.Now().UTC().Format(time.RFC3339Nano)
+	_, err = b.primary.CreateOrUpdateModelVersion(modelID, backend.VersionArgs{
+		VersionNumber:     versionNumber,
+		CreationTimestamp: versionInfo.CreationTimestamp,
+		Archived:          versionInfo.Archived,
+		DataHash:          versionInfo.DataHash,
+		Data:              data,
+		UserData:          userData,
+	})
+	if err != nil {
+		return false, fmt.Errorf(`unable to restore model %q version "%d": %w`, modelID, versionNumber, err)
+	}
+	b.deleteColdVersion(modelID, versionNumber)
+	return true, nil
+}
+
+// movedAt is the time from which the age of a version is computed to move it, its creation or its last restoration
+func movedAt(versionInfo backend.VersionInfo) time.Time {
+	if restoredAt, err := time.Parse(time.RFC3339Nano, versionInfo.UserData[restoredUserDataKey]); err == nil && restoredAt.After(versionInfo.CreationTimestamp) {
+		return restoredAt
+	}
+	return versionInfo.CreationTimestamp
+}
+
+func sameVersion(versionInfo backend.VersionInfo, otherVersionInfo backend.VersionInfo) bool {
+	return versionInfo.DataHash == otherVersionInfo.DataHash && versionInfo.CreationTimestamp.Equal(otherVersionInfo.CreationTimestamp) && versionInfo.UserData[movedUserDataKey] == otherVersionInfo.UserData[movedUserDataKey]
+}
+
+func (b *coldStorageBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	return b.primary.CreateOrUpdateModel(modelArgs)
+}
+
+func (b *coldStorageBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	return b.primary.RetrieveModelInfo(modelID)
+}
+
+func (b *coldStorageBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	return b.primary.RetrieveModelLatestVersionNumber(modelID)
+}
+
+func (b *coldStorageBackend) HasModel(modelID string) (bool, error) {
+	return b.primary.HasModel(modelID)
+}
+
+func (b *coldStorageBackend) DeleteModel(modelID string) error {
+	err := b.primary.DeleteModel(modelID)
+	if err != nil {
+		return err
+	}
+	err = b.cold.DeleteModel(modelID)
+	if errors.As(err, new(*backend.UnknownModelError)) {
+		return nil
+	}
+	return err
+}
+
+func (b *coldStorageBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.primary.ListModels(offset, limit)
+}
+
+func (b *coldStorageBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.primary.QueryModels(filter, offset, limit)
+}
+
+// overwrittenColdVersion checks if a write replaces a moved version, whose data in the cold backend is then outdated
+func (b *coldStorageBackend) overwrittenColdVersion(modelID string, versionArgs backend.VersionArgs) bool {
+	if versionArgs.VersionNumber == 0 {
+		return false
+	}
+	storedVersionInfo, err := b.primary.RetrieveModelVersionInfo(modelID, int(versionArgs.VersionNumber))
+	return err == nil && isMoved(storedVersionInfo)
+}
+
+func (b *coldStorageBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	overwritten := b.overwrittenColdVersion(modelID, versionArgs)
+	versionInfo, err := b.primary.CreateOrUpdateModelVersion(modelID, versionArgs)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	if overwritten {
+		b.deleteColdVersion(modelID, versionInfo.VersionNumber)
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+// versionDataWriter deletes the outdated data of the cold backend once a moved version is overwritten
+type versionDataWriter struct {
+	backend.VersionDataWriter
+	backend     *coldStorageBackend
+	modelID     string
+	overwritten bool
+}
+
+func (w *versionDataWriter) Commit() (backend.VersionInfo, error) {
+	versionInfo, err := w.VersionDataWriter.Commit()
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	if w.overwritten {
+		w.backend.deleteColdVersion(w.modelID, versionInfo.VersionNumber)
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+func (b *coldStorageBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	overwritten := b.overwrittenColdVersion(modelID, versionArgs)
+	writer, err := b.primary.CreateOrUpdateModelVersionStream(modelID, versionArgs)
+	if err != nil {
+		return nil, err
+	}
+	return &versionDataWriter{VersionDataWriter: writer, backend: b, modelID: modelID, overwritten: overwritten}, nil
+}
+
+func (b *coldStorageBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	versionInfo, err := b.primary.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+// RetrieveModelVersionData retrieves the data of a version from the backend storing it
+func (b *coldStorageBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	storedVersionInfo, err := b.primary.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	if isMoved(storedVersionInfo) {
+		return b.cold.RetrieveModelVersionData(modelID, int(storedVersionInfo.VersionNumber))
+	}
+	return b.primary.RetrieveModelVersionData(modelID, int(storedVersionInfo.VersionNumber))
+}
+
+func (b *coldStorageBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	storedVersionInfo, err := b.primary.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	if isMoved(storedVersionInfo) {
+		return b.cold.RetrieveModelVersionDataRange(modelID, int(storedVersionInfo.VersionNumber), offset, length)
+	}
+	return b.primary.RetrieveModelVersionDataRange(modelID, int(storedVersionInfo.VersionNumber), offset, length)
+}
+
+// UpdateModelVersionArchived changes whether a version is archived, a moved version stays in the cold backend
+func (b *coldStorageBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	versionInfo, err := b.primary.UpdateModelVersionArchived(modelID, versionNumber, archived)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+// UpdateModelVersionUserData replaces the user data of a given model version, keeping the reserved entries
+func (b *coldStorageBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	storedVersionInfo, err := b.primary.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	storedUserData := withoutReservedKeys(userData)
+	for key, value := range storedVersionInfo.UserData {
+		if strings.HasPrefix(key, userDataKeyPrefix) {
+			storedUserData[key] = value
+		}
+	}
+	versionInfo, err := b.primary.UpdateModelVersionUserData(modelID, int(storedVersionInfo.VersionNumber), storedUserData)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+func (b *coldStorageBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	storedVersionInfo, err := b.primary.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return err
+	}
+	err = b.primary.DeleteModelVersion(modelID, int(storedVersionInfo.VersionNumber))
+	if err != nil {
+		return err
+	}
+	if isMoved(storedVersionInfo) {
+		b.deleteColdVersion(modelID, storedVersionInfo.VersionNumber)
+	}
+	return nil
+}
+
+func (b *coldStorageBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	versionInfos, err := b.primary.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+	return restoreVersionInfos(versionInfos)
+}
+
+func (b *coldStorageBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	versionInfos, err := b.primary.QueryModelVersionInfos(modelID, filter, initialVersionNumber, limit)
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+	return restoreVersionInfos(versionInfos)
+}
+
+func (b *coldStorageBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return b.primary.RetrieveStorageCapacity()
+}
@@ -0,0 +1,149 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coldStorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/backend/objectStore"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+type tiers struct {
+	primary backend.Backend
+	cold    backend.Backend
+}
+
+func createTiers(t *testing.T) tiers {
+	primary, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	cold, err := objectStore.CreateBackend(objectStore.CreateMemoryStore())
+	assert.NoError(t, err)
+	return tiers{primary: primary, cold: cold}
+}
+
+func TestSuiteColdStorageBackend(t *testing.T) {
+	createdTiers := make(map[backend.Backend]tiers)
+	test.RunSuite(t, func() backend.Backend {
+		tiers := createTiers(t)
+		b, err := CreateBackend(tiers.primary, tiers.cold)
+		assert.NoError(t, err)
+		createdTiers[b] = tiers
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+		createdTiers[b].primary.Destroy()
+		createdTiers[b].cold.Destroy()
+		delete(createdTiers, b)
+	})
+}
+
+func TestMoveAndRestoreModelVersion(t *testing.T) {
+	tiers := createTiers(t)
+	defer tiers.primary.Destroy()
+	defer tiers.cold.Destroy()
+	b, err := CreateBackend(tiers.primary, tiers.cold)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	creationTimestamp := time.Now().Add(-48 * time.Hour)
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	for _, archived := range []bool{true, false} {
+		_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+			CreationTimestamp: creationTimestamp,
+			Archived:          archived,
+			DataHash:          backend.ComputeSHA256Hash(data),
+			Data:              data,
+			UserData:          map[string]string{"step": "10"},
+		})
+		assert.NoError(t, err)
+	}
+
+	// Only archived versions old enough are moved
+	moved, err := b.MoveModelVersion("foo", 1, creationTimestamp)
+	assert.NoError(t, err)
+	assert.False(t, moved)
+	moved, err = b.MoveModelVersion("foo", 2, time.Now())
+	assert.NoError(t, err)
+	assert.False(t, moved)
+	moved, err = b.MoveModelVersion("foo", 1, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, moved)
+	moved, err = b.MoveModelVersion("foo", 1, time.Now())
+	assert.NoError(t, err)
+	assert.False(t, moved)
+
+	// The primary backend only keeps a stub, the moved version is retrieved as before
+	storedData, err := tiers.primary.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Len(t, storedData, 0)
+	versionInfo, err := b.RetrieveModelVersionInfo("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, backend.ComputeSHA256Hash(data), versionInfo.DataHash)
+	assert.Equal(t, len(data), versionInfo.DataSize)
+	assert.Equal(t, map[string]string{"step": "10"}, versionInfo.UserData)
+	assert.True(t, versionInfo.CreationTimestamp.Equal(creationTimestamp))
+	retrievedData, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, data, retrievedData)
+	retrievedData, err = b.RetrieveModelVersionDataRange("foo", 1, 6, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, data[6:11], retrievedData)
+
+	// Updating the user data keeps the version in the cold backend
+	versionInfo, err = b.UpdateModelVersionUserData("foo", 1, map[string]string{"step": "20"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"step": "20"}, versionInfo.UserData)
+	assert.Equal(t, len(data), versionInfo.DataSize)
+	retrievedData, err = b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, data, retrievedData)
+
+	// A restored version is only moved again once old enough since its restoration
+	restored, err := b.RestoreModelVersion("foo", 1)
+	assert.NoError(t, err)
+	assert.True(t, restored)
+	restored, err = b.RestoreModelVersion("foo", 1)
+	assert.NoError(t, err)
+	assert.False(t, restored)
+	storedData, err = tiers.primary.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, data, storedData)
+	_, err = tiers.cold.RetrieveModelVersionInfo("foo", 1)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+	versionInfo, err = b.RetrieveModelVersionInfo("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"step": "20"}, versionInfo.UserData)
+	moved, err = b.MoveModelVersion("foo", 1, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, moved)
+	moved, err = b.MoveModelVersion("foo", 1, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, moved)
+
+	// Deleting a moved version deletes it from both backends
+	assert.NoError(t, b.DeleteModelVersion("foo", 1))
+	_, err = tiers.cold.RetrieveModelVersionInfo("foo", 1)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+	_, err = b.RetrieveModelVersionInfo("foo", 1)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+}
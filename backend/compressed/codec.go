@@ -0,0 +1,128 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compressed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec compresses and decompresses the data of the versions
+type Codec interface {
+	// Name identifies the codec, it is recorded with each version compressed by it
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+	// CreateWriter creates a writer compressing the data written to it in w, the same way as Compress, until it is closed
+	CreateWriter(w io.Writer) io.WriteCloser
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string {
+	return "gzip"
+}
+
+func (gzipCodec) CreateWriter(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+
+func (c gzipCodec) Compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := c.CreateWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string {
+	return "zstd"
+}
+
+func (zstdCodec) CreateWriter(w io.Writer) io.WriteCloser {
+	// Only fails for invalid options, a single goroutine keeps the output identical to Compress
+	writer, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	return writer
+}
+
+func (c zstdCodec) Compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := c.CreateWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (zstdCodec) Decompress(data []byte) ([]byte, error) {
+	reader, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+var codecs = map[string]Codec{
+	gzipCodec{}.Name(): gzipCodec{},
+	zstdCodec{}.Name(): zstdCodec{},
+}
+
+// UnknownCodecError is raised when trying to use a codec that doesn't exist
+type UnknownCodecError struct {
+	Name string
+}
+
+func (e *UnknownCodecError) Error() string {
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, fmt.Sprintf("%q", name))
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("unknown compression codec %q, expecting %s", e.Name, strings.Join(names, ", "))
+}
+
+// LookupCodec retrieves a codec from its name
+func LookupCodec(name string) (Codec, error) {
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, &UnknownCodecError{Name: name}
+	}
+	return codec, nil
+}
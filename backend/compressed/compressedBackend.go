@@ -0,0 +1,376 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compressed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// Reserved user data keys recording how the data of a version is stored in the underlying backend
+const (
+	compressionUserDataKey = "cogment_model_registry.compression"
+	dataHashUserDataKey    = "cogment_model_registry.data_hash"
+	dataSizeUserDataKey    = "cogment_model_registry.data_size"
+)
+
+type compressedBackend struct {
+	backend backend.Backend
+	codec   Codec
+}
+
+// CreateBackend creates a new backend compressing the data of the versions before storing them in another backend
+//
+// The codec, the hash and the size of the uncompressed data are recorded in reserved entries of the versions user data,
+// they are removed when the versions are retrieved and the codec is exposed as `DataCompression`. Versions stored without
+// compression, e.g. before compression was enabled, are retrieved as is. The underlying backend is not destroyed with the
+// created backend.
+func CreateBackend(b backend.Backend, codec Codec) (backend.Backend, error) {
+	return &compressedBackend{
+		backend: b,
+		codec:   codec,
+	}, nil
+}
+
+func (b *compressedBackend) Destroy() {
+}
+
+// BindContext binds the underlying backend to the context
+func (b *compressedBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	boundBackend, ok := backend.BindContext(b.backend, ctx)
+	if !ok {
+		return nil, false
+	}
+	return &compressedBackend{backend: boundBackend, codec: b.codec}, true
+}
+
+func (b *compressedBackend) Ping() error {
+	return b.backend.Ping()
+}
+
+// restoreVersionInfo converts the info of a stored version to the info of the uncompressed version
+func restoreVersionInfo(versionInfo backend.VersionInfo) (backend.VersionInfo, error) {
+	codecName, ok := versionInfo.UserData[compressionUserDataKey]
+	if !ok {
+		return versionInfo, nil
+	}
+	dataSize, err := strconv.Atoi(versionInfo.UserData[dataSizeUserDataKey])
+	if err != nil {
+		return backend.VersionInfo{}, fmt.Errorf(`unable to read the data size of model %q version "%d": %w`, versionInfo.ModelID, versionInfo.VersionNumber, err)
+	}
+	userData := make(map[string]string, len(versionInfo.UserData))
+	for key, value := range versionInfo.UserData {
+		userData[key] = value
+	}
+	delete(userData, compressionUserDataKey)
+	delete(userData, dataHashUserDataKey)
+	delete(userData, dataSizeUserDataKey)
+
+	versionInfo.DataHash = versionInfo.UserData[dataHashUserDataKey]
+	versionInfo.DataSize = dataSize
+	versionInfo.DataCompression = codecName
+	versionInfo.UserData = userData
+	return versionInfo, nil
+}
+
+func restoreVersionInfos(versionInfos []backend.VersionInfo) ([]backend.VersionInfo, error) {
+	restoredVersionInfos := make([]backend.VersionInfo, 0, len(versionInfos))
+	for _, versionInfo := range versionInfos {
+		restoredVersionInfo, err := restoreVersionInfo(versionInfo)
+		if err != nil {
+			return []backend.VersionInfo{}, err
+		}
+		restoredVersionInfos = append(restoredVersionInfos, restoredVersionInfo)
+	}
+	return restoredVersionInfos, nil
+}
+
+func (b *compressedBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	return b.backend.CreateOrUpdateModel(modelArgs)
+}
+
+func (b *compressedBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	return b.backend.RetrieveModelInfo(modelID)
+}
+
+func (b *compressedBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	return b.backend.RetrieveModelLatestVersionNumber(modelID)
+}
+
+func (b *compressedBackend) HasModel(modelID string) (bool, error) {
+	return b.backend.HasModel(modelID)
+}
+
+func (b *compressedBackend) DeleteModel(modelID string) error {
+	return b.backend.DeleteModel(modelID)
+}
+
+func (b *compressedBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.backend.ListModels(offset, limit)
+}
+
+func (b *compressedBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.backend.QueryModels(filter, offset, limit)
+}
+
+// CreateOrUpdateModelVersion compresses the data of a version and stores it in the underlying backend
+func (b *compressedBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	compressedData, err := b.codec.Compress(versionArgs.Data)
+	if err != nil {
+		return backend.VersionInfo{}, fmt.Errorf("unable to compress data for model %q: %w", modelID, err)
+	}
+
+	userData := make(map[string]string, len(versionArgs.UserData)+3)
+	for key, value := range versionArgs.UserData {
+		userData[key] = value
+	}
+	userData[compressionUserDataKey] = b.codec.Name()
+	userData[dataHashUserDataKey] = versionArgs.DataHash
+	userData[dataSizeUserDataKey] = strconv.Itoa(len(versionArgs.Data))
+
+	storedVersionArgs := versionArgs
+	storedVersionArgs.Data = compressedData
+	storedVersionArgs.DataHash = backend.ComputeSHA256Hash(compressedData)
+	storedVersionArgs.DataHashAlgorithm = ""
+	storedVersionArgs.DataSize = 0
+	storedVersionArgs.UserData = userData
+	versionInfo, err := b.backend.CreateOrUpdateModelVersion(modelID, storedVersionArgs)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+// CreateOrUpdateModelVersionStream compresses the data as it is written to a stream of the underlying backend
+//
+// The hash and the size of the uncompressed data are recorded when the version is created, when they aren't known
+// beforehand the data is buffered to compute them before being compressed.
+func (b *compressedBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	if versionArgs.DataHash == "" || versionArgs.DataSize <= 0 {
+		hasModel, err := b.backend.HasModel(modelID)
+		if err != nil {
+			return nil, err
+		}
+		if !hasModel {
+			return nil, &backend.UnknownModelError{ModelID: modelID}
+		}
+		return backend.CreateBufferedVersionDataWriter(b, modelID, versionArgs), nil
+	}
+	hasher, err := backend.CreateVersionHasher(versionArgs)
+	if err != nil {
+		return nil, err
+	}
+	userData := make(map[string]string, len(versionArgs.UserData)+3)
+	for key, value := range versionArgs.UserData {
+		userData[key] = value
+	}
+	userData[compressionUserDataKey] = b.codec.Name()
+	userData[dataHashUserDataKey] = versionArgs.DataHash
+	userData[dataSizeUserDataKey] = strconv.Itoa(versionArgs.DataSize)
+
+	storedVersionArgs := versionArgs
+	storedVersionArgs.Data = nil
+	storedVersionArgs.DataHash = ""
+	storedVersionArgs.DataHashAlgorithm = ""
+	storedVersionArgs.DataSize = 0
+	storedVersionArgs.UserData = userData
+	writer, err := b.backend.CreateOrUpdateModelVersionStream(modelID, storedVersionArgs)
+	if err != nil {
+		return nil, err
+	}
+	return &compressedVersionDataWriter{
+		modelID:          modelID,
+		expectedDataHash: versionArgs.DataHash,
+		expectedDataSize: versionArgs.DataSize,
+		hasher:           hasher,
+		compressor:       b.codec.CreateWriter(writer),
+		writer:           writer,
+	}, nil
+}
+
+func (b *compressedBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	versionInfo, err := b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+// retrieveStoredVersion retrieves the info and the stored data of a version, resolving the version number only once
+func (b *compressedBackend) retrieveStoredVersion(modelID string, versionNumber int) (backend.VersionInfo, []byte, error) {
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, nil, err
+	}
+	storedData, err := b.backend.RetrieveModelVersionData(modelID, int(versionInfo.VersionNumber))
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return backend.VersionInfo{}, nil, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return backend.VersionInfo{}, nil, err
+	}
+	return versionInfo, storedData, nil
+}
+
+// RetrieveModelVersionData retrieves and decompresses a given model version data
+func (b *compressedBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	versionInfo, storedData, err := b.retrieveStoredVersion(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	if versionInfo.DataCompression == "" {
+		return storedData, nil
+	}
+	codec, err := LookupCodec(versionInfo.DataCompression)
+	if err != nil {
+		return []byte{}, err
+	}
+	versionData, err := codec.Decompress(storedData)
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to decompress data for model %q version "%d": %w`, modelID, versionInfo.VersionNumber, err)
+	}
+	return versionData, nil
+}
+
+// RetrieveModelVersionDataRange retrieves a range of a given model version data, compressed versions are fully decompressed
+func (b *compressedBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	if versionInfo.DataCompression == "" {
+		return b.backend.RetrieveModelVersionDataRange(modelID, int(versionInfo.VersionNumber), offset, length)
+	}
+	versionData, err := b.RetrieveModelVersionData(modelID, int(versionInfo.VersionNumber))
+	if err != nil {
+		return []byte{}, err
+	}
+	return backend.SliceDataRange(modelID, versionNumber, versionData, offset, length)
+}
+
+func (b *compressedBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	versionInfo, err := b.backend.UpdateModelVersionArchived(modelID, versionNumber, archived)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+// UpdateModelVersionUserData replaces the user data of a given model version, keeping the stored compression metadata
+func (b *compressedBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	storedVersionInfo, err := b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	storedUserData := make(map[string]string, len(userData)+3)
+	for key, value := range userData {
+		storedUserData[key] = value
+	}
+	for _, key := range []string{compressionUserDataKey, dataHashUserDataKey, dataSizeUserDataKey} {
+		if value, ok := storedVersionInfo.UserData[key]; ok {
+			storedUserData[key] = value
+		} else {
+			delete(storedUserData, key)
+		}
+	}
+	versionInfo, err := b.backend.UpdateModelVersionUserData(modelID, int(storedVersionInfo.VersionNumber), storedUserData)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+func (b *compressedBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	return b.backend.DeleteModelVersion(modelID, versionNumber)
+}
+
+func (b *compressedBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	versionInfos, err := b.backend.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+	return restoreVersionInfos(versionInfos)
+}
+
+func (b *compressedBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	versionInfos, err := b.backend.QueryModelVersionInfos(modelID, filter, initialVersionNumber, limit)
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+	return restoreVersionInfos(versionInfos)
+}
+
+func (b *compressedBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return b.backend.RetrieveStorageCapacity()
+}
+
+type compressedVersionDataWriter struct {
+	modelID          string
+	expectedDataHash string
+	expectedDataSize int
+	hasher           backend.Hasher
+	dataSize         int
+	compressor       io.WriteCloser
+	writer           backend.VersionDataWriter
+	closed           bool
+}
+
+func (w *compressedVersionDataWriter) Write(data []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("unable to write data for model %q: writer already closed", w.modelID)
+	}
+	w.dataSize += len(data)
+	_, _ = w.hasher.Write(data)
+	return w.compressor.Write(data)
+}
+
+// Commit flushes the compressed data and checks the hash and the size of the uncompressed data before committing the
+// underlying stream
+func (w *compressedVersionDataWriter) Commit() (backend.VersionInfo, error) {
+	if w.closed {
+		return backend.VersionInfo{}, fmt.Errorf("unable to commit data for model %q: writer already closed", w.modelID)
+	}
+	w.closed = true
+	if err := w.compressor.Close(); err != nil {
+		_ = w.writer.Abort()
+		return backend.VersionInfo{}, fmt.Errorf("unable to compress data for model %q: %w", w.modelID, err)
+	}
+	if dataHash := w.hasher.Hash(); dataHash != w.expectedDataHash {
+		_ = w.writer.Abort()
+		return backend.VersionInfo{}, &backend.DataHashMismatchError{ModelID: w.modelID, ExpectedDataHash: w.expectedDataHash, DataHash: dataHash}
+	}
+	if w.dataSize != w.expectedDataSize {
+		_ = w.writer.Abort()
+		return backend.VersionInfo{}, fmt.Errorf("unable to commit data for model %q: expected %d bytes, received %d bytes", w.modelID, w.expectedDataSize, w.dataSize)
+	}
+	versionInfo, err := w.writer.Commit()
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+func (w *compressedVersionDataWriter) Abort() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.writer.Abort()
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compressed
+
+import (
+	"testing"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuiteCompressedBackend(t *testing.T) {
+	codec, err := LookupCodec("gzip")
+	assert.NoError(t, err)
+	underlyingBackends := make(map[backend.Backend]backend.Backend)
+	test.RunSuite(t, func() backend.Backend {
+		underlyingBackend, err := fs.CreateBackend(t.TempDir())
+		assert.NoError(t, err)
+		b, err := CreateBackend(underlyingBackend, codec)
+		assert.NoError(t, err)
+		underlyingBackends[b] = underlyingBackend
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+		underlyingBackends[b].Destroy()
+		delete(underlyingBackends, b)
+	})
+}
+
+func TestCompressedBackendStorage(t *testing.T) {
+	for _, codecName := range []string{"gzip", "zstd"} {
+		t.Run(codecName, func(t *testing.T) {
+			testCompressedBackendStorage(t, codecName)
+		})
+	}
+}
+
+func testCompressedBackendStorage(t *testing.T, codecName string) {
+	underlyingBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer underlyingBackend.Destroy()
+	codec, err := LookupCodec(codecName)
+	assert.NoError(t, err)
+	b, err := CreateBackend(underlyingBackend, codec)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+
+	// A version created before the compression was enabled
+	_, err = underlyingBackend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: test.Data1, DataHash: backend.ComputeSHA256Hash(test.Data1)})
+	assert.NoError(t, err)
+
+	versionInfo, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+		Data:     test.Data1,
+		DataHash: backend.ComputeSHA256Hash(test.Data1),
+		UserData: map[string]string{"foo": "bar"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), versionInfo.VersionNumber)
+	assert.Equal(t, codecName, versionInfo.DataCompression)
+	assert.Equal(t, backend.ComputeSHA256Hash(test.Data1), versionInfo.DataHash)
+	assert.Equal(t, len(test.Data1), versionInfo.DataSize)
+	assert.Equal(t, map[string]string{"foo": "bar"}, versionInfo.UserData)
+
+	storedVersionInfo, err := underlyingBackend.RetrieveModelVersionInfo("foo", 2)
+	assert.NoError(t, err)
+	assert.Less(t, storedVersionInfo.DataSize, len(test.Data1))
+	storedData, err := underlyingBackend.RetrieveModelVersionData("foo", 2)
+	assert.NoError(t, err)
+	assert.NotEqual(t, test.Data1, storedData)
+
+	for _, versionNumber := range []int{1, 2} {
+		versionInfo, err := b.RetrieveModelVersionInfo("foo", versionNumber)
+		assert.NoError(t, err)
+		assert.Equal(t, len(test.Data1), versionInfo.DataSize)
+		data, err := b.RetrieveModelVersionData("foo", versionNumber)
+		assert.NoError(t, err)
+		assert.Equal(t, test.Data1, data)
+		data, err = b.RetrieveModelVersionDataRange("foo", versionNumber, 10, 20)
+		assert.NoError(t, err)
+		assert.Equal(t, test.Data1[10:30], data)
+	}
+
+	versionInfos, err := b.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 2)
+	assert.Equal(t, "", versionInfos[0].DataCompression)
+	assert.Equal(t, codecName, versionInfos[1].DataCompression)
+}
+
+func TestCompressedBackendStream(t *testing.T) {
+	for _, codecName := range []string{"gzip", "zstd"} {
+		t.Run(codecName, func(t *testing.T) {
+			testCompressedBackendStream(t, codecName)
+		})
+	}
+}
+
+func testCompressedBackendStream(t *testing.T, codecName string) {
+	underlyingBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer underlyingBackend.Destroy()
+	codec, err := LookupCodec(codecName)
+	assert.NoError(t, err)
+	b, err := CreateBackend(underlyingBackend, codec)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+
+	writer, err := b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{DataHash: backend.ComputeSHA256Hash(test.Data1), DataSize: len(test.Data1)})
+	assert.NoError(t, err)
+	assert.IsType(t, &compressedVersionDataWriter{}, writer)
+	for i := 0; i < len(test.Data1); i += 100 {
+		end := i + 100
+		if end > len(test.Data1) {
+			end = len(test.Data1)
+		}
+		_, err = writer.Write(test.Data1[i:end])
+		assert.NoError(t, err)
+	}
+	versionInfo, err := writer.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, codecName, versionInfo.DataCompression)
+	assert.Equal(t, backend.ComputeSHA256Hash(test.Data1), versionInfo.DataHash)
+	assert.Equal(t, len(test.Data1), versionInfo.DataSize)
+
+	storedData, err := underlyingBackend.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	compressedData, err := codec.Compress(test.Data1)
+	assert.NoError(t, err)
+	assert.Equal(t, compressedData, storedData)
+	data, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data1, data)
+
+	// The written data needs to match the expected size and hash
+	for _, versionArgs := range []backend.VersionArgs{
+		{DataHash: backend.ComputeSHA256Hash(test.Data1), DataSize: len(test.Data1) + 1},
+		{DataHash: backend.ComputeSHA256Hash(test.Data2), DataSize: len(test.Data1)},
+	} {
+		writer, err = b.CreateOrUpdateModelVersionStream("foo", versionArgs)
+		assert.NoError(t, err)
+		_, err = writer.Write(test.Data1)
+		assert.NoError(t, err)
+		_, err = writer.Commit()
+		assert.Error(t, err)
+	}
+	versionInfos, err := b.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 1)
+
+	// Without the size, the data is buffered
+	writer, err = b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{DataHash: backend.ComputeSHA256Hash(test.Data2)})
+	assert.NoError(t, err)
+	_, err = writer.Write(test.Data2)
+	assert.NoError(t, err)
+	versionInfo, err = writer.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, len(test.Data2), versionInfo.DataSize)
+}
+
+func TestUnknownCodec(t *testing.T) {
+	_, err := LookupCodec("lz4")
+	assert.EqualError(t, err, `unknown compression codec "lz4", expecting "gzip", "zstd"`)
+}
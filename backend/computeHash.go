@@ -16,10 +16,141 @@ package backend
 
 import (
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/base64"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+	"lukechampine.com/blake3"
 )
 
 func ComputeSHA256Hash(data []byte) string {
 	rawHash := sha256.Sum256(data)
 	return base64.StdEncoding.EncodeToString(rawHash[:])
 }
+
+// HashAlgorithm computes the hashes of the versions data
+//
+// The hashes are prefixed by the name of the algorithm and a colon, e.g. `xxhash64:...`, except for SHA-256 hashes
+// which are the Cogment API default.
+type HashAlgorithm struct {
+	Name   string
+	create func() hash.Hash
+}
+
+// SHA256HashAlgorithm is the default hash algorithm, it computes the same hashes as ComputeSHA256Hash
+var SHA256HashAlgorithm = HashAlgorithm{Name: "sha256", create: sha256.New}
+
+var hashAlgorithms = map[string]HashAlgorithm{
+	SHA256HashAlgorithm.Name: SHA256HashAlgorithm,
+	"sha512":                 {Name: "sha512", create: sha512.New},
+	"xxhash64":               {Name: "xxhash64", create: func() hash.Hash { return xxhash.New() }},
+	"blake2b-256": {Name: "blake2b-256", create: func() hash.Hash {
+		// Only fails for keys longer than 64 bytes
+		h, _ := blake2b.New256(nil)
+		return h
+	}},
+	"blake3": {Name: "blake3", create: func() hash.Hash { return blake3.New(32, nil) }},
+}
+
+// UnknownHashAlgorithmError is raised when trying to use a hash algorithm that doesn't exist
+type UnknownHashAlgorithmError struct {
+	Name string
+}
+
+func (e *UnknownHashAlgorithmError) Error() string {
+	names := make([]string, 0, len(hashAlgorithms))
+	for name := range hashAlgorithms {
+		names = append(names, fmt.Sprintf("%q", name))
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("unknown hash algorithm %q, expecting %s", e.Name, strings.Join(names, ", "))
+}
+
+// LookupHashAlgorithm retrieves a hash algorithm from its name
+func LookupHashAlgorithm(name string) (HashAlgorithm, error) {
+	algorithm, ok := hashAlgorithms[name]
+	if !ok {
+		return HashAlgorithm{}, &UnknownHashAlgorithmError{Name: name}
+	}
+	return algorithm, nil
+}
+
+// ParseDataHashAlgorithm retrieves the algorithm that computed a hash from its prefix, hashes without prefix are SHA-256 hashes
+func ParseDataHashAlgorithm(dataHash string) (HashAlgorithm, error) {
+	separatorIndex := strings.Index(dataHash, ":")
+	if separatorIndex < 0 {
+		return SHA256HashAlgorithm, nil
+	}
+	return LookupHashAlgorithm(dataHash[:separatorIndex])
+}
+
+func (a HashAlgorithm) encode(rawHash []byte) string {
+	encodedHash := base64.StdEncoding.EncodeToString(rawHash)
+	if a.Name == SHA256HashAlgorithm.Name {
+		return encodedHash
+	}
+	return a.Name + ":" + encodedHash
+}
+
+// ComputeHash computes the hash of some data
+func (a HashAlgorithm) ComputeHash(data []byte) string {
+	h := a.create()
+	_, _ = h.Write(data)
+	return a.encode(h.Sum(nil))
+}
+
+// CreateHasher creates a hasher incrementally computing the same hash as ComputeHash
+func (a HashAlgorithm) CreateHasher() Hasher {
+	return Hasher{algorithm: a, hash: a.create()}
+}
+
+// Hasher incrementally computes the hash of some data
+type Hasher struct {
+	algorithm HashAlgorithm
+	hash      hash.Hash
+}
+
+func (h Hasher) Write(data []byte) (int, error) {
+	return h.hash.Write(data)
+}
+
+func (h Hasher) Hash() string {
+	return h.algorithm.encode(h.hash.Sum(nil))
+}
+
+// CreateVersionHasher creates a hasher for the data of a version, using the algorithm of its expected hash if defined,
+// its DataHashAlgorithm otherwise. This way the computed hash can be compared to the expected one.
+func CreateVersionHasher(versionArgs VersionArgs) (Hasher, error) {
+	if versionArgs.DataHash != "" {
+		algorithm, err := ParseDataHashAlgorithm(versionArgs.DataHash)
+		if err != nil {
+			return Hasher{}, err
+		}
+		return algorithm.CreateHasher(), nil
+	}
+	if versionArgs.DataHashAlgorithm == "" {
+		return SHA256HashAlgorithm.CreateHasher(), nil
+	}
+	algorithm, err := LookupHashAlgorithm(versionArgs.DataHashAlgorithm)
+	if err != nil {
+		return Hasher{}, err
+	}
+	return algorithm.CreateHasher(), nil
+}
+
+// VerifyDataHash checks that some data matches a hash, empty hashes match any data
+func VerifyDataHash(dataHash string, data []byte) (bool, error) {
+	if dataHash == "" {
+		return true, nil
+	}
+	algorithm, err := ParseDataHashAlgorithm(dataHash)
+	if err != nil {
+		return false, err
+	}
+	return algorithm.ComputeHash(data) == dataHash, nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import "context"
+
+// ContextBinder is implemented by the backends whose operations can be bound to a context, e.g. the one of a call
+type ContextBinder interface {
+	// BindContext returns a view of the backend whose operations stop once the context is done, ok is false when the
+	// backend, or one it wraps, can't be bound. The view shares the state of the backend and isn't destroyed.
+	BindContext(ctx context.Context) (b Backend, ok bool)
+}
+
+// BindContext binds a backend to a context if it is able to
+func BindContext(b Backend, ctx context.Context) (Backend, bool) {
+	binder, ok := b.(ContextBinder)
+	if !ok {
+		return nil, false
+	}
+	return binder.BindContext(ctx)
+}
+
+// IsContextDone tells whether an operation failed because its context is done, it isn't a failure of the backend
+func IsContextDone(ctx context.Context, err error) bool {
+	return err != nil && ctx != nil && ctx.Err() != nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+// ResolveDataRange checks that a range fits in the data of a model version and returns its end offset,
+// a length of 0 or going past the end of the data selects everything up to the end of the data
+func ResolveDataRange(modelID string, versionNumber int, dataSize uint64, offset uint64, length uint64) (uint64, error) {
+	if offset > dataSize {
+		return 0, &InvalidDataRangeError{ModelID: modelID, VersionNumber: versionNumber, Offset: offset, DataSize: dataSize}
+	}
+	if length == 0 || length > dataSize-offset {
+		return dataSize, nil
+	}
+	return offset + length, nil
+}
+
+// SliceDataRange copies a range of the data of a model version, for backends having it in memory
+func SliceDataRange(modelID string, versionNumber int, data []byte, offset uint64, length uint64) ([]byte, error) {
+	end, err := ResolveDataRange(modelID, versionNumber, uint64(len(data)), offset, length)
+	if err != nil {
+		return []byte{}, err
+	}
+	return append([]byte{}, data[offset:end]...), nil
+}
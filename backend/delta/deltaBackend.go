@@ -0,0 +1,422 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// Reserved user data keys recording how the data of a version is stored in the underlying backend
+const (
+	baseUserDataKey     = "cogment_model_registry.delta_base"
+	depthUserDataKey    = "cogment_model_registry.delta_depth"
+	dataHashUserDataKey = "cogment_model_registry.delta_data_hash"
+	dataSizeUserDataKey = "cogment_model_registry.delta_data_size"
+)
+
+type deltaBackend struct {
+	// modelLocks serialize the creations, updates and deletions of the versions of each model, a version can't be deleted
+	// while a delta against it is being created
+	modelLocks       *backend.ModelLocks
+	backend          backend.Backend
+	snapshotInterval int
+}
+
+// CreateBackend creates a new backend storing each version as a delta against the previous one in another backend
+//
+// Every snapshotInterval versions, or when the delta isn't smaller than the data, a version is stored as a full snapshot,
+// retrieving a version applies at most snapshotInterval-1 deltas. The base version, depth and the hash and size of the
+// reconstructed data are recorded in reserved entries of the versions user data, they are removed when the versions are
+// retrieved. Versions are stored as full snapshots when the version they are based on is updated or deleted.
+// The underlying backend is not destroyed with the created backend.
+func CreateBackend(b backend.Backend, snapshotInterval int) (backend.Backend, error) {
+	if snapshotInterval < 1 {
+		return nil, fmt.Errorf("unable to create a delta backend with a snapshot interval of %d, expecting at least 1", snapshotInterval)
+	}
+	return &deltaBackend{
+		modelLocks:       &backend.ModelLocks{},
+		backend:          b,
+		snapshotInterval: snapshotInterval,
+	}, nil
+}
+
+func (b *deltaBackend) Destroy() {
+}
+
+// BindContext binds the underlying backend to the context, the bound view shares the model locks
+func (b *deltaBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	boundBackend, ok := backend.BindContext(b.backend, ctx)
+	if !ok {
+		return nil, false
+	}
+	return &deltaBackend{modelLocks: b.modelLocks, backend: boundBackend, snapshotInterval: b.snapshotInterval}, true
+}
+
+func (b *deltaBackend) Ping() error {
+	return b.backend.Ping()
+}
+
+// storedVersion describes how a version is stored in the underlying backend
+type storedVersion struct {
+	versionInfo backend.VersionInfo // Info of the reconstructed version
+	baseVersion uint                // Version the stored data is a delta against, 0 for full snapshots
+	depth       int                 // Number of deltas to apply to reconstruct the data
+}
+
+func restoreVersion(versionInfo backend.VersionInfo) (storedVersion, error) {
+	baseVersionString, ok := versionInfo.UserData[baseUserDataKey]
+	if !ok {
+		return storedVersion{versionInfo: versionInfo}, nil
+	}
+	baseVersion, err := strconv.ParseUint(baseVersionString, 10, 0)
+	if err != nil {
+		return storedVersion{}, fmt.Errorf(`unable to read the delta base of model %q version "%d": %w`, versionInfo.ModelID, versionInfo.VersionNumber, err)
+	}
+	depth, err := strconv.Atoi(versionInfo.UserData[depthUserDataKey])
+	if err != nil {
+		return storedVersion{}, fmt.Errorf(`unable to read the delta depth of model %q version "%d": %w`, versionInfo.ModelID, versionInfo.VersionNumber, err)
+	}
+	dataSize, err := strconv.Atoi(versionInfo.UserData[dataSizeUserDataKey])
+	if err != nil {
+		return storedVersion{}, fmt.Errorf(`unable to read the data size of model %q version "%d": %w`, versionInfo.ModelID, versionInfo.VersionNumber, err)
+	}
+	userData := make(map[string]string, len(versionInfo.UserData))
+	for key, value := range versionInfo.UserData {
+		userData[key] = value
+	}
+	delete(userData, baseUserDataKey)
+	delete(userData, depthUserDataKey)
+	delete(userData, dataHashUserDataKey)
+	delete(userData, dataSizeUserDataKey)
+
+	versionInfo.DataHash = versionInfo.UserData[dataHashUserDataKey]
+	versionInfo.DataSize = dataSize
+	versionInfo.UserData = userData
+	return storedVersion{versionInfo: versionInfo, baseVersion: uint(baseVersion), depth: depth}, nil
+}
+
+func restoreVersionInfos(versionInfos []backend.VersionInfo) ([]backend.VersionInfo, error) {
+	restoredVersionInfos := make([]backend.VersionInfo, 0, len(versionInfos))
+	for _, versionInfo := range versionInfos {
+		version, err := restoreVersion(versionInfo)
+		if err != nil {
+			return []backend.VersionInfo{}, err
+		}
+		restoredVersionInfos = append(restoredVersionInfos, version.versionInfo)
+	}
+	return restoredVersionInfos, nil
+}
+
+func (b *deltaBackend) retrieveStoredVersion(modelID string, versionNumber int) (storedVersion, error) {
+	versionInfo, err := b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return storedVersion{}, err
+	}
+	return restoreVersion(versionInfo)
+}
+
+// reconstructData retrieves the stored data of a version and applies it to the data of its base
+func (b *deltaBackend) reconstructData(version storedVersion) ([]byte, error) {
+	modelID := version.versionInfo.ModelID
+	versionNumber := version.versionInfo.VersionNumber
+	storedData, err := b.backend.RetrieveModelVersionData(modelID, int(versionNumber))
+	if err != nil {
+		return []byte{}, err
+	}
+	if version.baseVersion == 0 {
+		return storedData, nil
+	}
+	baseVersion, err := b.retrieveStoredVersion(modelID, int(version.baseVersion))
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to retrieve the delta base of model %q version "%d": %w`, modelID, versionNumber, err)
+	}
+	baseData, err := b.reconstructData(baseVersion)
+	if err != nil {
+		return []byte{}, err
+	}
+	versionData, err := Patch(baseData, storedData)
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to apply the delta of model %q version "%d": %w`, modelID, versionNumber, err)
+	}
+	return versionData, nil
+}
+
+// storeSnapshots stores the versions based on the given one as full snapshots, before it is updated or deleted
+func (b *deltaBackend) storeSnapshots(modelID string, baseVersionNumber uint) error {
+	dependentVersionInfos, err := b.backend.QueryModelVersionInfos(modelID, backend.VersionFilter{
+		UserDataEquals: map[string]string{baseUserDataKey: strconv.FormatUint(uint64(baseVersionNumber), 10)},
+	}, baseVersionNumber+1, 0)
+	if err != nil {
+		return err
+	}
+	for _, dependentVersionInfo := range dependentVersionInfos {
+		version, err := restoreVersion(dependentVersionInfo)
+		if err != nil {
+			return err
+		}
+		versionData, err := b.reconstructData(version)
+		if err != nil {
+			return err
+		}
+		_, err = b.backend.CreateOrUpdateModelVersion(modelID, backend.VersionArgs{
+			VersionNumber:     version.versionInfo.VersionNumber,
+			CreationTimestamp: version.versionInfo.CreationTimestamp,
+			Archived:          version.versionInfo.Archived,
+			DataHash:          version.versionInfo.DataHash,
+			Data:              versionData,
+			UserData:          version.versionInfo.UserData,
+		})
+		if err != nil {
+			return fmt.Errorf(`unable to store model %q version "%d" as a snapshot: %w`, modelID, version.versionInfo.VersionNumber, err)
+		}
+	}
+	return nil
+}
+
+func (b *deltaBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	return b.backend.CreateOrUpdateModel(modelArgs)
+}
+
+func (b *deltaBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	return b.backend.RetrieveModelInfo(modelID)
+}
+
+func (b *deltaBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	return b.backend.RetrieveModelLatestVersionNumber(modelID)
+}
+
+func (b *deltaBackend) HasModel(modelID string) (bool, error) {
+	return b.backend.HasModel(modelID)
+}
+
+func (b *deltaBackend) DeleteModel(modelID string) error {
+	return b.backend.DeleteModel(modelID)
+}
+
+func (b *deltaBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.backend.ListModels(offset, limit)
+}
+
+func (b *deltaBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.backend.QueryModels(filter, offset, limit)
+}
+
+// createDeltaVersionArgs builds the arguments storing a new version as a delta against the latest version, it returns
+// false when the version needs to be stored as a full snapshot
+func (b *deltaBackend) createDeltaVersionArgs(modelID string, versionArgs backend.VersionArgs) (backend.VersionArgs, bool, error) {
+	baseVersion, err := b.retrieveStoredVersion(modelID, -1)
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return backend.VersionArgs{}, false, nil
+		}
+		return backend.VersionArgs{}, false, err
+	}
+	if baseVersion.depth+1 >= b.snapshotInterval {
+		return backend.VersionArgs{}, false, nil
+	}
+	baseData, err := b.reconstructData(baseVersion)
+	if err != nil {
+		return backend.VersionArgs{}, false, err
+	}
+	delta := Diff(baseData, versionArgs.Data)
+	if len(delta) >= len(versionArgs.Data) {
+		return backend.VersionArgs{}, false, nil
+	}
+
+	userData := make(map[string]string, len(versionArgs.UserData)+4)
+	for key, value := range versionArgs.UserData {
+		userData[key] = value
+	}
+	userData[baseUserDataKey] = strconv.FormatUint(uint64(baseVersion.versionInfo.VersionNumber), 10)
+	userData[depthUserDataKey] = strconv.Itoa(baseVersion.depth + 1)
+	userData[dataHashUserDataKey] = versionArgs.DataHash
+	userData[dataSizeUserDataKey] = strconv.Itoa(len(versionArgs.Data))
+
+	deltaVersionArgs := versionArgs
+	deltaVersionArgs.Data = delta
+	deltaVersionArgs.DataHash = backend.ComputeSHA256Hash(delta)
+	deltaVersionArgs.UserData = userData
+	return deltaVersionArgs, true, nil
+}
+
+// CreateOrUpdateModelVersion stores a new version as a delta against the latest one, updated versions are stored as full snapshots
+func (b *deltaBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	unlock := b.modelLocks.Lock(modelID)
+	defer unlock()
+
+	storedVersionArgs := versionArgs
+	if versionArgs.VersionNumber != 0 {
+		if err := b.storeSnapshots(modelID, versionArgs.VersionNumber); err != nil {
+			return backend.VersionInfo{}, err
+		}
+	} else {
+		deltaVersionArgs, isDelta, err := b.createDeltaVersionArgs(modelID, versionArgs)
+		if err != nil {
+			return backend.VersionInfo{}, err
+		}
+		if isDelta {
+			storedVersionArgs = deltaVersionArgs
+		}
+	}
+
+	versionInfo, err := b.backend.CreateOrUpdateModelVersion(modelID, storedVersionArgs)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	version, err := restoreVersion(versionInfo)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return version.versionInfo, nil
+}
+
+func (b *deltaBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	hasModel, err := b.backend.HasModel(modelID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasModel {
+		return nil, &backend.UnknownModelError{ModelID: modelID}
+	}
+	// The data needs to be complete to compute the delta
+	return backend.CreateBufferedVersionDataWriter(b, modelID, versionArgs), nil
+}
+
+func (b *deltaBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	version, err := b.retrieveStoredVersion(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return version.versionInfo, nil
+}
+
+// RetrieveModelVersionData retrieves a given model version data, applying the deltas it is based on
+func (b *deltaBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	version, err := b.retrieveStoredVersion(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	versionData, err := b.reconstructData(version)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return []byte{}, err
+	}
+	return versionData, nil
+}
+
+// RetrieveModelVersionDataRange retrieves a range of a given model version data, deltas are fully reconstructed
+func (b *deltaBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	version, err := b.retrieveStoredVersion(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	if version.baseVersion == 0 {
+		return b.backend.RetrieveModelVersionDataRange(modelID, int(version.versionInfo.VersionNumber), offset, length)
+	}
+	versionData, err := b.reconstructData(version)
+	if err != nil {
+		return []byte{}, err
+	}
+	return backend.SliceDataRange(modelID, versionNumber, versionData, offset, length)
+}
+
+// UpdateModelVersionArchived changes whether a given model version is archived, the stored deltas are left untouched
+func (b *deltaBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	unlock := b.modelLocks.Lock(modelID)
+	defer unlock()
+
+	versionInfo, err := b.backend.UpdateModelVersionArchived(modelID, versionNumber, archived)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	version, err := restoreVersion(versionInfo)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return version.versionInfo, nil
+}
+
+// UpdateModelVersionUserData replaces the user data of a given model version, keeping the stored delta metadata
+func (b *deltaBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	unlock := b.modelLocks.Lock(modelID)
+	defer unlock()
+
+	storedVersionInfo, err := b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	storedUserData := make(map[string]string, len(userData)+4)
+	for key, value := range userData {
+		storedUserData[key] = value
+	}
+	for _, key := range []string{baseUserDataKey, depthUserDataKey, dataHashUserDataKey, dataSizeUserDataKey} {
+		if value, ok := storedVersionInfo.UserData[key]; ok {
+			storedUserData[key] = value
+		} else {
+			delete(storedUserData, key)
+		}
+	}
+	versionInfo, err := b.backend.UpdateModelVersionUserData(modelID, int(storedVersionInfo.VersionNumber), storedUserData)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	version, err := restoreVersion(versionInfo)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return version.versionInfo, nil
+}
+
+// DeleteModelVersion deletes a given model version, the versions based on it are first stored as full snapshots
+func (b *deltaBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	unlock := b.modelLocks.Lock(modelID)
+	defer unlock()
+
+	version, err := b.retrieveStoredVersion(modelID, versionNumber)
+	if err != nil {
+		return err
+	}
+	if err := b.storeSnapshots(modelID, version.versionInfo.VersionNumber); err != nil {
+		return err
+	}
+	return b.backend.DeleteModelVersion(modelID, int(version.versionInfo.VersionNumber))
+}
+
+func (b *deltaBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	versionInfos, err := b.backend.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+	return restoreVersionInfos(versionInfos)
+}
+
+func (b *deltaBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	versionInfos, err := b.backend.QueryModelVersionInfos(modelID, filter, initialVersionNumber, limit)
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+	return restoreVersionInfos(versionInfos)
+}
+
+func (b *deltaBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return b.backend.RetrieveStorageCapacity()
+}
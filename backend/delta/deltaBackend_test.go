@@ -0,0 +1,156 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delta
+
+import (
+	"testing"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuiteDeltaBackend(t *testing.T) {
+	underlyingBackends := make(map[backend.Backend]backend.Backend)
+	test.RunSuite(t, func() backend.Backend {
+		underlyingBackend, err := fs.CreateBackend(t.TempDir())
+		assert.NoError(t, err)
+		b, err := CreateBackend(underlyingBackend, 3)
+		assert.NoError(t, err)
+		underlyingBackends[b] = underlyingBackend
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+		underlyingBackends[b].Destroy()
+		delete(underlyingBackends, b)
+	})
+}
+
+func TestDeltaBackendStorage(t *testing.T) {
+	underlyingBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer underlyingBackend.Destroy()
+	b, err := CreateBackend(underlyingBackend, 3)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+
+	versionsData := [][]byte{}
+	for i := 0; i < 5; i++ {
+		data := append([]byte{}, test.Data1...)
+		data[i*10] = '#'
+		versionsData = append(versionsData, data)
+		versionInfo, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+			Data:     data,
+			DataHash: backend.ComputeSHA256Hash(data),
+			UserData: map[string]string{"step": "foo"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, backend.ComputeSHA256Hash(data), versionInfo.DataHash)
+		assert.Equal(t, len(data), versionInfo.DataSize)
+		assert.Equal(t, map[string]string{"step": "foo"}, versionInfo.UserData)
+	}
+
+	// Versions 1 and 4 are snapshots, the others are deltas
+	for versionNumber, isSnapshot := range map[int]bool{1: true, 2: false, 3: false, 4: true, 5: false} {
+		storedVersionInfo, err := underlyingBackend.RetrieveModelVersionInfo("foo", versionNumber)
+		assert.NoError(t, err)
+		if isSnapshot {
+			assert.Equal(t, len(test.Data1), storedVersionInfo.DataSize)
+		} else {
+			assert.Less(t, storedVersionInfo.DataSize, len(test.Data1)/10)
+		}
+	}
+
+	for versionNumber, data := range versionsData {
+		versionData, err := b.RetrieveModelVersionData("foo", versionNumber+1)
+		assert.NoError(t, err)
+		assert.Equal(t, data, versionData)
+		versionData, err = b.RetrieveModelVersionDataRange("foo", versionNumber+1, 10, 30)
+		assert.NoError(t, err)
+		assert.Equal(t, data[10:40], versionData)
+	}
+
+	// Deleting a base version stores the versions based on it as snapshots
+	err = b.DeleteModelVersion("foo", 2)
+	assert.NoError(t, err)
+	storedVersionInfo, err := underlyingBackend.RetrieveModelVersionInfo("foo", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, len(test.Data1), storedVersionInfo.DataSize)
+	for _, versionNumber := range []int{1, 3, 4, 5} {
+		versionData, err := b.RetrieveModelVersionData("foo", versionNumber)
+		assert.NoError(t, err)
+		assert.Equal(t, versionsData[versionNumber-1], versionData)
+	}
+
+	// Updating a base version does the same
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{VersionNumber: 4, Data: test.Data2, DataHash: backend.ComputeSHA256Hash(test.Data2)})
+	assert.NoError(t, err)
+	versionData, err := b.RetrieveModelVersionData("foo", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data2, versionData)
+	versionData, err = b.RetrieveModelVersionData("foo", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, versionsData[4], versionData)
+}
+
+// blockingBackend blocks the creation of the versions of a model until released
+type blockingBackend struct {
+	backend.Backend
+	modelID string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	if modelID == b.modelID {
+		close(b.started)
+		<-b.release
+	}
+	return b.Backend.CreateOrUpdateModelVersion(modelID, versionArgs)
+}
+
+func TestDeltaBackendConcurrentModels(t *testing.T) {
+	fsBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer fsBackend.Destroy()
+	underlyingBackend := &blockingBackend{Backend: fsBackend, modelID: "foo", started: make(chan struct{}), release: make(chan struct{})}
+	b, err := CreateBackend(underlyingBackend, 3)
+	assert.NoError(t, err)
+	defer b.Destroy()
+	for _, modelID := range []string{"foo", "bar"} {
+		_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: modelID})
+		assert.NoError(t, err)
+	}
+
+	created := make(chan error)
+	go func() {
+		_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: test.Data1, DataHash: backend.ComputeSHA256Hash(test.Data1)})
+		created <- err
+	}()
+	<-underlyingBackend.started
+
+	// The versions of another model are created while the one of "foo" is
+	_, err = b.CreateOrUpdateModelVersion("bar", backend.VersionArgs{Data: test.Data1, DataHash: backend.ComputeSHA256Hash(test.Data1)})
+	assert.NoError(t, err)
+	err = b.DeleteModelVersion("bar", 1)
+	assert.NoError(t, err)
+
+	close(underlyingBackend.release)
+	assert.NoError(t, <-created)
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Size of the blocks of the base data looked up in the target data
+const blockSize = 32
+
+// Maximum number of base blocks sharing a hash that are compared, bounds the cost of very repetitive data
+const maxBlocksPerHash = 8
+
+const (
+	copyOp   byte = 0
+	insertOp byte = 1
+)
+
+// weakHash computes the rsync rolling checksum of a block
+func weakHash(block []byte) (uint32, uint32) {
+	s1, s2 := uint32(0), uint32(0)
+	for i, x := range block {
+		s1 += uint32(x)
+		s2 += uint32(len(block)-i) * uint32(x)
+	}
+	return s1, s2
+}
+
+func appendUvarint(delta []byte, value uint64) []byte {
+	buffer := make([]byte, binary.MaxVarintLen64)
+	return append(delta, buffer[:binary.PutUvarint(buffer, value)]...)
+}
+
+func appendCopy(delta []byte, offset int, length int) []byte {
+	delta = append(delta, copyOp)
+	delta = appendUvarint(delta, uint64(offset))
+	return appendUvarint(delta, uint64(length))
+}
+
+func appendInsert(delta []byte, data []byte) []byte {
+	if len(data) == 0 {
+		return delta
+	}
+	delta = append(delta, insertOp)
+	delta = appendUvarint(delta, uint64(len(data)))
+	return append(delta, data...)
+}
+
+// Diff computes a delta transforming base into target, as a sequence of copies from base and insertions of new data
+func Diff(base []byte, target []byte) []byte {
+	delta := []byte{}
+	if len(base) < blockSize || len(target) < blockSize {
+		return appendInsert(delta, target)
+	}
+
+	index := make(map[uint32][]int)
+	for offset := 0; offset+blockSize <= len(base); offset += blockSize {
+		s1, s2 := weakHash(base[offset : offset+blockSize])
+		hash := s1&0xffff | s2<<16
+		if len(index[hash]) < maxBlocksPerHash {
+			index[hash] = append(index[hash], offset)
+		}
+	}
+
+	literalStart := 0
+	position := 0
+	s1, s2 := weakHash(target[0:blockSize])
+	for position+blockSize <= len(target) {
+		matched := false
+		for _, offset := range index[s1&0xffff|s2<<16] {
+			if !bytes.Equal(base[offset:offset+blockSize], target[position:position+blockSize]) {
+				continue
+			}
+			// Extend the match forward and backward into the pending literal
+			length := blockSize
+			for offset+length < len(base) && position+length < len(target) && base[offset+length] == target[position+length] {
+				length++
+			}
+			backward := 0
+			for backward < position-literalStart && backward < offset && base[offset-backward-1] == target[position-backward-1] {
+				backward++
+			}
+			delta = appendInsert(delta, target[literalStart:position-backward])
+			delta = appendCopy(delta, offset-backward, length+backward)
+			position += length
+			literalStart = position
+			matched = true
+			break
+		}
+		if matched {
+			if position+blockSize <= len(target) {
+				s1, s2 = weakHash(target[position : position+blockSize])
+			}
+			continue
+		}
+		if position+blockSize < len(target) {
+			removed, added := uint32(target[position]), uint32(target[position+blockSize])
+			s1 = s1 - removed + added
+			s2 = s2 - blockSize*removed + s1
+		}
+		position++
+	}
+	return appendInsert(delta, target[literalStart:])
+}
+
+// InvalidDeltaError is raised when a delta can't be applied to a base
+type InvalidDeltaError struct {
+	Reason string
+}
+
+func (e *InvalidDeltaError) Error() string {
+	return fmt.Sprintf("invalid delta, %s", e.Reason)
+}
+
+// Patch applies a delta computed by Diff to its base
+func Patch(base []byte, delta []byte) ([]byte, error) {
+	target := []byte{}
+	reader := bytes.NewReader(delta)
+	for reader.Len() > 0 {
+		op, _ := reader.ReadByte()
+		switch op {
+		case copyOp:
+			offset, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return nil, &InvalidDeltaError{Reason: "truncated copy offset"}
+			}
+			length, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return nil, &InvalidDeltaError{Reason: "truncated copy length"}
+			}
+			if offset > uint64(len(base)) || length > uint64(len(base))-offset {
+				return nil, &InvalidDeltaError{Reason: fmt.Sprintf("copy of %d bytes at offset %d out of a base of %d bytes", length, offset, len(base))}
+			}
+			target = append(target, base[offset:offset+length]...)
+		case insertOp:
+			length, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return nil, &InvalidDeltaError{Reason: "truncated insertion length"}
+			}
+			if length > uint64(reader.Len()) {
+				return nil, &InvalidDeltaError{Reason: fmt.Sprintf("insertion of %d bytes with only %d bytes left", length, reader.Len())}
+			}
+			data := make([]byte, length)
+			_, _ = reader.Read(data)
+			target = append(target, data...)
+		default:
+			return nil, &InvalidDeltaError{Reason: fmt.Sprintf("unknown operation %d", op)}
+		}
+	}
+	return target, nil
+}
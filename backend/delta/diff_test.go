@@ -0,0 +1,65 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delta
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffPatch(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	base := make([]byte, 64*1024)
+	random.Read(base)
+
+	// Scattered modifications, an insertion and a truncation
+	target := append([]byte{}, base...)
+	for i := 0; i < 20; i++ {
+		target[random.Intn(len(target))] = byte(random.Intn(256))
+	}
+	target = append(target[:1000], append([]byte("inserted data"), target[1000:]...)...)
+	target = target[:len(target)-500]
+
+	delta := Diff(base, target)
+	assert.Less(t, len(delta), len(target)/10)
+	patched, err := Patch(base, delta)
+	assert.NoError(t, err)
+	assert.Equal(t, target, patched)
+
+	for _, testCase := range []struct {
+		base   []byte
+		target []byte
+	}{
+		{base: []byte{}, target: []byte("short")},
+		{base: base, target: []byte{}},
+		{base: []byte("short"), target: base},
+		{base: base[:1000], target: base[500:]},
+	} {
+		patched, err := Patch(testCase.base, Diff(testCase.base, testCase.target))
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.target, patched)
+	}
+}
+
+func TestPatchInvalidDelta(t *testing.T) {
+	_, err := Patch([]byte("base"), []byte{copyOp, 2, 10})
+	assert.IsType(t, &InvalidDeltaError{}, err)
+	_, err = Patch([]byte("base"), []byte{insertOp, 10, 'a'})
+	assert.IsType(t, &InvalidDeltaError{}, err)
+	_, err = Patch([]byte("base"), []byte{42})
+	assert.IsType(t, &InvalidDeltaError{}, err)
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypted
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The data of the versions is sealed in chunks, each with its own nonce, for it to be written and read without holding
+// it all in memory
+//
+// The stored data is a random nonce prefix followed by the sealed chunks. The nonce of a chunk is the prefix followed by
+// the index of the chunk, as a 32 bits big endian integer, and by a byte set to 1 for the last chunk only, the chunks
+// can't be reordered, removed or truncated without failing to be opened. Every chunk but the last one holds chunkSize
+// bytes of data, the last one holds up to chunkSize bytes. The chunks are authenticated with the model id and the
+// version number.
+const (
+	defaultChunkSize = 64 * 1024
+	// Sizes of the nonces and of the authentication tags of AES-GCM, as created by the keyring
+	nonceSize       = 12
+	tagSize         = 16
+	noncePrefixSize = nonceSize - 5
+)
+
+// additionalData is the data the chunks of a version are authenticated with
+func additionalData(modelID string, versionNumber uint) []byte {
+	return []byte(fmt.Sprintf("%s\x00%d", modelID, versionNumber))
+}
+
+func chunkNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], index)
+	if last {
+		nonce[nonceSize-1] = 1
+	}
+	return nonce
+}
+
+// chunkSealer seals the data written to it in chunks written to an underlying writer, the last chunk is sealed by Close
+type chunkSealer struct {
+	aead           cipher.AEAD
+	additionalData []byte
+	writer         io.Writer
+	prefix         []byte
+	buffer         []byte
+	sealed         []byte
+	index          uint32
+}
+
+func createChunkSealer(aead cipher.AEAD, additionalData []byte, chunkSize int, w io.Writer) (*chunkSealer, error) {
+	if aead.NonceSize() != nonceSize || aead.Overhead() != tagSize {
+		return nil, errors.New("unable to seal chunks, the cipher isn't AES-GCM")
+	}
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("unable to generate a nonce prefix: %w", err)
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+	return &chunkSealer{
+		aead:           aead,
+		additionalData: additionalData,
+		writer:         w,
+		prefix:         prefix,
+		buffer:         make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (s *chunkSealer) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		if len(s.buffer) == cap(s.buffer) {
+			// More data follows, the buffered chunk isn't the last one
+			if err := s.seal(false); err != nil {
+				return written, err
+			}
+		}
+		copied := copy(s.buffer[len(s.buffer):cap(s.buffer)], data)
+		s.buffer = s.buffer[:len(s.buffer)+copied]
+		data = data[copied:]
+		written += copied
+	}
+	return written, nil
+}
+
+func (s *chunkSealer) seal(last bool) error {
+	if s.index == math.MaxUint32 && !last {
+		return errors.New("unable to seal a chunk, too many chunks")
+	}
+	s.sealed = s.aead.Seal(s.sealed[:0], chunkNonce(s.prefix, s.index, last), s.buffer, s.additionalData)
+	s.index++
+	s.buffer = s.buffer[:0]
+	_, err := s.writer.Write(s.sealed)
+	return err
+}
+
+// Close seals the last chunk, it can be empty
+func (s *chunkSealer) Close() error {
+	return s.seal(true)
+}
+
+// sealChunks seals the data of a version in memory
+func sealChunks(aead cipher.AEAD, additionalData []byte, chunkSize int, data []byte) ([]byte, error) {
+	sealedSize := noncePrefixSize + len(data) + (len(data)/chunkSize+1)*tagSize
+	sealedData := bytes.NewBuffer(make([]byte, 0, sealedSize))
+	sealer, err := createChunkSealer(aead, additionalData, chunkSize, sealedData)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sealer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := sealer.Close(); err != nil {
+		return nil, err
+	}
+	return sealedData.Bytes(), nil
+}
+
+// chunkLayout locates the sealed chunks in the stored data of a version
+type chunkLayout struct {
+	chunkSize       int
+	sealedChunkSize int
+	chunksCount     int
+	dataSize        int // Size of the data once opened
+}
+
+var errTruncatedChunks = errors.New("the stored data is truncated")
+
+func createChunkLayout(chunkSize int, storedSize int) (chunkLayout, error) {
+	sealedChunkSize := chunkSize + tagSize
+	sealedSize := storedSize - noncePrefixSize
+	if chunkSize <= 0 || sealedSize < tagSize {
+		return chunkLayout{}, errTruncatedChunks
+	}
+	chunksCount := (sealedSize + sealedChunkSize - 1) / sealedChunkSize
+	if sealedSize-(chunksCount-1)*sealedChunkSize < tagSize {
+		return chunkLayout{}, errTruncatedChunks
+	}
+	return chunkLayout{
+		chunkSize:       chunkSize,
+		sealedChunkSize: sealedChunkSize,
+		chunksCount:     chunksCount,
+		dataSize:        sealedSize - chunksCount*tagSize,
+	}, nil
+}
+
+// storedRange returns the range of the stored data holding the chunks from first to last, included
+func (l chunkLayout) storedRange(first int, last int) (uint64, uint64) {
+	return uint64(noncePrefixSize + first*l.sealedChunkSize), uint64((last - first + 1) * l.sealedChunkSize)
+}
+
+// openChunks opens consecutive sealed chunks, starting with the one at index first
+func (l chunkLayout) openChunks(aead cipher.AEAD, additionalData []byte, prefix []byte, first int, sealedChunks []byte) ([]byte, error) {
+	if aead.NonceSize() != nonceSize || aead.Overhead() != tagSize {
+		return nil, errors.New("unable to open chunks, the cipher isn't AES-GCM")
+	}
+	data := make([]byte, 0, len(sealedChunks))
+	for index := first; len(sealedChunks) > 0; index++ {
+		if index >= l.chunksCount {
+			return nil, errTruncatedChunks
+		}
+		size := l.sealedChunkSize
+		if size > len(sealedChunks) {
+			size = len(sealedChunks)
+		}
+		var err error
+		data, err = aead.Open(data, chunkNonce(prefix, uint32(index), index == l.chunksCount-1), sealedChunks[:size], additionalData)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open chunk %d: %w", index, err)
+		}
+		sealedChunks = sealedChunks[size:]
+	}
+	return data, nil
+}
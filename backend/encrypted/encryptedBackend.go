@@ -0,0 +1,567 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypted
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// Reserved user data keys recording how the data of a version is stored in the underlying backend
+const (
+	keyIDUserDataKey    = "cogment_model_registry.encryption_key_id"
+	dataHashUserDataKey = "cogment_model_registry.plaintext_data_hash"
+	dataSizeUserDataKey = "cogment_model_registry.plaintext_data_size"
+	// Size of the chunks the data is sealed in, versions without it are sealed at once
+	chunkSizeUserDataKey = "cogment_model_registry.encryption_chunk_size"
+	// Marks the versions created to reserve their number while their data is sealed, they are hidden until it is stored
+	pendingUserDataKey = "cogment_model_registry.encryption_pending"
+)
+
+var reservedUserDataKeys = []string{keyIDUserDataKey, dataHashUserDataKey, dataSizeUserDataKey, chunkSizeUserDataKey, pendingUserDataKey}
+
+type encryptedBackend struct {
+	backend   backend.Backend
+	keyring   *Keyring
+	chunkSize int
+}
+
+// CreateBackend creates a new backend encrypting the data of the versions with AES-GCM before storing them in another backend
+//
+// The data is sealed in chunks authenticated with the model id and the version number, versions can be streamed and
+// ranges retrieved without holding the whole data in memory. The id of the key, the hash of the plaintext data and the
+// size of the chunks are recorded in reserved entries of the versions user data, they are removed when the versions are
+// retrieved and the key id is exposed as `DataEncryptionKeyID`. Every key that encrypted a stored version needs to stay
+// in the keyring for it to be retrieved. Versions stored in clear, e.g. before encryption was enabled, are retrieved as
+// is. The underlying backend is not destroyed with the created backend.
+func CreateBackend(b backend.Backend, keyring *Keyring) (backend.Backend, error) {
+	return &encryptedBackend{
+		backend:   b,
+		keyring:   keyring,
+		chunkSize: defaultChunkSize,
+	}, nil
+}
+
+func (b *encryptedBackend) Destroy() {
+}
+
+// BindContext binds the underlying backend to the context
+func (b *encryptedBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	boundBackend, ok := backend.BindContext(b.backend, ctx)
+	if !ok {
+		return nil, false
+	}
+	return &encryptedBackend{backend: boundBackend, keyring: b.keyring, chunkSize: b.chunkSize}, true
+}
+
+func (b *encryptedBackend) Ping() error {
+	return b.backend.Ping()
+}
+
+// restoreVersionInfo converts the info of a stored version to the info of the plaintext version
+func restoreVersionInfo(versionInfo backend.VersionInfo) (backend.VersionInfo, error) {
+	keyID, ok := versionInfo.UserData[keyIDUserDataKey]
+	if !ok {
+		return versionInfo, nil
+	}
+	var dataSize int
+	if _, ok := versionInfo.UserData[chunkSizeUserDataKey]; ok {
+		layout, err := versionChunkLayout(versionInfo)
+		if err != nil {
+			return backend.VersionInfo{}, fmt.Errorf(`unable to read the data size of model %q version "%d": %w`, versionInfo.ModelID, versionInfo.VersionNumber, err)
+		}
+		dataSize = layout.dataSize
+	} else {
+		var err error
+		dataSize, err = strconv.Atoi(versionInfo.UserData[dataSizeUserDataKey])
+		if err != nil {
+			return backend.VersionInfo{}, fmt.Errorf(`unable to read the data size of model %q version "%d": %w`, versionInfo.ModelID, versionInfo.VersionNumber, err)
+		}
+	}
+	userData := make(map[string]string, len(versionInfo.UserData))
+	for key, value := range versionInfo.UserData {
+		userData[key] = value
+	}
+	for _, key := range reservedUserDataKeys {
+		delete(userData, key)
+	}
+
+	versionInfo.DataHash = versionInfo.UserData[dataHashUserDataKey]
+	versionInfo.DataSize = dataSize
+	versionInfo.DataEncryptionKeyID = keyID
+	versionInfo.UserData = userData
+	return versionInfo, nil
+}
+
+// versionChunkLayout locates the sealed chunks in the stored data of a version
+func versionChunkLayout(storedVersionInfo backend.VersionInfo) (chunkLayout, error) {
+	chunkSize, err := strconv.Atoi(storedVersionInfo.UserData[chunkSizeUserDataKey])
+	if err != nil {
+		return chunkLayout{}, fmt.Errorf(`unable to read the chunk size of model %q version "%d": %w`, storedVersionInfo.ModelID, storedVersionInfo.VersionNumber, err)
+	}
+	return createChunkLayout(chunkSize, storedVersionInfo.DataSize)
+}
+
+func isPending(storedVersionInfo backend.VersionInfo) bool {
+	_, ok := storedVersionInfo.UserData[pendingUserDataKey]
+	return ok
+}
+
+// retrieveStoredVersionInfo retrieves the stored info of a version, skipping the pending ones
+func (b *encryptedBackend) retrieveStoredVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	if versionNumber >= 0 {
+		storedVersionInfo, err := b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+		if err != nil {
+			return backend.VersionInfo{}, err
+		}
+		if isPending(storedVersionInfo) {
+			return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return storedVersionInfo, nil
+	}
+	// Counting the nth to last version from the end without the pending ones
+	for storedVersionNumber, skipped := -1, -versionNumber-1; ; storedVersionNumber-- {
+		storedVersionInfo, err := b.backend.RetrieveModelVersionInfo(modelID, storedVersionNumber)
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelVersionError)) {
+				return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+			}
+			return backend.VersionInfo{}, err
+		}
+		if isPending(storedVersionInfo) {
+			continue
+		}
+		if skipped == 0 {
+			return storedVersionInfo, nil
+		}
+		skipped--
+	}
+}
+
+// listVersionInfos lists the info of versions without the pending ones, listing more to fill the limit
+func listVersionInfos(list func(initialVersionNumber uint, limit int) ([]backend.VersionInfo, error), initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	versionInfos := []backend.VersionInfo{}
+	for {
+		storedVersionInfos, err := list(initialVersionNumber, limit)
+		if err != nil {
+			return []backend.VersionInfo{}, err
+		}
+		for _, storedVersionInfo := range storedVersionInfos {
+			if isPending(storedVersionInfo) || (limit > 0 && len(versionInfos) == limit) {
+				continue
+			}
+			versionInfo, err := restoreVersionInfo(storedVersionInfo)
+			if err != nil {
+				return []backend.VersionInfo{}, err
+			}
+			versionInfos = append(versionInfos, versionInfo)
+		}
+		if limit <= 0 || len(versionInfos) == limit || len(storedVersionInfos) < limit {
+			return versionInfos, nil
+		}
+		initialVersionNumber = storedVersionInfos[len(storedVersionInfos)-1].VersionNumber + 1
+	}
+}
+
+func (b *encryptedBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	return b.backend.CreateOrUpdateModel(modelArgs)
+}
+
+func (b *encryptedBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	return b.backend.RetrieveModelInfo(modelID)
+}
+
+func (b *encryptedBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	latestVersionNumber, err := b.backend.RetrieveModelLatestVersionNumber(modelID)
+	if err != nil || latestVersionNumber == 0 {
+		return latestVersionNumber, err
+	}
+	storedVersionInfo, err := b.retrieveStoredVersionInfo(modelID, -1)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return storedVersionInfo.VersionNumber, nil
+}
+
+func (b *encryptedBackend) HasModel(modelID string) (bool, error) {
+	return b.backend.HasModel(modelID)
+}
+
+func (b *encryptedBackend) DeleteModel(modelID string) error {
+	return b.backend.DeleteModel(modelID)
+}
+
+func (b *encryptedBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.backend.ListModels(offset, limit)
+}
+
+func (b *encryptedBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.backend.QueryModels(filter, offset, limit)
+}
+
+// storedUserData adds the reserved entries recording how the data of a version is encrypted to its user data
+func (b *encryptedBackend) storedUserData(versionArgs backend.VersionArgs, keyID string) map[string]string {
+	userData := make(map[string]string, len(versionArgs.UserData)+3)
+	for key, value := range versionArgs.UserData {
+		userData[key] = value
+	}
+	userData[keyIDUserDataKey] = keyID
+	userData[dataHashUserDataKey] = versionArgs.DataHash
+	userData[chunkSizeUserDataKey] = strconv.Itoa(b.chunkSize)
+	return userData
+}
+
+// reserveVersionNumber returns the number of the version to create, the data being authenticated with it
+//
+// New versions are first created pending, without data, in the underlying backend to get their number, the returned
+// cancel function deletes them if the creation doesn't complete.
+func (b *encryptedBackend) reserveVersionNumber(modelID string, versionArgs backend.VersionArgs, userData map[string]string) (uint, func(), error) {
+	if versionArgs.VersionNumber != 0 {
+		return versionArgs.VersionNumber, func() {}, nil
+	}
+	pendingUserData := make(map[string]string, len(userData)+1)
+	for key, value := range userData {
+		pendingUserData[key] = value
+	}
+	pendingUserData[pendingUserDataKey] = "true"
+	versionInfo, err := b.backend.CreateOrUpdateModelVersion(modelID, backend.VersionArgs{
+		CreationTimestamp: versionArgs.CreationTimestamp,
+		Archived:          versionArgs.Archived,
+		DataHash:          backend.ComputeSHA256Hash([]byte{}),
+		Data:              []byte{},
+		UserData:          pendingUserData,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return versionInfo.VersionNumber, func() {
+		_ = b.backend.DeleteModelVersion(modelID, int(versionInfo.VersionNumber))
+	}, nil
+}
+
+// CreateOrUpdateModelVersion encrypts the data of a version with the current key and stores it in the underlying backend
+func (b *encryptedBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	keyID := b.keyring.CurrentKeyID()
+	aead, err := b.keyring.lookup(keyID)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	userData := b.storedUserData(versionArgs, keyID)
+	versionNumber, cancel, err := b.reserveVersionNumber(modelID, versionArgs, userData)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	encryptedData, err := sealChunks(aead, additionalData(modelID, versionNumber), b.chunkSize, versionArgs.Data)
+	if err != nil {
+		cancel()
+		return backend.VersionInfo{}, fmt.Errorf("unable to encrypt data for model %q: %w", modelID, err)
+	}
+
+	storedVersionArgs := versionArgs
+	storedVersionArgs.VersionNumber = versionNumber
+	storedVersionArgs.Data = encryptedData
+	storedVersionArgs.DataHash = backend.ComputeSHA256Hash(encryptedData)
+	storedVersionArgs.DataHashAlgorithm = ""
+	storedVersionArgs.DataSize = 0
+	storedVersionArgs.UserData = userData
+	versionInfo, err := b.backend.CreateOrUpdateModelVersion(modelID, storedVersionArgs)
+	if err != nil {
+		cancel()
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+// CreateOrUpdateModelVersionStream seals the data in chunks as it is written to a stream of the underlying backend
+//
+// The hash of the plaintext data is recorded when the version is created, when it isn't known beforehand the data is
+// buffered to compute it before being sealed.
+func (b *encryptedBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	if versionArgs.DataHash == "" {
+		hasModel, err := b.backend.HasModel(modelID)
+		if err != nil {
+			return nil, err
+		}
+		if !hasModel {
+			return nil, &backend.UnknownModelError{ModelID: modelID}
+		}
+		return backend.CreateBufferedVersionDataWriter(b, modelID, versionArgs), nil
+	}
+	hasher, err := backend.CreateVersionHasher(versionArgs)
+	if err != nil {
+		return nil, err
+	}
+	keyID := b.keyring.CurrentKeyID()
+	aead, err := b.keyring.lookup(keyID)
+	if err != nil {
+		return nil, err
+	}
+	userData := b.storedUserData(versionArgs, keyID)
+	versionNumber, cancel, err := b.reserveVersionNumber(modelID, versionArgs, userData)
+	if err != nil {
+		return nil, err
+	}
+
+	storedVersionArgs := versionArgs
+	storedVersionArgs.VersionNumber = versionNumber
+	storedVersionArgs.Data = nil
+	storedVersionArgs.DataHash = ""
+	storedVersionArgs.DataHashAlgorithm = ""
+	storedVersionArgs.DataSize = 0
+	storedVersionArgs.UserData = userData
+	writer, err := b.backend.CreateOrUpdateModelVersionStream(modelID, storedVersionArgs)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	sealer, err := createChunkSealer(aead, additionalData(modelID, versionNumber), b.chunkSize, writer)
+	if err != nil {
+		_ = writer.Abort()
+		cancel()
+		return nil, fmt.Errorf("unable to encrypt data for model %q: %w", modelID, err)
+	}
+	return &encryptedVersionDataWriter{
+		modelID:          modelID,
+		expectedDataHash: versionArgs.DataHash,
+		hasher:           hasher,
+		sealer:           sealer,
+		writer:           writer,
+		cancel:           cancel,
+	}, nil
+}
+
+func (b *encryptedBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	versionInfo, err := b.retrieveStoredVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+// RetrieveModelVersionData retrieves and decrypts a given model version data
+func (b *encryptedBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	storedVersionInfo, err := b.retrieveStoredVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	storedData, err := b.backend.RetrieveModelVersionData(modelID, int(storedVersionInfo.VersionNumber))
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return []byte{}, err
+	}
+	keyID, ok := storedVersionInfo.UserData[keyIDUserDataKey]
+	if !ok {
+		return storedData, nil
+	}
+	aead, err := b.keyring.lookup(keyID)
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to decrypt data for model %q version "%d": %w`, modelID, storedVersionInfo.VersionNumber, err)
+	}
+	if _, ok := storedVersionInfo.UserData[chunkSizeUserDataKey]; !ok {
+		return openLegacyData(aead, storedVersionInfo, storedData)
+	}
+	storedVersionInfo.DataSize = len(storedData)
+	layout, err := versionChunkLayout(storedVersionInfo)
+	if err == nil {
+		var versionData []byte
+		versionData, err = layout.openChunks(aead, additionalData(modelID, storedVersionInfo.VersionNumber), storedData[:noncePrefixSize], 0, storedData[noncePrefixSize:])
+		if err == nil {
+			return versionData, nil
+		}
+	}
+	return []byte{}, fmt.Errorf(`unable to decrypt data for model %q version "%d": %w`, modelID, storedVersionInfo.VersionNumber, err)
+}
+
+// openLegacyData decrypts the data of versions sealed at once, authenticated with the model id only
+func openLegacyData(aead cipher.AEAD, storedVersionInfo backend.VersionInfo, storedData []byte) ([]byte, error) {
+	if len(storedData) < aead.NonceSize() {
+		return []byte{}, fmt.Errorf(`unable to decrypt data for model %q version "%d": %w`, storedVersionInfo.ModelID, storedVersionInfo.VersionNumber, errTruncatedChunks)
+	}
+	nonce, sealedData := storedData[:aead.NonceSize()], storedData[aead.NonceSize():]
+	versionData, err := aead.Open(nil, nonce, sealedData, []byte(storedVersionInfo.ModelID))
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to decrypt data for model %q version "%d": %w`, storedVersionInfo.ModelID, storedVersionInfo.VersionNumber, err)
+	}
+	return versionData, nil
+}
+
+// RetrieveModelVersionDataRange retrieves a range of a given model version data, decrypting only the chunks it spans
+func (b *encryptedBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	storedVersionInfo, err := b.retrieveStoredVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	keyID, ok := storedVersionInfo.UserData[keyIDUserDataKey]
+	if !ok {
+		return b.backend.RetrieveModelVersionDataRange(modelID, int(storedVersionInfo.VersionNumber), offset, length)
+	}
+	if _, ok := storedVersionInfo.UserData[chunkSizeUserDataKey]; !ok {
+		versionData, err := b.RetrieveModelVersionData(modelID, int(storedVersionInfo.VersionNumber))
+		if err != nil {
+			return []byte{}, err
+		}
+		return backend.SliceDataRange(modelID, versionNumber, versionData, offset, length)
+	}
+	aead, err := b.keyring.lookup(keyID)
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to decrypt data for model %q version "%d": %w`, modelID, storedVersionInfo.VersionNumber, err)
+	}
+	layout, err := versionChunkLayout(storedVersionInfo)
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to decrypt data for model %q version "%d": %w`, modelID, storedVersionInfo.VersionNumber, err)
+	}
+	end, err := backend.ResolveDataRange(modelID, versionNumber, uint64(layout.dataSize), offset, length)
+	if err != nil {
+		return []byte{}, err
+	}
+	if end == offset {
+		return []byte{}, nil
+	}
+
+	chunkSize := uint64(layout.chunkSize)
+	firstChunk, lastChunk := int(offset/chunkSize), int((end-1)/chunkSize)
+	prefix, err := b.backend.RetrieveModelVersionDataRange(modelID, int(storedVersionInfo.VersionNumber), 0, noncePrefixSize)
+	if err != nil {
+		return []byte{}, err
+	}
+	storedOffset, storedLength := layout.storedRange(firstChunk, lastChunk)
+	sealedChunks, err := b.backend.RetrieveModelVersionDataRange(modelID, int(storedVersionInfo.VersionNumber), storedOffset, storedLength)
+	if err != nil {
+		return []byte{}, err
+	}
+	chunks, err := layout.openChunks(aead, additionalData(modelID, storedVersionInfo.VersionNumber), prefix, firstChunk, sealedChunks)
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to decrypt data for model %q version "%d": %w`, modelID, storedVersionInfo.VersionNumber, err)
+	}
+	chunksOffset := uint64(firstChunk) * chunkSize
+	if end-chunksOffset > uint64(len(chunks)) {
+		return []byte{}, fmt.Errorf(`unable to decrypt data for model %q version "%d": %w`, modelID, storedVersionInfo.VersionNumber, errTruncatedChunks)
+	}
+	return chunks[offset-chunksOffset : end-chunksOffset], nil
+}
+
+func (b *encryptedBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	versionInfo, err := b.backend.UpdateModelVersionArchived(modelID, versionNumber, archived)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+// UpdateModelVersionUserData replaces the user data of a given model version, keeping the stored encryption metadata
+func (b *encryptedBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	storedVersionInfo, err := b.retrieveStoredVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	storedUserData := make(map[string]string, len(userData)+len(reservedUserDataKeys))
+	for key, value := range userData {
+		storedUserData[key] = value
+	}
+	for _, key := range reservedUserDataKeys {
+		if value, ok := storedVersionInfo.UserData[key]; ok {
+			storedUserData[key] = value
+		} else {
+			delete(storedUserData, key)
+		}
+	}
+	versionInfo, err := b.backend.UpdateModelVersionUserData(modelID, int(storedVersionInfo.VersionNumber), storedUserData)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+func (b *encryptedBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	return b.backend.DeleteModelVersion(modelID, versionNumber)
+}
+
+func (b *encryptedBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return listVersionInfos(func(initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+		return b.backend.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+	}, initialVersionNumber, limit)
+}
+
+func (b *encryptedBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return listVersionInfos(func(initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+		return b.backend.QueryModelVersionInfos(modelID, filter, initialVersionNumber, limit)
+	}, initialVersionNumber, limit)
+}
+
+func (b *encryptedBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return b.backend.RetrieveStorageCapacity()
+}
+
+type encryptedVersionDataWriter struct {
+	modelID          string
+	expectedDataHash string
+	hasher           backend.Hasher
+	sealer           *chunkSealer
+	writer           backend.VersionDataWriter
+	cancel           func()
+	closed           bool
+}
+
+func (w *encryptedVersionDataWriter) Write(data []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("unable to write data for model %q: writer already closed", w.modelID)
+	}
+	_, _ = w.hasher.Write(data)
+	return w.sealer.Write(data)
+}
+
+// Commit seals the last chunk and checks the hash of the plaintext data before committing the underlying stream
+func (w *encryptedVersionDataWriter) Commit() (backend.VersionInfo, error) {
+	if w.closed {
+		return backend.VersionInfo{}, fmt.Errorf("unable to commit data for model %q: writer already closed", w.modelID)
+	}
+	w.closed = true
+	if err := w.sealer.Close(); err != nil {
+		_ = w.writer.Abort()
+		w.cancel()
+		return backend.VersionInfo{}, err
+	}
+	if dataHash := w.hasher.Hash(); dataHash != w.expectedDataHash {
+		_ = w.writer.Abort()
+		w.cancel()
+		return backend.VersionInfo{}, &backend.DataHashMismatchError{ModelID: w.modelID, ExpectedDataHash: w.expectedDataHash, DataHash: dataHash}
+	}
+	versionInfo, err := w.writer.Commit()
+	if err != nil {
+		w.cancel()
+		return backend.VersionInfo{}, err
+	}
+	return restoreVersionInfo(versionInfo)
+}
+
+func (w *encryptedVersionDataWriter) Abort() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.writer.Abort()
+	w.cancel()
+	return err
+}
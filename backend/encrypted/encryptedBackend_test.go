@@ -0,0 +1,317 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypted
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var key1 = bytes.Repeat([]byte{1}, KeySize)
+var key2 = bytes.Repeat([]byte{2}, KeySize)
+
+func TestSuiteEncryptedBackend(t *testing.T) {
+	keyring, err := CreateKeyring("key1", map[string][]byte{"key1": key1})
+	assert.NoError(t, err)
+	underlyingBackends := make(map[backend.Backend]backend.Backend)
+	test.RunSuite(t, func() backend.Backend {
+		underlyingBackend, err := fs.CreateBackend(t.TempDir())
+		assert.NoError(t, err)
+		b, err := CreateBackend(underlyingBackend, keyring)
+		assert.NoError(t, err)
+		underlyingBackends[b] = underlyingBackend
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+		underlyingBackends[b].Destroy()
+		delete(underlyingBackends, b)
+	})
+}
+
+func TestEncryptedBackendStorage(t *testing.T) {
+	underlyingBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer underlyingBackend.Destroy()
+	keyring, err := CreateKeyring("key1", map[string][]byte{"key1": key1})
+	assert.NoError(t, err)
+	b, err := CreateBackend(underlyingBackend, keyring)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+
+	// A version created before the encryption was enabled
+	_, err = underlyingBackend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: test.Data1, DataHash: backend.ComputeSHA256Hash(test.Data1)})
+	assert.NoError(t, err)
+
+	versionInfo, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+		Data:     test.Data1,
+		DataHash: backend.ComputeSHA256Hash(test.Data1),
+		UserData: map[string]string{"foo": "bar"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), versionInfo.VersionNumber)
+	assert.Equal(t, "key1", versionInfo.DataEncryptionKeyID)
+	assert.Equal(t, backend.ComputeSHA256Hash(test.Data1), versionInfo.DataHash)
+	assert.Equal(t, len(test.Data1), versionInfo.DataSize)
+	assert.Equal(t, map[string]string{"foo": "bar"}, versionInfo.UserData)
+
+	storedData, err := underlyingBackend.RetrieveModelVersionData("foo", 2)
+	assert.NoError(t, err)
+	assert.NotEqual(t, test.Data1, storedData)
+	assert.False(t, bytes.Contains(storedData, test.Data1[:16]))
+
+	for _, versionNumber := range []int{1, 2} {
+		data, err := b.RetrieveModelVersionData("foo", versionNumber)
+		assert.NoError(t, err)
+		assert.Equal(t, test.Data1, data)
+		data, err = b.RetrieveModelVersionDataRange("foo", versionNumber, 10, 20)
+		assert.NoError(t, err)
+		assert.Equal(t, test.Data1[10:30], data)
+	}
+
+	// Rotating the key, the previous one is kept to decrypt the existing versions
+	rotatedKeyring, err := CreateKeyring("key2", map[string][]byte{"key1": key1, "key2": key2})
+	assert.NoError(t, err)
+	rotatedBackend, err := CreateBackend(underlyingBackend, rotatedKeyring)
+	assert.NoError(t, err)
+	defer rotatedBackend.Destroy()
+
+	versionInfo, err = rotatedBackend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: test.Data2, DataHash: backend.ComputeSHA256Hash(test.Data2)})
+	assert.NoError(t, err)
+	assert.Equal(t, "key2", versionInfo.DataEncryptionKeyID)
+
+	data, err := rotatedBackend.RetrieveModelVersionData("foo", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data1, data)
+	data, err = rotatedBackend.RetrieveModelVersionData("foo", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data2, data)
+
+	// The initial keyring doesn't know the new key
+	_, err = b.RetrieveModelVersionData("foo", 3)
+	assert.Error(t, err)
+	var unknownKeyError *UnknownKeyError
+	assert.ErrorAs(t, err, &unknownKeyError)
+	assert.Equal(t, "key2", unknownKeyError.KeyID)
+}
+
+func TestEncryptedBackendAuthenticatesModelID(t *testing.T) {
+	underlyingBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer underlyingBackend.Destroy()
+	keyring, err := CreateKeyring("key1", map[string][]byte{"key1": key1})
+	assert.NoError(t, err)
+	b, err := CreateBackend(underlyingBackend, keyring)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	for _, modelID := range []string{"foo", "bar"} {
+		_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: modelID})
+		assert.NoError(t, err)
+	}
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: test.Data1, DataHash: backend.ComputeSHA256Hash(test.Data1)})
+	assert.NoError(t, err)
+
+	// Copying the stored version of "foo" to "bar"
+	storedVersionInfo, err := underlyingBackend.RetrieveModelVersionInfo("foo", 1)
+	assert.NoError(t, err)
+	storedData, err := underlyingBackend.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	_, err = underlyingBackend.CreateOrUpdateModelVersion("bar", backend.VersionArgs{
+		Data:     storedData,
+		DataHash: storedVersionInfo.DataHash,
+		UserData: storedVersionInfo.UserData,
+	})
+	assert.NoError(t, err)
+
+	_, err = b.RetrieveModelVersionData("bar", 1)
+	assert.Error(t, err)
+}
+
+func TestEncryptedBackendChunks(t *testing.T) {
+	underlyingBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer underlyingBackend.Destroy()
+	keyring, err := CreateKeyring("key1", map[string][]byte{"key1": key1})
+	assert.NoError(t, err)
+	b, err := CreateBackend(underlyingBackend, keyring)
+	assert.NoError(t, err)
+	defer b.Destroy()
+	b.(*encryptedBackend).chunkSize = 16
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	writer, err := b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{DataHash: backend.ComputeSHA256Hash(data)})
+	assert.NoError(t, err)
+	for i := 0; i < len(data); i += 7 {
+		end := i + 7
+		if end > len(data) {
+			end = len(data)
+		}
+		_, err = writer.Write(data[i:end])
+		assert.NoError(t, err)
+	}
+	versionInfo, err := writer.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	assert.Equal(t, len(data), versionInfo.DataSize)
+	assert.Equal(t, backend.ComputeSHA256Hash(data), versionInfo.DataHash)
+
+	storedVersionInfo, err := underlyingBackend.RetrieveModelVersionInfo("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, noncePrefixSize+len(data)+7*tagSize, storedVersionInfo.DataSize)
+
+	retrievedData, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, data, retrievedData)
+	for _, dataRange := range [][2]uint64{{0, 16}, {10, 20}, {15, 2}, {90, 0}, {96, 10}, {100, 0}} {
+		end := dataRange[0] + dataRange[1]
+		if dataRange[1] == 0 || end > uint64(len(data)) {
+			end = uint64(len(data))
+		}
+		retrievedData, err = b.RetrieveModelVersionDataRange("foo", 1, dataRange[0], dataRange[1])
+		assert.NoError(t, err)
+		assert.Equal(t, data[dataRange[0]:end], retrievedData)
+	}
+
+	// A stream with the wrong hash doesn't leave any version
+	writer, err = b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{DataHash: backend.ComputeSHA256Hash(test.Data1)})
+	assert.NoError(t, err)
+
+	// The version being written is hidden
+	versionInfo, err = b.RetrieveModelVersionInfo("foo", -1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	_, err = b.RetrieveModelVersionInfo("foo", 2)
+	assert.ErrorAs(t, err, new(*backend.UnknownModelVersionError))
+	latestVersionNumber, err := b.RetrieveModelLatestVersionNumber("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), latestVersionNumber)
+	versionInfos, err := b.ListModelVersionInfos("foo", 0, 1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 1)
+
+	_, err = writer.Write(data)
+	assert.NoError(t, err)
+	_, err = writer.Commit()
+	assert.ErrorAs(t, err, new(*backend.DataHashMismatchError))
+	versionInfos, err = b.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 1)
+
+	// Truncating the stored data, even at a chunk boundary
+	storedData, err := underlyingBackend.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	for _, truncatedSize := range []int{len(storedData) - 1, noncePrefixSize + 6*(16+tagSize)} {
+		_, err = underlyingBackend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+			VersionNumber: 1,
+			Data:          storedData[:truncatedSize],
+			DataHash:      backend.ComputeSHA256Hash(storedData[:truncatedSize]),
+			UserData:      storedVersionInfo.UserData,
+		})
+		assert.NoError(t, err)
+		_, err = b.RetrieveModelVersionData("foo", 1)
+		assert.Error(t, err)
+		_, err = b.RetrieveModelVersionDataRange("foo", 1, 80, 0)
+		assert.Error(t, err)
+	}
+}
+
+func TestEncryptedBackendAuthenticatesVersionNumber(t *testing.T) {
+	underlyingBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer underlyingBackend.Destroy()
+	keyring, err := CreateKeyring("key1", map[string][]byte{"key1": key1})
+	assert.NoError(t, err)
+	b, err := CreateBackend(underlyingBackend, keyring)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	for _, data := range [][]byte{test.Data1, test.Data2} {
+		_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: data, DataHash: backend.ComputeSHA256Hash(data)})
+		assert.NoError(t, err)
+	}
+
+	// Replacing the stored version 2 of "foo" by its version 1
+	storedVersionInfo, err := underlyingBackend.RetrieveModelVersionInfo("foo", 1)
+	assert.NoError(t, err)
+	storedData, err := underlyingBackend.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	_, err = underlyingBackend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+		VersionNumber: 2,
+		Data:          storedData,
+		DataHash:      storedVersionInfo.DataHash,
+		UserData:      storedVersionInfo.UserData,
+	})
+	assert.NoError(t, err)
+
+	_, err = b.RetrieveModelVersionData("foo", 2)
+	assert.Error(t, err)
+	_, err = b.RetrieveModelVersionDataRange("foo", 2, 0, 10)
+	assert.Error(t, err)
+}
+
+func TestEncryptedBackendLegacyVersions(t *testing.T) {
+	underlyingBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer underlyingBackend.Destroy()
+	keyring, err := CreateKeyring("key1", map[string][]byte{"key1": key1})
+	assert.NoError(t, err)
+	b, err := CreateBackend(underlyingBackend, keyring)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+
+	// A version sealed at once, authenticated with the model id only
+	aead, err := keyring.lookup("key1")
+	assert.NoError(t, err)
+	nonce := make([]byte, aead.NonceSize())
+	storedData := aead.Seal(nonce, nonce, test.Data1, []byte("foo"))
+	_, err = underlyingBackend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+		Data:     storedData,
+		DataHash: backend.ComputeSHA256Hash(storedData),
+		UserData: map[string]string{
+			keyIDUserDataKey:    "key1",
+			dataHashUserDataKey: backend.ComputeSHA256Hash(test.Data1),
+			dataSizeUserDataKey: strconv.Itoa(len(test.Data1)),
+		},
+	})
+	assert.NoError(t, err)
+
+	versionInfo, err := b.RetrieveModelVersionInfo("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, len(test.Data1), versionInfo.DataSize)
+	assert.Equal(t, backend.ComputeSHA256Hash(test.Data1), versionInfo.DataHash)
+	data, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data1, data)
+	data, err = b.RetrieveModelVersionDataRange("foo", 1, 10, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data1[10:30], data)
+}
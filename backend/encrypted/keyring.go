@@ -0,0 +1,118 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypted
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the size of the AES-256 keys
+const KeySize = 32
+
+// Keyring holds the keys able to decrypt the versions data, new versions are encrypted with the current one
+type Keyring struct {
+	currentKeyID string
+	aeads        map[string]cipher.AEAD
+}
+
+// InvalidKeyringError is raised when parsing an invalid keyring
+type InvalidKeyringError struct {
+	Reason string
+}
+
+func (e *InvalidKeyringError) Error() string {
+	return fmt.Sprintf("invalid encryption keyring, %s", e.Reason)
+}
+
+// UnknownKeyError is raised when a version was encrypted with a key that isn't in the keyring
+type UnknownKeyError struct {
+	KeyID string
+}
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("unknown encryption key %q", e.KeyID)
+}
+
+// CreateKeyring creates a keyring from AES-256 keys indexed by their id
+func CreateKeyring(currentKeyID string, keys map[string][]byte) (*Keyring, error) {
+	keyring := &Keyring{
+		currentKeyID: currentKeyID,
+		aeads:        make(map[string]cipher.AEAD, len(keys)),
+	}
+	for keyID, key := range keys {
+		if keyID == "" || strings.ContainsAny(keyID, ",:") {
+			return nil, &InvalidKeyringError{Reason: fmt.Sprintf("key id %q is empty or contains ',' or ':'", keyID)}
+		}
+		if len(key) != KeySize {
+			return nil, &InvalidKeyringError{Reason: fmt.Sprintf("key %q is %d bytes long, expecting %d", keyID, len(key), KeySize)}
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create the cipher of key %q: %w", keyID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create the cipher of key %q: %w", keyID, err)
+		}
+		keyring.aeads[keyID] = aead
+	}
+	if _, ok := keyring.aeads[currentKeyID]; !ok {
+		return nil, &InvalidKeyringError{Reason: fmt.Sprintf("current key %q is not defined", currentKeyID)}
+	}
+	return keyring, nil
+}
+
+// ParseKeyring parses a keyring from a comma separated list of `<key id>:<base64 encoded key>`, the first key is the current one
+func ParseKeyring(spec string) (*Keyring, error) {
+	currentKeyID := ""
+	keys := make(map[string][]byte)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		separatorIndex := strings.Index(entry, ":")
+		if separatorIndex < 0 {
+			return nil, &InvalidKeyringError{Reason: fmt.Sprintf("entry %q is not formatted as `<key id>:<base64 encoded key>`", entry)}
+		}
+		keyID := entry[:separatorIndex]
+		key, err := base64.StdEncoding.DecodeString(entry[separatorIndex+1:])
+		if err != nil {
+			return nil, &InvalidKeyringError{Reason: fmt.Sprintf("key %q is not base64 encoded", keyID)}
+		}
+		if _, ok := keys[keyID]; ok {
+			return nil, &InvalidKeyringError{Reason: fmt.Sprintf("key %q is defined twice", keyID)}
+		}
+		keys[keyID] = key
+		if currentKeyID == "" {
+			currentKeyID = keyID
+		}
+	}
+	return CreateKeyring(currentKeyID, keys)
+}
+
+// CurrentKeyID is the id of the key encrypting new versions
+func (k *Keyring) CurrentKeyID() string {
+	return k.currentKeyID
+}
+
+func (k *Keyring) lookup(keyID string) (cipher.AEAD, error) {
+	aead, ok := k.aeads[keyID]
+	if !ok {
+		return nil, &UnknownKeyError{KeyID: keyID}
+	}
+	return aead, nil
+}
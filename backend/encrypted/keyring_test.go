@@ -0,0 +1,45 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypted
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeyring(t *testing.T) {
+	keyring, err := ParseKeyring("key2:" + base64.StdEncoding.EncodeToString(key2) + ", key1:" + base64.StdEncoding.EncodeToString(key1))
+	assert.NoError(t, err)
+	assert.Equal(t, "key2", keyring.CurrentKeyID())
+	_, err = keyring.lookup("key1")
+	assert.NoError(t, err)
+	_, err = keyring.lookup("key3")
+	assert.IsType(t, &UnknownKeyError{}, err)
+}
+
+func TestParseInvalidKeyring(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"key1",
+		"key1:not-base64",
+		"key1:" + base64.StdEncoding.EncodeToString(key1[:16]),
+		"key1:" + base64.StdEncoding.EncodeToString(key1) + ",key1:" + base64.StdEncoding.EncodeToString(key2),
+	} {
+		_, err := ParseKeyring(spec)
+		assert.IsType(t, &InvalidKeyringError{}, err, spec)
+	}
+}
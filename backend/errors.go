@@ -0,0 +1,165 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of errors reported by the backends, the error types below match them with errors.Is
+//
+// The backends and their users check the errors with errors.Is or errors.As, the errors then stay recognized when wrapped.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrCorrupted     = errors.New("corrupted")
+	ErrInvalidData   = errors.New("invalid data")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrConflict      = errors.New("conflict")
+)
+
+// UnknownModelError is raised when trying to operate on an unknown model
+type UnknownModelError struct {
+	ModelID string
+}
+
+func (e *UnknownModelError) Error() string {
+	return fmt.Sprintf("no model %q found", e.ModelID)
+}
+
+func (e *UnknownModelError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// UnknownModelVersionError is raised when trying to operate on an unknown model version
+type UnknownModelVersionError struct {
+	ModelID       string
+	VersionNumber int
+}
+
+func (e *UnknownModelVersionError) Error() string {
+	if e.VersionNumber == 0 {
+		return fmt.Sprintf("model %q doesn't have any version yet", e.ModelID)
+	}
+	if e.VersionNumber < 0 {
+		return fmt.Sprintf(`no version "n%d" for model %q found`, e.VersionNumber, e.ModelID)
+	}
+	return fmt.Sprintf(`no version "%d" for model %q found`, e.VersionNumber, e.ModelID)
+}
+
+func (e *UnknownModelVersionError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// AlreadyExistsError is raised when trying to create a model or a version that already exists
+type AlreadyExistsError struct {
+	ModelID       string
+	VersionNumber uint // 0 when the model itself already exists
+}
+
+func (e *AlreadyExistsError) Error() string {
+	if e.VersionNumber == 0 {
+		return fmt.Sprintf("model %q already exists", e.ModelID)
+	}
+	return fmt.Sprintf(`version "%d" of model %q already exists`, e.VersionNumber, e.ModelID)
+}
+
+func (e *AlreadyExistsError) Is(target error) bool {
+	return target == ErrAlreadyExists
+}
+
+// DataHashMismatchError is raised when the data written to a version doesn't match its expected hash
+type DataHashMismatchError struct {
+	ModelID          string
+	ExpectedDataHash string
+	DataHash         string
+}
+
+func (e *DataHashMismatchError) Error() string {
+	return fmt.Sprintf("data for model %q did not match the expected hash, expected %q, received %q", e.ModelID, e.ExpectedDataHash, e.DataHash)
+}
+
+// Is matches ErrInvalidData, the written data is rejected, the stored data isn't corrupted
+func (e *DataHashMismatchError) Is(target error) bool {
+	return target == ErrInvalidData
+}
+
+// CorruptedDataError is raised when the stored data of a version doesn't match its hash or can't be decoded
+type CorruptedDataError struct {
+	ModelID       string
+	VersionNumber uint
+	DataHash      string
+	Err           error // If defined, the error met while decoding the data
+}
+
+func (e *CorruptedDataError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf(`data of version "%d" for model %q is corrupted: %s`, e.VersionNumber, e.ModelID, e.Err)
+	}
+	return fmt.Sprintf(`data of version "%d" for model %q doesn't match its hash %q`, e.VersionNumber, e.ModelID, e.DataHash)
+}
+
+func (e *CorruptedDataError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CorruptedDataError) Is(target error) bool {
+	return target == ErrCorrupted
+}
+
+// QuotaExceededError is raised when an operation would make the storage exceed one of its limits
+type QuotaExceededError struct {
+	Resource string // e.g. "models", "versions" or "bytes"
+	Limit    int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded, it is limited to %d %s", e.Limit, e.Resource)
+}
+
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// ConflictError is raised when a model or a version was changed concurrently to an operation expecting it unchanged
+type ConflictError struct {
+	ModelID       string
+	VersionNumber uint // 0 when the conflict is on the model itself
+	Reason        string
+}
+
+func (e *ConflictError) Error() string {
+	if e.VersionNumber == 0 {
+		return fmt.Sprintf("conflicting change of model %q, %s", e.ModelID, e.Reason)
+	}
+	return fmt.Sprintf(`conflicting change of version "%d" of model %q, %s`, e.VersionNumber, e.ModelID, e.Reason)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// InvalidDataRangeError is raised when trying to retrieve a range starting after the end of a model version data
+type InvalidDataRangeError struct {
+	ModelID       string
+	VersionNumber int
+	Offset        uint64
+	DataSize      uint64
+}
+
+func (e *InvalidDataRangeError) Error() string {
+	return fmt.Sprintf(`offset %d is out of the data of model %q version "%d" of size %d`, e.Offset, e.ModelID, e.VersionNumber, e.DataSize)
+}
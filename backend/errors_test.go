@@ -0,0 +1,47 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorKinds(t *testing.T) {
+	err := fmt.Errorf("unable to delete version: %w", &UnknownModelVersionError{ModelID: "foo", VersionNumber: 2})
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NotErrorIs(t, err, ErrConflict)
+	unknownModelVersionErr := &UnknownModelVersionError{}
+	assert.ErrorAs(t, err, &unknownModelVersionErr)
+	assert.Equal(t, 2, unknownModelVersionErr.VersionNumber)
+	assert.False(t, errors.As(err, new(*UnknownModelError)))
+
+	assert.ErrorIs(t, fmt.Errorf("unable to retrieve model: %w", &UnknownModelError{ModelID: "foo"}), ErrNotFound)
+	assert.ErrorIs(t, &AlreadyExistsError{ModelID: "foo", VersionNumber: 1}, ErrAlreadyExists)
+	assert.ErrorIs(t, &DataHashMismatchError{ModelID: "foo"}, ErrInvalidData)
+	assert.NotErrorIs(t, &DataHashMismatchError{ModelID: "foo"}, ErrCorrupted)
+	assert.ErrorIs(t, &QuotaExceededError{Resource: "bytes", Limit: 10}, ErrQuotaExceeded)
+	assert.ErrorIs(t, &ConflictError{ModelID: "foo", Reason: "it was deleted"}, ErrConflict)
+
+	decodingErr := errors.New("unexpected EOF")
+	corruptedErr := fmt.Errorf("unable to retrieve data: %w", &CorruptedDataError{ModelID: "foo", VersionNumber: 3, Err: decodingErr})
+	assert.ErrorIs(t, corruptedErr, ErrCorrupted)
+	assert.ErrorIs(t, corruptedErr, decodingErr)
+	assert.EqualError(t, corruptedErr, `unable to retrieve data: data of version "3" for model "foo" is corrupted: unexpected EOF`)
+	assert.EqualError(t, &CorruptedDataError{ModelID: "foo", VersionNumber: 3, DataHash: "abc"}, `data of version "3" for model "foo" doesn't match its hash "abc"`)
+}
@@ -0,0 +1,407 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+type fakeVersion struct {
+	versionInfo backend.VersionInfo
+	data        []byte
+}
+
+type fakeModel struct {
+	modelInfo backend.ModelInfo
+	versions  map[uint]fakeVersion
+}
+
+// versionNumbers lists the version numbers of the model in ascending order
+func (m *fakeModel) versionNumbers() []uint {
+	versionNumbers := make([]uint, 0, len(m.versions))
+	for versionNumber := range m.versions {
+		versionNumbers = append(versionNumbers, versionNumber)
+	}
+	sort.Slice(versionNumbers, func(i, j int) bool { return versionNumbers[i] < versionNumbers[j] })
+	return versionNumbers
+}
+
+// Backend is an in-memory backend for the unit tests of the services depending on the registry
+//
+// It behaves like the other backends, see backend/test.RunSuite, and can be made to fail any of its operations.
+type Backend struct {
+	mutex  sync.RWMutex
+	models map[string]*fakeModel
+	errors map[string]error
+	calls  map[string]int
+}
+
+// CreateBackend creates an empty fake backend
+func CreateBackend() *Backend {
+	return &Backend{
+		models: make(map[string]*fakeModel),
+		errors: make(map[string]error),
+		calls:  make(map[string]int),
+	}
+}
+
+// SetError makes every following call of an operation, named after its method e.g. "RetrieveModelVersionData", fail
+// with the given error, nil makes it succeed again
+func (b *Backend) SetError(operation string, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil {
+		delete(b.errors, operation)
+		return
+	}
+	b.errors[operation] = err
+}
+
+// Calls returns the number of calls of an operation, named after its method, including the failed ones
+func (b *Backend) Calls(operation string) int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.calls[operation]
+}
+
+// call records a call of an operation and returns its injected error, the lock needs to be held
+func (b *Backend) call(operation string) error {
+	b.calls[operation]++
+	return b.errors[operation]
+}
+
+func copyUserData(userData map[string]string) map[string]string {
+	if userData == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(userData))
+	for key, value := range userData {
+		copied[key] = value
+	}
+	return copied
+}
+
+func copyVersionInfo(versionInfo backend.VersionInfo) backend.VersionInfo {
+	versionInfo.UserData = copyUserData(versionInfo.UserData)
+	return versionInfo
+}
+
+// resolveVersion retrieves a version of a model, negative version numbers denote the nth to last version, the lock
+// needs to be held
+func (b *Backend) resolveVersion(modelID string, versionNumber int) (fakeVersion, error) {
+	model, ok := b.models[modelID]
+	if !ok {
+		if versionNumber > 0 {
+			return fakeVersion{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return fakeVersion{}, &backend.UnknownModelError{ModelID: modelID}
+	}
+	if versionNumber > 0 {
+		version, ok := model.versions[uint(versionNumber)]
+		if !ok {
+			return fakeVersion{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return version, nil
+	}
+	versionNumbers := model.versionNumbers()
+	index := len(versionNumbers) + versionNumber
+	if versionNumber == 0 || index < 0 {
+		return fakeVersion{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	return model.versions[versionNumbers[index]], nil
+}
+
+func (b *Backend) Destroy() {
+}
+
+func (b *Backend) Ping() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.call("Ping")
+}
+
+func (b *Backend) CreateOrUpdateModel(modelInfo backend.ModelInfo) (backend.ModelInfo, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("CreateOrUpdateModel"); err != nil {
+		return backend.ModelInfo{}, err
+	}
+	modelInfo.UserData = copyUserData(modelInfo.UserData)
+	if model, ok := b.models[modelInfo.ModelID]; ok {
+		model.modelInfo = modelInfo
+	} else {
+		b.models[modelInfo.ModelID] = &fakeModel{modelInfo: modelInfo, versions: make(map[uint]fakeVersion)}
+	}
+	return backend.ModelInfo{ModelID: modelInfo.ModelID, UserData: copyUserData(modelInfo.UserData)}, nil
+}
+
+func (b *Backend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("RetrieveModelInfo"); err != nil {
+		return backend.ModelInfo{}, err
+	}
+	model, ok := b.models[modelID]
+	if !ok {
+		return backend.ModelInfo{}, &backend.UnknownModelError{ModelID: modelID}
+	}
+	return backend.ModelInfo{ModelID: modelID, UserData: copyUserData(model.modelInfo.UserData)}, nil
+}
+
+func (b *Backend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("RetrieveModelLatestVersionNumber"); err != nil {
+		return 0, err
+	}
+	model, ok := b.models[modelID]
+	if !ok {
+		return 0, &backend.UnknownModelError{ModelID: modelID}
+	}
+	versionNumbers := model.versionNumbers()
+	if len(versionNumbers) == 0 {
+		return 0, nil
+	}
+	return versionNumbers[len(versionNumbers)-1], nil
+}
+
+// HasModel checks if a model exists
+func (b *Backend) HasModel(modelID string) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("HasModel"); err != nil {
+		return false, err
+	}
+	_, ok := b.models[modelID]
+	return ok, nil
+}
+
+// DeleteModel deletes a model and all its versions
+func (b *Backend) DeleteModel(modelID string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("DeleteModel"); err != nil {
+		return err
+	}
+	if _, ok := b.models[modelID]; !ok {
+		return &backend.UnknownModelError{ModelID: modelID}
+	}
+	delete(b.models, modelID)
+	return nil
+}
+
+// ListModels list models ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *Backend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("ListModels"); err != nil {
+		return []backend.ModelInfo{}, err
+	}
+	modelIDs := make([]string, 0, len(b.models))
+	for modelID := range b.models {
+		modelIDs = append(modelIDs, modelID)
+	}
+	sort.Strings(modelIDs)
+	if offset < 0 {
+		offset = 0
+	}
+	models := []backend.ModelInfo{}
+	for index := offset; index < len(modelIDs) && (limit <= 0 || len(models) < limit); index++ {
+		model := b.models[modelIDs[index]]
+		models = append(models, backend.ModelInfo{ModelID: model.modelInfo.ModelID, UserData: copyUserData(model.modelInfo.UserData)})
+	}
+	return models, nil
+}
+
+// QueryModels list models selected by the filter ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *Backend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return backend.QueryModelsByListing(b, filter, offset, limit)
+}
+
+func (b *Backend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("CreateOrUpdateModelVersion"); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	model, ok := b.models[modelID]
+	if !ok {
+		return backend.VersionInfo{}, &backend.UnknownModelError{ModelID: modelID}
+	}
+	versionInfo := backend.VersionInfo{
+		ModelID:           modelID,
+		VersionNumber:     versionArgs.VersionNumber,
+		CreationTimestamp: versionArgs.CreationTimestamp,
+		Archived:          versionArgs.Archived,
+		DataHash:          versionArgs.DataHash,
+		DataSize:          len(versionArgs.Data),
+		UserData:          copyUserData(versionArgs.UserData),
+	}
+	if versionInfo.VersionNumber == 0 {
+		// Create a new version after the last one
+		versionInfo.VersionNumber = 1
+		if versionNumbers := model.versionNumbers(); len(versionNumbers) > 0 {
+			versionInfo.VersionNumber = versionNumbers[len(versionNumbers)-1] + 1
+		}
+	} else if existingVersion, ok := model.versions[versionInfo.VersionNumber]; ok {
+		// Update an existing version
+		versionInfo.CreationTimestamp = existingVersion.versionInfo.CreationTimestamp
+	}
+	model.versions[versionInfo.VersionNumber] = fakeVersion{
+		versionInfo: versionInfo,
+		data:        append([]byte{}, versionArgs.Data...),
+	}
+	return copyVersionInfo(versionInfo), nil
+}
+
+// CreateOrUpdateModelVersionStream creates a writer accumulating the data in memory, the version is created on commit
+func (b *Backend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("CreateOrUpdateModelVersionStream"); err != nil {
+		return nil, err
+	}
+	if _, ok := b.models[modelID]; !ok {
+		return nil, &backend.UnknownModelError{ModelID: modelID}
+	}
+	return backend.CreateBufferedVersionDataWriter(b, modelID, versionArgs), nil
+}
+
+func (b *Backend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("RetrieveModelVersionInfo"); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	version, err := b.resolveVersion(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return copyVersionInfo(version.versionInfo), nil
+}
+
+func (b *Backend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("RetrieveModelVersionData"); err != nil {
+		return nil, err
+	}
+	version, err := b.resolveVersion(modelID, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, version.data...), nil
+}
+
+// RetrieveModelVersionDataRange retrieves length bytes of a model version data starting at offset, up to the end when length is 0
+func (b *Backend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("RetrieveModelVersionDataRange"); err != nil {
+		return nil, err
+	}
+	version, err := b.resolveVersion(modelID, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+	data, err := backend.SliceDataRange(modelID, versionNumber, version.data, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, data...), nil
+}
+
+// UpdateModelVersionArchived changes whether a model version is archived
+func (b *Backend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	return b.updateVersionInfo("UpdateModelVersionArchived", modelID, versionNumber, func(versionInfo *backend.VersionInfo) {
+		versionInfo.Archived = archived
+	})
+}
+
+// UpdateModelVersionUserData replaces the user data of a model version
+func (b *Backend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	return b.updateVersionInfo("UpdateModelVersionUserData", modelID, versionNumber, func(versionInfo *backend.VersionInfo) {
+		versionInfo.UserData = copyUserData(userData)
+	})
+}
+
+func (b *Backend) updateVersionInfo(operation string, modelID string, versionNumber int, update func(versionInfo *backend.VersionInfo)) (backend.VersionInfo, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call(operation); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	version, err := b.resolveVersion(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	update(&version.versionInfo)
+	b.models[modelID].versions[version.versionInfo.VersionNumber] = version
+	return copyVersionInfo(version.versionInfo), nil
+}
+
+func (b *Backend) DeleteModelVersion(modelID string, versionNumber int) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("DeleteModelVersion"); err != nil {
+		return err
+	}
+	version, err := b.resolveVersion(modelID, versionNumber)
+	if err != nil {
+		return err
+	}
+	delete(b.models[modelID].versions, version.versionInfo.VersionNumber)
+	return nil
+}
+
+func (b *Backend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("ListModelVersionInfos"); err != nil {
+		return []backend.VersionInfo{}, err
+	}
+	model, ok := b.models[modelID]
+	if !ok {
+		return []backend.VersionInfo{}, &backend.UnknownModelError{ModelID: modelID}
+	}
+	versions := []backend.VersionInfo{}
+	for _, versionNumber := range model.versionNumbers() {
+		if versionNumber < initialVersionNumber {
+			continue
+		}
+		versions = append(versions, copyVersionInfo(model.versions[versionNumber].versionInfo))
+		if limit > 0 && len(versions) >= limit {
+			break
+		}
+	}
+	return versions, nil
+}
+
+func (b *Backend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return backend.QueryModelVersionInfosByListing(b, modelID, filter, initialVersionNumber, limit)
+}
+
+// RetrieveStorageCapacity reports an unknown capacity, nothing limits the memory used by the fake backend
+func (b *Backend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.call("RetrieveStorageCapacity"); err != nil {
+		return backend.StorageCapacity{}, err
+	}
+	return backend.StorageCapacity{}, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/test"
+)
+
+func TestSuiteFakeBackend(t *testing.T) {
+	test.RunSuite(t, func() backend.Backend {
+		return CreateBackend()
+	}, func(b backend.Backend) {
+		b.Destroy()
+	})
+}
+
+func TestSetError(t *testing.T) {
+	b := CreateBackend()
+	_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{CreationTimestamp: time.Now(), Data: test.Data1, DataHash: backend.ComputeSHA256Hash(test.Data1)})
+	assert.NoError(t, err)
+
+	unavailable := &backend.TransientError{Err: errors.New("unavailable")}
+	b.SetError("RetrieveModelVersionData", unavailable)
+	_, err = b.RetrieveModelVersionData("foo", 1)
+	assert.Equal(t, unavailable, err)
+	// The other operations aren't affected
+	_, err = b.RetrieveModelVersionInfo("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, b.Calls("RetrieveModelVersionData"))
+
+	b.SetError("RetrieveModelVersionData", nil)
+	data, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data1, data)
+	assert.Equal(t, 2, b.Calls("RetrieveModelVersionData"))
+	assert.Equal(t, 0, b.Calls("DeleteModel"))
+}
+
+func TestCopies(t *testing.T) {
+	b := CreateBackend()
+	userData := map[string]string{"team": "a"}
+	_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo", UserData: userData})
+	assert.NoError(t, err)
+	data := []byte("data")
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{CreationTimestamp: time.Now(), Data: data, DataHash: backend.ComputeSHA256Hash(data)})
+	assert.NoError(t, err)
+
+	// Changing the arguments or the results doesn't change the stored models and versions
+	userData["team"] = "b"
+	data[0] = 'D'
+	modelInfo, err := b.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "a"}, modelInfo.UserData)
+	retrievedData, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), retrievedData)
+	retrievedData[0] = 'D'
+	retrievedData, err = b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), retrievedData)
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package backend
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// RetrieveFilesystemCapacity retrieves the capacity of the filesystem holding the given path
+func RetrieveFilesystemCapacity(path string) (StorageCapacity, error) {
+	stat := syscall.Statfs_t{}
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return StorageCapacity{}, fmt.Errorf("unable to retrieve the capacity of the filesystem holding %q: %w", path, err)
+	}
+	return StorageCapacity{
+		TotalBytes:     stat.Blocks * uint64(stat.Bsize),
+		AvailableBytes: stat.Bavail * uint64(stat.Bsize),
+	}, nil
+}
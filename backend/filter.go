@@ -0,0 +1,180 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GlobRegexp converts a glob, where `*` matches any sequence and `?` any single character, to an anchored regular expression
+func GlobRegexp(glob string) string {
+	var builder strings.Builder
+	builder.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			builder.WriteString(".*")
+		case '?':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	builder.WriteString("$")
+	return builder.String()
+}
+
+// Matches checks if a model is selected by the filter
+func (f ModelFilter) Matches(modelInfo ModelInfo) bool {
+	return f.Matcher()(modelInfo)
+}
+
+// Matcher compiles the filter once to check several models
+func (f ModelFilter) Matcher() func(modelInfo ModelInfo) bool {
+	var modelIDRegexp *regexp.Regexp
+	if f.ModelIDGlob != "" {
+		modelIDRegexp = regexp.MustCompile(GlobRegexp(f.ModelIDGlob))
+	}
+	return func(modelInfo ModelInfo) bool {
+		return (modelIDRegexp == nil || modelIDRegexp.MatchString(modelInfo.ModelID)) && f.matchesUserData(modelInfo)
+	}
+}
+
+func (f ModelFilter) matchesUserData(modelInfo ModelInfo) bool {
+	for key, expectedValue := range f.UserDataEquals {
+		if value, ok := modelInfo.UserData[key]; !ok || value != expectedValue {
+			return false
+		}
+	}
+	for key, prefix := range f.UserDataPrefixes {
+		if value, ok := modelInfo.UserData[key]; !ok || !strings.HasPrefix(value, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// Number of models listed at once by QueryModelsByListing
+const queryModelsBatchSize = 100
+
+// QueryModelsByListing implements `QueryModels` for backends without native filtering by listing every model
+func QueryModelsByListing(b Backend, filter ModelFilter, offset int, limit int) ([]ModelInfo, error) {
+	matches := filter.Matcher()
+	modelInfos := []ModelInfo{}
+	matchingModelIdx := 0
+	for listOffset := 0; ; listOffset += queryModelsBatchSize {
+		listedModelInfos, err := b.ListModels(listOffset, queryModelsBatchSize)
+		if err != nil {
+			return []ModelInfo{}, err
+		}
+		for _, modelInfo := range listedModelInfos {
+			if !matches(modelInfo) {
+				continue
+			}
+			if matchingModelIdx >= offset {
+				modelInfos = append(modelInfos, modelInfo)
+				if limit > 0 && len(modelInfos) >= limit {
+					return modelInfos, nil
+				}
+			}
+			matchingModelIdx++
+		}
+		if len(listedModelInfos) < queryModelsBatchSize {
+			return modelInfos, nil
+		}
+	}
+}
+
+// NumberPattern is the regular expression matching the user data values considered as numbers by a UserDataComparison
+const NumberPattern = `^\s*[-+]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][-+]?[0-9]+)?\s*$`
+
+var numberRegexp = regexp.MustCompile(NumberPattern)
+
+// Matches checks if a user data value satisfies the comparison
+func (c UserDataComparison) Matches(userData map[string]string) bool {
+	value, ok := userData[c.Key]
+	if !ok || !numberRegexp.MatchString(value) {
+		return false
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return false
+	}
+	switch c.Operator {
+	case LessThan:
+		return number < c.Value
+	case LessOrEqual:
+		return number <= c.Value
+	case GreaterThan:
+		return number > c.Value
+	case GreaterOrEqual:
+		return number >= c.Value
+	default:
+		return false
+	}
+}
+
+// Matches checks if a version is selected by the filter
+func (f VersionFilter) Matches(versionInfo VersionInfo) bool {
+	if !f.CreatedAfter.IsZero() && versionInfo.CreationTimestamp.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !versionInfo.CreationTimestamp.Before(f.CreatedBefore) {
+		return false
+	}
+	if (f.Archived == ArchivedOnly && !versionInfo.Archived) || (f.Archived == NonArchivedOnly && versionInfo.Archived) {
+		return false
+	}
+	for key, expectedValue := range f.UserDataEquals {
+		if value, ok := versionInfo.UserData[key]; !ok || value != expectedValue {
+			return false
+		}
+	}
+	for _, comparison := range f.UserDataComparisons {
+		if !comparison.Matches(versionInfo.UserData) {
+			return false
+		}
+	}
+	return true
+}
+
+// Number of versions listed at once by QueryModelVersionInfosByListing
+const queryVersionsBatchSize = 100
+
+// QueryModelVersionInfosByListing implements `QueryModelVersionInfos` for backends without native filtering by listing every version
+func QueryModelVersionInfosByListing(b Backend, modelID string, filter VersionFilter, initialVersionNumber uint, limit int) ([]VersionInfo, error) {
+	versionInfos := []VersionInfo{}
+	for {
+		listedVersionInfos, err := b.ListModelVersionInfos(modelID, initialVersionNumber, queryVersionsBatchSize)
+		if err != nil {
+			return []VersionInfo{}, err
+		}
+		for _, versionInfo := range listedVersionInfos {
+			if !filter.Matches(versionInfo) {
+				continue
+			}
+			versionInfos = append(versionInfos, versionInfo)
+			if limit > 0 && len(versionInfos) >= limit {
+				return versionInfos, nil
+			}
+		}
+		if len(listedVersionInfos) < queryVersionsBatchSize {
+			return versionInfos, nil
+		}
+		initialVersionNumber = listedVersionInfos[len(listedVersionInfos)-1].VersionNumber + 1
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Prefix of the temporary files, they don't match any model, version or data filename
+const temporaryFilenamePrefix = ".upload-"
+
+// Age after which a temporary file is considered left by an interrupted write, ongoing writes keep updating theirs
+var staleTemporaryFileAge = 24 * time.Hour
+
+// createTemporaryFile creates a temporary file in the same directory as the given final filename
+func createTemporaryFile(dirname string) (*os.File, error) {
+	file, err := os.CreateTemp(dirname, temporaryFilenamePrefix+"*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	err = file.Chmod(0640)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// syncAndClose flushes the content of a file to the disk before closing it
+func syncAndClose(file *os.File) error {
+	err := file.Sync()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// syncDir flushes a directory entries to the disk, making renames and file creations durable
+func syncDir(dirname string) error {
+	dir, err := os.Open(dirname)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// renameDurably atomically replaces the destination file with the source file and makes sure it persists
+func renameDurably(srcFilename string, dstFilename string) error {
+	err := os.Rename(srcFilename, dstFilename)
+	if err != nil {
+		return err
+	}
+	return syncDir(path.Dir(dstFilename))
+}
+
+// writeFileAtomically writes the content of the reader to a temporary file then moves it in place
+//
+// A crash during the write never leaves a partially written file at the given filename.
+func writeFileAtomically(filename string, reader io.Reader) error {
+	file, err := createTemporaryFile(path.Dir(filename))
+	if err != nil {
+		return err
+	}
+	tmpFilename := file.Name()
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		file.Close()
+		os.Remove(tmpFilename)
+		return err
+	}
+	err = syncAndClose(file)
+	if err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	err = renameDurably(tmpFilename, filename)
+	if err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	return nil
+}
+
+// removeTemporaryFiles removes the temporary files left in the models directories by interrupted writes
+//
+// Only the temporary files not modified for staleTemporaryFileAge are removed, the ongoing writes of other instances sharing the directory are kept.
+func removeTemporaryFiles(rootDirname string) {
+	staleTime := time.Now().Add(-staleTemporaryFileAge)
+	modelEntries, err := os.ReadDir(rootDirname)
+	if err != nil {
+		logrus.WithField("dirname", rootDirname).WithError(err).Warn("unable to remove temporary files")
+		return
+	}
+	for _, modelEntry := range modelEntries {
+		if !modelEntry.IsDir() {
+			continue
+		}
+		modelDirname := path.Join(rootDirname, modelEntry.Name())
+		entries, err := os.ReadDir(modelDirname)
+		if err != nil {
+			logrus.WithField("dirname", modelDirname).WithError(err).Warn("unable to remove temporary files")
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasPrefix(entry.Name(), temporaryFilenamePrefix) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || info.ModTime().After(staleTime) {
+				continue
+			}
+			err = os.Remove(path.Join(modelDirname, entry.Name()))
+			if err != nil {
+				logrus.WithField("filename", entry.Name()).WithError(err).Warn("unable to remove a temporary file")
+			}
+		}
+	}
+}
@@ -16,9 +16,10 @@ package fs
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
-	"log"
 	"os"
 	"path"
 	"regexp"
@@ -27,7 +28,9 @@ import (
 	"time"
 
 	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/modelIDs"
 	"github.com/rogpeppe/go-internal/lockedfile"
+	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
@@ -49,12 +52,15 @@ func saveModelInfoFile(modelInfoFilename string, modelInfo backend.ModelInfo) er
 	_, err = os.Stat(modelDirname)
 	if os.IsNotExist(err) {
 		err = os.Mkdir(modelDirname, 0750)
+		if err == nil {
+			err = syncDir(path.Dir(modelDirname))
+		}
 		if err != nil {
 			return fmt.Errorf("unable to save model %q to %q: directory creation failed %w", modelInfo.ModelID, modelInfoFilename, err)
 		}
 	}
 
-	err = lockedfile.Write(modelInfoFilename, bytes.NewReader(modelInfoData), 0640)
+	err = writeFileAtomically(modelInfoFilename, bytes.NewReader(modelInfoData))
 
 	if err != nil {
 		return fmt.Errorf("unable to save model %q to %q: writing to file failed %w", modelInfo.ModelID, modelInfoFilename, err)
@@ -108,12 +114,15 @@ func saveVersionInfoFile(versionInfoFilename string, versionInfo backend.Version
 	_, err = os.Stat(modelDirname)
 	if os.IsNotExist(err) {
 		err = os.Mkdir(modelDirname, 0750)
+		if err == nil {
+			err = syncDir(path.Dir(modelDirname))
+		}
 		if err != nil {
 			return fmt.Errorf("unable to save version info for model \"%s@%d\" to %q: directory creation failed %w", versionInfo.ModelID, versionInfo.VersionNumber, versionInfoFilename, err)
 		}
 	}
 
-	err = lockedfile.Write(versionInfoFilename, bytes.NewReader(versionInfoData), 0640)
+	err = writeFileAtomically(versionInfoFilename, bytes.NewReader(versionInfoData))
 
 	if err != nil {
 		return fmt.Errorf("unable to save version info for model \"%s@%d\" to %q: writing to file failed %w", versionInfo.ModelID, versionInfo.VersionNumber, versionInfoFilename, err)
@@ -154,8 +163,19 @@ var versionInfoFilenameTemplate = template.Must(template.New("versionInfoFilenam
 var modelInfoFilenameTemplate = template.Must(template.New("modelInfoFilenameTemplate").Parse(`{{ .ModelID }}.yaml`))
 var versionInfoFilenameRegexp = regexp.MustCompile("([a-zA-Z][a-zA-Z0-9-_]*)-v([0-9]+).yaml")
 
+// Lock file created in the directory of each model
+const versionNumberingLockFilename = ".version-numbering.lock"
+
 var modelDirnameRegexp = regexp.MustCompile("([a-zA-Z][a-zA-Z0-9-_]*)")
 
+// checkModelPath rejects the model ids that can't be mapped to a path under the root directory, as unknown models
+func checkModelPath(modelID string) error {
+	if modelIDs.CheckPathSafety(modelID) != nil {
+		return &backend.UnknownModelError{ModelID: modelID}
+	}
+	return nil
+}
+
 // CreateBackend creates a new backend using the local filesystem
 func CreateBackend(rootDirname string) (backend.Backend, error) {
 	rootDirentry, err := os.Stat(rootDirname)
@@ -165,6 +185,7 @@ func CreateBackend(rootDirname string) (backend.Backend, error) {
 	if !rootDirentry.IsDir() {
 		return nil, fmt.Errorf("unable to create filesystem backend: %q is not a directory", rootDirname)
 	}
+	removeTemporaryFiles(rootDirname)
 	backend := fsBackend{
 		rootDirname: rootDirname,
 	}
@@ -176,7 +197,20 @@ func (b *fsBackend) Destroy() {
 	// Nothing
 }
 
+// BindContext returns the backend itself, its operations on the local filesystem aren't interrupted
+func (b *fsBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	return b, true
+}
+
+func (b *fsBackend) Ping() error {
+	_, err := os.Stat(b.rootDirname)
+	return err
+}
+
 func (b *fsBackend) retrieveModelNthToLastVersionInfo(modelID string, nthToLastIndex uint) (backend.VersionInfo, error) {
+	if err := checkModelPath(modelID); err != nil {
+		return backend.VersionInfo{}, err
+	}
 	modelDirname := path.Join(b.rootDirname, modelID)
 	modelDirContent, err := os.ReadDir(modelDirname)
 	if err != nil {
@@ -204,6 +238,9 @@ func (b *fsBackend) retrieveModelNthToLastVersionInfo(modelID string, nthToLastI
 }
 
 func (b *fsBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	if err := modelIDs.CheckPathSafety(modelArgs.ModelID); err != nil {
+		return backend.ModelInfo{}, fmt.Errorf("unable to create model %q: %w", modelArgs.ModelID, err)
+	}
 	modelInfo := backend.ModelInfo{
 		ModelID:  modelArgs.ModelID,
 		UserData: modelArgs.UserData,
@@ -218,6 +255,9 @@ func (b *fsBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.Mo
 }
 
 func (b *fsBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	if err := checkModelPath(modelID); err != nil {
+		return backend.ModelInfo{}, err
+	}
 	modelInfoFilename := b.buildModelInfoFilename(backend.ModelInfo{ModelID: modelID})
 
 	_, err := os.Stat(modelInfoFilename)
@@ -246,6 +286,9 @@ func (b *fsBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, erro
 
 // HasModel checks if a model exists
 func (b *fsBackend) HasModel(modelID string) (bool, error) {
+	if checkModelPath(modelID) != nil {
+		return false, nil
+	}
 	modelDirname := path.Join(b.rootDirname, modelID)
 	_, err := os.Stat(modelDirname)
 	if os.IsNotExist(err) {
@@ -319,12 +362,11 @@ func (b *fsBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, erro
 		modelID := entry.Name()
 		modelInfoFilename := b.buildModelInfoFilename(backend.ModelInfo{ModelID: modelID})
 
-		_, err := os.Stat(modelInfoFilename)
-		if err != nil {
-			return []backend.ModelInfo{}, fmt.Errorf("unable to read model info from %q: %w", modelInfoFilename, err)
-		}
-
 		modelInfo, err := loadModelInfoFile(modelInfoFilename)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Created or deleted during the listing
+			continue
+		}
 		if err != nil {
 			return []backend.ModelInfo{}, err
 		}
@@ -335,6 +377,11 @@ func (b *fsBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, erro
 	return models, nil
 }
 
+// QueryModels list models selected by the filter ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *fsBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return backend.QueryModelsByListing(b, filter, offset, limit)
+}
+
 func (b *fsBackend) buildVersionInfoFilename(versionInfo backend.VersionInfo) string {
 	versionInfoFilenameBuffer := new(bytes.Buffer)
 	err := versionInfoFilenameTemplate.Execute(versionInfoFilenameBuffer, versionInfo)
@@ -362,71 +409,225 @@ func (b *fsBackend) buildVersionDataFilename(versionInfo backend.VersionInfo) st
 	return path.Join(b.rootDirname, versionInfo.ModelID, versionDataFilenameBuffer.String())
 }
 
-// CreateModelVersion creates and store a new version for a model and returns its info, including the version number
-func (b *fsBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
-	var versionInfo backend.VersionInfo
+func (b *fsBackend) resolveVersionInfo(modelID string, versionArgs backend.VersionArgs, dataSize int) (backend.VersionInfo, error) {
 	if versionArgs.VersionNumber == 0 {
 		// Create a new version after the last one
 		latestVersionInfo, err := b.retrieveModelNthToLastVersionInfo(modelID, 0)
 		if err != nil {
 			return backend.VersionInfo{}, err
 		}
-		versionInfo = backend.VersionInfo{
+		return backend.VersionInfo{
 			ModelID:           modelID,
 			VersionNumber:     latestVersionInfo.VersionNumber + 1,
 			CreationTimestamp: versionArgs.CreationTimestamp,
 			Archived:          versionArgs.Archived,
 			DataHash:          versionArgs.DataHash,
-			DataSize:          len(versionArgs.Data),
+			DataSize:          dataSize,
 			UserData:          versionArgs.UserData,
+		}, nil
+	}
+	// Maybe there is an existing version
+	existingVersionInfo, err := b.RetrieveModelVersionInfo(modelID, int(versionArgs.VersionNumber))
+	if err != nil {
+		if !errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return backend.VersionInfo{}, err
 		}
-	} else {
-		// Maybe there is an existing version
-		existingVersionInfo, err := b.RetrieveModelVersionInfo(modelID, int(versionArgs.VersionNumber))
-		if err != nil {
-			if _, ok := err.(*backend.UnknownModelVersionError); !ok {
-				return backend.VersionInfo{}, err
-			}
-			// No version, create a new one
-			versionInfo = backend.VersionInfo{
-				ModelID:           modelID,
-				VersionNumber:     versionArgs.VersionNumber,
-				CreationTimestamp: versionArgs.CreationTimestamp,
-				Archived:          versionArgs.Archived,
-				DataHash:          versionArgs.DataHash,
-				DataSize:          len(versionArgs.Data),
-				UserData:          versionArgs.UserData,
-			}
-		} else {
-			// Update an existing version
-			versionInfo = existingVersionInfo
-			versionInfo.Archived = versionArgs.Archived
-			versionInfo.DataHash = versionArgs.DataHash
-			versionInfo.DataSize = len(versionArgs.Data)
-			versionInfo.UserData = versionArgs.UserData
+		// No version, create a new one
+		return backend.VersionInfo{
+			ModelID:           modelID,
+			VersionNumber:     versionArgs.VersionNumber,
+			CreationTimestamp: versionArgs.CreationTimestamp,
+			Archived:          versionArgs.Archived,
+			DataHash:          versionArgs.DataHash,
+			DataSize:          dataSize,
+			UserData:          versionArgs.UserData,
+		}, nil
+	}
+	// Update an existing version
+	versionInfo := existingVersionInfo
+	// The stored info might be inconsistent with its filename, the version is rewritten under the requested number
+	versionInfo.VersionNumber = versionArgs.VersionNumber
+	versionInfo.Archived = versionArgs.Archived
+	versionInfo.DataHash = versionArgs.DataHash
+	versionInfo.DataSize = dataSize
+	versionInfo.UserData = versionArgs.UserData
+	return versionInfo, nil
+}
+
+// lockVersionNumbering serializes, within and across processes, the creations of versions of a model from the resolution of their number to the write of their info
+func (b *fsBackend) lockVersionNumbering(modelID string) (func(), error) {
+	if err := checkModelPath(modelID); err != nil {
+		return nil, err
+	}
+	unlock, err := lockedfile.MutexAt(path.Join(b.rootDirname, modelID, versionNumberingLockFilename)).Lock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &backend.UnknownModelError{ModelID: modelID}
 		}
+		return nil, fmt.Errorf("unable to lock the version numbering of model %q: %w", modelID, err)
 	}
+	return unlock, nil
+}
 
-	versionInfoFilename := b.buildVersionInfoFilename(versionInfo)
+// CreateModelVersion creates and store a new version for a model and returns its info, including the version number
+func (b *fsBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	unlock, err := b.lockVersionNumbering(modelID)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	defer unlock()
 
-	err := saveVersionInfoFile(versionInfoFilename, versionInfo)
+	versionInfo, err := b.resolveVersionInfo(modelID, versionArgs, len(versionArgs.Data))
 	if err != nil {
 		return backend.VersionInfo{}, err
 	}
 
+	// The data is written before the info for the version to only be visible once complete
 	versionDataFilename := b.buildVersionDataFilename(versionInfo)
 
-	err = lockedfile.Write(versionDataFilename, bytes.NewReader(versionArgs.Data), 0640)
+	err = writeFileAtomically(versionDataFilename, bytes.NewReader(versionArgs.Data))
 	if err != nil {
-		os.Remove(versionInfoFilename)
 		return backend.VersionInfo{}, fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
 	}
 
+	versionInfoFilename := b.buildVersionInfoFilename(versionInfo)
+
+	err = saveVersionInfoFile(versionInfoFilename, versionInfo)
+	if err != nil {
+		os.Remove(versionDataFilename)
+		return backend.VersionInfo{}, err
+	}
+
 	return versionInfo, nil
 }
 
+type fsVersionDataWriter struct {
+	backend     *fsBackend
+	modelID     string
+	versionArgs backend.VersionArgs
+	file        *os.File
+	hasher      backend.Hasher
+	dataSize    int
+}
+
+func (w *fsVersionDataWriter) Write(data []byte) (int, error) {
+	if w.file == nil {
+		return 0, fmt.Errorf("unable to write data for model %q: writer already closed", w.modelID)
+	}
+	n, err := w.file.Write(data)
+	w.dataSize += n
+	_, _ = w.hasher.Write(data[:n])
+	if err != nil {
+		return n, fmt.Errorf("unable to write data for model %q: %w", w.modelID, err)
+	}
+	return n, nil
+}
+
+func (w *fsVersionDataWriter) close() (string, error) {
+	if w.file == nil {
+		return "", fmt.Errorf("unable to close data writer for model %q: writer already closed", w.modelID)
+	}
+	tmpFilename := w.file.Name()
+	err := syncAndClose(w.file)
+	w.file = nil
+	if err != nil {
+		os.Remove(tmpFilename)
+		return "", fmt.Errorf("unable to close data writer for model %q: %w", w.modelID, err)
+	}
+	return tmpFilename, nil
+}
+
+func (w *fsVersionDataWriter) Commit() (backend.VersionInfo, error) {
+	tmpFilename, err := w.close()
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+
+	dataHash := w.hasher.Hash()
+	if w.versionArgs.DataHash != "" && w.versionArgs.DataHash != dataHash {
+		os.Remove(tmpFilename)
+		return backend.VersionInfo{}, &backend.DataHashMismatchError{ModelID: w.modelID, ExpectedDataHash: w.versionArgs.DataHash, DataHash: dataHash}
+	}
+	versionArgs := w.versionArgs
+	versionArgs.DataHash = dataHash
+
+	unlock, err := w.backend.lockVersionNumbering(w.modelID)
+	if err != nil {
+		os.Remove(tmpFilename)
+		return backend.VersionInfo{}, err
+	}
+	defer unlock()
+
+	versionInfo, err := w.backend.resolveVersionInfo(w.modelID, versionArgs, w.dataSize)
+	if err != nil {
+		os.Remove(tmpFilename)
+		return backend.VersionInfo{}, err
+	}
+
+	// The data is moved in place before the info is written for the version to only be visible once complete
+	versionDataFilename := w.backend.buildVersionDataFilename(versionInfo)
+	err = renameDurably(tmpFilename, versionDataFilename)
+	if err != nil {
+		os.Remove(tmpFilename)
+		return backend.VersionInfo{}, fmt.Errorf("unable to create a version for model %q: %w", w.modelID, err)
+	}
+
+	versionInfoFilename := w.backend.buildVersionInfoFilename(versionInfo)
+	err = saveVersionInfoFile(versionInfoFilename, versionInfo)
+	if err != nil {
+		os.Remove(versionDataFilename)
+		return backend.VersionInfo{}, err
+	}
+
+	return versionInfo, nil
+}
+
+func (w *fsVersionDataWriter) Abort() error {
+	tmpFilename, err := w.close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(tmpFilename)
+}
+
+// CreateOrUpdateModelVersionStream creates a writer storing the version data in a temporary file until it is committed
+func (b *fsBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	if err := checkModelPath(modelID); err != nil {
+		return nil, err
+	}
+	modelDirname := path.Join(b.rootDirname, modelID)
+	_, err := os.Stat(modelDirname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &backend.UnknownModelError{ModelID: modelID}
+		}
+		return nil, fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+	}
+
+	hasher, err := backend.CreateVersionHasher(versionArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := createTemporaryFile(modelDirname)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create a version for model %q: temporary file creation failed %w", modelID, err)
+	}
+
+	return &fsVersionDataWriter{
+		backend:     b,
+		modelID:     modelID,
+		versionArgs: versionArgs,
+		file:        file,
+		hasher:      hasher,
+	}, nil
+}
+
 // RetrieveModelVersionInfo retrieves a given model version info
 func (b *fsBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	if err := checkModelPath(modelID); err != nil {
+		return backend.VersionInfo{}, err
+	}
 	if versionNumber == 0 {
 		return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
 	}
@@ -457,27 +658,36 @@ func (b *fsBackend) RetrieveModelVersionInfo(modelID string, versionNumber int)
 	return versionInfo, err
 }
 
-// RetrieveModelVersion retrieves a given model version data
-func (b *fsBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
-	var versionInfo backend.VersionInfo
+// resolveDataVersionInfo resolves the model id and version number of a version whose data is retrieved
+func (b *fsBackend) resolveDataVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	if err := checkModelPath(modelID); err != nil {
+		return backend.VersionInfo{}, err
+	}
 	if versionNumber == 0 {
-		return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
 	}
-	if versionNumber < 0 {
-		// Retrieve the nth to last version
-		var err error
-		versionInfo, err = b.retrieveModelNthToLastVersionInfo(modelID, uint(-versionNumber-1))
-		if err != nil {
-			return []byte{}, err
-		}
-		if versionInfo.VersionNumber == 0 {
-			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
-		}
-	} else {
-		versionInfo = backend.VersionInfo{
+	if versionNumber > 0 {
+		return backend.VersionInfo{
 			ModelID:       modelID,
 			VersionNumber: uint(versionNumber),
-		}
+		}, nil
+	}
+	// Retrieve the nth to last version
+	versionInfo, err := b.retrieveModelNthToLastVersionInfo(modelID, uint(-versionNumber-1))
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	if versionInfo.VersionNumber == 0 {
+		return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	return versionInfo, nil
+}
+
+// RetrieveModelVersion retrieves a given model version data
+func (b *fsBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	versionInfo, err := b.resolveDataVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
 	}
 
 	// Retrieve a specific version
@@ -492,8 +702,89 @@ func (b *fsBackend) RetrieveModelVersionData(modelID string, versionNumber int)
 	return versionData, nil
 }
 
+// RetrieveModelVersionDataRange retrieves a range of a given model version data, only reading this range from the file
+func (b *fsBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	versionInfo, err := b.resolveDataVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	versionDataFilename := b.buildVersionDataFilename(versionInfo)
+	file, err := os.Open(versionDataFilename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return []byte{}, fmt.Errorf(`unable to read data for model %q version "%d": %w`, versionInfo.ModelID, versionInfo.VersionNumber, err)
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to read data for model %q version "%d": %w`, versionInfo.ModelID, versionInfo.VersionNumber, err)
+	}
+	end, err := backend.ResolveDataRange(modelID, versionNumber, uint64(fileInfo.Size()), offset, length)
+	if err != nil {
+		return []byte{}, err
+	}
+	versionData := make([]byte, end-offset)
+	_, err = file.ReadAt(versionData, int64(offset))
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to read data for model %q version "%d": %w`, versionInfo.ModelID, versionInfo.VersionNumber, err)
+	}
+	return versionData, nil
+}
+
+// OpenModelVersionData opens the data file of a given model version, it is read piece by piece instead of being loaded
+func (b *fsBackend) OpenModelVersionData(modelID string, versionNumber int) (backend.VersionInfo, backend.VersionDataReader, bool, error) {
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, nil, false, err
+	}
+
+	// An update moves another data file in place, the opened one keeps its data
+	file, err := os.Open(b.buildVersionDataFilename(versionInfo))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return backend.VersionInfo{}, nil, false, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return backend.VersionInfo{}, nil, false, fmt.Errorf(`unable to read data for model %q version "%d": %w`, versionInfo.ModelID, versionInfo.VersionNumber, err)
+	}
+	return versionInfo, file, true, nil
+}
+
+// UpdateModelVersionArchived changes whether a given model version is archived by rewriting its info file, its data is left untouched
+func (b *fsBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo.Archived = archived
+	err = saveVersionInfoFile(b.buildVersionInfoFilename(versionInfo), versionInfo)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return versionInfo, nil
+}
+
+// UpdateModelVersionUserData replaces the user data of a given model version by rewriting its info file, its data is left untouched
+func (b *fsBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo.UserData = userData
+	err = saveVersionInfoFile(b.buildVersionInfoFilename(versionInfo), versionInfo)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return versionInfo, nil
+}
+
 // DeleteModelVersion deletes a given model version
 func (b *fsBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	if err := checkModelPath(modelID); err != nil {
+		return err
+	}
 	var versionInfo backend.VersionInfo
 	if versionNumber == 0 {
 		return &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
@@ -532,6 +823,9 @@ func (b *fsBackend) DeleteModelVersion(modelID string, versionNumber int) error
 }
 
 func (b *fsBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	if err := checkModelPath(modelID); err != nil {
+		return nil, err
+	}
 	modelDirname := path.Join(b.rootDirname, modelID)
 	modelVersionEntries, err := filteredReadDir(modelDirname, 0, limit, func(entry fs.DirEntry) bool {
 		if entry.IsDir() {
@@ -554,10 +848,20 @@ func (b *fsBackend) ListModelVersionInfos(modelID string, initialVersionNumber u
 		versionInfoFilename := path.Join(modelDirname, entry.Name())
 		versionInfo, err := loadVersionInfoFile(versionInfoFilename)
 		if err != nil {
-			log.Printf("unable to unmarshall model version info from %q, skipping the version: %s", versionInfoFilename, err)
+			logrus.WithField("filename", versionInfoFilename).WithError(err).Warn("unable to unmarshall a version info, skipping the version")
 			continue
 		}
 		versions = append(versions, versionInfo)
 	}
 	return versions, nil
 }
+
+// QueryModelVersionInfos lists the versions selected by the filter ordered by version number from the given initial version number, it returns at most the given limit number of versions
+func (b *fsBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return backend.QueryModelVersionInfosByListing(b, modelID, filter, initialVersionNumber, limit)
+}
+
+// RetrieveStorageCapacity retrieves the capacity of the filesystem holding the root directory
+func (b *fsBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return backend.RetrieveFilesystemCapacity(b.rootDirname)
+}
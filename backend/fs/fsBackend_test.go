@@ -15,7 +15,12 @@
 package fs
 
 import (
+	"io"
+	"os"
+	"path"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cogment/cogment-model-registry/backend"
 	"github.com/cogment/cogment-model-registry/backend/test"
@@ -41,3 +46,159 @@ func BenchmarkSuiteFsBackend(b *testing.B) {
 		bck.Destroy()
 	})
 }
+
+func TestInterruptedVersionCreation(t *testing.T) {
+	rootDirname := t.TempDir()
+	b, err := CreateBackend(rootDirname)
+	assert.NoError(t, err)
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+
+	// Simulating a crash in the middle of an upload
+	writer, err := b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{Archived: true})
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("partial data"))
+	assert.NoError(t, err)
+	temporaryFilename := writer.(*fsVersionDataWriter).file.Name()
+	_, err = os.Stat(temporaryFilename)
+	assert.NoError(t, err)
+
+	// The partial version isn't visible
+	versionInfos, err := b.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 0)
+
+	// A recent temporary file, e.g. an ongoing write of another instance, is kept by the next backend
+	otherB, err := CreateBackend(rootDirname)
+	assert.NoError(t, err)
+	_, err = os.Stat(temporaryFilename)
+	assert.NoError(t, err)
+	otherB.Destroy()
+
+	// The stale temporary file is cleaned up by the next backend
+	staleTime := time.Now().Add(-2 * staleTemporaryFileAge)
+	assert.NoError(t, os.Chtimes(temporaryFilename, staleTime, staleTime))
+	b, err = CreateBackend(rootDirname)
+	assert.NoError(t, err)
+	defer b.Destroy()
+	_, err = os.Stat(temporaryFilename)
+	assert.True(t, os.IsNotExist(err))
+	entries, err := os.ReadDir(path.Join(rootDirname, "foo"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestUnsafeModelIDs(t *testing.T) {
+	parentDirname := t.TempDir()
+	rootDirname := path.Join(parentDirname, "root")
+	assert.NoError(t, os.Mkdir(rootDirname, 0o755))
+	b, err := CreateBackend(rootDirname)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	// The model ids escaping the root directory are rejected, such models are unknown
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "../foo"})
+	assert.Error(t, err)
+	entries, err := os.ReadDir(parentDirname)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	hasModel, err := b.HasModel("..")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+	err = b.DeleteModel("..")
+	assert.IsType(t, &backend.UnknownModelError{}, err)
+	_, err = os.Stat(rootDirname)
+	assert.NoError(t, err)
+}
+
+func TestConcurrentVersionCreations(t *testing.T) {
+	b, err := CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+
+	versionsCount := 20
+	versionNumbers := make(chan uint, versionsCount)
+	wg := sync.WaitGroup{}
+	for i := 0; i < versionsCount; i++ {
+		wg.Add(1)
+		go func(streamed bool) {
+			defer wg.Done()
+			var versionInfo backend.VersionInfo
+			var err error
+			if streamed {
+				writer, err := b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{Archived: true})
+				assert.NoError(t, err)
+				_, err = writer.Write(test.Data1)
+				assert.NoError(t, err)
+				versionInfo, err = writer.Commit()
+				assert.NoError(t, err)
+			} else {
+				versionInfo, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Archived: true, DataHash: backend.ComputeSHA256Hash(test.Data1), Data: test.Data1})
+				assert.NoError(t, err)
+			}
+			versionNumbers <- versionInfo.VersionNumber
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	close(versionNumbers)
+
+	// Every version got its own number
+	seenVersionNumbers := map[uint]bool{}
+	for versionNumber := range versionNumbers {
+		assert.False(t, seenVersionNumbers[versionNumber])
+		seenVersionNumbers[versionNumber] = true
+	}
+	versionInfos, err := b.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, versionsCount)
+	latestVersionNumber, err := b.RetrieveModelLatestVersionNumber("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(versionsCount), latestVersionNumber)
+}
+
+func TestRetrieveStorageCapacity(t *testing.T) {
+	b, err := CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	capacity, err := b.RetrieveStorageCapacity()
+	assert.NoError(t, err)
+	assert.Greater(t, capacity.TotalBytes, uint64(0))
+	assert.LessOrEqual(t, capacity.AvailableBytes, capacity.TotalBytes)
+}
+
+func TestOpenModelVersionData(t *testing.T) {
+	b, err := CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{DataHash: backend.ComputeSHA256Hash(test.Data1), Data: test.Data1})
+	assert.NoError(t, err)
+
+	versionInfo, reader, opened, err := backend.OpenModelVersionData(b, "foo", -1)
+	assert.NoError(t, err)
+	assert.True(t, opened)
+	defer reader.Close()
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	assert.Equal(t, len(test.Data1), versionInfo.DataSize)
+
+	// The opened data isn't changed by an update of the version
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{VersionNumber: 1, DataHash: backend.ComputeSHA256Hash(test.Data2), Data: test.Data2})
+	assert.NoError(t, err)
+	data := make([]byte, 5)
+	_, err = reader.ReadAt(data, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data1[6:11], data)
+	data = make([]byte, len(test.Data1))
+	n, err := reader.ReadAt(data, 0)
+	assert.True(t, err == nil || err == io.EOF)
+	assert.Equal(t, test.Data1, data[:n])
+
+	_, _, _, err = backend.OpenModelVersionData(b, "foo", 2)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+	_, _, _, err = backend.OpenModelVersionData(b, "bar", 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,217 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/objectStore"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// Configuration defines how to connect to a Google Cloud Storage bucket
+type Configuration struct {
+	Bucket          string
+	Prefix          string // Optional, prefix of the names of all the stored objects
+	CredentialsFile string // Optional, the default credentials are used if empty, e.g. from `GOOGLE_APPLICATION_CREDENTIALS`
+}
+
+type gcsStore struct {
+	client *storage.Client
+	bucket *storage.BucketHandle
+	prefix string
+	ctx    context.Context // Nil unless bound to a context
+}
+
+// CreateStore creates a new object store in a Google Cloud Storage bucket
+func CreateStore(configuration Configuration) (objectStore.Store, error) {
+	opts := []option.ClientOption{}
+	if configuration.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(configuration.CredentialsFile))
+	}
+	client, err := storage.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create gcs store: %w", err)
+	}
+
+	bucket := client.Bucket(configuration.Bucket)
+	_, err = bucket.Attrs(context.Background())
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("unable to create gcs store: unable to access bucket %q: %w", configuration.Bucket, err)
+	}
+
+	prefix := configuration.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &gcsStore{
+		client: client,
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
+
+// CreateBackend creates a new backend storing models and versions in a Google Cloud Storage bucket
+func CreateBackend(configuration Configuration) (backend.Backend, error) {
+	store, err := CreateStore(configuration)
+	if err != nil {
+		return nil, err
+	}
+	return objectStore.CreateBackend(store)
+}
+
+// BindContext returns a view of the store whose requests are canceled once the context is done
+func (s *gcsStore) BindContext(ctx context.Context) objectStore.Store {
+	bound := *s
+	bound.ctx = ctx
+	return &bound
+}
+
+func (s *gcsStore) requestContext() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *gcsStore) Close() error {
+	return s.client.Close()
+}
+
+// markTransient marks the errors of a throttled or temporarily unavailable Google Cloud Storage service as transient
+func markTransient(err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || (apiErr.Code != http.StatusTooManyRequests && apiErr.Code < 500) {
+		return err
+	}
+	return &backend.TransientError{Err: err}
+}
+
+func (s *gcsStore) Ping() error {
+	_, err := s.bucket.Attrs(s.requestContext())
+	if err != nil {
+		return fmt.Errorf("unable to reach the gcs bucket: %w", markTransient(err))
+	}
+	return nil
+}
+
+func (s *gcsStore) PutObject(key string, reader io.Reader, size int64) error {
+	// Canceling the context is the only way to abort an upload
+	ctx, cancel := context.WithCancel(s.requestContext())
+	defer cancel()
+	writer := s.bucket.Object(s.prefix + key).NewWriter(ctx)
+	writer.ContentType = "application/octet-stream"
+	_, err := io.Copy(writer, reader)
+	if err != nil {
+		cancel()
+		_ = writer.Close()
+		return err
+	}
+	return markTransient(writer.Close())
+}
+
+func (s *gcsStore) PutObjectIfAbsent(key string, reader io.Reader, size int64) error {
+	ctx, cancel := context.WithCancel(s.requestContext())
+	defer cancel()
+	writer := s.bucket.Object(s.prefix + key).If(storage.Conditions{DoesNotExist: true}).NewWriter(ctx)
+	writer.ContentType = "application/octet-stream"
+	_, err := io.Copy(writer, reader)
+	if err != nil {
+		cancel()
+		_ = writer.Close()
+		return err
+	}
+	err = writer.Close()
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return &objectStore.ObjectAlreadyExistsError{Key: key}
+	}
+	return markTransient(err)
+}
+
+func (s *gcsStore) GetObject(key string) (io.ReadCloser, error) {
+	reader, err := s.bucket.Object(s.prefix + key).NewReader(s.requestContext())
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, &objectStore.UnknownObjectError{Key: key}
+		}
+		return nil, markTransient(err)
+	}
+	return reader, nil
+}
+
+func (s *gcsStore) GetObjectRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	reader, err := s.bucket.Object(s.prefix+key).NewRangeReader(s.requestContext(), offset, length)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, &objectStore.UnknownObjectError{Key: key}
+		}
+		return nil, markTransient(err)
+	}
+	return reader, nil
+}
+
+// PresignGetObject signs the URL with the service account of the credentials, or through the IAM API without a private key
+func (s *gcsStore) PresignGetObject(key string, expiration time.Duration) (string, error) {
+	return s.bucket.SignedURL(s.prefix+key, &storage.SignedURLOptions{
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(expiration),
+		Scheme:  storage.SigningSchemeV4,
+	})
+}
+
+func (s *gcsStore) DeleteObject(key string) error {
+	err := s.bucket.Object(s.prefix + key).Delete(s.requestContext())
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return markTransient(err)
+	}
+	return nil
+}
+
+func (s *gcsStore) ListObjects(prefix string) ([]string, error) {
+	keys := []string{}
+	objects := s.bucket.Objects(s.requestContext(), &storage.Query{
+		Prefix:    s.prefix + prefix,
+		Delimiter: "/",
+	})
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, markTransient(err)
+		}
+		// Grouped entries only define a prefix
+		name := attrs.Name
+		if name == "" {
+			name = attrs.Prefix
+		}
+		keys = append(keys, strings.TrimPrefix(name, s.prefix))
+	}
+	return keys, nil
+}
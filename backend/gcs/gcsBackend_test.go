@@ -0,0 +1,46 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// The test suite requires an accessible Google Cloud Storage bucket configured using `COGMENT_MODEL_REGISTRY_TEST_GCS_BUCKET`
+// and the default credentials, e.g. from `GOOGLE_APPLICATION_CREDENTIALS`
+func TestSuiteGcsBackend(t *testing.T) {
+	bucket := os.Getenv("COGMENT_MODEL_REGISTRY_TEST_GCS_BUCKET")
+	if bucket == "" {
+		t.Skip("COGMENT_MODEL_REGISTRY_TEST_GCS_BUCKET is not defined")
+	}
+	test.RunSuite(t, func() backend.Backend {
+		// Each backend uses its own prefix to be isolated from the others
+		b, err := CreateBackend(Configuration{
+			Bucket: bucket,
+			Prefix: fmt.Sprintf("test-%d", time.Now().UnixNano()),
+		})
+		assert.NoError(t, err)
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+	})
+}
@@ -0,0 +1,372 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hybrid
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/objectStore"
+	"github.com/sirupsen/logrus"
+)
+
+type hybridBackend struct {
+	metadata MetadataStore
+	blobs    objectStore.Store
+}
+
+// CreateBackend creates a new backend storing models and versions metadata in the given metadata store and the versions data in the given object store
+//
+// Each version data is stored in the object store at `<model_id>/<unique_id>`.
+func CreateBackend(metadata MetadataStore, blobs objectStore.Store) (backend.Backend, error) {
+	return &hybridBackend{
+		metadata: metadata,
+		blobs:    blobs,
+	}, nil
+}
+
+// BindContext binds the metadata store and the object store to the context, if both are able to
+func (b *hybridBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	metadata, ok := b.metadata.(ContextMetadataStore)
+	if !ok {
+		return nil, false
+	}
+	blobs, ok := b.blobs.(objectStore.ContextStore)
+	if !ok {
+		return nil, false
+	}
+	return &hybridBackend{metadata: metadata.BindContext(ctx), blobs: blobs.BindContext(ctx)}, true
+}
+
+// Destroy terminates the underlying storages, closing the object store if needed
+func (b *hybridBackend) Destroy() {
+	b.metadata.Close()
+	if closer, ok := b.blobs.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+func (b *hybridBackend) Ping() error {
+	if err := b.metadata.Ping(); err != nil {
+		return err
+	}
+	return b.blobs.Ping()
+}
+
+func buildVersionDataKey(modelID string) (string, error) {
+	uniqueID := make([]byte, 12)
+	_, err := rand.Read(uniqueID)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate a data key for model %q: %w", modelID, err)
+	}
+	return modelID + "/" + hex.EncodeToString(uniqueID), nil
+}
+
+func (b *hybridBackend) deleteOrphanedData(modelID string, versionNumber uint, dataKey string) {
+	err := b.blobs.DeleteObject(dataKey)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"model_id": modelID, "version_number": versionNumber, "key": dataKey}).WithError(err).Warn("unable to delete the data of a version, the object is orphaned")
+	}
+}
+
+func (b *hybridBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	modelInfo := backend.ModelInfo{
+		ModelID:  modelArgs.ModelID,
+		UserData: modelArgs.UserData,
+	}
+	err := b.metadata.CreateOrUpdateModel(modelInfo)
+	if err != nil {
+		return backend.ModelInfo{}, err
+	}
+	return modelInfo, nil
+}
+
+func (b *hybridBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	return b.metadata.RetrieveModelInfo(modelID)
+}
+
+func (b *hybridBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	return b.metadata.RetrieveModelLatestVersionNumber(modelID)
+}
+
+// HasModel checks if a model exists
+func (b *hybridBackend) HasModel(modelID string) (bool, error) {
+	return b.metadata.HasModel(modelID)
+}
+
+// DeleteModel deletes a model with a given id from the storage, the data of its versions is deleted afterwards
+func (b *hybridBackend) DeleteModel(modelID string) error {
+	deletedVersions, err := b.metadata.DeleteModel(modelID)
+	if err != nil {
+		return err
+	}
+	for _, version := range deletedVersions {
+		b.deleteOrphanedData(modelID, version.VersionNumber, version.DataKey)
+	}
+	return nil
+}
+
+// ListModels list models ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *hybridBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.metadata.ListModels(offset, limit)
+}
+
+// QueryModels list models selected by the filter ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *hybridBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.metadata.QueryModels(filter, offset, limit)
+}
+
+// commitVersion stores the metadata of a version which data has been stored at the given key
+func (b *hybridBackend) commitVersion(modelID string, versionArgs backend.VersionArgs, dataKey string, dataSize int) (backend.VersionInfo, error) {
+	version, previousDataKey, err := b.metadata.CreateOrUpdateVersion(VersionMetadata{
+		VersionInfo: backend.VersionInfo{
+			ModelID:           modelID,
+			VersionNumber:     versionArgs.VersionNumber,
+			CreationTimestamp: versionArgs.CreationTimestamp,
+			Archived:          versionArgs.Archived,
+			DataHash:          versionArgs.DataHash,
+			DataSize:          dataSize,
+			UserData:          versionArgs.UserData,
+		},
+		DataKey: dataKey,
+	})
+	if err != nil {
+		_ = b.blobs.DeleteObject(dataKey)
+		return backend.VersionInfo{}, err
+	}
+	if previousDataKey != "" {
+		b.deleteOrphanedData(modelID, version.VersionNumber, previousDataKey)
+	}
+	return version.VersionInfo, nil
+}
+
+// CreateOrUpdateModelVersion creates and store a new version for a model and returns its info, including the version number
+func (b *hybridBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	hasModel, err := b.metadata.HasModel(modelID)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	if !hasModel {
+		return backend.VersionInfo{}, &backend.UnknownModelError{ModelID: modelID}
+	}
+
+	dataKey, err := buildVersionDataKey(modelID)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	err = b.blobs.PutObject(dataKey, bytes.NewReader(versionArgs.Data), int64(len(versionArgs.Data)))
+	if err != nil {
+		return backend.VersionInfo{}, fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+	}
+
+	return b.commitVersion(modelID, versionArgs, dataKey, len(versionArgs.Data))
+}
+
+type hybridVersionDataWriter struct {
+	backend      *hybridBackend
+	modelID      string
+	versionArgs  backend.VersionArgs
+	dataKey      string
+	objectWriter *objectStore.ObjectWriter
+	hasher       backend.Hasher
+	dataSize     int
+}
+
+func (w *hybridVersionDataWriter) Write(data []byte) (int, error) {
+	n, err := w.objectWriter.Write(data)
+	w.dataSize += n
+	_, _ = w.hasher.Write(data[:n])
+	if err != nil {
+		return n, fmt.Errorf("unable to write data for model %q: %w", w.modelID, err)
+	}
+	return n, nil
+}
+
+func (w *hybridVersionDataWriter) Commit() (backend.VersionInfo, error) {
+	err := w.objectWriter.Close()
+	if err != nil {
+		_ = w.backend.blobs.DeleteObject(w.dataKey)
+		return backend.VersionInfo{}, fmt.Errorf("unable to create a version for model %q: %w", w.modelID, err)
+	}
+
+	dataHash := w.hasher.Hash()
+	if w.versionArgs.DataHash != "" && w.versionArgs.DataHash != dataHash {
+		_ = w.backend.blobs.DeleteObject(w.dataKey)
+		return backend.VersionInfo{}, &backend.DataHashMismatchError{ModelID: w.modelID, ExpectedDataHash: w.versionArgs.DataHash, DataHash: dataHash}
+	}
+	versionArgs := w.versionArgs
+	versionArgs.DataHash = dataHash
+
+	return w.backend.commitVersion(w.modelID, versionArgs, w.dataKey, w.dataSize)
+}
+
+func (w *hybridVersionDataWriter) Abort() error {
+	return w.objectWriter.Abort()
+}
+
+// CreateOrUpdateModelVersionStream creates a writer uploading the version data to the object store as it is written, the metadata is stored on commit
+func (b *hybridBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	hasModel, err := b.metadata.HasModel(modelID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasModel {
+		return nil, &backend.UnknownModelError{ModelID: modelID}
+	}
+
+	hasher, err := backend.CreateVersionHasher(versionArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := buildVersionDataKey(modelID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hybridVersionDataWriter{
+		backend:      b,
+		modelID:      modelID,
+		versionArgs:  versionArgs,
+		dataKey:      dataKey,
+		objectWriter: objectStore.CreateObjectWriter(b.blobs, dataKey),
+		hasher:       hasher,
+	}, nil
+}
+
+// RetrieveModelVersionInfo retrieves a given model version info
+func (b *hybridBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	version, err := b.metadata.RetrieveVersion(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return version.VersionInfo, nil
+}
+
+// RetrieveModelVersionData retrieves a given model version data
+func (b *hybridBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	version, err := b.metadata.RetrieveVersion(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	reader, err := b.blobs.GetObject(version.DataKey)
+	if err != nil {
+		if _, ok := err.(*objectStore.UnknownObjectError); ok {
+			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return []byte{}, fmt.Errorf(`unable to read data for model %q version "%d": %w`, modelID, version.VersionNumber, err)
+	}
+	defer reader.Close()
+	versionData, err := io.ReadAll(reader)
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to read data for model %q version "%d": %w`, modelID, version.VersionNumber, err)
+	}
+	return versionData, nil
+}
+
+// PresignModelVersionData presigns the URL of the data blob of a given model version, if the blob store is able to
+func (b *hybridBackend) PresignModelVersionData(modelID string, versionNumber int, expiration time.Duration) (backend.VersionInfo, string, bool, error) {
+	presigningStore, ok := b.blobs.(objectStore.PresigningStore)
+	if !ok {
+		return backend.VersionInfo{}, "", false, nil
+	}
+	version, err := b.metadata.RetrieveVersion(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, "", false, err
+	}
+	url, err := presigningStore.PresignGetObject(version.DataKey, expiration)
+	if err != nil {
+		return backend.VersionInfo{}, "", false, fmt.Errorf(`unable to presign the data of model %q version "%d": %w`, modelID, version.VersionNumber, err)
+	}
+	return version.VersionInfo, url, true, nil
+}
+
+// RetrieveModelVersionDataRange retrieves a range of a given model version data, only reading this range from the blob store
+func (b *hybridBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	version, err := b.metadata.RetrieveVersion(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	end, err := backend.ResolveDataRange(modelID, versionNumber, uint64(version.DataSize), offset, length)
+	if err != nil || end == offset {
+		return []byte{}, err
+	}
+	versionData, err := objectStore.ReadObjectRange(b.blobs, version.DataKey, offset, end)
+	if err != nil {
+		if _, ok := err.(*objectStore.UnknownObjectError); ok {
+			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return []byte{}, fmt.Errorf(`unable to read data for model %q version "%d": %w`, modelID, version.VersionNumber, err)
+	}
+	return versionData, nil
+}
+
+// UpdateModelVersionArchived changes whether a given model version is archived in the metadata store, its data is left untouched
+func (b *hybridBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	version, err := b.metadata.UpdateVersionArchived(modelID, versionNumber, archived)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return version.VersionInfo, nil
+}
+
+// UpdateModelVersionUserData replaces the user data of a given model version in the metadata store, its data is left untouched
+func (b *hybridBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	version, err := b.metadata.UpdateVersionUserData(modelID, versionNumber, userData)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return version.VersionInfo, nil
+}
+
+// DeleteModelVersion deletes a given model version
+func (b *hybridBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	version, err := b.metadata.DeleteVersion(modelID, versionNumber)
+	if err != nil {
+		return err
+	}
+	err = b.blobs.DeleteObject(version.DataKey)
+	if err != nil {
+		return fmt.Errorf(`unable to delete model %q version "%d" data: %w`, modelID, version.VersionNumber, err)
+	}
+	return nil
+}
+
+func (b *hybridBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return b.QueryModelVersionInfos(modelID, backend.VersionFilter{}, initialVersionNumber, limit)
+}
+
+func (b *hybridBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	versions, err := b.metadata.QueryVersions(modelID, filter, initialVersionNumber, limit)
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+	versionInfos := make([]backend.VersionInfo, 0, len(versions))
+	for _, version := range versions {
+		versionInfos = append(versionInfos, version.VersionInfo)
+	}
+	return versionInfos, nil
+}
+
+// RetrieveStorageCapacity retrieves an unknown capacity, object stores don't report their capacity
+func (b *hybridBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return backend.StorageCapacity{}, nil
+}
@@ -0,0 +1,269 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hybrid
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+type memoryMetadataStoreModel struct {
+	modelInfo backend.ModelInfo
+	versions  map[uint]VersionMetadata
+}
+
+// versionNumbers lists the version numbers of the model in ascending order
+func (m *memoryMetadataStoreModel) versionNumbers() []uint {
+	versionNumbers := make([]uint, 0, len(m.versions))
+	for versionNumber := range m.versions {
+		versionNumbers = append(versionNumbers, versionNumber)
+	}
+	sort.Slice(versionNumbers, func(i, j int) bool { return versionNumbers[i] < versionNumbers[j] })
+	return versionNumbers
+}
+
+type memoryMetadataStore struct {
+	mutex  sync.RWMutex
+	models map[string]*memoryMetadataStoreModel
+}
+
+// CreateMemoryMetadataStore creates a metadata store keeping everything in memory, mostly useful for tests
+func CreateMemoryMetadataStore() MetadataStore {
+	return &memoryMetadataStore{
+		models: make(map[string]*memoryMetadataStoreModel),
+	}
+}
+
+func (s *memoryMetadataStore) Close() error {
+	return nil
+}
+
+func (s *memoryMetadataStore) Ping() error {
+	return nil
+}
+
+func (s *memoryMetadataStore) CreateOrUpdateModel(modelInfo backend.ModelInfo) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if model, ok := s.models[modelInfo.ModelID]; ok {
+		model.modelInfo = modelInfo
+		return nil
+	}
+	s.models[modelInfo.ModelID] = &memoryMetadataStoreModel{
+		modelInfo: modelInfo,
+		versions:  make(map[uint]VersionMetadata),
+	}
+	return nil
+}
+
+func (s *memoryMetadataStore) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	model, ok := s.models[modelID]
+	if !ok {
+		return backend.ModelInfo{}, &backend.UnknownModelError{ModelID: modelID}
+	}
+	return model.modelInfo, nil
+}
+
+func (s *memoryMetadataStore) HasModel(modelID string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.models[modelID]
+	return ok, nil
+}
+
+func (s *memoryMetadataStore) DeleteModel(modelID string) ([]VersionMetadata, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	model, ok := s.models[modelID]
+	if !ok {
+		return nil, &backend.UnknownModelError{ModelID: modelID}
+	}
+	delete(s.models, modelID)
+	versions := make([]VersionMetadata, 0, len(model.versions))
+	for _, versionNumber := range model.versionNumbers() {
+		versions = append(versions, model.versions[versionNumber])
+	}
+	return versions, nil
+}
+
+func (s *memoryMetadataStore) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	return s.QueryModels(backend.ModelFilter{}, offset, limit)
+}
+
+func (s *memoryMetadataStore) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	matches := filter.Matcher()
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	modelIDs := make([]string, 0, len(s.models))
+	for modelID, model := range s.models {
+		if matches(model.modelInfo) {
+			modelIDs = append(modelIDs, modelID)
+		}
+	}
+	sort.Strings(modelIDs)
+
+	models := []backend.ModelInfo{}
+	for modelIdx, modelID := range modelIDs {
+		if modelIdx < offset {
+			continue
+		}
+		models = append(models, s.models[modelID].modelInfo)
+		if limit > 0 && len(models) >= limit {
+			break
+		}
+	}
+	return models, nil
+}
+
+func (s *memoryMetadataStore) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	model, ok := s.models[modelID]
+	if !ok {
+		return 0, &backend.UnknownModelError{ModelID: modelID}
+	}
+	versionNumbers := model.versionNumbers()
+	if len(versionNumbers) == 0 {
+		return 0, nil
+	}
+	return versionNumbers[len(versionNumbers)-1], nil
+}
+
+func (s *memoryMetadataStore) CreateOrUpdateVersion(version VersionMetadata) (VersionMetadata, string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	model, ok := s.models[version.ModelID]
+	if !ok {
+		return VersionMetadata{}, "", &backend.UnknownModelError{ModelID: version.ModelID}
+	}
+	if version.VersionNumber == 0 {
+		// Create a new version after the last one
+		version.VersionNumber = 1
+		if versionNumbers := model.versionNumbers(); len(versionNumbers) > 0 {
+			version.VersionNumber = versionNumbers[len(versionNumbers)-1] + 1
+		}
+	}
+	previousDataKey := ""
+	if existingVersion, ok := model.versions[version.VersionNumber]; ok {
+		version.CreationTimestamp = existingVersion.CreationTimestamp
+		previousDataKey = existingVersion.DataKey
+	}
+	model.versions[version.VersionNumber] = version
+	return version, previousDataKey, nil
+}
+
+// resolveVersionNumber must be called with the mutex locked
+func (s *memoryMetadataStore) resolveVersionNumber(modelID string, versionNumber int) (*memoryMetadataStoreModel, uint, error) {
+	if versionNumber == 0 {
+		return nil, 0, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	model, ok := s.models[modelID]
+	if !ok {
+		if versionNumber > 0 {
+			return nil, 0, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return nil, 0, &backend.UnknownModelError{ModelID: modelID}
+	}
+	if versionNumber > 0 {
+		if _, ok := model.versions[uint(versionNumber)]; !ok {
+			return nil, 0, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return model, uint(versionNumber), nil
+	}
+	// Retrieve the nth to last version
+	versionNumbers := model.versionNumbers()
+	nthToLastIndex := -versionNumber - 1
+	if nthToLastIndex >= len(versionNumbers) {
+		return nil, 0, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	return model, versionNumbers[len(versionNumbers)-1-nthToLastIndex], nil
+}
+
+func (s *memoryMetadataStore) RetrieveVersion(modelID string, versionNumber int) (VersionMetadata, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	model, resolvedVersionNumber, err := s.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return VersionMetadata{}, err
+	}
+	return model.versions[resolvedVersionNumber], nil
+}
+
+func (s *memoryMetadataStore) UpdateVersionArchived(modelID string, versionNumber int, archived bool) (VersionMetadata, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	model, resolvedVersionNumber, err := s.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return VersionMetadata{}, err
+	}
+	version := model.versions[resolvedVersionNumber]
+	version.Archived = archived
+	model.versions[resolvedVersionNumber] = version
+	return version, nil
+}
+
+func (s *memoryMetadataStore) UpdateVersionUserData(modelID string, versionNumber int, userData map[string]string) (VersionMetadata, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	model, resolvedVersionNumber, err := s.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return VersionMetadata{}, err
+	}
+	version := model.versions[resolvedVersionNumber]
+	version.UserData = userData
+	model.versions[resolvedVersionNumber] = version
+	return version, nil
+}
+
+func (s *memoryMetadataStore) DeleteVersion(modelID string, versionNumber int) (VersionMetadata, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	model, resolvedVersionNumber, err := s.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return VersionMetadata{}, err
+	}
+	version := model.versions[resolvedVersionNumber]
+	delete(model.versions, resolvedVersionNumber)
+	return version, nil
+}
+
+func (s *memoryMetadataStore) ListVersions(modelID string, initialVersionNumber uint, limit int) ([]VersionMetadata, error) {
+	return s.QueryVersions(modelID, backend.VersionFilter{}, initialVersionNumber, limit)
+}
+
+func (s *memoryMetadataStore) QueryVersions(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]VersionMetadata, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	model, ok := s.models[modelID]
+	if !ok {
+		return []VersionMetadata{}, &backend.UnknownModelError{ModelID: modelID}
+	}
+	versions := []VersionMetadata{}
+	for _, versionNumber := range model.versionNumbers() {
+		if versionNumber < initialVersionNumber || !filter.Matches(model.versions[versionNumber].VersionInfo) {
+			continue
+		}
+		versions = append(versions, model.versions[versionNumber])
+		if limit > 0 && len(versions) >= limit {
+			break
+		}
+	}
+	return versions, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hybrid
+
+import (
+	"context"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// VersionMetadata describes a version as stored in a metadata store, its data is stored in the blob store at DataKey
+type VersionMetadata struct {
+	backend.VersionInfo
+	DataKey string
+}
+
+// MetadataStore defines the interface of the store holding the models and versions metadata of a hybrid backend
+//
+// Errors follow the conventions of `backend.Backend`, e.g. `backend.UnknownModelError` for an unknown model.
+type MetadataStore interface {
+	Close() error
+	// Ping checks the storage underlying the metadata store is reachable
+	Ping() error
+
+	CreateOrUpdateModel(modelInfo backend.ModelInfo) error
+	RetrieveModelInfo(modelID string) (backend.ModelInfo, error)
+	HasModel(modelID string) (bool, error)
+	// DeleteModel deletes a model and its versions, it returns the metadata of the deleted versions
+	DeleteModel(modelID string) ([]VersionMetadata, error)
+	ListModels(offset int, limit int) ([]backend.ModelInfo, error)
+	QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error)
+
+	RetrieveModelLatestVersionNumber(modelID string) (uint, error)
+	// CreateOrUpdateVersion stores the metadata of a version, a new version number is attributed when it is 0
+	//
+	// The creation timestamp of an updated version is kept, the data key it replaces is returned ("" when creating a version).
+	CreateOrUpdateVersion(version VersionMetadata) (VersionMetadata, string, error)
+	// RetrieveVersion retrieves a version metadata, negative version numbers denote the nth to last version
+	RetrieveVersion(modelID string, versionNumber int) (VersionMetadata, error)
+	// UpdateVersionArchived changes whether a version is archived, negative version numbers denote the nth to last version, it returns the updated metadata
+	UpdateVersionArchived(modelID string, versionNumber int, archived bool) (VersionMetadata, error)
+	// UpdateVersionUserData replaces the user data of a version, negative version numbers denote the nth to last version, it returns the updated metadata
+	UpdateVersionUserData(modelID string, versionNumber int, userData map[string]string) (VersionMetadata, error)
+	// DeleteVersion deletes a version metadata, negative version numbers denote the nth to last version, it returns the deleted metadata
+	DeleteVersion(modelID string, versionNumber int) (VersionMetadata, error)
+	ListVersions(modelID string, initialVersionNumber uint, limit int) ([]VersionMetadata, error)
+	QueryVersions(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]VersionMetadata, error)
+}
+
+// ContextMetadataStore is implemented by the metadata stores whose queries can be bound to a context
+type ContextMetadataStore interface {
+	MetadataStore
+	// BindContext returns a view of the store whose queries are canceled once the context is done
+	BindContext(ctx context.Context) MetadataStore
+}
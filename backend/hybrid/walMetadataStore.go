@@ -0,0 +1,523 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hybrid
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// DefaultWALCompactionThreshold is the default number of records appended to the log before it is compacted
+const DefaultWALCompactionThreshold = 10000
+
+// The directory of a WAL metadata store holds
+//
+//	snapshot.json      the metadata once the logs up to its generation were applied
+//	wal-<generation>.log
+//	...
+//
+// the mutations are appended to the log of the latest generation. A compaction starts a new generation, writes the
+// snapshot of the previous ones then deletes their logs, a crash at any point leaves a snapshot and the logs following it.
+const (
+	walSnapshotFilename  = "snapshot.json"
+	walLogFilenamePrefix = "wal-"
+	walLogFilenameSuffix = ".log"
+	walFormatVersion     = 1
+	// Each record is prefixed by the size and the CRC-32 of its JSON payload
+	walRecordHeaderSize = 8
+)
+
+type WALConfiguration struct {
+	Dirname             string
+	CompactionThreshold int // Number of records appended to the log before it is compacted into a snapshot, DefaultWALCompactionThreshold when 0
+}
+
+type walOperation string
+
+const (
+	walPutModel              walOperation = "put_model"
+	walDeleteModel           walOperation = "delete_model"
+	walPutVersion            walOperation = "put_version"
+	walUpdateVersionArchived walOperation = "update_version_archived"
+	walUpdateVersionUserData walOperation = "update_version_user_data"
+	walDeleteVersion         walOperation = "delete_version"
+)
+
+// walRecord is a mutation of the metadata, applying it doesn't depend on the state it is applied to
+type walRecord struct {
+	Operation     walOperation       `json:"operation"`
+	ModelInfo     *backend.ModelInfo `json:"model_info,omitempty"`
+	Version       *VersionMetadata   `json:"version,omitempty"`
+	ModelID       string             `json:"model_id,omitempty"`
+	VersionNumber uint               `json:"version_number,omitempty"`
+	Archived      bool               `json:"archived,omitempty"`
+	UserData      map[string]string  `json:"user_data,omitempty"`
+}
+
+type walSnapshotModel struct {
+	ModelInfo backend.ModelInfo `json:"model_info"`
+	Versions  []VersionMetadata `json:"versions"`
+}
+
+type walSnapshot struct {
+	FormatVersion int                `json:"format_version"`
+	Generation    uint64             `json:"generation"`
+	Models        []walSnapshotModel `json:"models"`
+}
+
+// walMetadataStore is a memory metadata store whose mutations are appended to a write-ahead log
+//
+// The reads are served by the memory store, the mutations are serialized by the log mutex.
+type walMetadataStore struct {
+	MetadataStore
+	configuration WALConfiguration
+	mutex         sync.Mutex
+	generation    uint64
+	log           *os.File
+	logSize       int64 // Size of the complete records of the log
+	recordsCount  int   // Records appended since the latest compaction
+}
+
+// CreateWALMetadataStore creates a metadata store keeping everything in memory and appending every mutation to a
+// write-ahead log in the given directory, the metadata is restored from the log when the store is created
+//
+// A single store can use a directory at a time.
+func CreateWALMetadataStore(configuration WALConfiguration) (MetadataStore, error) {
+	if configuration.CompactionThreshold <= 0 {
+		configuration.CompactionThreshold = DefaultWALCompactionThreshold
+	}
+	if err := os.MkdirAll(configuration.Dirname, 0750); err != nil {
+		return nil, fmt.Errorf("unable to create the WAL directory %q: %w", configuration.Dirname, err)
+	}
+	s := &walMetadataStore{
+		MetadataStore: CreateMemoryMetadataStore(),
+		configuration: configuration,
+	}
+	if err := s.restore(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *walMetadataStore) logFilename(generation uint64) string {
+	return filepath.Join(s.configuration.Dirname, fmt.Sprintf("%s%020d%s", walLogFilenamePrefix, generation, walLogFilenameSuffix))
+}
+
+// listLogGenerations lists the generations of the logs of the directory in ascending order
+func (s *walMetadataStore) listLogGenerations() ([]uint64, error) {
+	entries, err := ioutil.ReadDir(s.configuration.Dirname)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the WAL directory %q: %w", s.configuration.Dirname, err)
+	}
+	generations := []uint64{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, walLogFilenamePrefix) || !strings.HasSuffix(name, walLogFilenameSuffix) {
+			continue
+		}
+		generation, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, walLogFilenamePrefix), walLogFilenameSuffix), 10, 64)
+		if err == nil {
+			generations = append(generations, generation)
+		}
+	}
+	sort.Slice(generations, func(i, j int) bool { return generations[i] < generations[j] })
+	return generations, nil
+}
+
+// restore loads the snapshot, replays the following logs and opens the latest one
+func (s *walMetadataStore) restore() error {
+	snapshotGeneration, err := s.loadSnapshot()
+	if err != nil {
+		return err
+	}
+	generations, err := s.listLogGenerations()
+	if err != nil {
+		return err
+	}
+	// Appending to the latest log, or to the one following the snapshot
+	s.generation = snapshotGeneration + 1
+	for _, generation := range generations {
+		if generation <= snapshotGeneration {
+			// Already part of the snapshot, the compaction was interrupted before deleting it
+			if err := os.Remove(s.logFilename(generation)); err != nil {
+				return fmt.Errorf("unable to delete the compacted WAL %q: %w", s.logFilename(generation), err)
+			}
+			continue
+		}
+		recordsCount, err := s.replayLog(generation)
+		if err != nil {
+			return err
+		}
+		s.recordsCount += recordsCount
+		s.generation = generation
+	}
+	if err := s.openLog(); err != nil {
+		return err
+	}
+	if s.recordsCount >= s.configuration.CompactionThreshold {
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *walMetadataStore) loadSnapshot() (uint64, error) {
+	filename := filepath.Join(s.configuration.Dirname, walSnapshotFilename)
+	content, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to read the WAL snapshot %q: %w", filename, err)
+	}
+	snapshot := walSnapshot{}
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return 0, fmt.Errorf("unable to parse the WAL snapshot %q: %w", filename, err)
+	}
+	if snapshot.FormatVersion != walFormatVersion {
+		return 0, fmt.Errorf("unsupported format version %d of the WAL snapshot %q, expecting %d", snapshot.FormatVersion, filename, walFormatVersion)
+	}
+	for _, model := range snapshot.Models {
+		if err := s.MetadataStore.CreateOrUpdateModel(model.ModelInfo); err != nil {
+			return 0, err
+		}
+		for _, version := range model.Versions {
+			if _, _, err := s.MetadataStore.CreateOrUpdateVersion(version); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return snapshot.Generation, nil
+}
+
+// replayLog applies the records of a log, a truncated or corrupted record ends the log, it was being written during a
+// crash and wasn't acknowledged
+func (s *walMetadataStore) replayLog(generation uint64) (int, error) {
+	filename := s.logFilename(generation)
+	file, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return 0, fmt.Errorf("unable to open the WAL %q: %w", filename, err)
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	recordsCount := 0
+	validSize := int64(0)
+	for {
+		payload, err := readWALRecord(reader)
+		if err == io.EOF {
+			return recordsCount, nil
+		}
+		record := walRecord{}
+		if err == nil {
+			err = json.Unmarshal(payload, &record)
+		}
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"filename": filename, "offset": validSize}).WithError(err).Warn("Discarding the end of a WAL, its last record is incomplete")
+			if err := file.Truncate(validSize); err != nil {
+				return recordsCount, fmt.Errorf("unable to truncate the WAL %q: %w", filename, err)
+			}
+			return recordsCount, file.Sync()
+		}
+		if _, err := s.apply(record); err != nil {
+			return recordsCount, fmt.Errorf("unable to replay the WAL %q: %w", filename, err)
+		}
+		recordsCount++
+		validSize += int64(walRecordHeaderSize + len(payload))
+	}
+}
+
+func readWALRecord(reader io.Reader) ([]byte, error) {
+	header := make([]byte, walRecordHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated record header")
+		}
+		return nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[:4]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, fmt.Errorf("truncated record")
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, fmt.Errorf("record checksum mismatch")
+	}
+	return payload, nil
+}
+
+func (s *walMetadataStore) openLog() error {
+	filename := s.logFilename(s.generation)
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("unable to open the WAL %q: %w", filename, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("unable to open the WAL %q: %w", filename, err)
+	}
+	s.log = file
+	s.logSize = info.Size()
+	return nil
+}
+
+// apply applies a record to the memory store, it returns the versions deleted along with a model
+func (s *walMetadataStore) apply(record walRecord) ([]VersionMetadata, error) {
+	var err error
+	var deletedVersions []VersionMetadata
+	switch record.Operation {
+	case walPutModel:
+		err = s.MetadataStore.CreateOrUpdateModel(*record.ModelInfo)
+	case walDeleteModel:
+		deletedVersions, err = s.MetadataStore.DeleteModel(record.ModelID)
+	case walPutVersion:
+		_, _, err = s.MetadataStore.CreateOrUpdateVersion(*record.Version)
+	case walUpdateVersionArchived:
+		_, err = s.MetadataStore.UpdateVersionArchived(record.ModelID, int(record.VersionNumber), record.Archived)
+	case walUpdateVersionUserData:
+		_, err = s.MetadataStore.UpdateVersionUserData(record.ModelID, int(record.VersionNumber), record.UserData)
+	case walDeleteVersion:
+		_, err = s.MetadataStore.DeleteVersion(record.ModelID, int(record.VersionNumber))
+	default:
+		err = fmt.Errorf("unknown WAL operation %q", record.Operation)
+	}
+	return deletedVersions, err
+}
+
+// append durably appends a record to the log then applies it, it must be called with the mutex locked
+func (s *walMetadataStore) append(record walRecord) ([]VersionMetadata, error) {
+	if s.log == nil {
+		return nil, fmt.Errorf("the WAL metadata store is closed")
+	}
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("unable to serialize a WAL record: %w", err)
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, walRecordHeaderSize+len(payload)))
+	header := make([]byte, walRecordHeaderSize)
+	binary.BigEndian.PutUint32(header[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+	buffer.Write(header)
+	buffer.Write(payload)
+	_, err = s.log.Write(buffer.Bytes())
+	if err == nil {
+		err = s.log.Sync()
+	}
+	if err != nil {
+		// Removing the partially written record, the following ones would otherwise be discarded when replaying
+		_ = s.log.Truncate(s.logSize)
+		return nil, fmt.Errorf("unable to append to the WAL: %w", err)
+	}
+	s.logSize += int64(buffer.Len())
+	deletedVersions, err := s.apply(record)
+	if err != nil {
+		return nil, err
+	}
+	s.recordsCount++
+	if s.recordsCount >= s.configuration.CompactionThreshold {
+		if err := s.compact(); err != nil {
+			// The log keeps growing until the next successful compaction
+			logrus.WithField("dirname", s.configuration.Dirname).WithError(err).Error("Unable to compact the WAL")
+		}
+	}
+	return deletedVersions, nil
+}
+
+// compact writes the current metadata as a snapshot and deletes the logs, it must be called with the mutex locked
+func (s *walMetadataStore) compact() error {
+	compactedGeneration := s.generation
+	if err := s.log.Close(); err != nil {
+		return fmt.Errorf("unable to close the WAL: %w", err)
+	}
+	s.log = nil
+	s.generation++
+	if err := s.openLog(); err != nil {
+		return err
+	}
+
+	snapshot := walSnapshot{FormatVersion: walFormatVersion, Generation: compactedGeneration, Models: []walSnapshotModel{}}
+	modelInfos, err := s.MetadataStore.ListModels(0, -1)
+	if err != nil {
+		return err
+	}
+	for _, modelInfo := range modelInfos {
+		versions, err := s.MetadataStore.ListVersions(modelInfo.ModelID, 0, -1)
+		if err != nil {
+			return err
+		}
+		snapshot.Models = append(snapshot.Models, walSnapshotModel{ModelInfo: modelInfo, Versions: versions})
+	}
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("unable to serialize the WAL snapshot: %w", err)
+	}
+	if err := writeFileDurably(filepath.Join(s.configuration.Dirname, walSnapshotFilename), content); err != nil {
+		return fmt.Errorf("unable to write the WAL snapshot: %w", err)
+	}
+	s.recordsCount = 0
+
+	generations, err := s.listLogGenerations()
+	if err != nil {
+		return err
+	}
+	for _, generation := range generations {
+		if generation <= compactedGeneration {
+			if err := os.Remove(s.logFilename(generation)); err != nil {
+				return fmt.Errorf("unable to delete the compacted WAL %q: %w", s.logFilename(generation), err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileDurably writes a file to a temporary file then moves it in place, a crash never leaves a partial file
+func writeFileDurably(filename string, content []byte) error {
+	dirname := filepath.Dir(filename)
+	file, err := ioutil.TempFile(dirname, ".snapshot-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), filename); err != nil {
+		return err
+	}
+	dir, err := os.Open(dirname)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func (s *walMetadataStore) Ping() error {
+	_, err := os.Stat(s.configuration.Dirname)
+	return err
+}
+
+func (s *walMetadataStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.log == nil {
+		return nil
+	}
+	err := s.log.Close()
+	s.log = nil
+	return err
+}
+
+func (s *walMetadataStore) CreateOrUpdateModel(modelInfo backend.ModelInfo) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err := s.append(walRecord{Operation: walPutModel, ModelInfo: &modelInfo})
+	return err
+}
+
+func (s *walMetadataStore) DeleteModel(modelID string) ([]VersionMetadata, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := s.MetadataStore.RetrieveModelInfo(modelID); err != nil {
+		return nil, err
+	}
+	return s.append(walRecord{Operation: walDeleteModel, ModelID: modelID})
+}
+
+func (s *walMetadataStore) CreateOrUpdateVersion(version VersionMetadata) (VersionMetadata, string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	latestVersionNumber, err := s.MetadataStore.RetrieveModelLatestVersionNumber(version.ModelID)
+	if err != nil {
+		return VersionMetadata{}, "", err
+	}
+	// The record holds the resolved version, replaying it doesn't depend on the existing versions
+	if version.VersionNumber == 0 {
+		version.VersionNumber = latestVersionNumber + 1
+	}
+	previousDataKey := ""
+	if existingVersion, err := s.MetadataStore.RetrieveVersion(version.ModelID, int(version.VersionNumber)); err == nil {
+		version.CreationTimestamp = existingVersion.CreationTimestamp
+		previousDataKey = existingVersion.DataKey
+	}
+	if _, err := s.append(walRecord{Operation: walPutVersion, Version: &version}); err != nil {
+		return VersionMetadata{}, "", err
+	}
+	return version, previousDataKey, nil
+}
+
+func (s *walMetadataStore) UpdateVersionArchived(modelID string, versionNumber int, archived bool) (VersionMetadata, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	version, err := s.MetadataStore.RetrieveVersion(modelID, versionNumber)
+	if err != nil {
+		return VersionMetadata{}, err
+	}
+	if _, err := s.append(walRecord{Operation: walUpdateVersionArchived, ModelID: modelID, VersionNumber: version.VersionNumber, Archived: archived}); err != nil {
+		return VersionMetadata{}, err
+	}
+	version.Archived = archived
+	return version, nil
+}
+
+func (s *walMetadataStore) UpdateVersionUserData(modelID string, versionNumber int, userData map[string]string) (VersionMetadata, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	version, err := s.MetadataStore.RetrieveVersion(modelID, versionNumber)
+	if err != nil {
+		return VersionMetadata{}, err
+	}
+	if _, err := s.append(walRecord{Operation: walUpdateVersionUserData, ModelID: modelID, VersionNumber: version.VersionNumber, UserData: userData}); err != nil {
+		return VersionMetadata{}, err
+	}
+	version.UserData = userData
+	return version, nil
+}
+
+func (s *walMetadataStore) DeleteVersion(modelID string, versionNumber int) (VersionMetadata, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	version, err := s.MetadataStore.RetrieveVersion(modelID, versionNumber)
+	if err != nil {
+		return VersionMetadata{}, err
+	}
+	if _, err := s.append(walRecord{Operation: walDeleteVersion, ModelID: modelID, VersionNumber: version.VersionNumber}); err != nil {
+		return VersionMetadata{}, err
+	}
+	return version, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hybrid
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+var creationTimestamp = time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func createVersionMetadata(modelID string, dataKey string) VersionMetadata {
+	return VersionMetadata{
+		VersionInfo: backend.VersionInfo{
+			ModelID:           modelID,
+			CreationTimestamp: creationTimestamp,
+			Archived:          true,
+			DataHash:          "sha256:" + dataKey,
+			DataSize:          12,
+		},
+		DataKey: dataKey,
+	}
+}
+
+func populate(t *testing.T, s MetadataStore) {
+	assert.NoError(t, s.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{"team": "a"}}))
+	assert.NoError(t, s.CreateOrUpdateModel(backend.ModelInfo{ModelID: "bar"}))
+	for _, dataKey := range []string{"a", "b", "c"} {
+		_, _, err := s.CreateOrUpdateVersion(createVersionMetadata("foo", dataKey))
+		assert.NoError(t, err)
+	}
+	_, err := s.UpdateVersionArchived("foo", -1, false)
+	assert.NoError(t, err)
+	_, err = s.UpdateVersionUserData("foo", 2, map[string]string{"step": "2"})
+	assert.NoError(t, err)
+	_, err = s.DeleteVersion("foo", 1)
+	assert.NoError(t, err)
+	_, err = s.DeleteModel("bar")
+	assert.NoError(t, err)
+}
+
+func assertPopulated(t *testing.T, s MetadataStore) {
+	modelInfos, err := s.ListModels(0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []backend.ModelInfo{{ModelID: "foo", UserData: map[string]string{"team": "a"}}}, modelInfos)
+	versions, err := s.ListVersions("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+	assert.Equal(t, uint(2), versions[0].VersionNumber)
+	assert.Equal(t, map[string]string{"step": "2"}, versions[0].UserData)
+	assert.True(t, versions[0].Archived)
+	assert.True(t, versions[0].CreationTimestamp.Equal(creationTimestamp))
+	assert.Equal(t, uint(3), versions[1].VersionNumber)
+	assert.False(t, versions[1].Archived)
+	assert.Equal(t, "c", versions[1].DataKey)
+}
+
+func TestWALMetadataStoreRestart(t *testing.T) {
+	dirname := t.TempDir()
+	s, err := CreateWALMetadataStore(WALConfiguration{Dirname: dirname})
+	assert.NoError(t, err)
+	populate(t, s)
+	assertPopulated(t, s)
+	assert.NoError(t, s.Close())
+	_, err = s.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Error(t, s.CreateOrUpdateModel(backend.ModelInfo{ModelID: "baz"}))
+
+	s, err = CreateWALMetadataStore(WALConfiguration{Dirname: dirname})
+	assert.NoError(t, err)
+	defer s.Close()
+	assertPopulated(t, s)
+
+	// New versions follow the replayed ones
+	version, previousDataKey, err := s.CreateOrUpdateVersion(createVersionMetadata("foo", "d"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(4), version.VersionNumber)
+	assert.Equal(t, "", previousDataKey)
+	version.DataKey = "e"
+	version.CreationTimestamp = time.Now()
+	version, previousDataKey, err = s.CreateOrUpdateVersion(version)
+	assert.NoError(t, err)
+	assert.Equal(t, "d", previousDataKey)
+	assert.True(t, version.CreationTimestamp.Equal(creationTimestamp))
+}
+
+func TestWALMetadataStoreCompaction(t *testing.T) {
+	dirname := t.TempDir()
+	s, err := CreateWALMetadataStore(WALConfiguration{Dirname: dirname, CompactionThreshold: 4})
+	assert.NoError(t, err)
+	populate(t, s)
+	assert.NoError(t, s.Close())
+
+	_, err = os.Stat(filepath.Join(dirname, walSnapshotFilename))
+	assert.NoError(t, err)
+	logFilenames, err := filepath.Glob(filepath.Join(dirname, walLogFilenamePrefix+"*"))
+	assert.NoError(t, err)
+	assert.Len(t, logFilenames, 1)
+
+	s, err = CreateWALMetadataStore(WALConfiguration{Dirname: dirname, CompactionThreshold: 4})
+	assert.NoError(t, err)
+	defer s.Close()
+	assertPopulated(t, s)
+}
+
+func TestWALMetadataStoreTruncatedRecord(t *testing.T) {
+	dirname := t.TempDir()
+	s, err := CreateWALMetadataStore(WALConfiguration{Dirname: dirname})
+	assert.NoError(t, err)
+	populate(t, s)
+	assert.NoError(t, s.Close())
+
+	// A crash while appending a record leaves it incomplete
+	logFilenames, err := filepath.Glob(filepath.Join(dirname, walLogFilenamePrefix+"*"))
+	assert.NoError(t, err)
+	assert.Len(t, logFilenames, 1)
+	log, err := os.OpenFile(logFilenames[0], os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	_, err = log.Write([]byte{0, 0, 1, 0, 42, 42})
+	assert.NoError(t, err)
+	assert.NoError(t, log.Close())
+
+	s, err = CreateWALMetadataStore(WALConfiguration{Dirname: dirname})
+	assert.NoError(t, err)
+	assertPopulated(t, s)
+	assert.NoError(t, s.CreateOrUpdateModel(backend.ModelInfo{ModelID: "baz"}))
+	assert.NoError(t, s.Close())
+
+	s, err = CreateWALMetadataStore(WALConfiguration{Dirname: dirname})
+	assert.NoError(t, err)
+	defer s.Close()
+	hasModel, err := s.HasModel("baz")
+	assert.NoError(t, err)
+	assert.True(t, hasModel)
+}
@@ -0,0 +1,113 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lruCache
+
+import (
+	"container/list"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// Estimated size of an entry besides its data and user data, e.g. the version info fields and the list element
+const entryOverhead = 256
+
+type versionKey struct {
+	modelID       string
+	versionNumber uint
+}
+
+type entry struct {
+	key         versionKey
+	versionInfo backend.VersionInfo
+	data        []byte // Nil when only the info of the version is cached
+	size        int64
+}
+
+func createEntry(versionInfo backend.VersionInfo, data []byte) *entry {
+	size := int64(entryOverhead + len(versionInfo.ModelID) + len(versionInfo.DataHash) + len(data))
+	for key, value := range versionInfo.UserData {
+		size += int64(len(key) + len(value))
+	}
+	return &entry{
+		key:         versionKey{modelID: versionInfo.ModelID, versionNumber: versionInfo.VersionNumber},
+		versionInfo: versionInfo,
+		data:        data,
+		size:        size,
+	}
+}
+
+// lru is a least recently used set of entries whose total size is bounded, it isn't safe for concurrent use
+type lru struct {
+	maxBytes int64
+	bytes    int64
+	elements map[versionKey]*list.Element
+	order    *list.List // From the most to the least recently used entry
+}
+
+func createLRU(maxBytes int64) *lru {
+	return &lru{
+		maxBytes: maxBytes,
+		elements: make(map[versionKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get retrieves an entry and marks it as the most recently used
+func (c *lru) get(key versionKey) (*entry, bool) {
+	element, ok := c.elements[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*entry), true
+}
+
+// add adds or replaces an entry and evicts the least recently used ones beyond the maximum size, it returns the number
+// of evicted entries. Entries larger than the maximum size aren't added.
+func (c *lru) add(e *entry) int {
+	c.remove(e.key)
+	if e.size > c.maxBytes {
+		return 0
+	}
+	c.elements[e.key] = c.order.PushFront(e)
+	c.bytes += e.size
+	evictedEntries := 0
+	for c.bytes > c.maxBytes {
+		c.removeElement(c.order.Back())
+		evictedEntries++
+	}
+	return evictedEntries
+}
+
+func (c *lru) remove(key versionKey) {
+	if element, ok := c.elements[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+// removeModel removes the entries of every version of a model
+func (c *lru) removeModel(modelID string) {
+	for key, element := range c.elements {
+		if key.modelID == modelID {
+			c.removeElement(element)
+		}
+	}
+}
+
+func (c *lru) removeElement(element *list.Element) {
+	e := c.order.Remove(element).(*entry)
+	delete(c.elements, e.key)
+	c.bytes -= e.size
+}
@@ -0,0 +1,368 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lruCache
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// Metrics published by every LRU cache backend under `/debug/vars`
+var (
+	hitsMetric       = expvar.NewInt("lru_cache_hits")
+	missesMetric     = expvar.NewInt("lru_cache_misses")
+	evictionsMetric  = expvar.NewInt("lru_cache_evictions")
+	coalescingMetric = expvar.NewInt("lru_cache_coalesced_retrievals")
+)
+
+type Configuration struct {
+	MaxBytes int64 // Maximum total size of the cached versions, including their data, 0 only coalesces the retrievals
+}
+
+// flightKey identifies the retrievals of a version that can share the same read of the underlying backend
+type flightKey struct {
+	modelID       string
+	versionNumber int
+	generation    uint64 // The retrievals started after an invalidation don't join the ones started before
+}
+
+// flight is a retrieval from the underlying backend, its result is shared by every retrieval waiting for it
+type flight struct {
+	done  chan struct{}
+	ctx   context.Context // Context of the retrieval sharing its result, nil if it isn't bound to a context
+	entry *entry
+	err   error
+}
+
+// lruCacheState is shared by a cache backend and the views bound to a context
+type lruCacheState struct {
+	mutex sync.Mutex
+	cache *lru
+	// Version number of the latest version of the models, retrieving version -1 doesn't reach the underlying backend
+	latestVersionNumbers map[string]uint
+	// Incremented by every invalidation, the versions retrieved from the underlying backend across an invalidation
+	// aren't cached as they might be outdated
+	generation uint64
+	flights    map[flightKey]*flight
+}
+
+type lruCacheBackend struct {
+	*lruCacheState
+	backend backend.Backend
+	ctx     context.Context // Nil unless bound to a context
+}
+
+// CreateBackend creates a new backend keeping the recently retrieved versions, info and data, of another backend in memory
+//
+// The least recently used versions are evicted once their total size exceeds the configured maximum. Concurrent
+// retrievals of the data of a version that isn't cached share a single read of the underlying backend. A cached version
+// is invalidated when it is updated or deleted through the created backend, the changes made directly to the underlying
+// backend, e.g. by other instances sharing it, aren't seen. The retrieved data must not be modified. The underlying
+// backend is not destroyed with the created backend.
+func CreateBackend(b backend.Backend, configuration Configuration) (backend.Backend, error) {
+	return &lruCacheBackend{
+		lruCacheState: &lruCacheState{
+			cache:                createLRU(configuration.MaxBytes),
+			latestVersionNumbers: make(map[string]uint),
+			flights:              make(map[flightKey]*flight),
+		},
+		backend: b,
+	}, nil
+}
+
+func (b *lruCacheBackend) Destroy() {
+}
+
+// BindContext binds the underlying backend to the context, the bound view shares the cache
+func (b *lruCacheBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	boundBackend, ok := backend.BindContext(b.backend, ctx)
+	if !ok {
+		return nil, false
+	}
+	return &lruCacheBackend{lruCacheState: b.lruCacheState, backend: boundBackend, ctx: ctx}, true
+}
+
+func (b *lruCacheBackend) Ping() error {
+	return b.backend.Ping()
+}
+
+// lookup retrieves the cached entry of a version, or of the latest version with -1, requiring its data if withData is set
+//
+// It also returns the current generation, to be given to store if the version is retrieved from the underlying backend.
+func (b *lruCacheBackend) lookup(modelID string, versionNumber int, withData bool) (*entry, uint64, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	key := versionKey{modelID: modelID}
+	if versionNumber > 0 {
+		key.versionNumber = uint(versionNumber)
+	} else if latestVersionNumber, ok := b.latestVersionNumbers[modelID]; ok && versionNumber == -1 {
+		key.versionNumber = latestVersionNumber
+	} else {
+		missesMetric.Add(1)
+		return nil, b.generation, false
+	}
+	e, ok := b.cache.get(key)
+	if !ok || (withData && e.data == nil) {
+		missesMetric.Add(1)
+		return nil, b.generation, false
+	}
+	hitsMetric.Add(1)
+	return e, b.generation, true
+}
+
+// store caches a version retrieved as versionNumber from the underlying backend, unless an invalidation happened since
+// the given generation. A nil data keeps the data already cached, if any.
+func (b *lruCacheBackend) store(generation uint64, versionNumber int, versionInfo backend.VersionInfo, data []byte) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if generation != b.generation {
+		return
+	}
+	if data == nil {
+		if existingEntry, ok := b.cache.get(versionKey{modelID: versionInfo.ModelID, versionNumber: versionInfo.VersionNumber}); ok {
+			data = existingEntry.data
+		}
+	}
+	evictionsMetric.Add(int64(b.cache.add(createEntry(versionInfo, data))))
+	if versionNumber == -1 {
+		b.latestVersionNumbers[versionInfo.ModelID] = versionInfo.VersionNumber
+	}
+}
+
+// invalidateVersions removes versions of a model from the cache, they can't be cached by the pending retrievals either
+func (b *lruCacheBackend) invalidateVersions(modelID string, versionNumbers ...uint) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.generation++
+	for _, versionNumber := range versionNumbers {
+		b.cache.remove(versionKey{modelID: modelID, versionNumber: versionNumber})
+	}
+	delete(b.latestVersionNumbers, modelID)
+}
+
+// invalidateModel removes every version of a model from the cache
+func (b *lruCacheBackend) invalidateModel(modelID string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.generation++
+	b.cache.removeModel(modelID)
+	delete(b.latestVersionNumbers, modelID)
+}
+
+func copyVersionInfo(versionInfo backend.VersionInfo) backend.VersionInfo {
+	userData := make(map[string]string, len(versionInfo.UserData))
+	for key, value := range versionInfo.UserData {
+		userData[key] = value
+	}
+	versionInfo.UserData = userData
+	return versionInfo
+}
+
+func (b *lruCacheBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	return b.backend.CreateOrUpdateModel(modelArgs)
+}
+
+func (b *lruCacheBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	return b.backend.RetrieveModelInfo(modelID)
+}
+
+func (b *lruCacheBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	return b.backend.RetrieveModelLatestVersionNumber(modelID)
+}
+
+func (b *lruCacheBackend) HasModel(modelID string) (bool, error) {
+	return b.backend.HasModel(modelID)
+}
+
+func (b *lruCacheBackend) DeleteModel(modelID string) error {
+	defer b.invalidateModel(modelID)
+	return b.backend.DeleteModel(modelID)
+}
+
+func (b *lruCacheBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.backend.ListModels(offset, limit)
+}
+
+func (b *lruCacheBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.backend.QueryModels(filter, offset, limit)
+}
+
+func (b *lruCacheBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	versionInfo, err := b.backend.CreateOrUpdateModelVersion(modelID, versionArgs)
+	b.invalidateVersions(modelID, versionArgs.VersionNumber, versionInfo.VersionNumber)
+	return versionInfo, err
+}
+
+// versionDataWriter invalidates the written version once committed
+type versionDataWriter struct {
+	backend.VersionDataWriter
+	backend     *lruCacheBackend
+	modelID     string
+	versionArgs backend.VersionArgs
+}
+
+func (w *versionDataWriter) Commit() (backend.VersionInfo, error) {
+	versionInfo, err := w.VersionDataWriter.Commit()
+	w.backend.invalidateVersions(w.modelID, w.versionArgs.VersionNumber, versionInfo.VersionNumber)
+	return versionInfo, err
+}
+
+func (b *lruCacheBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	writer, err := b.backend.CreateOrUpdateModelVersionStream(modelID, versionArgs)
+	if err != nil {
+		return nil, err
+	}
+	return &versionDataWriter{VersionDataWriter: writer, backend: b, modelID: modelID, versionArgs: versionArgs}, nil
+}
+
+func (b *lruCacheBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	e, generation, ok := b.lookup(modelID, versionNumber, false)
+	if ok {
+		return copyVersionInfo(e.versionInfo), nil
+	}
+	versionInfo, err := b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	b.store(generation, versionNumber, copyVersionInfo(versionInfo), nil)
+	return versionInfo, nil
+}
+
+// retrieveVersion retrieves the cached info and data of a version, retrieving them from the underlying backend if needed
+func (b *lruCacheBackend) retrieveVersion(modelID string, versionNumber int) (*entry, error) {
+	e, generation, ok := b.lookup(modelID, versionNumber, true)
+	if ok {
+		return e, nil
+	}
+
+	key := flightKey{modelID: modelID, versionNumber: versionNumber, generation: generation}
+	b.mutex.Lock()
+	if f, ok := b.flights[key]; ok {
+		b.mutex.Unlock()
+		coalescingMetric.Add(1)
+		<-f.done
+		if backend.IsContextDone(f.ctx, f.err) {
+			// The shared retrieval was stopped by the end of its call, not by a failure of the backend
+			return b.retrieveVersion(modelID, versionNumber)
+		}
+		return f.entry, f.err
+	}
+	f := &flight{done: make(chan struct{}), ctx: b.ctx}
+	b.flights[key] = f
+	b.mutex.Unlock()
+
+	f.entry, f.err = b.retrieveUnderlyingVersion(modelID, versionNumber)
+	if f.err == nil {
+		b.store(generation, versionNumber, f.entry.versionInfo, f.entry.data)
+	}
+	b.mutex.Lock()
+	delete(b.flights, key)
+	b.mutex.Unlock()
+	close(f.done)
+	return f.entry, f.err
+}
+
+func (b *lruCacheBackend) retrieveUnderlyingVersion(modelID string, versionNumber int) (*entry, error) {
+	versionInfo, err := b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+	data, err := b.backend.RetrieveModelVersionData(modelID, int(versionInfo.VersionNumber))
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return nil, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return nil, err
+	}
+	return createEntry(copyVersionInfo(versionInfo), data), nil
+}
+
+func (b *lruCacheBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	e, err := b.retrieveVersion(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	return e.data, nil
+}
+
+// RetrieveModelVersionDataRange slices the cached data of a version, versions that aren't cached are only partially read
+// from the underlying backend and aren't cached
+func (b *lruCacheBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	e, _, ok := b.lookup(modelID, versionNumber, true)
+	if ok {
+		return backend.SliceDataRange(modelID, versionNumber, e.data, offset, length)
+	}
+	return b.backend.RetrieveModelVersionDataRange(modelID, versionNumber, offset, length)
+}
+
+// OpenModelVersionData reads the cached data of a version, versions that aren't cached are opened by the underlying
+// backend and aren't cached
+func (b *lruCacheBackend) OpenModelVersionData(modelID string, versionNumber int) (backend.VersionInfo, backend.VersionDataReader, bool, error) {
+	e, _, ok := b.lookup(modelID, versionNumber, true)
+	if ok {
+		return copyVersionInfo(e.versionInfo), backend.CreateBytesVersionDataReader(e.data), true, nil
+	}
+	return backend.OpenModelVersionData(b.backend, modelID, versionNumber)
+}
+
+// PresignModelVersionData presigns the URL of the data of a version stored by the underlying backend, cached or not
+func (b *lruCacheBackend) PresignModelVersionData(modelID string, versionNumber int, expiration time.Duration) (backend.VersionInfo, string, bool, error) {
+	return backend.PresignModelVersionData(b.backend, modelID, versionNumber, expiration)
+}
+
+func (b *lruCacheBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	versionInfo, err := b.backend.UpdateModelVersionArchived(modelID, versionNumber, archived)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	b.invalidateVersions(modelID, versionInfo.VersionNumber)
+	return versionInfo, nil
+}
+
+func (b *lruCacheBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	versionInfo, err := b.backend.UpdateModelVersionUserData(modelID, versionNumber, userData)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	b.invalidateVersions(modelID, versionInfo.VersionNumber)
+	return versionInfo, nil
+}
+
+func (b *lruCacheBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	if versionNumber > 0 {
+		defer b.invalidateVersions(modelID, uint(versionNumber))
+	} else {
+		// The deleted version is only known by the underlying backend
+		defer b.invalidateModel(modelID)
+	}
+	return b.backend.DeleteModelVersion(modelID, versionNumber)
+}
+
+func (b *lruCacheBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return b.backend.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+}
+
+func (b *lruCacheBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return b.backend.QueryModelVersionInfos(modelID, filter, initialVersionNumber, limit)
+}
+
+func (b *lruCacheBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return b.backend.RetrieveStorageCapacity()
+}
@@ -0,0 +1,285 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lruCache
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuiteLRUCacheBackend(t *testing.T) {
+	underlyingBackends := make(map[backend.Backend]backend.Backend)
+	test.RunSuite(t, func() backend.Backend {
+		underlyingBackend, err := fs.CreateBackend(t.TempDir())
+		assert.NoError(t, err)
+		b, err := CreateBackend(underlyingBackend, Configuration{MaxBytes: 1024 * 1024})
+		assert.NoError(t, err)
+		underlyingBackends[b] = underlyingBackend
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+		underlyingBackends[b].Destroy()
+		delete(underlyingBackends, b)
+	})
+}
+
+// countingBackend counts the version data retrievals reaching a backend, they wait for the gate to be open if defined
+type countingBackend struct {
+	backend.Backend
+	dataRetrievals int64
+	gate           chan struct{}
+}
+
+func (b *countingBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	atomic.AddInt64(&b.dataRetrievals, 1)
+	if b.gate != nil {
+		<-b.gate
+	}
+	return b.Backend.RetrieveModelVersionData(modelID, versionNumber)
+}
+
+func createCountingBackend(t *testing.T, maxBytes int64) (*countingBackend, backend.Backend) {
+	underlyingBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(underlyingBackend.Destroy)
+	counting := &countingBackend{Backend: underlyingBackend}
+	b, err := CreateBackend(counting, Configuration{MaxBytes: maxBytes})
+	assert.NoError(t, err)
+	t.Cleanup(b.Destroy)
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	return counting, b
+}
+
+func createVersion(t *testing.T, b backend.Backend, versionNumber uint, data []byte) {
+	_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+		VersionNumber: versionNumber,
+		Archived:      true,
+		DataHash:      backend.ComputeSHA256Hash(data),
+		Data:          data,
+	})
+	assert.NoError(t, err)
+}
+
+func TestCachedRetrievals(t *testing.T) {
+	counting, b := createCountingBackend(t, 1024*1024)
+	createVersion(t, b, 0, test.Data1)
+
+	for i := 0; i < 10; i++ {
+		data, err := b.RetrieveModelVersionData("foo", -1)
+		assert.NoError(t, err)
+		assert.Equal(t, test.Data1, data)
+		data, err = b.RetrieveModelVersionData("foo", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, test.Data1, data)
+	}
+	assert.Equal(t, int64(1), counting.dataRetrievals)
+
+	dataRange, err := b.RetrieveModelVersionDataRange("foo", -1, 6, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ipsum"), dataRange)
+	assert.Equal(t, int64(1), counting.dataRetrievals)
+
+	// Creating a version changes the latest one
+	createVersion(t, b, 0, test.Data2)
+	data, err := b.RetrieveModelVersionData("foo", -1)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data2, data)
+	assert.Equal(t, int64(2), counting.dataRetrievals)
+
+	// The returned info can be modified without changing the cached one
+	versionInfo, err := b.RetrieveModelVersionInfo("foo", 2)
+	assert.NoError(t, err)
+	versionInfo.UserData["foo"] = "bar"
+	versionInfo, err = b.RetrieveModelVersionInfo("foo", 2)
+	assert.NoError(t, err)
+	assert.Empty(t, versionInfo.UserData)
+}
+
+func TestInvalidation(t *testing.T) {
+	counting, b := createCountingBackend(t, 1024*1024)
+	createVersion(t, b, 0, test.Data1)
+	createVersion(t, b, 0, test.Data1)
+
+	_, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	createVersion(t, b, 1, test.Data2)
+	data, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data2, data)
+
+	versionInfo, err := b.UpdateModelVersionArchived("foo", 1, false)
+	assert.NoError(t, err)
+	assert.False(t, versionInfo.Archived)
+	versionInfo, err = b.RetrieveModelVersionInfo("foo", 1)
+	assert.NoError(t, err)
+	assert.False(t, versionInfo.Archived)
+
+	_, err = b.RetrieveModelVersionData("foo", -1)
+	assert.NoError(t, err)
+	assert.NoError(t, b.DeleteModelVersion("foo", -1))
+	versionInfo, err = b.RetrieveModelVersionInfo("foo", -1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+
+	assert.NoError(t, b.DeleteModelVersion("foo", 1))
+	_, err = b.RetrieveModelVersionData("foo", 1)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+
+	createVersion(t, b, 0, test.Data1)
+	_, err = b.RetrieveModelVersionData("foo", -1)
+	assert.NoError(t, err)
+	assert.NoError(t, b.DeleteModel("foo"))
+	_, err = b.RetrieveModelVersionData("foo", -1)
+	assert.IsType(t, &backend.UnknownModelError{}, err)
+	assert.Equal(t, int64(4), counting.dataRetrievals)
+}
+
+func TestEviction(t *testing.T) {
+	// Room for a single version
+	maxBytes := int64(len(test.Data1) + 2*entryOverhead)
+	counting, b := createCountingBackend(t, maxBytes)
+	createVersion(t, b, 0, test.Data1)
+	createVersion(t, b, 0, test.Data1)
+
+	for _, versionNumber := range []int{1, 1, 2, 2, 1} {
+		data, err := b.RetrieveModelVersionData("foo", versionNumber)
+		assert.NoError(t, err)
+		assert.Equal(t, test.Data1, data)
+	}
+	assert.Equal(t, int64(3), counting.dataRetrievals)
+
+	// Versions larger than the cache aren't cached
+	_, b = createCountingBackend(t, 16)
+	createVersion(t, b, 0, test.Data1)
+	data, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data1, data)
+}
+
+func TestCoalescedRetrievals(t *testing.T) {
+	// Nothing is cached, only the concurrent retrievals share a read
+	counting, b := createCountingBackend(t, 0)
+	createVersion(t, b, 0, test.Data1)
+	counting.gate = make(chan struct{})
+
+	coalescedRetrievals := coalescingMetric.Value()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := b.RetrieveModelVersionData("foo", -1)
+			assert.NoError(t, err)
+			assert.Equal(t, test.Data1, data)
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		return coalescingMetric.Value()-coalescedRetrievals == 9
+	}, time.Second, time.Millisecond)
+	close(counting.gate)
+	wg.Wait()
+	assert.Equal(t, int64(1), atomic.LoadInt64(&counting.dataRetrievals))
+
+	_, err := b.RetrieveModelVersionData("foo", -1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&counting.dataRetrievals))
+}
+
+func TestCoalescedRetrievalsAfterInvalidation(t *testing.T) {
+	counting, b := createCountingBackend(t, 1024*1024)
+	createVersion(t, b, 0, test.Data1)
+	counting.gate = make(chan struct{})
+
+	retrieved := make(chan []byte)
+	go func() {
+		data, err := b.RetrieveModelVersionData("foo", -1)
+		assert.NoError(t, err)
+		retrieved <- data
+	}()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&counting.dataRetrievals) == 1
+	}, time.Second, time.Millisecond)
+
+	// A retrieval started after the creation of a version doesn't join the pending one
+	createVersion(t, b, 0, test.Data2)
+	go func() {
+		data, err := b.RetrieveModelVersionData("foo", -1)
+		assert.NoError(t, err)
+		retrieved <- data
+	}()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&counting.dataRetrievals) == 2
+	}, time.Second, time.Millisecond)
+	close(counting.gate)
+	assert.ElementsMatch(t, [][]byte{test.Data1, test.Data2}, [][]byte{<-retrieved, <-retrieved})
+
+	data, err := b.RetrieveModelVersionData("foo", -1)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data2, data)
+}
+
+func TestOpenModelVersionData(t *testing.T) {
+	underlyingBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer underlyingBackend.Destroy()
+	b, err := CreateBackend(underlyingBackend, Configuration{MaxBytes: 1024 * 1024})
+	assert.NoError(t, err)
+	defer b.Destroy()
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	createVersion(t, b, 0, test.Data1)
+
+	readAll := func(reader backend.VersionDataReader, dataSize int) []byte {
+		data := make([]byte, dataSize)
+		n, err := reader.ReadAt(data, 0)
+		assert.True(t, err == nil || err == io.EOF)
+		return data[:n]
+	}
+
+	// Versions that aren't cached are opened by the underlying backend
+	versionInfo, reader, opened, err := backend.OpenModelVersionData(b, "foo", 1)
+	assert.NoError(t, err)
+	assert.True(t, opened)
+	assert.IsType(t, &os.File{}, reader)
+	assert.Equal(t, test.Data1, readAll(reader, versionInfo.DataSize))
+	assert.NoError(t, reader.Close())
+
+	// Once cached, they are read from memory
+	_, err = b.RetrieveModelVersionData("foo", -1)
+	assert.NoError(t, err)
+	versionInfo, reader, opened, err = backend.OpenModelVersionData(b, "foo", -1)
+	assert.NoError(t, err)
+	assert.True(t, opened)
+	_, isFile := reader.(*os.File)
+	assert.False(t, isFile)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	assert.Equal(t, test.Data1, readAll(reader, versionInfo.DataSize))
+	assert.NoError(t, reader.Close())
+
+	// Backends that can't open the data of their versions are reported as such
+	_, _, opened, err = backend.OpenModelVersionData(&countingBackend{Backend: underlyingBackend}, "foo", 1)
+	assert.NoError(t, err)
+	assert.False(t, opened)
+}
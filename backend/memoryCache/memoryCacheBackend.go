@@ -16,7 +16,9 @@ package memoryCache
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -33,14 +35,21 @@ var DefaultVersionCacheConfiguration = VersionCacheConfiguration{
 	MaxItems: 100,
 }
 
-type memoryCacheBackend struct {
-	archive                        backend.Backend
+// memoryCacheState is shared by a cache backend and the views bound to a context
+type memoryCacheState struct {
 	modelsLatestVersionNumberMutex sync.RWMutex
 	modelsLatestVersionNumber      map[string]uint
+	reservedVersionNumbers         map[string]uint // Highest version number handed out to a creation not yet completed, per model
+	numberingLocks                 backend.ModelLocks
 	versionCache                   *lru.Cache
 	versionCacheConfiguration      VersionCacheConfiguration
 }
 
+type memoryCacheBackend struct {
+	*memoryCacheState
+	archive backend.Backend
+}
+
 type cachedVersion struct {
 	ModelID           string
 	VersionNumber     uint
@@ -91,11 +100,13 @@ func CreateBackend(versionCacheConfiguration VersionCacheConfiguration, archive
 		return nil, fmt.Errorf("unable to create memory cache backend: %w", err)
 	}
 	b := memoryCacheBackend{
-		archive:                        archive,
-		modelsLatestVersionNumberMutex: sync.RWMutex{},
-		modelsLatestVersionNumber:      make(map[string]uint),
-		versionCache:                   cache,
-		versionCacheConfiguration:      versionCacheConfiguration,
+		memoryCacheState: &memoryCacheState{
+			modelsLatestVersionNumber: make(map[string]uint),
+			reservedVersionNumbers:    make(map[string]uint),
+			versionCache:              cache,
+			versionCacheConfiguration: versionCacheConfiguration,
+		},
+		archive: archive,
 	}
 	return &b, nil
 
@@ -104,6 +115,19 @@ func CreateBackend(versionCacheConfiguration VersionCacheConfiguration, archive
 func (b *memoryCacheBackend) Destroy() {
 }
 
+// BindContext binds the archive backend to the context, the bound view shares the cache
+func (b *memoryCacheBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	boundArchive, ok := backend.BindContext(b.archive, ctx)
+	if !ok {
+		return nil, false
+	}
+	return &memoryCacheBackend{memoryCacheState: b.memoryCacheState, archive: boundArchive}, true
+}
+
+func (b *memoryCacheBackend) Ping() error {
+	return b.archive.Ping()
+}
+
 func (b *memoryCacheBackend) retrieveCachedModelLatestVersionNumber(modelID string) (uint, bool) {
 	b.modelsLatestVersionNumberMutex.RLock()
 	defer b.modelsLatestVersionNumberMutex.RUnlock()
@@ -125,12 +149,45 @@ func (b *memoryCacheBackend) updateCachedModelLatestVersionNumber(modelID string
 	if !ok || latestVersionNumber < versionNumber {
 		b.modelsLatestVersionNumberMutex.Lock()
 		defer b.modelsLatestVersionNumberMutex.Unlock()
-		b.modelsLatestVersionNumber[modelID] = versionNumber
-		return versionNumber
+		// Checked again, another update might have happened in between
+		latestVersionNumber, ok = b.modelsLatestVersionNumber[modelID]
+		if !ok || latestVersionNumber < versionNumber {
+			b.modelsLatestVersionNumber[modelID] = versionNumber
+			return versionNumber
+		}
 	}
 	return latestVersionNumber
 }
 
+// reserveVersionNumber hands out the number of a new version of a model, concurrent creations never get the same number
+func (b *memoryCacheBackend) reserveVersionNumber(modelID string) (uint, error) {
+	unlock := b.numberingLocks.Lock(modelID)
+	defer unlock()
+	resolvedVersionNumbers, err := b.resolveModelVersionNumbers(modelID, []int{-1})
+	if err != nil {
+		return 0, err
+	}
+	b.modelsLatestVersionNumberMutex.Lock()
+	defer b.modelsLatestVersionNumberMutex.Unlock()
+	versionNumber := resolvedVersionNumbers[0] + 1
+	if reservedVersionNumber := b.reservedVersionNumbers[modelID]; reservedVersionNumber >= versionNumber {
+		versionNumber = reservedVersionNumber + 1
+	}
+	b.reservedVersionNumbers[modelID] = versionNumber
+	return versionNumber, nil
+}
+
+// releaseVersionNumber ends the reservation of a version number once its creation completed or failed
+//
+// Only the last reservation is released, a failed creation followed by another one leaves a gap in the numbering.
+func (b *memoryCacheBackend) releaseVersionNumber(modelID string, versionNumber uint) {
+	b.modelsLatestVersionNumberMutex.Lock()
+	defer b.modelsLatestVersionNumberMutex.Unlock()
+	if b.reservedVersionNumbers[modelID] == versionNumber {
+		delete(b.reservedVersionNumbers, modelID)
+	}
+}
+
 func (b *memoryCacheBackend) resolveModelVersionNumbers(modelID string, versionNumbers []int) ([]uint, error) {
 	resolvedVersionNumbers := []uint{}
 	latestVersionNumber := uint(0) // We might not need it
@@ -199,11 +256,12 @@ func (b *memoryCacheBackend) RetrieveModelInfo(modelID string) (backend.ModelInf
 }
 
 func (b *memoryCacheBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
-	versionsCount, err := b.archive.RetrieveModelLatestVersionNumber(modelID)
-	if err == nil {
-		b.updateCachedModelLatestVersionNumber(modelID, versionsCount)
+	// The non-archived versions are only known by the cache
+	resolvedVersionNumbers, err := b.resolveModelVersionNumbers(modelID, []int{-1})
+	if err != nil {
+		return 0, err
 	}
-	return versionsCount, err
+	return resolvedVersionNumbers[0], nil
 }
 
 func (b *memoryCacheBackend) DeleteModel(modelID string) error {
@@ -212,6 +270,9 @@ func (b *memoryCacheBackend) DeleteModel(modelID string) error {
 		return err
 	}
 	b.deleteCachedModelLatestVersionNumber(modelID, func(uint) bool { return true })
+	b.modelsLatestVersionNumberMutex.Lock()
+	delete(b.reservedVersionNumbers, modelID)
+	b.modelsLatestVersionNumberMutex.Unlock()
 	b.deleteModelVersions(modelID)
 	return nil
 }
@@ -220,6 +281,10 @@ func (b *memoryCacheBackend) ListModels(offset int, limit int) ([]backend.ModelI
 	return b.archive.ListModels(offset, limit)
 }
 
+func (b *memoryCacheBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.archive.QueryModels(filter, offset, limit)
+}
+
 func (b *memoryCacheBackend) retrieveCachedModelVersion(modelID string, versionNumber uint) (cachedVersion, bool) {
 	// Is the version cached?
 	key := memoryCacheKey{modelID: modelID, versionNumber: versionNumber}
@@ -243,11 +308,13 @@ func (b *memoryCacheBackend) deleteCachedModelVersion(modelID string, versionNum
 func (b *memoryCacheBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
 	// Let's compute the actual version number
 	if versionArgs.VersionNumber == uint(0) {
-		resolvedVersionNumbers, err := b.resolveModelVersionNumbers(modelID, []int{-1})
+		versionNumber, err := b.reserveVersionNumber(modelID)
 		if err != nil {
 			return backend.VersionInfo{}, err
 		}
-		versionArgs.VersionNumber = resolvedVersionNumbers[0] + 1
+		// Released once the latest version number is updated, or on failure
+		defer b.releaseVersionNumber(modelID, versionNumber)
+		versionArgs.VersionNumber = versionNumber
 	}
 
 	var versionInfo backend.VersionInfo
@@ -283,6 +350,60 @@ func (b *memoryCacheBackend) CreateOrUpdateModelVersion(modelID string, versionA
 	return versionInfo, nil
 }
 
+type archivedVersionDataWriter struct {
+	backend.VersionDataWriter
+	cacheBackend          *memoryCacheBackend
+	modelID               string
+	reservedVersionNumber uint // 0 if the version number was provided
+}
+
+func (w *archivedVersionDataWriter) Commit() (backend.VersionInfo, error) {
+	defer w.cacheBackend.releaseVersionNumber(w.modelID, w.reservedVersionNumber)
+	versionInfo, err := w.VersionDataWriter.Commit()
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	// The data is not added to the cache, it'll be on its first retrieval
+	w.cacheBackend.deleteCachedModelVersion(w.modelID, versionInfo.VersionNumber)
+	w.cacheBackend.updateCachedModelLatestVersionNumber(w.modelID, versionInfo.VersionNumber)
+	return versionInfo, nil
+}
+
+func (w *archivedVersionDataWriter) Abort() error {
+	defer w.cacheBackend.releaseVersionNumber(w.modelID, w.reservedVersionNumber)
+	return w.VersionDataWriter.Abort()
+}
+
+// CreateOrUpdateModelVersionStream streams archived versions directly to the archive backend, transient versions are accumulated in memory
+func (b *memoryCacheBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	if !versionArgs.Archived {
+		return backend.CreateBufferedVersionDataWriter(b, modelID, versionArgs), nil
+	}
+
+	// Let's compute the actual version number
+	reservedVersionNumber := uint(0)
+	if versionArgs.VersionNumber == uint(0) {
+		versionNumber, err := b.reserveVersionNumber(modelID)
+		if err != nil {
+			return nil, err
+		}
+		reservedVersionNumber = versionNumber
+		versionArgs.VersionNumber = versionNumber
+	}
+
+	archiveWriter, err := b.archive.CreateOrUpdateModelVersionStream(modelID, versionArgs)
+	if err != nil {
+		b.releaseVersionNumber(modelID, reservedVersionNumber)
+		return nil, err
+	}
+	return &archivedVersionDataWriter{
+		VersionDataWriter:     archiveWriter,
+		cacheBackend:          b,
+		modelID:               modelID,
+		reservedVersionNumber: reservedVersionNumber,
+	}, nil
+}
+
 func (b *memoryCacheBackend) doRetrieveModelVersionData(modelID string, versionNumber uint) ([]byte, error) {
 	// Is the version cached?
 	version, versionInCache := b.retrieveCachedModelVersion(modelID, versionNumber)
@@ -310,6 +431,68 @@ func (b *memoryCacheBackend) doRetrieveModelVersionData(modelID string, versionN
 	return versionData, nil
 }
 
+// RetrieveModelVersionDataRange retrieves a range of a given model version data, it isn't cached when retrieved from the archive
+func (b *memoryCacheBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	resolvedVersionNumbers, err := b.resolveModelVersionNumbers(modelID, []int{versionNumber})
+	if err != nil {
+		return nil, err
+	}
+	resolvedVersionNumber := resolvedVersionNumbers[0]
+	if resolvedVersionNumber == 0 {
+		return nil, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	version, versionInCache := b.retrieveCachedModelVersion(modelID, resolvedVersionNumber)
+	if versionInCache {
+		return backend.SliceDataRange(modelID, versionNumber, version.Data, offset, length)
+	}
+	return b.archive.RetrieveModelVersionDataRange(modelID, int(resolvedVersionNumber), offset, length)
+}
+
+// OpenModelVersionData reads the cached data of a version, versions that aren't cached are opened by the archive
+// backend and aren't cached
+func (b *memoryCacheBackend) OpenModelVersionData(modelID string, versionNumber int) (backend.VersionInfo, backend.VersionDataReader, bool, error) {
+	resolvedVersionNumbers, err := b.resolveModelVersionNumbers(modelID, []int{versionNumber})
+	if err != nil {
+		return backend.VersionInfo{}, nil, false, err
+	}
+	resolvedVersionNumber := resolvedVersionNumbers[0]
+	if resolvedVersionNumber == 0 {
+		return backend.VersionInfo{}, nil, false, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	version, versionInCache := b.retrieveCachedModelVersion(modelID, resolvedVersionNumber)
+	if versionInCache {
+		versionInfo := backend.VersionInfo{
+			ModelID:           modelID,
+			VersionNumber:     resolvedVersionNumber,
+			CreationTimestamp: version.CreationTimestamp,
+			Archived:          version.Archived,
+			DataHash:          version.DataHash,
+			DataSize:          len(version.Data),
+			UserData:          version.UserData,
+		}
+		return versionInfo, backend.CreateBytesVersionDataReader(version.Data), true, nil
+	}
+	return backend.OpenModelVersionData(b.archive, modelID, int(resolvedVersionNumber))
+}
+
+// PresignModelVersionData presigns the URL of the data of a version stored by the archive backend, non-archived
+// versions are only held in memory and can't be presigned
+func (b *memoryCacheBackend) PresignModelVersionData(modelID string, versionNumber int, expiration time.Duration) (backend.VersionInfo, string, bool, error) {
+	resolvedVersionNumbers, err := b.resolveModelVersionNumbers(modelID, []int{versionNumber})
+	if err != nil {
+		return backend.VersionInfo{}, "", false, err
+	}
+	resolvedVersionNumber := resolvedVersionNumbers[0]
+	if resolvedVersionNumber == 0 {
+		return backend.VersionInfo{}, "", false, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	version, versionInCache := b.retrieveCachedModelVersion(modelID, resolvedVersionNumber)
+	if versionInCache && !version.Archived {
+		return backend.VersionInfo{}, "", false, nil
+	}
+	return backend.PresignModelVersionData(b.archive, modelID, int(resolvedVersionNumber), expiration)
+}
+
 func (b *memoryCacheBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
 	resolvedVersionNumbers, err := b.resolveModelVersionNumbers(modelID, []int{versionNumber})
 	if err != nil {
@@ -355,7 +538,7 @@ func (b *memoryCacheBackend) RetrieveModelVersionInfo(modelID string, versionNum
 	}
 	versionInfo, err := b.doRetrieveModelVersionInfo(modelID, resolvedVersionNumber)
 	if err != nil {
-		if _, ok := err.(*backend.UnknownModelVersionError); ok {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
 			// Sending an error with the unresolved versionNumber for it to make sense to the user
 			return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
 		}
@@ -364,9 +547,103 @@ func (b *memoryCacheBackend) RetrieveModelVersionInfo(modelID string, versionNum
 	return versionInfo, nil
 }
 
+// UpdateModelVersionArchived changes whether a given model version is archived, archiving a version only held by the cache stores it in the archive
+func (b *memoryCacheBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	resolvedVersionNumbers, err := b.resolveModelVersionNumbers(modelID, []int{versionNumber})
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	resolvedVersionNumber := resolvedVersionNumbers[0]
+	if resolvedVersionNumber == 0 {
+		return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	version, versionInCache := b.retrieveCachedModelVersion(modelID, resolvedVersionNumber)
+	versionInfo, err := b.archive.UpdateModelVersionArchived(modelID, int(resolvedVersionNumber), archived)
+	if err != nil {
+		notFound := errors.As(err, new(*backend.UnknownModelVersionError))
+		if !notFound || !versionInCache {
+			if notFound {
+				return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+			}
+			return backend.VersionInfo{}, err
+		}
+		// Non-archived versions are only stored in the cache
+		versionArgs := backend.VersionArgs{
+			VersionNumber:     resolvedVersionNumber,
+			CreationTimestamp: version.CreationTimestamp,
+			Archived:          archived,
+			DataHash:          version.DataHash,
+			Data:              version.Data,
+			UserData:          version.UserData,
+		}
+		if archived {
+			versionInfo, err = b.archive.CreateOrUpdateModelVersion(modelID, versionArgs)
+			if err != nil {
+				return backend.VersionInfo{}, err
+			}
+		} else {
+			versionInfo = backend.VersionInfo{
+				ModelID:           modelID,
+				VersionNumber:     resolvedVersionNumber,
+				CreationTimestamp: version.CreationTimestamp,
+				Archived:          archived,
+				DataHash:          version.DataHash,
+				DataSize:          len(version.Data),
+				UserData:          version.UserData,
+			}
+		}
+	}
+	if versionInCache {
+		version.Archived = archived
+		b.updateCachedModelVersion(modelID, resolvedVersionNumber, version)
+	}
+	return versionInfo, nil
+}
+
+// UpdateModelVersionUserData replaces the user data of a given model version, a version only held by the cache is only updated there
+func (b *memoryCacheBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	resolvedVersionNumbers, err := b.resolveModelVersionNumbers(modelID, []int{versionNumber})
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	resolvedVersionNumber := resolvedVersionNumbers[0]
+	if resolvedVersionNumber == 0 {
+		return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	version, versionInCache := b.retrieveCachedModelVersion(modelID, resolvedVersionNumber)
+	versionInfo, err := b.archive.UpdateModelVersionUserData(modelID, int(resolvedVersionNumber), userData)
+	if err != nil {
+		notFound := errors.As(err, new(*backend.UnknownModelVersionError))
+		if !notFound || !versionInCache {
+			if notFound {
+				return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+			}
+			return backend.VersionInfo{}, err
+		}
+		// Non-archived versions are only stored in the cache
+		versionInfo = backend.VersionInfo{
+			ModelID:           modelID,
+			VersionNumber:     resolvedVersionNumber,
+			CreationTimestamp: version.CreationTimestamp,
+			Archived:          version.Archived,
+			DataHash:          version.DataHash,
+			DataSize:          len(version.Data),
+			UserData:          userData,
+		}
+	}
+	if versionInCache {
+		version.UserData = userData
+		b.updateCachedModelVersion(modelID, resolvedVersionNumber, version)
+	}
+	return versionInfo, nil
+}
+
 func (b *memoryCacheBackend) doDeleteModelVersion(modelID string, versionNumber uint) error {
-	// Delete from the archive model ignoring any error here
-	_ = b.archive.DeleteModelVersion(modelID, int(versionNumber))
+	// Delete from the archive model, its error is ignored unless the version isn't cached either
+	err := b.archive.DeleteModelVersion(modelID, int(versionNumber))
+	if _, cached := b.retrieveCachedModelVersion(modelID, versionNumber); err != nil && !cached {
+		return err
+	}
 	b.deleteCachedModelVersion(modelID, versionNumber)
 	// Delete the latest version number if it became "dirty"
 	b.deleteCachedModelLatestVersionNumber(modelID, func(latestVersionNumber uint) bool { return versionNumber >= latestVersionNumber })
@@ -397,7 +674,7 @@ func (b *memoryCacheBackend) ListModelVersionInfos(modelID string, initialVersio
 		versionInfo, err := b.RetrieveModelVersionInfo(modelID, int(versionNumber))
 		if err != nil {
 			// skip the version if it is unknown.
-			if _, ok := err.(*backend.UnknownModelVersionError); ok {
+			if errors.As(err, new(*backend.UnknownModelVersionError)) {
 				continue
 			}
 			return []backend.VersionInfo{}, err
@@ -409,3 +686,13 @@ func (b *memoryCacheBackend) ListModelVersionInfos(modelID string, initialVersio
 	}
 	return versions, nil
 }
+
+// QueryModelVersionInfos lists the versions selected by the filter ordered by version number from the given initial version number, it returns at most the given limit number of versions
+func (b *memoryCacheBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return backend.QueryModelVersionInfosByListing(b, modelID, filter, initialVersionNumber, limit)
+}
+
+// RetrieveStorageCapacity retrieves the capacity of the archive, the cache being bounded by its configuration
+func (b *memoryCacheBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return b.archive.RetrieveStorageCapacity()
+}
@@ -15,6 +15,7 @@
 package memoryCache
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -129,3 +130,77 @@ func TestModelAddedInArchiveBackend(t *testing.T) {
 	assert.Equal(t, 1, int(versionInfo.VersionNumber))
 	assert.Equal(t, data1Hash, versionInfo.DataHash)
 }
+
+func TestConcurrentVersionCreations(t *testing.T) {
+	fsBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer fsBackend.Destroy()
+
+	b, err := CreateBackend(DefaultVersionCacheConfiguration, fsBackend)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+
+	// Transient versions, archived versions and archived streams are mixed
+	versionsCount := 30
+	versionNumbers := make(chan uint, versionsCount)
+	wg := sync.WaitGroup{}
+	for i := 0; i < versionsCount; i++ {
+		wg.Add(1)
+		go func(kind int) {
+			defer wg.Done()
+			var versionInfo backend.VersionInfo
+			var err error
+			switch kind {
+			case 0:
+				writer, err := b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{Archived: true})
+				assert.NoError(t, err)
+				_, err = writer.Write(test.Data1)
+				assert.NoError(t, err)
+				versionInfo, err = writer.Commit()
+				assert.NoError(t, err)
+			default:
+				versionInfo, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Archived: kind == 1, DataHash: backend.ComputeSHA256Hash(test.Data1), Data: test.Data1})
+				assert.NoError(t, err)
+			}
+			versionNumbers <- versionInfo.VersionNumber
+		}(i % 3)
+	}
+	wg.Wait()
+	close(versionNumbers)
+
+	// Every version got its own number
+	seenVersionNumbers := map[uint]bool{}
+	for versionNumber := range versionNumbers {
+		assert.False(t, seenVersionNumbers[versionNumber])
+		seenVersionNumbers[versionNumber] = true
+	}
+	assert.Len(t, seenVersionNumbers, versionsCount)
+	versionInfo, err := b.RetrieveModelVersionInfo("foo", -1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(versionsCount), versionInfo.VersionNumber)
+}
+
+func TestAbortedVersionCreation(t *testing.T) {
+	fsBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer fsBackend.Destroy()
+
+	b, err := CreateBackend(DefaultVersionCacheConfiguration, fsBackend)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+
+	// An aborted creation doesn't leave a gap behind
+	writer, err := b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{Archived: true})
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Abort())
+
+	versionInfo, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Archived: false, DataHash: backend.ComputeSHA256Hash(test.Data1), Data: test.Data1})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Middleware wraps a backend in a layer adding a cross-cutting behavior, e.g. a cache or retries
+type Middleware func(b Backend) (Backend, error)
+
+// Chain wraps a backend in the middlewares, the first one being the outermost layer
+func Chain(b Backend, middlewares ...Middleware) (Backend, error) {
+	for index := len(middlewares) - 1; index >= 0; index-- {
+		var err error
+		b, err = middlewares[index](b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// MiddlewareFactory creates a middleware from the settings of the registry or of a tenant
+type MiddlewareFactory func(settings Settings) (Middleware, error)
+
+var (
+	middlewareFactoriesMutex sync.RWMutex
+	middlewareFactories      = make(map[string]MiddlewareFactory)
+)
+
+// RegisterMiddleware makes a middleware available under a name in the stack expressions, it panics if the name is
+// already registered
+func RegisterMiddleware(name string, factory MiddlewareFactory) {
+	middlewareFactoriesMutex.Lock()
+	defer middlewareFactoriesMutex.Unlock()
+	if !middlewareNameRegexp.MatchString(name) {
+		panic(fmt.Sprintf("invalid middleware name %q", name))
+	}
+	if _, ok := middlewareFactories[name]; ok {
+		panic(fmt.Sprintf("middleware %q is already registered", name))
+	}
+	middlewareFactories[name] = factory
+}
+
+// RegisteredMiddlewares returns the sorted names of the registered middlewares
+func RegisteredMiddlewares() []string {
+	middlewareFactoriesMutex.RLock()
+	defer middlewareFactoriesMutex.RUnlock()
+	names := make([]string, 0, len(middlewareFactories))
+	for name := range middlewareFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UnknownMiddlewareError is raised when trying to create a middleware that isn't registered
+type UnknownMiddlewareError struct {
+	Name string
+}
+
+func (e *UnknownMiddlewareError) Error() string {
+	names := RegisteredMiddlewares()
+	for index, name := range names {
+		names[index] = fmt.Sprintf("%q", name)
+	}
+	return fmt.Sprintf("unknown backend middleware %q, expecting %s", e.Name, strings.Join(names, ", "))
+}
+
+// CreateMiddleware creates a middleware with the factory registered under its name
+func CreateMiddleware(name string, settings Settings) (Middleware, error) {
+	middlewareFactoriesMutex.RLock()
+	factory, ok := middlewareFactories[name]
+	middlewareFactoriesMutex.RUnlock()
+	if !ok {
+		return nil, &UnknownMiddlewareError{Name: name}
+	}
+	middleware, err := factory(settings)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the %q backend middleware: %w", name, err)
+	}
+	return middleware, nil
+}
+
+var middlewareNameRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// ParseStack parses a stack expression, e.g. "cache(retry(s3://bucket/prefix))", in the names of its middlewares,
+// the outermost first, and the URI of the backend they wrap
+func ParseStack(expression string) ([]string, string, error) {
+	names := []string{}
+	uri := strings.TrimSpace(expression)
+	for {
+		openingIndex := strings.Index(uri, "(")
+		if openingIndex < 0 || !middlewareNameRegexp.MatchString(strings.TrimSpace(uri[:openingIndex])) {
+			break
+		}
+		if !strings.HasSuffix(uri, ")") {
+			return nil, "", fmt.Errorf("unable to parse the backend stack %q: missing closing parenthesis", expression)
+		}
+		names = append(names, strings.TrimSpace(uri[:openingIndex]))
+		uri = strings.TrimSpace(uri[openingIndex+1 : len(uri)-1])
+	}
+	if uri == "" {
+		return nil, "", fmt.Errorf("unable to parse the backend stack %q: missing backend", expression)
+	}
+	return names, uri, nil
+}
+
+// CreateStack creates the backend of a stack expression wrapped in its middlewares
+//
+// The backend is returned along with the stack, the middlewares don't destroy the backend they wrap.
+func CreateStack(expression string, settings Settings) (Backend, Backend, error) {
+	names, uri, err := ParseStack(expression)
+	if err != nil {
+		return nil, nil, err
+	}
+	middlewares := make([]Middleware, 0, len(names))
+	for _, name := range names {
+		middleware, err := CreateMiddleware(name, settings)
+		if err != nil {
+			return nil, nil, err
+		}
+		middlewares = append(middlewares, middleware)
+	}
+	b, err := Create(uri, settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	stack, err := Chain(b, middlewares...)
+	if err != nil {
+		b.Destroy()
+		return nil, nil, err
+	}
+	return stack, b, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import "sync"
+
+// ModelLocks serializes the operations made on each model while letting the ones on different models run concurrently
+//
+// The zero value is ready to use. The mutex of a model is only kept while it is locked or awaited.
+type ModelLocks struct {
+	mutex sync.Mutex
+	locks map[string]*modelLock
+}
+
+type modelLock struct {
+	mutex      sync.Mutex
+	references int // Holder and waiters of the lock
+}
+
+// Lock waits for the operations on a model to complete, the returned function must be called to unlock it
+func (l *ModelLocks) Lock(modelID string) func() {
+	l.mutex.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*modelLock)
+	}
+	lock, ok := l.locks[modelID]
+	if !ok {
+		lock = &modelLock{}
+		l.locks[modelID] = lock
+	}
+	lock.references++
+	l.mutex.Unlock()
+
+	lock.mutex.Lock()
+	return func() {
+		lock.mutex.Unlock()
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		lock.references--
+		if lock.references == 0 {
+			delete(l.locks, modelID)
+		}
+	}
+}
+
+// lockedModels counts the models whose mutex is kept
+func (l *ModelLocks) lockedModels() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.locks)
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelLocks(t *testing.T) {
+	locks := ModelLocks{}
+	unlockFoo := locks.Lock("foo")
+
+	// Other models aren't blocked
+	unlockBar := locks.Lock("bar")
+	assert.Equal(t, 2, locks.lockedModels())
+	unlockBar()
+
+	locked := make(chan struct{})
+	go func() {
+		unlock := locks.Lock("foo")
+		close(locked)
+		unlock()
+	}()
+	select {
+	case <-locked:
+		assert.Fail(t, "model \"foo\" locked twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlockFoo()
+	<-locked
+
+	// Concurrent operations on a model are serialized
+	counter := 0
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.Lock("foo")
+			defer unlock()
+			counter++
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 100, counter)
+	assert.Eventually(t, func() bool { return locks.lockedModels() == 0 }, time.Second, time.Millisecond)
+}
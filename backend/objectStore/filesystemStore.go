@@ -0,0 +1,204 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectStore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Prefix of the temporary files created while objects are written, they are ignored when listing
+const filesystemStoreTemporaryPrefix = ".upload-"
+
+type filesystemStore struct {
+	rootDirname string
+}
+
+// CreateFilesystemStore creates an object store keeping each object in a file under the given root directory
+//
+// The "/" in the keys are mapped to subdirectories.
+func CreateFilesystemStore(rootDirname string) (Store, error) {
+	err := os.MkdirAll(rootDirname, 0750)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create filesystem store in %q: %w", rootDirname, err)
+	}
+	return &filesystemStore{
+		rootDirname: rootDirname,
+	}, nil
+}
+
+func (s *filesystemStore) buildFilename(key string) string {
+	return filepath.Join(s.rootDirname, filepath.FromSlash(key))
+}
+
+// writeTemporaryFile writes the content of the given reader to a temporary file next to the object's file and returns its name
+func (s *filesystemStore) writeTemporaryFile(filename string, reader io.Reader) (string, error) {
+	err := os.MkdirAll(filepath.Dir(filename), 0750)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(filepath.Dir(filename), filesystemStoreTemporaryPrefix+"*.tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+	err = file.Close()
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	err = os.Chmod(file.Name(), 0640)
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+func (s *filesystemStore) Ping() error {
+	_, err := os.Stat(s.rootDirname)
+	return err
+}
+
+func (s *filesystemStore) PutObject(key string, reader io.Reader, size int64) error {
+	filename := s.buildFilename(key)
+	// Writing to a temporary file first for the object to appear atomically
+	temporaryFilename, err := s.writeTemporaryFile(filename, reader)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(temporaryFilename, filename)
+	if err != nil {
+		os.Remove(temporaryFilename)
+		return err
+	}
+	return nil
+}
+
+func (s *filesystemStore) PutObjectIfAbsent(key string, reader io.Reader, size int64) error {
+	filename := s.buildFilename(key)
+	temporaryFilename, err := s.writeTemporaryFile(filename, reader)
+	if err != nil {
+		return err
+	}
+	// Unlike a rename, a hard link never replaces an existing file
+	defer os.Remove(temporaryFilename)
+	err = os.Link(temporaryFilename, filename)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return &ObjectAlreadyExistsError{Key: key}
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *filesystemStore) GetObject(key string) (io.ReadCloser, error) {
+	file, err := os.Open(s.buildFilename(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &UnknownObjectError{Key: key}
+		}
+		return nil, err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if fileInfo.IsDir() {
+		file.Close()
+		return nil, &UnknownObjectError{Key: key}
+	}
+	return file, nil
+}
+
+type limitedFileReader struct {
+	io.Reader
+	file *os.File
+}
+
+func (r *limitedFileReader) Close() error {
+	return r.file.Close()
+}
+
+func (s *filesystemStore) GetObjectRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	reader, err := s.GetObject(key)
+	if err != nil {
+		return nil, err
+	}
+	file := reader.(*os.File)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &limitedFileReader{Reader: io.LimitReader(file, length), file: file}, nil
+}
+
+func (s *filesystemStore) DeleteObject(key string) error {
+	filename := s.buildFilename(key)
+	err := os.Remove(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// Removing the parent directories that are now empty, it fails on the first non empty one
+	for dirname := filepath.Dir(filename); dirname != filepath.Clean(s.rootDirname); dirname = filepath.Dir(dirname) {
+		if os.Remove(dirname) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *filesystemStore) ListObjects(prefix string) ([]string, error) {
+	keyDirname := ""
+	namePrefix := prefix
+	if separatorIdx := strings.LastIndex(prefix, "/"); separatorIdx >= 0 {
+		keyDirname = prefix[:separatorIdx+1]
+		namePrefix = prefix[separatorIdx+1:]
+	}
+	entries, err := os.ReadDir(s.buildFilename(keyDirname))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	keys := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, namePrefix) || strings.HasPrefix(name, filesystemStoreTemporaryPrefix) {
+			continue
+		}
+		if entry.IsDir() {
+			keys = append(keys, keyDirname+name+"/")
+		} else {
+			keys = append(keys, keyDirname+name)
+		}
+	}
+	// Directory entries are sorted by name, not taking into account the trailing "/"
+	sort.Strings(keys)
+	return keys, nil
+}
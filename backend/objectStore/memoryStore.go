@@ -0,0 +1,119 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectStore
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type memoryStore struct {
+	mutex   sync.RWMutex
+	objects map[string][]byte
+}
+
+func (s *memoryStore) Ping() error {
+	return nil
+}
+
+// CreateMemoryStore creates an object store keeping everything in memory, mostly useful for tests
+func CreateMemoryStore() Store {
+	return &memoryStore{
+		objects: make(map[string][]byte),
+	}
+}
+
+func (s *memoryStore) PutObject(key string, reader io.Reader, size int64) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.objects[key] = data
+	return nil
+}
+
+func (s *memoryStore) PutObjectIfAbsent(key string, reader io.Reader, size int64) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.objects[key]; ok {
+		return &ObjectAlreadyExistsError{Key: key}
+	}
+	s.objects[key] = data
+	return nil
+}
+
+func (s *memoryStore) GetObject(key string) (io.ReadCloser, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, &UnknownObjectError{Key: key}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memoryStore) GetObjectRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, &UnknownObjectError{Key: key}
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	end := offset + length
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return io.NopCloser(bytes.NewReader(data[offset:end])), nil
+}
+
+func (s *memoryStore) DeleteObject(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memoryStore) ListObjects(prefix string) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	keysSet := make(map[string]struct{})
+	for key := range s.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if separatorIdx := strings.Index(key[len(prefix):], "/"); separatorIdx >= 0 {
+			key = key[:len(prefix)+separatorIdx+1]
+		}
+		keysSet[key] = struct{}{}
+	}
+	keys := make([]string, 0, len(keysSet))
+	for key := range keysSet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
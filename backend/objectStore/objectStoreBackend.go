@@ -0,0 +1,736 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectStore
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/sirupsen/logrus"
+)
+
+type objectStoreModelInfo struct {
+	ModelID  string            `json:"model_id"`
+	UserData map[string]string `json:"user_data"`
+}
+
+type objectStoreVersionInfo struct {
+	ModelID           string            `json:"model_id"`
+	VersionNumber     uint              `json:"version_number"`
+	CreationTimestamp time.Time         `json:"creation_timestamp"`
+	Archived          bool              `json:"archived"`
+	DataHash          string            `json:"data_hash"`
+	DataSize          int               `json:"data_size"`
+	DataKey           string            `json:"data_key"`
+	UserData          map[string]string `json:"user_data"`
+}
+
+func (v objectStoreVersionInfo) toVersionInfo() backend.VersionInfo {
+	return backend.VersionInfo{
+		ModelID:           v.ModelID,
+		VersionNumber:     v.VersionNumber,
+		CreationTimestamp: v.CreationTimestamp,
+		Archived:          v.Archived,
+		DataHash:          v.DataHash,
+		DataSize:          v.DataSize,
+		UserData:          v.UserData,
+	}
+}
+
+// Maximum number of version numbers tried when concurrent writers create versions of the same model
+const maxVersionNumberAttempts = 10
+
+var versionInfoKeyRegexp = regexp.MustCompile(`/v([0-9]+)\.json$`)
+
+type objectStoreBackend struct {
+	store Store
+}
+
+// CreateBackend creates a new backend storing models and versions in the given object store
+//
+// Each model is stored under a `<model_id>/` prefix:
+// - `<model_id>/model.json` holds the model info,
+// - `<model_id>/v<version_number>.json` holds a version info, including the key of its data,
+// - `<model_id>/data/<unique_id>` holds a version data.
+//
+// Several backends can share a `ConditionalStore`, new versions are then attributed distinct version numbers.
+func CreateBackend(store Store) (backend.Backend, error) {
+	return &objectStoreBackend{
+		store: store,
+	}, nil
+}
+
+// BindContext binds the requests made to the store to the context, if the store is able to
+func (b *objectStoreBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	contextStore, ok := b.store.(ContextStore)
+	if !ok {
+		return nil, false
+	}
+	return &objectStoreBackend{store: contextStore.BindContext(ctx)}, true
+}
+
+// Destroy terminates the underlying storage, closing the store if needed
+func (b *objectStoreBackend) Destroy() {
+	if closer, ok := b.store.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+func (b *objectStoreBackend) Ping() error {
+	return b.store.Ping()
+}
+
+func buildModelPrefix(modelID string) string {
+	return modelID + "/"
+}
+
+func buildModelInfoKey(modelID string) string {
+	return buildModelPrefix(modelID) + "model.json"
+}
+
+func buildVersionInfoKey(modelID string, versionNumber uint) string {
+	return fmt.Sprintf("%sv%06d.json", buildModelPrefix(modelID), versionNumber)
+}
+
+func buildVersionDataKey(modelID string) (string, error) {
+	uniqueID := make([]byte, 12)
+	_, err := rand.Read(uniqueID)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate a data key for model %q: %w", modelID, err)
+	}
+	return buildModelPrefix(modelID) + "data/" + hex.EncodeToString(uniqueID), nil
+}
+
+func (b *objectStoreBackend) putJSON(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("unable to save %q: json serialization failed %w", key, err)
+	}
+	err = b.store.PutObject(key, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("unable to save %q: %w", key, err)
+	}
+	return nil
+}
+
+func (b *objectStoreBackend) getJSON(key string, value interface{}) error {
+	reader, err := b.store.GetObject(key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("unable to read %q: %w", key, err)
+	}
+	err = json.Unmarshal(data, value)
+	if err != nil {
+		return fmt.Errorf("unable to deserialize %q: %w", key, err)
+	}
+	return nil
+}
+
+// listAllObjects lists the keys starting with the given prefix, including the ones nested under a "/"
+func (b *objectStoreBackend) listAllObjects(prefix string) ([]string, error) {
+	entries, err := b.store.ListObjects(prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry, "/") {
+			keys = append(keys, entry)
+			continue
+		}
+		nestedKeys, err := b.listAllObjects(entry)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, nestedKeys...)
+	}
+	return keys, nil
+}
+
+func (b *objectStoreBackend) loadVersionInfo(modelID string, versionNumber uint) (objectStoreVersionInfo, error) {
+	versionInfo := objectStoreVersionInfo{}
+	err := b.getJSON(buildVersionInfoKey(modelID, versionNumber), &versionInfo)
+	if err != nil {
+		if _, ok := err.(*UnknownObjectError); ok {
+			return objectStoreVersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: int(versionNumber)}
+		}
+		return objectStoreVersionInfo{}, err
+	}
+	return versionInfo, nil
+}
+
+// listVersionNumbers lists the version numbers of a model in ascending order
+func (b *objectStoreBackend) listVersionNumbers(modelID string) ([]uint, error) {
+	hasModel, err := b.HasModel(modelID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasModel {
+		return nil, &backend.UnknownModelError{ModelID: modelID}
+	}
+	keys, err := b.store.ListObjects(buildModelPrefix(modelID) + "v")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list versions of model %q: %w", modelID, err)
+	}
+	versionNumbers := []uint{}
+	for _, key := range keys {
+		submatches := versionInfoKeyRegexp.FindStringSubmatch(key)
+		if submatches == nil {
+			continue
+		}
+		// Parsing the version number, we ignore the error as the regex matching should be enough guarantees
+		versionNumber, _ := strconv.ParseUint(submatches[1], 10, 0)
+		versionNumbers = append(versionNumbers, uint(versionNumber))
+	}
+	return versionNumbers, nil
+}
+
+func (b *objectStoreBackend) resolveVersionNumber(modelID string, versionNumber int) (uint, error) {
+	if versionNumber == 0 {
+		return 0, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	if versionNumber > 0 {
+		return uint(versionNumber), nil
+	}
+	// Retrieve the nth to last version
+	versionNumbers, err := b.listVersionNumbers(modelID)
+	if err != nil {
+		return 0, err
+	}
+	nthToLastIndex := -versionNumber - 1
+	if nthToLastIndex >= len(versionNumbers) {
+		return 0, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	return versionNumbers[len(versionNumbers)-1-nthToLastIndex], nil
+}
+
+func (b *objectStoreBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	modelInfo := backend.ModelInfo{
+		ModelID:  modelArgs.ModelID,
+		UserData: modelArgs.UserData,
+	}
+	err := b.putJSON(buildModelInfoKey(modelInfo.ModelID), objectStoreModelInfo{
+		ModelID:  modelInfo.ModelID,
+		UserData: modelInfo.UserData,
+	})
+	if err != nil {
+		return backend.ModelInfo{}, fmt.Errorf("unable to save model %q: %w", modelInfo.ModelID, err)
+	}
+	return modelInfo, nil
+}
+
+func (b *objectStoreBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	modelInfo := objectStoreModelInfo{}
+	err := b.getJSON(buildModelInfoKey(modelID), &modelInfo)
+	if err != nil {
+		if _, ok := err.(*UnknownObjectError); ok {
+			return backend.ModelInfo{}, &backend.UnknownModelError{ModelID: modelID}
+		}
+		return backend.ModelInfo{}, err
+	}
+	return backend.ModelInfo{
+		ModelID:  modelInfo.ModelID,
+		UserData: modelInfo.UserData,
+	}, nil
+}
+
+func (b *objectStoreBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	versionNumbers, err := b.listVersionNumbers(modelID)
+	if err != nil {
+		return 0, err
+	}
+	if len(versionNumbers) == 0 {
+		return 0, nil
+	}
+	return versionNumbers[len(versionNumbers)-1], nil
+}
+
+// HasModel checks if a model exists
+func (b *objectStoreBackend) HasModel(modelID string) (bool, error) {
+	reader, err := b.store.GetObject(buildModelInfoKey(modelID))
+	if err != nil {
+		if _, ok := err.(*UnknownObjectError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	reader.Close()
+	return true, nil
+}
+
+// DeleteModel deletes a model with a given id from the storage
+func (b *objectStoreBackend) DeleteModel(modelID string) error {
+	hasModel, err := b.HasModel(modelID)
+	if err != nil {
+		return err
+	}
+	if !hasModel {
+		return &backend.UnknownModelError{ModelID: modelID}
+	}
+	keys, err := b.listAllObjects(buildModelPrefix(modelID))
+	if err != nil {
+		return fmt.Errorf("unable to delete model %q: %w", modelID, err)
+	}
+	// Deleting the model info last for the model to stay visible until everything is deleted
+	modelInfoKey := buildModelInfoKey(modelID)
+	for _, key := range keys {
+		if key == modelInfoKey {
+			continue
+		}
+		err := b.store.DeleteObject(key)
+		if err != nil {
+			return fmt.Errorf("unable to delete model %q: %w", modelID, err)
+		}
+	}
+	err = b.store.DeleteObject(modelInfoKey)
+	if err != nil {
+		return fmt.Errorf("unable to delete model %q: %w", modelID, err)
+	}
+	return nil
+}
+
+// ListModels list models ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *objectStoreBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	prefixes, err := b.store.ListObjects("")
+	if err != nil {
+		return []backend.ModelInfo{}, fmt.Errorf("unable to list models: %w", err)
+	}
+
+	models := []backend.ModelInfo{}
+	modelIdx := 0
+	for _, prefix := range prefixes {
+		if !strings.HasSuffix(prefix, "/") {
+			continue
+		}
+		modelInfo, err := b.RetrieveModelInfo(strings.TrimSuffix(prefix, "/"))
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				// Not a model or a model being deleted
+				continue
+			}
+			return []backend.ModelInfo{}, err
+		}
+		if modelIdx < offset {
+			modelIdx++
+			continue
+		}
+		models = append(models, modelInfo)
+		modelIdx++
+		if limit > 0 && len(models) >= limit {
+			break
+		}
+	}
+	return models, nil
+}
+
+// QueryModels list models selected by the filter ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *objectStoreBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return backend.QueryModelsByListing(b, filter, offset, limit)
+}
+
+func (b *objectStoreBackend) resolveVersionInfo(modelID string, versionArgs backend.VersionArgs, dataKey string, dataSize int) (objectStoreVersionInfo, string, error) {
+	versionInfo := objectStoreVersionInfo{
+		ModelID:           modelID,
+		VersionNumber:     versionArgs.VersionNumber,
+		CreationTimestamp: versionArgs.CreationTimestamp,
+		Archived:          versionArgs.Archived,
+		DataHash:          versionArgs.DataHash,
+		DataSize:          dataSize,
+		DataKey:           dataKey,
+		UserData:          versionArgs.UserData,
+	}
+	if versionArgs.VersionNumber == 0 {
+		// Create a new version after the last one
+		latestVersionNumber, err := b.RetrieveModelLatestVersionNumber(modelID)
+		if err != nil {
+			return objectStoreVersionInfo{}, "", err
+		}
+		versionInfo.VersionNumber = latestVersionNumber + 1
+		return versionInfo, "", nil
+	}
+	hasModel, err := b.HasModel(modelID)
+	if err != nil {
+		return objectStoreVersionInfo{}, "", err
+	}
+	if !hasModel {
+		return objectStoreVersionInfo{}, "", &backend.UnknownModelError{ModelID: modelID}
+	}
+	// Maybe there is an existing version
+	existingVersionInfo, err := b.loadVersionInfo(modelID, versionArgs.VersionNumber)
+	if err != nil {
+		if !errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return objectStoreVersionInfo{}, "", err
+		}
+		// No version, create a new one
+		return versionInfo, "", nil
+	}
+	// Update an existing version, its previous data will need to be deleted
+	versionInfo.CreationTimestamp = existingVersionInfo.CreationTimestamp
+	return versionInfo, existingVersionInfo.DataKey, nil
+}
+
+// putVersionInfo stores a version info, a new version is only created if its number is still free when the store is conditional
+func (b *objectStoreBackend) putVersionInfo(versionInfo objectStoreVersionInfo, isNewVersion bool) error {
+	key := buildVersionInfoKey(versionInfo.ModelID, versionInfo.VersionNumber)
+	conditionalStore, ok := b.store.(ConditionalStore)
+	if !isNewVersion || !ok {
+		return b.putJSON(key, versionInfo)
+	}
+	data, err := json.Marshal(versionInfo)
+	if err != nil {
+		return fmt.Errorf("unable to save %q: json serialization failed %w", key, err)
+	}
+	return conditionalStore.PutObjectIfAbsent(key, bytes.NewReader(data), int64(len(data)))
+}
+
+func (b *objectStoreBackend) commitVersionInfo(modelID string, versionArgs backend.VersionArgs, dataKey string, dataSize int) (backend.VersionInfo, error) {
+	for attempt := 0; attempt < maxVersionNumberAttempts; attempt++ {
+		versionInfo, previousDataKey, err := b.resolveVersionInfo(modelID, versionArgs, dataKey, dataSize)
+		if err != nil {
+			_ = b.store.DeleteObject(dataKey)
+			return backend.VersionInfo{}, err
+		}
+
+		err = b.putVersionInfo(versionInfo, versionArgs.VersionNumber == 0)
+		if _, ok := err.(*ObjectAlreadyExistsError); ok {
+			// Another writer created this version in the meantime, retrying with the next version number
+			continue
+		}
+		if err != nil {
+			_ = b.store.DeleteObject(dataKey)
+			return backend.VersionInfo{}, fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+		}
+
+		if previousDataKey != "" {
+			err = b.store.DeleteObject(previousDataKey)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{"model_id": modelID, "version_number": versionInfo.VersionNumber, "key": previousDataKey}).WithError(err).Warn("unable to delete the previous data of a version, the object is orphaned")
+			}
+		}
+
+		return versionInfo.toVersionInfo(), nil
+	}
+	_ = b.store.DeleteObject(dataKey)
+	return backend.VersionInfo{}, fmt.Errorf("unable to create a version for model %q: too many concurrent creations", modelID)
+}
+
+// CreateOrUpdateModelVersion creates and store a new version for a model and returns its info, including the version number
+func (b *objectStoreBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	hasModel, err := b.HasModel(modelID)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	if !hasModel {
+		return backend.VersionInfo{}, &backend.UnknownModelError{ModelID: modelID}
+	}
+
+	dataKey, err := buildVersionDataKey(modelID)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	err = b.store.PutObject(dataKey, bytes.NewReader(versionArgs.Data), int64(len(versionArgs.Data)))
+	if err != nil {
+		return backend.VersionInfo{}, fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+	}
+
+	return b.commitVersionInfo(modelID, versionArgs, dataKey, len(versionArgs.Data))
+}
+
+type objectStoreVersionDataWriter struct {
+	backend      *objectStoreBackend
+	modelID      string
+	versionArgs  backend.VersionArgs
+	dataKey      string
+	objectWriter *ObjectWriter
+	hasher       backend.Hasher
+	dataSize     int
+}
+
+func (w *objectStoreVersionDataWriter) Write(data []byte) (int, error) {
+	n, err := w.objectWriter.Write(data)
+	w.dataSize += n
+	_, _ = w.hasher.Write(data[:n])
+	if err != nil {
+		return n, fmt.Errorf("unable to write data for model %q: %w", w.modelID, err)
+	}
+	return n, nil
+}
+
+func (w *objectStoreVersionDataWriter) Commit() (backend.VersionInfo, error) {
+	err := w.objectWriter.Close()
+	if err != nil {
+		_ = w.backend.store.DeleteObject(w.dataKey)
+		return backend.VersionInfo{}, fmt.Errorf("unable to create a version for model %q: %w", w.modelID, err)
+	}
+
+	dataHash := w.hasher.Hash()
+	if w.versionArgs.DataHash != "" && w.versionArgs.DataHash != dataHash {
+		_ = w.backend.store.DeleteObject(w.dataKey)
+		return backend.VersionInfo{}, &backend.DataHashMismatchError{ModelID: w.modelID, ExpectedDataHash: w.versionArgs.DataHash, DataHash: dataHash}
+	}
+	versionArgs := w.versionArgs
+	versionArgs.DataHash = dataHash
+
+	return w.backend.commitVersionInfo(w.modelID, versionArgs, w.dataKey, w.dataSize)
+}
+
+func (w *objectStoreVersionDataWriter) Abort() error {
+	return w.objectWriter.Abort()
+}
+
+// CreateOrUpdateModelVersionStream creates a writer uploading the version data to the object store as it is written
+func (b *objectStoreBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	hasModel, err := b.HasModel(modelID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasModel {
+		return nil, &backend.UnknownModelError{ModelID: modelID}
+	}
+
+	hasher, err := backend.CreateVersionHasher(versionArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := buildVersionDataKey(modelID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &objectStoreVersionDataWriter{
+		backend:      b,
+		modelID:      modelID,
+		versionArgs:  versionArgs,
+		dataKey:      dataKey,
+		objectWriter: CreateObjectWriter(b.store, dataKey),
+		hasher:       hasher,
+	}, nil
+}
+
+// RetrieveModelVersionInfo retrieves a given model version info
+func (b *objectStoreBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := b.loadVersionInfo(modelID, resolvedVersionNumber)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return backend.VersionInfo{}, err
+	}
+	return versionInfo.toVersionInfo(), nil
+}
+
+// RetrieveModelVersionData retrieves a given model version data
+func (b *objectStoreBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	versionInfo, err := b.loadVersionInfo(modelID, resolvedVersionNumber)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return []byte{}, err
+	}
+	reader, err := b.store.GetObject(versionInfo.DataKey)
+	if err != nil {
+		if _, ok := err.(*UnknownObjectError); ok {
+			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return []byte{}, fmt.Errorf(`unable to read data for model %q version "%d": %w`, modelID, resolvedVersionNumber, err)
+	}
+	defer reader.Close()
+	versionData, err := io.ReadAll(reader)
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to read data for model %q version "%d": %w`, modelID, resolvedVersionNumber, err)
+	}
+	return versionData, nil
+}
+
+// RetrieveModelVersionDataRange retrieves a range of a given model version data, only reading this range from the store
+func (b *objectStoreBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	versionInfo, err := b.loadVersionInfo(modelID, resolvedVersionNumber)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return []byte{}, err
+	}
+	end, err := backend.ResolveDataRange(modelID, versionNumber, uint64(versionInfo.DataSize), offset, length)
+	if err != nil || end == offset {
+		return []byte{}, err
+	}
+	versionData, err := ReadObjectRange(b.store, versionInfo.DataKey, offset, end)
+	if err != nil {
+		if _, ok := err.(*UnknownObjectError); ok {
+			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return []byte{}, fmt.Errorf(`unable to read data for model %q version "%d": %w`, modelID, resolvedVersionNumber, err)
+	}
+	return versionData, nil
+}
+
+// PresignModelVersionData presigns the URL of the data object of a given model version, if the store is able to
+func (b *objectStoreBackend) PresignModelVersionData(modelID string, versionNumber int, expiration time.Duration) (backend.VersionInfo, string, bool, error) {
+	presigningStore, ok := b.store.(PresigningStore)
+	if !ok {
+		return backend.VersionInfo{}, "", false, nil
+	}
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, "", false, err
+	}
+	versionInfo, err := b.loadVersionInfo(modelID, resolvedVersionNumber)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return backend.VersionInfo{}, "", false, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return backend.VersionInfo{}, "", false, err
+	}
+	// Data objects are never rewritten, an update of the version stores another one
+	url, err := presigningStore.PresignGetObject(versionInfo.DataKey, expiration)
+	if err != nil {
+		return backend.VersionInfo{}, "", false, fmt.Errorf(`unable to presign the data of model %q version "%d": %w`, modelID, resolvedVersionNumber, err)
+	}
+	return versionInfo.toVersionInfo(), url, true, nil
+}
+
+// DeleteModelVersion deletes a given model version
+// UpdateModelVersionArchived changes whether a given model version is archived by rewriting its info object, its data object is left untouched
+func (b *objectStoreBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := b.loadVersionInfo(modelID, resolvedVersionNumber)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return backend.VersionInfo{}, err
+	}
+	versionInfo.Archived = archived
+	err = b.putJSON(buildVersionInfoKey(modelID, resolvedVersionNumber), versionInfo)
+	if err != nil {
+		return backend.VersionInfo{}, fmt.Errorf(`unable to update model %q version "%d": %w`, modelID, resolvedVersionNumber, err)
+	}
+	return versionInfo.toVersionInfo(), nil
+}
+
+// UpdateModelVersionUserData replaces the user data of a given model version by rewriting its info object, its data object is left untouched
+func (b *objectStoreBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := b.loadVersionInfo(modelID, resolvedVersionNumber)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return backend.VersionInfo{}, err
+	}
+	versionInfo.UserData = userData
+	err = b.putJSON(buildVersionInfoKey(modelID, resolvedVersionNumber), versionInfo)
+	if err != nil {
+		return backend.VersionInfo{}, fmt.Errorf(`unable to update model %q version "%d": %w`, modelID, resolvedVersionNumber, err)
+	}
+	return versionInfo.toVersionInfo(), nil
+}
+
+func (b *objectStoreBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return err
+	}
+	versionInfo, err := b.loadVersionInfo(modelID, resolvedVersionNumber)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return err
+	}
+	err = b.store.DeleteObject(buildVersionInfoKey(modelID, resolvedVersionNumber))
+	if err != nil {
+		return fmt.Errorf(`unable to delete model %q version "%d" info: %w`, modelID, resolvedVersionNumber, err)
+	}
+	err = b.store.DeleteObject(versionInfo.DataKey)
+	if err != nil {
+		return fmt.Errorf(`unable to delete model %q version "%d" data: %w`, modelID, resolvedVersionNumber, err)
+	}
+	return nil
+}
+
+func (b *objectStoreBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	versionNumbers, err := b.listVersionNumbers(modelID)
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+
+	versions := []backend.VersionInfo{}
+	for _, versionNumber := range versionNumbers {
+		if versionNumber < initialVersionNumber {
+			continue
+		}
+		versionInfo, err := b.loadVersionInfo(modelID, versionNumber)
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelVersionError)) {
+				// Deleted in the meantime
+				continue
+			}
+			logrus.WithFields(logrus.Fields{"model_id": modelID, "version_number": versionNumber}).WithError(err).Warn("unable to load a version info, skipping the version")
+			continue
+		}
+		versions = append(versions, versionInfo.toVersionInfo())
+		if limit > 0 && len(versions) >= limit {
+			break
+		}
+	}
+	return versions, nil
+}
+
+// QueryModelVersionInfos lists the versions selected by the filter ordered by version number from the given initial version number, it returns at most the given limit number of versions
+func (b *objectStoreBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return backend.QueryModelVersionInfosByListing(b, modelID, filter, initialVersionNumber, limit)
+}
+
+// RetrieveStorageCapacity retrieves an unknown capacity, object stores don't report their capacity
+func (b *objectStoreBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return backend.StorageCapacity{}, nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectStore
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuiteObjectStoreBackend(t *testing.T) {
+	test.RunSuite(t, func() backend.Backend {
+		b, err := CreateBackend(CreateMemoryStore())
+		assert.NoError(t, err)
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+	})
+}
+
+func TestSuiteObjectStoreBackendFilesystemStore(t *testing.T) {
+	test.RunSuite(t, func() backend.Backend {
+		store, err := CreateFilesystemStore(t.TempDir())
+		assert.NoError(t, err)
+		b, err := CreateBackend(store)
+		assert.NoError(t, err)
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+	})
+}
+
+func TestPutObjectIfAbsent(t *testing.T) {
+	filesystemStore, err := CreateFilesystemStore(t.TempDir())
+	assert.NoError(t, err)
+	for name, store := range map[string]Store{"memory": CreateMemoryStore(), "filesystem": filesystemStore} {
+		t.Run(name, func(t *testing.T) {
+			conditionalStore := store.(ConditionalStore)
+			assert.NoError(t, conditionalStore.PutObjectIfAbsent("foo/bar", bytes.NewReader([]byte("first")), 5))
+			err := conditionalStore.PutObjectIfAbsent("foo/bar", bytes.NewReader([]byte("second")), 6)
+			assert.IsType(t, &ObjectAlreadyExistsError{}, err)
+
+			data, err := ReadObjectRange(store, "foo/bar", 0, 5)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("first"), data)
+			keys, err := store.ListObjects("foo/")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"foo/bar"}, keys)
+		})
+	}
+}
+
+// slowListingStore delays the listings for concurrent writers to compute the same next version number
+type slowListingStore struct {
+	ConditionalStore
+}
+
+func (s *slowListingStore) ListObjects(prefix string) ([]string, error) {
+	keys, err := s.ConditionalStore.ListObjects(prefix)
+	time.Sleep(10 * time.Millisecond)
+	return keys, err
+}
+
+func TestSharedStoreConcurrentCreateModelVersions(t *testing.T) {
+	filesystemStore, err := CreateFilesystemStore(t.TempDir())
+	assert.NoError(t, err)
+	store := &slowListingStore{ConditionalStore: filesystemStore.(ConditionalStore)}
+	// Two instances of the registry sharing the same store
+	instances := []backend.Backend{}
+	for i := 0; i < 2; i++ {
+		b, err := CreateBackend(store)
+		assert.NoError(t, err)
+		instances = append(instances, b)
+	}
+	_, err = instances[0].CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+
+	data := []byte("Lorem ipsum dolor sit amet")
+	wg := new(sync.WaitGroup)
+	for _, b := range instances {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			b := b
+			go func() {
+				defer wg.Done()
+				_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+					CreationTimestamp: time.Now(),
+					Data:              data,
+					DataHash:          backend.ComputeSHA256Hash(data),
+				})
+				assert.NoError(t, err)
+			}()
+		}
+	}
+	wg.Wait()
+
+	versionInfos, err := instances[1].ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 8)
+	for index, versionInfo := range versionInfos {
+		assert.Equal(t, uint(index+1), versionInfo.VersionNumber)
+	}
+	// Only the data of the stored versions remains
+	dataKeys, err := store.ListObjects("foo/data/")
+	assert.NoError(t, err)
+	assert.Len(t, dataKeys, 8)
+}
+
+func BenchmarkSuiteObjectStoreBackend(b *testing.B) {
+	test.RunBenchmarkSuite(b, func() backend.Backend {
+		bck, err := CreateBackend(CreateMemoryStore())
+		assert.NoError(b, err)
+		return bck
+	}, func(bck backend.Backend) {
+		bck.Destroy()
+	})
+}
+
+// presigningStore presigns fake URLs of the objects of a memory store
+type presigningStore struct {
+	Store
+}
+
+func (s *presigningStore) PresignGetObject(key string, expiration time.Duration) (string, error) {
+	return "https://store.test/" + key + "?expiration=" + expiration.String(), nil
+}
+
+func TestPresignModelVersionData(t *testing.T) {
+	store := &presigningStore{Store: CreateMemoryStore()}
+	b, err := CreateBackend(store)
+	assert.NoError(t, err)
+	defer b.Destroy()
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	data := []byte("Lorem ipsum dolor sit amet")
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{CreationTimestamp: time.Now(), DataHash: backend.ComputeSHA256Hash(data), Data: data})
+	assert.NoError(t, err)
+
+	versionInfo, url, presigned, err := backend.PresignModelVersionData(b, "foo", -1, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, presigned)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	assert.True(t, strings.HasPrefix(url, "https://store.test/") && strings.HasSuffix(url, "?expiration=1m0s"))
+	// The URL targets the data object of the version
+	presignedData, err := ReadObjectRange(store, strings.TrimSuffix(strings.TrimPrefix(url, "https://store.test/"), "?expiration=1m0s"), 0, uint64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, presignedData)
+
+	_, _, _, err = backend.PresignModelVersionData(b, "foo", 2, time.Minute)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+	_, _, _, err = backend.PresignModelVersionData(b, "bar", -1, time.Minute)
+	assert.IsType(t, &backend.UnknownModelError{}, err)
+
+	// Stores unable to presign don't provide URLs
+	b, err = CreateBackend(CreateMemoryStore())
+	assert.NoError(t, err)
+	defer b.Destroy()
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{CreationTimestamp: time.Now(), DataHash: backend.ComputeSHA256Hash(data), Data: data})
+	assert.NoError(t, err)
+	_, _, presigned, err = backend.PresignModelVersionData(b, "foo", 1, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, presigned)
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectStore
+
+import (
+	"fmt"
+	"io"
+)
+
+// ObjectWriter uploads an object to a store as it is written
+type ObjectWriter struct {
+	store      Store
+	key        string
+	pipeWriter *io.PipeWriter
+	putResult  chan error
+}
+
+// CreateObjectWriter starts the upload of an object of unknown size at the given key
+func CreateObjectWriter(store Store, key string) *ObjectWriter {
+	pipeReader, pipeWriter := io.Pipe()
+	putResult := make(chan error, 1)
+	go func() {
+		err := store.PutObject(key, pipeReader, -1)
+		// Making sure the writer doesn't block if the upload failed early
+		_ = pipeReader.CloseWithError(err)
+		putResult <- err
+	}()
+	return &ObjectWriter{
+		store:      store,
+		key:        key,
+		pipeWriter: pipeWriter,
+		putResult:  putResult,
+	}
+}
+
+func (w *ObjectWriter) Write(data []byte) (int, error) {
+	if w.pipeWriter == nil {
+		return 0, fmt.Errorf("unable to write object %q: writer already closed", w.key)
+	}
+	return w.pipeWriter.Write(data)
+}
+
+func (w *ObjectWriter) close(closeErr error) error {
+	if w.pipeWriter == nil {
+		return fmt.Errorf("unable to close object %q writer: writer already closed", w.key)
+	}
+	_ = w.pipeWriter.CloseWithError(closeErr)
+	w.pipeWriter = nil
+	return <-w.putResult
+}
+
+// Close terminates the upload and waits for the object to be stored
+func (w *ObjectWriter) Close() error {
+	return w.close(nil)
+}
+
+// Abort interrupts the upload and deletes anything that might have been stored
+func (w *ObjectWriter) Abort() error {
+	_ = w.close(fmt.Errorf("upload of object %q aborted", w.key))
+	return w.store.DeleteObject(w.key)
+}
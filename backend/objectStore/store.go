@@ -0,0 +1,95 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectStore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Store defines the minimal interface of an object store used to store models and their versions
+type Store interface {
+	// PutObject stores the content of the given reader at the given key, size is -1 when unknown
+	PutObject(key string, reader io.Reader, size int64) error
+	// GetObject retrieves the content stored at the given key
+	GetObject(key string) (io.ReadCloser, error)
+	// GetObjectRange retrieves length bytes of the content stored at the given key starting at offset, length is at least 1
+	GetObjectRange(key string, offset int64, length int64) (io.ReadCloser, error)
+	// DeleteObject deletes the object stored at the given key
+	DeleteObject(key string) error
+	// ListObjects lists the keys starting with the given prefix in lexicographical order
+	// Keys including a "/" after the prefix are grouped in a single entry ending with "/"
+	ListObjects(prefix string) ([]string, error)
+	// Ping checks the object store is reachable
+	Ping() error
+}
+
+// ConditionalStore is implemented by the object stores able to create an object only if the key is free
+//
+// Concurrent writers sharing a conditional store, e.g. several instances of the registry, are attributed distinct version numbers.
+type ConditionalStore interface {
+	Store
+	// PutObjectIfAbsent stores the content of the given reader at the given key, failing with an `ObjectAlreadyExistsError` if there is already an object
+	PutObjectIfAbsent(key string, reader io.Reader, size int64) error
+}
+
+// PresigningStore is implemented by the object stores able to let clients download an object without credentials
+type PresigningStore interface {
+	Store
+	// PresignGetObject returns a URL from which the object stored at the given key can be downloaded until it expires
+	PresignGetObject(key string, expiration time.Duration) (string, error)
+}
+
+// ContextStore is implemented by the object stores whose requests can be bound to a context
+type ContextStore interface {
+	Store
+	// BindContext returns a view of the store whose requests are canceled once the context is done
+	BindContext(ctx context.Context) Store
+}
+
+// ReadObjectRange reads the bytes of an object from offset to end, end being greater than offset
+func ReadObjectRange(store Store, key string, offset uint64, end uint64) ([]byte, error) {
+	reader, err := store.GetObjectRange(key, int64(offset), int64(end-offset))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data := make([]byte, end-offset)
+	_, err = io.ReadFull(reader, data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// UnknownObjectError is raised when trying to operate on an unknown object
+type UnknownObjectError struct {
+	Key string
+}
+
+func (e *UnknownObjectError) Error() string {
+	return fmt.Sprintf("no object %q found", e.Key)
+}
+
+// ObjectAlreadyExistsError is raised when trying to create an object at a key already in use
+type ObjectAlreadyExistsError struct {
+	Key string
+}
+
+func (e *ObjectAlreadyExistsError) Error() string {
+	return fmt.Sprintf("object %q already exists", e.Key)
+}
@@ -0,0 +1,433 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/hybrid"
+)
+
+type postgresMetadataStore struct {
+	db  *sql.DB
+	ctx context.Context // Nil unless bound to a context
+}
+
+// The metadata store uses its own tables for a database to be shareable with a postgres backend
+const metadataStoreSchema = `
+CREATE TABLE IF NOT EXISTS metadata_models (
+	model_id TEXT PRIMARY KEY,
+	user_data JSONB NOT NULL DEFAULT '{}'
+);
+CREATE TABLE IF NOT EXISTS metadata_versions (
+	model_id TEXT NOT NULL REFERENCES metadata_models (model_id) ON DELETE CASCADE,
+	version_number BIGINT NOT NULL,
+	creation_timestamp TIMESTAMPTZ NOT NULL,
+	archived BOOLEAN NOT NULL,
+	data_hash TEXT NOT NULL,
+	data_size BIGINT NOT NULL,
+	user_data JSONB NOT NULL DEFAULT '{}',
+	data_key TEXT NOT NULL,
+	PRIMARY KEY (model_id, version_number)
+);
+`
+
+// Columns of the metadata_versions table retrieved to build a `hybrid.VersionMetadata`
+const versionMetadataColumns = versionInfoColumns + `, data_key`
+
+// CreateMetadataStore creates a new metadata store for hybrid backends in a PostgreSQL database, the tables are created if needed
+func CreateMetadataStore(configuration Configuration) (hybrid.MetadataStore, error) {
+	db, err := sql.Open("postgres", configuration.URL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create postgres metadata store: %w", err)
+	}
+	_, err = db.Exec(metadataStoreSchema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to create postgres metadata store: schema creation failed %w", err)
+	}
+	return &postgresMetadataStore{
+		db: db,
+	}, nil
+}
+
+// BindContext returns a view of the store whose queries are canceled once the context is done
+func (s *postgresMetadataStore) BindContext(ctx context.Context) hybrid.MetadataStore {
+	return &postgresMetadataStore{db: s.db, ctx: ctx}
+}
+
+func (s *postgresMetadataStore) requestContext() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *postgresMetadataStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *postgresMetadataStore) Ping() error {
+	return s.db.PingContext(s.requestContext())
+}
+
+func scanVersionMetadata(row rowScanner) (hybrid.VersionMetadata, error) {
+	var version hybrid.VersionMetadata
+	var versionNumber int64
+	var dataSize int64
+	var serializedUserData []byte
+	err := row.Scan(
+		&version.ModelID,
+		&versionNumber,
+		&version.CreationTimestamp,
+		&version.Archived,
+		&version.DataHash,
+		&dataSize,
+		&serializedUserData,
+		&version.DataKey,
+	)
+	if err != nil {
+		return hybrid.VersionMetadata{}, err
+	}
+	version.VersionNumber = uint(versionNumber)
+	version.DataSize = int(dataSize)
+	version.UserData, err = deserializeUserData(serializedUserData)
+	if err != nil {
+		return hybrid.VersionMetadata{}, err
+	}
+	return version, nil
+}
+
+func (s *postgresMetadataStore) CreateOrUpdateModel(modelInfo backend.ModelInfo) error {
+	serializedUserData, err := serializeUserData(modelInfo.UserData)
+	if err != nil {
+		return fmt.Errorf("unable to save model %q: %w", modelInfo.ModelID, err)
+	}
+	_, err = s.db.ExecContext(s.requestContext(),
+		`INSERT INTO metadata_models (model_id, user_data) VALUES ($1, $2::jsonb)
+		ON CONFLICT (model_id) DO UPDATE SET user_data = EXCLUDED.user_data`,
+		modelInfo.ModelID,
+		serializedUserData,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to save model %q: %w", modelInfo.ModelID, err)
+	}
+	return nil
+}
+
+func (s *postgresMetadataStore) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	var serializedUserData []byte
+	err := s.db.QueryRowContext(s.requestContext(), `SELECT user_data FROM metadata_models WHERE model_id = $1`, modelID).Scan(&serializedUserData)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return backend.ModelInfo{}, &backend.UnknownModelError{ModelID: modelID}
+		}
+		return backend.ModelInfo{}, fmt.Errorf("unable to retrieve model %q: %w", modelID, err)
+	}
+	userData, err := deserializeUserData(serializedUserData)
+	if err != nil {
+		return backend.ModelInfo{}, fmt.Errorf("unable to retrieve model %q: %w", modelID, err)
+	}
+	return backend.ModelInfo{
+		ModelID:  modelID,
+		UserData: userData,
+	}, nil
+}
+
+func (s *postgresMetadataStore) HasModel(modelID string) (bool, error) {
+	var hasModel bool
+	err := s.db.QueryRowContext(s.requestContext(), `SELECT EXISTS (SELECT 1 FROM metadata_models WHERE model_id = $1)`, modelID).Scan(&hasModel)
+	if err != nil {
+		return false, fmt.Errorf("unable to check model %q existence: %w", modelID, err)
+	}
+	return hasModel, nil
+}
+
+func (s *postgresMetadataStore) DeleteModel(modelID string) ([]hybrid.VersionMetadata, error) {
+	tx, err := s.db.BeginTx(s.requestContext(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to delete model %q: %w", modelID, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(s.requestContext(), `DELETE FROM metadata_versions WHERE model_id = $1 RETURNING `+versionMetadataColumns, modelID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to delete model %q: %w", modelID, err)
+	}
+	versions := []hybrid.VersionMetadata{}
+	for rows.Next() {
+		version, err := scanVersionMetadata(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("unable to delete model %q: %w", modelID, err)
+		}
+		versions = append(versions, version)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("unable to delete model %q: %w", modelID, err)
+	}
+
+	result, err := tx.ExecContext(s.requestContext(), `DELETE FROM metadata_models WHERE model_id = $1`, modelID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to delete model %q: %w", modelID, err)
+	}
+	deletedCount, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("unable to delete model %q: %w", modelID, err)
+	}
+	if deletedCount == 0 {
+		return nil, &backend.UnknownModelError{ModelID: modelID}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("unable to delete model %q: %w", modelID, err)
+	}
+	return versions, nil
+}
+
+func (s *postgresMetadataStore) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	return queryModels(s.requestContext(), s.db, "metadata_models", backend.ModelFilter{}, offset, limit)
+}
+
+func (s *postgresMetadataStore) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return queryModels(s.requestContext(), s.db, "metadata_models", filter, offset, limit)
+}
+
+func (s *postgresMetadataStore) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	var latestVersionNumber sql.NullInt64
+	err := s.db.QueryRowContext(s.requestContext(),
+		`SELECT (SELECT MAX(version_number) FROM metadata_versions WHERE model_id = $1) FROM metadata_models WHERE model_id = $1`,
+		modelID,
+	).Scan(&latestVersionNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, &backend.UnknownModelError{ModelID: modelID}
+		}
+		return 0, fmt.Errorf("unable to retrieve model %q latest version number: %w", modelID, err)
+	}
+	if !latestVersionNumber.Valid {
+		// No versions
+		return 0, nil
+	}
+	return uint(latestVersionNumber.Int64), nil
+}
+
+// CreateOrUpdateVersion stores a version metadata in a transaction locking the model to guarantee the uniqueness of the version numbers
+func (s *postgresMetadataStore) CreateOrUpdateVersion(version hybrid.VersionMetadata) (hybrid.VersionMetadata, string, error) {
+	modelID := version.ModelID
+	serializedUserData, err := serializeUserData(version.UserData)
+	if err != nil {
+		return hybrid.VersionMetadata{}, "", fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+	}
+
+	tx, err := s.db.BeginTx(s.requestContext(), nil)
+	if err != nil {
+		return hybrid.VersionMetadata{}, "", fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+	}
+	defer tx.Rollback()
+
+	var lockedModelID string
+	err = tx.QueryRowContext(s.requestContext(), `SELECT model_id FROM metadata_models WHERE model_id = $1 FOR UPDATE`, modelID).Scan(&lockedModelID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return hybrid.VersionMetadata{}, "", &backend.UnknownModelError{ModelID: modelID}
+		}
+		return hybrid.VersionMetadata{}, "", fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+	}
+
+	versionNumber := int64(version.VersionNumber)
+	previousDataKey := ""
+	if versionNumber == 0 {
+		// Create a new version after the last one
+		err = tx.QueryRowContext(s.requestContext(), `SELECT COALESCE(MAX(version_number), 0) + 1 FROM metadata_versions WHERE model_id = $1`, modelID).Scan(&versionNumber)
+		if err != nil {
+			return hybrid.VersionMetadata{}, "", fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+		}
+	} else {
+		// Maybe there is an existing version which data is replaced
+		err = tx.QueryRowContext(s.requestContext(),
+			`SELECT data_key FROM metadata_versions WHERE model_id = $1 AND version_number = $2`,
+			modelID,
+			versionNumber,
+		).Scan(&previousDataKey)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return hybrid.VersionMetadata{}, "", fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+		}
+	}
+
+	// Updating an existing version keeps its creation timestamp
+	storedVersion, err := scanVersionMetadata(tx.QueryRowContext(s.requestContext(),
+		`INSERT INTO metadata_versions (model_id, version_number, creation_timestamp, archived, data_hash, data_size, user_data, data_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb, $8)
+		ON CONFLICT (model_id, version_number) DO UPDATE SET
+			archived = EXCLUDED.archived,
+			data_hash = EXCLUDED.data_hash,
+			data_size = EXCLUDED.data_size,
+			user_data = EXCLUDED.user_data,
+			data_key = EXCLUDED.data_key
+		RETURNING `+versionMetadataColumns,
+		modelID,
+		versionNumber,
+		version.CreationTimestamp,
+		version.Archived,
+		version.DataHash,
+		version.DataSize,
+		serializedUserData,
+		version.DataKey,
+	))
+	if err != nil {
+		return hybrid.VersionMetadata{}, "", fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return hybrid.VersionMetadata{}, "", fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+	}
+	return storedVersion, previousDataKey, nil
+}
+
+// unknownVersionError builds the error matching an unknown version, for the nth to last versions it depends on the existence of the model
+func (s *postgresMetadataStore) unknownVersionError(modelID string, versionNumber int) error {
+	if versionNumber < 0 {
+		hasModel, err := s.HasModel(modelID)
+		if err != nil {
+			return err
+		}
+		if !hasModel {
+			return &backend.UnknownModelError{ModelID: modelID}
+		}
+	}
+	return &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+}
+
+func (s *postgresMetadataStore) RetrieveVersion(modelID string, versionNumber int) (hybrid.VersionMetadata, error) {
+	if versionNumber == 0 {
+		return hybrid.VersionMetadata{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	query, args := selectVersion(versionMetadataColumns, "metadata_versions", modelID, versionNumber)
+	version, err := scanVersionMetadata(s.db.QueryRowContext(s.requestContext(), query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return hybrid.VersionMetadata{}, s.unknownVersionError(modelID, versionNumber)
+		}
+		return hybrid.VersionMetadata{}, fmt.Errorf(`unable to retrieve model %q version "%d" info: %w`, modelID, versionNumber, err)
+	}
+	return version, nil
+}
+
+func (s *postgresMetadataStore) UpdateVersionArchived(modelID string, versionNumber int, archived bool) (hybrid.VersionMetadata, error) {
+	if versionNumber == 0 {
+		return hybrid.VersionMetadata{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	selectQuery, args := selectVersion("version_number", "metadata_versions", modelID, versionNumber)
+	args = append(args, archived)
+	version, err := scanVersionMetadata(s.db.QueryRowContext(s.requestContext(),
+		`UPDATE metadata_versions SET archived = $3 WHERE model_id = $1 AND version_number = (`+selectQuery+`) RETURNING `+versionMetadataColumns,
+		args...,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return hybrid.VersionMetadata{}, s.unknownVersionError(modelID, versionNumber)
+		}
+		return hybrid.VersionMetadata{}, fmt.Errorf(`unable to update model %q version "%d": %w`, modelID, versionNumber, err)
+	}
+	return version, nil
+}
+
+func (s *postgresMetadataStore) UpdateVersionUserData(modelID string, versionNumber int, userData map[string]string) (hybrid.VersionMetadata, error) {
+	if versionNumber == 0 {
+		return hybrid.VersionMetadata{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	serializedUserData, err := serializeUserData(userData)
+	if err != nil {
+		return hybrid.VersionMetadata{}, fmt.Errorf(`unable to update model %q version "%d": %w`, modelID, versionNumber, err)
+	}
+	selectQuery, args := selectVersion("version_number", "metadata_versions", modelID, versionNumber)
+	args = append(args, serializedUserData)
+	version, err := scanVersionMetadata(s.db.QueryRowContext(s.requestContext(),
+		`UPDATE metadata_versions SET user_data = $3::jsonb WHERE model_id = $1 AND version_number = (`+selectQuery+`) RETURNING `+versionMetadataColumns,
+		args...,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return hybrid.VersionMetadata{}, s.unknownVersionError(modelID, versionNumber)
+		}
+		return hybrid.VersionMetadata{}, fmt.Errorf(`unable to update model %q version "%d": %w`, modelID, versionNumber, err)
+	}
+	return version, nil
+}
+
+func (s *postgresMetadataStore) DeleteVersion(modelID string, versionNumber int) (hybrid.VersionMetadata, error) {
+	if versionNumber == 0 {
+		return hybrid.VersionMetadata{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	selectQuery, args := selectVersion("version_number", "metadata_versions", modelID, versionNumber)
+	version, err := scanVersionMetadata(s.db.QueryRowContext(s.requestContext(),
+		`DELETE FROM metadata_versions WHERE model_id = $1 AND version_number = (`+selectQuery+`) RETURNING `+versionMetadataColumns,
+		args...,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return hybrid.VersionMetadata{}, s.unknownVersionError(modelID, versionNumber)
+		}
+		return hybrid.VersionMetadata{}, fmt.Errorf(`unable to delete model %q version "%d": %w`, modelID, versionNumber, err)
+	}
+	return version, nil
+}
+
+func (s *postgresMetadataStore) ListVersions(modelID string, initialVersionNumber uint, limit int) ([]hybrid.VersionMetadata, error) {
+	return s.QueryVersions(modelID, backend.VersionFilter{}, initialVersionNumber, limit)
+}
+
+func (s *postgresMetadataStore) QueryVersions(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]hybrid.VersionMetadata, error) {
+	hasModel, err := s.HasModel(modelID)
+	if err != nil {
+		return []hybrid.VersionMetadata{}, err
+	}
+	if !hasModel {
+		return []hybrid.VersionMetadata{}, &backend.UnknownModelError{ModelID: modelID}
+	}
+
+	query, args, err := queryVersionsSQL(versionMetadataColumns, "metadata_versions", modelID, filter, initialVersionNumber, limit)
+	if err != nil {
+		return []hybrid.VersionMetadata{}, fmt.Errorf("unable to list versions of model %q: %w", modelID, err)
+	}
+	rows, err := s.db.QueryContext(s.requestContext(), query, args...)
+	if err != nil {
+		return []hybrid.VersionMetadata{}, fmt.Errorf("unable to list versions of model %q: %w", modelID, err)
+	}
+	defer rows.Close()
+
+	versions := []hybrid.VersionMetadata{}
+	for rows.Next() {
+		version, err := scanVersionMetadata(rows)
+		if err != nil {
+			return []hybrid.VersionMetadata{}, fmt.Errorf("unable to list versions of model %q: %w", modelID, err)
+		}
+		versions = append(versions, version)
+	}
+	err = rows.Err()
+	if err != nil {
+		return []hybrid.VersionMetadata{}, fmt.Errorf("unable to list versions of model %q: %w", modelID, err)
+	}
+	return versions, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/hybrid"
+	"github.com/cogment/cogment-model-registry/backend/objectStore"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// The test suite requires an accessible PostgreSQL database, e.g. `docker run -p 5432:5432 -e POSTGRES_PASSWORD=test postgres`,
+// configured using `COGMENT_MODEL_REGISTRY_TEST_POSTGRES_URL`, its tables are dropped after each test
+func testConfiguration(t *testing.T) Configuration {
+	url := os.Getenv("COGMENT_MODEL_REGISTRY_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("COGMENT_MODEL_REGISTRY_TEST_POSTGRES_URL is not defined")
+	}
+	return Configuration{
+		URL: url,
+	}
+}
+
+func TestSuitePostgresBackend(t *testing.T) {
+	configuration := testConfiguration(t)
+	test.RunSuite(t, func() backend.Backend {
+		b, err := CreateBackend(configuration)
+		assert.NoError(t, err)
+		return b
+	}, func(b backend.Backend) {
+		_, err := b.(*postgresBackend).db.Exec(`DROP TABLE IF EXISTS versions, models`)
+		assert.NoError(t, err)
+		b.Destroy()
+	})
+}
+
+func TestSuiteHybridBackendPostgresMetadataStore(t *testing.T) {
+	configuration := testConfiguration(t)
+	test.RunSuite(t, func() backend.Backend {
+		metadataStore, err := CreateMetadataStore(configuration)
+		assert.NoError(t, err)
+		b, err := hybrid.CreateBackend(metadataStore, objectStore.CreateMemoryStore())
+		assert.NoError(t, err)
+		return b
+	}, func(b backend.Backend) {
+		db, err := sql.Open("postgres", configuration.URL)
+		assert.NoError(t, err)
+		_, err = db.Exec(`DROP TABLE IF EXISTS metadata_versions, metadata_models`)
+		assert.NoError(t, err)
+		db.Close()
+		b.Destroy()
+	})
+}
@@ -0,0 +1,453 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reconnecting
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/sirupsen/logrus"
+)
+
+// Metrics published by every reconnecting backend under `/debug/vars`
+var (
+	disconnectionsMetric = expvar.NewInt("backend_disconnections")
+	reconnectionsMetric  = expvar.NewInt("backend_reconnections")
+)
+
+type Configuration struct {
+	InitialBackoff time.Duration // Delay before the first reconnection attempt, doubled after each failed attempt
+	MaxBackoff     time.Duration // Maximum delay between two reconnection attempts
+}
+
+var DefaultConfiguration = Configuration{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+}
+
+// UnavailableError is raised by the operations made while the underlying backend is being reconnected
+type UnavailableError struct {
+	Backend string
+	Err     error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("the %s backend is unavailable, reconnecting: %s", e.Backend, e.Err)
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// connection is shared by a reconnecting backend and the views bound to a context
+type connection struct {
+	checking int32 // Set while a ping checks the backend after a failed operation
+
+	mutex        sync.RWMutex
+	backend      backend.Backend // Nil while disconnected
+	err          error           // Cause of the disconnection
+	reconnecting bool
+	done         chan struct{}
+}
+
+type reconnectingBackend struct {
+	*connection
+	name          string
+	create        func() (backend.Backend, error)
+	configuration Configuration
+	log           *logrus.Entry
+	ctx           context.Context // Nil unless bound to a context, the connected backend is then bound to it
+}
+
+// CreateBackend creates a backend recreating the one built by create, with an exponential backoff, when it is unreachable
+//
+// The backend is created right away, if it fails the creation is retried in the background and the operations fail with an
+// `UnavailableError` until it succeeds. A failed ping, or an unexpected error followed by a failed ping, disconnects the
+// created backend, it is then destroyed and replaced.
+func CreateBackend(name string, create func() (backend.Backend, error), configuration Configuration) backend.Backend {
+	b := &reconnectingBackend{
+		connection:    &connection{done: make(chan struct{})},
+		name:          name,
+		create:        create,
+		configuration: configuration,
+		log:           logrus.WithField("backend", name),
+	}
+	created, err := create()
+	if err != nil {
+		b.log.WithError(err).Warn("Unable to create the backend, retrying in the background")
+		b.disconnect(nil, err)
+	} else {
+		b.backend = created
+	}
+	return b
+}
+
+func (b *reconnectingBackend) Destroy() {
+	b.mutex.Lock()
+	current := b.backend
+	b.backend = nil
+	select {
+	case <-b.done:
+	default:
+		close(b.done)
+	}
+	b.mutex.Unlock()
+	if current != nil {
+		current.Destroy()
+	}
+}
+
+// BindContext binds the connected backend to the context, along with the backends it is replaced by during the call
+func (b *reconnectingBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	b.mutex.RLock()
+	connected := b.backend
+	b.mutex.RUnlock()
+	if connected != nil {
+		if _, ok := backend.BindContext(connected, ctx); !ok {
+			return nil, false
+		}
+	}
+	bound := *b
+	bound.ctx = ctx
+	return &bound, true
+}
+
+// current retrieves the connected backend and the one the operations use, bound to the context if needed
+func (b *reconnectingBackend) current() (backend.Backend, backend.Backend, error) {
+	b.mutex.RLock()
+	connected := b.backend
+	err := b.err
+	b.mutex.RUnlock()
+	if connected == nil {
+		return nil, nil, &UnavailableError{Backend: b.name, Err: err}
+	}
+	if b.ctx == nil {
+		return connected, connected, nil
+	}
+	if bound, ok := backend.BindContext(connected, b.ctx); ok {
+		return connected, bound, nil
+	}
+	return connected, connected, nil
+}
+
+// disconnect replaces a backend found unreachable, nil when it couldn't be created, by a new one created in the background
+func (b *reconnectingBackend) disconnect(disconnected backend.Backend, err error) {
+	b.mutex.Lock()
+	if b.backend != disconnected {
+		// Already replaced
+		b.mutex.Unlock()
+		return
+	}
+	b.backend = nil
+	b.err = err
+	startReconnection := !b.reconnecting
+	b.reconnecting = true
+	b.mutex.Unlock()
+
+	if disconnected != nil {
+		disconnectionsMetric.Add(1)
+		b.log.WithError(err).Warn("Backend unreachable, reconnecting")
+		disconnected.Destroy()
+	}
+	if startReconnection {
+		go b.reconnect()
+	}
+}
+
+func (b *reconnectingBackend) reconnect() {
+	backoff := b.configuration.InitialBackoff
+	for {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-b.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		created, err := b.create()
+		if err == nil {
+			if err = created.Ping(); err != nil {
+				created.Destroy()
+			}
+		}
+		if err == nil {
+			b.mutex.Lock()
+			select {
+			case <-b.done:
+				b.mutex.Unlock()
+				created.Destroy()
+				return
+			default:
+			}
+			b.backend = created
+			b.err = nil
+			b.reconnecting = false
+			b.mutex.Unlock()
+			reconnectionsMetric.Add(1)
+			b.log.Info("Backend reconnected")
+			return
+		}
+
+		b.mutex.Lock()
+		b.err = err
+		b.mutex.Unlock()
+		backoff *= 2
+		if backoff > b.configuration.MaxBackoff {
+			backoff = b.configuration.MaxBackoff
+		}
+		b.log.WithError(err).WithField("retry_in", backoff).Warn("Unable to reconnect the backend")
+	}
+}
+
+// isBackendError returns true for the errors about the models and versions themselves, not the reachability of the backend
+func isBackendError(err error) bool {
+	return errors.Is(err, backend.ErrNotFound) ||
+		errors.Is(err, backend.ErrCorrupted) ||
+		errors.Is(err, backend.ErrInvalidData) ||
+		errors.As(err, new(*backend.InvalidDataRangeError)) ||
+		errors.As(err, new(*backend.UnknownHashAlgorithmError))
+}
+
+// checkError pings the backend in the background after an unexpected error, disconnecting it if it is unreachable
+func (b *reconnectingBackend) checkError(current backend.Backend, err error) {
+	if err == nil || isBackendError(err) || !atomic.CompareAndSwapInt32(&b.checking, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&b.checking, 0)
+		if err := current.Ping(); err != nil {
+			b.disconnect(current, err)
+		}
+	}()
+}
+
+func (b *reconnectingBackend) Ping() error {
+	connected, current, err := b.current()
+	if err != nil {
+		return err
+	}
+	err = current.Ping()
+	if err != nil {
+		b.disconnect(connected, err)
+	}
+	return err
+}
+
+func (b *reconnectingBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return backend.ModelInfo{}, err
+	}
+	modelInfo, err := current.CreateOrUpdateModel(modelArgs)
+	b.checkError(connected, err)
+	return modelInfo, err
+}
+
+func (b *reconnectingBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return backend.ModelInfo{}, err
+	}
+	modelInfo, err := current.RetrieveModelInfo(modelID)
+	b.checkError(connected, err)
+	return modelInfo, err
+}
+
+func (b *reconnectingBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return 0, err
+	}
+	versionNumber, err := current.RetrieveModelLatestVersionNumber(modelID)
+	b.checkError(connected, err)
+	return versionNumber, err
+}
+
+func (b *reconnectingBackend) HasModel(modelID string) (bool, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return false, err
+	}
+	hasModel, err := current.HasModel(modelID)
+	b.checkError(connected, err)
+	return hasModel, err
+}
+
+func (b *reconnectingBackend) DeleteModel(modelID string) error {
+	connected, current, err := b.current()
+	if err != nil {
+		return err
+	}
+	err = current.DeleteModel(modelID)
+	b.checkError(connected, err)
+	return err
+}
+
+func (b *reconnectingBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return nil, err
+	}
+	modelInfos, err := current.ListModels(offset, limit)
+	b.checkError(connected, err)
+	return modelInfos, err
+}
+
+func (b *reconnectingBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return nil, err
+	}
+	modelInfos, err := current.QueryModels(filter, offset, limit)
+	b.checkError(connected, err)
+	return modelInfos, err
+}
+
+func (b *reconnectingBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := current.CreateOrUpdateModelVersion(modelID, versionArgs)
+	b.checkError(connected, err)
+	return versionInfo, err
+}
+
+func (b *reconnectingBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return nil, err
+	}
+	writer, err := current.CreateOrUpdateModelVersionStream(modelID, versionArgs)
+	b.checkError(connected, err)
+	return writer, err
+}
+
+func (b *reconnectingBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := current.RetrieveModelVersionInfo(modelID, versionNumber)
+	b.checkError(connected, err)
+	return versionInfo, err
+}
+
+func (b *reconnectingBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return nil, err
+	}
+	data, err := current.RetrieveModelVersionData(modelID, versionNumber)
+	b.checkError(connected, err)
+	return data, err
+}
+
+func (b *reconnectingBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return nil, err
+	}
+	data, err := current.RetrieveModelVersionDataRange(modelID, versionNumber, offset, length)
+	b.checkError(connected, err)
+	return data, err
+}
+
+func (b *reconnectingBackend) OpenModelVersionData(modelID string, versionNumber int) (backend.VersionInfo, backend.VersionDataReader, bool, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return backend.VersionInfo{}, nil, false, err
+	}
+	versionInfo, reader, opened, err := backend.OpenModelVersionData(current, modelID, versionNumber)
+	b.checkError(connected, err)
+	return versionInfo, reader, opened, err
+}
+
+func (b *reconnectingBackend) PresignModelVersionData(modelID string, versionNumber int, expiration time.Duration) (backend.VersionInfo, string, bool, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return backend.VersionInfo{}, "", false, err
+	}
+	versionInfo, url, presigned, err := backend.PresignModelVersionData(current, modelID, versionNumber, expiration)
+	b.checkError(connected, err)
+	return versionInfo, url, presigned, err
+}
+
+func (b *reconnectingBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := current.UpdateModelVersionArchived(modelID, versionNumber, archived)
+	b.checkError(connected, err)
+	return versionInfo, err
+}
+
+func (b *reconnectingBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := current.UpdateModelVersionUserData(modelID, versionNumber, userData)
+	b.checkError(connected, err)
+	return versionInfo, err
+}
+
+func (b *reconnectingBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	connected, current, err := b.current()
+	if err != nil {
+		return err
+	}
+	err = current.DeleteModelVersion(modelID, versionNumber)
+	b.checkError(connected, err)
+	return err
+}
+
+func (b *reconnectingBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return nil, err
+	}
+	versionInfos, err := current.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+	b.checkError(connected, err)
+	return versionInfos, err
+}
+
+func (b *reconnectingBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return nil, err
+	}
+	versionInfos, err := current.QueryModelVersionInfos(modelID, filter, initialVersionNumber, limit)
+	b.checkError(connected, err)
+	return versionInfos, err
+}
+
+func (b *reconnectingBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	connected, current, err := b.current()
+	if err != nil {
+		return backend.StorageCapacity{}, err
+	}
+	storageCapacity, err := current.RetrieveStorageCapacity()
+	b.checkError(connected, err)
+	return storageCapacity, err
+}
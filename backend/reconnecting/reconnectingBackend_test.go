@@ -0,0 +1,140 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reconnecting
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var testConfiguration = Configuration{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+
+func TestSuiteReconnectingBackend(t *testing.T) {
+	test.RunSuite(t, func() backend.Backend {
+		rootDirname := t.TempDir()
+		return CreateBackend("fs", func() (backend.Backend, error) {
+			return fs.CreateBackend(rootDirname)
+		}, testConfiguration)
+	}, func(b backend.Backend) {
+		b.Destroy()
+	})
+}
+
+// network simulates the reachability of a networked backend
+type network struct {
+	unreachable int32
+	creations   int32
+}
+
+func (n *network) setReachable(reachable bool) {
+	if reachable {
+		atomic.StoreInt32(&n.unreachable, 0)
+	} else {
+		atomic.StoreInt32(&n.unreachable, 1)
+	}
+}
+
+func (n *network) check() error {
+	if atomic.LoadInt32(&n.unreachable) == 1 {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+type networkedBackend struct {
+	backend.Backend
+	network *network
+}
+
+func (b *networkedBackend) Ping() error {
+	return b.network.check()
+}
+
+func (b *networkedBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	if err := b.network.check(); err != nil {
+		return backend.ModelInfo{}, err
+	}
+	return b.Backend.RetrieveModelInfo(modelID)
+}
+
+func createNetworkedBackend(t *testing.T, n *network) func() (backend.Backend, error) {
+	fsBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	_, err = fsBackend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	return func() (backend.Backend, error) {
+		if err := n.check(); err != nil {
+			return nil, err
+		}
+		atomic.AddInt32(&n.creations, 1)
+		return &networkedBackend{Backend: fsBackend, network: n}, nil
+	}
+}
+
+func TestReconnection(t *testing.T) {
+	n := &network{}
+	b := CreateBackend("test", createNetworkedBackend(t, n), testConfiguration)
+	defer b.Destroy()
+	_, err := b.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+
+	n.setReachable(false)
+	_, err = b.RetrieveModelInfo("foo")
+	assert.EqualError(t, err, "connection refused")
+	// The failed operation disconnects the backend once the ping fails
+	assert.Eventually(t, func() bool {
+		_, err := b.RetrieveModelInfo("foo")
+		return errors.As(err, new(*UnavailableError))
+	}, time.Second, 5*time.Millisecond)
+	assert.Error(t, b.Ping())
+
+	n.setReachable(true)
+	assert.Eventually(t, func() bool { return b.Ping() == nil }, time.Second, 5*time.Millisecond)
+	_, err = b.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&n.creations))
+
+	// Errors about the models don't disconnect the backend
+	_, err = b.RetrieveModelInfo("bar")
+	assert.ErrorAs(t, err, new(*backend.UnknownModelError))
+	assert.NoError(t, b.Ping())
+}
+
+func TestFailedCreation(t *testing.T) {
+	n := &network{}
+	create := createNetworkedBackend(t, n)
+	n.setReachable(false)
+	b := CreateBackend("test", create, testConfiguration)
+	defer b.Destroy()
+
+	_, err := b.RetrieveModelInfo("foo")
+	unavailableErr := &UnavailableError{}
+	assert.ErrorAs(t, err, &unavailableErr)
+	assert.Equal(t, "the test backend is unavailable, reconnecting: connection refused", unavailableErr.Error())
+
+	n.setReachable(true)
+	assert.Eventually(t, func() bool {
+		_, err := b.RetrieveModelInfo("foo")
+		return err == nil
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&n.creations))
+}
@@ -0,0 +1,670 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/go-redis/redis/v8"
+)
+
+// Configuration defines how to connect to a Redis server and how versions are stored
+type Configuration struct {
+	Address  string // Address of the server, e.g. "localhost:6379"
+	Password string // Optional
+	DB       int
+	Prefix   string        // Optional, prefix of all the keys
+	TTL      time.Duration // Optional, when > 0 the versions expire after this duration
+}
+
+// Maximum number of attempts of an optimistic transaction before giving up
+const maxTransactionAttempts = 10
+
+// transactionRetryDelay is the randomized, growing, delay before retrying a conflicting transaction, the concurrent
+// writers retrying at once would conflict again
+func transactionRetryDelay(attempt int) time.Duration {
+	return time.Duration(rand.Int63n(int64(time.Millisecond) << attempt))
+}
+
+type redisModelInfo struct {
+	ModelID  string            `json:"model_id"`
+	UserData map[string]string `json:"user_data"`
+}
+
+type redisVersionInfo struct {
+	ModelID           string            `json:"model_id"`
+	VersionNumber     uint              `json:"version_number"`
+	CreationTimestamp time.Time         `json:"creation_timestamp"`
+	Archived          bool              `json:"archived"`
+	DataHash          string            `json:"data_hash"`
+	DataSize          int               `json:"data_size"`
+	UserData          map[string]string `json:"user_data"`
+}
+
+func (v redisVersionInfo) toVersionInfo() backend.VersionInfo {
+	return backend.VersionInfo{
+		ModelID:           v.ModelID,
+		VersionNumber:     v.VersionNumber,
+		CreationTimestamp: v.CreationTimestamp,
+		Archived:          v.Archived,
+		DataHash:          v.DataHash,
+		DataSize:          v.DataSize,
+		UserData:          v.UserData,
+	}
+}
+
+type redisBackend struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// CreateBackend creates a new backend storing models and versions in Redis
+//
+// When a secondary backend is provided every write goes through to it and it is used when a version is missing
+// from Redis, e.g. because it expired. The secondary backend is not destroyed with the created backend.
+func CreateBackend(configuration Configuration, secondary backend.Backend) (backend.Backend, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     configuration.Address,
+		Password: configuration.Password,
+		DB:       configuration.DB,
+	})
+	err := client.Ping(context.Background()).Err()
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("unable to create redis backend: unable to connect to %q: %w", configuration.Address, err)
+	}
+	redisBackend := &redisBackend{
+		client: client,
+		prefix: configuration.Prefix,
+		ttl:    configuration.TTL,
+	}
+	if secondary == nil {
+		return redisBackend, nil
+	}
+	return &writeThroughBackend{
+		cache:     redisBackend,
+		secondary: secondary,
+	}, nil
+}
+
+// Destroy terminates the underlying storage
+func (b *redisBackend) Destroy() {
+	b.client.Close()
+}
+
+func (b *redisBackend) Ping() error {
+	return b.client.Ping(context.Background()).Err()
+}
+
+// Keys layout, the models ids are members of a sorted set with a constant score to be ordered lexicographically and
+// each model has its own keys, tagged with its id between braces to avoid collisions and to be in the same cluster slot
+func (b *redisBackend) modelKeysPrefix(modelID string) string {
+	return b.prefix + "model:{" + modelID + "}"
+}
+
+func (b *redisBackend) modelsKey() string {
+	return b.prefix + "models"
+}
+
+func (b *redisBackend) modelInfoKey(modelID string) string {
+	return b.modelKeysPrefix(modelID)
+}
+
+func (b *redisBackend) versionsKey(modelID string) string {
+	return b.modelKeysPrefix(modelID) + ":versions"
+}
+
+func (b *redisBackend) lastVersionNumberKey(modelID string) string {
+	return b.modelKeysPrefix(modelID) + ":last_version_number"
+}
+
+func (b *redisBackend) versionInfoKey(modelID string, versionNumber uint) string {
+	return fmt.Sprintf("%s:version:%d", b.modelKeysPrefix(modelID), versionNumber)
+}
+
+func (b *redisBackend) versionDataKey(modelID string, versionNumber uint) string {
+	return fmt.Sprintf("%s:version:%d:data", b.modelKeysPrefix(modelID), versionNumber)
+}
+
+func (b *redisBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	modelInfo := backend.ModelInfo{
+		ModelID:  modelArgs.ModelID,
+		UserData: modelArgs.UserData,
+	}
+	serializedModelInfo, err := json.Marshal(redisModelInfo{
+		ModelID:  modelInfo.ModelID,
+		UserData: modelInfo.UserData,
+	})
+	if err != nil {
+		return backend.ModelInfo{}, fmt.Errorf("unable to save model %q: json serialization failed %w", modelInfo.ModelID, err)
+	}
+	ctx := context.Background()
+	_, err = b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, b.modelInfoKey(modelInfo.ModelID), serializedModelInfo, 0)
+		pipe.ZAdd(ctx, b.modelsKey(), &redis.Z{Score: 0, Member: modelInfo.ModelID})
+		return nil
+	})
+	if err != nil {
+		return backend.ModelInfo{}, fmt.Errorf("unable to save model %q: %w", modelInfo.ModelID, err)
+	}
+	return modelInfo, nil
+}
+
+func (b *redisBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	serializedModelInfo, err := b.client.Get(context.Background(), b.modelInfoKey(modelID)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return backend.ModelInfo{}, &backend.UnknownModelError{ModelID: modelID}
+		}
+		return backend.ModelInfo{}, fmt.Errorf("unable to retrieve model %q: %w", modelID, err)
+	}
+	modelInfo := redisModelInfo{}
+	err = json.Unmarshal(serializedModelInfo, &modelInfo)
+	if err != nil {
+		return backend.ModelInfo{}, fmt.Errorf("unable to retrieve model %q: json deserialization failed %w", modelID, err)
+	}
+	return backend.ModelInfo{
+		ModelID:  modelInfo.ModelID,
+		UserData: modelInfo.UserData,
+	}, nil
+}
+
+// listVersionNumbers lists the version numbers of a model in ascending order, leaving out the expired ones
+func (b *redisBackend) listVersionNumbers(modelID string) ([]uint, error) {
+	hasModel, err := b.HasModel(modelID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasModel {
+		return nil, &backend.UnknownModelError{ModelID: modelID}
+	}
+	ctx := context.Background()
+	members, err := b.client.ZRange(ctx, b.versionsKey(modelID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list versions of model %q: %w", modelID, err)
+	}
+	versionNumbers := make([]uint, 0, len(members))
+	for _, member := range members {
+		// Parsing the version number, we ignore the error as members are only added by the backend
+		versionNumber, _ := strconv.ParseUint(member, 10, 0)
+		versionNumbers = append(versionNumbers, uint(versionNumber))
+	}
+	if b.ttl <= 0 {
+		return versionNumbers, nil
+	}
+
+	// Versions can expire, checking which ones are still there and forgetting about the others
+	existsCmds := make([]*redis.IntCmd, len(versionNumbers))
+	_, err = b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for idx, versionNumber := range versionNumbers {
+			existsCmds[idx] = pipe.Exists(ctx, b.versionInfoKey(modelID, versionNumber))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list versions of model %q: %w", modelID, err)
+	}
+	liveVersionNumbers := make([]uint, 0, len(versionNumbers))
+	expiredMembers := []interface{}{}
+	for idx, versionNumber := range versionNumbers {
+		if existsCmds[idx].Val() > 0 {
+			liveVersionNumbers = append(liveVersionNumbers, versionNumber)
+		} else {
+			expiredMembers = append(expiredMembers, strconv.FormatUint(uint64(versionNumber), 10))
+		}
+	}
+	if len(expiredMembers) > 0 {
+		err = b.client.ZRem(ctx, b.versionsKey(modelID), expiredMembers...).Err()
+		if err != nil {
+			return nil, fmt.Errorf("unable to list versions of model %q: %w", modelID, err)
+		}
+	}
+	return liveVersionNumbers, nil
+}
+
+func (b *redisBackend) resolveVersionNumber(modelID string, versionNumber int) (uint, error) {
+	if versionNumber == 0 {
+		return 0, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	if versionNumber > 0 {
+		return uint(versionNumber), nil
+	}
+	// Retrieve the nth to last version
+	versionNumbers, err := b.listVersionNumbers(modelID)
+	if err != nil {
+		return 0, err
+	}
+	nthToLastIndex := -versionNumber - 1
+	if nthToLastIndex >= len(versionNumbers) {
+		return 0, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	return versionNumbers[len(versionNumbers)-1-nthToLastIndex], nil
+}
+
+// loadVersionInfo retrieves the info of a version, client is the transaction when within one, it holds a connection of
+// the pool and waiting for another one can exhaust it
+func (b *redisBackend) loadVersionInfo(client redis.Cmdable, modelID string, versionNumber uint) (redisVersionInfo, error) {
+	serializedVersionInfo, err := client.Get(context.Background(), b.versionInfoKey(modelID, versionNumber)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return redisVersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: int(versionNumber)}
+		}
+		return redisVersionInfo{}, fmt.Errorf(`unable to retrieve model %q version "%d" info: %w`, modelID, versionNumber, err)
+	}
+	versionInfo := redisVersionInfo{}
+	err = json.Unmarshal(serializedVersionInfo, &versionInfo)
+	if err != nil {
+		return redisVersionInfo{}, fmt.Errorf(`unable to retrieve model %q version "%d" info: json deserialization failed %w`, modelID, versionNumber, err)
+	}
+	return versionInfo, nil
+}
+
+func (b *redisBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	versionNumbers, err := b.listVersionNumbers(modelID)
+	if err != nil {
+		return 0, err
+	}
+	if len(versionNumbers) == 0 {
+		return 0, nil
+	}
+	return versionNumbers[len(versionNumbers)-1], nil
+}
+
+// HasModel checks if a model exists
+func (b *redisBackend) HasModel(modelID string) (bool, error) {
+	count, err := b.client.Exists(context.Background(), b.modelInfoKey(modelID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("unable to check model %q existence: %w", modelID, err)
+	}
+	return count > 0, nil
+}
+
+// DeleteModel deletes a model with a given id from the storage
+func (b *redisBackend) DeleteModel(modelID string) error {
+	hasModel, err := b.HasModel(modelID)
+	if err != nil {
+		return err
+	}
+	if !hasModel {
+		return &backend.UnknownModelError{ModelID: modelID}
+	}
+	ctx := context.Background()
+	members, err := b.client.ZRange(ctx, b.versionsKey(modelID), 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("unable to delete model %q: %w", modelID, err)
+	}
+	keys := []string{b.modelInfoKey(modelID), b.versionsKey(modelID), b.lastVersionNumberKey(modelID)}
+	for _, member := range members {
+		versionNumber, _ := strconv.ParseUint(member, 10, 0)
+		keys = append(keys, b.versionInfoKey(modelID, uint(versionNumber)), b.versionDataKey(modelID, uint(versionNumber)))
+	}
+	_, err = b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, b.modelsKey(), modelID)
+		pipe.Del(ctx, keys...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete model %q: %w", modelID, err)
+	}
+	return nil
+}
+
+// ListModels list models ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *redisBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(offset + limit - 1)
+	}
+	modelIDs, err := b.client.ZRange(context.Background(), b.modelsKey(), int64(offset), stop).Result()
+	if err != nil {
+		return []backend.ModelInfo{}, fmt.Errorf("unable to list models: %w", err)
+	}
+	models := []backend.ModelInfo{}
+	for _, modelID := range modelIDs {
+		modelInfo, err := b.RetrieveModelInfo(modelID)
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				// Deleted in the meantime
+				continue
+			}
+			return []backend.ModelInfo{}, err
+		}
+		models = append(models, modelInfo)
+	}
+	return models, nil
+}
+
+// QueryModels list models selected by the filter ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *redisBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return backend.QueryModelsByListing(b, filter, offset, limit)
+}
+
+// CreateOrUpdateModelVersion creates and store a new version for a model and returns its info, including the version number
+//
+// The creation happens in an optimistic transaction to guarantee the uniqueness of the version numbers
+func (b *redisBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	ctx := context.Background()
+	var versionInfo redisVersionInfo
+	transaction := func(tx *redis.Tx) error {
+		hasModel, err := tx.Exists(ctx, b.modelInfoKey(modelID)).Result()
+		if err != nil {
+			return err
+		}
+		if hasModel == 0 {
+			return &backend.UnknownModelError{ModelID: modelID}
+		}
+
+		versionInfo = redisVersionInfo{
+			ModelID:           modelID,
+			VersionNumber:     versionArgs.VersionNumber,
+			CreationTimestamp: versionArgs.CreationTimestamp,
+			Archived:          versionArgs.Archived,
+			DataHash:          versionArgs.DataHash,
+			DataSize:          len(versionArgs.Data),
+			UserData:          versionArgs.UserData,
+		}
+		lastVersionNumber, err := tx.Get(ctx, b.lastVersionNumberKey(modelID)).Uint64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if versionInfo.VersionNumber == 0 {
+			// Create a new version after the last one, even if it expired
+			versionInfo.VersionNumber = uint(lastVersionNumber) + 1
+		} else {
+			existingVersionInfo, err := b.loadVersionInfo(tx, modelID, versionInfo.VersionNumber)
+			if err == nil {
+				// Update an existing version
+				versionInfo.CreationTimestamp = existingVersionInfo.CreationTimestamp
+			} else if !errors.As(err, new(*backend.UnknownModelVersionError)) {
+				return err
+			}
+		}
+
+		serializedVersionInfo, err := json.Marshal(versionInfo)
+		if err != nil {
+			return fmt.Errorf("json serialization failed %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, b.versionInfoKey(modelID, versionInfo.VersionNumber), serializedVersionInfo, b.ttl)
+			pipe.Set(ctx, b.versionDataKey(modelID, versionInfo.VersionNumber), versionArgs.Data, b.ttl)
+			pipe.ZAdd(ctx, b.versionsKey(modelID), &redis.Z{Score: float64(versionInfo.VersionNumber), Member: versionInfo.VersionNumber})
+			if uint64(versionInfo.VersionNumber) > lastVersionNumber {
+				pipe.Set(ctx, b.lastVersionNumberKey(modelID), versionInfo.VersionNumber, 0)
+			}
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < maxTransactionAttempts; attempt++ {
+		watchedKeys := []string{b.modelInfoKey(modelID), b.lastVersionNumberKey(modelID)}
+		if versionArgs.VersionNumber > 0 {
+			watchedKeys = append(watchedKeys, b.versionInfoKey(modelID, versionArgs.VersionNumber))
+		}
+		err := b.client.Watch(ctx, transaction, watchedKeys...)
+		if errors.Is(err, redis.TxFailedErr) {
+			// Concurrent modification, retrying
+			time.Sleep(transactionRetryDelay(attempt))
+			continue
+		}
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				return backend.VersionInfo{}, err
+			}
+			return backend.VersionInfo{}, fmt.Errorf("unable to create a version for model %q: %w", modelID, err)
+		}
+		return versionInfo.toVersionInfo(), nil
+	}
+	return backend.VersionInfo{}, fmt.Errorf("unable to create a version for model %q: too many concurrent modifications", modelID)
+}
+
+// CreateOrUpdateModelVersionStream creates a writer accumulating the data in memory, it is stored in a single transaction on commit
+func (b *redisBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	hasModel, err := b.HasModel(modelID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasModel {
+		return nil, &backend.UnknownModelError{ModelID: modelID}
+	}
+	return backend.CreateBufferedVersionDataWriter(b, modelID, versionArgs), nil
+}
+
+// RetrieveModelVersionInfo retrieves a given model version info
+func (b *redisBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := b.loadVersionInfo(b.client, modelID, resolvedVersionNumber)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return backend.VersionInfo{}, err
+	}
+	return versionInfo.toVersionInfo(), nil
+}
+
+// RetrieveModelVersionData retrieves a given model version data
+func (b *redisBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	versionData, err := b.client.Get(context.Background(), b.versionDataKey(modelID, resolvedVersionNumber)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return []byte{}, fmt.Errorf(`unable to read data for model %q version "%d": %w`, modelID, resolvedVersionNumber, err)
+	}
+	return versionData, nil
+}
+
+// RetrieveModelVersionDataRange retrieves a range of a given model version data, only this range is transferred from Redis
+func (b *redisBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	ctx := context.Background()
+	versionDataKey := b.versionDataKey(modelID, resolvedVersionNumber)
+	// GETRANGE end offset is inclusive, -1 being the last byte
+	end := int64(-1)
+	if length > 0 {
+		end = int64(offset + length - 1)
+	}
+	var existsCmd, sizeCmd *redis.IntCmd
+	var rangeCmd *redis.StringCmd
+	_, err = b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		existsCmd = pipe.Exists(ctx, versionDataKey)
+		sizeCmd = pipe.StrLen(ctx, versionDataKey)
+		rangeCmd = pipe.GetRange(ctx, versionDataKey, int64(offset), end)
+		return nil
+	})
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to read data for model %q version "%d": %w`, modelID, resolvedVersionNumber, err)
+	}
+	if existsCmd.Val() == 0 {
+		return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	if _, err := backend.ResolveDataRange(modelID, versionNumber, uint64(sizeCmd.Val()), offset, length); err != nil {
+		return []byte{}, err
+	}
+	versionData, err := rangeCmd.Bytes()
+	if err != nil {
+		return []byte{}, fmt.Errorf(`unable to read data for model %q version "%d": %w`, modelID, resolvedVersionNumber, err)
+	}
+	return versionData, nil
+}
+
+// UpdateModelVersionArchived changes whether a given model version is archived, its data and expiration are left untouched
+func (b *redisBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	ctx := context.Background()
+	versionInfoKey := b.versionInfoKey(modelID, resolvedVersionNumber)
+	var versionInfo redisVersionInfo
+	transaction := func(tx *redis.Tx) error {
+		versionInfo, err = b.loadVersionInfo(tx, modelID, resolvedVersionNumber)
+		if err != nil {
+			return err
+		}
+		versionInfo.Archived = archived
+		serializedVersionInfo, err := json.Marshal(versionInfo)
+		if err != nil {
+			return fmt.Errorf("json serialization failed %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, versionInfoKey, serializedVersionInfo, redis.KeepTTL)
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < maxTransactionAttempts; attempt++ {
+		err := b.client.Watch(ctx, transaction, versionInfoKey)
+		if errors.Is(err, redis.TxFailedErr) {
+			// Concurrent modification, retrying
+			time.Sleep(transactionRetryDelay(attempt))
+			continue
+		}
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelVersionError)) {
+				return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+			}
+			return backend.VersionInfo{}, fmt.Errorf(`unable to update model %q version "%d": %w`, modelID, resolvedVersionNumber, err)
+		}
+		return versionInfo.toVersionInfo(), nil
+	}
+	return backend.VersionInfo{}, fmt.Errorf(`unable to update model %q version "%d": too many concurrent modifications`, modelID, resolvedVersionNumber)
+}
+
+// UpdateModelVersionUserData replaces the user data of a given model version, its data and expiration are left untouched
+func (b *redisBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	ctx := context.Background()
+	versionInfoKey := b.versionInfoKey(modelID, resolvedVersionNumber)
+	var versionInfo redisVersionInfo
+	transaction := func(tx *redis.Tx) error {
+		versionInfo, err = b.loadVersionInfo(tx, modelID, resolvedVersionNumber)
+		if err != nil {
+			return err
+		}
+		versionInfo.UserData = userData
+		serializedVersionInfo, err := json.Marshal(versionInfo)
+		if err != nil {
+			return fmt.Errorf("json serialization failed %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, versionInfoKey, serializedVersionInfo, redis.KeepTTL)
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < maxTransactionAttempts; attempt++ {
+		err := b.client.Watch(ctx, transaction, versionInfoKey)
+		if errors.Is(err, redis.TxFailedErr) {
+			// Concurrent modification, retrying
+			time.Sleep(transactionRetryDelay(attempt))
+			continue
+		}
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelVersionError)) {
+				return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+			}
+			return backend.VersionInfo{}, fmt.Errorf(`unable to update model %q version "%d": %w`, modelID, resolvedVersionNumber, err)
+		}
+		return versionInfo.toVersionInfo(), nil
+	}
+	return backend.VersionInfo{}, fmt.Errorf(`unable to update model %q version "%d": too many concurrent modifications`, modelID, resolvedVersionNumber)
+}
+
+// DeleteModelVersion deletes a given model version
+func (b *redisBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	var deleteCmd *redis.IntCmd
+	_, err = b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		deleteCmd = pipe.Del(ctx, b.versionInfoKey(modelID, resolvedVersionNumber), b.versionDataKey(modelID, resolvedVersionNumber))
+		pipe.ZRem(ctx, b.versionsKey(modelID), strconv.FormatUint(uint64(resolvedVersionNumber), 10))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf(`unable to delete model %q version "%d": %w`, modelID, resolvedVersionNumber, err)
+	}
+	if deleteCmd.Val() == 0 {
+		return &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	return nil
+}
+
+func (b *redisBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	versionNumbers, err := b.listVersionNumbers(modelID)
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+
+	versions := []backend.VersionInfo{}
+	for _, versionNumber := range versionNumbers {
+		if versionNumber < initialVersionNumber {
+			continue
+		}
+		versionInfo, err := b.loadVersionInfo(b.client, modelID, versionNumber)
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelVersionError)) {
+				// Deleted or expired in the meantime
+				continue
+			}
+			return []backend.VersionInfo{}, err
+		}
+		versions = append(versions, versionInfo.toVersionInfo())
+		if limit > 0 && len(versions) >= limit {
+			break
+		}
+	}
+	return versions, nil
+}
+
+// QueryModelVersionInfos lists the versions selected by the filter ordered by version number from the given initial version number, it returns at most the given limit number of versions
+func (b *redisBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return backend.QueryModelVersionInfosByListing(b, modelID, filter, initialVersionNumber, limit)
+}
+
+// RetrieveStorageCapacity retrieves an unknown capacity, Redis being bounded by its memory configuration
+func (b *redisBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return backend.StorageCapacity{}, nil
+}
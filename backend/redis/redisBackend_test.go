@@ -0,0 +1,108 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuiteRedisBackend(t *testing.T) {
+	test.RunSuite(t, func() backend.Backend {
+		server := miniredis.RunT(t)
+		b, err := CreateBackend(Configuration{Address: server.Addr()}, nil)
+		assert.NoError(t, err)
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+	})
+}
+
+func TestSuiteRedisBackendWithSecondary(t *testing.T) {
+	test.RunSuite(t, func() backend.Backend {
+		server := miniredis.RunT(t)
+		secondary, err := fs.CreateBackend(t.TempDir())
+		assert.NoError(t, err)
+		b, err := CreateBackend(Configuration{Address: server.Addr(), TTL: time.Minute}, secondary)
+		assert.NoError(t, err)
+		return b
+	}, func(b backend.Backend) {
+		b.(*writeThroughBackend).secondary.Destroy()
+		b.Destroy()
+	})
+}
+
+func TestRedisBackendTTL(t *testing.T) {
+	server := miniredis.RunT(t)
+	b, err := CreateBackend(Configuration{Address: server.Addr(), Prefix: "test:", TTL: time.Minute}, nil)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	versionInfo, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: []byte("bar")})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+
+	server.FastForward(2 * time.Minute)
+
+	_, err = b.RetrieveModelVersionData("foo", 1)
+	assert.Error(t, err)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+	_, err = b.RetrieveModelVersionInfo("foo", -1)
+	assert.Error(t, err)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+	versionInfos, err := b.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 0)
+
+	// The models don't expire and the version numbers of expired versions aren't reused
+	modelInfo, err := b.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", modelInfo.ModelID)
+	versionInfo, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: []byte("baz")})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), versionInfo.VersionNumber)
+}
+
+func TestRedisBackendTTLWithSecondary(t *testing.T) {
+	server := miniredis.RunT(t)
+	secondary, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer secondary.Destroy()
+	b, err := CreateBackend(Configuration{Address: server.Addr(), TTL: time.Minute}, secondary)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: []byte("bar")})
+	assert.NoError(t, err)
+
+	server.FastForward(2 * time.Minute)
+	assert.False(t, server.Exists("model:{foo}:version:1:data"))
+
+	// The expired version is retrieved from the secondary backend and cached again
+	versionData, err := b.RetrieveModelVersionData("foo", -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), versionData)
+	assert.True(t, server.Exists("model:{foo}:version:1:data"))
+}
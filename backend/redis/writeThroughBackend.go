@@ -0,0 +1,320 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/sirupsen/logrus"
+)
+
+// writeThroughBackend writes to both a cache and a durable secondary backend, reads are served by the cache when possible
+//
+// The secondary backend is the reference, listings and version numbers resolution are delegated to it.
+type writeThroughBackend struct {
+	cache     backend.Backend
+	secondary backend.Backend
+}
+
+// BindContext binds the secondary backend to the context, the operations on the cache are short and aren't bound
+func (b *writeThroughBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	boundSecondary, ok := backend.BindContext(b.secondary, ctx)
+	if !ok {
+		return nil, false
+	}
+	return &writeThroughBackend{cache: b.cache, secondary: boundSecondary}, true
+}
+
+// Destroy terminates the cache, the secondary backend is left untouched
+func (b *writeThroughBackend) Destroy() {
+	b.cache.Destroy()
+}
+
+func (b *writeThroughBackend) Ping() error {
+	if err := b.cache.Ping(); err != nil {
+		return err
+	}
+	return b.secondary.Ping()
+}
+
+func (b *writeThroughBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	modelInfo, err := b.secondary.CreateOrUpdateModel(modelArgs)
+	if err != nil {
+		return backend.ModelInfo{}, err
+	}
+	_, err = b.cache.CreateOrUpdateModel(modelInfo)
+	if err != nil {
+		return backend.ModelInfo{}, err
+	}
+	return modelInfo, nil
+}
+
+func (b *writeThroughBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	modelInfo, err := b.cache.RetrieveModelInfo(modelID)
+	if err == nil {
+		return modelInfo, nil
+	}
+	if !errors.As(err, new(*backend.UnknownModelError)) {
+		return backend.ModelInfo{}, err
+	}
+	modelInfo, err = b.secondary.RetrieveModelInfo(modelID)
+	if err != nil {
+		return backend.ModelInfo{}, err
+	}
+	_, err = b.cache.CreateOrUpdateModel(modelInfo)
+	if err != nil {
+		logrus.WithField("model_id", modelID).WithError(err).Warn("unable to cache a model")
+	}
+	return modelInfo, nil
+}
+
+func (b *writeThroughBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	return b.secondary.RetrieveModelLatestVersionNumber(modelID)
+}
+
+// HasModel checks if a model exists
+func (b *writeThroughBackend) HasModel(modelID string) (bool, error) {
+	return b.secondary.HasModel(modelID)
+}
+
+// DeleteModel deletes a model with a given id from both storages
+func (b *writeThroughBackend) DeleteModel(modelID string) error {
+	err := b.secondary.DeleteModel(modelID)
+	if err != nil {
+		return err
+	}
+	err = b.cache.DeleteModel(modelID)
+	if err != nil && !errors.As(err, new(*backend.UnknownModelError)) {
+		return err
+	}
+	return nil
+}
+
+// ListModels list models ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *writeThroughBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.secondary.ListModels(offset, limit)
+}
+
+// QueryModels list models selected by the filter ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *writeThroughBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.secondary.QueryModels(filter, offset, limit)
+}
+
+// cacheVersion stores a version of the secondary backend in the cache, the failures are only logged
+func (b *writeThroughBackend) cacheVersion(versionInfo backend.VersionInfo, versionData []byte) {
+	hasModel, err := b.cache.HasModel(versionInfo.ModelID)
+	if err == nil && !hasModel {
+		var modelInfo backend.ModelInfo
+		modelInfo, err = b.secondary.RetrieveModelInfo(versionInfo.ModelID)
+		if err == nil {
+			_, err = b.cache.CreateOrUpdateModel(modelInfo)
+		}
+	}
+	if err == nil {
+		_, err = b.cache.CreateOrUpdateModelVersion(versionInfo.ModelID, backend.VersionArgs{
+			VersionNumber:     versionInfo.VersionNumber,
+			CreationTimestamp: versionInfo.CreationTimestamp,
+			Archived:          versionInfo.Archived,
+			DataHash:          versionInfo.DataHash,
+			Data:              versionData,
+			UserData:          versionInfo.UserData,
+		})
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"model_id": versionInfo.ModelID, "version_number": versionInfo.VersionNumber}).WithError(err).Warn("unable to cache a version")
+		// Making sure a previous value of the version isn't served anymore
+		_ = b.cache.DeleteModelVersion(versionInfo.ModelID, int(versionInfo.VersionNumber))
+	}
+}
+
+// CreateOrUpdateModelVersion creates and store a new version for a model and returns its info, including the version number
+func (b *writeThroughBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	versionInfo, err := b.secondary.CreateOrUpdateModelVersion(modelID, versionArgs)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	b.cacheVersion(versionInfo, versionArgs.Data)
+	return versionInfo, nil
+}
+
+type writeThroughVersionDataWriter struct {
+	backend         *writeThroughBackend
+	secondaryWriter backend.VersionDataWriter
+	data            bytes.Buffer
+}
+
+func (w *writeThroughVersionDataWriter) Write(data []byte) (int, error) {
+	n, err := w.secondaryWriter.Write(data)
+	_, _ = w.data.Write(data[:n])
+	return n, err
+}
+
+func (w *writeThroughVersionDataWriter) Commit() (backend.VersionInfo, error) {
+	versionInfo, err := w.secondaryWriter.Commit()
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	w.backend.cacheVersion(versionInfo, w.data.Bytes())
+	return versionInfo, nil
+}
+
+func (w *writeThroughVersionDataWriter) Abort() error {
+	return w.secondaryWriter.Abort()
+}
+
+// CreateOrUpdateModelVersionStream creates a writer streaming the data to the secondary backend, it is cached on commit
+func (b *writeThroughBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	secondaryWriter, err := b.secondary.CreateOrUpdateModelVersionStream(modelID, versionArgs)
+	if err != nil {
+		return nil, err
+	}
+	return &writeThroughVersionDataWriter{
+		backend:         b,
+		secondaryWriter: secondaryWriter,
+	}, nil
+}
+
+// resolveVersionNumber retrieves the actual number of a version, the nth to last versions are resolved by the secondary backend
+func (b *writeThroughBackend) resolveVersionNumber(modelID string, versionNumber int) (int, error) {
+	if versionNumber >= 0 {
+		return versionNumber, nil
+	}
+	versionInfo, err := b.secondary.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return 0, err
+	}
+	return int(versionInfo.VersionNumber), nil
+}
+
+// RetrieveModelVersionInfo retrieves a given model version info
+func (b *writeThroughBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	if versionNumber < 0 {
+		return b.secondary.RetrieveModelVersionInfo(modelID, versionNumber)
+	}
+	versionInfo, err := b.cache.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err == nil {
+		return versionInfo, nil
+	}
+	return b.secondary.RetrieveModelVersionInfo(modelID, versionNumber)
+}
+
+// RetrieveModelVersionData retrieves a given model version data, caching it if needed
+func (b *writeThroughBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	versionData, err := b.cache.RetrieveModelVersionData(modelID, resolvedVersionNumber)
+	if err == nil {
+		return versionData, nil
+	}
+	versionInfo, err := b.secondary.RetrieveModelVersionInfo(modelID, resolvedVersionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	versionData, err = b.secondary.RetrieveModelVersionData(modelID, resolvedVersionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	b.cacheVersion(versionInfo, versionData)
+	return versionData, nil
+}
+
+// RetrieveModelVersionDataRange retrieves a range of a given model version data, the version isn't cached when missing
+func (b *writeThroughBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	versionData, err := b.cache.RetrieveModelVersionDataRange(modelID, resolvedVersionNumber, offset, length)
+	if err == nil {
+		return versionData, nil
+	}
+	if errors.As(err, new(*backend.InvalidDataRangeError)) {
+		return []byte{}, err
+	}
+	return b.secondary.RetrieveModelVersionDataRange(modelID, resolvedVersionNumber, offset, length)
+}
+
+// UpdateModelVersionArchived changes whether a given model version is archived in the secondary storage, then in the cache if it holds the version
+func (b *writeThroughBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := b.secondary.UpdateModelVersionArchived(modelID, resolvedVersionNumber, archived)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	_, err = b.cache.UpdateModelVersionArchived(modelID, resolvedVersionNumber, archived)
+	if err != nil && !errors.Is(err, backend.ErrNotFound) {
+		logrus.WithFields(logrus.Fields{"model_id": modelID, "version_number": resolvedVersionNumber}).WithError(err).Warn("unable to update a cached version")
+		// Making sure a previous value of the version isn't served anymore
+		_ = b.cache.DeleteModelVersion(modelID, resolvedVersionNumber)
+	}
+	return versionInfo, nil
+}
+
+// UpdateModelVersionUserData replaces the user data of a given model version in the secondary storage, then in the cache if it holds the version
+func (b *writeThroughBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := b.secondary.UpdateModelVersionUserData(modelID, resolvedVersionNumber, userData)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	_, err = b.cache.UpdateModelVersionUserData(modelID, resolvedVersionNumber, userData)
+	if err != nil && !errors.Is(err, backend.ErrNotFound) {
+		logrus.WithFields(logrus.Fields{"model_id": modelID, "version_number": resolvedVersionNumber}).WithError(err).Warn("unable to update a cached version")
+		// Making sure a previous value of the version isn't served anymore
+		_ = b.cache.DeleteModelVersion(modelID, resolvedVersionNumber)
+	}
+	return versionInfo, nil
+}
+
+// DeleteModelVersion deletes a given model version from both storages
+func (b *writeThroughBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return err
+	}
+	err = b.secondary.DeleteModelVersion(modelID, resolvedVersionNumber)
+	if err != nil {
+		return err
+	}
+	err = b.cache.DeleteModelVersion(modelID, resolvedVersionNumber)
+	if err != nil && !errors.Is(err, backend.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (b *writeThroughBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return b.secondary.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+}
+
+func (b *writeThroughBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return b.secondary.QueryModelVersionInfos(modelID, filter, initialVersionNumber, limit)
+}
+
+// RetrieveStorageCapacity retrieves the capacity of the secondary backend
+func (b *writeThroughBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return b.secondary.RetrieveStorageCapacity()
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings are the settings of the registry or of a tenant, the factories read in them what their URI doesn't define
+type Settings interface {
+	GetString(key string) string
+	GetBool(key string) bool
+	GetInt(key string) int
+	GetInt64(key string) int64
+	GetDuration(key string) time.Duration
+}
+
+// Factory creates a backend from its URI, whose scheme is the name the factory is registered with
+type Factory func(uri *url.URL, settings Settings) (Backend, error)
+
+var (
+	factoriesMutex sync.RWMutex
+	factories      = make(map[string]Factory)
+)
+
+// Register makes a backend available under a name, used as the scheme of its URIs, it panics if the name is already
+// registered
+func Register(name string, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+	name = strings.ToLower(name)
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("backend %q is already registered", name))
+	}
+	factories[name] = factory
+}
+
+// Registered returns the sorted names of the registered backends
+func Registered() []string {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UnknownBackendError is raised when trying to create a backend that isn't registered
+type UnknownBackendError struct {
+	Name string
+}
+
+func (e *UnknownBackendError) Error() string {
+	names := Registered()
+	for index, name := range names {
+		names[index] = fmt.Sprintf("%q", name)
+	}
+	return fmt.Sprintf("unknown backend %q, expecting %s", e.Name, strings.Join(names, ", "))
+}
+
+// ParseURI parses the URI of a backend, e.g. "fs:///data" or "s3://bucket/prefix", a bare name e.g. "fs" is the URI of
+// a backend whose location is defined by the settings
+func ParseURI(uri string) (*url.URL, error) {
+	if !strings.Contains(uri, ":") {
+		return &url.URL{Scheme: strings.ToLower(uri)}, nil
+	}
+	parsedURI, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the backend URI: %w", err)
+	}
+	if parsedURI.Scheme == "" {
+		return nil, fmt.Errorf("unable to parse the backend URI %q: missing scheme", parsedURI.Redacted())
+	}
+	return parsedURI, nil
+}
+
+// Create creates a backend from its URI with the factory registered under its scheme
+func Create(uri string, settings Settings) (Backend, error) {
+	parsedURI, err := ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	factoriesMutex.RLock()
+	factory, ok := factories[parsedURI.Scheme]
+	factoriesMutex.RUnlock()
+	if !ok {
+		return nil, &UnknownBackendError{Name: parsedURI.Scheme}
+	}
+	return factory(parsedURI, settings)
+}
+
+// URILocation returns the location of a backend URI, e.g. "/data" for "fs:///data", "data" for "fs:data" or
+// "bucket/prefix" for "s3://bucket/prefix", empty when it isn't defined
+func URILocation(uri *url.URL) string {
+	if uri.Opaque != "" {
+		return uri.Opaque
+	}
+	return uri.Host + uri.Path
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mapSettings map[string]string
+
+func (s mapSettings) GetString(key string) string          { return s[key] }
+func (s mapSettings) GetBool(key string) bool              { return s[key] == "true" }
+func (s mapSettings) GetInt(key string) int                { return 0 }
+func (s mapSettings) GetInt64(key string) int64            { return 0 }
+func (s mapSettings) GetDuration(key string) time.Duration { return 0 }
+
+func TestParseURI(t *testing.T) {
+	uri, err := ParseURI("fs:///data/models")
+	assert.NoError(t, err)
+	assert.Equal(t, "fs", uri.Scheme)
+	assert.Equal(t, "/data/models", URILocation(uri))
+
+	uri, err = ParseURI("fs:relative/models")
+	assert.NoError(t, err)
+	assert.Equal(t, "relative/models", URILocation(uri))
+
+	uri, err = ParseURI("S3://bucket/prefix")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3", uri.Scheme)
+	assert.Equal(t, "bucket", uri.Host)
+	assert.Equal(t, "bucket/prefix", URILocation(uri))
+
+	uri, err = ParseURI("Bbolt")
+	assert.NoError(t, err)
+	assert.Equal(t, "bbolt", uri.Scheme)
+	assert.Equal(t, "", URILocation(uri))
+
+	_, err = ParseURI("://missing")
+	assert.Error(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	var createdURI *url.URL
+	failure := errors.New("failure")
+	Register("test-registry", func(uri *url.URL, settings Settings) (Backend, error) {
+		createdURI = uri
+		if settings.GetString("FAIL") != "" {
+			return nil, failure
+		}
+		return nil, nil
+	})
+	assert.Contains(t, Registered(), "test-registry")
+	assert.Panics(t, func() {
+		Register("Test-Registry", func(*url.URL, Settings) (Backend, error) { return nil, nil })
+	})
+
+	_, err := Create("test-registry://somewhere/else?option=1", mapSettings{})
+	assert.NoError(t, err)
+	assert.Equal(t, "somewhere/else", URILocation(createdURI))
+	assert.Equal(t, "1", createdURI.Query().Get("option"))
+
+	_, err = Create("test-registry", mapSettings{"FAIL": "true"})
+	assert.ErrorIs(t, err, failure)
+
+	_, err = Create("unknown:///data", mapSettings{})
+	var unknownBackendError *UnknownBackendError
+	assert.ErrorAs(t, err, &unknownBackendError)
+	assert.Equal(t, "unknown", unknownBackendError.Name)
+	assert.Contains(t, err.Error(), `"test-registry"`)
+}
@@ -0,0 +1,400 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retrying
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/sirupsen/logrus"
+)
+
+// Metrics published by every retrying backend under `/debug/vars`
+var (
+	retriesMetric          = expvar.NewInt("backend_retries")
+	budgetExhaustedMetric  = expvar.NewInt("backend_retry_budget_exhausted")
+	exhaustedRetriesMetric = expvar.NewInt("backend_exhausted_retries")
+)
+
+type Configuration struct {
+	MaxAttempts    int           // Maximum number of attempts of an operation, including the first one
+	InitialBackoff time.Duration // Delay before the first retry, doubled after each retry, a random jitter of up to half of it is removed
+	MaxBackoff     time.Duration // Maximum delay between two attempts
+	BudgetTokens   float64       // Size of the retry budget, shared by every operation, retries stop while less than half of it is left
+	BudgetRatio    float64       // Tokens given back to the budget by each successful operation, each transient failure takes one
+}
+
+var DefaultConfiguration = Configuration{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	BudgetTokens:   10,
+	BudgetRatio:    0.1,
+}
+
+// retryBudget is shared by a retrying backend and the views bound to a context
+type retryBudget struct {
+	mutex  sync.Mutex
+	tokens float64
+}
+
+type retryingBackend struct {
+	*retryBudget
+	backend       backend.Backend
+	configuration Configuration
+	sleep         func(time.Duration)
+	ctx           context.Context // Nil unless bound to a context, the retries stop once it is done
+}
+
+// CreateBackend creates a new backend retrying the operations of another backend failing with a transient error
+//
+// The transient errors, as classified by `backend.IsTransient`, are retried up to the configured number of attempts with
+// a jittered exponential backoff. As in the gRPC retry throttling, the retries share a budget: each transient failure
+// takes a token and each success gives back a fraction of one, the operations are no longer retried while less than half
+// of the tokens are left, a storage failing every operation isn't overloaded by retries. Creating a version without a
+// version number isn't retried, a failed attempt might have created it, neither is the data written to a version stream.
+// For the same reason, deleting a version designated from the latest one isn't retried. A failed attempt might also have
+// completed a deletion, the retries no longer finding the model or version report the deletion as successful.
+// The underlying backend is not destroyed with the created backend.
+func CreateBackend(b backend.Backend, configuration Configuration) (backend.Backend, error) {
+	return &retryingBackend{
+		retryBudget:   &retryBudget{tokens: configuration.BudgetTokens},
+		backend:       b,
+		configuration: configuration,
+		sleep:         time.Sleep,
+	}, nil
+}
+
+func (b *retryingBackend) Destroy() {
+}
+
+// BindContext binds the underlying backend to the context, the operations are no longer retried once it is done
+func (b *retryingBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	boundBackend, ok := backend.BindContext(b.backend, ctx)
+	if !ok {
+		return nil, false
+	}
+	bound := *b
+	bound.backend = boundBackend
+	bound.ctx = ctx
+	return &bound, true
+}
+
+// wait sleeps before a retry, it returns false if the context is done first
+func (b *retryingBackend) wait(backoff time.Duration) bool {
+	if b.ctx == nil {
+		b.sleep(backoff)
+		return true
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-b.ctx.Done():
+		return false
+	}
+}
+
+// succeeded gives back a fraction of token to the budget
+func (b *retryingBackend) succeeded() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens += b.configuration.BudgetRatio
+	if b.tokens > b.configuration.BudgetTokens {
+		b.tokens = b.configuration.BudgetTokens
+	}
+}
+
+// failed takes a token from the budget and tells whether a retry is allowed
+func (b *retryingBackend) failed() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens--
+	if b.tokens < 0 {
+		b.tokens = 0
+	}
+	return b.tokens > b.configuration.BudgetTokens/2
+}
+
+// backoff computes the delay before the given retry, starting at 1
+func (b *retryingBackend) backoff(retry int) time.Duration {
+	backoff := b.configuration.InitialBackoff
+	for i := 1; i < retry && backoff < b.configuration.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > b.configuration.MaxBackoff {
+		backoff = b.configuration.MaxBackoff
+	}
+	if backoff <= 1 {
+		return backoff
+	}
+	return backoff - time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// retry calls do until it succeeds, fails with a non transient error, runs out of attempts or of budget
+func (b *retryingBackend) retry(operation string, do func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := do()
+		if err == nil {
+			b.succeeded()
+			return nil
+		}
+		if !backend.IsTransient(err) || backend.IsContextDone(b.ctx, err) {
+			return err
+		}
+		if !b.failed() {
+			budgetExhaustedMetric.Add(1)
+			return err
+		}
+		if attempt >= b.configuration.MaxAttempts {
+			exhaustedRetriesMetric.Add(1)
+			return err
+		}
+		backoff := b.backoff(attempt)
+		logrus.WithFields(logrus.Fields{"operation": operation, "attempt": attempt, "retry_in": backoff}).WithError(err).Debug("Retrying a backend operation")
+		retriesMetric.Add(1)
+		if !b.wait(backoff) {
+			return err
+		}
+	}
+}
+
+// retryDeletion retries a deletion like retry, a retry failing because the deleted model or version is no longer found
+// succeeds, a failed attempt deleted it
+func (b *retryingBackend) retryDeletion(operation string, do func() error) error {
+	retried := false
+	return b.retry(operation, func() error {
+		err := do()
+		if retried && errors.Is(err, backend.ErrNotFound) {
+			return nil
+		}
+		retried = true
+		return err
+	})
+}
+
+func (b *retryingBackend) Ping() error {
+	// The health checks need to know about the failures right away
+	return b.backend.Ping()
+}
+
+func (b *retryingBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	var modelInfo backend.ModelInfo
+	err := b.retry("CreateOrUpdateModel", func() error {
+		var err error
+		modelInfo, err = b.backend.CreateOrUpdateModel(modelArgs)
+		return err
+	})
+	return modelInfo, err
+}
+
+func (b *retryingBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	var modelInfo backend.ModelInfo
+	err := b.retry("RetrieveModelInfo", func() error {
+		var err error
+		modelInfo, err = b.backend.RetrieveModelInfo(modelID)
+		return err
+	})
+	return modelInfo, err
+}
+
+func (b *retryingBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	var versionNumber uint
+	err := b.retry("RetrieveModelLatestVersionNumber", func() error {
+		var err error
+		versionNumber, err = b.backend.RetrieveModelLatestVersionNumber(modelID)
+		return err
+	})
+	return versionNumber, err
+}
+
+func (b *retryingBackend) HasModel(modelID string) (bool, error) {
+	var hasModel bool
+	err := b.retry("HasModel", func() error {
+		var err error
+		hasModel, err = b.backend.HasModel(modelID)
+		return err
+	})
+	return hasModel, err
+}
+
+func (b *retryingBackend) DeleteModel(modelID string) error {
+	return b.retryDeletion("DeleteModel", func() error {
+		return b.backend.DeleteModel(modelID)
+	})
+}
+
+func (b *retryingBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	var modelInfos []backend.ModelInfo
+	err := b.retry("ListModels", func() error {
+		var err error
+		modelInfos, err = b.backend.ListModels(offset, limit)
+		return err
+	})
+	return modelInfos, err
+}
+
+func (b *retryingBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	var modelInfos []backend.ModelInfo
+	err := b.retry("QueryModels", func() error {
+		var err error
+		modelInfos, err = b.backend.QueryModels(filter, offset, limit)
+		return err
+	})
+	return modelInfos, err
+}
+
+func (b *retryingBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	if versionArgs.VersionNumber == 0 {
+		return b.backend.CreateOrUpdateModelVersion(modelID, versionArgs)
+	}
+	var versionInfo backend.VersionInfo
+	err := b.retry("CreateOrUpdateModelVersion", func() error {
+		var err error
+		versionInfo, err = b.backend.CreateOrUpdateModelVersion(modelID, versionArgs)
+		return err
+	})
+	return versionInfo, err
+}
+
+func (b *retryingBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	var writer backend.VersionDataWriter
+	err := b.retry("CreateOrUpdateModelVersionStream", func() error {
+		var err error
+		writer, err = b.backend.CreateOrUpdateModelVersionStream(modelID, versionArgs)
+		return err
+	})
+	return writer, err
+}
+
+func (b *retryingBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	err := b.retry("RetrieveModelVersionInfo", func() error {
+		var err error
+		versionInfo, err = b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+		return err
+	})
+	return versionInfo, err
+}
+
+func (b *retryingBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	var data []byte
+	err := b.retry("RetrieveModelVersionData", func() error {
+		var err error
+		data, err = b.backend.RetrieveModelVersionData(modelID, versionNumber)
+		return err
+	})
+	return data, err
+}
+
+func (b *retryingBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	var data []byte
+	err := b.retry("RetrieveModelVersionDataRange", func() error {
+		var err error
+		data, err = b.backend.RetrieveModelVersionDataRange(modelID, versionNumber, offset, length)
+		return err
+	})
+	return data, err
+}
+
+func (b *retryingBackend) OpenModelVersionData(modelID string, versionNumber int) (backend.VersionInfo, backend.VersionDataReader, bool, error) {
+	var versionInfo backend.VersionInfo
+	var reader backend.VersionDataReader
+	var opened bool
+	err := b.retry("OpenModelVersionData", func() error {
+		var err error
+		versionInfo, reader, opened, err = backend.OpenModelVersionData(b.backend, modelID, versionNumber)
+		return err
+	})
+	return versionInfo, reader, opened, err
+}
+
+func (b *retryingBackend) PresignModelVersionData(modelID string, versionNumber int, expiration time.Duration) (backend.VersionInfo, string, bool, error) {
+	var versionInfo backend.VersionInfo
+	var url string
+	var presigned bool
+	err := b.retry("PresignModelVersionData", func() error {
+		var err error
+		versionInfo, url, presigned, err = backend.PresignModelVersionData(b.backend, modelID, versionNumber, expiration)
+		return err
+	})
+	return versionInfo, url, presigned, err
+}
+
+func (b *retryingBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	err := b.retry("UpdateModelVersionArchived", func() error {
+		var err error
+		versionInfo, err = b.backend.UpdateModelVersionArchived(modelID, versionNumber, archived)
+		return err
+	})
+	return versionInfo, err
+}
+
+func (b *retryingBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	err := b.retry("UpdateModelVersionUserData", func() error {
+		var err error
+		versionInfo, err = b.backend.UpdateModelVersionUserData(modelID, versionNumber, userData)
+		return err
+	})
+	return versionInfo, err
+}
+
+func (b *retryingBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	if versionNumber < 0 {
+		// A failed attempt might have deleted the version, a retry would delete the one preceding it
+		return b.backend.DeleteModelVersion(modelID, versionNumber)
+	}
+	return b.retryDeletion("DeleteModelVersion", func() error {
+		return b.backend.DeleteModelVersion(modelID, versionNumber)
+	})
+}
+
+func (b *retryingBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	var versionInfos []backend.VersionInfo
+	err := b.retry("ListModelVersionInfos", func() error {
+		var err error
+		versionInfos, err = b.backend.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+		return err
+	})
+	return versionInfos, err
+}
+
+func (b *retryingBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	var versionInfos []backend.VersionInfo
+	err := b.retry("QueryModelVersionInfos", func() error {
+		var err error
+		versionInfos, err = b.backend.QueryModelVersionInfos(modelID, filter, initialVersionNumber, limit)
+		return err
+	})
+	return versionInfos, err
+}
+
+func (b *retryingBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	var capacity backend.StorageCapacity
+	err := b.retry("RetrieveStorageCapacity", func() error {
+		var err error
+		capacity, err = b.backend.RetrieveStorageCapacity()
+		return err
+	})
+	return capacity, err
+}
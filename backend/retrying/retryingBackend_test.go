@@ -0,0 +1,270 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retrying
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuiteRetryingBackend(t *testing.T) {
+	underlyingBackends := make(map[backend.Backend]backend.Backend)
+	test.RunSuite(t, func() backend.Backend {
+		underlyingBackend, err := fs.CreateBackend(t.TempDir())
+		assert.NoError(t, err)
+		b, err := CreateBackend(underlyingBackend, DefaultConfiguration)
+		assert.NoError(t, err)
+		underlyingBackends[b] = underlyingBackend
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+		underlyingBackends[b].Destroy()
+		delete(underlyingBackends, b)
+	})
+}
+
+// flakyBackend fails the given number of calls with the given error before reaching the underlying backend
+type flakyBackend struct {
+	backend.Backend
+	failures int
+	err      error
+	calls    int
+}
+
+func (b *flakyBackend) fail() error {
+	b.calls++
+	if b.failures > 0 {
+		b.failures--
+		return b.err
+	}
+	return nil
+}
+
+func (b *flakyBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	if err := b.fail(); err != nil {
+		return backend.ModelInfo{}, err
+	}
+	return b.Backend.RetrieveModelInfo(modelID)
+}
+
+func (b *flakyBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	if err := b.fail(); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return b.Backend.CreateOrUpdateModelVersion(modelID, versionArgs)
+}
+
+// DeleteModel reaches the underlying backend before failing, like a storage timing out after acting on the request
+func (b *flakyBackend) DeleteModel(modelID string) error {
+	err := b.Backend.DeleteModel(modelID)
+	if failure := b.fail(); failure != nil {
+		return failure
+	}
+	return err
+}
+
+// DeleteModelVersion reaches the underlying backend before failing, like DeleteModel
+func (b *flakyBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	err := b.Backend.DeleteModelVersion(modelID, versionNumber)
+	if failure := b.fail(); failure != nil {
+		return failure
+	}
+	return err
+}
+
+// BindContext returns the flaky backend itself, its failures don't depend on the context
+func (b *flakyBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	return b, true
+}
+
+func createRetryingBackend(t *testing.T, configuration Configuration) (*retryingBackend, *flakyBackend, *[]time.Duration) {
+	underlyingBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(underlyingBackend.Destroy)
+	_, err = underlyingBackend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	flaky := &flakyBackend{Backend: underlyingBackend, err: &backend.TransientError{Err: errors.New("503 Service Unavailable")}}
+	b, err := CreateBackend(flaky, configuration)
+	assert.NoError(t, err)
+	r := b.(*retryingBackend)
+	backoffs := []time.Duration{}
+	r.sleep = func(backoff time.Duration) {
+		backoffs = append(backoffs, backoff)
+	}
+	return r, flaky, &backoffs
+}
+
+func TestRetries(t *testing.T) {
+	b, flaky, backoffs := createRetryingBackend(t, Configuration{
+		MaxAttempts:    4,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		BudgetTokens:   100,
+		BudgetRatio:    0.1,
+	})
+
+	flaky.failures = 3
+	modelInfo, err := b.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", modelInfo.ModelID)
+	assert.Equal(t, 4, flaky.calls)
+	assert.Len(t, *backoffs, 3)
+	for index, maxBackoff := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond} {
+		assert.LessOrEqual(t, (*backoffs)[index], maxBackoff)
+		assert.GreaterOrEqual(t, (*backoffs)[index], maxBackoff/2)
+	}
+
+	// Out of attempts
+	flaky.calls = 0
+	flaky.failures = 4
+	_, err = b.RetrieveModelInfo("foo")
+	assert.True(t, backend.IsTransient(err))
+	assert.Equal(t, 4, flaky.calls)
+
+	// Not transient
+	flaky.calls = 0
+	_, err = b.RetrieveModelInfo("bar")
+	assert.IsType(t, &backend.UnknownModelError{}, err)
+	assert.Equal(t, 1, flaky.calls)
+}
+
+func TestVersionCreationRetries(t *testing.T) {
+	b, flaky, _ := createRetryingBackend(t, DefaultConfiguration)
+	data := []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+	// A failed attempt might have created the version
+	flaky.failures = 1
+	_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: data, DataHash: backend.ComputeSHA256Hash(data)})
+	assert.True(t, backend.IsTransient(err))
+	assert.Equal(t, 1, flaky.calls)
+
+	// Updating a given version can be repeated
+	flaky.calls = 0
+	flaky.failures = 1
+	versionInfo, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{VersionNumber: 1, Data: data, DataHash: backend.ComputeSHA256Hash(data)})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	assert.Equal(t, 2, flaky.calls)
+}
+
+func TestDeletionRetries(t *testing.T) {
+	b, flaky, _ := createRetryingBackend(t, DefaultConfiguration)
+	data := []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+	for i := 0; i < 3; i++ {
+		_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: data, DataHash: backend.ComputeSHA256Hash(data)})
+		assert.NoError(t, err)
+	}
+
+	// The failed attempt deleted the version, the retry no longer finding it succeeds
+	flaky.calls = 0
+	flaky.failures = 1
+	err := b.DeleteModelVersion("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, flaky.calls)
+	_, err = b.RetrieveModelVersionInfo("foo", 1)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+
+	// The first attempt still reports unknown versions
+	flaky.calls = 0
+	err = b.DeleteModelVersion("foo", 1)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+	assert.Equal(t, 1, flaky.calls)
+
+	// A retry would delete the version preceding the latest one
+	flaky.calls = 0
+	flaky.failures = 1
+	err = b.DeleteModelVersion("foo", -1)
+	assert.True(t, backend.IsTransient(err))
+	assert.Equal(t, 1, flaky.calls)
+	versionInfos, err := b.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 1)
+
+	flaky.calls = 0
+	flaky.failures = 1
+	err = b.DeleteModel("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, flaky.calls)
+	hasModel, err := b.HasModel("foo")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+}
+
+func TestBoundRetries(t *testing.T) {
+	b, flaky, backoffs := createRetryingBackend(t, Configuration{
+		MaxAttempts:    4,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     time.Hour,
+		BudgetTokens:   100,
+		BudgetRatio:    0.1,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	bound, ok := backend.BindContext(b, ctx)
+	assert.True(t, ok)
+
+	// The backoff stops with the context instead of sleeping
+	flaky.failures = 3
+	_, err := bound.RetrieveModelInfo("foo")
+	assert.True(t, backend.IsTransient(err))
+	assert.True(t, backend.IsContextDone(ctx, err))
+	assert.Equal(t, 1, flaky.calls)
+	assert.Empty(t, *backoffs)
+
+	// Once done, the context fails the operations without retrying them
+	flaky.calls = 0
+	_, err = bound.RetrieveModelInfo("foo")
+	assert.Error(t, err)
+	assert.Equal(t, 1, flaky.calls)
+}
+
+func TestRetryBudget(t *testing.T) {
+	b, flaky, _ := createRetryingBackend(t, Configuration{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		BudgetTokens:   4,
+		BudgetRatio:    1,
+	})
+
+	// A storage failing every operation exhausts the budget, 2 tokens, the operations then fail right away
+	flaky.failures = 100
+	_, err := b.RetrieveModelInfo("foo")
+	assert.Error(t, err)
+	assert.Equal(t, 2, flaky.calls)
+	flaky.calls = 0
+	_, err = b.RetrieveModelInfo("foo")
+	assert.Error(t, err)
+	assert.Equal(t, 1, flaky.calls)
+
+	// The successful operations refill it
+	flaky.failures = 0
+	for i := 0; i < 3; i++ {
+		_, err = b.RetrieveModelInfo("foo")
+		assert.NoError(t, err)
+	}
+	flaky.calls = 0
+	flaky.failures = 1
+	_, err = b.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, flaky.calls)
+}
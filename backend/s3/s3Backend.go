@@ -0,0 +1,206 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/objectStore"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Configuration defines how to connect to an S3 compatible object storage (AWS S3, MinIO, Ceph...)
+type Configuration struct {
+	Endpoint        string
+	Bucket          string
+	Prefix          string // Optional, prefix of the keys of all the stored objects
+	Region          string // Optional
+	AccessKeyID     string // Optional, the credentials are retrieved from the environment or the IAM role if empty
+	SecretAccessKey string
+	UseSSL          bool
+}
+
+type s3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+	ctx    context.Context // Nil unless bound to a context
+}
+
+// CreateStore creates a new object store in an S3 bucket
+func CreateStore(configuration Configuration) (objectStore.Store, error) {
+	var creds *credentials.Credentials
+	if configuration.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(configuration.AccessKeyID, configuration.SecretAccessKey, "")
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.IAM{},
+		})
+	}
+	client, err := minio.New(configuration.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: configuration.UseSSL,
+		Region: configuration.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create s3 store: %w", err)
+	}
+
+	bucketExists, err := client.BucketExists(context.Background(), configuration.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create s3 store: unable to access bucket %q: %w", configuration.Bucket, err)
+	}
+	if !bucketExists {
+		return nil, fmt.Errorf("unable to create s3 store: bucket %q doesn't exist", configuration.Bucket)
+	}
+
+	prefix := configuration.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &s3Store{
+		client: client,
+		bucket: configuration.Bucket,
+		prefix: prefix,
+	}, nil
+}
+
+// CreateBackend creates a new backend storing models and versions in an S3 bucket
+func CreateBackend(configuration Configuration) (backend.Backend, error) {
+	store, err := CreateStore(configuration)
+	if err != nil {
+		return nil, err
+	}
+	return objectStore.CreateBackend(store)
+}
+
+// markTransient marks the errors of a throttled or temporarily unavailable S3 service as transient
+func markTransient(err error) error {
+	if err == nil {
+		return nil
+	}
+	response := minio.ToErrorResponse(err)
+	if response.StatusCode != http.StatusTooManyRequests && response.StatusCode < 500 && response.Code != "SlowDown" && response.Code != "RequestTimeout" {
+		return err
+	}
+	return &backend.TransientError{Err: err}
+}
+
+// BindContext returns a view of the store whose requests are canceled once the context is done
+func (s *s3Store) BindContext(ctx context.Context) objectStore.Store {
+	bound := *s
+	bound.ctx = ctx
+	return &bound
+}
+
+func (s *s3Store) requestContext() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *s3Store) Ping() error {
+	bucketExists, err := s.client.BucketExists(s.requestContext(), s.bucket)
+	if err != nil {
+		return fmt.Errorf("unable to access bucket %q: %w", s.bucket, markTransient(err))
+	}
+	if !bucketExists {
+		return fmt.Errorf("bucket %q doesn't exist", s.bucket)
+	}
+	return nil
+}
+
+func (s *s3Store) PutObject(key string, reader io.Reader, size int64) error {
+	_, err := s.client.PutObject(s.requestContext(), s.bucket, s.prefix+key, reader, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return markTransient(err)
+}
+
+func (s *s3Store) GetObject(key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(s.requestContext(), s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, markTransient(err)
+	}
+	// Objects are lazily retrieved, stat it to know it exists
+	_, err = object.Stat()
+	if err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, &objectStore.UnknownObjectError{Key: key}
+		}
+		return nil, markTransient(err)
+	}
+	return object, nil
+}
+
+func (s *s3Store) GetObjectRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	options := minio.GetObjectOptions{}
+	err := options.SetRange(offset, offset+length-1)
+	if err != nil {
+		return nil, err
+	}
+	object, err := s.client.GetObject(s.requestContext(), s.bucket, s.prefix+key, options)
+	if err != nil {
+		return nil, markTransient(err)
+	}
+	// Objects are lazily retrieved, stat it to know it exists
+	_, err = object.Stat()
+	if err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, &objectStore.UnknownObjectError{Key: key}
+		}
+		return nil, markTransient(err)
+	}
+	return object, nil
+}
+
+func (s *s3Store) PresignGetObject(key string, expiration time.Duration) (string, error) {
+	presignedURL, err := s.client.PresignedGetObject(s.requestContext(), s.bucket, s.prefix+key, expiration, nil)
+	if err != nil {
+		return "", err
+	}
+	return presignedURL.String(), nil
+}
+
+func (s *s3Store) DeleteObject(key string) error {
+	return markTransient(s.client.RemoveObject(s.requestContext(), s.bucket, s.prefix+key, minio.RemoveObjectOptions{}))
+}
+
+func (s *s3Store) ListObjects(prefix string) ([]string, error) {
+	keys := []string{}
+	for object := range s.client.ListObjects(s.requestContext(), s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix + prefix,
+		Recursive: false,
+	}) {
+		if object.Err != nil {
+			return nil, markTransient(object.Err)
+		}
+		keys = append(keys, strings.TrimPrefix(object.Key, s.prefix))
+	}
+	return keys, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// The test suite requires an accessible S3 compatible storage, e.g. `docker run -p 9090:9000 minio/minio server /data`,
+// configured using `COGMENT_MODEL_REGISTRY_TEST_S3_ENDPOINT`, `COGMENT_MODEL_REGISTRY_TEST_S3_BUCKET`,
+// `COGMENT_MODEL_REGISTRY_TEST_S3_ACCESS_KEY_ID` and `COGMENT_MODEL_REGISTRY_TEST_S3_SECRET_ACCESS_KEY`
+func testConfiguration(t *testing.T) Configuration {
+	endpoint := os.Getenv("COGMENT_MODEL_REGISTRY_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("COGMENT_MODEL_REGISTRY_TEST_S3_ENDPOINT is not defined")
+	}
+	return Configuration{
+		Endpoint:        endpoint,
+		Bucket:          os.Getenv("COGMENT_MODEL_REGISTRY_TEST_S3_BUCKET"),
+		AccessKeyID:     os.Getenv("COGMENT_MODEL_REGISTRY_TEST_S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("COGMENT_MODEL_REGISTRY_TEST_S3_SECRET_ACCESS_KEY"),
+	}
+}
+
+func TestSuiteS3Backend(t *testing.T) {
+	configuration := testConfiguration(t)
+	test.RunSuite(t, func() backend.Backend {
+		// Each backend uses its own prefix to be isolated from the others
+		configuration.Prefix = fmt.Sprintf("test-%d", time.Now().UnixNano())
+		b, err := CreateBackend(configuration)
+		assert.NoError(t, err)
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+	})
+}
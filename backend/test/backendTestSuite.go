@@ -47,7 +47,14 @@ fringilla vel, aliquet nec, vulputate eget, arcu. In enim justo, rhoncus ut,
 imperdiet a, venenatis vitae, justo. Nullam dictum felis eu pede mollis pretium.
 Integer tincidunt.`)
 
-// RunSuite runs the full backend test suite
+// RunSuite runs the full backend test suite, the conformance suite of the Backend contract
+//
+// Every backend of the registry runs it, a custom backend can run it from its own tests to check it behaves like them:
+// models listed by id and versions by number, paginated by offset or initial version number with a limit of 0 or less
+// meaning no limit, the backend errors matching their kind with errors.Is and errors.As, e.g. an *UnknownModelError
+// matching ErrNotFound, large payloads and concurrent calls, including versions created at once in the same model
+// getting distinct numbers without gaps. createBackend is called by each case and must return an empty backend,
+// destroyBackend releases it.
 func RunSuite(t *testing.T, createBackend func() backend.Backend, destroyBackend func(backend.Backend)) {
 	versionUserData := make(map[string]string)
 	versionUserData["version_test1"] = "version_test1"
@@ -59,10 +66,7 @@ func RunSuite(t *testing.T, createBackend func() backend.Backend, destroyBackend
 	modelUserData["model_test2"] = "model_test2"
 	modelUserData["model_test3"] = "model_test3"
 
-	cases := []struct {
-		name string
-		test func(t *testing.T)
-	}{
+	cases := []suiteCase{
 		{
 			name: "TestCreateAndDestroyBackend",
 			test: func(t *testing.T) {
@@ -143,6 +147,7 @@ func RunSuite(t *testing.T, createBackend func() backend.Backend, destroyBackend
 					err := b.DeleteModel("bar")
 					concreteErr := &backend.UnknownModelError{}
 					assert.ErrorAs(t, err, &concreteErr)
+					assert.ErrorIs(t, err, backend.ErrNotFound)
 					assert.Equal(t, "bar", concreteErr.ModelID)
 					assert.EqualError(t, err, `no model "bar" found`)
 				}
@@ -159,6 +164,7 @@ func RunSuite(t *testing.T, createBackend func() backend.Backend, destroyBackend
 					err := b.DeleteModel("foo")
 					concreteErr := &backend.UnknownModelError{}
 					assert.ErrorAs(t, err, &concreteErr)
+					assert.ErrorIs(t, err, backend.ErrNotFound)
 					assert.Equal(t, "foo", concreteErr.ModelID)
 					assert.EqualError(t, err, `no model "foo" found`)
 				}
@@ -247,6 +253,53 @@ func RunSuite(t *testing.T, createBackend func() backend.Backend, destroyBackend
 				assert.Equal(t, "foo", models[1].ModelID)
 			},
 		},
+		{
+			name: "TestQueryModels",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				for _, modelInfo := range []backend.ModelInfo{
+					{ModelID: "policy_a", UserData: map[string]string{"env": "cartpole-v1", "algo": "dqn"}},
+					{ModelID: "policy_b", UserData: map[string]string{"env": "cartpole-v0", "algo": "ppo"}},
+					{ModelID: "policy_c.1", UserData: map[string]string{"env": "pendulum", "algo": "ppo"}},
+					{ModelID: "value_a", UserData: map[string]string{"env": "cartpole-v1"}},
+					{ModelID: "value_b"},
+				} {
+					_, err := b.CreateOrUpdateModel(modelInfo)
+					assert.NoError(t, err)
+				}
+
+				queryModelIDs := func(filter backend.ModelFilter, offset int, limit int) []string {
+					models, err := b.QueryModels(filter, offset, limit)
+					assert.NoError(t, err)
+					modelIDs := []string{}
+					for _, model := range models {
+						modelIDs = append(modelIDs, model.ModelID)
+					}
+					return modelIDs
+				}
+
+				assert.Equal(t, []string{"policy_a", "policy_b", "policy_c.1", "value_a", "value_b"}, queryModelIDs(backend.ModelFilter{}, 0, 0))
+				assert.Equal(t, []string{"policy_a", "policy_b", "policy_c.1"}, queryModelIDs(backend.ModelFilter{ModelIDGlob: "policy_*"}, 0, 0))
+				assert.Equal(t, []string{"policy_a", "policy_b"}, queryModelIDs(backend.ModelFilter{ModelIDGlob: "policy_?"}, 0, 0))
+				assert.Equal(t, []string{"policy_c.1"}, queryModelIDs(backend.ModelFilter{ModelIDGlob: "*.1"}, 0, 0))
+				assert.Equal(t, []string{}, queryModelIDs(backend.ModelFilter{ModelIDGlob: "policy"}, 0, 0))
+				assert.Equal(t, []string{"policy_b", "policy_c.1"}, queryModelIDs(backend.ModelFilter{UserDataEquals: map[string]string{"algo": "ppo"}}, 0, 0))
+				assert.Equal(t, []string{"policy_a", "policy_b", "value_a"}, queryModelIDs(backend.ModelFilter{UserDataPrefixes: map[string]string{"env": "cartpole"}}, 0, 0))
+				assert.Equal(t, []string{"policy_a", "policy_b", "policy_c.1", "value_a"}, queryModelIDs(backend.ModelFilter{UserDataPrefixes: map[string]string{"env": ""}}, 0, 0))
+				assert.Equal(t, []string{"policy_b"}, queryModelIDs(backend.ModelFilter{
+					ModelIDGlob:      "policy_*",
+					UserDataEquals:   map[string]string{"algo": "ppo"},
+					UserDataPrefixes: map[string]string{"env": "cartpole"},
+				}, 0, 0))
+
+				// Offset and limit apply to the selected models
+				assert.Equal(t, []string{"policy_b", "value_a"}, queryModelIDs(backend.ModelFilter{UserDataPrefixes: map[string]string{"env": "cartpole"}}, 1, 2))
+				assert.Equal(t, []string{"policy_a"}, queryModelIDs(backend.ModelFilter{UserDataPrefixes: map[string]string{"env": "cartpole"}}, 0, 1))
+				assert.Equal(t, []string{}, queryModelIDs(backend.ModelFilter{UserDataPrefixes: map[string]string{"env": "cartpole"}}, 3, 0))
+			},
+		},
 		{
 			name: "TestCreateModelVersion",
 			test: func(t *testing.T) {
@@ -383,6 +436,7 @@ func RunSuite(t *testing.T, createBackend func() backend.Backend, destroyBackend
 				{
 					concreteErr := &backend.UnknownModelVersionError{}
 					assert.ErrorAs(t, err, &concreteErr)
+					assert.ErrorIs(t, err, backend.ErrNotFound)
 					assert.Equal(t, "foo", concreteErr.ModelID)
 					assert.Equal(t, 3, concreteErr.VersionNumber)
 				}
@@ -549,6 +603,68 @@ func RunSuite(t *testing.T, createBackend func() backend.Backend, destroyBackend
 				assert.EqualError(t, err, `no version "n-3" for model "foo" found`)
 			},
 		},
+		{
+			name: "TestRetrieveModelVersionDataRange",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				_, err := b.RetrieveModelVersionDataRange("foo", 1, 0, 10)
+				assert.Error(t, err)
+
+				_, err = b.CreateOrUpdateModel(backend.ModelInfo{
+					ModelID:  "foo",
+					UserData: modelUserData,
+				})
+				assert.NoError(t, err)
+
+				_, err = b.RetrieveModelVersionDataRange("foo", 1, 0, 10)
+				assert.Error(t, err)
+
+				for _, archived := range []bool{true, false} {
+					_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+						CreationTimestamp: time.Now(),
+						Data:              Data1,
+						DataHash:          backend.ComputeSHA256Hash(Data1),
+						Archived:          archived,
+						UserData:          versionUserData,
+					})
+					assert.NoError(t, err)
+				}
+
+				for _, versionNumber := range []int{1, 2, -1} {
+					data, err := b.RetrieveModelVersionDataRange("foo", versionNumber, 6, 5)
+					assert.NoError(t, err)
+					assert.Equal(t, Data1[6:11], data)
+
+					data, err = b.RetrieveModelVersionDataRange("foo", versionNumber, 100, 0)
+					assert.NoError(t, err)
+					assert.Equal(t, Data1[100:], data)
+
+					data, err = b.RetrieveModelVersionDataRange("foo", versionNumber, uint64(len(Data1)-3), 10)
+					assert.NoError(t, err)
+					assert.Equal(t, Data1[len(Data1)-3:], data)
+
+					data, err = b.RetrieveModelVersionDataRange("foo", versionNumber, uint64(len(Data1)), 10)
+					assert.NoError(t, err)
+					assert.Empty(t, data)
+
+					_, err = b.RetrieveModelVersionDataRange("foo", versionNumber, uint64(len(Data1)+1), 10)
+					{
+						concreteErr := &backend.InvalidDataRangeError{}
+						assert.ErrorAs(t, err, &concreteErr)
+						assert.Equal(t, "foo", concreteErr.ModelID)
+						assert.Equal(t, uint64(len(Data1)), concreteErr.DataSize)
+					}
+				}
+
+				_, err = b.RetrieveModelVersionDataRange("foo", 3, 0, 10)
+				{
+					concreteErr := &backend.UnknownModelVersionError{}
+					assert.ErrorAs(t, err, &concreteErr)
+				}
+			},
+		},
 		{
 			name: "DeleteModelVersion",
 			test: func(t *testing.T) {
@@ -705,6 +821,312 @@ func RunSuite(t *testing.T, createBackend func() backend.Backend, destroyBackend
 				assert.Equal(t, 5, int(versions[2].VersionNumber))
 			},
 		},
+		{
+			name: "TestUpdateModelVersionArchived",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				_, err := b.UpdateModelVersionArchived("foo", 1, true)
+				assert.Error(t, err)
+				assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+
+				_, err = b.CreateOrUpdateModel(backend.ModelInfo{
+					ModelID:  "foo",
+					UserData: modelUserData,
+				})
+				assert.NoError(t, err)
+
+				for i := 0; i < 3; i++ {
+					_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+						CreationTimestamp: time.Now(),
+						Data:              Data1,
+						DataHash:          backend.ComputeSHA256Hash(Data1),
+						Archived:          false,
+						UserData:          versionUserData,
+					})
+					assert.NoError(t, err)
+				}
+
+				_, err = b.UpdateModelVersionArchived("foo", 4, true)
+				assert.Error(t, err)
+				assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+
+				versionInfo, err := b.UpdateModelVersionArchived("foo", 2, true)
+				assert.NoError(t, err)
+				assert.Equal(t, 2, int(versionInfo.VersionNumber))
+				assert.True(t, versionInfo.Archived)
+				assert.Equal(t, backend.ComputeSHA256Hash(Data1), versionInfo.DataHash)
+				assert.Equal(t, len(Data1), versionInfo.DataSize)
+				assert.Equal(t, versionUserData, versionInfo.UserData)
+
+				versionInfo, err = b.RetrieveModelVersionInfo("foo", 2)
+				assert.NoError(t, err)
+				assert.True(t, versionInfo.Archived)
+
+				versionData, err := b.RetrieveModelVersionData("foo", 2)
+				assert.NoError(t, err)
+				assert.Equal(t, Data1, versionData)
+
+				// Latest version
+				versionInfo, err = b.UpdateModelVersionArchived("foo", -1, true)
+				assert.NoError(t, err)
+				assert.Equal(t, 3, int(versionInfo.VersionNumber))
+				assert.True(t, versionInfo.Archived)
+
+				versionInfo, err = b.UpdateModelVersionArchived("foo", 2, false)
+				assert.NoError(t, err)
+				assert.False(t, versionInfo.Archived)
+
+				versionInfos, err := b.ListModelVersionInfos("foo", 0, -1)
+				assert.NoError(t, err)
+				assert.Len(t, versionInfos, 3)
+				assert.False(t, versionInfos[0].Archived)
+				assert.False(t, versionInfos[1].Archived)
+				assert.True(t, versionInfos[2].Archived)
+
+				versionData, err = b.RetrieveModelVersionData("foo", 2)
+				assert.NoError(t, err)
+				assert.Equal(t, Data1, versionData)
+			},
+		},
+		{
+			name: "TestUpdateModelVersionUserData",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				_, err := b.UpdateModelVersionUserData("foo", 1, map[string]string{})
+				assert.Error(t, err)
+				assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+
+				_, err = b.CreateOrUpdateModel(backend.ModelInfo{
+					ModelID:  "foo",
+					UserData: modelUserData,
+				})
+				assert.NoError(t, err)
+
+				for i := 0; i < 2; i++ {
+					_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+						CreationTimestamp: time.Now(),
+						Data:              Data1,
+						DataHash:          backend.ComputeSHA256Hash(Data1),
+						Archived:          i == 0,
+						UserData:          versionUserData,
+					})
+					assert.NoError(t, err)
+				}
+
+				_, err = b.UpdateModelVersionUserData("foo", 3, map[string]string{})
+				assert.Error(t, err)
+				assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+
+				updatedUserData := map[string]string{"note": "reviewed"}
+				versionInfo, err := b.UpdateModelVersionUserData("foo", 1, updatedUserData)
+				assert.NoError(t, err)
+				assert.Equal(t, 1, int(versionInfo.VersionNumber))
+				assert.True(t, versionInfo.Archived)
+				assert.Equal(t, backend.ComputeSHA256Hash(Data1), versionInfo.DataHash)
+				assert.Equal(t, len(Data1), versionInfo.DataSize)
+				assert.Equal(t, updatedUserData, versionInfo.UserData)
+
+				versionInfo, err = b.RetrieveModelVersionInfo("foo", 1)
+				assert.NoError(t, err)
+				assert.Equal(t, updatedUserData, versionInfo.UserData)
+
+				versionData, err := b.RetrieveModelVersionData("foo", 1)
+				assert.NoError(t, err)
+				assert.Equal(t, Data1, versionData)
+
+				// Latest version
+				versionInfo, err = b.UpdateModelVersionUserData("foo", -1, map[string]string{})
+				assert.NoError(t, err)
+				assert.Equal(t, 2, int(versionInfo.VersionNumber))
+				assert.False(t, versionInfo.Archived)
+				assert.Empty(t, versionInfo.UserData)
+
+				versionInfos, err := b.ListModelVersionInfos("foo", 0, -1)
+				assert.NoError(t, err)
+				assert.Len(t, versionInfos, 2)
+				assert.Equal(t, updatedUserData, versionInfos[0].UserData)
+				assert.Empty(t, versionInfos[1].UserData)
+
+				versionData, err = b.RetrieveModelVersionData("foo", 2)
+				assert.NoError(t, err)
+				assert.Equal(t, Data1, versionData)
+			},
+		},
+		{
+			name: "TestQueryModelVersions",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				_, err := b.QueryModelVersionInfos("foo", backend.VersionFilter{}, 0, 0)
+				assert.Error(t, err)
+				assert.IsType(t, &backend.UnknownModelError{}, err)
+
+				_, err = b.CreateOrUpdateModel(backend.ModelInfo{
+					ModelID:  "foo",
+					UserData: modelUserData,
+				})
+				assert.NoError(t, err)
+
+				baseTimestamp := time.Date(2022, time.March, 1, 12, 0, 0, 0, time.UTC)
+				rewards := []string{"0.5", "1.5", "-2", "not a number", "2e1", "3", "0.75", "12"}
+				for i, reward := range rewards {
+					_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+						CreationTimestamp: baseTimestamp.Add(time.Duration(i) * time.Hour),
+						Data:              Data1,
+						DataHash:          backend.ComputeSHA256Hash(Data1),
+						Archived:          i%2 == 1,
+						UserData:          map[string]string{"reward": reward, "stage": fmt.Sprintf("stage_%d", i/4)},
+					})
+					assert.NoError(t, err)
+				}
+
+				queryVersionNumbers := func(filter backend.VersionFilter, initialVersionNumber uint, limit int) []uint {
+					versionInfos, err := b.QueryModelVersionInfos("foo", filter, initialVersionNumber, limit)
+					assert.NoError(t, err)
+					versionNumbers := []uint{}
+					for _, versionInfo := range versionInfos {
+						versionNumbers = append(versionNumbers, versionInfo.VersionNumber)
+					}
+					return versionNumbers
+				}
+
+				assert.Equal(t, []uint{1, 2, 3, 4, 5, 6, 7, 8}, queryVersionNumbers(backend.VersionFilter{}, 0, 0))
+				assert.Equal(t, []uint{3, 4, 5}, queryVersionNumbers(backend.VersionFilter{
+					CreatedAfter:  baseTimestamp.Add(2 * time.Hour),
+					CreatedBefore: baseTimestamp.Add(5 * time.Hour),
+				}, 0, 0))
+				assert.Equal(t, []uint{6, 7, 8}, queryVersionNumbers(backend.VersionFilter{CreatedAfter: baseTimestamp.Add(5 * time.Hour)}, 0, 0))
+				assert.Equal(t, []uint{2, 4, 6, 8}, queryVersionNumbers(backend.VersionFilter{Archived: backend.ArchivedOnly}, 0, 0))
+				assert.Equal(t, []uint{1, 3, 5, 7}, queryVersionNumbers(backend.VersionFilter{Archived: backend.NonArchivedOnly}, 0, 0))
+				assert.Equal(t, []uint{5, 6, 7, 8}, queryVersionNumbers(backend.VersionFilter{UserDataEquals: map[string]string{"stage": "stage_1"}}, 0, 0))
+				assert.Equal(t, []uint{2, 5, 6, 8}, queryVersionNumbers(backend.VersionFilter{
+					UserDataComparisons: []backend.UserDataComparison{{Key: "reward", Operator: backend.GreaterThan, Value: 1}},
+				}, 0, 0))
+				assert.Equal(t, []uint{1, 3, 7}, queryVersionNumbers(backend.VersionFilter{
+					UserDataComparisons: []backend.UserDataComparison{{Key: "reward", Operator: backend.LessThan, Value: 1}},
+				}, 0, 0))
+				assert.Equal(t, []uint{2, 6}, queryVersionNumbers(backend.VersionFilter{
+					UserDataComparisons: []backend.UserDataComparison{
+						{Key: "reward", Operator: backend.GreaterOrEqual, Value: 1.5},
+						{Key: "reward", Operator: backend.LessOrEqual, Value: 3},
+					},
+				}, 0, 0))
+				assert.Equal(t, []uint{}, queryVersionNumbers(backend.VersionFilter{
+					UserDataComparisons: []backend.UserDataComparison{{Key: "missing", Operator: backend.GreaterThan, Value: -100}},
+				}, 0, 0))
+				assert.Equal(t, []uint{6, 8}, queryVersionNumbers(backend.VersionFilter{
+					Archived:            backend.ArchivedOnly,
+					UserDataEquals:      map[string]string{"stage": "stage_1"},
+					UserDataComparisons: []backend.UserDataComparison{{Key: "reward", Operator: backend.GreaterThan, Value: 1}},
+				}, 0, 0))
+
+				// Initial version number and limit apply to the selected versions
+				assert.Equal(t, []uint{4, 6}, queryVersionNumbers(backend.VersionFilter{Archived: backend.ArchivedOnly}, 3, 2))
+				assert.Equal(t, []uint{8}, queryVersionNumbers(backend.VersionFilter{Archived: backend.ArchivedOnly}, 7, 2))
+			},
+		},
+		{
+			name: "TestRetrieveStorageCapacity",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				capacity, err := b.RetrieveStorageCapacity()
+				assert.NoError(t, err)
+				assert.LessOrEqual(t, capacity.AvailableBytes, capacity.TotalBytes)
+			},
+		},
+		{
+			name: "TestCreateModelVersionStream",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				_, err := b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{
+					CreationTimestamp: time.Now(),
+					Archived:          true,
+				})
+				{
+					concreteErr := &backend.UnknownModelError{}
+					assert.ErrorAs(t, err, &concreteErr)
+					assert.Equal(t, "foo", concreteErr.ModelID)
+				}
+
+				_, err = b.CreateOrUpdateModel(backend.ModelInfo{
+					ModelID:  "foo",
+					UserData: modelUserData,
+				})
+				assert.NoError(t, err)
+
+				for _, archived := range []bool{true, false} {
+					writer, err := b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{
+						CreationTimestamp: time.Now(),
+						Archived:          archived,
+						DataHash:          backend.ComputeSHA256Hash(Data1),
+						UserData:          versionUserData,
+					})
+					assert.NoError(t, err)
+					_, err = writer.Write(Data1[:100])
+					assert.NoError(t, err)
+					_, err = writer.Write(Data1[100:])
+					assert.NoError(t, err)
+					versionInfo, err := writer.Commit()
+					assert.NoError(t, err)
+					assert.Equal(t, "foo", versionInfo.ModelID)
+					assert.Equal(t, archived, versionInfo.Archived)
+					assert.Equal(t, backend.ComputeSHA256Hash(Data1), versionInfo.DataHash)
+					assert.Equal(t, len(Data1), versionInfo.DataSize)
+
+					versionData, err := b.RetrieveModelVersionData("foo", int(versionInfo.VersionNumber))
+					assert.NoError(t, err)
+					assert.Equal(t, Data1, versionData)
+				}
+
+				latestVersionInfo, err := b.RetrieveModelVersionInfo("foo", -1)
+				assert.NoError(t, err)
+				assert.Equal(t, 2, int(latestVersionInfo.VersionNumber))
+
+				// Aborted versions are not created
+				writer, err := b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{
+					CreationTimestamp: time.Now(),
+					Archived:          true,
+				})
+				assert.NoError(t, err)
+				_, err = writer.Write(Data2)
+				assert.NoError(t, err)
+				err = writer.Abort()
+				assert.NoError(t, err)
+
+				// Versions not matching their expected hash are not created
+				writer, err = b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{
+					CreationTimestamp: time.Now(),
+					Archived:          true,
+					DataHash:          backend.ComputeSHA256Hash(Data1),
+				})
+				assert.NoError(t, err)
+				_, err = writer.Write(Data2)
+				assert.NoError(t, err)
+				_, err = writer.Commit()
+				{
+					concreteErr := &backend.DataHashMismatchError{}
+					assert.ErrorAs(t, err, &concreteErr)
+					assert.ErrorIs(t, err, backend.ErrInvalidData)
+					assert.NotErrorIs(t, err, backend.ErrCorrupted)
+					assert.Equal(t, "foo", concreteErr.ModelID)
+					assert.Equal(t, backend.ComputeSHA256Hash(Data1), concreteErr.ExpectedDataHash)
+					assert.Equal(t, backend.ComputeSHA256Hash(Data2), concreteErr.DataHash)
+				}
+
+				versions, err := b.ListModelVersionInfos("foo", 0, 0)
+				assert.NoError(t, err)
+				assert.Len(t, versions, 2)
+			},
+		},
 		{
 			name: "TestConcurrentCreateAndRetrieveModelVersions",
 			test: func(t *testing.T) {
@@ -789,6 +1211,7 @@ func RunSuite(t *testing.T, createBackend func() backend.Backend, destroyBackend
 			},
 		},
 	}
+	cases = append(cases, conformanceCases(createBackend, destroyBackend)...)
 	for _, c := range cases {
 		t.Run(c.name, c.test)
 	}
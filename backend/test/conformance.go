@@ -0,0 +1,412 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// Size of the data of the versions created by the large payload cases
+const largeDataSize = 8 * 1024 * 1024
+
+// suiteCase is a named test of the suite run against a fresh backend
+type suiteCase struct {
+	name string
+	test func(t *testing.T)
+}
+
+func createVersion(t *testing.T, b backend.Backend, modelID string, data []byte) backend.VersionInfo {
+	versionInfo, err := b.CreateOrUpdateModelVersion(modelID, backend.VersionArgs{
+		CreationTimestamp: time.Now(),
+		Data:              data,
+		DataHash:          backend.ComputeSHA256Hash(data),
+	})
+	assert.NoError(t, err)
+	return versionInfo
+}
+
+func versionNumbers(versionInfos []backend.VersionInfo) []uint {
+	versionNumbers := []uint{}
+	for _, versionInfo := range versionInfos {
+		versionNumbers = append(versionNumbers, versionInfo.VersionNumber)
+	}
+	return versionNumbers
+}
+
+// conformanceCases are the cases checking the parts of the contract the other backends build upon: pagination, error
+// semantics, large payloads and concurrent calls
+func conformanceCases(createBackend func() backend.Backend, destroyBackend func(backend.Backend)) []suiteCase {
+	return []suiteCase{
+		{
+			name: "TestPaginateModels",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				expectedModelIDs := []string{}
+				for i := 0; i < 25; i++ {
+					modelID := fmt.Sprintf("model_%02d", i)
+					_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: modelID})
+					assert.NoError(t, err)
+					expectedModelIDs = append(expectedModelIDs, modelID)
+				}
+
+				// Pages are ordered by id, their concatenation lists every model once
+				modelIDs := []string{}
+				for offset := 0; ; offset += 7 {
+					models, err := b.ListModels(offset, 7)
+					assert.NoError(t, err)
+					assert.LessOrEqual(t, len(models), 7)
+					for _, model := range models {
+						modelIDs = append(modelIDs, model.ModelID)
+					}
+					if len(models) < 7 {
+						break
+					}
+				}
+				assert.Equal(t, expectedModelIDs, modelIDs)
+
+				models, err := b.ListModels(24, 10)
+				assert.NoError(t, err)
+				assert.Len(t, models, 1)
+				assert.Equal(t, "model_24", models[0].ModelID)
+				models, err = b.ListModels(25, 10)
+				assert.NoError(t, err)
+				assert.Len(t, models, 0)
+				// A limit of 0 or less lists every model from the offset
+				models, err = b.ListModels(20, -1)
+				assert.NoError(t, err)
+				assert.Len(t, models, 5)
+			},
+		},
+		{
+			name: "TestPaginateModelVersions",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+				assert.NoError(t, err)
+				for i := 0; i < 25; i++ {
+					createVersion(t, b, "foo", Data1)
+				}
+				for versionNumber := 5; versionNumber < 10; versionNumber++ {
+					assert.NoError(t, b.DeleteModelVersion("foo", versionNumber))
+				}
+				expectedVersionNumbers := []uint{1, 2, 3, 4}
+				for versionNumber := uint(10); versionNumber <= 25; versionNumber++ {
+					expectedVersionNumbers = append(expectedVersionNumbers, versionNumber)
+				}
+
+				// Pages start at the given version number, or the next existing one, and skip the deleted versions
+				listedVersionNumbers := []uint{}
+				for initialVersionNumber := uint(0); ; {
+					versionInfos, err := b.ListModelVersionInfos("foo", initialVersionNumber, 7)
+					assert.NoError(t, err)
+					assert.LessOrEqual(t, len(versionInfos), 7)
+					listedVersionNumbers = append(listedVersionNumbers, versionNumbers(versionInfos)...)
+					if len(versionInfos) < 7 {
+						break
+					}
+					initialVersionNumber = versionInfos[len(versionInfos)-1].VersionNumber + 1
+				}
+				assert.Equal(t, expectedVersionNumbers, listedVersionNumbers)
+
+				versionInfos, err := b.ListModelVersionInfos("foo", 5, 2)
+				assert.NoError(t, err)
+				assert.Equal(t, []uint{10, 11}, versionNumbers(versionInfos))
+				versionInfos, err = b.ListModelVersionInfos("foo", 26, 10)
+				assert.NoError(t, err)
+				assert.Len(t, versionInfos, 0)
+				versionInfos, err = b.ListModelVersionInfos("foo", 20, -1)
+				assert.NoError(t, err)
+				assert.Equal(t, []uint{20, 21, 22, 23, 24, 25}, versionNumbers(versionInfos))
+			},
+		},
+		{
+			name: "TestUnknownModelErrors",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				checkUnknownModel := func(err error) {
+					concreteErr := &backend.UnknownModelError{}
+					if assert.ErrorAs(t, err, &concreteErr) {
+						assert.Equal(t, "foo", concreteErr.ModelID)
+					}
+					assert.ErrorIs(t, err, backend.ErrNotFound)
+				}
+
+				_, err := b.RetrieveModelInfo("foo")
+				checkUnknownModel(err)
+				_, err = b.RetrieveModelLatestVersionNumber("foo")
+				checkUnknownModel(err)
+				checkUnknownModel(b.DeleteModel("foo"))
+				_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+					CreationTimestamp: time.Now(),
+					Data:              Data1,
+					DataHash:          backend.ComputeSHA256Hash(Data1),
+				})
+				checkUnknownModel(err)
+				_, err = b.ListModelVersionInfos("foo", 0, 0)
+				checkUnknownModel(err)
+
+				// The versions of an unknown model are unknown as well
+				_, err = b.RetrieveModelVersionInfo("foo", 1)
+				assert.ErrorIs(t, err, backend.ErrNotFound)
+				_, err = b.RetrieveModelVersionData("foo", 1)
+				assert.ErrorIs(t, err, backend.ErrNotFound)
+				_, err = b.RetrieveModelVersionDataRange("foo", 1, 0, 10)
+				assert.ErrorIs(t, err, backend.ErrNotFound)
+				assert.ErrorIs(t, b.DeleteModelVersion("foo", 1), backend.ErrNotFound)
+			},
+		},
+		{
+			name: "TestUnknownModelVersionErrors",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+				assert.NoError(t, err)
+
+				checkUnknownVersion := func(err error, versionNumber int) {
+					concreteErr := &backend.UnknownModelVersionError{}
+					if assert.ErrorAs(t, err, &concreteErr) {
+						assert.Equal(t, "foo", concreteErr.ModelID)
+						assert.Equal(t, versionNumber, concreteErr.VersionNumber)
+					}
+					assert.ErrorIs(t, err, backend.ErrNotFound)
+					assert.NotErrorIs(t, err, backend.ErrCorrupted)
+				}
+
+				// Without any version, even the latest one is unknown
+				_, err = b.RetrieveModelVersionInfo("foo", -1)
+				assert.ErrorIs(t, err, backend.ErrNotFound)
+
+				createVersion(t, b, "foo", Data1)
+				for _, versionNumber := range []int{2, 10} {
+					_, err = b.RetrieveModelVersionInfo("foo", versionNumber)
+					checkUnknownVersion(err, versionNumber)
+					_, err = b.RetrieveModelVersionData("foo", versionNumber)
+					checkUnknownVersion(err, versionNumber)
+					_, err = b.RetrieveModelVersionDataRange("foo", versionNumber, 0, 10)
+					checkUnknownVersion(err, versionNumber)
+					_, err = b.UpdateModelVersionArchived("foo", versionNumber, true)
+					checkUnknownVersion(err, versionNumber)
+					_, err = b.UpdateModelVersionUserData("foo", versionNumber, map[string]string{"key": "value"})
+					checkUnknownVersion(err, versionNumber)
+					checkUnknownVersion(b.DeleteModelVersion("foo", versionNumber), versionNumber)
+				}
+
+				// Counting from the latest version past the first one
+				_, err = b.RetrieveModelVersionInfo("foo", -2)
+				assert.ErrorIs(t, err, backend.ErrNotFound)
+
+				// A deleted version is unknown, the others are kept
+				assert.NoError(t, b.DeleteModelVersion("foo", 1))
+				_, err = b.RetrieveModelVersionInfo("foo", 1)
+				checkUnknownVersion(err, 1)
+				hasModel, err := b.HasModel("foo")
+				assert.NoError(t, err)
+				assert.True(t, hasModel)
+			},
+		},
+		{
+			name: "TestLargeModelVersionData",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+				assert.NoError(t, err)
+
+				// Random data isn't compressible, unlike the other cases' text
+				data := make([]byte, largeDataSize)
+				_, _ = rand.New(rand.NewSource(1)).Read(data)
+				dataHash := backend.ComputeSHA256Hash(data)
+
+				versionInfo := createVersion(t, b, "foo", data)
+				assert.Equal(t, dataHash, versionInfo.DataHash)
+				assert.Equal(t, largeDataSize, versionInfo.DataSize)
+
+				// The same data written in chunks
+				writer, err := b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{
+					CreationTimestamp: time.Now(),
+					DataHash:          dataHash,
+				})
+				assert.NoError(t, err)
+				for offset := 0; offset < largeDataSize; offset += 64 * 1024 {
+					_, err = writer.Write(data[offset : offset+64*1024])
+					assert.NoError(t, err)
+				}
+				streamedVersionInfo, err := writer.Commit()
+				assert.NoError(t, err)
+				assert.Equal(t, dataHash, streamedVersionInfo.DataHash)
+				assert.Equal(t, largeDataSize, streamedVersionInfo.DataSize)
+
+				for _, versionNumber := range []uint{versionInfo.VersionNumber, streamedVersionInfo.VersionNumber} {
+					retrievedVersionInfo, err := b.RetrieveModelVersionInfo("foo", int(versionNumber))
+					assert.NoError(t, err)
+					assert.Equal(t, largeDataSize, retrievedVersionInfo.DataSize)
+					retrievedData, err := b.RetrieveModelVersionData("foo", int(versionNumber))
+					assert.NoError(t, err)
+					// Not assert.Equal, printing a mismatch of this size isn't useful
+					assert.True(t, len(retrievedData) == largeDataSize && backend.ComputeSHA256Hash(retrievedData) == dataHash, "retrieved data doesn't match the created one")
+					dataRange, err := b.RetrieveModelVersionDataRange("foo", int(versionNumber), largeDataSize/2, 1024)
+					assert.NoError(t, err)
+					assert.Equal(t, data[largeDataSize/2:largeDataSize/2+1024], dataRange)
+				}
+			},
+		},
+		{
+			name: "TestConcurrentCreateModelVersions",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+				assert.NoError(t, err)
+
+				// Versions created at once in the same model get distinct numbers without gaps
+				const workers = 8
+				const versionsPerWorker = 5
+				mutex := sync.Mutex{}
+				createdVersionNumbers := []uint{}
+				wg := sync.WaitGroup{}
+				for worker := 0; worker < workers; worker++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for i := 0; i < versionsPerWorker; i++ {
+							versionInfo := createVersion(t, b, "foo", Data2)
+							mutex.Lock()
+							createdVersionNumbers = append(createdVersionNumbers, versionInfo.VersionNumber)
+							mutex.Unlock()
+						}
+					}()
+				}
+				wg.Wait()
+
+				sort.Slice(createdVersionNumbers, func(i, j int) bool { return createdVersionNumbers[i] < createdVersionNumbers[j] })
+				expectedVersionNumbers := []uint{}
+				for versionNumber := uint(1); versionNumber <= workers*versionsPerWorker; versionNumber++ {
+					expectedVersionNumbers = append(expectedVersionNumbers, versionNumber)
+				}
+				assert.Equal(t, expectedVersionNumbers, createdVersionNumbers)
+				versionInfos, err := b.ListModelVersionInfos("foo", 0, 0)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedVersionNumbers, versionNumbers(versionInfos))
+				latestVersionNumber, err := b.RetrieveModelLatestVersionNumber("foo")
+				assert.NoError(t, err)
+				assert.Equal(t, uint(workers*versionsPerWorker), latestVersionNumber)
+			},
+		},
+		{
+			name: "TestConcurrentModelVersionStreams",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+				assert.NoError(t, err)
+
+				// Streams opened at once in the same model are written in turns and committed in reverse order
+				datas := [][]byte{Data1, Data2, Data1[:100]}
+				writers := []backend.VersionDataWriter{}
+				for _, data := range datas {
+					writer, err := b.CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{
+						CreationTimestamp: time.Now(),
+						DataHash:          backend.ComputeSHA256Hash(data),
+					})
+					assert.NoError(t, err)
+					writers = append(writers, writer)
+				}
+				for _, half := range []int{0, 1} {
+					for index, writer := range writers {
+						data := datas[index]
+						_, err := writer.Write(data[half*len(data)/2 : (half+1)*len(data)/2])
+						assert.NoError(t, err)
+					}
+				}
+				versionNumbersByData := map[uint][]byte{}
+				for index := len(writers) - 1; index >= 0; index-- {
+					versionInfo, err := writers[index].Commit()
+					assert.NoError(t, err)
+					assert.Equal(t, backend.ComputeSHA256Hash(datas[index]), versionInfo.DataHash)
+					versionNumbersByData[versionInfo.VersionNumber] = datas[index]
+				}
+				assert.Len(t, versionNumbersByData, len(datas))
+				for versionNumber, data := range versionNumbersByData {
+					retrievedData, err := b.RetrieveModelVersionData("foo", int(versionNumber))
+					assert.NoError(t, err)
+					assert.Equal(t, data, retrievedData)
+				}
+			},
+		},
+		{
+			name: "TestConcurrentModelOperations",
+			test: func(t *testing.T) {
+				b := createBackend()
+				defer destroyBackend(b)
+
+				// Models created, updated, listed and deleted at once don't interfere with each other
+				wg := sync.WaitGroup{}
+				for i := 0; i < 20; i++ {
+					modelID := fmt.Sprintf("model_%02d", i)
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: modelID})
+						assert.NoError(t, err)
+						createVersion(t, b, modelID, Data1)
+						_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: modelID, UserData: map[string]string{"updated": "true"}})
+						assert.NoError(t, err)
+						_, err = b.ListModels(0, 0)
+						assert.NoError(t, err)
+					}()
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						temporaryModelID := modelID + "_temporary"
+						_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: temporaryModelID})
+						assert.NoError(t, err)
+						assert.NoError(t, b.DeleteModel(temporaryModelID))
+					}()
+				}
+				wg.Wait()
+
+				models, err := b.ListModels(0, 0)
+				assert.NoError(t, err)
+				assert.Len(t, models, 20)
+				for _, model := range models {
+					assert.Equal(t, map[string]string{"updated": "true"}, model.UserData)
+					versionInfo, err := b.RetrieveModelVersionInfo(model.ModelID, -1)
+					assert.NoError(t, err)
+					assert.Equal(t, uint(1), versionInfo.VersionNumber)
+				}
+			},
+		},
+	}
+}
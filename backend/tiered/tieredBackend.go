@@ -0,0 +1,491 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tiered
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/sirupsen/logrus"
+)
+
+type tieredBackend struct {
+	hot  backend.Backend
+	cold backend.Backend
+}
+
+// CreateBackend creates a new backend storing non-archived versions in a fast hot backend and archived versions in a cold backend
+//
+// The models are stored in both tiers, the cold one being the reference. Archived versions are promoted to the hot tier
+// when their data is retrieved, its own eviction policy, e.g. a Redis TTL, defines how long they stay there.
+// The tiers are not destroyed with the created backend.
+func CreateBackend(hot backend.Backend, cold backend.Backend) (backend.Backend, error) {
+	return &tieredBackend{
+		hot:  hot,
+		cold: cold,
+	}, nil
+}
+
+func (b *tieredBackend) Destroy() {
+}
+
+// BindContext binds both underlying backends to the context
+func (b *tieredBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	boundHot, ok := backend.BindContext(b.hot, ctx)
+	if !ok {
+		return nil, false
+	}
+	boundCold, ok := backend.BindContext(b.cold, ctx)
+	if !ok {
+		return nil, false
+	}
+	return &tieredBackend{hot: boundHot, cold: boundCold}, true
+}
+
+func (b *tieredBackend) Ping() error {
+	if err := b.hot.Ping(); err != nil {
+		return err
+	}
+	return b.cold.Ping()
+}
+
+func isUnknownModelOrVersionError(err error) bool {
+	return errors.Is(err, backend.ErrNotFound)
+}
+
+// ensureHotModel makes sure the model exists in the hot tier, creating it from the cold tier if needed
+func (b *tieredBackend) ensureHotModel(modelID string) error {
+	hasModel, err := b.hot.HasModel(modelID)
+	if err != nil {
+		return err
+	}
+	if hasModel {
+		return nil
+	}
+	modelInfo, err := b.cold.RetrieveModelInfo(modelID)
+	if err != nil {
+		return err
+	}
+	_, err = b.hot.CreateOrUpdateModel(modelInfo)
+	return err
+}
+
+// evictHotVersion removes a version from the hot tier, e.g. because it is outdated
+func (b *tieredBackend) evictHotVersion(modelID string, versionNumber uint) {
+	err := b.hot.DeleteModelVersion(modelID, int(versionNumber))
+	if err != nil && !isUnknownModelOrVersionError(err) {
+		logrus.WithFields(logrus.Fields{"model_id": modelID, "version_number": versionNumber}).WithError(err).Warn("unable to evict a version from the hot tier")
+	}
+}
+
+// promoteVersion copies a version retrieved from the cold tier to the hot tier, the failures are only logged
+func (b *tieredBackend) promoteVersion(versionInfo backend.VersionInfo, versionData []byte) {
+	err := b.ensureHotModel(versionInfo.ModelID)
+	if err == nil {
+		_, err = b.hot.CreateOrUpdateModelVersion(versionInfo.ModelID, backend.VersionArgs{
+			VersionNumber:     versionInfo.VersionNumber,
+			CreationTimestamp: versionInfo.CreationTimestamp,
+			Archived:          versionInfo.Archived,
+			DataHash:          versionInfo.DataHash,
+			Data:              versionData,
+			UserData:          versionInfo.UserData,
+		})
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"model_id": versionInfo.ModelID, "version_number": versionInfo.VersionNumber}).WithError(err).Warn("unable to promote a version to the hot tier")
+	}
+}
+
+func (b *tieredBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	modelInfo, err := b.cold.CreateOrUpdateModel(modelArgs)
+	if err != nil {
+		return backend.ModelInfo{}, err
+	}
+	_, err = b.hot.CreateOrUpdateModel(modelInfo)
+	if err != nil {
+		return backend.ModelInfo{}, err
+	}
+	return modelInfo, nil
+}
+
+func (b *tieredBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	return b.cold.RetrieveModelInfo(modelID)
+}
+
+// RetrieveModelLatestVersionNumber retrieves the latest version number accross both tiers
+func (b *tieredBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	coldLatestVersionNumber, err := b.cold.RetrieveModelLatestVersionNumber(modelID)
+	if err != nil {
+		return 0, err
+	}
+	hotLatestVersionNumber, err := b.hot.RetrieveModelLatestVersionNumber(modelID)
+	if err != nil {
+		if !errors.As(err, new(*backend.UnknownModelError)) {
+			return 0, err
+		}
+		hotLatestVersionNumber = 0
+	}
+	if hotLatestVersionNumber > coldLatestVersionNumber {
+		return hotLatestVersionNumber, nil
+	}
+	return coldLatestVersionNumber, nil
+}
+
+// HasModel checks if a model exists
+func (b *tieredBackend) HasModel(modelID string) (bool, error) {
+	return b.cold.HasModel(modelID)
+}
+
+// DeleteModel deletes a model with a given id from both tiers
+func (b *tieredBackend) DeleteModel(modelID string) error {
+	err := b.cold.DeleteModel(modelID)
+	if err != nil {
+		return err
+	}
+	err = b.hot.DeleteModel(modelID)
+	if err != nil && !errors.As(err, new(*backend.UnknownModelError)) {
+		return err
+	}
+	return nil
+}
+
+// ListModels list models ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *tieredBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.cold.ListModels(offset, limit)
+}
+
+// QueryModels list models selected by the filter ordered by id from the given offset index, it returns at most the given limit number of models
+func (b *tieredBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.cold.QueryModels(filter, offset, limit)
+}
+
+// resolveVersionNumber computes the actual number of a version, negative version numbers denote the nth to last version accross both tiers
+func (b *tieredBackend) resolveVersionNumber(modelID string, versionNumber int) (uint, error) {
+	if versionNumber == 0 {
+		return 0, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	if versionNumber > 0 {
+		return uint(versionNumber), nil
+	}
+	if versionNumber == -1 {
+		latestVersionNumber, err := b.RetrieveModelLatestVersionNumber(modelID)
+		if err != nil {
+			return 0, err
+		}
+		if latestVersionNumber == 0 {
+			return 0, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return latestVersionNumber, nil
+	}
+	// Retrieve the nth to last version
+	versionInfos, err := b.ListModelVersionInfos(modelID, 0, -1)
+	if err != nil {
+		return 0, err
+	}
+	nthToLastIndex := -versionNumber - 1
+	if nthToLastIndex >= len(versionInfos) {
+		return 0, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	return versionInfos[len(versionInfos)-1-nthToLastIndex].VersionNumber, nil
+}
+
+// CreateOrUpdateModelVersion creates and store a new version for a model in the tier matching its archival status
+func (b *tieredBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	if versionArgs.VersionNumber == 0 {
+		// Version numbers are shared by both tiers
+		latestVersionNumber, err := b.RetrieveModelLatestVersionNumber(modelID)
+		if err != nil {
+			return backend.VersionInfo{}, err
+		}
+		versionArgs.VersionNumber = latestVersionNumber + 1
+	}
+
+	if versionArgs.Archived {
+		versionInfo, err := b.cold.CreateOrUpdateModelVersion(modelID, versionArgs)
+		if err != nil {
+			return backend.VersionInfo{}, err
+		}
+		b.evictHotVersion(modelID, versionInfo.VersionNumber)
+		return versionInfo, nil
+	}
+
+	hasModel, err := b.cold.HasModel(modelID)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	if !hasModel {
+		return backend.VersionInfo{}, &backend.UnknownModelError{ModelID: modelID}
+	}
+	err = b.ensureHotModel(modelID)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := b.hot.CreateOrUpdateModelVersion(modelID, versionArgs)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	// A version is only stored in one tier
+	err = b.cold.DeleteModelVersion(modelID, int(versionInfo.VersionNumber))
+	if err != nil && !isUnknownModelOrVersionError(err) {
+		logrus.WithFields(logrus.Fields{"model_id": modelID, "version_number": versionInfo.VersionNumber}).WithError(err).Warn("unable to delete an archived version replaced by a non-archived one")
+	}
+	return versionInfo, nil
+}
+
+type archivedVersionDataWriter struct {
+	backend.VersionDataWriter
+	tieredBackend *tieredBackend
+	modelID       string
+}
+
+func (w *archivedVersionDataWriter) Commit() (backend.VersionInfo, error) {
+	versionInfo, err := w.VersionDataWriter.Commit()
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	w.tieredBackend.evictHotVersion(w.modelID, versionInfo.VersionNumber)
+	return versionInfo, nil
+}
+
+// CreateOrUpdateModelVersionStream streams archived versions directly to the cold tier, non-archived versions are accumulated in memory
+func (b *tieredBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	if !versionArgs.Archived {
+		hasModel, err := b.cold.HasModel(modelID)
+		if err != nil {
+			return nil, err
+		}
+		if !hasModel {
+			return nil, &backend.UnknownModelError{ModelID: modelID}
+		}
+		return backend.CreateBufferedVersionDataWriter(b, modelID, versionArgs), nil
+	}
+
+	if versionArgs.VersionNumber == 0 {
+		// Version numbers are shared by both tiers
+		latestVersionNumber, err := b.RetrieveModelLatestVersionNumber(modelID)
+		if err != nil {
+			return nil, err
+		}
+		versionArgs.VersionNumber = latestVersionNumber + 1
+	}
+
+	coldWriter, err := b.cold.CreateOrUpdateModelVersionStream(modelID, versionArgs)
+	if err != nil {
+		return nil, err
+	}
+	return &archivedVersionDataWriter{
+		VersionDataWriter: coldWriter,
+		tieredBackend:     b,
+		modelID:           modelID,
+	}, nil
+}
+
+// RetrieveModelVersionInfo retrieves a given model version info, checking the hot tier first
+func (b *tieredBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err := b.hot.RetrieveModelVersionInfo(modelID, int(resolvedVersionNumber))
+	if err == nil {
+		return versionInfo, nil
+	}
+	if !isUnknownModelOrVersionError(err) {
+		return backend.VersionInfo{}, err
+	}
+	versionInfo, err = b.cold.RetrieveModelVersionInfo(modelID, int(resolvedVersionNumber))
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return backend.VersionInfo{}, err
+	}
+	return versionInfo, nil
+}
+
+// RetrieveModelVersionData retrieves a given model version data, checking the hot tier first and promoting the version to it otherwise
+func (b *tieredBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	versionData, err := b.hot.RetrieveModelVersionData(modelID, int(resolvedVersionNumber))
+	if err == nil {
+		return versionData, nil
+	}
+	if !isUnknownModelOrVersionError(err) {
+		return []byte{}, err
+	}
+	versionInfo, err := b.cold.RetrieveModelVersionInfo(modelID, int(resolvedVersionNumber))
+	if err == nil {
+		versionData, err = b.cold.RetrieveModelVersionData(modelID, int(resolvedVersionNumber))
+	}
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return []byte{}, err
+	}
+	b.promoteVersion(versionInfo, versionData)
+	return versionData, nil
+}
+
+// RetrieveModelVersionDataRange retrieves a range of a given model version data, checking the hot tier first, the version isn't promoted
+func (b *tieredBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return []byte{}, err
+	}
+	versionData, err := b.hot.RetrieveModelVersionDataRange(modelID, int(resolvedVersionNumber), offset, length)
+	if err == nil {
+		return versionData, nil
+	}
+	if !isUnknownModelOrVersionError(err) {
+		return []byte{}, err
+	}
+	versionData, err = b.cold.RetrieveModelVersionDataRange(modelID, int(resolvedVersionNumber), offset, length)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return []byte{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+		}
+		return []byte{}, err
+	}
+	return versionData, nil
+}
+
+// UpdateModelVersionArchived changes whether a given model version is archived, moving it to the tier matching its new archival status
+func (b *tieredBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	if versionInfo.Archived == archived {
+		return versionInfo, nil
+	}
+	versionData, err := b.RetrieveModelVersionData(modelID, int(versionInfo.VersionNumber))
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return b.CreateOrUpdateModelVersion(modelID, backend.VersionArgs{
+		VersionNumber:     versionInfo.VersionNumber,
+		CreationTimestamp: versionInfo.CreationTimestamp,
+		Archived:          archived,
+		DataHash:          versionInfo.DataHash,
+		Data:              versionData,
+		UserData:          versionInfo.UserData,
+	})
+}
+
+// UpdateModelVersionUserData replaces the user data of a given model version in the tiers holding it
+func (b *tieredBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	hotVersionInfo, hotErr := b.hot.UpdateModelVersionUserData(modelID, int(resolvedVersionNumber), userData)
+	if hotErr != nil && !isUnknownModelOrVersionError(hotErr) {
+		return backend.VersionInfo{}, hotErr
+	}
+	coldVersionInfo, coldErr := b.cold.UpdateModelVersionUserData(modelID, int(resolvedVersionNumber), userData)
+	if coldErr != nil && !isUnknownModelOrVersionError(coldErr) {
+		return backend.VersionInfo{}, coldErr
+	}
+	if hotErr == nil {
+		return hotVersionInfo, nil
+	}
+	if coldErr == nil {
+		return coldVersionInfo, nil
+	}
+	return backend.VersionInfo{}, &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+}
+
+// DeleteModelVersion deletes a given model version from both tiers
+func (b *tieredBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	resolvedVersionNumber, err := b.resolveVersionNumber(modelID, versionNumber)
+	if err != nil {
+		return err
+	}
+	hotErr := b.hot.DeleteModelVersion(modelID, int(resolvedVersionNumber))
+	if hotErr != nil && !isUnknownModelOrVersionError(hotErr) {
+		return hotErr
+	}
+	coldErr := b.cold.DeleteModelVersion(modelID, int(resolvedVersionNumber))
+	if coldErr != nil && !isUnknownModelOrVersionError(coldErr) {
+		return coldErr
+	}
+	if hotErr != nil && coldErr != nil {
+		return &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+	}
+	return nil
+}
+
+// ListModelVersionInfos lists the versions of both tiers ordered by version number
+func (b *tieredBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	coldVersionInfos, err := b.cold.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+	hotVersionInfos, err := b.hot.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+	if err != nil {
+		if !errors.As(err, new(*backend.UnknownModelError)) {
+			return []backend.VersionInfo{}, err
+		}
+		hotVersionInfos = []backend.VersionInfo{}
+	}
+
+	// Promoted versions are in both tiers
+	versionInfosByNumber := make(map[uint]backend.VersionInfo)
+	for _, versionInfo := range coldVersionInfos {
+		versionInfosByNumber[versionInfo.VersionNumber] = versionInfo
+	}
+	for _, versionInfo := range hotVersionInfos {
+		versionInfosByNumber[versionInfo.VersionNumber] = versionInfo
+	}
+	versionInfos := make([]backend.VersionInfo, 0, len(versionInfosByNumber))
+	for _, versionInfo := range versionInfosByNumber {
+		versionInfos = append(versionInfos, versionInfo)
+	}
+	sort.Slice(versionInfos, func(i, j int) bool { return versionInfos[i].VersionNumber < versionInfos[j].VersionNumber })
+	if limit > 0 && len(versionInfos) > limit {
+		versionInfos = versionInfos[:limit]
+	}
+	return versionInfos, nil
+}
+
+// QueryModelVersionInfos lists the versions selected by the filter ordered by version number from the given initial version number, it returns at most the given limit number of versions
+func (b *tieredBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	return backend.QueryModelVersionInfosByListing(b, modelID, filter, initialVersionNumber, limit)
+}
+
+// RetrieveStorageCapacity retrieves the combined capacity of both tiers, it is unknown if the capacity of either is
+func (b *tieredBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	hotCapacity, err := b.hot.RetrieveStorageCapacity()
+	if err != nil {
+		return backend.StorageCapacity{}, err
+	}
+	coldCapacity, err := b.cold.RetrieveStorageCapacity()
+	if err != nil {
+		return backend.StorageCapacity{}, err
+	}
+	if hotCapacity.TotalBytes == 0 || coldCapacity.TotalBytes == 0 {
+		return backend.StorageCapacity{}, nil
+	}
+	return backend.StorageCapacity{
+		TotalBytes:     hotCapacity.TotalBytes + coldCapacity.TotalBytes,
+		AvailableBytes: hotCapacity.AvailableBytes + coldCapacity.AvailableBytes,
+	}, nil
+}
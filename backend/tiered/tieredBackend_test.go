@@ -0,0 +1,93 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tiered
+
+import (
+	"testing"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/backend/objectStore"
+	"github.com/cogment/cogment-model-registry/backend/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type tiers struct {
+	hot  backend.Backend
+	cold backend.Backend
+}
+
+func createTiers(t *testing.T) tiers {
+	hot, err := objectStore.CreateBackend(objectStore.CreateMemoryStore())
+	assert.NoError(t, err)
+	cold, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	return tiers{hot: hot, cold: cold}
+}
+
+func TestSuiteTieredBackend(t *testing.T) {
+	createdTiers := make(map[backend.Backend]tiers)
+	test.RunSuite(t, func() backend.Backend {
+		tiers := createTiers(t)
+		b, err := CreateBackend(tiers.hot, tiers.cold)
+		assert.NoError(t, err)
+		createdTiers[b] = tiers
+		return b
+	}, func(b backend.Backend) {
+		b.Destroy()
+		createdTiers[b].hot.Destroy()
+		createdTiers[b].cold.Destroy()
+		delete(createdTiers, b)
+	})
+}
+
+func TestTieredBackendPromotion(t *testing.T) {
+	tiers := createTiers(t)
+	defer tiers.hot.Destroy()
+	defer tiers.cold.Destroy()
+	b, err := CreateBackend(tiers.hot, tiers.cold)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: test.Data1, Archived: true})
+	assert.NoError(t, err)
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: test.Data2, Archived: false})
+	assert.NoError(t, err)
+
+	// Each version is stored in a single tier
+	_, err = tiers.hot.RetrieveModelVersionInfo("foo", 1)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+	_, err = tiers.cold.RetrieveModelVersionInfo("foo", 2)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+
+	// Retrieving the archived version promotes it to the hot tier
+	versionData, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data1, versionData)
+	versionData, err = tiers.hot.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data1, versionData)
+
+	// Updating the archived version evicts the promoted copy
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{VersionNumber: 1, Data: test.Data2, Archived: true})
+	assert.NoError(t, err)
+	_, err = tiers.hot.RetrieveModelVersionInfo("foo", 1)
+	assert.IsType(t, &backend.UnknownModelVersionError{}, err)
+	versionData, err = b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, test.Data2, versionData)
+}
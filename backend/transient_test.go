@@ -0,0 +1,39 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransient(t *testing.T) {
+	assert.False(t, IsTransient(nil))
+	assert.False(t, IsTransient(errors.New("invalid argument")))
+	assert.False(t, IsTransient(fmt.Errorf("unable to retrieve model: %w", &UnknownModelError{ModelID: "foo"})))
+	assert.False(t, IsTransient(fmt.Errorf("unable to retrieve model: %w", context.Canceled)))
+
+	assert.True(t, IsTransient(fmt.Errorf("unable to put object: %w", &TransientError{Err: errors.New("503 Slow Down")})))
+	assert.True(t, IsTransient(fmt.Errorf("unable to query: %w", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)})))
+	assert.True(t, IsTransient(fmt.Errorf("unable to query: %w", os.ErrDeadlineExceeded)))
+	assert.True(t, IsTransient(context.DeadlineExceeded))
+}
@@ -15,7 +15,7 @@
 package backend
 
 import (
-	"fmt"
+	"io"
 	"time"
 )
 
@@ -27,13 +27,57 @@ type ModelInfo struct {
 
 // VersionInfo describes the informations (metadata) for a particular version of a model
 type VersionInfo struct {
-	ModelID           string
-	VersionNumber     uint
-	CreationTimestamp time.Time
-	Archived          bool
-	DataHash          string
-	DataSize          int
-	UserData          map[string]string
+	ModelID             string
+	VersionNumber       uint
+	CreationTimestamp   time.Time
+	Archived            bool
+	DataHash            string
+	DataSize            int
+	UserData            map[string]string
+	DataCompression     string // Codec compressing the data at rest, empty when the data is stored as is
+	DataEncryptionKeyID string // Id of the key encrypting the data at rest, empty when the data is stored in clear
+}
+
+// ModelFilter selects models, its zero value selects every model
+type ModelFilter struct {
+	ModelIDGlob      string            // Glob matching the whole model id, `*` matches any sequence and `?` any single character
+	UserDataEquals   map[string]string // User data entries the model needs to have
+	UserDataPrefixes map[string]string // User data keys the model needs to have, with a value starting with the given prefix
+}
+
+// ArchivedFilter selects versions depending on whether they are archived
+type ArchivedFilter int
+
+const (
+	AnyArchived ArchivedFilter = iota
+	ArchivedOnly
+	NonArchivedOnly
+)
+
+// ComparisonOperator is the operator of a UserDataComparison
+type ComparisonOperator int
+
+const (
+	LessThan ComparisonOperator = iota
+	LessOrEqual
+	GreaterThan
+	GreaterOrEqual
+)
+
+// UserDataComparison compares the numeric value of a user data entry, e.g. a reward stored by a trainer
+type UserDataComparison struct {
+	Key      string
+	Operator ComparisonOperator
+	Value    float64
+}
+
+// VersionFilter selects versions, its zero value selects every version
+type VersionFilter struct {
+	CreatedAfter        time.Time            // Inclusive lower bound of the creation timestamp, ignored if zero
+	CreatedBefore       time.Time            // Exclusive upper bound of the creation timestamp, ignored if zero
+	Archived            ArchivedFilter       // Whether archived, non-archived or any versions are selected
+	UserDataEquals      map[string]string    // User data entries the version needs to have
+	UserDataComparisons []UserDataComparison // Comparisons the version's user data needs to satisfy, entries not being numbers never do
 }
 
 // VersionArgs represents the arguments to create or update a version
@@ -42,10 +86,27 @@ type VersionArgs struct {
 	CreationTimestamp time.Time
 	Archived          bool
 	DataHash          string
+	DataHashAlgorithm string // Algorithm computing the hash when DataHash is empty, SHA-256 when empty
 	Data              []byte
+	DataSize          int // Size of the data written to a stream when known beforehand, 0 otherwise
 	UserData          map[string]string
 }
 
+// VersionDataWriter streams the data of a model version to a backend
+type VersionDataWriter interface {
+	io.Writer
+	// Commit stores the version with the written data and returns its info
+	Commit() (VersionInfo, error)
+	// Abort discards the written data, no version is created
+	Abort() error
+}
+
+// StorageCapacity describes the capacity of the storage underlying a backend, a zero TotalBytes means it is unknown
+type StorageCapacity struct {
+	TotalBytes     uint64
+	AvailableBytes uint64
+}
+
 // Backend defines the interface for a model registry backend
 type Backend interface {
 	Destroy()
@@ -56,35 +117,25 @@ type Backend interface {
 	HasModel(modelID string) (bool, error)
 	DeleteModel(modelID string) error
 	ListModels(offset int, limit int) ([]ModelInfo, error)
+	QueryModels(filter ModelFilter, offset int, limit int) ([]ModelInfo, error)
 
 	CreateOrUpdateModelVersion(modelID string, versionArgs VersionArgs) (VersionInfo, error)
+	CreateOrUpdateModelVersionStream(modelID string, versionArgs VersionArgs) (VersionDataWriter, error)
 	RetrieveModelVersionInfo(modelID string, versionNumber int) (VersionInfo, error)
 	RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error)
+	// RetrieveModelVersionDataRange retrieves length bytes of a model version data starting at offset, up to the end when length is 0
+	RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error)
+	// UpdateModelVersionArchived changes whether a model version is archived without rewriting its data
+	UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (VersionInfo, error)
+	// UpdateModelVersionUserData replaces the user data of a model version without rewriting its data
+	UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (VersionInfo, error)
 	DeleteModelVersion(modelID string, versionNumber int) error
 	ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]VersionInfo, error)
-}
-
-// UnknownModelError is raised when trying to operate on an unknown model
-type UnknownModelError struct {
-	ModelID string
-}
+	QueryModelVersionInfos(modelID string, filter VersionFilter, initialVersionNumber uint, limit int) ([]VersionInfo, error)
 
-func (e *UnknownModelError) Error() string {
-	return fmt.Sprintf("no model %q found", e.ModelID)
-}
-
-// UnknownModelVersionError is raised when trying to operate on an unknown model version
-type UnknownModelVersionError struct {
-	ModelID       string
-	VersionNumber int
-}
+	// RetrieveStorageCapacity retrieves the capacity of the storage underlying the backend
+	RetrieveStorageCapacity() (StorageCapacity, error)
 
-func (e *UnknownModelVersionError) Error() string {
-	if e.VersionNumber == 0 {
-		return fmt.Sprintf("model %q doesn't have any version yet", e.ModelID)
-	}
-	if e.VersionNumber < 0 {
-		return fmt.Sprintf(`no version "n%d" for model %q found`, e.VersionNumber, e.ModelID)
-	}
-	return fmt.Sprintf(`no version "%d" for model %q found`, e.VersionNumber, e.ModelID)
+	// Ping checks the storage underlying the backend is reachable
+	Ping() error
 }
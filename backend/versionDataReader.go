@@ -0,0 +1,55 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"bytes"
+	"io"
+)
+
+// VersionDataReader reads pieces of the data of a model version without loading all of it, e.g. from an open file
+type VersionDataReader interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// VersionDataOpener is implemented by the backends able to open the data of a model version
+type VersionDataOpener interface {
+	// OpenModelVersionData opens the data of a model version, the reader keeps reading the opened data if the version is
+	// updated or deleted. When opened is false the backend can't open this version, its data needs to be retrieved.
+	OpenModelVersionData(modelID string, versionNumber int) (versionInfo VersionInfo, reader VersionDataReader, opened bool, err error)
+}
+
+// OpenModelVersionData opens the data of a model version if the backend is able to
+func OpenModelVersionData(b Backend, modelID string, versionNumber int) (VersionInfo, VersionDataReader, bool, error) {
+	opener, ok := b.(VersionDataOpener)
+	if !ok {
+		return VersionInfo{}, nil, false, nil
+	}
+	return opener.OpenModelVersionData(modelID, versionNumber)
+}
+
+type bytesVersionDataReader struct {
+	*bytes.Reader
+}
+
+func (r bytesVersionDataReader) Close() error {
+	return nil
+}
+
+// CreateBytesVersionDataReader creates a reader of version data already in memory, for backends caching it
+func CreateBytesVersionDataReader(data []byte) VersionDataReader {
+	return bytesVersionDataReader{Reader: bytes.NewReader(data)}
+}
@@ -0,0 +1,33 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import "time"
+
+// VersionDataPresigner is implemented by the backends able to let clients download the data of a version directly
+type VersionDataPresigner interface {
+	// PresignModelVersionData returns a URL from which the data of a model version can be downloaded until it expires.
+	// When presigned is false the backend can't presign this version, its data needs to be retrieved.
+	PresignModelVersionData(modelID string, versionNumber int, expiration time.Duration) (versionInfo VersionInfo, url string, presigned bool, err error)
+}
+
+// PresignModelVersionData presigns the URL of the data of a model version if the backend is able to
+func PresignModelVersionData(b Backend, modelID string, versionNumber int, expiration time.Duration) (VersionInfo, string, bool, error) {
+	presigner, ok := b.(VersionDataPresigner)
+	if !ok {
+		return VersionInfo{}, "", false, nil
+	}
+	return presigner.PresignModelVersionData(modelID, versionNumber, expiration)
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"bytes"
+	"fmt"
+)
+
+type bufferedVersionDataWriter struct {
+	backend     Backend
+	modelID     string
+	versionArgs VersionArgs
+	buffer      *bytes.Buffer
+}
+
+// CreateBufferedVersionDataWriter creates a writer accumulating the data in memory and creating the version using `CreateOrUpdateModelVersion` on commit
+//
+// The hash of the data is computed on commit using the algorithm defined by CreateVersionHasher
+func CreateBufferedVersionDataWriter(b Backend, modelID string, versionArgs VersionArgs) VersionDataWriter {
+	return &bufferedVersionDataWriter{
+		backend:     b,
+		modelID:     modelID,
+		versionArgs: versionArgs,
+		buffer:      new(bytes.Buffer),
+	}
+}
+
+func (w *bufferedVersionDataWriter) Write(data []byte) (int, error) {
+	if w.buffer == nil {
+		return 0, fmt.Errorf("unable to write data for model %q: writer already closed", w.modelID)
+	}
+	return w.buffer.Write(data)
+}
+
+func (w *bufferedVersionDataWriter) Commit() (VersionInfo, error) {
+	if w.buffer == nil {
+		return VersionInfo{}, fmt.Errorf("unable to commit data for model %q: writer already closed", w.modelID)
+	}
+	data := w.buffer.Bytes()
+	w.buffer = nil
+
+	hasher, err := CreateVersionHasher(w.versionArgs)
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	_, _ = hasher.Write(data)
+	dataHash := hasher.Hash()
+	if w.versionArgs.DataHash != "" && w.versionArgs.DataHash != dataHash {
+		return VersionInfo{}, &DataHashMismatchError{ModelID: w.modelID, ExpectedDataHash: w.versionArgs.DataHash, DataHash: dataHash}
+	}
+
+	versionArgs := w.versionArgs
+	versionArgs.DataHash = dataHash
+	versionArgs.Data = data
+	return w.backend.CreateOrUpdateModelVersion(w.modelID, versionArgs)
+}
+
+func (w *bufferedVersionDataWriter) Abort() error {
+	w.buffer = nil
+	return nil
+}
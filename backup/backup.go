@@ -0,0 +1,433 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/objectStore"
+	"github.com/cogment/cogment-model-registry/modelIDs"
+	"github.com/sirupsen/logrus"
+)
+
+// FormatVersion is the version of the layout of the snapshots
+const FormatVersion = 1
+
+// Number of models or versions listed at once while walking the backend
+const pageSize = 100
+
+// Backups are laid out in their target as
+//
+//	snapshots/<timestamp>-<kind>.json
+//	blobs/<sha256 of the data>
+//
+// each snapshot lists every model and version of the backend along with the blobs holding their data, the blobs are
+// shared by the snapshots. The timestamps of the snapshots keys sort them chronologically.
+const (
+	snapshotsPrefix    = "snapshots/"
+	blobsPrefix        = "blobs/"
+	snapshotTimeLayout = "20060102T150405.000000000Z"
+)
+
+// Metrics published by every backuper under `/debug/vars`
+var (
+	snapshotsMetric      = expvar.NewInt("backup_snapshots")
+	failedBackupsMetric  = expvar.NewInt("backup_failures")
+	uploadedBytesMetric  = expvar.NewInt("backup_uploaded_bytes")
+	uploadedBlobsMetric  = expvar.NewInt("backup_uploaded_blobs")
+	reusedVersionsMetric = expvar.NewInt("backup_reused_versions")
+)
+
+// Kind is the kind of a backup
+type Kind string
+
+const (
+	// Full backups read the data of every version and upload every blob
+	Full Kind = "full"
+	// Incremental backups only read the data of the versions changed since the previous snapshot and upload the missing blobs
+	Incremental Kind = "incremental"
+)
+
+type Configuration struct {
+	Interval     time.Duration // Delay between the start of two backups
+	FullInterval time.Duration // Maximum delay between two full backups, the others are incremental, 0 makes every backup full
+}
+
+type snapshot struct {
+	FormatVersion int              `json:"format_version"`
+	Kind          Kind             `json:"kind"`
+	Timestamp     time.Time        `json:"timestamp"`
+	Base          string           `json:"base,omitempty"` // Key of the snapshot an incremental one was computed from
+	Models        []modelEntry     `json:"models"`
+	Blobs         map[string]int64 `json:"blobs"` // Size of every blob referenced by the versions, by their SHA-256
+}
+
+type modelEntry struct {
+	ModelID  string            `json:"model_id"`
+	UserData map[string]string `json:"user_data"`
+	Versions []versionEntry    `json:"versions"`
+}
+
+type versionEntry struct {
+	VersionNumber     uint              `json:"version_number"`
+	CreationTimestamp time.Time         `json:"creation_timestamp"`
+	Archived          bool              `json:"archived"`
+	DataHash          string            `json:"data_hash"`
+	DataSize          int               `json:"data_size"`
+	UserData          map[string]string `json:"user_data"`
+	Blob              string            `json:"blob"`
+}
+
+// SnapshotInfo describes a snapshot stored in a backup target
+type SnapshotInfo struct {
+	Key       string
+	Kind      Kind
+	Timestamp time.Time
+}
+
+// Report summarizes a backup
+type Report struct {
+	Snapshot       SnapshotInfo
+	ModelsCount    int
+	VersionsCount  int
+	UploadedBlobs  int
+	UploadedBytes  int64
+	ReusedVersions int // Versions unchanged since the previous snapshot, whose data wasn't read
+}
+
+// InvalidSnapshotError is raised when reading a snapshot that wasn't produced by a backuper
+type InvalidSnapshotError struct {
+	Key    string
+	Reason string
+}
+
+func (e *InvalidSnapshotError) Error() string {
+	return fmt.Sprintf("invalid backup snapshot %q, %s", e.Key, e.Reason)
+}
+
+// NoSnapshotError is raised when no snapshot was taken before the requested point in time
+type NoSnapshotError struct {
+	At time.Time
+}
+
+func (e *NoSnapshotError) Error() string {
+	if e.At.IsZero() {
+		return "no backup snapshot found"
+	}
+	return fmt.Sprintf("no backup snapshot found before %s", e.At.Format(time.RFC3339))
+}
+
+func blobKey(blob string) string {
+	return blobsPrefix + blob
+}
+
+func parseSnapshotKey(key string) (SnapshotInfo, bool) {
+	name := strings.TrimSuffix(strings.TrimPrefix(key, snapshotsPrefix), ".json")
+	separatorIndex := strings.LastIndex(name, "-")
+	if !strings.HasPrefix(key, snapshotsPrefix) || !strings.HasSuffix(key, ".json") || separatorIndex < 0 {
+		return SnapshotInfo{}, false
+	}
+	timestamp, err := time.Parse(snapshotTimeLayout, name[:separatorIndex])
+	kind := Kind(name[separatorIndex+1:])
+	if err != nil || (kind != Full && kind != Incremental) {
+		return SnapshotInfo{}, false
+	}
+	return SnapshotInfo{Key: key, Kind: kind, Timestamp: timestamp}, true
+}
+
+// ListSnapshots lists the snapshots stored in a backup target, from the oldest to the latest
+func ListSnapshots(target objectStore.Store) ([]SnapshotInfo, error) {
+	keys, err := target.ListObjects(snapshotsPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the backup snapshots: %w", err)
+	}
+	snapshotInfos := []SnapshotInfo{}
+	for _, key := range keys {
+		if snapshotInfo, ok := parseSnapshotKey(key); ok {
+			snapshotInfos = append(snapshotInfos, snapshotInfo)
+		}
+	}
+	return snapshotInfos, nil
+}
+
+// FindSnapshot finds the latest snapshot taken at or before the given point in time, the latest one if it is zero
+func FindSnapshot(target objectStore.Store, at time.Time) (SnapshotInfo, error) {
+	snapshotInfos, err := ListSnapshots(target)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	for index := len(snapshotInfos) - 1; index >= 0; index-- {
+		if at.IsZero() || !snapshotInfos[index].Timestamp.After(at) {
+			return snapshotInfos[index], nil
+		}
+	}
+	return SnapshotInfo{}, &NoSnapshotError{At: at}
+}
+
+func readSnapshot(target objectStore.Store, key string) (snapshot, error) {
+	reader, err := target.GetObject(key)
+	if err != nil {
+		return snapshot{}, fmt.Errorf("unable to retrieve backup snapshot %q: %w", key, err)
+	}
+	defer reader.Close()
+	s := snapshot{}
+	if err := json.NewDecoder(reader).Decode(&s); err != nil {
+		return snapshot{}, &InvalidSnapshotError{Key: key, Reason: err.Error()}
+	}
+	if s.FormatVersion != FormatVersion {
+		return snapshot{}, &InvalidSnapshotError{Key: key, Reason: fmt.Sprintf("unsupported format version %d, expecting %d", s.FormatVersion, FormatVersion)}
+	}
+	// The snapshots are restored in backends mapping the model ids to paths
+	for _, model := range s.Models {
+		if err := modelIDs.CheckPathSafety(model.ModelID); err != nil {
+			return snapshot{}, &InvalidSnapshotError{Key: key, Reason: err.Error()}
+		}
+	}
+	return s, nil
+}
+
+type Backuper struct {
+	backend       backend.Backend
+	target        objectStore.Store
+	configuration Configuration
+}
+
+// CreateBackuper creates a backuper taking snapshots of the models and versions of a backend to a target object store
+func CreateBackuper(b backend.Backend, target objectStore.Store, configuration Configuration) *Backuper {
+	return &Backuper{
+		backend:       b,
+		target:        target,
+		configuration: configuration,
+	}
+}
+
+// Run takes a backup every configured interval until the context is done, a full one if the latest full one is older
+// than the configured full interval
+func (b *Backuper) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.configuration.Interval)
+	defer ticker.Stop()
+	for {
+		kind, err := b.nextKind()
+		if err == nil {
+			var report Report
+			report, err = b.Backup(ctx, kind)
+			if err == nil {
+				logrus.WithFields(logrus.Fields{
+					"snapshot":        report.Snapshot.Key,
+					"models":          report.ModelsCount,
+					"versions":        report.VersionsCount,
+					"uploaded_blobs":  report.UploadedBlobs,
+					"uploaded_bytes":  report.UploadedBytes,
+					"reused_versions": report.ReusedVersions,
+				}).Info("Backup completed")
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			failedBackupsMetric.Add(1)
+			logrus.WithError(err).Error("Backup failed")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Backuper) nextKind() (Kind, error) {
+	if b.configuration.FullInterval <= 0 {
+		return Full, nil
+	}
+	snapshotInfos, err := ListSnapshots(b.target)
+	if err != nil {
+		return Full, err
+	}
+	for index := len(snapshotInfos) - 1; index >= 0; index-- {
+		if snapshotInfos[index].Kind == Full {
+			if time.Since(snapshotInfos[index].Timestamp) < b.configuration.FullInterval {
+				return Incremental, nil
+			}
+			break
+		}
+	}
+	return Full, nil
+}
+
+// Backup takes a snapshot of the backend, an incremental backup without any previous snapshot is a full one
+//
+// The snapshot is only stored once all the blobs were uploaded, an interrupted backup doesn't leave any snapshot.
+func (b *Backuper) Backup(ctx context.Context, kind Kind) (Report, error) {
+	s := snapshot{
+		FormatVersion: FormatVersion,
+		Kind:          kind,
+		Timestamp:     time.Now().UTC(),
+		Models:        []modelEntry{},
+		Blobs:         map[string]int64{},
+	}
+	// Versions of the previous snapshot, by model and number
+	baseVersions := map[string]map[uint]versionEntry{}
+	if kind == Incremental {
+		baseSnapshotInfo, err := FindSnapshot(b.target, time.Time{})
+		if _, ok := err.(*NoSnapshotError); ok {
+			s.Kind = Full
+		} else if err != nil {
+			return Report{}, err
+		} else {
+			baseSnapshot, err := readSnapshot(b.target, baseSnapshotInfo.Key)
+			if err != nil {
+				return Report{}, err
+			}
+			s.Base = baseSnapshotInfo.Key
+			for _, model := range baseSnapshot.Models {
+				baseVersions[model.ModelID] = make(map[uint]versionEntry, len(model.Versions))
+				for _, version := range model.Versions {
+					if _, ok := baseSnapshot.Blobs[version.Blob]; ok {
+						baseVersions[model.ModelID][version.VersionNumber] = version
+					}
+				}
+			}
+		}
+	}
+
+	report := Report{}
+	for modelOffset := 0; ; modelOffset += pageSize {
+		modelInfos, err := b.backend.ListModels(modelOffset, pageSize)
+		if err != nil {
+			return report, fmt.Errorf("unable to list models: %w", err)
+		}
+		for _, modelInfo := range modelInfos {
+			model, err := b.backupModel(ctx, modelInfo, baseVersions[modelInfo.ModelID], &s, &report)
+			if err != nil {
+				return report, err
+			}
+			s.Models = append(s.Models, model)
+		}
+		if len(modelInfos) < pageSize {
+			break
+		}
+	}
+
+	content, err := json.Marshal(s)
+	if err != nil {
+		return report, fmt.Errorf("unable to serialize the backup snapshot: %w", err)
+	}
+	key := fmt.Sprintf("%s%s-%s.json", snapshotsPrefix, s.Timestamp.Format(snapshotTimeLayout), s.Kind)
+	if err := b.target.PutObject(key, bytes.NewReader(content), int64(len(content))); err != nil {
+		return report, fmt.Errorf("unable to store backup snapshot %q: %w", key, err)
+	}
+	snapshotsMetric.Add(1)
+	report.Snapshot = SnapshotInfo{Key: key, Kind: s.Kind, Timestamp: s.Timestamp}
+	report.ModelsCount = len(s.Models)
+	return report, nil
+}
+
+func (b *Backuper) backupModel(ctx context.Context, modelInfo backend.ModelInfo, baseVersions map[uint]versionEntry, s *snapshot, report *Report) (modelEntry, error) {
+	model := modelEntry{ModelID: modelInfo.ModelID, UserData: modelInfo.UserData, Versions: []versionEntry{}}
+	for initialVersionNumber := uint(0); ; {
+		versionInfos, err := b.backend.ListModelVersionInfos(modelInfo.ModelID, initialVersionNumber, pageSize)
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				// Deleted during the backup, its versions aren't part of the snapshot
+				return model, nil
+			}
+			return model, fmt.Errorf("unable to list the versions of model %q: %w", modelInfo.ModelID, err)
+		}
+		for _, versionInfo := range versionInfos {
+			if err := ctx.Err(); err != nil {
+				return model, err
+			}
+			initialVersionNumber = versionInfo.VersionNumber + 1
+			version := versionEntry{
+				VersionNumber:     versionInfo.VersionNumber,
+				CreationTimestamp: versionInfo.CreationTimestamp,
+				Archived:          versionInfo.Archived,
+				DataHash:          versionInfo.DataHash,
+				DataSize:          versionInfo.DataSize,
+				UserData:          versionInfo.UserData,
+			}
+			baseVersion, ok := baseVersions[versionInfo.VersionNumber]
+			if ok && baseVersion.DataHash == versionInfo.DataHash && baseVersion.CreationTimestamp.Equal(versionInfo.CreationTimestamp) {
+				// Same data, only the archived flag or the user data may have changed
+				version.Blob = baseVersion.Blob
+				version.DataSize = baseVersion.DataSize
+				s.Blobs[version.Blob] = int64(baseVersion.DataSize)
+				report.ReusedVersions++
+				reusedVersionsMetric.Add(1)
+			} else {
+				data, err := b.backend.RetrieveModelVersionData(modelInfo.ModelID, int(versionInfo.VersionNumber))
+				if err != nil {
+					if errors.As(err, new(*backend.UnknownModelVersionError)) {
+						// Deleted during the backup
+						continue
+					}
+					return model, fmt.Errorf("unable to retrieve version \"%d\" of model %q: %w", versionInfo.VersionNumber, modelInfo.ModelID, err)
+				}
+				dataHash := sha256.Sum256(data)
+				version.Blob = hex.EncodeToString(dataHash[:])
+				version.DataSize = len(data)
+				if _, uploaded := s.Blobs[version.Blob]; !uploaded {
+					if err := b.target.PutObject(blobKey(version.Blob), bytes.NewReader(data), int64(len(data))); err != nil {
+						return model, fmt.Errorf("unable to store the data of version \"%d\" of model %q: %w", versionInfo.VersionNumber, modelInfo.ModelID, err)
+					}
+					report.UploadedBlobs++
+					report.UploadedBytes += int64(len(data))
+					uploadedBlobsMetric.Add(1)
+					uploadedBytesMetric.Add(int64(len(data)))
+				}
+				s.Blobs[version.Blob] = int64(len(data))
+			}
+			model.Versions = append(model.Versions, version)
+			report.VersionsCount++
+		}
+		if len(versionInfos) < pageSize {
+			return model, nil
+		}
+	}
+}
+
+// readBlob retrieves a blob and checks it against its size and SHA-256
+func readBlob(target objectStore.Store, blob string, size int64) ([]byte, error) {
+	reader, err := target.GetObject(blobKey(blob))
+	if _, ok := err.(*objectStore.UnknownObjectError); ok {
+		return nil, &IntegrityError{Blob: blob, Reason: "it is missing"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve backup blob %q: %w", blob, err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve backup blob %q: %w", blob, err)
+	}
+	if int64(len(data)) != size {
+		return nil, &IntegrityError{Blob: blob, Reason: fmt.Sprintf("expected %d bytes, found %d", size, len(data))}
+	}
+	dataHash := sha256.Sum256(data)
+	if hex.EncodeToString(dataHash[:]) != blob {
+		return nil, &IntegrityError{Blob: blob, Reason: "its content doesn't match its SHA-256"}
+	}
+	return data, nil
+}
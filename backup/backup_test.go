@@ -0,0 +1,194 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/backend/objectStore"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+var creationTimestamp = time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func createBackend(t *testing.T) backend.Backend {
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(b.Destroy)
+	return b
+}
+
+func createVersion(t *testing.T, b backend.Backend, modelID string, userData map[string]string, data []byte) {
+	_, err := b.CreateOrUpdateModelVersion(modelID, backend.VersionArgs{
+		CreationTimestamp: creationTimestamp,
+		Archived:          true,
+		DataHash:          backend.ComputeSHA256Hash(data),
+		Data:              data,
+		UserData:          userData,
+	})
+	assert.NoError(t, err)
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	ctx := context.Background()
+	b := createBackend(t)
+	_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{"team": "a"}})
+	assert.NoError(t, err)
+	createVersion(t, b, "foo", nil, data)
+	createVersion(t, b, "foo", map[string]string{"step": "2"}, data[:10])
+	// Same data, stored once
+	createVersion(t, b, "foo", nil, data)
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "bar"})
+	assert.NoError(t, err)
+
+	target := objectStore.CreateMemoryStore()
+	backuper := CreateBackuper(b, target, Configuration{})
+	fullReport, err := backuper.Backup(ctx, Full)
+	assert.NoError(t, err)
+	assert.Equal(t, Full, fullReport.Snapshot.Kind)
+	assert.Equal(t, 2, fullReport.ModelsCount)
+	assert.Equal(t, 3, fullReport.VersionsCount)
+	assert.Equal(t, 2, fullReport.UploadedBlobs)
+	assert.Equal(t, int64(len(data)+10), fullReport.UploadedBytes)
+
+	createVersion(t, b, "foo", nil, data[:20])
+	_, err = b.UpdateModelVersionUserData("foo", 1, map[string]string{"step": "1"})
+	assert.NoError(t, err)
+	assert.NoError(t, b.DeleteModel("bar"))
+	incrementalReport, err := backuper.Backup(ctx, Incremental)
+	assert.NoError(t, err)
+	assert.Equal(t, Incremental, incrementalReport.Snapshot.Kind)
+	assert.Equal(t, 1, incrementalReport.ModelsCount)
+	assert.Equal(t, 4, incrementalReport.VersionsCount)
+	assert.Equal(t, 3, incrementalReport.ReusedVersions)
+	assert.Equal(t, 1, incrementalReport.UploadedBlobs)
+	assert.Equal(t, int64(20), incrementalReport.UploadedBytes)
+
+	snapshotInfos, err := ListSnapshots(target)
+	assert.NoError(t, err)
+	assert.Equal(t, []SnapshotInfo{fullReport.Snapshot, incrementalReport.Snapshot}, snapshotInfos)
+
+	// Point in time restoration
+	snapshotInfo, err := FindSnapshot(target, incrementalReport.Snapshot.Timestamp.Add(-time.Nanosecond))
+	assert.NoError(t, err)
+	assert.Equal(t, fullReport.Snapshot, snapshotInfo)
+	_, err = FindSnapshot(target, fullReport.Snapshot.Timestamp.Add(-time.Second))
+	assert.IsType(t, &NoSnapshotError{}, err)
+
+	restoredBackend := createBackend(t)
+	restoreReport, err := Restore(ctx, target, snapshotInfo, restoredBackend, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, restoreReport.ModelsCount)
+	assert.Equal(t, 3, restoreReport.VersionsCount)
+	assert.Equal(t, 2, restoreReport.VerifiedBlobs)
+	modelInfo, err := restoredBackend.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "a"}, modelInfo.UserData)
+	hasModel, err := restoredBackend.HasModel("bar")
+	assert.NoError(t, err)
+	assert.True(t, hasModel)
+	versionInfo, err := restoredBackend.RetrieveModelVersionInfo("foo", 2)
+	assert.NoError(t, err)
+	assert.True(t, versionInfo.CreationTimestamp.Equal(creationTimestamp))
+	assert.True(t, versionInfo.Archived)
+	assert.Equal(t, map[string]string{"step": "2"}, versionInfo.UserData)
+	versionData, err := restoredBackend.RetrieveModelVersionData("foo", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:10], versionData)
+
+	// The restored backend already has models
+	_, err = Restore(ctx, target, incrementalReport.Snapshot, restoredBackend, false)
+	assert.IsType(t, &NonEmptyBackendError{}, err)
+	restoreReport, err = Restore(ctx, target, incrementalReport.Snapshot, restoredBackend, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, restoreReport.DeletedModels)
+	hasModel, err = restoredBackend.HasModel("bar")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+	versionInfos, err := restoredBackend.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 4)
+	assert.Equal(t, map[string]string{"step": "1"}, versionInfos[0].UserData)
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	b := createBackend(t)
+	_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	createVersion(t, b, "foo", nil, data)
+
+	target := objectStore.CreateMemoryStore()
+	report, err := CreateBackuper(b, target, Configuration{}).Backup(ctx, Incremental)
+	assert.NoError(t, err)
+	// Without any previous snapshot, the backup is a full one
+	assert.Equal(t, Full, report.Snapshot.Kind)
+	verifyReport, err := Verify(ctx, target, report.Snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, verifyReport.VerifiedBlobs)
+	assert.Equal(t, int64(len(data)), verifyReport.VerifiedBytes)
+
+	keys, err := target.ListObjects(blobsPrefix)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	corruptedData := append([]byte{}, data...)
+	corruptedData[0] = 'l'
+	assert.NoError(t, target.PutObject(keys[0], bytes.NewReader(corruptedData), int64(len(corruptedData))))
+	_, err = Verify(ctx, target, report.Snapshot)
+	assert.IsType(t, &IntegrityError{}, err)
+
+	// Nothing is restored from a corrupted snapshot
+	restoredBackend := createBackend(t)
+	_, err = Restore(ctx, target, report.Snapshot, restoredBackend, false)
+	assert.IsType(t, &IntegrityError{}, err)
+	hasModel, err := restoredBackend.HasModel("foo")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+
+	assert.NoError(t, target.DeleteObject(keys[0]))
+	_, err = Verify(ctx, target, report.Snapshot)
+	assert.IsType(t, &IntegrityError{}, err)
+}
+
+func TestNextKind(t *testing.T) {
+	b := createBackend(t)
+	target := objectStore.CreateMemoryStore()
+
+	kind, err := CreateBackuper(b, target, Configuration{}).nextKind()
+	assert.NoError(t, err)
+	assert.Equal(t, Full, kind)
+
+	backuper := CreateBackuper(b, target, Configuration{FullInterval: time.Hour})
+	kind, err = backuper.nextKind()
+	assert.NoError(t, err)
+	assert.Equal(t, Full, kind)
+	_, err = backuper.Backup(context.Background(), Full)
+	assert.NoError(t, err)
+	kind, err = backuper.nextKind()
+	assert.NoError(t, err)
+	assert.Equal(t, Incremental, kind)
+
+	kind, err = CreateBackuper(b, target, Configuration{FullInterval: time.Nanosecond}).nextKind()
+	assert.NoError(t, err)
+	assert.Equal(t, Full, kind)
+}
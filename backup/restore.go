@@ -0,0 +1,161 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/objectStore"
+)
+
+// IntegrityError is raised when a blob of a snapshot is missing or corrupted
+type IntegrityError struct {
+	Blob   string
+	Reason string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("backup blob %q failed the integrity verification, %s", e.Blob, e.Reason)
+}
+
+// NonEmptyBackendError is raised when restoring to a backend already having models without overwriting them
+type NonEmptyBackendError struct{}
+
+func (e *NonEmptyBackendError) Error() string {
+	return "the restored backend already has models"
+}
+
+// RestoreReport summarizes a verification or a restoration of a snapshot
+type RestoreReport struct {
+	Snapshot      SnapshotInfo
+	ModelsCount   int
+	VersionsCount int
+	VerifiedBlobs int
+	VerifiedBytes int64
+	DeletedModels int // Models of the backend deleted before the restoration
+}
+
+// Verify checks every blob of a snapshot against its size and SHA-256 and the data of every version against its hash
+func Verify(ctx context.Context, target objectStore.Store, snapshotInfo SnapshotInfo) (RestoreReport, error) {
+	s, err := readSnapshot(target, snapshotInfo.Key)
+	if err != nil {
+		return RestoreReport{Snapshot: snapshotInfo}, err
+	}
+	return verify(ctx, target, snapshotInfo, s)
+}
+
+func verify(ctx context.Context, target objectStore.Store, snapshotInfo SnapshotInfo, s snapshot) (RestoreReport, error) {
+	report := RestoreReport{Snapshot: snapshotInfo, ModelsCount: len(s.Models)}
+	// Data hashes of the versions, by blob
+	dataHashes := map[string][]string{}
+	for _, model := range s.Models {
+		for _, version := range model.Versions {
+			if _, ok := s.Blobs[version.Blob]; !ok {
+				return report, &InvalidSnapshotError{Key: snapshotInfo.Key, Reason: fmt.Sprintf("blob %q of version \"%d\" of model %q isn't in its manifest", version.Blob, version.VersionNumber, model.ModelID)}
+			}
+			dataHashes[version.Blob] = append(dataHashes[version.Blob], version.DataHash)
+			report.VersionsCount++
+		}
+	}
+	for blob, size := range s.Blobs {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		data, err := readBlob(target, blob, size)
+		if err != nil {
+			return report, err
+		}
+		for _, dataHash := range dataHashes[blob] {
+			matches, err := backend.VerifyDataHash(dataHash, data)
+			if err != nil || !matches {
+				return report, &IntegrityError{Blob: blob, Reason: fmt.Sprintf("its content doesn't match the version data hash %q", dataHash)}
+			}
+		}
+		report.VerifiedBlobs++
+		report.VerifiedBytes += size
+	}
+	return report, nil
+}
+
+func listModels(b backend.Backend) ([]backend.ModelInfo, error) {
+	modelInfos := []backend.ModelInfo{}
+	for modelOffset := 0; ; modelOffset += pageSize {
+		pageModelInfos, err := b.ListModels(modelOffset, pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list models: %w", err)
+		}
+		modelInfos = append(modelInfos, pageModelInfos...)
+		if len(pageModelInfos) < pageSize {
+			return modelInfos, nil
+		}
+	}
+}
+
+// Restore rebuilds a backend to the state of a snapshot, once the snapshot is verified
+//
+// Without overwrite, the backend can't have any model. With overwrite, the models of the backend are deleted before
+// the ones of the snapshot are created. The versions keep their number, creation timestamp, data hash and user data.
+func Restore(ctx context.Context, target objectStore.Store, snapshotInfo SnapshotInfo, b backend.Backend, overwrite bool) (RestoreReport, error) {
+	s, err := readSnapshot(target, snapshotInfo.Key)
+	if err != nil {
+		return RestoreReport{Snapshot: snapshotInfo}, err
+	}
+	existingModelInfos, err := listModels(b)
+	if err != nil {
+		return RestoreReport{Snapshot: snapshotInfo}, err
+	}
+	if len(existingModelInfos) > 0 && !overwrite {
+		return RestoreReport{Snapshot: snapshotInfo}, &NonEmptyBackendError{}
+	}
+	report, err := verify(ctx, target, snapshotInfo, s)
+	if err != nil {
+		return report, err
+	}
+
+	for _, modelInfo := range existingModelInfos {
+		if err := b.DeleteModel(modelInfo.ModelID); err != nil {
+			return report, fmt.Errorf("unable to delete model %q: %w", modelInfo.ModelID, err)
+		}
+		report.DeletedModels++
+	}
+	for _, model := range s.Models {
+		if _, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: model.ModelID, UserData: model.UserData}); err != nil {
+			return report, fmt.Errorf("unable to create model %q: %w", model.ModelID, err)
+		}
+		for _, version := range model.Versions {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			data, err := readBlob(target, version.Blob, s.Blobs[version.Blob])
+			if err != nil {
+				return report, err
+			}
+			_, err = b.CreateOrUpdateModelVersion(model.ModelID, backend.VersionArgs{
+				VersionNumber:     version.VersionNumber,
+				CreationTimestamp: version.CreationTimestamp,
+				Archived:          version.Archived,
+				DataHash:          version.DataHash,
+				Data:              data,
+				UserData:          version.UserData,
+			})
+			if err != nil {
+				return report, fmt.Errorf("unable to create version \"%d\" of model %q: %w", version.VersionNumber, model.ModelID, err)
+			}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/cogment/cogment-model-registry/backend/objectStore"
+	"github.com/cogment/cogment-model-registry/backup"
+	"github.com/cogment/cogment-model-registry/configuration"
+	"github.com/cogment/cogment-model-registry/logging"
+)
+
+const backupUsage = `Usage: cogment-model-registry backup <command> [<flags>]
+
+Commands, using the backup target and the storage of the registry configuration:
+  list     List the snapshots of the backup target
+  verify   Check the integrity of a snapshot, the latest one by default
+  restore  Rebuild the storage to a snapshot, the latest one by default, once it is verified, with the registry stopped
+
+Flags:
+`
+
+// runBackupCommand executes the `backup` command selected by the given command line arguments, without any server
+func runBackupCommand(args []string, stdout io.Writer) error {
+	flags := pflag.NewFlagSet("backup", pflag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	tenant := flags.String("tenant", "", "Tenant whose backups are used, the default registry's otherwise")
+	snapshotKey := flags.String("snapshot", "", "Key of the snapshot, as listed by `backup list`")
+	at := flags.String("at", "", "Point in time of the restored or verified snapshot, the latest snapshot taken at or before it is used, e.g. `2022-03-01T12:00:00Z`")
+	overwrite := flags.Bool("overwrite", false, "Delete the models of the storage before restoring, a storage with models is otherwise rejected")
+	usage := backupUsage + flags.FlagUsages()
+	if err := flags.Parse(args); err != nil {
+		if err == pflag.ErrHelp {
+			fmt.Fprintln(stdout, usage)
+			return nil
+		}
+		return fmt.Errorf("%s\n\n%s", err, usage)
+	}
+	if flags.NArg() != 1 || (flags.Arg(0) != "list" && flags.Arg(0) != "verify" && flags.Arg(0) != "restore") {
+		return fmt.Errorf("unknown command %q\n\n%s", strings.Join(append([]string{"backup"}, flags.Args()...), " "), usage)
+	}
+
+	settings := viper.New()
+	if err := configuration.Load(settings, os.Getenv(configuration.FileEnvVar)); err != nil {
+		return err
+	}
+	err := logging.Configure(logging.Configuration{
+		Level:  settings.GetString("LOG_LEVEL"),
+		Format: settings.GetString("LOG_FORMAT"),
+	})
+	if err != nil {
+		return err
+	}
+	log := logrus.NewEntry(logrus.StandardLogger())
+	if *tenant != "" {
+		tenantsSettings, err := configuration.LoadTenants(settings, settings.GetString("TENANTS_FILE"))
+		if err != nil {
+			return err
+		}
+		settings = tenantsSettings[strings.ToLower(*tenant)]
+		if settings == nil {
+			return fmt.Errorf("unknown tenant %q", *tenant)
+		}
+		log = log.WithField("tenant", *tenant)
+	}
+	target, _, err := createBackupTarget(settings)
+	if err != nil {
+		return err
+	}
+
+	if flags.Arg(0) == "list" {
+		return listSnapshots(target, stdout)
+	}
+	snapshotInfo, err := findSnapshot(target, *snapshotKey, *at)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if flags.Arg(0) == "verify" {
+		report, err := backup.Verify(ctx, target, snapshotInfo)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Snapshot %q verified, %d models, %d versions and %d blobs of %d bytes\n", snapshotInfo.Key, report.ModelsCount, report.VersionsCount, report.VerifiedBlobs, report.VerifiedBytes)
+		return nil
+	}
+
+	// The versions are restored to the persistent backends, without any cache or periodic task
+	restoredStorage := &storage{}
+	defer restoredStorage.destroy()
+	restoredStorage.create(ctx, settings, true, false, log)
+	report, err := backup.Restore(ctx, target, snapshotInfo, restoredStorage.backend, *overwrite)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Snapshot %q restored, %d models and %d versions created, %d models deleted\n", snapshotInfo.Key, report.ModelsCount, report.VersionsCount, report.DeletedModels)
+	return nil
+}
+
+func findSnapshot(target objectStore.Store, snapshotKey string, at string) (backup.SnapshotInfo, error) {
+	if snapshotKey != "" && at != "" {
+		return backup.SnapshotInfo{}, fmt.Errorf("--snapshot and --at can't be both defined")
+	}
+	if snapshotKey != "" {
+		snapshotInfos, err := backup.ListSnapshots(target)
+		if err != nil {
+			return backup.SnapshotInfo{}, err
+		}
+		for _, snapshotInfo := range snapshotInfos {
+			if snapshotInfo.Key == snapshotKey {
+				return snapshotInfo, nil
+			}
+		}
+		return backup.SnapshotInfo{}, fmt.Errorf("no backup snapshot %q found", snapshotKey)
+	}
+	pointInTime := time.Time{}
+	if at != "" {
+		var err error
+		pointInTime, err = time.Parse(time.RFC3339Nano, at)
+		if err != nil {
+			return backup.SnapshotInfo{}, fmt.Errorf("invalid point in time %q, expecting a RFC 3339 timestamp: %w", at, err)
+		}
+	}
+	return backup.FindSnapshot(target, pointInTime)
+}
+
+func listSnapshots(target objectStore.Store, stdout io.Writer) error {
+	snapshotInfos, err := backup.ListSnapshots(target)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SNAPSHOT\tKIND\tTIMESTAMP")
+	for _, snapshotInfo := range snapshotInfos {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", snapshotInfo.Key, snapshotInfo.Kind, snapshotInfo.Timestamp.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,217 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/client"
+)
+
+type Configuration struct {
+	ModelID     string // Model the versions are created in, it is created if needed
+	DataSize    int    // Size of the data of each created version
+	Concurrency int    // Number of operations running at once, 1 when 0
+	Uploads     int    // Number of created versions
+	Downloads   int    // Number of retrieved versions, cycling through the created ones
+	Keep        bool   // Keep the model and its versions once done instead of deleting them
+}
+
+// Stats summarizes the operations of one kind
+type Stats struct {
+	Operations int
+	Errors     int
+	Bytes      int64 // Data size of the successful operations
+	Duration   time.Duration
+	Latencies  Latencies
+}
+
+// Latencies are percentiles of the durations of the successful operations
+type Latencies struct {
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// BytesPerSecond is the throughput of the successful operations
+func (s Stats) BytesPerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Duration.Seconds()
+}
+
+// OperationsPerSecond is the rate of the successful operations
+func (s Stats) OperationsPerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Operations-s.Errors) / s.Duration.Seconds()
+}
+
+// Report is the outcome of a workload
+type Report struct {
+	Uploads   Stats
+	Downloads Stats
+	FirstErr  error // First error of an operation, if any
+}
+
+// Run creates then retrieves versions against a running model registry as configured
+func Run(ctx context.Context, c *client.Client, configuration Configuration) (Report, error) {
+	if configuration.Concurrency <= 0 {
+		configuration.Concurrency = 1
+	}
+	if configuration.DataSize < 0 || configuration.Uploads < 0 || configuration.Downloads < 0 {
+		return Report{}, fmt.Errorf("invalid workload %+v, expecting positive values or 0", configuration)
+	}
+	if err := c.CreateOrUpdateModel(ctx, client.ModelInfo{ModelID: configuration.ModelID}); err != nil {
+		return Report{}, fmt.Errorf("unable to create model %q: %w", configuration.ModelID, err)
+	}
+	if !configuration.Keep {
+		defer func() {
+			_ = c.DeleteModel(context.Background(), configuration.ModelID)
+		}()
+	}
+
+	report := Report{}
+	versionNumbers := make([]uint, configuration.Uploads)
+	var mutex sync.Mutex
+	recordErr := func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if report.FirstErr == nil {
+			report.FirstErr = err
+		}
+	}
+
+	data := make([]byte, configuration.DataSize)
+	// Random data isn't compressible, the backends do the same work as with actual weights
+	_, _ = rand.New(rand.NewSource(time.Now().UnixNano())).Read(data)
+	report.Uploads = execute(ctx, configuration.Uploads, configuration.Concurrency, func() func(index int) (int64, error) {
+		workerData := append([]byte{}, data...)
+		return func(index int) (int64, error) {
+			// Every version has its own data so that no backend can deduplicate it
+			if len(workerData) >= 8 {
+				binary.BigEndian.PutUint64(workerData, uint64(index))
+			}
+			versionInfo, err := c.CreateVersion(ctx, configuration.ModelID, client.VersionArgs{}, bytes.NewReader(workerData))
+			if err != nil {
+				err = fmt.Errorf("unable to create a version of model %q: %w", configuration.ModelID, err)
+				recordErr(err)
+				return 0, err
+			}
+			versionNumbers[index] = versionInfo.VersionNumber
+			return int64(len(workerData)), nil
+		}
+	})
+
+	retrievedVersionNumbers := []uint{}
+	for _, versionNumber := range versionNumbers {
+		if versionNumber > 0 {
+			retrievedVersionNumbers = append(retrievedVersionNumbers, versionNumber)
+		}
+	}
+	if configuration.Downloads > 0 && len(retrievedVersionNumbers) == 0 {
+		// Nothing uploaded by the workload, a single version is created to be retrieved
+		versionInfo, err := c.CreateVersion(ctx, configuration.ModelID, client.VersionArgs{}, bytes.NewReader(data))
+		if err != nil {
+			return report, fmt.Errorf("unable to create a version of model %q: %w", configuration.ModelID, err)
+		}
+		retrievedVersionNumbers = append(retrievedVersionNumbers, versionInfo.VersionNumber)
+	}
+	report.Downloads = execute(ctx, configuration.Downloads, configuration.Concurrency, func() func(index int) (int64, error) {
+		return func(index int) (int64, error) {
+			versionNumber := retrievedVersionNumbers[index%len(retrievedVersionNumbers)]
+			size, err := c.RetrieveVersionData(ctx, configuration.ModelID, int(versionNumber), io.Discard, false)
+			if err != nil {
+				err = fmt.Errorf("unable to retrieve version %d of model %q: %w", versionNumber, configuration.ModelID, err)
+				recordErr(err)
+				return 0, err
+			}
+			return size, nil
+		}
+	})
+	return report, ctx.Err()
+}
+
+// execute runs the given number of operations with a number of workers, each creating its operation function once
+func execute(ctx context.Context, operations int, concurrency int, createWorker func() func(index int) (int64, error)) Stats {
+	stats := Stats{}
+	indexes := make(chan int)
+	var mutex sync.Mutex
+	latencies := make([]time.Duration, 0, operations)
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < concurrency && worker < operations; worker++ {
+		operation := createWorker()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				startTime := time.Now()
+				size, err := operation(index)
+				latency := time.Since(startTime)
+				mutex.Lock()
+				stats.Operations++
+				if err != nil {
+					stats.Errors++
+				} else {
+					stats.Bytes += size
+					latencies = append(latencies, latency)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	startTime := time.Now()
+	for index := 0; index < operations && ctx.Err() == nil; index++ {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	stats.Duration = time.Since(startTime)
+	stats.Latencies = computeLatencies(latencies)
+	return stats
+}
+
+func computeLatencies(latencies []time.Duration) Latencies {
+	if len(latencies) == 0 {
+		return Latencies{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	// Nearest rank
+	percentile := func(p int) time.Duration {
+		rank := (p*len(latencies) + 99) / 100
+		if rank < 1 {
+			rank = 1
+		}
+		return latencies[rank-1]
+	}
+	return Latencies{
+		P50: percentile(50),
+		P90: percentile(90),
+		P99: percentile(99),
+		Max: latencies[len(latencies)-1],
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+)
+
+// startServer starts a model registry server on a local port and returns a client connected to it
+func startServer(tb testing.TB) (*client.Client, backend.Backend) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(tb, err)
+	server := grpc.NewServer()
+	tb.Cleanup(server.Stop)
+	b, err := fs.CreateBackend(tb.TempDir())
+	assert.NoError(tb, err)
+	tb.Cleanup(b.Destroy)
+	modelRegistryServer, err := grpcservers.RegisterModelRegistryServer(server, grpcservers.ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 1024 * 1024,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+	})
+	assert.NoError(tb, err)
+	modelRegistryServer.SetBackend(b)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	c, err := client.CreateClient(context.Background(), client.Configuration{Address: listener.Addr().String(), ChunkSize: 64 * 1024})
+	assert.NoError(tb, err)
+	tb.Cleanup(func() { c.Close() })
+	return c, b
+}
+
+func TestRun(t *testing.T) {
+	c, b := startServer(t)
+	report, err := Run(context.Background(), c, Configuration{ModelID: "bench", DataSize: 100, Concurrency: 3, Uploads: 5, Downloads: 7, Keep: true})
+	assert.NoError(t, err)
+	assert.NoError(t, report.FirstErr)
+	assert.Equal(t, 5, report.Uploads.Operations)
+	assert.Equal(t, 0, report.Uploads.Errors)
+	assert.Equal(t, int64(500), report.Uploads.Bytes)
+	assert.Equal(t, 7, report.Downloads.Operations)
+	assert.Equal(t, int64(700), report.Downloads.Bytes)
+	assert.Greater(t, int64(report.Downloads.Latencies.P50), int64(0))
+	assert.LessOrEqual(t, int64(report.Downloads.Latencies.P99), int64(report.Downloads.Latencies.Max))
+	assert.Greater(t, report.Uploads.BytesPerSecond(), float64(0))
+
+	// Every version has its own data
+	versionInfos, err := b.ListModelVersionInfos("bench", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 5)
+	dataHashes := map[string]bool{}
+	for _, versionInfo := range versionInfos {
+		dataHashes[versionInfo.DataHash] = true
+	}
+	assert.Len(t, dataHashes, 5)
+
+	// Without uploads, a single version is created to be retrieved and the model is deleted once done
+	report, err = Run(context.Background(), c, Configuration{ModelID: "bench_downloads", DataSize: 10, Downloads: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Uploads.Operations)
+	assert.Equal(t, int64(20), report.Downloads.Bytes)
+	hasModel, err := b.HasModel("bench_downloads")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+
+	_, err = Run(context.Background(), c, Configuration{ModelID: "bench", Uploads: -1})
+	assert.Error(t, err)
+}
+
+func TestComputeLatencies(t *testing.T) {
+	latencies := []time.Duration{}
+	for latency := 100; latency > 0; latency-- {
+		latencies = append(latencies, time.Duration(latency)*time.Millisecond)
+	}
+	assert.Equal(t, Latencies{
+		P50: 50 * time.Millisecond,
+		P90: 90 * time.Millisecond,
+		P99: 99 * time.Millisecond,
+		Max: 100 * time.Millisecond,
+	}, computeLatencies(latencies))
+	assert.Equal(t, Latencies{P50: time.Second, P90: time.Second, P99: time.Second, Max: time.Second}, computeLatencies([]time.Duration{time.Second}))
+	assert.Equal(t, Latencies{}, computeLatencies(nil))
+}
+
+func runBenchmark(b *testing.B, dataSize int, concurrency int, upload bool) {
+	c, _ := startServer(b)
+	configuration := Configuration{ModelID: "bench", DataSize: dataSize, Concurrency: concurrency}
+	if upload {
+		configuration.Uploads = b.N
+	} else {
+		configuration.Downloads = b.N
+	}
+	b.SetBytes(int64(dataSize))
+	b.ResetTimer()
+	report, err := Run(context.Background(), c, configuration)
+	assert.NoError(b, err)
+	assert.NoError(b, report.FirstErr)
+}
+
+func runBenchmarkSuite(b *testing.B, upload bool) {
+	for _, dataSize := range []int{1024, 1024 * 1024, 16 * 1024 * 1024} {
+		for _, concurrency := range []int{1, 8} {
+			dataSize, concurrency := dataSize, concurrency
+			b.Run(fmt.Sprintf("%dKiB_%dc", dataSize/1024, concurrency), func(b *testing.B) {
+				runBenchmark(b, dataSize, concurrency, upload)
+			})
+		}
+	}
+}
+
+func BenchmarkUploads(b *testing.B) {
+	runBenchmarkSuite(b, true)
+}
+
+func BenchmarkDownloads(b *testing.B) {
+	runBenchmarkSuite(b, false)
+}
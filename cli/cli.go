@@ -0,0 +1,161 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/cogment/cogment-model-registry/client"
+)
+
+// UsageError is raised when the command line doesn't match any command or its expected arguments
+type UsageError struct {
+	Message string
+	Usage   string
+}
+
+func (e *UsageError) Error() string {
+	return fmt.Sprintf("%s\n\n%s", e.Message, e.Usage)
+}
+
+// runner executes a command once its flags are parsed
+type runner func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error
+
+type command struct {
+	name        string // Words selecting the command, e.g. "models list"
+	arguments   string // Usage of the positional arguments
+	description string
+	minArgs     int
+	maxArgs     int // -1 accepts any number of arguments
+	// define adds the flags of the command and returns its runner
+	define func(flags *pflag.FlagSet) runner
+}
+
+func defineConnectionFlags(flags *pflag.FlagSet, configuration *client.Configuration) {
+	flags.StringVar(&configuration.Address, "address", envOrDefault("COGMENT_MODEL_REGISTRY_ADDRESS", "localhost:9000"), "Address of the model registry, defaults to $COGMENT_MODEL_REGISTRY_ADDRESS")
+	flags.StringVar(&configuration.Token, "token", os.Getenv("COGMENT_MODEL_REGISTRY_TOKEN"), "Authorization token, defaults to $COGMENT_MODEL_REGISTRY_TOKEN")
+	flags.StringVar(&configuration.TLSCAFile, "tls-ca-file", "", "PEM encoded CA certificates verifying the server, enables TLS")
+	flags.StringVar(&configuration.TLSCertFile, "tls-cert-file", "", "PEM encoded client certificate, for mutual TLS")
+	flags.StringVar(&configuration.TLSKeyFile, "tls-key-file", "", "PEM encoded client private key, for mutual TLS")
+	flags.IntVar(&configuration.Retries, "retries", 3, "Number of times idempotent calls failing with UNAVAILABLE are retried")
+	flags.IntVar(&configuration.ChunkSize, "chunk-size", client.DefaultChunkSize, "Size in bytes of the data chunks sent while creating a version")
+	flags.IntVar(&configuration.ReceivedChunkSize, "received-chunk-size", 0, "Size in bytes of the data chunks the server is asked to send, its own setting when 0")
+}
+
+func envOrDefault(key string, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// overview lists every command with its arguments
+func overview() string {
+	var overview strings.Builder
+	overview.WriteString("Without a command, or with `--restore-from <file>` only, the model registry server is started, the commands operate a running server:\n\n")
+	w := tabwriter.NewWriter(&overview, 0, 4, 2, ' ', 0)
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", command.name, command.arguments, command.description)
+	}
+	_ = w.Flush()
+	return strings.TrimSuffix(overview.String(), "\n")
+}
+
+// usageError wraps an error of the command line in a UsageError with the usage of the command
+func usageError(cmd *cobra.Command, err error) error {
+	return &UsageError{Message: err.Error(), Usage: strings.TrimSuffix(cmd.UsageString(), "\n")}
+}
+
+// unknownSubcommand is run by the commands only grouping other commands, e.g. `models`
+func unknownSubcommand(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return cmd.Help()
+	}
+	return usageError(cmd, fmt.Errorf("unknown command %q", strings.Join(append(strings.Fields(cmd.CommandPath())[1:], args...), " ")))
+}
+
+// createCommand creates the subcommand running a command of the table, the connection flags are inherited from the root
+func createCommand(command command, clientConfiguration *client.Configuration, stdout io.Writer) *cobra.Command {
+	words := strings.Fields(command.name)
+	cobraCommand := &cobra.Command{
+		Use:   strings.TrimSpace(words[len(words)-1] + " " + command.arguments),
+		Short: command.description,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < command.minArgs || (command.maxArgs >= 0 && len(args) > command.maxArgs) {
+				return usageError(cmd, fmt.Errorf("%q expects %s", command.name, command.arguments))
+			}
+			return nil
+		},
+	}
+	run := command.define(cobraCommand.Flags())
+	cobraCommand.RunE = func(cmd *cobra.Command, args []string) error {
+		c, err := client.CreateClient(cmd.Context(), *clientConfiguration)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		return run(cmd.Context(), c, args, stdout)
+	}
+	return cobraCommand
+}
+
+// createRootCommand creates the cobra command tree of the commands, each word of their name being a subcommand
+func createRootCommand(stdout io.Writer) *cobra.Command {
+	root := &cobra.Command{
+		Use:           "cogment-model-registry",
+		Long:          overview(),
+		Args:          cobra.ArbitraryArgs,
+		RunE:          unknownSubcommand,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	root.SetOut(stdout)
+	root.SetFlagErrorFunc(usageError)
+	clientConfiguration := &client.Configuration{}
+	defineConnectionFlags(root.PersistentFlags(), clientConfiguration)
+
+	groups := map[string]*cobra.Command{}
+	for _, command := range commands {
+		parent := root
+		words := strings.Fields(command.name)
+		for index := range words[:len(words)-1] {
+			path := strings.Join(words[:index+1], " ")
+			group, ok := groups[path]
+			if !ok {
+				group = &cobra.Command{Use: words[index], Args: cobra.ArbitraryArgs, RunE: unknownSubcommand}
+				groups[path] = group
+				parent.AddCommand(group)
+			}
+			parent = group
+		}
+		parent.AddCommand(createCommand(command, clientConfiguration, stdout))
+	}
+	return root
+}
+
+// Run executes the command selected by the given command line arguments
+func Run(ctx context.Context, args []string, stdout io.Writer) error {
+	root := createRootCommand(stdout)
+	root.SetArgs(args)
+	return root.ExecuteContext(ctx)
+}
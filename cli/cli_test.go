@@ -0,0 +1,419 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+	"github.com/cogment/cogment-model-registry/retention"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+// startServer starts a model registry server on a local port and returns its address
+func startServer(t *testing.T) (string, backend.Backend) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	t.Cleanup(server.Stop)
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(b.Destroy)
+	modelRegistryServer, err := grpcservers.RegisterModelRegistryServer(server, grpcservers.ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 16,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+	})
+	assert.NoError(t, err)
+	modelRegistryServer.SetBackend(b)
+	// Without a default policy, only the models defining their own retention policy are collected
+	modelRegistryServer.SetRetentionCollector(retention.CreateCollector(b, retention.Configuration{}))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return listener.Addr().String(), b
+}
+
+func run(t *testing.T, address string, args ...string) (string, error) {
+	stdout := bytes.Buffer{}
+	err := Run(context.Background(), append(args, "--address", address), &stdout)
+	return stdout.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	address, b := startServer(t)
+	_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{"team": "a"}})
+	assert.NoError(t, err)
+
+	filename := filepath.Join(t.TempDir(), "model.data")
+	assert.NoError(t, ioutil.WriteFile(filename, data, 0600))
+
+	output, err := run(t, address, "version", "push", "foo", filename, "--archived", "--user-data", "step=10")
+	assert.NoError(t, err)
+	pushedVersionInfo := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(output), &pushedVersionInfo))
+	assert.Equal(t, float64(1), pushedVersionInfo["versionNumber"])
+	assert.Equal(t, backend.ComputeSHA256Hash(data), pushedVersionInfo["dataHash"])
+	assert.Equal(t, true, pushedVersionInfo["archived"])
+
+	output, err = run(t, address, "version", "push", "foo", filename, "--description", "Second try")
+	assert.NoError(t, err)
+	assert.Contains(t, output, `"description": "Second try"`)
+
+	output, err = run(t, address, "models", "list")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"MODEL ID  USER DATA", "foo       team=a"}, strings.Split(strings.TrimSpace(output), "\n"))
+	output, err = run(t, address, "models", "list", "--namespace", "team_a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"MODEL ID  USER DATA"}, strings.Split(strings.TrimSpace(output), "\n"))
+
+	output, err = run(t, address, "versions", "list", "foo")
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[1], "step=10")
+
+	output, err = run(t, address, "model", "inspect", "foo")
+	assert.NoError(t, err)
+	inspection := map[string]map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(output), &inspection))
+	assert.Equal(t, "foo", inspection["modelInfo"]["modelId"])
+	assert.Equal(t, float64(2), inspection["latestVersionInfo"]["versionNumber"])
+
+	output, err = run(t, address, "version", "inspect", "foo", "1")
+	assert.NoError(t, err)
+	assert.Contains(t, output, `"step": "10"`)
+
+	output, err = run(t, address, "version", "pull", "foo", "1", "--verify")
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), output)
+
+	pulledFilename := filepath.Join(t.TempDir(), "pulled.data")
+	_, err = run(t, address, "version", "pull", "foo", "-o", pulledFilename)
+	assert.NoError(t, err)
+	pulledData, err := ioutil.ReadFile(pulledFilename)
+	assert.NoError(t, err)
+	assert.Equal(t, data, pulledData)
+
+	output, err = run(t, address, "version", "update", "foo", "1", "--description", "First try", "--user-data", "reward=0.5", "--remove-user-data", "step")
+	assert.NoError(t, err)
+	update := struct {
+		VersionInfo map[string]interface{} `json:"versionInfo"`
+		ETag        string                 `json:"etag"`
+	}{}
+	assert.NoError(t, json.Unmarshal([]byte(output), &update))
+	assert.Equal(t, "First try", update.VersionInfo["description"])
+	assert.Equal(t, map[string]interface{}{"reward": "0.5", "cogment_model_registry.description": "First try"}, update.VersionInfo["userData"])
+	output, err = run(t, address, "version", "update", "foo", "1", "--description", "", "--etag", update.ETag)
+	assert.NoError(t, err)
+	assert.NotContains(t, output, "First try")
+	_, err = run(t, address, "version", "update", "foo", "1", "--archived=false", "--etag", update.ETag)
+	assert.Error(t, err)
+
+	_, err = run(t, address, "version", "update", "foo", "1", "--metric", "reward=0.25")
+	assert.NoError(t, err)
+	_, err = run(t, address, "version", "update", "foo", "2", "--metric", "reward=0.75")
+	assert.NoError(t, err)
+	_, err = run(t, address, "version", "update", "foo", "2", "--metric", "reward=high")
+	assert.Error(t, err)
+	output, err = run(t, address, "version", "push", "foo", filename, "--parent-version", "2", "--run-id", "run-1")
+	assert.NoError(t, err)
+	assert.Contains(t, output, `"parentVersionNumber": 2`)
+	output, err = run(t, address, "version", "lineage", "foo")
+	assert.NoError(t, err)
+	lines = strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[1], "run-1")
+	_, err = run(t, address, "version", "delete", "foo", "3")
+	assert.NoError(t, err)
+
+	manifestFilename := filepath.Join(t.TempDir(), "manifest.json")
+	assert.NoError(t, ioutil.WriteFile(manifestFilename, []byte(`{"framework":"pytorch","frameworkVersion":"2.1.0","inputs":[{"name":"observation","dtype":"float32"}]}`), 0600))
+	output, err = run(t, address, "version", "push", "foo", filename, "--manifest", manifestFilename)
+	assert.NoError(t, err)
+	assert.Contains(t, output, `"frameworkVersion": "2.1.0"`)
+	pushedVersionInfo = map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(output), &pushedVersionInfo))
+	manifestVersionNumber := fmt.Sprintf("%v", pushedVersionInfo["versionNumber"])
+	output, err = run(t, address, "versions", "compatible", "foo", "pytorch", "--framework-version", "2.1.0")
+	assert.NoError(t, err)
+	lines = strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[1], manifestVersionNumber+" "))
+	_, err = run(t, address, "version", "delete", "foo", manifestVersionNumber)
+	assert.NoError(t, err)
+
+	configFilename := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, ioutil.WriteFile(configFilename, data[:10], 0600))
+	output, err = run(t, address, "version", "push-artifacts", "foo", "weights="+filename, "config="+configFilename)
+	assert.NoError(t, err)
+	pushedVersionInfo = map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(output), &pushedVersionInfo))
+	assert.Len(t, pushedVersionInfo["artifacts"], 2)
+	artifactsVersionNumber := fmt.Sprintf("%v", pushedVersionInfo["versionNumber"])
+	output, err = run(t, address, "version", "pull", "foo", artifactsVersionNumber, "--artifact", "config")
+	assert.NoError(t, err)
+	assert.Equal(t, string(data[:10]), output)
+	_, err = run(t, address, "version", "pull", "foo", artifactsVersionNumber, "--artifact", "optimizer")
+	assert.Error(t, err)
+	_, err = run(t, address, "version", "push-artifacts", "foo", filename)
+	assert.Error(t, err)
+	_, err = run(t, address, "version", "delete", "foo", artifactsVersionNumber)
+	assert.NoError(t, err)
+
+	output, err = run(t, address, "version", "push", "foo", filename, "--dependency", "foo=1")
+	assert.NoError(t, err)
+	pushedVersionInfo = map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(output), &pushedVersionInfo))
+	dependentVersionNumber := fmt.Sprintf("%v", pushedVersionInfo["versionNumber"])
+	_, err = run(t, address, "version", "push", "foo", filename, "--dependency", "foo="+dependentVersionNumber)
+	assert.NoError(t, err)
+	_, err = run(t, address, "version", "push", "foo", filename, "--dependency", "foo=latest")
+	assert.Error(t, err)
+	output, err = run(t, address, "version", "dependencies", "foo", dependentVersionNumber, "--dependents")
+	assert.NoError(t, err)
+	graph := struct {
+		Versions []map[string]interface{} `json:"versions"`
+		Edges    []map[string]interface{} `json:"edges"`
+	}{}
+	assert.NoError(t, json.Unmarshal([]byte(output), &graph))
+	assert.Len(t, graph.Versions, 3)
+	assert.Len(t, graph.Edges, 2)
+	_, err = run(t, address, "version", "delete", "foo", dependentVersionNumber)
+	assert.Error(t, err)
+	output, err = run(t, address, "version", "delete", "foo", dependentVersionNumber, "--cascade")
+	assert.NoError(t, err)
+	lines = strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, fmt.Sprintf("Version %q of model \"foo\" deleted", dependentVersionNumber), lines[1])
+
+	output, err = run(t, address, "model", "clone", "foo", "bar", "--version", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, "Model \"foo\" cloned as \"bar\" with 1 version(s)\n", output)
+	output, err = run(t, address, "versions", "list", "bar")
+	assert.NoError(t, err)
+	lines = strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[1], "2 "))
+	_, err = run(t, address, "model", "clone", "foo", "bar")
+	assert.Error(t, err)
+	_, err = run(t, address, "model", "delete", "bar")
+	assert.NoError(t, err)
+
+	output, err = run(t, address, "versions", "top", "foo", "reward")
+	assert.NoError(t, err)
+	lines = strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], "2 "))
+	assert.True(t, strings.HasSuffix(lines[2], "0.25"))
+
+	output, err = run(t, address, "version", "alias", "foo", "candidate", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Alias \"candidate\" of model \"foo\" points at version \"1\"\n", output)
+	_, err = run(t, address, "version", "alias", "foo", "latest", "1")
+	assert.Error(t, err)
+
+	output, err = run(t, address, "version", "stage", "foo", "2", "staging", "--comment", "candidate")
+	assert.NoError(t, err)
+	stageInfo := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(output), &stageInfo))
+	assert.Equal(t, "staging", stageInfo["stage"])
+	output, err = run(t, address, "version", "stage", "foo", "2")
+	assert.NoError(t, err)
+	assert.Contains(t, output, `"comment": "candidate"`)
+	_, err = run(t, address, "version", "stage", "foo", "2", "deployed")
+	assert.Error(t, err)
+
+	archiveFilename := filepath.Join(t.TempDir(), "registry.tar")
+	_, err = run(t, address, "registry", "export", "foo", "-o", archiveFilename)
+	assert.NoError(t, err)
+
+	output, err = run(t, address, "version", "leases", "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "VERSION  HOLDER  EXPIRES\n", output)
+	_, err = run(t, address, "version", "leases", "foo", "-1")
+	assert.Error(t, err)
+
+	// Locked versions are never deleted, even when forced
+	output, err = run(t, address, "version", "lock", "foo", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Version \"1\" of model \"foo\" locked\n", output)
+	_, err = run(t, address, "version", "delete", "foo", "1", "--force")
+	assert.Error(t, err)
+	output, err = run(t, address, "version", "unlock", "foo", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Version \"1\" of model \"foo\" unlocked\n", output)
+
+	// Archived versions are only deleted when forced
+	_, err = run(t, address, "version", "delete", "foo", "1")
+	assert.Error(t, err)
+	_, err = run(t, address, "version", "delete", "foo", "1", "--force")
+	assert.NoError(t, err)
+
+	_, err = run(t, address, "model", "delete", "foo")
+	assert.NoError(t, err)
+	_, err = run(t, address, "model", "inspect", "foo")
+	assert.Error(t, err)
+
+	output, err = run(t, address, "registry", "import", archiveFilename)
+	assert.NoError(t, err)
+	assert.Equal(t, "1 models and 2 versions imported\n", output)
+	output, err = run(t, address, "versions", "list", "foo")
+	assert.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(output), "\n"), 3)
+}
+
+func TestRegistryGC(t *testing.T) {
+	address, b := startServer(t)
+	_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{retention.MaxCountUserDataKey: "1"}})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{DataHash: backend.ComputeSHA256Hash(data), Data: data})
+		assert.NoError(t, err)
+	}
+
+	output, err := run(t, address, "registry", "gc", "--dry-run")
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[1], "foo "))
+	assert.Equal(t, fmt.Sprintf("2 versions would be deleted, reclaiming %d bytes", 2*len(data)), lines[3])
+
+	output, err = run(t, address, "registry", "gc")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "2 versions deleted")
+	output, err = run(t, address, "versions", "list", "foo")
+	assert.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(output), "\n"), 2)
+}
+
+func TestRegistryFsck(t *testing.T) {
+	address, b := startServer(t)
+	_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{DataHash: backend.ComputeSHA256Hash(data), Data: data})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, b.DeleteModelVersion("foo", 2))
+
+	output, err := run(t, address, "registry", "fsck", "--repair", "foo")
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], "gap "))
+	assert.Equal(t, "1 models and 2 versions checked, 1 problems found", lines[2])
+}
+
+func TestRegistryImportDir(t *testing.T) {
+	address, b := startServer(t)
+	root := t.TempDir()
+	files := map[string][]byte{
+		"foo/checkpoint-2/weights.pt":         data[:10],
+		"foo/checkpoint-10/weights.pt":        data[:20],
+		"foo/checkpoint-10/config/model.json": data[:5],
+		"foo/.cache/ignored":                  data,
+		"bar/final.pt":                        data,
+	}
+	for name, fileData := range files {
+		filename := filepath.Join(root, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+		assert.NoError(t, ioutil.WriteFile(filename, fileData, 0o644))
+	}
+
+	output, err := run(t, address, "registry", "import-dir", root, "--dry-run")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "2 models and 3 versions would be imported, 0 versions already imported")
+	hasModel, err := b.HasModel("foo")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+
+	output, err = run(t, address, "registry", "import-dir", root)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "2 models and 3 versions imported, 0 versions already imported")
+	versionInfos, err := b.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 2)
+	// Versions are created by the natural order of their directories
+	assert.Equal(t, "foo/checkpoint-2", versionInfos[0].UserData[client.ImportedFromUserDataKey])
+	assert.Equal(t, "foo/checkpoint-10", versionInfos[1].UserData[client.ImportedFromUserDataKey])
+	assert.Contains(t, versionInfos[1].UserData, grpcservers.VersionArtifactUserDataKeyPrefix+"config/model.json")
+	versionData, err := b.RetrieveModelVersionData("bar", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, data, versionData)
+
+	// Importing again only imports the new versions
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "bar", "final-2.pt"), data[:10], 0o644))
+	output, err = run(t, address, "registry", "import-dir", root)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "0 models and 1 versions imported, 3 versions already imported")
+	versionInfos, err = b.ListModelVersionInfos("bar", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 2)
+}
+
+func TestBench(t *testing.T) {
+	address, b := startServer(t)
+	output, err := run(t, address, "bench", "--size", "100", "--uploads", "4", "--downloads", "6", "--concurrency", "2", "--chunk-size", "32", "--keep")
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "P99")
+	assert.Regexp(t, `^upload +4 +0 `, lines[1])
+	assert.Regexp(t, `^download +6 +0 `, lines[2])
+	versionInfos, err := b.ListModelVersionInfos("bench", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 4)
+
+	_, err = run(t, address, "bench", "--model-id", "bench_deleted", "--uploads", "1", "--downloads", "0")
+	assert.NoError(t, err)
+	hasModel, err := b.HasModel("bench_deleted")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+}
+
+func TestUsage(t *testing.T) {
+	stdout := bytes.Buffer{}
+	assert.NoError(t, Run(context.Background(), []string{"help"}, &stdout))
+	assert.Contains(t, stdout.String(), "version push <model_id> <file>")
+
+	err := Run(context.Background(), []string{"models", "drop"}, &stdout)
+	assert.IsType(t, &UsageError{}, err)
+
+	err = Run(context.Background(), []string{"version", "push", "foo"}, &stdout)
+	assert.IsType(t, &UsageError{}, err)
+
+	err = Run(context.Background(), []string{"models", "list", "--unknown"}, &stdout)
+	assert.IsType(t, &UsageError{}, err)
+
+	err = Run(context.Background(), []string{"version", "oci-push", "foo", "1", "registry.example.com/Team/models"}, &stdout)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "isn't a valid repository")
+}
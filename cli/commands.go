@@ -0,0 +1,1161 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/bench"
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/oci"
+)
+
+var commands = []command{
+	{
+		name:        "models list",
+		description: "List the models",
+		define: func(flags *pflag.FlagSet) runner {
+			namespace := flags.String("namespace", "", "Only list the models of this namespace")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return listModels(ctx, c, *namespace, stdout)
+			}
+		},
+	},
+	{
+		name:        "model inspect",
+		arguments:   "<model_id>",
+		description: "Show the info of a model and of its latest version",
+		minArgs:     1,
+		maxArgs:     1,
+		define: func(flags *pflag.FlagSet) runner {
+			return inspectModel
+		},
+	},
+	{
+		name:        "model clone",
+		arguments:   "<source_model_id> <model_id>",
+		description: "Create a model as a copy of another one and of its versions",
+		minArgs:     2,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			versionNumbers := flags.UintSlice("version", []uint{}, "`Numbers` of the copied versions, every version by default")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return cloneModel(ctx, c, args, *versionNumbers, stdout)
+			}
+		},
+	},
+	{
+		name:        "model delete",
+		arguments:   "<model_id>",
+		description: "Delete a model and all its versions",
+		minArgs:     1,
+		maxArgs:     1,
+		define: func(flags *pflag.FlagSet) runner {
+			return deleteModel
+		},
+	},
+	{
+		name:        "versions list",
+		arguments:   "<model_id>",
+		description: "List the versions of a model",
+		minArgs:     1,
+		maxArgs:     1,
+		define: func(flags *pflag.FlagSet) runner {
+			return listVersions
+		},
+	},
+	{
+		name:        "versions top",
+		arguments:   "<model_id> <metric>",
+		description: "List the versions of a model having a metric, the highest values first",
+		minArgs:     2,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			count := flags.Int("count", 10, "Maximum number of listed versions, 0 lists all of them")
+			ascending := flags.Bool("ascending", false, "List the lowest values first")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return topVersions(ctx, c, args, *count, *ascending, stdout)
+			}
+		},
+	},
+	{
+		name:        "versions compatible",
+		arguments:   "<model_id> <framework>",
+		description: "List the versions of a model whose manifest defines a framework",
+		minArgs:     2,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			frameworkVersion := flags.String("framework-version", "", "Version of the framework the manifest needs to define")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return listCompatibleVersions(ctx, c, args, *frameworkVersion, stdout)
+			}
+		},
+	},
+	{
+		name:        "version inspect",
+		arguments:   "<model_id> [<version_number>]",
+		description: "Show the info of a version, the latest one by default",
+		minArgs:     1,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			return inspectVersion
+		},
+	},
+	{
+		name:        "version push",
+		arguments:   "<model_id> <file>",
+		description: "Create a version of a model from the content of a file, `-` reads the standard input",
+		minArgs:     2,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			versionArgs := defineVersionArgsFlags(flags)
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				parsedVersionArgs, err := versionArgs()
+				if err != nil {
+					return err
+				}
+				return pushVersion(ctx, c, args, parsedVersionArgs, stdout)
+			}
+		},
+	},
+	{
+		name:        "version push-artifacts",
+		arguments:   "<model_id> <name>=<file>...",
+		description: "Create a version of a model made of named artifacts, e.g. its weights and its tokenizer, from the content of files",
+		minArgs:     2,
+		maxArgs:     -1,
+		define: func(flags *pflag.FlagSet) runner {
+			versionArgs := defineVersionArgsFlags(flags)
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				parsedVersionArgs, err := versionArgs()
+				if err != nil {
+					return err
+				}
+				return pushArtifacts(ctx, c, args, parsedVersionArgs, stdout)
+			}
+		},
+	},
+	{
+		name:        "version pull",
+		arguments:   "<model_id> [<version_number>]",
+		description: "Download the data of a version, the latest one by default",
+		minArgs:     1,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			output := flags.StringP("output", "o", "-", "`File` the data is written to, - writes to the standard output")
+			verify := flags.Bool("verify", false, "Request the server to verify the data against the hash of the version")
+			artifact := flags.String("artifact", "", "`Name` of the artifact to download instead of the whole data")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return pullVersion(ctx, c, args, *output, *artifact, *verify, stdout)
+			}
+		},
+	},
+	{
+		name:        "version oci-push",
+		arguments:   "<model_id> <version_number> <reference>",
+		description: "Push a version as an OCI artifact to a container registry, e.g. `registry.example.com/team/models:my_model-2`",
+		minArgs:     3,
+		maxArgs:     3,
+		define: func(flags *pflag.FlagSet) runner {
+			ociConfiguration := defineOCIFlags(flags)
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return pushOCIVersion(ctx, c, args, *ociConfiguration, stdout)
+			}
+		},
+	},
+	{
+		name:        "version oci-pull",
+		arguments:   "<reference> [<model_id>]",
+		description: "Create a version from an OCI artifact pushed to a container registry, in the model it was pushed from by default",
+		minArgs:     1,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			ociConfiguration := defineOCIFlags(flags)
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return pullOCIVersion(ctx, c, args, *ociConfiguration, stdout)
+			}
+		},
+	},
+	{
+		name:        "version delete",
+		arguments:   "<model_id> <version_number>",
+		description: "Delete a version of a model",
+		minArgs:     2,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			force := flags.Bool("force", false, "Delete the version even if it is archived")
+			cascade := flags.Bool("cascade", false, "Delete the versions depending on the version first, requires the `delete` scope on every model")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return deleteVersion(ctx, c, args, *force, *cascade, stdout)
+			}
+		},
+	},
+	{
+		name:        "version lock",
+		arguments:   "<model_id> <version_number>",
+		description: "Lock a version, it can't be deleted or changed until unlocked",
+		minArgs:     2,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return lockVersion(ctx, c, args, true, stdout)
+			}
+		},
+	},
+	{
+		name:        "version unlock",
+		arguments:   "<model_id> <version_number>",
+		description: "Unlock a version, requires the `admin` scope",
+		minArgs:     2,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return lockVersion(ctx, c, args, false, stdout)
+			}
+		},
+	},
+	{
+		name:        "version leases",
+		arguments:   "<model_id> [<version_number>]",
+		description: "List the leases of the consumers on the versions of a model, or on one of its versions",
+		minArgs:     1,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			return listVersionLeases
+		},
+	},
+	{
+		name:        "version update",
+		arguments:   "<model_id> <version_number>",
+		description: "Change the description, metrics, user data and archival status of a version",
+		minArgs:     2,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			description := flags.String("description", "", "New description of the version, an empty one removes it")
+			userData := flags.StringToString("user-data", map[string]string{}, "User data entries added or replaced, as `key=value` pairs")
+			removedUserDataKeys := flags.StringSlice("remove-user-data", []string{}, "`Keys` of the user data entries removed")
+			metrics := flags.StringToString("metric", map[string]string{}, "Metrics added or replaced, as `name=number` pairs")
+			removedMetricNames := flags.StringSlice("remove-metric", []string{}, "`Names` of the metrics removed")
+			archived := flags.Bool("archived", false, "Archive the version, `--archived=false` unarchives it")
+			etag := flags.String("etag", "", "Fail if the version changed since this etag was returned")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				parsedMetrics, err := parseMetrics(*metrics)
+				if err != nil {
+					return err
+				}
+				update := client.VersionInfoUpdate{
+					Description:         *description,
+					ClearDescription:    flags.Changed("description") && *description == "",
+					UserData:            *userData,
+					RemovedUserDataKeys: *removedUserDataKeys,
+					Metrics:             parsedMetrics,
+					RemovedMetricNames:  *removedMetricNames,
+					ExpectedETag:        *etag,
+				}
+				if flags.Changed("archived") {
+					update.Archived = archived
+				}
+				return updateVersion(ctx, c, args, update, stdout)
+			}
+		},
+	},
+	{
+		name:        "version lineage",
+		arguments:   "<model_id> [<version_number>]",
+		description: "List a version, the latest one by default, and its ancestors",
+		minArgs:     1,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			maxDepth := flags.Int("max-depth", 0, "Maximum number of listed versions, 0 lists the whole ancestry")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return versionLineage(ctx, c, args, *maxDepth, stdout)
+			}
+		},
+	},
+	{
+		name:        "version dependencies",
+		arguments:   "<model_id> [<version_number>]",
+		description: "Show a version, the latest one by default, and the versions it depends on",
+		minArgs:     1,
+		maxArgs:     2,
+		define: func(flags *pflag.FlagSet) runner {
+			dependents := flags.Bool("dependents", false, "Also show the versions depending on the version, requires the `read` scope on every model")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return versionDependencies(ctx, c, args, *dependents, stdout)
+			}
+		},
+	},
+	{
+		name:        "version alias",
+		arguments:   "<model_id> <alias> <version_number>",
+		description: "Point an alias of a model at a version, 0 removes the alias",
+		minArgs:     3,
+		maxArgs:     3,
+		define: func(flags *pflag.FlagSet) runner {
+			return setVersionAlias
+		},
+	},
+	{
+		name:        "version stage",
+		arguments:   "<model_id> <version_number> [<stage>]",
+		description: "Show the stage of a version and its history, or transition it to `staging`, `production` or `retired`",
+		minArgs:     2,
+		maxArgs:     3,
+		define: func(flags *pflag.FlagSet) runner {
+			comment := flags.String("comment", "", "Comment recorded in the history of the version")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return versionStage(ctx, c, args, *comment, stdout)
+			}
+		},
+	},
+	{
+		name:        "registry export",
+		arguments:   "[<model_id>...]",
+		description: "Export models and their versions as a tar archive, every model by default",
+		minArgs:     0,
+		maxArgs:     -1,
+		define: func(flags *pflag.FlagSet) runner {
+			output := flags.StringP("output", "o", "-", "`File` the archive is written to, - writes to the standard output")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return exportRegistry(ctx, c, args, *output, stdout)
+			}
+		},
+	},
+	{
+		name:        "registry import",
+		arguments:   "<file>",
+		description: "Import the models and versions of a tar archive, `-` reads the standard input",
+		minArgs:     1,
+		maxArgs:     1,
+		define: func(flags *pflag.FlagSet) runner {
+			return importRegistry
+		},
+	},
+	{
+		name:        "registry import-dir",
+		arguments:   "<directory>",
+		description: "Import a directory of checkpoints, each `<model_id>/<version>` entry becoming a version",
+		minArgs:     1,
+		maxArgs:     1,
+		define: func(flags *pflag.FlagSet) runner {
+			options := client.DirectoryImportOptions{}
+			flags.BoolVar(&options.DryRun, "dry-run", false, "Only list the versions that would be imported")
+			flags.BoolVar(&options.Archived, "archived", false, "Archive the imported versions")
+			flags.BoolVar(&options.UseModificationTimes, "use-modification-times", false, "Use the latest modification time of the files of a version as its creation timestamp")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return importDirectory(ctx, c, args[0], options, stdout)
+			}
+		},
+	},
+	{
+		name:        "registry snapshot-save",
+		arguments:   "[<name>]",
+		description: "Save every model and version to a snapshot file in the snapshot directory of the registry",
+		minArgs:     0,
+		maxArgs:     1,
+		define: func(flags *pflag.FlagSet) runner {
+			return saveSnapshot
+		},
+	},
+	{
+		name:        "registry snapshot-load",
+		arguments:   "<name>",
+		description: "Load the models and versions of a snapshot file of the snapshot directory of the registry",
+		minArgs:     1,
+		maxArgs:     1,
+		define: func(flags *pflag.FlagSet) runner {
+			overwrite := flags.Bool("overwrite", false, "Delete every model before loading the snapshot")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return loadSnapshot(ctx, c, args[0], *overwrite, stdout)
+			}
+		},
+	},
+	{
+		name:        "registry maintenance",
+		arguments:   "<on|off>",
+		description: "Enter or leave the maintenance mode, queuing the changes made to the models and versions until it ends",
+		minArgs:     1,
+		maxArgs:     1,
+		define: func(flags *pflag.FlagSet) runner {
+			reason := flags.String("reason", "", "Reason of the maintenance, reported to the clients whose changes are rejected")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return setMaintenance(ctx, c, args[0], *reason, stdout)
+			}
+		},
+	},
+	{
+		name:        "registry gc",
+		arguments:   "",
+		description: "Delete the non-archived versions beyond the retention policy of their model",
+		minArgs:     0,
+		maxArgs:     0,
+		define: func(flags *pflag.FlagSet) runner {
+			dryRun := flags.Bool("dry-run", false, "Only list the versions that would be deleted")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return runGarbageCollection(ctx, c, *dryRun, stdout)
+			}
+		},
+	},
+	{
+		name:        "registry fsck",
+		arguments:   "[<model_id>...]",
+		description: "Check the numbering of the versions of the given models, or of every model, for duplicates, mismatches and gaps",
+		minArgs:     0,
+		maxArgs:     -1,
+		define: func(flags *pflag.FlagSet) runner {
+			repair := flags.Bool("repair", false, "Rewrite the versions whose number is duplicated, mismatched or stale")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return runFsck(ctx, c, args, *repair, stdout)
+			}
+		},
+	},
+	{
+		name:        "bench",
+		arguments:   "",
+		description: "Create then retrieve versions of a model to measure the throughput and latency of the registry",
+		minArgs:     0,
+		maxArgs:     0,
+		define: func(flags *pflag.FlagSet) runner {
+			configuration := bench.Configuration{}
+			flags.StringVar(&configuration.ModelID, "model-id", "bench", "Model the versions are created in, deleted once done")
+			flags.IntVar(&configuration.DataSize, "size", 1024*1024, "Size in bytes of the data of each created version")
+			flags.IntVar(&configuration.Concurrency, "concurrency", 4, "Number of operations running at once")
+			flags.IntVar(&configuration.Uploads, "uploads", 100, "Number of created versions")
+			flags.IntVar(&configuration.Downloads, "downloads", 100, "Number of retrieved versions, cycling through the created ones")
+			flags.BoolVar(&configuration.Keep, "keep", false, "Keep the model and its versions once done")
+			return func(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+				return runBench(ctx, c, configuration, stdout)
+			}
+		},
+	},
+}
+
+func parseVersionNumber(args []string, index int) (int, error) {
+	if len(args) <= index {
+		return -1, nil
+	}
+	versionNumber, err := strconv.ParseInt(args[index], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version number %q", args[index])
+	}
+	return int(versionNumber), nil
+}
+
+func parseMetrics(values map[string]string) (map[string]float64, error) {
+	metrics := make(map[string]float64, len(values))
+	for name, value := range values {
+		metric, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for metric %q, a number is expected", value, name)
+		}
+		metrics[name] = metric
+	}
+	return metrics, nil
+}
+
+func formatUserData(userData map[string]string) string {
+	entries := make([]string, 0, len(userData))
+	for key, value := range userData {
+		entries = append(entries, key+"="+value)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+func writeJSON(stdout io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func listModels(ctx context.Context, c *client.Client, namespace string, stdout io.Writer) error {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL ID\tUSER DATA")
+	models := c.Models(ctx)
+	if namespace != "" {
+		models = c.NamespaceModels(ctx, namespace)
+	}
+	for models.Next() {
+		fmt.Fprintf(w, "%s\t%s\n", models.ModelInfo().ModelID, formatUserData(models.ModelInfo().UserData))
+	}
+	if err := models.Err(); err != nil {
+		return fmt.Errorf("unable to retrieve the models: %w", err)
+	}
+	return w.Flush()
+}
+
+// modelInspection is the output of `model inspect`
+type modelInspection struct {
+	ModelInfo         client.ModelInfo    `json:"modelInfo"`
+	LatestVersionInfo *client.VersionInfo `json:"latestVersionInfo,omitempty"`
+}
+
+func inspectModel(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+	modelInfo, err := c.RetrieveModelInfo(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("unable to retrieve model %q: %w", args[0], err)
+	}
+	inspection := modelInspection{ModelInfo: modelInfo}
+	latestVersionInfo, err := c.RetrieveVersionInfo(ctx, args[0], -1)
+	if err == nil {
+		inspection.LatestVersionInfo = &latestVersionInfo
+	} else if status.Code(err) != codes.NotFound {
+		return fmt.Errorf("unable to retrieve the latest version of model %q: %w", args[0], err)
+	}
+	return writeJSON(stdout, inspection)
+}
+
+func cloneModel(ctx context.Context, c *client.Client, args []string, versionNumbers []uint, stdout io.Writer) error {
+	_, versionInfos, err := c.CloneModel(ctx, args[0], args[1], versionNumbers)
+	if err != nil {
+		return fmt.Errorf("unable to clone model %q as %q: %w", args[0], args[1], err)
+	}
+	fmt.Fprintf(stdout, "Model %q cloned as %q with %d version(s)\n", args[0], args[1], len(versionInfos))
+	return nil
+}
+
+func deleteModel(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+	if err := c.DeleteModel(ctx, args[0]); err != nil {
+		return fmt.Errorf("unable to delete model %q: %w", args[0], err)
+	}
+	fmt.Fprintf(stdout, "Model %q deleted\n", args[0])
+	return nil
+}
+
+func listVersions(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tCREATED\tARCHIVED\tSIZE\tHASH\tUSER DATA")
+	versions := c.Versions(ctx, args[0])
+	for versions.Next() {
+		versionInfo := versions.VersionInfo()
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%t\t%d\t%s\t%s\n",
+			versionInfo.VersionNumber,
+			versionInfo.CreationTimestamp.UTC().Format(time.RFC3339),
+			versionInfo.Archived,
+			versionInfo.DataSize,
+			versionInfo.DataHash,
+			formatUserData(versionInfo.UserData),
+		)
+	}
+	if err := versions.Err(); err != nil {
+		return fmt.Errorf("unable to retrieve the versions of model %q: %w", args[0], err)
+	}
+	return w.Flush()
+}
+
+func listCompatibleVersions(ctx context.Context, c *client.Client, args []string, frameworkVersion string, stdout io.Writer) error {
+	versionInfos, err := c.RetrieveVersionInfosByFramework(ctx, args[0], args[1], frameworkVersion)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve the versions of model %q by framework %q: %w", args[0], args[1], err)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tCREATED\tARCHIVED\tFRAMEWORK\tFRAMEWORK VERSION")
+	for _, versionInfo := range versionInfos {
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%t\t%s\t%s\n",
+			versionInfo.VersionNumber,
+			versionInfo.CreationTimestamp.UTC().Format(time.RFC3339),
+			versionInfo.Archived,
+			versionInfo.Manifest.Framework,
+			versionInfo.Manifest.FrameworkVersion,
+		)
+	}
+	return w.Flush()
+}
+
+func topVersions(ctx context.Context, c *client.Client, args []string, count int, ascending bool, stdout io.Writer) error {
+	versionInfos, err := c.RetrieveVersionInfosByMetric(ctx, args[0], args[1], !ascending, count)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve the versions of model %q by metric %q: %w", args[0], args[1], err)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tCREATED\tARCHIVED\tMETRIC")
+	for _, versionInfo := range versionInfos {
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%t\t%s\n",
+			versionInfo.VersionNumber,
+			versionInfo.CreationTimestamp.UTC().Format(time.RFC3339),
+			versionInfo.Archived,
+			strconv.FormatFloat(versionInfo.Metrics[args[1]], 'g', -1, 64),
+		)
+	}
+	return w.Flush()
+}
+
+func inspectVersion(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+	versionNumber, err := parseVersionNumber(args, 1)
+	if err != nil {
+		return err
+	}
+	versionInfo, err := c.RetrieveVersionInfo(ctx, args[0], versionNumber)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve version \"%d\" of model %q: %w", versionNumber, args[0], err)
+	}
+	return writeJSON(stdout, versionInfo)
+}
+
+// readPushedData opens the pushed data, reading the standard input to a temporary file as it needs to be read twice
+func readPushedData(filename string) (*os.File, error) {
+	if filename != "-" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open %q: %w", filename, err)
+		}
+		return file, nil
+	}
+	file, err := os.CreateTemp("", "cogment-model-registry-push-*")
+	if err != nil {
+		return nil, fmt.Errorf("unable to buffer the standard input: %w", err)
+	}
+	_ = os.Remove(file.Name())
+	if _, err := io.Copy(file, os.Stdin); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("unable to buffer the standard input: %w", err)
+	}
+	return file, nil
+}
+
+// defineVersionArgsFlags defines the flags describing a created version, the returned function builds the version args once they are parsed
+func defineVersionArgsFlags(flags *pflag.FlagSet) func() (client.VersionArgs, error) {
+	archived := flags.Bool("archived", false, "Archive the created version")
+	description := flags.String("description", "", "Description of the created version")
+	metrics := flags.StringToString("metric", map[string]string{}, "Metrics of the created version, as `name=number` pairs")
+	parentModelID := flags.String("parent-model", "", "Model of the parent version, the model of the created version by default")
+	parentVersionNumber := flags.Uint("parent-version", 0, "Version the created version was trained from")
+	runID := flags.String("run-id", "", "Run the created version comes from")
+	trialID := flags.String("trial-id", "", "Trial the created version comes from")
+	dependencies := flags.StringToString("dependency", map[string]string{}, "Versions the created version depends on, as `model_id=version_number` pairs")
+	manifestFilename := flags.String("manifest", "", "JSON `file` describing the framework, tensors and Python dependencies of the created version")
+	userData := flags.StringToString("user-data", map[string]string{}, "User data of the created version, as `key=value` pairs")
+	return func() (client.VersionArgs, error) {
+		parsedMetrics, err := parseMetrics(*metrics)
+		if err != nil {
+			return client.VersionArgs{}, err
+		}
+		versionArgs := client.VersionArgs{Archived: *archived, Description: *description, Metrics: parsedMetrics, UserData: *userData}
+		lineage := client.VersionLineage{ParentModelID: *parentModelID, ParentVersionNumber: *parentVersionNumber, RunID: *runID, TrialID: *trialID}
+		if lineage != (client.VersionLineage{}) {
+			versionArgs.Lineage = &lineage
+		}
+		if versionArgs.Dependencies, err = parseDependencies(*dependencies); err != nil {
+			return client.VersionArgs{}, err
+		}
+		if *manifestFilename != "" {
+			if versionArgs.Manifest, err = readManifest(*manifestFilename); err != nil {
+				return client.VersionArgs{}, err
+			}
+		}
+		return versionArgs, nil
+	}
+}
+
+func parseDependencies(dependencies map[string]string) ([]client.VersionReference, error) {
+	if len(dependencies) == 0 {
+		return nil, nil
+	}
+	references := make([]client.VersionReference, 0, len(dependencies))
+	for modelID, value := range dependencies {
+		versionNumber, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || versionNumber == 0 {
+			return nil, fmt.Errorf("invalid version number %q for the dependency on model %q", value, modelID)
+		}
+		references = append(references, client.VersionReference{ModelID: modelID, VersionNumber: uint(versionNumber)})
+	}
+	return references, nil
+}
+
+func readManifest(filename string) (*client.VersionManifest, error) {
+	serializedManifest, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the manifest %q: %w", filename, err)
+	}
+	manifest := &client.VersionManifest{}
+	if err := json.Unmarshal(serializedManifest, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %q: %w", filename, err)
+	}
+	return manifest, nil
+}
+
+func pushVersion(ctx context.Context, c *client.Client, args []string, versionArgs client.VersionArgs, stdout io.Writer) error {
+	file, err := readPushedData(args[1])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	versionInfo, err := c.CreateVersion(ctx, args[0], versionArgs, file)
+	if err != nil {
+		return fmt.Errorf("unable to create a version of model %q: %w", args[0], err)
+	}
+	return writeJSON(stdout, versionInfo)
+}
+
+func pushArtifacts(ctx context.Context, c *client.Client, args []string, versionArgs client.VersionArgs, stdout io.Writer) error {
+	artifacts := make([]client.ArtifactArgs, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		separatorIndex := strings.Index(arg, "=")
+		if separatorIndex <= 0 {
+			return fmt.Errorf("invalid artifact %q, expecting `<name>=<file>`", arg)
+		}
+		file, err := readPushedData(arg[separatorIndex+1:])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		artifacts = append(artifacts, client.ArtifactArgs{Name: arg[:separatorIndex], Data: file})
+	}
+
+	versionInfo, err := c.CreateVersionWithArtifacts(ctx, args[0], versionArgs, artifacts)
+	if err != nil {
+		return fmt.Errorf("unable to create a version of model %q: %w", args[0], err)
+	}
+	return writeJSON(stdout, versionInfo)
+}
+
+func pullVersion(ctx context.Context, c *client.Client, args []string, output string, artifact string, verify bool, stdout io.Writer) error {
+	versionNumber, err := parseVersionNumber(args, 1)
+	if err != nil {
+		return err
+	}
+	retrieveData := func(w io.Writer) error {
+		if artifact != "" {
+			if _, err := c.RetrieveArtifactData(ctx, args[0], versionNumber, artifact, w, verify); err != nil {
+				return fmt.Errorf("unable to retrieve artifact %q of version \"%d\" of model %q: %w", artifact, versionNumber, args[0], err)
+			}
+			return nil
+		}
+		if _, err := c.RetrieveVersionData(ctx, args[0], versionNumber, w, verify); err != nil {
+			return fmt.Errorf("unable to retrieve version \"%d\" of model %q: %w", versionNumber, args[0], err)
+		}
+		return nil
+	}
+	if output == "-" {
+		return retrieveData(stdout)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("unable to create %q: %w", output, err)
+	}
+	defer file.Close()
+	if err := retrieveData(file); err != nil {
+		_ = os.Remove(output)
+		return err
+	}
+	return nil
+}
+
+func defineOCIFlags(flags *pflag.FlagSet) *oci.Configuration {
+	configuration := &oci.Configuration{}
+	flags.StringVar(&configuration.Username, "oci-username", os.Getenv("COGMENT_MODEL_REGISTRY_OCI_USERNAME"), "Username of the container registry, defaults to $COGMENT_MODEL_REGISTRY_OCI_USERNAME")
+	flags.StringVar(&configuration.Password, "oci-password", os.Getenv("COGMENT_MODEL_REGISTRY_OCI_PASSWORD"), "Password or token of the container registry, defaults to $COGMENT_MODEL_REGISTRY_OCI_PASSWORD")
+	flags.BoolVar(&configuration.PlainHTTP, "plain-http", false, "Connect to the container registry over HTTP instead of HTTPS")
+	flags.DurationVar(&configuration.Timeout, "oci-timeout", 30*time.Second, "Timeout of the container registry requests not transferring data")
+	return configuration
+}
+
+func pushOCIVersion(ctx context.Context, c *client.Client, args []string, configuration oci.Configuration, stdout io.Writer) error {
+	versionNumber, err := parseVersionNumber(args, 1)
+	if err != nil {
+		return err
+	}
+	ref, err := oci.ParseReference(args[2])
+	if err != nil {
+		return err
+	}
+	digest, err := oci.CreateClient(configuration).PushVersion(ctx, c, args[0], versionNumber, ref)
+	if err != nil {
+		return fmt.Errorf("unable to push version \"%d\" of model %q to %q: %w", versionNumber, args[0], ref, err)
+	}
+	fmt.Fprintf(stdout, "Pushed to %s@%s\n", ref, digest)
+	return nil
+}
+
+func pullOCIVersion(ctx context.Context, c *client.Client, args []string, configuration oci.Configuration, stdout io.Writer) error {
+	ref, err := oci.ParseReference(args[0])
+	if err != nil {
+		return err
+	}
+	modelID := ""
+	if len(args) > 1 {
+		modelID = args[1]
+	}
+	versionInfo, err := oci.CreateClient(configuration).PullVersion(ctx, ref, c, modelID)
+	if err != nil {
+		return fmt.Errorf("unable to pull %q: %w", ref, err)
+	}
+	return writeJSON(stdout, versionInfo)
+}
+
+func deleteVersion(ctx context.Context, c *client.Client, args []string, force bool, cascade bool, stdout io.Writer) error {
+	versionNumber, err := parseVersionNumber(args, 1)
+	if err != nil {
+		return err
+	}
+	if !cascade {
+		versionInfo, err := c.DeleteVersion(ctx, args[0], versionNumber, force)
+		if err != nil {
+			return fmt.Errorf("unable to delete version \"%d\" of model %q: %w", versionNumber, args[0], err)
+		}
+		fmt.Fprintf(stdout, "Version \"%d\" of model %q deleted\n", versionInfo.VersionNumber, args[0])
+		return nil
+	}
+	versionInfo, deletedDependents, err := c.DeleteVersionWithDependents(ctx, args[0], versionNumber, force)
+	if err != nil {
+		return fmt.Errorf("unable to delete version \"%d\" of model %q: %w", versionNumber, args[0], err)
+	}
+	for _, dependent := range deletedDependents {
+		fmt.Fprintf(stdout, "Version \"%d\" of model %q deleted\n", dependent.VersionNumber, dependent.ModelID)
+	}
+	fmt.Fprintf(stdout, "Version \"%d\" of model %q deleted\n", versionInfo.VersionNumber, args[0])
+	return nil
+}
+
+func lockVersion(ctx context.Context, c *client.Client, args []string, locked bool, stdout io.Writer) error {
+	versionNumber, err := parseVersionNumber(args, 1)
+	if err != nil {
+		return err
+	}
+	if locked {
+		versionInfo, err := c.LockVersion(ctx, args[0], versionNumber)
+		if err != nil {
+			return fmt.Errorf("unable to lock version \"%d\" of model %q: %w", versionNumber, args[0], err)
+		}
+		fmt.Fprintf(stdout, "Version \"%d\" of model %q locked\n", versionInfo.VersionNumber, args[0])
+		return nil
+	}
+	versionInfo, err := c.UnlockVersion(ctx, args[0], versionNumber)
+	if err != nil {
+		return fmt.Errorf("unable to unlock version \"%d\" of model %q: %w", versionNumber, args[0], err)
+	}
+	fmt.Fprintf(stdout, "Version \"%d\" of model %q unlocked\n", versionInfo.VersionNumber, args[0])
+	return nil
+}
+
+func listVersionLeases(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+	versionNumber := 0
+	if len(args) > 1 {
+		var err error
+		versionNumber, err = parseVersionNumber(args, 1)
+		if err != nil {
+			return err
+		}
+		if versionNumber <= 0 {
+			return fmt.Errorf("invalid version number %q", args[1])
+		}
+	}
+	leases, err := c.VersionLeases(ctx, args[0], uint(versionNumber))
+	if err != nil {
+		return fmt.Errorf("unable to list the leases of model %q: %w", args[0], err)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tHOLDER\tEXPIRES")
+	for _, lease := range leases {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", lease.VersionNumber, lease.Holder, lease.ExpirationTime.UTC().Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+type versionUpdate struct {
+	VersionInfo client.VersionInfo `json:"versionInfo"`
+	ETag        string             `json:"etag"`
+}
+
+func updateVersion(ctx context.Context, c *client.Client, args []string, update client.VersionInfoUpdate, stdout io.Writer) error {
+	versionNumber, err := parseVersionNumber(args, 1)
+	if err != nil {
+		return err
+	}
+	versionInfo, etag, err := c.UpdateVersionInfo(ctx, args[0], versionNumber, update)
+	if err != nil {
+		return fmt.Errorf("unable to update version \"%d\" of model %q: %w", versionNumber, args[0], err)
+	}
+	return writeJSON(stdout, versionUpdate{VersionInfo: versionInfo, ETag: etag})
+}
+
+func versionLineage(ctx context.Context, c *client.Client, args []string, maxDepth int, stdout io.Writer) error {
+	versionNumber, err := parseVersionNumber(args, 1)
+	if err != nil {
+		return err
+	}
+	versionInfos, err := c.RetrieveLineage(ctx, args[0], versionNumber, maxDepth)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve the lineage of version \"%d\" of model %q: %w", versionNumber, args[0], err)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL ID\tVERSION\tCREATED\tRUN ID\tTRIAL ID")
+	for _, versionInfo := range versionInfos {
+		lineage := client.VersionLineage{}
+		if versionInfo.Lineage != nil {
+			lineage = *versionInfo.Lineage
+		}
+		fmt.Fprintf(
+			w,
+			"%s\t%d\t%s\t%s\t%s\n",
+			versionInfo.ModelID,
+			versionInfo.VersionNumber,
+			versionInfo.CreationTimestamp.UTC().Format(time.RFC3339),
+			lineage.RunID,
+			lineage.TrialID,
+		)
+	}
+	return w.Flush()
+}
+
+func versionDependencies(ctx context.Context, c *client.Client, args []string, includeDependents bool, stdout io.Writer) error {
+	versionNumber, err := parseVersionNumber(args, 1)
+	if err != nil {
+		return err
+	}
+	graph, err := c.RetrieveDependencyGraph(ctx, args[0], versionNumber, includeDependents)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve the dependencies of version \"%d\" of model %q: %w", versionNumber, args[0], err)
+	}
+	return writeJSON(stdout, graph)
+}
+
+func setVersionAlias(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+	versionNumber, err := parseVersionNumber(args, 2)
+	if err != nil {
+		return err
+	}
+	versionInfo, err := c.SetVersionAlias(ctx, args[0], args[1], versionNumber)
+	if err != nil {
+		return fmt.Errorf("unable to set alias %q of model %q: %w", args[1], args[0], err)
+	}
+	if versionNumber == 0 {
+		fmt.Fprintf(stdout, "Alias %q of model %q removed\n", args[1], args[0])
+		return nil
+	}
+	fmt.Fprintf(stdout, "Alias %q of model %q points at version \"%d\"\n", args[1], args[0], versionInfo.VersionNumber)
+	return nil
+}
+
+func versionStage(ctx context.Context, c *client.Client, args []string, comment string, stdout io.Writer) error {
+	versionNumber, err := parseVersionNumber(args, 1)
+	if err != nil {
+		return err
+	}
+	if len(args) < 3 {
+		stageInfo, err := c.RetrieveVersionStage(ctx, args[0], versionNumber)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve the stage of version \"%d\" of model %q: %w", versionNumber, args[0], err)
+		}
+		return writeJSON(stdout, stageInfo)
+	}
+	stageInfo, err := c.TransitionVersionStage(ctx, args[0], versionNumber, client.VersionStage(args[2]), comment)
+	if err != nil {
+		return fmt.Errorf("unable to transition version \"%d\" of model %q to stage %q: %w", versionNumber, args[0], args[2], err)
+	}
+	return writeJSON(stdout, stageInfo)
+}
+
+func exportRegistry(ctx context.Context, c *client.Client, args []string, output string, stdout io.Writer) error {
+	if output == "-" {
+		if err := c.ExportRegistry(ctx, stdout, args); err != nil {
+			return fmt.Errorf("unable to export the registry: %w", err)
+		}
+		return nil
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("unable to create %q: %w", output, err)
+	}
+	defer file.Close()
+	if err := c.ExportRegistry(ctx, file, args); err != nil {
+		_ = os.Remove(output)
+		return fmt.Errorf("unable to export the registry: %w", err)
+	}
+	return nil
+}
+
+func importRegistry(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+	var archive io.Reader = os.Stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("unable to open %q: %w", args[0], err)
+		}
+		defer file.Close()
+		archive = file
+	}
+	summary, err := c.ImportRegistry(ctx, archive)
+	if err != nil {
+		return fmt.Errorf("unable to import the registry: %w", err)
+	}
+	fmt.Fprintf(stdout, "%d models and %d versions imported\n", summary.ModelsCount, summary.VersionsCount)
+	return nil
+}
+
+func saveSnapshot(ctx context.Context, c *client.Client, args []string, stdout io.Writer) error {
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+	summary, err := c.SaveSnapshot(ctx, name)
+	if err != nil {
+		return fmt.Errorf("unable to save the snapshot: %w", err)
+	}
+	fmt.Fprintf(stdout, "%d models and %d versions saved to snapshot %q\n", summary.ModelsCount, summary.VersionsCount, summary.Name)
+	return nil
+}
+
+func loadSnapshot(ctx context.Context, c *client.Client, name string, overwrite bool, stdout io.Writer) error {
+	summary, err := c.LoadSnapshot(ctx, name, overwrite)
+	if err != nil {
+		return fmt.Errorf("unable to load snapshot %q: %w", name, err)
+	}
+	if overwrite {
+		fmt.Fprintf(stdout, "%d models deleted, ", summary.DeletedModelsCount)
+	}
+	fmt.Fprintf(stdout, "%d models and %d versions loaded\n", summary.ModelsCount, summary.VersionsCount)
+	return nil
+}
+
+func setMaintenance(ctx context.Context, c *client.Client, mode string, reason string, stdout io.Writer) error {
+	if mode != "on" && mode != "off" {
+		return fmt.Errorf("invalid maintenance mode %q, expecting \"on\" or \"off\"", mode)
+	}
+	state, err := c.SetMaintenance(ctx, mode == "on", reason)
+	if err != nil {
+		return fmt.Errorf("unable to set the maintenance mode: %w", err)
+	}
+	if !state.Enabled {
+		fmt.Fprintln(stdout, "Maintenance ended")
+		return nil
+	}
+	fmt.Fprintf(stdout, "Maintenance since %s", state.Since.UTC().Format(time.RFC3339))
+	if state.Reason != "" {
+		fmt.Fprintf(stdout, " (%s)", state.Reason)
+	}
+	fmt.Fprintf(stdout, ", %d requests queued\n", state.QueuedRequests)
+	return nil
+}
+
+func importDirectory(ctx context.Context, c *client.Client, directory string, options client.DirectoryImportOptions, stdout io.Writer) error {
+	summary, err := c.ImportDirectory(ctx, directory, options)
+	if err != nil {
+		return fmt.Errorf("unable to import %q: %w", directory, err)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DIRECTORY\tMODEL ID\tVERSION\tFILES\tSIZE")
+	skippedCount := 0
+	for _, importedVersion := range summary.Versions {
+		versionNumber := "-"
+		if importedVersion.Skipped {
+			skippedCount++
+			versionNumber = fmt.Sprintf("%d (already imported)", importedVersion.VersionNumber)
+		} else if !options.DryRun {
+			versionNumber = strconv.FormatUint(uint64(importedVersion.VersionNumber), 10)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n", importedVersion.Directory, importedVersion.ModelID, versionNumber, importedVersion.FilesCount, importedVersion.DataSize)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if options.DryRun {
+		fmt.Fprintf(stdout, "%d models and %d versions would be imported, %d versions already imported\n", len(summary.CreatedModels), len(summary.Versions)-skippedCount, skippedCount)
+	} else {
+		fmt.Fprintf(stdout, "%d models and %d versions imported, %d versions already imported\n", len(summary.CreatedModels), len(summary.Versions)-skippedCount, skippedCount)
+	}
+	return nil
+}
+
+func runGarbageCollection(ctx context.Context, c *client.Client, dryRun bool, stdout io.Writer) error {
+	report, err := c.RunGarbageCollection(ctx, dryRun)
+	if err != nil {
+		return fmt.Errorf("unable to run a garbage collection: %w", err)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL ID\tVERSION\tSIZE")
+	for _, collectedVersion := range report.CollectedVersions {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", collectedVersion.ModelID, collectedVersion.VersionNumber, collectedVersion.DataSize)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if report.DryRun {
+		fmt.Fprintf(stdout, "%d versions would be deleted, reclaiming %d bytes\n", len(report.CollectedVersions), report.ReclaimedBytes)
+	} else {
+		fmt.Fprintf(stdout, "%d versions deleted, reclaiming %d bytes\n", len(report.CollectedVersions), report.ReclaimedBytes)
+	}
+	return nil
+}
+
+func runFsck(ctx context.Context, c *client.Client, modelIDs []string, repair bool, stdout io.Writer) error {
+	report, err := c.RunFsck(ctx, repair, modelIDs...)
+	if err != nil {
+		return fmt.Errorf("unable to check the versions numbering: %w", err)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND	MODEL ID	VERSION	REPAIRED	DESCRIPTION")
+	for _, problem := range report.Problems {
+		fmt.Fprintf(w, "%s	%s	%d	%t	%s\n", problem.Kind, problem.ModelID, problem.VersionNumber, problem.Repaired, problem.Description)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%d models and %d versions checked, %d problems found\n", report.CheckedModels, report.CheckedVersions, len(report.Problems))
+	return nil
+}
+
+func runBench(ctx context.Context, c *client.Client, configuration bench.Configuration, stdout io.Writer) error {
+	report, err := bench.Run(ctx, c, configuration)
+	if err != nil {
+		return fmt.Errorf("unable to run the benchmark: %w", err)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "OPERATION\tCOUNT\tERRORS\tMB/S\tOPS/S\tP50\tP90\tP99\tMAX")
+	for _, operation := range []struct {
+		name  string
+		stats bench.Stats
+	}{{"upload", report.Uploads}, {"download", report.Downloads}} {
+		stats := operation.stats
+		if stats.Operations == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2f\t%.2f\t%s\t%s\t%s\t%s\n", operation.name, stats.Operations, stats.Errors, stats.BytesPerSecond()/1e6, stats.OperationsPerSecond(),
+			formatLatency(stats.Latencies.P50), formatLatency(stats.Latencies.P90), formatLatency(stats.Latencies.P99), formatLatency(stats.Latencies.Max))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if report.FirstErr != nil {
+		return fmt.Errorf("%d operations failed, the first one with: %w", report.Uploads.Errors+report.Downloads.Errors, report.FirstErr)
+	}
+	return nil
+}
+
+func formatLatency(latency time.Duration) string {
+	return latency.Round(time.Microsecond).String()
+}
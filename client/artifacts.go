@@ -0,0 +1,179 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+
+	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// Prefix of the user data keys locating the artifacts of a version in its data
+const artifactUserDataKeyPrefix = "cogment_model_registry.artifact."
+
+// Artifact is a named part of the data of a version, e.g. its weights or its tokenizer
+type Artifact struct {
+	Name     string `json:"name"`
+	Offset   uint64 `json:"offset"` // Offset of the artifact in the data of the version
+	DataSize uint64 `json:"dataSize"`
+	DataHash string `json:"dataHash"`
+}
+
+// ArtifactArgs represents an artifact of a version to create
+type ArtifactArgs struct {
+	Name string
+	Data io.ReadSeeker
+}
+
+// parseArtifacts retrieves the artifacts of a version from its user data, ordered by offset, nil if it has none
+func parseArtifacts(userData map[string]string) []Artifact {
+	artifacts := []Artifact{}
+	for key, value := range userData {
+		if !strings.HasPrefix(key, artifactUserDataKeyPrefix) {
+			continue
+		}
+		fields := strings.SplitN(value, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		offset, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		dataSize, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		artifacts = append(artifacts, Artifact{Name: strings.TrimPrefix(key, artifactUserDataKeyPrefix), Offset: offset, DataSize: dataSize, DataHash: fields[2]})
+	}
+	if len(artifacts) == 0 {
+		return nil
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		if artifacts[i].Offset != artifacts[j].Offset {
+			return artifacts[i].Offset < artifacts[j].Offset
+		}
+		return artifacts[i].Name < artifacts[j].Name
+	})
+	return artifacts
+}
+
+// CreateVersionWithArtifacts creates a version of a model made of several artifacts, read from their start and sent in
+// chunks, the data of the version is their concatenation
+//
+// Creating a version isn't idempotent, it isn't retried.
+func (c *Client) CreateVersionWithArtifacts(ctx context.Context, modelID string, versionArgs VersionArgs, artifacts []ArtifactArgs) (VersionInfo, error) {
+	artifactHeaders := make([]*extensionsapi.CreateVersionWithArtifactsRequestChunk_ArtifactHeader, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		if _, err := artifact.Data.Seek(0, io.SeekStart); err != nil {
+			return VersionInfo{}, fmt.Errorf("unable to read the data of artifact %q: %w", artifact.Name, err)
+		}
+		dataSize, dataHash, err := measureData(artifact.Data)
+		if err != nil {
+			return VersionInfo{}, fmt.Errorf("unable to read the data of artifact %q: %w", artifact.Name, err)
+		}
+		artifactHeaders = append(artifactHeaders, &extensionsapi.CreateVersionWithArtifactsRequestChunk_ArtifactHeader{Name: artifact.Name, DataSize: dataSize, DataHash: dataHash})
+	}
+	creationTimestamp := uint64(0)
+	if !versionArgs.CreationTimestamp.IsZero() {
+		creationTimestamp = uint64(versionArgs.CreationTimestamp.UnixNano())
+	}
+
+	stream, err := c.extensions.CreateVersionWithArtifacts(ctx)
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	header := &extensionsapi.CreateVersionWithArtifactsRequestChunk_Header{
+		VersionInfo: &grpcapi.ModelVersionInfo{
+			ModelId:           modelID,
+			CreationTimestamp: creationTimestamp,
+			Archived:          versionArgs.Archived,
+			DataHash:          versionArgs.DataHash,
+			UserData:          versionUserData(versionArgs),
+		},
+	}
+	// A failed send is reported by CloseAndRecv
+	if err := stream.Send(&extensionsapi.CreateVersionWithArtifactsRequestChunk{Msg: &extensionsapi.CreateVersionWithArtifactsRequestChunk_Header_{Header: header}}); err == nil {
+		for index, artifact := range artifacts {
+			if err := stream.Send(&extensionsapi.CreateVersionWithArtifactsRequestChunk{Msg: &extensionsapi.CreateVersionWithArtifactsRequestChunk_ArtifactHeader_{ArtifactHeader: artifactHeaders[index]}}); err != nil {
+				break
+			}
+			sent, err := c.sendArtifactData(stream, artifact.Data)
+			if err != nil {
+				return VersionInfo{}, fmt.Errorf("unable to read the data of artifact %q: %w", artifact.Name, err)
+			}
+			if !sent {
+				break
+			}
+		}
+	}
+	rep, err := stream.CloseAndRecv()
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	return createVersionInfo(rep.VersionInfo), nil
+}
+
+// sendArtifactData sends data as body chunks until it is read, it returns false if a chunk can't be sent
+func (c *Client) sendArtifactData(stream extensionsapi.ModelRegistryExtensionsSP_CreateVersionWithArtifactsClient, data io.Reader) (bool, error) {
+	chunk := make([]byte, c.configuration.ChunkSize)
+	for {
+		readSize, err := io.ReadFull(data, chunk)
+		if readSize > 0 {
+			body := &extensionsapi.CreateVersionWithArtifactsRequestChunk_Body{DataChunk: chunk[:readSize]}
+			if err := stream.Send(&extensionsapi.CreateVersionWithArtifactsRequestChunk{Msg: &extensionsapi.CreateVersionWithArtifactsRequestChunk_Body_{Body: body}}); err != nil {
+				return false, nil
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// RetrieveArtifactData streams the data of an artifact of a version, or of the n-th to last version with -n, to a writer
+//
+// The retrieval is retried as long as no data was written. When verify is set the server checks the data
+// against the hash of the artifact before sending it.
+func (c *Client) RetrieveArtifactData(ctx context.Context, modelID string, versionNumber int, artifactName string, w io.Writer, verify bool) (int64, error) {
+	if verify {
+		ctx = metadata.AppendToOutgoingContext(ctx, verifyDataHashMetadataKey, "true")
+	}
+	writtenSize := int64(0)
+	err := c.retry(ctx, func() error {
+		stream, err := c.extensions.RetrieveArtifactData(ctx, &extensionsapi.RetrieveArtifactDataRequest{
+			ModelId:            modelID,
+			VersionNumber:      int32(versionNumber),
+			ArtifactName:       artifactName,
+			PreferredChunkSize: uint32(c.configuration.ReceivedChunkSize),
+		})
+		if err != nil {
+			return err
+		}
+		return receiveData(stream, w, &writtenSize, fmt.Sprintf("artifact %q of version \"%d\" of model %q", artifactName, versionNumber, modelID))
+	})
+	return writtenSize, err
+}
@@ -0,0 +1,279 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Version user data key recording the directory a version was imported from by ImportDirectory, relative to the root
+// of the import, e.g. `my_model/checkpoint-1000`
+const ImportedFromUserDataKey = "imported_from"
+
+type DirectoryImportOptions struct {
+	DryRun               bool // Only list the versions that would be imported
+	Archived             bool // Archive the imported versions
+	UseModificationTimes bool // Use the latest modification time of the files of a version as its creation timestamp
+}
+
+// ImportedVersion describes a version found by ImportDirectory
+type ImportedVersion struct {
+	ModelID       string `json:"modelId"`
+	Directory     string `json:"directory"`     // Relative to the root of the import
+	VersionNumber uint   `json:"versionNumber"` // 0 when not imported
+	FilesCount    int    `json:"filesCount"`
+	DataSize      uint64 `json:"dataSize"`
+	Skipped       bool   `json:"skipped"` // Imported by a previous import
+}
+
+// DirectoryImportSummary lists what ImportDirectory created, or would create in a dry run
+type DirectoryImportSummary struct {
+	CreatedModels []string          `json:"createdModels"`
+	Versions      []ImportedVersion `json:"versions"`
+}
+
+// naturalLess orders names with their numbers compared by value, e.g. `checkpoint-2` before `checkpoint-10`
+func naturalLess(a string, b string) bool {
+	for a != "" && b != "" {
+		aDigits := strings.IndexFunc(a, func(r rune) bool { return !unicode.IsDigit(r) })
+		bDigits := strings.IndexFunc(b, func(r rune) bool { return !unicode.IsDigit(r) })
+		if aDigits < 0 {
+			aDigits = len(a)
+		}
+		if bDigits < 0 {
+			bDigits = len(b)
+		}
+		if aDigits > 0 && bDigits > 0 {
+			aNumber := strings.TrimLeft(a[:aDigits], "0")
+			bNumber := strings.TrimLeft(b[:bDigits], "0")
+			if len(aNumber) != len(bNumber) {
+				return len(aNumber) < len(bNumber)
+			}
+			if aNumber != bNumber {
+				return aNumber < bNumber
+			}
+			a, b = a[aDigits:], b[bDigits:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// listEntries lists the visible entries of a directory in natural order
+func listEntries(directory string) ([]os.FileInfo, error) {
+	entries, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list %q: %w", directory, err)
+	}
+	visibleEntries := []os.FileInfo{}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			visibleEntries = append(visibleEntries, entry)
+		}
+	}
+	sort.Slice(visibleEntries, func(i, j int) bool { return naturalLess(visibleEntries[i].Name(), visibleEntries[j].Name()) })
+	return visibleEntries, nil
+}
+
+// versionFile is a file of a version found by ImportDirectory
+type versionFile struct {
+	path string
+	name string // Relative to the version directory with `/` separators, the name of its artifact
+	info os.FileInfo
+}
+
+// listVersionFiles lists the visible files of a version directory and of its subdirectories
+func listVersionFiles(directory string) ([]versionFile, error) {
+	files := []versionFile{}
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != directory && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		name, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, versionFile{path: path, name: filepath.ToSlash(name), info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the files of %q: %w", directory, err)
+	}
+	sort.Slice(files, func(i, j int) bool { return naturalLess(files[i].name, files[j].name) })
+	return files, nil
+}
+
+// importedDirectories lists the directories the versions of a model were imported from
+func (c *Client) importedDirectories(ctx context.Context, modelID string) (map[string]uint, error) {
+	importedDirectories := map[string]uint{}
+	it := c.Versions(ctx, modelID)
+	for it.Next() {
+		if directory, ok := it.VersionInfo().UserData[ImportedFromUserDataKey]; ok {
+			importedDirectories[directory] = it.VersionInfo().VersionNumber
+		}
+	}
+	if err := it.Err(); err != nil && status.Code(err) != codes.NotFound {
+		return nil, err
+	}
+	return importedDirectories, nil
+}
+
+// ImportDirectory creates a model for each directory of the root and a version for each of their entries, a
+// directory whose files are the artifacts of the version or a single file holding its data, e.g.
+// `my_model/checkpoint-1000/weights.pt`
+//
+// The versions are created by the natural order of their names and the models are created if needed. The versions
+// imported by a previous import, recorded by their ImportedFromUserDataKey user data, are skipped, an interrupted
+// import can be run again.
+func (c *Client) ImportDirectory(ctx context.Context, root string, options DirectoryImportOptions) (DirectoryImportSummary, error) {
+	summary := DirectoryImportSummary{CreatedModels: []string{}, Versions: []ImportedVersion{}}
+	modelEntries, err := listEntries(root)
+	if err != nil {
+		return summary, err
+	}
+	for _, modelEntry := range modelEntries {
+		if !modelEntry.IsDir() {
+			continue
+		}
+		modelID := modelEntry.Name()
+		modelDirectory := filepath.Join(root, modelID)
+		if err := c.importModelDirectory(ctx, modelID, modelDirectory, options, &summary); err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+func (c *Client) importModelDirectory(ctx context.Context, modelID string, modelDirectory string, options DirectoryImportOptions, summary *DirectoryImportSummary) error {
+	versionEntries, err := listEntries(modelDirectory)
+	if err != nil {
+		return err
+	}
+	_, err = c.RetrieveModelInfo(ctx, modelID)
+	modelExists := err == nil
+	if err != nil && status.Code(err) != codes.NotFound {
+		return fmt.Errorf("unable to retrieve model %q: %w", modelID, err)
+	}
+	importedDirectories := map[string]uint{}
+	if modelExists {
+		importedDirectories, err = c.importedDirectories(ctx, modelID)
+		if err != nil {
+			return fmt.Errorf("unable to list the versions of model %q: %w", modelID, err)
+		}
+	}
+
+	for _, versionEntry := range versionEntries {
+		versionDirectory := filepath.Join(modelDirectory, versionEntry.Name())
+		files := []versionFile{{path: versionDirectory, name: versionEntry.Name(), info: versionEntry}}
+		if versionEntry.IsDir() {
+			files, err = listVersionFiles(versionDirectory)
+			if err != nil {
+				return err
+			}
+		} else if !versionEntry.Mode().IsRegular() {
+			continue
+		}
+		if len(files) == 0 {
+			continue
+		}
+		importedVersion := ImportedVersion{ModelID: modelID, Directory: modelID + "/" + versionEntry.Name(), FilesCount: len(files)}
+		for _, file := range files {
+			importedVersion.DataSize += uint64(file.info.Size())
+		}
+		if versionNumber, ok := importedDirectories[importedVersion.Directory]; ok {
+			importedVersion.VersionNumber = versionNumber
+			importedVersion.Skipped = true
+			summary.Versions = append(summary.Versions, importedVersion)
+			continue
+		}
+		if !modelExists && options.DryRun {
+			modelExists = true
+			summary.CreatedModels = append(summary.CreatedModels, modelID)
+		}
+		if options.DryRun {
+			summary.Versions = append(summary.Versions, importedVersion)
+			continue
+		}
+
+		if !modelExists {
+			if err := c.CreateModel(ctx, ModelInfo{ModelID: modelID}); err != nil && status.Code(err) != codes.AlreadyExists {
+				return fmt.Errorf("unable to create model %q: %w", modelID, err)
+			}
+			modelExists = true
+			summary.CreatedModels = append(summary.CreatedModels, modelID)
+		}
+		versionInfo, err := c.importVersion(ctx, modelID, versionEntry.IsDir(), files, importedVersion.Directory, options)
+		if err != nil {
+			return fmt.Errorf("unable to import %q: %w", versionDirectory, err)
+		}
+		importedVersion.VersionNumber = versionInfo.VersionNumber
+		summary.Versions = append(summary.Versions, importedVersion)
+	}
+	return nil
+}
+
+// importVersion creates a version from the files of a version directory as artifacts, or from a single file
+func (c *Client) importVersion(ctx context.Context, modelID string, isDirectory bool, files []versionFile, directory string, options DirectoryImportOptions) (VersionInfo, error) {
+	versionArgs := VersionArgs{
+		Archived: options.Archived,
+		UserData: map[string]string{ImportedFromUserDataKey: directory},
+	}
+	if options.UseModificationTimes {
+		for _, file := range files {
+			if file.info.ModTime().After(versionArgs.CreationTimestamp) {
+				versionArgs.CreationTimestamp = file.info.ModTime()
+			}
+		}
+		versionArgs.CreationTimestamp = versionArgs.CreationTimestamp.Round(time.Microsecond)
+	}
+
+	artifacts := make([]ArtifactArgs, 0, len(files))
+	for _, file := range files {
+		data, err := os.Open(file.path)
+		if err != nil {
+			return VersionInfo{}, fmt.Errorf("unable to open %q: %w", file.path, err)
+		}
+		defer data.Close()
+		artifacts = append(artifacts, ArtifactArgs{Name: file.name, Data: data})
+	}
+	if !isDirectory {
+		return c.CreateVersion(ctx, modelID, versionArgs, artifacts[0].Data)
+	}
+	return c.CreateVersionWithArtifacts(ctx, modelID, versionArgs, artifacts)
+}
@@ -0,0 +1,165 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// Default size of the data chunks sent while creating a version
+const DefaultChunkSize = 1024 * 1024
+
+// Default delay before the first retry, doubled for every following retry
+const DefaultRetryBackoff = 100 * time.Millisecond
+
+// Maximum size of the received messages, the default maximum chunk size of the server, 64 MiB, and some room for the
+// rest of the message, gRPC's own default of 4 MiB is below the default chunk size of the server
+const maxReceivedMessageSize = 65 * 1024 * 1024
+
+// Number of models or versions retrieved at once by the iterators
+const pageSize = 100
+
+// Dialer opens a connection to the model registry at an address, e.g. to an in-process server
+type Dialer func(ctx context.Context, address string) (net.Conn, error)
+
+type Configuration struct {
+	Address           string
+	Token             string        // If defined, sent as an `authorization: Bearer <token>` metadata
+	TLSCAFile         string        // If defined, the connection uses TLS and the server certificate is verified against these CAs
+	TLSCertFile       string        // If defined with TLSKeyFile, the client certificate presented for mutual TLS
+	TLSKeyFile        string        // Private key of the client certificate
+	ChunkSize         int           // Size of the data chunks sent while creating a version, DefaultChunkSize when 0
+	ReceivedChunkSize int           // If defined, size of the data chunks the server is asked to send, clamped to its limits
+	Retries           int           // Number of times idempotent calls failing with UNAVAILABLE are retried
+	RetryBackoff      time.Duration // Delay before the first retry, DefaultRetryBackoff when 0
+	Dialer            Dialer        // If defined, opens the connection instead of dialing Address over TCP
+}
+
+// Client calls the API of a running model registry
+type Client struct {
+	connection    *grpc.ClientConn
+	registry      grpcapi.ModelRegistrySPClient
+	extensions    extensionsapi.ModelRegistryExtensionsSPClient
+	configuration Configuration
+}
+
+// tokenCredentials sends the token of the client with every call
+type tokenCredentials struct {
+	token string
+}
+
+func (c tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+func transportCredentials(configuration Configuration) (credentials.TransportCredentials, error) {
+	caCertificates, err := ioutil.ReadFile(configuration.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the CA certificates: %w", err)
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(caCertificates) {
+		return nil, fmt.Errorf("unable to parse the CA certificates of %q", configuration.TLSCAFile)
+	}
+	tlsConfig := &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+	if configuration.TLSCertFile != "" || configuration.TLSKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(configuration.TLSCertFile, configuration.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// CreateClient creates a client connected to the model registry at the configured address
+func CreateClient(ctx context.Context, configuration Configuration) (*Client, error) {
+	if configuration.ChunkSize <= 0 {
+		configuration.ChunkSize = DefaultChunkSize
+	}
+	if configuration.RetryBackoff <= 0 {
+		configuration.RetryBackoff = DefaultRetryBackoff
+	}
+
+	opts := []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxReceivedMessageSize))}
+	if configuration.TLSCAFile != "" {
+		transportCredentials, err := transportCredentials(configuration)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(transportCredentials))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	if configuration.Dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(configuration.Dialer))
+	}
+	if configuration.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials{token: configuration.Token}))
+	}
+	connection, err := grpc.DialContext(ctx, configuration.Address, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %q: %w", configuration.Address, err)
+	}
+
+	return &Client{
+		connection:    connection,
+		registry:      grpcapi.NewModelRegistrySPClient(connection),
+		extensions:    extensionsapi.NewModelRegistryExtensionsSPClient(connection),
+		configuration: configuration,
+	}, nil
+}
+
+// Close closes the connection of the client
+func (c *Client) Close() error {
+	return c.connection.Close()
+}
+
+// retry calls f until it succeeds, fails with another code than UNAVAILABLE or the configured retries are exhausted
+func (c *Client) retry(ctx context.Context, f func() error) error {
+	backoff := c.configuration.RetryBackoff
+	for retry := 0; ; retry++ {
+		err := f()
+		if err == nil || status.Code(err) != codes.Unavailable || retry >= c.configuration.Retries {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,716 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+// startServer starts a model registry server on a local port, the given number of unary calls fail with UNAVAILABLE first
+func startServer(t *testing.T, unavailableCalls int32) (string, backend.Backend) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if atomic.AddInt32(&unavailableCalls, -1) >= 0 {
+			return nil, status.Errorf(codes.Unavailable, "unavailable for the test")
+		}
+		return handler(ctx, req)
+	}))
+	t.Cleanup(server.Stop)
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(b.Destroy)
+	modelRegistryServer, err := grpcservers.RegisterModelRegistryServer(server, grpcservers.ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 16,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		VersionLeaseTTL:               300 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	modelRegistryServer.SetBackend(b)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return listener.Addr().String(), b
+}
+
+func TestVersions(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address, ChunkSize: 7})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(data))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, extensionsapi.ErrorReason_MODEL_NOT_FOUND, ErrorReason(err))
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo", UserData: map[string]string{"team": "a"}}))
+	modelInfo, err := c.RetrieveModelInfo(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, ModelInfo{ModelID: "foo", UserData: map[string]string{"team": "a"}}, modelInfo)
+	_, err = c.RetrieveModelInfo(ctx, "bar")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, map[string]string{"model_id": "bar"}, ErrorDetails(err).GetMetadata())
+
+	creationTimestamp := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	versionInfo, err := c.CreateVersion(ctx, "foo", VersionArgs{CreationTimestamp: creationTimestamp, Archived: true, UserData: map[string]string{"step": "10"}}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	assert.True(t, creationTimestamp.Equal(versionInfo.CreationTimestamp))
+	assert.Equal(t, backend.ComputeSHA256Hash(data), versionInfo.DataHash)
+	assert.Equal(t, uint64(len(data)), versionInfo.DataSize)
+	assert.Equal(t, map[string]string{"step": "10"}, versionInfo.UserData)
+
+	// The server checks the data against the given hash
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{DataHash: backend.ComputeSHA256Hash(data[:10])}, bytes.NewReader(data))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, extensionsapi.ErrorReason_HASH_MISMATCH, ErrorReason(fmt.Errorf("unable to push: %w", err)))
+
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(data[:10]))
+	assert.NoError(t, err)
+
+	latestVersionInfo, err := c.RetrieveVersionInfo(ctx, "foo", -1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), latestVersionInfo.VersionNumber)
+
+	retrievedData := bytes.Buffer{}
+	retrievedSize, err := c.RetrieveVersionData(ctx, "foo", 1, &retrievedData, true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), retrievedSize)
+	assert.Equal(t, data, retrievedData.Bytes())
+
+	versionNumbers := []uint{}
+	versions := c.Versions(ctx, "foo")
+	for versions.Next() {
+		versionNumbers = append(versionNumbers, versions.VersionInfo().VersionNumber)
+	}
+	assert.NoError(t, versions.Err())
+	assert.Equal(t, []uint{1, 2}, versionNumbers)
+
+	_, err = c.DeleteVersion(ctx, "foo", 1, false)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	deletedVersionInfo, err := c.DeleteVersion(ctx, "foo", 1, true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), deletedVersionInfo.VersionNumber)
+
+	assert.NoError(t, c.DeleteModel(ctx, "foo"))
+	versions = c.Versions(ctx, "foo")
+	assert.False(t, versions.Next())
+	assert.Equal(t, codes.NotFound, status.Code(versions.Err()))
+}
+
+func TestCloneModel(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo", UserData: map[string]string{"team": "a"}}))
+	for _, versionData := range [][]byte{data, data[:10]} {
+		_, err = c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(versionData))
+		assert.NoError(t, err)
+	}
+
+	modelInfo, versionInfos, err := c.CloneModel(ctx, "foo", "bar", []uint{2})
+	assert.NoError(t, err)
+	assert.Equal(t, ModelInfo{ModelID: "bar", UserData: map[string]string{"team": "a"}}, modelInfo)
+	assert.Len(t, versionInfos, 1)
+	assert.Equal(t, uint(2), versionInfos[0].VersionNumber)
+	retrievedData := bytes.Buffer{}
+	_, err = c.RetrieveVersionData(ctx, "bar", 2, &retrievedData, true)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:10], retrievedData.Bytes())
+
+	_, _, err = c.CloneModel(ctx, "foo", "bar", nil)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestVersionAliases(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	for range []int{1, 2} {
+		_, err := c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(data))
+		assert.NoError(t, err)
+	}
+	versionInfo, err := c.SetVersionAlias(ctx, "foo", "candidate", -2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+
+	versionInfo, err = c.RetrieveVersionInfoByAlias(ctx, "foo", "candidate")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	versionInfo, err = c.RetrieveVersionInfoByAlias(ctx, "foo", "latest")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), versionInfo.VersionNumber)
+
+	_, err = c.SetVersionAlias(ctx, "foo", "candidate", 0)
+	assert.NoError(t, err)
+	_, err = c.RetrieveVersionInfoByAlias(ctx, "foo", "candidate")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestUpdateVersionInfo(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo", Description: "Cartpole agent"}))
+	modelInfo, err := c.RetrieveModelInfo(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "Cartpole agent", modelInfo.Description)
+
+	versionInfo, err := c.CreateVersion(ctx, "foo", VersionArgs{Description: "Baseline", UserData: map[string]string{"step": "10"}}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, "Baseline", versionInfo.Description)
+
+	versionInfo, etag, err := c.UpdateVersionInfo(ctx, "foo", 1, VersionInfoUpdate{Description: "Tuned baseline", UserData: map[string]string{"reward": "0.5"}})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, "Tuned baseline", versionInfo.Description)
+	assert.Equal(t, "10", versionInfo.UserData["step"])
+	assert.Equal(t, "0.5", versionInfo.UserData["reward"])
+
+	archived := true
+	versionInfo, _, err = c.UpdateVersionInfo(ctx, "foo", -1, VersionInfoUpdate{ClearDescription: true, RemovedUserDataKeys: []string{"step"}, Archived: &archived, ExpectedETag: etag})
+	assert.NoError(t, err)
+	assert.Empty(t, versionInfo.Description)
+	assert.True(t, versionInfo.Archived)
+	assert.Equal(t, map[string]string{"reward": "0.5"}, versionInfo.UserData)
+
+	// The version changed since the first etag was returned
+	_, _, err = c.UpdateVersionInfo(ctx, "foo", 1, VersionInfoUpdate{UserData: map[string]string{"reward": "0.6"}, ExpectedETag: etag})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	_, _, err = c.UpdateVersionInfo(ctx, "foo", 2, VersionInfoUpdate{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestLockVersion(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	versionInfo, err := c.LockVersion(ctx, "foo", 1)
+	assert.NoError(t, err)
+	assert.True(t, versionInfo.Locked)
+	_, err = c.DeleteVersion(ctx, "foo", 1, true)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	versionInfo, err = c.UnlockVersion(ctx, "foo", -1)
+	assert.NoError(t, err)
+	assert.False(t, versionInfo.Locked)
+	_, err = c.DeleteVersion(ctx, "foo", 1, false)
+	assert.NoError(t, err)
+}
+
+func TestVersionDependencies(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	for _, modelID := range []string{"world_model", "policy"} {
+		assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: modelID}))
+	}
+	_, err = c.CreateVersion(ctx, "world_model", VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	_, err = c.CreateVersion(ctx, "policy", VersionArgs{Dependencies: []VersionReference{{ModelID: "world_model", VersionNumber: 2}}}, bytes.NewReader(data))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	versionInfo, err := c.CreateVersion(ctx, "policy", VersionArgs{Dependencies: []VersionReference{{ModelID: "world_model", VersionNumber: 1}}}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, []VersionReference{{ModelID: "world_model", VersionNumber: 1}}, versionInfo.Dependencies)
+
+	graph, err := c.RetrieveDependencyGraph(ctx, "world_model", 1, true)
+	assert.NoError(t, err)
+	assert.Len(t, graph.Versions, 2)
+	assert.Equal(t, []VersionDependencyEdge{{Dependent: VersionReference{ModelID: "policy", VersionNumber: 1}, Dependency: VersionReference{ModelID: "world_model", VersionNumber: 1}}}, graph.Edges)
+
+	_, err = c.DeleteVersion(ctx, "world_model", 1, false)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, deletedDependents, err := c.DeleteVersionWithDependents(ctx, "world_model", 1, false)
+	assert.NoError(t, err)
+	assert.Len(t, deletedDependents, 1)
+	assert.Equal(t, "policy", deletedDependents[0].ModelID)
+}
+
+func TestVersionLeases(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	lease, err := c.AcquireVersionLease(ctx, "foo", -1, "orchestrator_x")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), lease.VersionNumber)
+	assert.NotEmpty(t, lease.LeaseID)
+	_, err = c.RenewVersionLease(ctx, lease.LeaseID)
+	assert.NoError(t, err)
+	_, err = c.DeleteVersion(ctx, "foo", 1, false)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.NoError(t, c.ReleaseVersionLease(ctx, lease.LeaseID))
+
+	// Held leases outlive their validity
+	held, err := c.HoldVersionLease(ctx, "foo", 1, "orchestrator_y")
+	assert.NoError(t, err)
+	time.Sleep(500 * time.Millisecond)
+	leases, err := c.VersionLeases(ctx, "foo", 0)
+	assert.NoError(t, err)
+	assert.Len(t, leases, 1)
+	assert.Equal(t, "orchestrator_y", leases[0].Holder)
+	assert.Empty(t, leases[0].LeaseID)
+	assert.NoError(t, held.Err())
+	assert.NoError(t, held.Release(ctx))
+
+	leases, err = c.VersionLeases(ctx, "foo", 1)
+	assert.NoError(t, err)
+	assert.Empty(t, leases)
+	_, err = c.DeleteVersion(ctx, "foo", 1, false)
+	assert.NoError(t, err)
+}
+
+func TestVersionMetrics(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	versionInfo, err := c.CreateVersion(ctx, "foo", VersionArgs{Metrics: map[string]float64{"reward": 0.5}}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"reward": 0.5}, versionInfo.Metrics)
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	versionInfo, _, err = c.UpdateVersionInfo(ctx, "foo", 2, VersionInfoUpdate{Metrics: map[string]float64{"reward": 0.75, "loss": 1.5}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"reward": 0.75, "loss": 1.5}, versionInfo.Metrics)
+
+	versionInfos, err := c.RetrieveVersionInfosByMetric(ctx, "foo", "reward", true, 1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 1)
+	assert.Equal(t, uint(2), versionInfos[0].VersionNumber)
+	versionInfos, err = c.RetrieveVersionInfosByMetric(ctx, "foo", "reward", false, 0)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 2)
+	assert.Equal(t, uint(1), versionInfos[0].VersionNumber)
+}
+
+func TestRetrieveLineage(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	for _, modelID := range []string{"pretrained", "foo"} {
+		assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: modelID}))
+	}
+	_, err = c.CreateVersion(ctx, "pretrained", VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	versionInfo, err := c.CreateVersion(ctx, "foo", VersionArgs{Lineage: &VersionLineage{ParentModelID: "pretrained", ParentVersionNumber: 1, RunID: "run-1"}}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, &VersionLineage{ParentModelID: "pretrained", ParentVersionNumber: 1, RunID: "run-1"}, versionInfo.Lineage)
+	versionInfo, err = c.CreateVersion(ctx, "foo", VersionArgs{Lineage: &VersionLineage{ParentVersionNumber: 1}}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, &VersionLineage{ParentModelID: "foo", ParentVersionNumber: 1}, versionInfo.Lineage)
+
+	// The ancestry is followed across models
+	versionInfos, err := c.RetrieveLineage(ctx, "foo", 2, 0)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 3)
+	assert.Equal(t, "pretrained", versionInfos[2].ModelID)
+	assert.Nil(t, versionInfos[2].Lineage)
+
+	versionInfos, err = c.RetrieveLineage(ctx, "foo", 2, 2)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 2)
+
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{Lineage: &VersionLineage{ParentVersionNumber: 12}}, bytes.NewReader(data))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestVersionManifests(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	manifest := &VersionManifest{
+		Framework:          "pytorch",
+		FrameworkVersion:   "2.1.0",
+		Inputs:             []TensorSpec{{Name: "observation", DType: "float32", Shape: []int64{-1, 84}}},
+		Outputs:            []TensorSpec{{Name: "action", DType: "int64"}},
+		PythonDependencies: []string{"numpy>=1.21"},
+	}
+	versionInfo, err := c.CreateVersion(ctx, "foo", VersionArgs{Manifest: manifest}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, manifest, versionInfo.Manifest)
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{Manifest: &VersionManifest{Framework: "pytorch", FrameworkVersion: "1.13"}}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{Manifest: &VersionManifest{Framework: "pytorch", Inputs: []TensorSpec{{Name: "observation", DType: "float"}}}}, bytes.NewReader(data))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	versionInfos, err := c.RetrieveVersionInfosByFramework(ctx, "foo", "pytorch", "")
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 2)
+	versionInfos, err = c.RetrieveVersionInfosByFramework(ctx, "foo", "pytorch", "2.1.0")
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 1)
+	assert.Equal(t, manifest, versionInfos[0].Manifest)
+}
+
+func TestVersionArtifacts(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address, ChunkSize: 16})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	versionInfo, err := c.CreateVersionWithArtifacts(ctx, "foo", VersionArgs{Description: "checkpoint"}, []ArtifactArgs{
+		{Name: "weights.pt", Data: bytes.NewReader(data[:20])},
+		{Name: "config.json", Data: bytes.NewReader(data[20:])},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(len(data)), versionInfo.DataSize)
+	assert.Equal(t, "checkpoint", versionInfo.Description)
+	assert.Equal(t, []Artifact{
+		{Name: "weights.pt", Offset: 0, DataSize: 20, DataHash: backend.ComputeSHA256Hash(data[:20])},
+		{Name: "config.json", Offset: 20, DataSize: uint64(len(data) - 20), DataHash: backend.ComputeSHA256Hash(data[20:])},
+	}, versionInfo.Artifacts)
+
+	retrievedVersionInfo, err := c.RetrieveVersionInfo(ctx, "foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, versionInfo.Artifacts, retrievedVersionInfo.Artifacts)
+
+	retrievedData := &bytes.Buffer{}
+	_, err = c.RetrieveArtifactData(ctx, "foo", -1, "config.json", retrievedData, true)
+	assert.NoError(t, err)
+	assert.Equal(t, data[20:], retrievedData.Bytes())
+	_, err = c.RetrieveArtifactData(ctx, "foo", 1, "unknown", retrievedData, false)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestVersionStages(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	stageInfo, err := c.RetrieveVersionStage(ctx, "foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, NoStage, stageInfo.Stage)
+	assert.Empty(t, stageInfo.History)
+
+	_, err = c.TransitionVersionStage(ctx, "foo", 1, Staging, "")
+	assert.NoError(t, err)
+	stageInfo, err = c.TransitionVersionStage(ctx, "foo", 1, Production, "evaluated")
+	assert.NoError(t, err)
+	assert.Equal(t, Production, stageInfo.Stage)
+	assert.Len(t, stageInfo.History, 2)
+	assert.Equal(t, "evaluated", stageInfo.History[1].Comment)
+
+	versionInfo, err := c.RetrieveVersionInfoByAlias(ctx, "foo", "production")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+
+	_, err = c.TransitionVersionStage(ctx, "foo", 1, Staging, "")
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+// writesRecorder records the size of each write
+type writesRecorder struct {
+	sizes []int
+}
+
+func (w *writesRecorder) Write(p []byte) (int, error) {
+	w.sizes = append(w.sizes, len(p))
+	return len(p), nil
+}
+
+func TestReceivedChunkSize(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address, ReceivedChunkSize: 32})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	recorder := &writesRecorder{}
+	_, err = c.RetrieveVersionData(ctx, "foo", 1, recorder, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{32, len(data) - 32}, recorder.sizes)
+}
+
+func TestLargeReceivedChunks(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	// Above gRPC's default maximum message size of 4 MiB, like the default chunk size of the server
+	c, err := CreateClient(ctx, Configuration{Address: address, ReceivedChunkSize: 5 * 1024 * 1024})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	largeData := bytes.Repeat(data, 100*1024)
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(largeData))
+	assert.NoError(t, err)
+
+	recorder := &writesRecorder{}
+	_, err = c.RetrieveVersionData(ctx, "foo", 1, recorder, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{5 * 1024 * 1024, len(largeData) - 5*1024*1024}, recorder.sizes)
+}
+
+func TestRetrieveVersionDataIfModified(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	versionInfo, err := c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	w := &bytes.Buffer{}
+	writtenSize, modified, err := c.RetrieveVersionDataIfModified(ctx, "foo", -1, "", w, false)
+	assert.NoError(t, err)
+	assert.True(t, modified)
+	assert.Equal(t, int64(len(data)), writtenSize)
+	assert.Equal(t, data, w.Bytes())
+
+	w.Reset()
+	writtenSize, modified, err = c.RetrieveVersionDataIfModified(ctx, "foo", -1, versionInfo.DataHash, w, false)
+	assert.NoError(t, err)
+	assert.False(t, modified)
+	assert.Equal(t, int64(0), writtenSize)
+	assert.Equal(t, 0, w.Len())
+}
+
+func TestRetrieveLatestVersionIfChanged(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address, ReceivedChunkSize: 16})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	w := &bytes.Buffer{}
+	versionInfo, changed, err := c.RetrieveLatestVersionIfChanged(ctx, "foo", 0, "", w)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	assert.Equal(t, data, w.Bytes())
+
+	w.Reset()
+	versionInfo, changed, err = c.RetrieveLatestVersionIfChanged(ctx, "foo", versionInfo.VersionNumber, versionInfo.DataHash, w)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	assert.Equal(t, 0, w.Len())
+}
+
+func TestRetrieveVersionDataURL(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	// The filesystem backend doesn't provide URLs
+	versionInfo, url, expirationTime, err := c.RetrieveVersionDataURL(ctx, "foo", -1, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "", url)
+	assert.True(t, expirationTime.IsZero())
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	assert.Equal(t, uint64(len(data)), versionInfo.DataSize)
+}
+
+func TestModels(t *testing.T) {
+	address, b := startServer(t, 0)
+	modelsCount := pageSize + pageSize/2
+	for i := 0; i < modelsCount; i++ {
+		_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: fmt.Sprintf("model_%03d", i)})
+		assert.NoError(t, err)
+	}
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	modelIDs := []string{}
+	models := c.Models(ctx)
+	for models.Next() {
+		modelIDs = append(modelIDs, models.ModelInfo().ModelID)
+	}
+	assert.NoError(t, models.Err())
+	assert.Len(t, modelIDs, modelsCount)
+	assert.Equal(t, "model_000", modelIDs[0])
+	assert.Equal(t, fmt.Sprintf("model_%03d", modelsCount-1), modelIDs[modelsCount-1])
+
+	// The models of a namespace are also retrieved page by page
+	for i := 0; i <= pageSize; i++ {
+		_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: fmt.Sprintf("team_a.model_%03d", i)})
+		assert.NoError(t, err)
+	}
+	modelIDs = []string{}
+	models = c.NamespaceModels(ctx, "team_a")
+	for models.Next() {
+		modelIDs = append(modelIDs, models.ModelInfo().ModelID)
+	}
+	assert.NoError(t, models.Err())
+	assert.Len(t, modelIDs, pageSize+1)
+	assert.Equal(t, "team_a.model_000", modelIDs[0])
+}
+
+func TestModelRevisions(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModelAtRevision(ctx, ModelInfo{ModelID: "foo", UserData: map[string]string{"team": "a"}}, 0))
+	modelInfo, err := c.RetrieveModelInfo(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), modelInfo.Revision)
+
+	modelInfo.UserData["team"] = "b"
+	assert.NoError(t, c.CreateOrUpdateModelAtRevision(ctx, modelInfo, modelInfo.Revision))
+	err = c.CreateOrUpdateModelAtRevision(ctx, modelInfo, modelInfo.Revision)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	modelInfo, err = c.RetrieveModelInfo(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), modelInfo.Revision)
+	assert.Equal(t, "b", modelInfo.UserData["team"])
+}
+
+func TestCreateModelAndUpdateModel(t *testing.T) {
+	address, _ := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.Equal(t, codes.NotFound, status.Code(c.UpdateModel(ctx, ModelInfo{ModelID: "foo"})))
+	assert.NoError(t, c.CreateModel(ctx, ModelInfo{ModelID: "foo", Description: "First"}))
+	assert.Equal(t, codes.AlreadyExists, status.Code(c.CreateModel(ctx, ModelInfo{ModelID: "foo"})))
+	assert.NoError(t, c.UpdateModel(ctx, ModelInfo{ModelID: "foo", Description: "Second"}))
+	modelInfo, err := c.RetrieveModelInfo(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "Second", modelInfo.Description)
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	{
+		address, _ := startServer(t, 2)
+		c, err := CreateClient(ctx, Configuration{Address: address, Retries: 2, RetryBackoff: time.Millisecond})
+		assert.NoError(t, err)
+		defer c.Close()
+		assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	}
+	{
+		address, _ := startServer(t, 2)
+		c, err := CreateClient(ctx, Configuration{Address: address, Retries: 1, RetryBackoff: time.Millisecond})
+		assert.NoError(t, err)
+		defer c.Close()
+		err = c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	}
+}
+
+func TestExportImportRegistry(t *testing.T) {
+	address, b := startServer(t, 0)
+	ctx := context.Background()
+	c, err := CreateClient(ctx, Configuration{Address: address, ChunkSize: 100})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, ModelInfo{ModelID: "foo"}))
+	_, err = c.CreateVersion(ctx, "foo", VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	archive := bytes.Buffer{}
+	assert.NoError(t, c.ExportRegistry(ctx, &archive, nil))
+
+	_, err = c.ImportRegistry(ctx, bytes.NewReader(archive.Bytes()))
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	assert.NoError(t, b.DeleteModel("foo"))
+	summary, err := c.ImportRegistry(ctx, bytes.NewReader(archive.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, ImportSummary{ModelsCount: 1, VersionsCount: 1}, summary)
+
+	retrievedData := bytes.Buffer{}
+	_, err = c.RetrieveVersionData(ctx, "foo", 1, &retrievedData, true)
+	assert.NoError(t, err)
+	assert.Equal(t, data, retrievedData.Bytes())
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// User data keys starting with this prefix, followed by a model id, hold the version of this model a version depends on
+const dependencyUserDataKeyPrefix = "cogment_model_registry.dependency."
+
+// VersionReference identifies a version of a model, e.g. a dependency of another version
+type VersionReference struct {
+	ModelID       string `json:"modelId"`
+	VersionNumber uint   `json:"versionNumber"`
+}
+
+// VersionDependencyEdge records that the dependent version depends on the dependency version
+type VersionDependencyEdge struct {
+	Dependent  VersionReference `json:"dependent"`
+	Dependency VersionReference `json:"dependency"`
+}
+
+// DependencyGraph is a version along with the versions it depends on and, if requested, the versions depending on it
+type DependencyGraph struct {
+	Versions []VersionInfo           `json:"versions"` // The requested version first
+	Edges    []VersionDependencyEdge `json:"edges"`
+}
+
+// parseDependencies retrieves the dependencies of a version from its user data ordered by model id, nil if it has none
+func parseDependencies(userData map[string]string) []VersionReference {
+	var dependencies []VersionReference
+	for key, value := range userData {
+		if !strings.HasPrefix(key, dependencyUserDataKeyPrefix) {
+			continue
+		}
+		versionNumber, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			continue
+		}
+		dependencies = append(dependencies, VersionReference{ModelID: strings.TrimPrefix(key, dependencyUserDataKeyPrefix), VersionNumber: uint(versionNumber)})
+	}
+	sort.Slice(dependencies, func(i, j int) bool { return dependencies[i].ModelID < dependencies[j].ModelID })
+	return dependencies
+}
+
+// withDependencies copies user data with the entries of dependencies set
+func withDependencies(userData map[string]string, dependencies []VersionReference) map[string]string {
+	if len(dependencies) == 0 {
+		return userData
+	}
+	userDataWithDependencies := make(map[string]string, len(userData)+len(dependencies))
+	for key, value := range userData {
+		userDataWithDependencies[key] = value
+	}
+	for _, dependency := range dependencies {
+		userDataWithDependencies[dependencyUserDataKeyPrefix+dependency.ModelID] = strconv.FormatUint(uint64(dependency.VersionNumber), 10)
+	}
+	return userDataWithDependencies
+}
+
+func createVersionReference(pbReference *extensionsapi.VersionReference) VersionReference {
+	return VersionReference{ModelID: pbReference.ModelId, VersionNumber: uint(pbReference.VersionNumber)}
+}
+
+// RetrieveDependencyGraph retrieves a version, or the n-th to last version with -n, the versions it depends on and, when
+// includeDependents is set, the versions depending on it, which requires the read scope on every model
+func (c *Client) RetrieveDependencyGraph(ctx context.Context, modelID string, versionNumber int, includeDependents bool) (DependencyGraph, error) {
+	graph := DependencyGraph{}
+	err := c.retry(ctx, func() error {
+		rep, err := c.extensions.RetrieveDependencyGraph(ctx, &extensionsapi.RetrieveDependencyGraphRequest{
+			ModelId:           modelID,
+			VersionNumber:     int32(versionNumber),
+			IncludeDependents: includeDependents,
+		})
+		if err != nil {
+			return err
+		}
+		graph = DependencyGraph{
+			Versions: make([]VersionInfo, 0, len(rep.Versions)),
+			Edges:    make([]VersionDependencyEdge, 0, len(rep.Edges)),
+		}
+		for _, pbVersionInfo := range rep.Versions {
+			graph.Versions = append(graph.Versions, createVersionInfo(pbVersionInfo))
+		}
+		for _, pbEdge := range rep.Edges {
+			graph.Edges = append(graph.Edges, VersionDependencyEdge{Dependent: createVersionReference(pbEdge.Dependent), Dependency: createVersionReference(pbEdge.Dependency)})
+		}
+		return nil
+	})
+	return graph, err
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// ErrorDetails returns the details attached by the server to the status of an error, nil if its reason isn't known
+func ErrorDetails(err error) *extensionsapi.ErrorDetails {
+	var statusErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &statusErr) {
+		return nil
+	}
+	for _, detail := range statusErr.GRPCStatus().Details() {
+		if errorDetails, ok := detail.(*extensionsapi.ErrorDetails); ok {
+			return errorDetails
+		}
+	}
+	return nil
+}
+
+// ErrorReason returns the reason of an error, e.g. MODEL_NOT_FOUND, UNKNOWN_ERROR_REASON if it isn't known
+func ErrorReason(err error) extensionsapi.ErrorReason {
+	return ErrorDetails(err).GetReason()
+}
+
+// reasonError creates a status error carrying a reason like the ones of the server
+func reasonError(c codes.Code, reason extensionsapi.ErrorReason, metadata map[string]string, format string, a ...interface{}) error {
+	st := status.New(c, fmt.Sprintf(format, a...))
+	detailedSt, err := st.WithDetails(&extensionsapi.ErrorDetails{Reason: reason, Metadata: metadata})
+	if err != nil {
+		return st.Err()
+	}
+	return detailedSt.Err()
+}
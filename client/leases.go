@@ -0,0 +1,187 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// VersionLease marks a version as in use by a holder, it can't be deleted while the lease is renewed
+type VersionLease struct {
+	LeaseID        string    `json:"leaseId,omitempty"` // Only known by the holder, empty for the listed leases
+	ModelID        string    `json:"modelId"`
+	VersionNumber  uint      `json:"versionNumber"`
+	Holder         string    `json:"holder"`
+	ExpirationTime time.Time `json:"expirationTime"`
+}
+
+func createVersionLease(pbLease *extensionsapi.VersionLease) VersionLease {
+	return VersionLease{
+		LeaseID:        pbLease.LeaseId,
+		ModelID:        pbLease.ModelId,
+		VersionNumber:  uint(pbLease.VersionNumber),
+		Holder:         pbLease.Holder,
+		ExpirationTime: time.Unix(0, int64(pbLease.ExpirationTimestamp)),
+	}
+}
+
+// AcquireVersionLease leases a version, or the n-th to last version with -n, for a holder, acquiring it again renews it
+//
+// The lease expires unless renewed with RenewVersionLease, HoldVersionLease renews it in the background.
+func (c *Client) AcquireVersionLease(ctx context.Context, modelID string, versionNumber int, holder string) (VersionLease, error) {
+	lease := VersionLease{}
+	acquireVersionLease := func() error {
+		rep, err := c.extensions.AcquireVersionLease(ctx, &extensionsapi.AcquireVersionLeaseRequest{ModelId: modelID, VersionNumber: int32(versionNumber), Holder: holder})
+		if err != nil {
+			return err
+		}
+		lease = createVersionLease(rep.Lease)
+		return nil
+	}
+	if versionNumber < 0 {
+		return lease, acquireVersionLease()
+	}
+	return lease, c.retry(ctx, acquireVersionLease)
+}
+
+// RenewVersionLease postpones the expiration of a lease, it fails with NOT_FOUND once the lease expired
+func (c *Client) RenewVersionLease(ctx context.Context, leaseID string) (VersionLease, error) {
+	lease := VersionLease{}
+	err := c.retry(ctx, func() error {
+		rep, err := c.extensions.RenewVersionLease(ctx, &extensionsapi.RenewVersionLeaseRequest{LeaseId: leaseID})
+		if err != nil {
+			return err
+		}
+		lease = createVersionLease(rep.Lease)
+		return nil
+	})
+	return lease, err
+}
+
+func (c *Client) ReleaseVersionLease(ctx context.Context, leaseID string) error {
+	return c.retry(ctx, func() error {
+		_, err := c.extensions.ReleaseVersionLease(ctx, &extensionsapi.ReleaseVersionLeaseRequest{LeaseId: leaseID})
+		return err
+	})
+}
+
+// VersionLeases lists the leases on the versions of a model, on every version when versionNumber is 0
+func (c *Client) VersionLeases(ctx context.Context, modelID string, versionNumber uint) ([]VersionLease, error) {
+	leases := []VersionLease{}
+	err := c.retry(ctx, func() error {
+		rep, err := c.extensions.ListVersionLeases(ctx, &extensionsapi.ListVersionLeasesRequest{ModelId: modelID, VersionNumber: uint32(versionNumber)})
+		if err != nil {
+			return err
+		}
+		leases = leases[:0]
+		for _, pbLease := range rep.Leases {
+			leases = append(leases, createVersionLease(pbLease))
+		}
+		return nil
+	})
+	return leases, err
+}
+
+// Shortest delay between two renewals of a held lease
+const minLeaseRenewalDelay = time.Second
+
+// HeldVersionLease is a lease renewed in the background by HoldVersionLease
+type HeldVersionLease struct {
+	client  *Client
+	mutex   sync.Mutex
+	lease   VersionLease
+	err     error // Last renewal error, nil if the last renewal succeeded
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// HoldVersionLease leases a version, or the n-th to last version with -n, for a holder and renews the lease in the
+// background until the context is done or Release is called
+//
+// The lease is renewed when a third of its validity remains, an expired lease is acquired again.
+func (c *Client) HoldVersionLease(ctx context.Context, modelID string, versionNumber int, holder string) (*HeldVersionLease, error) {
+	lease, err := c.AcquireVersionLease(ctx, modelID, versionNumber, holder)
+	if err != nil {
+		return nil, err
+	}
+	renewCtx, cancel := context.WithCancel(ctx)
+	held := &HeldVersionLease{
+		client:  c,
+		lease:   lease,
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	go held.renew(renewCtx)
+	return held, nil
+}
+
+func (h *HeldVersionLease) renew(ctx context.Context) {
+	defer close(h.stopped)
+	wait := time.Until(h.Lease().ExpirationTime) * 2 / 3
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		lease := h.Lease()
+		renewedLease, err := h.client.RenewVersionLease(ctx, lease.LeaseID)
+		if status.Code(err) == codes.NotFound {
+			renewedLease, err = h.client.AcquireVersionLease(ctx, lease.ModelID, int(lease.VersionNumber), lease.Holder)
+		}
+		h.mutex.Lock()
+		h.err = err
+		if err == nil {
+			h.lease = renewedLease
+		}
+		h.mutex.Unlock()
+		if err == nil {
+			wait = time.Until(renewedLease.ExpirationTime) * 2 / 3
+		} else if wait = time.Until(lease.ExpirationTime) / 2; wait < minLeaseRenewalDelay {
+			// Trying again before the lease expires, without flooding the server once it did
+			wait = minLeaseRenewalDelay
+		}
+	}
+}
+
+// Lease retrieves the lease as of its last renewal
+func (h *HeldVersionLease) Lease() VersionLease {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.lease
+}
+
+// Err retrieves the error of the last renewal, nil if it succeeded
+func (h *HeldVersionLease) Err() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.err
+}
+
+// Release stops renewing the lease and releases it
+func (h *HeldVersionLease) Release(ctx context.Context) error {
+	h.cancel()
+	<-h.stopped
+	return h.client.ReleaseVersionLease(ctx, h.Lease().LeaseID)
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// User data keys holding the lineage of a version
+const (
+	parentModelIDUserDataKey       = "cogment_model_registry.lineage.parent_model_id"
+	parentVersionNumberUserDataKey = "cogment_model_registry.lineage.parent_version_number"
+	runIDUserDataKey               = "cogment_model_registry.lineage.run_id"
+	trialIDUserDataKey             = "cogment_model_registry.lineage.trial_id"
+)
+
+// VersionLineage records where a version comes from, it is set when the version is created
+type VersionLineage struct {
+	ParentModelID       string `json:"parentModelId,omitempty"`       // Defaults to the model of the version
+	ParentVersionNumber uint   `json:"parentVersionNumber,omitempty"` // Version the version was trained from, 0 if it has none
+	RunID               string `json:"runId,omitempty"`
+	TrialID             string `json:"trialId,omitempty"`
+}
+
+// parseLineage retrieves the lineage of a version of a model from its user data, nil if it has none
+func parseLineage(modelID string, userData map[string]string) *VersionLineage {
+	lineage := VersionLineage{
+		ParentModelID: userData[parentModelIDUserDataKey],
+		RunID:         userData[runIDUserDataKey],
+		TrialID:       userData[trialIDUserDataKey],
+	}
+	if parentVersionNumber, err := strconv.ParseUint(userData[parentVersionNumberUserDataKey], 10, 32); err == nil {
+		lineage.ParentVersionNumber = uint(parentVersionNumber)
+		if lineage.ParentModelID == "" {
+			lineage.ParentModelID = modelID
+		}
+	}
+	if lineage == (VersionLineage{}) {
+		return nil
+	}
+	return &lineage
+}
+
+// withLineage copies user data with the entries of a lineage set
+func withLineage(userData map[string]string, lineage *VersionLineage) map[string]string {
+	if lineage == nil {
+		return userData
+	}
+	userDataWithLineage := make(map[string]string, len(userData)+4)
+	for key, value := range userData {
+		userDataWithLineage[key] = value
+	}
+	if lineage.ParentModelID != "" {
+		userDataWithLineage[parentModelIDUserDataKey] = lineage.ParentModelID
+	}
+	if lineage.ParentVersionNumber > 0 {
+		userDataWithLineage[parentVersionNumberUserDataKey] = strconv.FormatUint(uint64(lineage.ParentVersionNumber), 10)
+	}
+	if lineage.RunID != "" {
+		userDataWithLineage[runIDUserDataKey] = lineage.RunID
+	}
+	if lineage.TrialID != "" {
+		userDataWithLineage[trialIDUserDataKey] = lineage.TrialID
+	}
+	return userDataWithLineage
+}
+
+// RetrieveLineage retrieves a version and its ancestors, from the closest, following the parents across models
+//
+// The walk stops at a deleted parent or after maxDepth versions, 0 means no limit.
+func (c *Client) RetrieveLineage(ctx context.Context, modelID string, versionNumber int, maxDepth int) ([]VersionInfo, error) {
+	versionInfos := []VersionInfo{}
+	for {
+		remainingDepth := 0
+		if maxDepth > 0 {
+			remainingDepth = maxDepth - len(versionInfos)
+		}
+		ancestors := []VersionInfo{}
+		err := c.retry(ctx, func() error {
+			rep, err := c.extensions.RetrieveLineage(ctx, &extensionsapi.RetrieveLineageRequest{
+				ModelId:       modelID,
+				VersionNumber: int32(versionNumber),
+				MaxDepth:      uint32(remainingDepth),
+			})
+			if err != nil {
+				return err
+			}
+			ancestors = make([]VersionInfo, 0, len(rep.Ancestors))
+			for _, ancestor := range rep.Ancestors {
+				ancestors = append(ancestors, createVersionInfo(ancestor.VersionInfo))
+			}
+			return nil
+		})
+		if err != nil {
+			// The ancestry continues in a model that was deleted since
+			if len(versionInfos) > 0 && status.Code(err) == codes.NotFound {
+				return versionInfos, nil
+			}
+			return nil, err
+		}
+		versionInfos = append(versionInfos, ancestors...)
+		if len(ancestors) == 0 || (maxDepth > 0 && len(versionInfos) >= maxDepth) {
+			return versionInfos, nil
+		}
+		lineage := ancestors[len(ancestors)-1].Lineage
+		if lineage == nil || lineage.ParentVersionNumber == 0 || lineage.ParentModelID == modelID {
+			return versionInfos, nil
+		}
+		modelID = lineage.ParentModelID
+		versionNumber = int(lineage.ParentVersionNumber)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// User data keys holding the manifest of a version
+const (
+	frameworkUserDataKey          = "cogment_model_registry.manifest.framework"
+	frameworkVersionUserDataKey   = "cogment_model_registry.manifest.framework_version"
+	inputsUserDataKey             = "cogment_model_registry.manifest.inputs"
+	outputsUserDataKey            = "cogment_model_registry.manifest.outputs"
+	pythonDependenciesUserDataKey = "cogment_model_registry.manifest.python_dependencies"
+)
+
+// TensorSpec describes an input or output tensor of a version
+type TensorSpec struct {
+	Name  string  `json:"name"`
+	DType string  `json:"dtype"`           // e.g. "float32"
+	Shape []int64 `json:"shape,omitempty"` // -1 for a dynamic dimension
+}
+
+// VersionManifest describes what is needed to serve a version, it is set when the version is created
+type VersionManifest struct {
+	Framework          string       `json:"framework"`                  // e.g. "pytorch"
+	FrameworkVersion   string       `json:"frameworkVersion,omitempty"` // e.g. "2.1.0"
+	Inputs             []TensorSpec `json:"inputs,omitempty"`
+	Outputs            []TensorSpec `json:"outputs,omitempty"`
+	PythonDependencies []string     `json:"pythonDependencies,omitempty"` // Requirement specifiers, e.g. "numpy>=1.21"
+}
+
+// parseManifest retrieves the manifest of a version from its user data, nil if it has none
+func parseManifest(userData map[string]string) *VersionManifest {
+	framework, ok := userData[frameworkUserDataKey]
+	if !ok {
+		return nil
+	}
+	manifest := VersionManifest{Framework: framework, FrameworkVersion: userData[frameworkVersionUserDataKey]}
+	// The registry validates the manifest, entries that can't be parsed are ignored
+	_ = json.Unmarshal([]byte(userData[inputsUserDataKey]), &manifest.Inputs)
+	_ = json.Unmarshal([]byte(userData[outputsUserDataKey]), &manifest.Outputs)
+	_ = json.Unmarshal([]byte(userData[pythonDependenciesUserDataKey]), &manifest.PythonDependencies)
+	return &manifest
+}
+
+// withManifest copies user data with the entries of a manifest set, unless it is nil
+func withManifest(userData map[string]string, manifest *VersionManifest) map[string]string {
+	if manifest == nil {
+		return userData
+	}
+	userDataWithManifest := make(map[string]string, len(userData)+5)
+	for key, value := range userData {
+		userDataWithManifest[key] = value
+	}
+	userDataWithManifest[frameworkUserDataKey] = manifest.Framework
+	if manifest.FrameworkVersion != "" {
+		userDataWithManifest[frameworkVersionUserDataKey] = manifest.FrameworkVersion
+	}
+	// Serializing slices of strings and numbers doesn't fail
+	if len(manifest.Inputs) > 0 {
+		inputs, _ := json.Marshal(manifest.Inputs)
+		userDataWithManifest[inputsUserDataKey] = string(inputs)
+	}
+	if len(manifest.Outputs) > 0 {
+		outputs, _ := json.Marshal(manifest.Outputs)
+		userDataWithManifest[outputsUserDataKey] = string(outputs)
+	}
+	if len(manifest.PythonDependencies) > 0 {
+		pythonDependencies, _ := json.Marshal(manifest.PythonDependencies)
+		userDataWithManifest[pythonDependenciesUserDataKey] = string(pythonDependencies)
+	}
+	return userDataWithManifest
+}
+
+// RetrieveVersionInfosByFramework retrieves the versions of a model whose manifest defines a framework, and a framework
+// version unless it is empty, e.g. to find the versions a serving infrastructure is able to load
+func (c *Client) RetrieveVersionInfosByFramework(ctx context.Context, modelID string, framework string, frameworkVersion string) ([]VersionInfo, error) {
+	versionInfos := []VersionInfo{}
+	err := c.retry(ctx, func() error {
+		rep, err := c.extensions.QueryVersionInfos(ctx, &extensionsapi.QueryVersionInfosRequest{
+			ModelId:          modelID,
+			Framework:        framework,
+			FrameworkVersion: frameworkVersion,
+		})
+		if err != nil {
+			return err
+		}
+		versionInfos = make([]VersionInfo, 0, len(rep.VersionInfos))
+		for _, pbVersionInfo := range rep.VersionInfos {
+			versionInfos = append(versionInfos, createVersionInfo(pbVersionInfo))
+		}
+		return nil
+	})
+	return versionInfos, err
+}
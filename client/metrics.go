@@ -0,0 +1,81 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// Prefix of the user data keys holding the metrics of a version
+const metricUserDataKeyPrefix = "cogment_model_registry.metric."
+
+// parseMetrics extracts the metrics of a version from its user data, entries that aren't numbers are ignored
+func parseMetrics(userData map[string]string) map[string]float64 {
+	metrics := map[string]float64{}
+	for key, value := range userData {
+		if !strings.HasPrefix(key, metricUserDataKeyPrefix) {
+			continue
+		}
+		if metric, err := strconv.ParseFloat(value, 64); err == nil {
+			metrics[strings.TrimPrefix(key, metricUserDataKeyPrefix)] = metric
+		}
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	return metrics
+}
+
+// withMetrics copies user data with the entries of some metrics set
+func withMetrics(userData map[string]string, metrics map[string]float64) map[string]string {
+	if len(metrics) == 0 {
+		return userData
+	}
+	userDataWithMetrics := make(map[string]string, len(userData)+len(metrics))
+	for key, value := range userData {
+		userDataWithMetrics[key] = value
+	}
+	for name, metric := range metrics {
+		userDataWithMetrics[metricUserDataKeyPrefix+name] = strconv.FormatFloat(metric, 'g', -1, 64)
+	}
+	return userDataWithMetrics
+}
+
+// RetrieveVersionInfosByMetric retrieves at most count versions of a model having a metric, ordered by its value, e.g.
+// the versions with the best evaluation score. A count of 0 retrieves every version having the metric.
+func (c *Client) RetrieveVersionInfosByMetric(ctx context.Context, modelID string, metric string, descending bool, count int) ([]VersionInfo, error) {
+	versionInfos := []VersionInfo{}
+	err := c.retry(ctx, func() error {
+		rep, err := c.extensions.QueryVersionInfos(ctx, &extensionsapi.QueryVersionInfosRequest{
+			ModelId:       modelID,
+			OrderByMetric: metric,
+			Descending:    descending,
+			VersionsCount: uint32(count),
+		})
+		if err != nil {
+			return err
+		}
+		versionInfos = make([]VersionInfo, 0, len(rep.VersionInfos))
+		for _, pbVersionInfo := range rep.VersionInfos {
+			versionInfos = append(versionInfos, createVersionInfo(pbVersionInfo))
+		}
+		return nil
+	})
+	return versionInfos, err
+}
@@ -0,0 +1,205 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// Model user data key storing the revision of a model, managed by the registry
+const modelRevisionUserDataKey = "cogment_model_registry.revision"
+
+// Metadata key asking the server to update a model only if it is at the expected revision
+const expectedModelRevisionMetadataKey = "cogment-model-registry-expected-revision"
+
+type ModelInfo struct {
+	ModelID     string            `json:"modelId"`
+	Description string            `json:"description,omitempty"` // Stored in the user data, overrides its description entry when not empty
+	Revision    uint64            `json:"revision,omitempty"`    // Stored in the user data, 0 until updated with CreateOrUpdateModelAtRevision
+	UserData    map[string]string `json:"userData,omitempty"`
+}
+
+func createModelInfo(pbModelInfo *grpcapi.ModelInfo) ModelInfo {
+	revision, _ := strconv.ParseUint(pbModelInfo.UserData[modelRevisionUserDataKey], 10, 64)
+	return ModelInfo{
+		ModelID:     pbModelInfo.ModelId,
+		Description: pbModelInfo.UserData[descriptionUserDataKey],
+		Revision:    revision,
+		UserData:    pbModelInfo.UserData,
+	}
+}
+
+// CreateOrUpdateModel creates a model or replaces the user data of an existing one
+func (c *Client) CreateOrUpdateModel(ctx context.Context, modelInfo ModelInfo) error {
+	return c.retry(ctx, func() error {
+		_, err := c.registry.CreateOrUpdateModel(ctx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{
+			ModelId:  modelInfo.ModelID,
+			UserData: withDescription(modelInfo.UserData, modelInfo.Description),
+		}})
+		return err
+	})
+}
+
+// CreateModel creates a model, failing with ALREADY_EXISTS if it exists
+func (c *Client) CreateModel(ctx context.Context, modelInfo ModelInfo) error {
+	return c.retry(ctx, func() error {
+		_, err := c.extensions.CreateModel(ctx, &extensionsapi.CreateModelRequest{ModelInfo: &grpcapi.ModelInfo{
+			ModelId:  modelInfo.ModelID,
+			UserData: withDescription(modelInfo.UserData, modelInfo.Description),
+		}})
+		return err
+	})
+}
+
+// UpdateModel replaces the user data of a model, failing with NOT_FOUND if it doesn't exist
+func (c *Client) UpdateModel(ctx context.Context, modelInfo ModelInfo) error {
+	return c.retry(ctx, func() error {
+		_, err := c.extensions.UpdateModel(ctx, &extensionsapi.UpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{
+			ModelId:  modelInfo.ModelID,
+			UserData: withDescription(modelInfo.UserData, modelInfo.Description),
+		}})
+		return err
+	})
+}
+
+// CreateOrUpdateModelAtRevision creates or updates a model only if it is at the expected revision, failing with
+// FAILED_PRECONDITION otherwise
+//
+// A missing model is at revision 0, the revision of the retrieved models is their Revision field.
+func (c *Client) CreateOrUpdateModelAtRevision(ctx context.Context, modelInfo ModelInfo, expectedRevision uint64) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, expectedModelRevisionMetadataKey, strconv.FormatUint(expectedRevision, 10))
+	return c.CreateOrUpdateModel(ctx, modelInfo)
+}
+
+// RetrieveModelInfo retrieves the info of a model, failing with NOT_FOUND if it doesn't exist
+func (c *Client) RetrieveModelInfo(ctx context.Context, modelID string) (ModelInfo, error) {
+	modelInfo := ModelInfo{}
+	err := c.retry(ctx, func() error {
+		rep, err := c.registry.RetrieveModels(ctx, &grpcapi.RetrieveModelsRequest{ModelIds: []string{modelID}})
+		if err != nil {
+			return err
+		}
+		if len(rep.ModelInfos) == 0 {
+			return reasonError(codes.NotFound, extensionsapi.ErrorReason_MODEL_NOT_FOUND, map[string]string{"model_id": modelID}, "unable to retrieve model %q", modelID)
+		}
+		modelInfo = createModelInfo(rep.ModelInfos[0])
+		return nil
+	})
+	return modelInfo, err
+}
+
+// DeleteModel deletes a model and all its versions, it isn't retried
+func (c *Client) DeleteModel(ctx context.Context, modelID string) error {
+	_, err := c.registry.DeleteModel(ctx, &grpcapi.DeleteModelRequest{ModelId: modelID})
+	return err
+}
+
+// CloneModel creates a model from the user data and the given versions of another model, every version when
+// versionNumbers is empty, their data is copied by the server. It isn't retried.
+func (c *Client) CloneModel(ctx context.Context, sourceModelID string, modelID string, versionNumbers []uint) (ModelInfo, []VersionInfo, error) {
+	pbVersionNumbers := make([]uint32, 0, len(versionNumbers))
+	for _, versionNumber := range versionNumbers {
+		pbVersionNumbers = append(pbVersionNumbers, uint32(versionNumber))
+	}
+	rep, err := c.extensions.CloneModel(ctx, &extensionsapi.CloneModelRequest{SourceModelId: sourceModelID, ModelId: modelID, VersionNumbers: pbVersionNumbers})
+	if err != nil {
+		return ModelInfo{}, nil, err
+	}
+	versionInfos := make([]VersionInfo, 0, len(rep.VersionInfos))
+	for _, pbVersionInfo := range rep.VersionInfos {
+		versionInfos = append(versionInfos, createVersionInfo(pbVersionInfo))
+	}
+	return createModelInfo(rep.ModelInfo), versionInfos, nil
+}
+
+// ModelIterator iterates over the models of the registry, retrieving them page by page
+type ModelIterator struct {
+	ctx         context.Context
+	client      *Client
+	page        []ModelInfo
+	index       int    // Index of the current model in the page
+	namespace   string // If defined, only the models of this namespace are iterated over
+	modelHandle string
+	lastPage    bool
+	err         error
+}
+
+// Models creates an iterator over all the models of the registry
+func (c *Client) Models(ctx context.Context) *ModelIterator {
+	return &ModelIterator{ctx: ctx, client: c, index: -1}
+}
+
+// NamespaceModels creates an iterator over the models of a namespace, i.e. whose id is `<namespace>.<model>`
+func (c *Client) NamespaceModels(ctx context.Context, namespace string) *ModelIterator {
+	return &ModelIterator{ctx: ctx, client: c, index: -1, namespace: namespace}
+}
+
+// retrievePage retrieves the page of models following the current handle
+func (it *ModelIterator) retrievePage() ([]*grpcapi.ModelInfo, string, error) {
+	if it.namespace != "" {
+		rep, err := it.client.extensions.QueryModels(it.ctx, &extensionsapi.QueryModelsRequest{Namespace: it.namespace, ModelsCount: pageSize, ModelHandle: it.modelHandle})
+		if err != nil {
+			return nil, "", err
+		}
+		return rep.ModelInfos, rep.NextModelHandle, nil
+	}
+	rep, err := it.client.registry.RetrieveModels(it.ctx, &grpcapi.RetrieveModelsRequest{ModelsCount: pageSize, ModelHandle: it.modelHandle})
+	if err != nil {
+		return nil, "", err
+	}
+	return rep.ModelInfos, rep.NextModelHandle, nil
+}
+
+// Next advances to the next model, it returns false when there are no more models or an error occurred
+func (it *ModelIterator) Next() bool {
+	it.index++
+	for it.index >= len(it.page) {
+		if it.lastPage || it.err != nil {
+			return false
+		}
+		it.err = it.client.retry(it.ctx, func() error {
+			pbModelInfos, nextModelHandle, err := it.retrievePage()
+			if err != nil {
+				return err
+			}
+			it.page = make([]ModelInfo, 0, len(pbModelInfos))
+			for _, pbModelInfo := range pbModelInfos {
+				it.page = append(it.page, createModelInfo(pbModelInfo))
+			}
+			it.index = 0
+			it.modelHandle = nextModelHandle
+			it.lastPage = len(pbModelInfos) < pageSize
+			return nil
+		})
+	}
+	return true
+}
+
+// ModelInfo is the info of the current model
+func (it *ModelIterator) ModelInfo() ModelInfo {
+	return it.page[it.index]
+}
+
+// Err is the error that stopped the iteration, if any
+func (it *ModelIterator) Err() error {
+	return it.err
+}
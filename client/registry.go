@@ -0,0 +1,334 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// ImportSummary counts what an import created
+type ImportSummary struct {
+	ModelsCount   int `json:"modelsCount"`
+	VersionsCount int `json:"versionsCount"`
+}
+
+// ExportRegistry writes a tar archive of the given models, or of every model if none is given
+//
+// The written data can't be taken back, the export isn't retried.
+func (c *Client) ExportRegistry(ctx context.Context, w io.Writer, modelIDs []string) error {
+	stream, err := c.extensions.ExportRegistry(ctx, &extensionsapi.ExportRegistryRequest{ModelIds: modelIDs})
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk.DataChunk); err != nil {
+			return fmt.Errorf("unable to write the registry archive: %w", err)
+		}
+	}
+}
+
+// ImportRegistry creates the models and versions of a tar archive produced by ExportRegistry
+//
+// The imported models must not exist, nothing is created if the import fails. It isn't retried.
+func (c *Client) ImportRegistry(ctx context.Context, r io.Reader) (ImportSummary, error) {
+	// Canceling the stream aborts the import if the archive can't be read
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.extensions.ImportRegistry(ctx)
+	if err != nil {
+		return ImportSummary{}, err
+	}
+	chunk := make([]byte, c.configuration.ChunkSize)
+	for {
+		readSize, err := io.ReadFull(r, chunk)
+		if readSize > 0 {
+			if err := stream.Send(&extensionsapi.ImportRegistryRequestChunk{DataChunk: chunk[:readSize]}); err != nil {
+				// The failure is reported by CloseAndRecv
+				break
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return ImportSummary{}, fmt.Errorf("unable to read the registry archive: %w", err)
+		}
+	}
+	rep, err := stream.CloseAndRecv()
+	if err != nil {
+		return ImportSummary{}, err
+	}
+	return ImportSummary{ModelsCount: int(rep.ModelsCount), VersionsCount: int(rep.VersionsCount)}, nil
+}
+
+// SnapshotSummary counts what a snapshot saved or loaded
+type SnapshotSummary struct {
+	Name               string `json:"name,omitempty"`
+	ModelsCount        int    `json:"modelsCount"`
+	VersionsCount      int    `json:"versionsCount"`
+	DeletedModelsCount int    `json:"deletedModelsCount,omitempty"`
+}
+
+// SaveSnapshot writes every model and version to a snapshot file in the snapshot directory of the registry, named
+// after the current time when name is empty
+//
+// It isn't retried.
+func (c *Client) SaveSnapshot(ctx context.Context, name string) (SnapshotSummary, error) {
+	rep, err := c.extensions.SaveSnapshot(ctx, &extensionsapi.SaveSnapshotRequest{Name: name})
+	if err != nil {
+		return SnapshotSummary{}, err
+	}
+	return SnapshotSummary{Name: rep.Name, ModelsCount: int(rep.ModelsCount), VersionsCount: int(rep.VersionsCount)}, nil
+}
+
+// LoadSnapshot creates the models and versions of a snapshot file of the snapshot directory of the registry, deleting
+// every model beforehand when overwrite is set
+//
+// It isn't retried.
+func (c *Client) LoadSnapshot(ctx context.Context, name string, overwrite bool) (SnapshotSummary, error) {
+	rep, err := c.extensions.LoadSnapshot(ctx, &extensionsapi.LoadSnapshotRequest{Name: name, Overwrite: overwrite})
+	if err != nil {
+		return SnapshotSummary{}, err
+	}
+	return SnapshotSummary{
+		Name:               name,
+		ModelsCount:        int(rep.ModelsCount),
+		VersionsCount:      int(rep.VersionsCount),
+		DeletedModelsCount: int(rep.DeletedModelsCount),
+	}, nil
+}
+
+// MaintenanceState describes the maintenance mode of the registry
+type MaintenanceState struct {
+	Enabled        bool      `json:"enabled"`
+	Reason         string    `json:"reason,omitempty"`
+	Since          time.Time `json:"since,omitempty"`
+	QueuedRequests int       `json:"queuedRequests"`
+}
+
+// SetMaintenance enters or leaves the maintenance mode of the registry, the mutations received in maintenance are
+// queued until it ends
+//
+// Entering it waits for the ongoing mutations to complete. It isn't retried.
+func (c *Client) SetMaintenance(ctx context.Context, enabled bool, reason string) (MaintenanceState, error) {
+	rep, err := c.extensions.SetMaintenance(ctx, &extensionsapi.SetMaintenanceRequest{Enabled: enabled, Reason: reason})
+	if err != nil {
+		return MaintenanceState{}, err
+	}
+	state := MaintenanceState{Enabled: rep.Enabled, Reason: rep.Reason, QueuedRequests: int(rep.QueuedRequests)}
+	if rep.Since > 0 {
+		state.Since = time.Unix(0, int64(rep.Since))
+	}
+	return state, nil
+}
+
+// CollectedVersion is a version deleted by a garbage collection, or that would be deleted by a dry run
+type CollectedVersion struct {
+	ModelID       string `json:"modelId"`
+	VersionNumber uint   `json:"versionNumber"`
+	DataSize      uint64 `json:"dataSize"`
+}
+
+// GarbageCollectionReport lists the versions collected by RunGarbageCollection
+type GarbageCollectionReport struct {
+	DryRun            bool               `json:"dryRun"`
+	CollectedVersions []CollectedVersion `json:"collectedVersions"`
+	ReclaimedBytes    uint64             `json:"reclaimedBytes"`
+}
+
+// RunGarbageCollection deletes the non-archived versions beyond the retention policy of their model, or only reports
+// them when dryRun is set
+//
+// It isn't retried.
+func (c *Client) RunGarbageCollection(ctx context.Context, dryRun bool) (GarbageCollectionReport, error) {
+	rep, err := c.extensions.RunGarbageCollection(ctx, &extensionsapi.RunGarbageCollectionRequest{DryRun: dryRun})
+	if err != nil {
+		return GarbageCollectionReport{}, err
+	}
+	report := GarbageCollectionReport{
+		DryRun:            rep.DryRun,
+		CollectedVersions: make([]CollectedVersion, 0, len(rep.CollectedVersions)),
+		ReclaimedBytes:    rep.ReclaimedBytes,
+	}
+	for _, collectedVersion := range rep.CollectedVersions {
+		report.CollectedVersions = append(report.CollectedVersions, CollectedVersion{
+			ModelID:       collectedVersion.ModelId,
+			VersionNumber: uint(collectedVersion.VersionNumber),
+			DataSize:      collectedVersion.DataSize,
+		})
+	}
+	return report, nil
+}
+
+// FsckProblem is an inconsistency in the numbering of the versions of a model
+type FsckProblem struct {
+	Kind          string `json:"kind"`
+	ModelID       string `json:"modelId"`
+	VersionNumber uint   `json:"versionNumber"`
+	Description   string `json:"description"`
+	Repaired      bool   `json:"repaired"`
+}
+
+// FsckReport lists the problems found by RunFsck
+type FsckReport struct {
+	CheckedModels   int           `json:"checkedModels"`
+	CheckedVersions int           `json:"checkedVersions"`
+	Problems        []FsckProblem `json:"problems"`
+}
+
+// RunFsck checks the numbering of the versions of the given models, or of every model if none is given, and repairs
+// the duplicated, mismatched and stale version numbers when repair is set
+//
+// It isn't retried.
+func (c *Client) RunFsck(ctx context.Context, repair bool, modelIDs ...string) (FsckReport, error) {
+	rep, err := c.extensions.RunFsck(ctx, &extensionsapi.RunFsckRequest{Repair: repair, ModelIds: modelIDs})
+	if err != nil {
+		return FsckReport{}, err
+	}
+	report := FsckReport{
+		CheckedModels:   int(rep.CheckedModels),
+		CheckedVersions: int(rep.CheckedVersions),
+		Problems:        make([]FsckProblem, 0, len(rep.Problems)),
+	}
+	for _, problem := range rep.Problems {
+		report.Problems = append(report.Problems, FsckProblem{
+			Kind:          problem.Kind,
+			ModelID:       problem.ModelId,
+			VersionNumber: uint(problem.VersionNumber),
+			Description:   problem.Description,
+			Repaired:      problem.Repaired,
+		})
+	}
+	return report, nil
+}
+
+// RegistryEventType is the kind of change notified by WatchRegistry
+type RegistryEventType string
+
+const (
+	ModelCreated   RegistryEventType = "model_created"
+	ModelUpdated   RegistryEventType = "model_updated"
+	ModelDeleted   RegistryEventType = "model_deleted"
+	VersionCreated RegistryEventType = "version_created"
+	VersionUpdated RegistryEventType = "version_updated" // The version was archived or unarchived
+	VersionDeleted RegistryEventType = "version_deleted"
+)
+
+// RegistryEvent is a change made to a model or to a version, ModelInfo is defined for the model events and VersionInfo
+// for the version events
+type RegistryEvent struct {
+	Type        RegistryEventType
+	ModelInfo   ModelInfo
+	VersionInfo VersionInfo
+}
+
+// RegistryWatcher receives the changes made to the registry, one at a time
+type RegistryWatcher struct {
+	stream extensionsapi.ModelRegistryExtensionsSP_WatchRegistryClient
+	event  RegistryEvent
+	err    error
+}
+
+// WatchRegistry watches every change made to the models and versions, the watch is active once it returns
+//
+// The watch ends when the context is done. A watch failing with RESOURCE_EXHAUSTED didn't keep up and missed changes.
+func (c *Client) WatchRegistry(ctx context.Context) (*RegistryWatcher, error) {
+	watcher := &RegistryWatcher{}
+	err := c.retry(ctx, func() error {
+		stream, err := c.extensions.WatchRegistry(ctx, &extensionsapi.WatchRegistryRequest{})
+		if err != nil {
+			return err
+		}
+		if _, err := stream.Header(); err != nil {
+			return err
+		}
+		watcher.stream = stream
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return watcher, nil
+}
+
+func createRegistryEvent(rep *extensionsapi.WatchRegistryReply) RegistryEvent {
+	if modelEvent := rep.GetModelEvent(); modelEvent != nil {
+		event := RegistryEvent{ModelInfo: ModelInfo{ModelID: modelEvent.ModelInfo.GetModelId(), Description: modelEvent.ModelInfo.GetUserData()[descriptionUserDataKey], UserData: modelEvent.ModelInfo.GetUserData()}}
+		switch modelEvent.EventType {
+		case extensionsapi.ModelEventType_MODEL_CREATED:
+			event.Type = ModelCreated
+		case extensionsapi.ModelEventType_MODEL_UPDATED:
+			event.Type = ModelUpdated
+		case extensionsapi.ModelEventType_MODEL_DELETED:
+			event.Type = ModelDeleted
+		}
+		return event
+	}
+	versionEvent := rep.GetVersionEvent()
+	if versionEvent.GetVersionInfo() == nil {
+		return RegistryEvent{}
+	}
+	event := RegistryEvent{VersionInfo: createVersionInfo(versionEvent.GetVersionInfo())}
+	switch versionEvent.GetEventType() {
+	case extensionsapi.VersionEventType_VERSION_CREATED:
+		event.Type = VersionCreated
+	case extensionsapi.VersionEventType_VERSION_UPDATED:
+		event.Type = VersionUpdated
+	case extensionsapi.VersionEventType_VERSION_DELETED:
+		event.Type = VersionDeleted
+	}
+	return event
+}
+
+// Next waits for the next change, it returns false when the watch ended
+func (w *RegistryWatcher) Next() bool {
+	if w.err != nil {
+		return false
+	}
+	for {
+		rep, err := w.stream.Recv()
+		if err != nil {
+			w.err = err
+			return false
+		}
+		w.event = createRegistryEvent(rep)
+		// Events unknown to this client are skipped
+		if w.event.Type != "" {
+			return true
+		}
+	}
+}
+
+// Event is the current change
+func (w *RegistryWatcher) Event() RegistryEvent {
+	return w.event
+}
+
+// Err is the error that ended the watch
+func (w *RegistryWatcher) Err() error {
+	return w.err
+}
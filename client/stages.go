@@ -0,0 +1,117 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// VersionStage is the stage of a version in its lifecycle, none -> staging -> production -> retired
+type VersionStage string
+
+const (
+	NoStage    VersionStage = "none"
+	Staging    VersionStage = "staging"
+	Production VersionStage = "production"
+	Retired    VersionStage = "retired"
+)
+
+var pbVersionStages = map[VersionStage]extensionsapi.VersionStage{
+	NoStage:    extensionsapi.VersionStage_NO_STAGE,
+	Staging:    extensionsapi.VersionStage_STAGING,
+	Production: extensionsapi.VersionStage_PRODUCTION,
+	Retired:    extensionsapi.VersionStage_RETIRED,
+}
+
+func createVersionStage(pbStage extensionsapi.VersionStage) VersionStage {
+	for stage, pbVersionStage := range pbVersionStages {
+		if pbVersionStage == pbStage {
+			return stage
+		}
+	}
+	return NoStage
+}
+
+type VersionStageTransition struct {
+	Stage     VersionStage `json:"stage"`
+	Timestamp time.Time    `json:"timestamp"`
+	Comment   string       `json:"comment,omitempty"`
+}
+
+// VersionStageInfo is the stage of a version and the history of its transitions, the last one being its current stage
+type VersionStageInfo struct {
+	VersionInfo           VersionInfo              `json:"versionInfo"`
+	Stage                 VersionStage             `json:"stage"`
+	History               []VersionStageTransition `json:"history"`
+	RetiredVersionNumbers []uint                   `json:"retiredVersionNumbers,omitempty"` // Versions replaced by a transition
+}
+
+func createVersionStageHistory(pbHistory []*extensionsapi.VersionStageTransition) []VersionStageTransition {
+	history := []VersionStageTransition{}
+	for _, pbTransition := range pbHistory {
+		history = append(history, VersionStageTransition{
+			Stage:     createVersionStage(pbTransition.Stage),
+			Timestamp: time.Unix(0, int64(pbTransition.Timestamp)),
+			Comment:   pbTransition.Comment,
+		})
+	}
+	return history
+}
+
+// TransitionVersionStage moves a version, or the n-th to last version with -n, to the next stage or retires it, the
+// version previously in staging or production is retired
+//
+// A transition isn't idempotent, it isn't retried.
+func (c *Client) TransitionVersionStage(ctx context.Context, modelID string, versionNumber int, stage VersionStage, comment string) (VersionStageInfo, error) {
+	pbStage, ok := pbVersionStages[stage]
+	if !ok {
+		return VersionStageInfo{}, fmt.Errorf("unknown stage %q", stage)
+	}
+	rep, err := c.extensions.TransitionVersionStage(ctx, &extensionsapi.TransitionVersionStageRequest{ModelId: modelID, VersionNumber: int32(versionNumber), Stage: pbStage, Comment: comment})
+	if err != nil {
+		return VersionStageInfo{}, err
+	}
+	stageInfo := VersionStageInfo{
+		VersionInfo: createVersionInfo(rep.VersionInfo),
+		Stage:       stage,
+		History:     createVersionStageHistory(rep.History),
+	}
+	for _, retiredVersionNumber := range rep.RetiredVersionNumbers {
+		stageInfo.RetiredVersionNumbers = append(stageInfo.RetiredVersionNumbers, uint(retiredVersionNumber))
+	}
+	return stageInfo, nil
+}
+
+// RetrieveVersionStage retrieves the stage of a version, or of the n-th to last version with -n, and its history
+func (c *Client) RetrieveVersionStage(ctx context.Context, modelID string, versionNumber int) (VersionStageInfo, error) {
+	stageInfo := VersionStageInfo{}
+	err := c.retry(ctx, func() error {
+		rep, err := c.extensions.RetrieveVersionStage(ctx, &extensionsapi.RetrieveVersionStageRequest{ModelId: modelID, VersionNumber: int32(versionNumber)})
+		if err != nil {
+			return err
+		}
+		stageInfo = VersionStageInfo{
+			VersionInfo: createVersionInfo(rep.VersionInfo),
+			Stage:       createVersionStage(rep.Stage),
+			History:     createVersionStageHistory(rep.History),
+		}
+		return nil
+	})
+	return stageInfo, err
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fake"
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+	"github.com/cogment/cogment-model-registry/server"
+)
+
+// Size of the in-memory buffer of the connections to the server
+const bufferSize = 1024 * 1024
+
+// TB is the subset of testing.TB used to stop the server and close the clients at the end of a test
+type TB interface {
+	Helper()
+	Cleanup(func())
+	Fatalf(format string, args ...interface{})
+}
+
+// Server is an in-process model registry serving its API over an in-memory listener
+type Server struct {
+	Backend  backend.Backend
+	listener *bufconn.Listener
+	registry *server.Registry
+}
+
+// StartServer starts a model registry on top of the given backend, a fake backend when nil
+func StartServer(b backend.Backend) (*Server, error) {
+	if b == nil {
+		b = fake.CreateBackend()
+	}
+	registry, err := server.CreateRegistry(server.Configuration{
+		Backend: b,
+		ModelRegistry: grpcservers.ModelRegistryServerConfiguration{
+			SentModelVersionDataChunkSize: client.DefaultChunkSize,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the model registry: %w", err)
+	}
+	listener := bufconn.Listen(bufferSize)
+	go func() {
+		_ = registry.Serve(listener)
+	}()
+	return &Server{Backend: b, listener: listener, registry: registry}, nil
+}
+
+// Dial opens a connection to the server, it can be used as the dialer of clients or gRPC connections
+func (s *Server) Dial(context.Context, string) (net.Conn, error) {
+	return s.listener.Dial()
+}
+
+// CreateClient creates a client connected to the server, the address and the dialer of the configuration are overridden
+func (s *Server) CreateClient(ctx context.Context, configuration client.Configuration) (*client.Client, error) {
+	configuration.Address = "bufnet"
+	configuration.Dialer = s.Dial
+	return client.CreateClient(ctx, configuration)
+}
+
+// Stop stops the server, closing the connections of its clients
+func (s *Server) Stop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	// Canceling the in-flight calls right away
+	cancel()
+	_ = s.registry.Shutdown(ctx)
+}
+
+// CreateClient starts a server on top of the given backend, a fake backend when nil, and returns a client connected
+// to it, both are stopped at the end of the test
+func CreateClient(t TB, b backend.Backend) *client.Client {
+	t.Helper()
+	s, err := StartServer(b)
+	if err != nil {
+		t.Fatalf("unable to start the model registry: %v", err)
+	}
+	t.Cleanup(s.Stop)
+	c, err := s.CreateClient(context.Background(), client.Configuration{})
+	if err != nil {
+		t.Fatalf("unable to connect to the model registry: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend/fake"
+	"github.com/cogment/cogment-model-registry/client"
+	registrytesting "github.com/cogment/cogment-model-registry/client/testing"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+func TestCreateClient(t *testing.T) {
+	c := registrytesting.CreateClient(t, nil)
+	ctx := context.Background()
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, client.ModelInfo{ModelID: "foo"}))
+	versionInfo, err := c.CreateVersion(ctx, "foo", client.VersionArgs{UserData: map[string]string{"step": "1"}}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+
+	retrievedData := bytes.Buffer{}
+	_, err = c.RetrieveVersionData(ctx, "foo", -1, &retrievedData, true)
+	assert.NoError(t, err)
+	assert.Equal(t, data, retrievedData.Bytes())
+
+	_, err = c.RetrieveVersionInfo(ctx, "bar", 1)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestFakeBackendErrors(t *testing.T) {
+	b := fake.CreateBackend()
+	c := registrytesting.CreateClient(t, b)
+	ctx := context.Background()
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, client.ModelInfo{ModelID: "foo"}))
+	_, err := c.CreateVersion(ctx, "foo", client.VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	b.SetError("RetrieveModelVersionInfo", errors.New("disk failure"))
+	_, err = c.RetrieveVersionInfo(ctx, "foo", 1)
+	assert.Error(t, err)
+	assert.Equal(t, 1, b.Calls("RetrieveModelVersionInfo"))
+
+	b.SetError("RetrieveModelVersionInfo", nil)
+	versionInfo, err := c.RetrieveVersionInfo(ctx, "foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+}
+
+func TestServer(t *testing.T) {
+	s, err := registrytesting.StartServer(nil)
+	assert.NoError(t, err)
+	defer s.Stop()
+	ctx := context.Background()
+	c, err := s.CreateClient(ctx, client.Configuration{ChunkSize: 8})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, client.ModelInfo{ModelID: "foo"}))
+	_, err = c.CreateVersion(ctx, "foo", client.VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	// The versions created through the client are stored in the server's backend
+	storedData, err := s.Backend.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, data, storedData)
+}
@@ -0,0 +1,577 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// Metadata key requesting the server to verify the retrieved data against its hash
+const verifyDataHashMetadataKey = "cogment-model-registry-verify-data-hash"
+
+// Metadata key asking the server for a size of the data chunks it sends
+const preferredChunkSizeMetadataKey = "cogment-model-registry-preferred-chunk-size"
+
+// Metadata key asking the server to resolve an alias instead of the requested version numbers
+const versionAliasMetadataKey = "cogment-model-registry-version-alias"
+
+// Metadata key providing the hash of the data the client already has, the server doesn't send it again if unchanged
+const knownDataHashMetadataKey = "cogment-model-registry-known-data-hash"
+
+// Header metadata key set by the server when the data matches the known hash and isn't sent
+const notModifiedMetadataKey = "cogment-model-registry-not-modified"
+
+// User data key holding the description of a model or version
+const descriptionUserDataKey = "cogment_model_registry.description"
+
+// Version user data key set by the server on the locked versions
+const lockedUserDataKey = "cogment_model_registry.locked"
+
+// withDescription copies user data with its description entry set, unless the description is empty
+func withDescription(userData map[string]string, description string) map[string]string {
+	if description == "" {
+		return userData
+	}
+	userDataWithDescription := make(map[string]string, len(userData)+1)
+	for key, value := range userData {
+		userDataWithDescription[key] = value
+	}
+	userDataWithDescription[descriptionUserDataKey] = description
+	return userDataWithDescription
+}
+
+type VersionInfo struct {
+	ModelID           string             `json:"modelId"`
+	VersionNumber     uint               `json:"versionNumber"`
+	CreationTimestamp time.Time          `json:"creationTimestamp"`
+	Archived          bool               `json:"archived"`
+	Locked            bool               `json:"locked,omitempty"` // Locked versions can't be deleted or changed until unlocked
+	DataHash          string             `json:"dataHash"`
+	DataSize          uint64             `json:"dataSize"`
+	Description       string             `json:"description,omitempty"`  // Stored in the user data
+	Metrics           map[string]float64 `json:"metrics,omitempty"`      // Stored in the user data
+	Lineage           *VersionLineage    `json:"lineage,omitempty"`      // Stored in the user data, nil if the version has none
+	Manifest          *VersionManifest   `json:"manifest,omitempty"`     // Stored in the user data, nil if the version has none
+	Dependencies      []VersionReference `json:"dependencies,omitempty"` // Stored in the user data, nil if the version has none
+	Artifacts         []Artifact         `json:"artifacts,omitempty"`    // Stored in the user data, nil if the version has none
+	UserData          map[string]string  `json:"userData,omitempty"`
+}
+
+type VersionArgs struct {
+	CreationTimestamp time.Time // The time of the creation by the server when zero
+	Archived          bool
+	DataHash          string             // The SHA-256 hash of the data is computed when empty, the server checks the data against it
+	Description       string             // Stored in the user data, overrides its description entry when not empty
+	Metrics           map[string]float64 // Stored in the user data, e.g. evaluation scores
+	Lineage           *VersionLineage    // Stored in the user data, the parent version needs to exist
+	Manifest          *VersionManifest   // Stored in the user data, validated by the server
+	Dependencies      []VersionReference // Stored in the user data, the versions need to exist
+	UserData          map[string]string
+}
+
+// VersionInfoUpdate describes the changes UpdateVersionInfo makes to a version
+type VersionInfoUpdate struct {
+	Description         string // New description, unchanged when empty
+	ClearDescription    bool
+	UserData            map[string]string // Entries added or replaced
+	RemovedUserDataKeys []string
+	Metrics             map[string]float64 // Metrics added or replaced
+	RemovedMetricNames  []string
+	Archived            *bool  // Archives or unarchives the version when defined
+	ExpectedETag        string // When defined, the update fails with ABORTED if the version changed since this etag was returned
+}
+
+// versionUserData is the user data of a created version, along with the entries of its typed fields
+func versionUserData(versionArgs VersionArgs) map[string]string {
+	userData := withDescription(versionArgs.UserData, versionArgs.Description)
+	userData = withMetrics(userData, versionArgs.Metrics)
+	userData = withLineage(userData, versionArgs.Lineage)
+	userData = withManifest(userData, versionArgs.Manifest)
+	return withDependencies(userData, versionArgs.Dependencies)
+}
+
+func createVersionInfo(pbVersionInfo *grpcapi.ModelVersionInfo) VersionInfo {
+	return VersionInfo{
+		ModelID:           pbVersionInfo.ModelId,
+		VersionNumber:     uint(pbVersionInfo.VersionNumber),
+		CreationTimestamp: time.Unix(0, int64(pbVersionInfo.CreationTimestamp)),
+		Archived:          pbVersionInfo.Archived,
+		Locked:            pbVersionInfo.UserData[lockedUserDataKey] != "",
+		DataHash:          pbVersionInfo.DataHash,
+		DataSize:          pbVersionInfo.DataSize,
+		Description:       pbVersionInfo.UserData[descriptionUserDataKey],
+		Metrics:           parseMetrics(pbVersionInfo.UserData),
+		Lineage:           parseLineage(pbVersionInfo.ModelId, pbVersionInfo.UserData),
+		Manifest:          parseManifest(pbVersionInfo.UserData),
+		Dependencies:      parseDependencies(pbVersionInfo.UserData),
+		Artifacts:         parseArtifacts(pbVersionInfo.UserData),
+		UserData:          pbVersionInfo.UserData,
+	}
+}
+
+// measureData computes the size and the SHA-256 hash of some data, formatted as the model registry does, and rewinds it
+func measureData(data io.ReadSeeker) (uint64, string, error) {
+	hash := sha256.New()
+	dataSize, err := io.Copy(hash, data)
+	if err != nil {
+		return 0, "", err
+	}
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+	return uint64(dataSize), base64.StdEncoding.EncodeToString(hash.Sum(nil)), nil
+}
+
+// CreateVersion creates a version of a model from the data read from its current position, sending it in chunks
+//
+// Creating a version isn't idempotent, it isn't retried.
+func (c *Client) CreateVersion(ctx context.Context, modelID string, versionArgs VersionArgs, data io.ReadSeeker) (VersionInfo, error) {
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return VersionInfo{}, fmt.Errorf("unable to read the data of the version: %w", err)
+	}
+	dataSize, dataHash, err := measureData(data)
+	if err != nil {
+		return VersionInfo{}, fmt.Errorf("unable to read the data of the version: %w", err)
+	}
+	if versionArgs.DataHash != "" {
+		dataHash = versionArgs.DataHash
+	}
+	creationTimestamp := uint64(0)
+	if !versionArgs.CreationTimestamp.IsZero() {
+		creationTimestamp = uint64(versionArgs.CreationTimestamp.UnixNano())
+	}
+
+	stream, err := c.registry.CreateVersion(ctx)
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	header := &grpcapi.CreateVersionRequestChunk_Header{
+		VersionInfo: &grpcapi.ModelVersionInfo{
+			ModelId:           modelID,
+			CreationTimestamp: creationTimestamp,
+			Archived:          versionArgs.Archived,
+			DataHash:          dataHash,
+			DataSize:          dataSize,
+			UserData:          versionUserData(versionArgs),
+		},
+	}
+	// A failed send is reported by CloseAndRecv
+	if err := stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Header_{Header: header}}); err == nil {
+		if err := c.sendData(stream, data); err != nil {
+			return VersionInfo{}, fmt.Errorf("unable to read the data of the version: %w", err)
+		}
+	}
+	rep, err := stream.CloseAndRecv()
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	return createVersionInfo(rep.VersionInfo), nil
+}
+
+// sendData sends data as body chunks until it is read or a chunk can't be sent
+func (c *Client) sendData(stream grpcapi.ModelRegistrySP_CreateVersionClient, data io.Reader) error {
+	chunk := make([]byte, c.configuration.ChunkSize)
+	for {
+		readSize, err := io.ReadFull(data, chunk)
+		if readSize > 0 {
+			if err := stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{DataChunk: chunk[:readSize]}}}); err != nil {
+				return nil
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// RetrieveVersionInfo retrieves the info of a version, or of the n-th to last version with -n
+func (c *Client) RetrieveVersionInfo(ctx context.Context, modelID string, versionNumber int) (VersionInfo, error) {
+	versionInfo := VersionInfo{}
+	err := c.retry(ctx, func() error {
+		rep, err := c.registry.RetrieveVersionInfos(ctx, &grpcapi.RetrieveVersionInfosRequest{ModelId: modelID, VersionNumbers: []int32{int32(versionNumber)}})
+		if err != nil {
+			return err
+		}
+		if len(rep.VersionInfos) == 0 {
+			return reasonError(codes.NotFound, extensionsapi.ErrorReason_VERSION_NOT_FOUND, map[string]string{
+				"model_id":       modelID,
+				"version_number": strconv.Itoa(versionNumber),
+			}, "unable to retrieve version \"%d\" of model %q", versionNumber, modelID)
+		}
+		versionInfo = createVersionInfo(rep.VersionInfos[0])
+		return nil
+	})
+	return versionInfo, err
+}
+
+// RetrieveVersionInfoByAlias retrieves the info of the version an alias of a model points at, "latest" being the
+// latest version
+func (c *Client) RetrieveVersionInfoByAlias(ctx context.Context, modelID string, alias string) (VersionInfo, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, versionAliasMetadataKey, alias)
+	versionInfo := VersionInfo{}
+	err := c.retry(ctx, func() error {
+		rep, err := c.registry.RetrieveVersionInfos(ctx, &grpcapi.RetrieveVersionInfosRequest{ModelId: modelID})
+		if err != nil {
+			return err
+		}
+		if len(rep.VersionInfos) == 0 {
+			return status.Errorf(codes.NotFound, "unable to retrieve alias %q of model %q", alias, modelID)
+		}
+		versionInfo = createVersionInfo(rep.VersionInfos[0])
+		return nil
+	})
+	return versionInfo, err
+}
+
+// UpdateVersionInfo changes the description, metrics, user data and archival status of a version, or of the current n-th to
+// last version with -n, and returns its updated info along with its etag. An update without changes retrieves them.
+//
+// Updating the n-th to last version or checking an etag isn't idempotent, these updates are not retried.
+func (c *Client) UpdateVersionInfo(ctx context.Context, modelID string, versionNumber int, update VersionInfoUpdate) (VersionInfo, string, error) {
+	versionInfo := VersionInfo{}
+	etag := ""
+	req := &extensionsapi.UpdateVersionInfoRequest{
+		ModelId:             modelID,
+		VersionNumber:       int32(versionNumber),
+		Description:         update.Description,
+		ClearDescription:    update.ClearDescription,
+		UserData:            update.UserData,
+		RemovedUserDataKeys: update.RemovedUserDataKeys,
+		Metrics:             update.Metrics,
+		RemovedMetricNames:  update.RemovedMetricNames,
+		ExpectedEtag:        update.ExpectedETag,
+	}
+	if update.Archived != nil {
+		req.Archive = *update.Archived
+		req.Unarchive = !*update.Archived
+	}
+	updateVersionInfo := func() error {
+		rep, err := c.extensions.UpdateVersionInfo(ctx, req)
+		if err != nil {
+			return err
+		}
+		versionInfo = createVersionInfo(rep.VersionInfo)
+		etag = rep.Etag
+		return nil
+	}
+	if versionNumber < 0 || update.ExpectedETag != "" {
+		return versionInfo, etag, updateVersionInfo()
+	}
+	return versionInfo, etag, c.retry(ctx, updateVersionInfo)
+}
+
+// SetVersionAlias points an alias of a model at a version, or at the current n-th to last version with -n, 0 removes
+// the alias
+//
+// Setting an alias isn't idempotent when targeting the n-th to last version, it is then not retried.
+func (c *Client) SetVersionAlias(ctx context.Context, modelID string, alias string, versionNumber int) (VersionInfo, error) {
+	versionInfo := VersionInfo{}
+	setVersionAlias := func() error {
+		rep, err := c.extensions.SetVersionAlias(ctx, &extensionsapi.SetVersionAliasRequest{ModelId: modelID, Alias: alias, VersionNumber: int32(versionNumber)})
+		if err != nil {
+			return err
+		}
+		if rep.VersionInfo != nil {
+			versionInfo = createVersionInfo(rep.VersionInfo)
+		}
+		return nil
+	}
+	if versionNumber < 0 {
+		return versionInfo, setVersionAlias()
+	}
+	return versionInfo, c.retry(ctx, setVersionAlias)
+}
+
+// RetrieveVersionData streams the data of a version, or of the n-th to last version with -n, to a writer
+//
+// The retrieval is retried as long as no data was written. When verify is set the server checks the data
+// against the hash of the version before sending it.
+func (c *Client) RetrieveVersionData(ctx context.Context, modelID string, versionNumber int, w io.Writer, verify bool) (int64, error) {
+	writtenSize, _, err := c.retrieveVersionData(ctx, modelID, versionNumber, "", w, verify)
+	return writtenSize, err
+}
+
+// RetrieveVersionDataIfModified streams the data of a version to a writer like RetrieveVersionData, unless it matches
+// knownDataHash, e.g. the hash of the data retrieved by a previous call, and returns whether the data was retrieved
+func (c *Client) RetrieveVersionDataIfModified(ctx context.Context, modelID string, versionNumber int, knownDataHash string, w io.Writer, verify bool) (int64, bool, error) {
+	return c.retrieveVersionData(ctx, modelID, versionNumber, knownDataHash, w, verify)
+}
+
+// RetrieveLatestVersionIfChanged streams the data of the latest version of a model to a writer and returns its info,
+// only if its number is greater than knownVersionNumber and its data hash differs from knownDataHash, both optional
+//
+// The returned boolean is false when the latest version didn't change, the returned info is then the one of the
+// latest version and nothing is written. The retrieval is retried as long as no data was written.
+func (c *Client) RetrieveLatestVersionIfChanged(ctx context.Context, modelID string, knownVersionNumber uint, knownDataHash string, w io.Writer) (VersionInfo, bool, error) {
+	versionInfo := VersionInfo{}
+	changed := false
+	writtenSize := int64(0)
+	err := c.retry(ctx, func() error {
+		stream, err := c.extensions.RetrieveLatestVersionDataIfChanged(ctx, &extensionsapi.RetrieveLatestVersionDataIfChangedRequest{
+			ModelId:            modelID,
+			KnownVersionNumber: uint32(knownVersionNumber),
+			KnownDataHash:      knownDataHash,
+			PreferredChunkSize: uint32(c.configuration.ReceivedChunkSize),
+		})
+		if err != nil {
+			return err
+		}
+		chunk, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		header := chunk.GetHeader()
+		if header == nil {
+			return status.Errorf(codes.Internal, "unexpected first message retrieving the latest version of model %q, expecting a header", modelID)
+		}
+		versionInfo = createVersionInfo(header.VersionInfo)
+		changed = !header.NotModified
+		if !changed {
+			return nil
+		}
+		retrieved := fmt.Sprintf("version \"%d\" of model %q", versionInfo.VersionNumber, modelID)
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				if writtenSize > 0 {
+					// The written data can't be taken back, the retrieval can't be retried
+					return status.Errorf(codes.Aborted, "retrieval of %s interrupted after %d bytes: %s", retrieved, writtenSize, status.Convert(err).Message())
+				}
+				return err
+			}
+			chunkSize, err := w.Write(chunk.GetBody().GetDataChunk())
+			writtenSize += int64(chunkSize)
+			if err != nil {
+				return fmt.Errorf("unable to write the data of %s: %w", retrieved, err)
+			}
+		}
+	})
+	return versionInfo, changed, err
+}
+
+func (c *Client) retrieveVersionData(ctx context.Context, modelID string, versionNumber int, knownDataHash string, w io.Writer, verify bool) (int64, bool, error) {
+	if verify {
+		ctx = metadata.AppendToOutgoingContext(ctx, verifyDataHashMetadataKey, "true")
+	}
+	if c.configuration.ReceivedChunkSize > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, preferredChunkSizeMetadataKey, strconv.Itoa(c.configuration.ReceivedChunkSize))
+	}
+	if knownDataHash != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, knownDataHashMetadataKey, knownDataHash)
+	}
+	writtenSize := int64(0)
+	modified := true
+	err := c.retry(ctx, func() error {
+		stream, err := c.registry.RetrieveVersionData(ctx, &grpcapi.RetrieveVersionDataRequest{ModelId: modelID, VersionNumber: int32(versionNumber)})
+		if err != nil {
+			return err
+		}
+		if err := receiveData(stream, w, &writtenSize, fmt.Sprintf("version \"%d\" of model %q", versionNumber, modelID)); err != nil {
+			return err
+		}
+		header, err := stream.Header()
+		if err != nil {
+			return err
+		}
+		modified = len(header.Get(notModifiedMetadataKey)) == 0
+		return nil
+	})
+	return writtenSize, modified, err
+}
+
+// RetrieveVersionDataURL retrieves a URL the data of a version, or of the n-th to last version with -n, can be
+// downloaded from directly until the returned time, along with the info of the version to check the data against
+//
+// The URL is empty when the server doesn't provide one, RetrieveVersionData must then be used. The server caps the
+// expiration, 0 requests its longest one.
+func (c *Client) RetrieveVersionDataURL(ctx context.Context, modelID string, versionNumber int, expiration time.Duration) (VersionInfo, string, time.Time, error) {
+	versionInfo := VersionInfo{}
+	url := ""
+	expirationTime := time.Time{}
+	err := c.retry(ctx, func() error {
+		rep, err := c.extensions.RetrieveVersionDataURL(ctx, &extensionsapi.RetrieveVersionDataURLRequest{
+			ModelId:           modelID,
+			VersionNumber:     int32(versionNumber),
+			ExpirationSeconds: uint64(expiration / time.Second),
+		})
+		if err != nil {
+			return err
+		}
+		versionInfo = createVersionInfo(rep.VersionInfo)
+		url = rep.Url
+		if url != "" {
+			expirationTime = time.Unix(0, int64(rep.ExpirationTimestamp))
+		}
+		return nil
+	})
+	return versionInfo, url, expirationTime, err
+}
+
+// versionDataChunkReceiver is implemented by the streams receiving the data of a version
+type versionDataChunkReceiver interface {
+	Recv() (*grpcapi.RetrieveVersionDataReplyChunk, error)
+}
+
+// receiveData writes the received chunks to a writer until the stream ends, counting the written bytes in writtenSize
+func receiveData(stream versionDataChunkReceiver, w io.Writer, writtenSize *int64, retrieved string) error {
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if *writtenSize > 0 {
+				// The written data can't be taken back, the retrieval can't be retried
+				return status.Errorf(codes.Aborted, "retrieval of %s interrupted after %d bytes: %s", retrieved, *writtenSize, status.Convert(err).Message())
+			}
+			return err
+		}
+		chunkSize, err := w.Write(chunk.DataChunk)
+		*writtenSize += int64(chunkSize)
+		if err != nil {
+			return fmt.Errorf("unable to write the data of %s: %w", retrieved, err)
+		}
+	}
+}
+
+// DeleteVersion deletes a version, or the n-th to last version with -n, archived versions are only deleted when forced
+//
+// Deleting a version isn't idempotent when targeting the n-th to last version, it isn't retried.
+func (c *Client) DeleteVersion(ctx context.Context, modelID string, versionNumber int, force bool) (VersionInfo, error) {
+	rep, err := c.extensions.DeleteVersion(ctx, &extensionsapi.DeleteVersionRequest{ModelId: modelID, VersionNumber: int32(versionNumber), Force: force})
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	return createVersionInfo(rep.VersionInfo), nil
+}
+
+// DeleteVersionWithDependents deletes a version along with the versions depending on it, directly or not, which are
+// returned in the order they were deleted. It requires the delete scope on every model.
+func (c *Client) DeleteVersionWithDependents(ctx context.Context, modelID string, versionNumber int, force bool) (VersionInfo, []VersionInfo, error) {
+	rep, err := c.extensions.DeleteVersion(ctx, &extensionsapi.DeleteVersionRequest{ModelId: modelID, VersionNumber: int32(versionNumber), Force: force, Cascade: true})
+	if err != nil {
+		return VersionInfo{}, nil, err
+	}
+	deletedDependents := make([]VersionInfo, 0, len(rep.DeletedDependents))
+	for _, pbVersionInfo := range rep.DeletedDependents {
+		deletedDependents = append(deletedDependents, createVersionInfo(pbVersionInfo))
+	}
+	return createVersionInfo(rep.VersionInfo), deletedDependents, nil
+}
+
+// LockVersion locks a version, or the n-th to last version with -n, it can't be deleted or changed until unlocked
+func (c *Client) LockVersion(ctx context.Context, modelID string, versionNumber int) (VersionInfo, error) {
+	versionInfo := VersionInfo{}
+	lockVersion := func() error {
+		rep, err := c.extensions.LockVersion(ctx, &extensionsapi.LockVersionRequest{ModelId: modelID, VersionNumber: int32(versionNumber)})
+		if err != nil {
+			return err
+		}
+		versionInfo = createVersionInfo(rep.VersionInfo)
+		return nil
+	}
+	if versionNumber < 0 {
+		return versionInfo, lockVersion()
+	}
+	return versionInfo, c.retry(ctx, lockVersion)
+}
+
+// UnlockVersion unlocks a version, or the n-th to last version with -n, it requires the admin scope
+func (c *Client) UnlockVersion(ctx context.Context, modelID string, versionNumber int) (VersionInfo, error) {
+	versionInfo := VersionInfo{}
+	unlockVersion := func() error {
+		rep, err := c.extensions.UnlockVersion(ctx, &extensionsapi.UnlockVersionRequest{ModelId: modelID, VersionNumber: int32(versionNumber)})
+		if err != nil {
+			return err
+		}
+		versionInfo = createVersionInfo(rep.VersionInfo)
+		return nil
+	}
+	if versionNumber < 0 {
+		return versionInfo, unlockVersion()
+	}
+	return versionInfo, c.retry(ctx, unlockVersion)
+}
+
+// VersionIterator iterates over the versions of a model, retrieving them page by page
+type VersionIterator struct {
+	ctx           context.Context
+	client        *Client
+	modelID       string
+	page          []VersionInfo
+	index         int // Index of the current version in the page
+	versionHandle string
+	lastPage      bool
+	err           error
+}
+
+// Versions creates an iterator over the versions of a model, by increasing version number
+func (c *Client) Versions(ctx context.Context, modelID string) *VersionIterator {
+	return &VersionIterator{ctx: ctx, client: c, modelID: modelID, index: -1}
+}
+
+// Next advances to the next version, it returns false when there are no more versions or an error occurred
+func (it *VersionIterator) Next() bool {
+	it.index++
+	for it.index >= len(it.page) {
+		if it.lastPage || it.err != nil {
+			return false
+		}
+		it.err = it.client.retry(it.ctx, func() error {
+			rep, err := it.client.registry.RetrieveVersionInfos(it.ctx, &grpcapi.RetrieveVersionInfosRequest{ModelId: it.modelID, VersionsCount: pageSize, VersionHandle: it.versionHandle})
+			if err != nil {
+				return err
+			}
+			it.page = make([]VersionInfo, 0, len(rep.VersionInfos))
+			for _, pbVersionInfo := range rep.VersionInfos {
+				it.page = append(it.page, createVersionInfo(pbVersionInfo))
+			}
+			it.index = 0
+			it.versionHandle = rep.NextVersionHandle
+			it.lastPage = len(rep.VersionInfos) < pageSize
+			return nil
+		})
+	}
+	return true
+}
+
+// VersionInfo is the info of the current version
+func (it *VersionIterator) VersionInfo() VersionInfo {
+	return it.page[it.index]
+}
+
+// Err is the error that stopped the iteration, if any
+func (it *VersionIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,294 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configuration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/memoryCache"
+)
+
+// EnvPrefix is the prefix of the environment variables defining the settings, e.g. `COGMENT_MODEL_REGISTRY_PORT`
+const EnvPrefix = "COGMENT_MODEL_REGISTRY"
+
+// FileEnvVar is the environment variable defining the configuration file
+const FileEnvVar = EnvPrefix + "_CONFIG_FILE"
+
+// defaults defines every setting of the server with its default value, the type of the default is the type of the setting
+var defaults = map[string]interface{}{
+	"PORT":                                   9000,
+	"ARCHIVE_BACKEND":                        "fs",
+	"ARCHIVE_URI":                            "",
+	"ARCHIVE_DIR":                            ".cogment_model_registry",
+	"S3_ENDPOINT":                            "s3.amazonaws.com",
+	"S3_BUCKET":                              "",
+	"S3_PREFIX":                              "",
+	"S3_REGION":                              "",
+	"S3_ACCESS_KEY_ID":                       "",
+	"S3_SECRET_ACCESS_KEY":                   "",
+	"S3_USE_SSL":                             true,
+	"GCS_BUCKET":                             "",
+	"GCS_PREFIX":                             "",
+	"GCS_CREDENTIALS_FILE":                   "",
+	"POSTGRES_URL":                           "",
+	"BBOLT_FILENAME":                         "",
+	"REDIS_ADDRESS":                          "",
+	"REDIS_PASSWORD":                         "",
+	"REDIS_DB":                               0,
+	"REDIS_PREFIX":                           "",
+	"REDIS_TTL":                              time.Duration(0),
+	"HYBRID_BLOB_STORE":                      "fs",
+	"HYBRID_METADATA_STORE":                  "postgres",
+	"HYBRID_WAL_DIR":                         "",
+	"HYBRID_WAL_COMPACTION_THRESHOLD":        10000,
+	"COMPRESSION":                            "",
+	"ENCRYPTION_KEYS":                        "",
+	"DELTA_SNAPSHOT_INTERVAL":                0,
+	"VERSION_CACHE_MAX_ITEMS":                memoryCache.DefaultVersionCacheConfiguration.MaxItems,
+	"READ_CACHE_MAX_BYTES":                   int64(0),
+	"SHARED_BACKEND":                         false,
+	"SENT_MODEL_VERSION_DATA_CHUNK_SIZE":     1024 * 1024 * 5, // Default chunk size is 5 MB
+	"MIN_SENT_MODEL_VERSION_DATA_CHUNK_SIZE": 1024,
+	"MAX_SENT_MODEL_VERSION_DATA_CHUNK_SIZE": 1024 * 1024 * 64,
+	"SENT_VERSION_DATA_BUFFERED_CHUNKS":      4,
+	"PRESIGNED_URL_EXPIRATION":               time.Duration(0),
+	"PAGINATION_SECRET":                      "",
+	"UPLOAD_SESSION_TIMEOUT":                 time.Hour,
+	"MAX_UPLOAD_SESSIONS":                    256,
+	"VERSION_LEASE_TTL":                      time.Minute,
+	"MAX_VERSION_DATA_SIZE":                  int64(0),
+	"MAX_CONCURRENT_UPLOADS":                 0,
+	"MAX_UPLOAD_BYTES_PER_SECOND":            int64(0),
+	"MAX_CLIENT_UPLOAD_BYTES_PER_SECOND":     int64(0),
+	"HASH_ALGORITHM":                         backend.SHA256HashAlgorithm.Name,
+	"VERIFY_DATA_HASH":                       false,
+	"SIGNATURE_PUBLIC_KEYS":                  "",
+	"SIGNATURE_REQUIRED":                     false,
+	"NAMESPACES_FILE":                        "",
+	"MODEL_ID_PATTERN":                       "",
+	"MODEL_ID_MAX_LENGTH":                    0,
+	"MODEL_ID_RESERVED_PREFIXES":             "",
+	"TENANTS_FILE":                           "",
+	"SCRUB_INTERVAL":                         time.Duration(0),
+	"SCRUB_MAX_BYTES_PER_SECOND":             int64(10 * 1024 * 1024), // Default scan rate is 10 MB/s
+	"SCRUB_WEBHOOK_URL":                      "",
+	"RETENTION_INTERVAL":                     time.Duration(0),
+	"RETENTION_MAX_AGE":                      time.Duration(0),
+	"RETENTION_MAX_COUNT":                    0,
+	"RETENTION_DRY_RUN":                      false,
+	"COLD_STORAGE_BACKEND":                   "",
+	"COLD_STORAGE_DIR":                       "",
+	"COLD_STORAGE_BUCKET":                    "",
+	"COLD_STORAGE_PREFIX":                    "",
+	"COLD_STORAGE_MIN_AGE":                   time.Duration(0),
+	"COLD_STORAGE_INTERVAL":                  time.Hour,
+	"BACKUP_INTERVAL":                        time.Duration(0),
+	"BACKUP_FULL_INTERVAL":                   7 * 24 * time.Hour,
+	"BACKUP_TARGET":                          "fs",
+	"BACKUP_DIR":                             "",
+	"BACKUP_BUCKET":                          "",
+	"BACKUP_PREFIX":                          "",
+	"SNAPSHOT_DIR":                           "",
+	"RESTORE_FROM":                           "",
+	"MAINTENANCE_MAX_QUEUED_REQUESTS":        100,
+	"MAINTENANCE_QUEUE_TIMEOUT":              10 * time.Second,
+	"MAINTENANCE_MAX_DURATION":               5 * time.Minute,
+	"WEBHOOK_URLS":                           "",
+	"WEBHOOK_SECRET":                         "",
+	"WEBHOOK_EVENTS":                         "",
+	"WEBHOOK_MAX_ATTEMPTS":                   5,
+	"WEBHOOK_BACKOFF":                        time.Second,
+	"EVENT_BUS_URL":                          "",
+	"EVENT_BUS_SUBJECT":                      "cogment_model_registry",
+	"EVENT_BUS_ENCODING":                     "json",
+	"REPLICATION_PRIMARY_ADDRESS":            "",
+	"REPLICATION_PRIMARY_TOKEN":              "",
+	"REPLICATION_PRIMARY_TLS_CA_FILE":        "",
+	"REPLICATION_RESYNC_INTERVAL":            time.Hour,
+	"FEDERATION_UPSTREAM_ADDRESSES":          "",
+	"FEDERATION_UPSTREAM_TOKEN":              "",
+	"FEDERATION_UPSTREAM_TLS_CA_FILE":        "",
+	"FEDERATION_UPSTREAM_TIMEOUT":            30 * time.Second,
+	"FEDERATION_CACHE":                       false,
+	"FEDERATION_CACHE_TTL":                   time.Duration(0),
+	"FEDERATION_CACHE_MAX_BYTES":             int64(0),
+	"DIRECTORY_ADDRESS":                      "",
+	"DIRECTORY_AUTHENTICATION_TOKEN":         "",
+	"DIRECTORY_REGISTRATION_HOST":            "",
+	"DIRECTORY_REGISTRATION_PORT":            0,
+	"DIRECTORY_PROPERTIES":                   "",
+	"HEALTH_CHECK_INTERVAL":                  10 * time.Second,
+	"BACKEND_RECONNECT_INITIAL_BACKOFF":      time.Second,
+	"BACKEND_RECONNECT_MAX_BACKOFF":          time.Minute,
+	"BACKEND_RETRY_MAX_ATTEMPTS":             3,
+	"BACKEND_RETRY_INITIAL_BACKOFF":          100 * time.Millisecond,
+	"BACKEND_RETRY_MAX_BACKOFF":              2 * time.Second,
+	"CIRCUIT_BREAKER_FAILURE_THRESHOLD":      5,
+	"CIRCUIT_BREAKER_OPEN_DURATION":          10 * time.Second,
+	"CIRCUIT_BREAKER_SLOW_CALL_DURATION":     30 * time.Second,
+	"RPC_TIMEOUT":                            30 * time.Second,
+	"STREAM_RPC_TIMEOUT":                     time.Hour,
+	"SHUTDOWN_TIMEOUT":                       30 * time.Second,
+	"METRICS_PORT":                           0,
+	"DEBUG_PORT":                             0,
+	"MLFLOW_PORT":                            0,
+	"TLS_CERT_FILE":                          "",
+	"TLS_KEY_FILE":                           "",
+	"TLS_CLIENT_CA_FILE":                     "",
+	"AUTHORIZATION_POLICY_FILE":              "",
+	"GRPC_REFLECTION":                        false,
+	"LOG_LEVEL":                              "info",
+	"LOG_FORMAT":                             "text",
+}
+
+// reloadableKeys are the settings that can change while the server runs, see IsReloadable
+var reloadableKeys = map[string]bool{
+	"LOG_LEVEL":                          true,
+	"LOG_FORMAT":                         true,
+	"SENT_MODEL_VERSION_DATA_CHUNK_SIZE": true,
+	"RETENTION_MAX_AGE":                  true,
+	"RETENTION_MAX_COUNT":                true,
+	"RETENTION_DRY_RUN":                  true,
+	"AUTHORIZATION_POLICY_FILE":          true,
+}
+
+// UnknownSettingError is raised when the configuration file defines a setting the server doesn't have
+type UnknownSettingError struct {
+	Filename   string
+	Key        string
+	Suggestion string // Known setting the key likely refers to, empty if none
+}
+
+func (e *UnknownSettingError) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("unknown setting %q in %q, did you mean %q?", e.Key, e.Filename, e.Suggestion)
+	}
+	return fmt.Sprintf("unknown setting %q in %q", e.Key, e.Filename)
+}
+
+// InvalidSettingError is raised when the value of a setting doesn't have the expected type
+type InvalidSettingError struct {
+	Key      string
+	Value    interface{}
+	Expected string
+}
+
+func (e *InvalidSettingError) Error() string {
+	return fmt.Sprintf("invalid value %q for setting %q (%s_%s), expecting %s", fmt.Sprint(e.Value), strings.ToLower(e.Key), EnvPrefix, e.Key, e.Expected)
+}
+
+// Keys lists the settings of the server in alphabetical order
+func Keys() []string {
+	keys := make([]string, 0, len(defaults))
+	for key := range defaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Load defines the settings of v from their default values, the given configuration file if not empty and the
+// environment variables, each source overriding the previous ones, and validates them
+//
+// The configuration file can be in any format supported by viper, e.g. YAML, TOML or JSON, detected from its
+// extension. Its keys are the names of the environment variables without the prefix, e.g. `archive_backend`.
+func Load(v *viper.Viper, filename string) error {
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	v.SetEnvPrefix(EnvPrefix)
+	v.AutomaticEnv()
+
+	if filename != "" {
+		v.SetConfigFile(filename)
+		err := v.ReadInConfig()
+		if err != nil {
+			return fmt.Errorf("unable to read the configuration file %q: %w", filename, err)
+		}
+		fileKeys := v.AllKeys()
+		sort.Strings(fileKeys)
+		for _, key := range fileKeys {
+			if _, ok := defaults[strings.ToUpper(key)]; ok {
+				continue
+			}
+			// Nested sections, e.g. `s3: {bucket: ...}` in YAML, are flattened as `s3.bucket`
+			suggestion := strings.ReplaceAll(key, ".", "_")
+			if _, ok := defaults[strings.ToUpper(suggestion)]; !ok {
+				suggestion = ""
+			}
+			return &UnknownSettingError{Filename: filename, Key: key, Suggestion: suggestion}
+		}
+	}
+
+	return Validate(v)
+}
+
+// Validate checks the value of every setting of v can be converted to the type of its default value
+func Validate(v *viper.Viper) error {
+	for _, key := range Keys() {
+		value := v.Get(key)
+		_, expected, err := convert(key, value)
+		if err != nil {
+			return &InvalidSettingError{Key: key, Value: value, Expected: expected}
+		}
+	}
+	return nil
+}
+
+// convert converts the value of a setting to the type of its default value, also returning a description of this type
+func convert(key string, value interface{}) (interface{}, string, error) {
+	switch defaults[key].(type) {
+	case int:
+		converted, err := cast.ToIntE(value)
+		return converted, "an integer", err
+	case int64:
+		converted, err := cast.ToInt64E(value)
+		return converted, "an integer", err
+	case bool:
+		converted, err := cast.ToBoolE(value)
+		return converted, "a boolean, e.g. `true` or `false`", err
+	case time.Duration:
+		converted, err := cast.ToDurationE(value)
+		return converted, "a duration, e.g. `10m` or `72h`", err
+	default:
+		converted, err := cast.ToStringE(value)
+		return converted, "a string", err
+	}
+}
+
+// IsReloadable tells whether a setting is applied by a reload of the configuration, the others require a restart
+func IsReloadable(key string) bool {
+	return reloadableKeys[key]
+}
+
+// Changes lists in alphabetical order the settings whose value differ between two validated configurations
+func Changes(previous *viper.Viper, current *viper.Viper) []string {
+	changes := []string{}
+	for _, key := range Keys() {
+		previousValue, _, _ := convert(key, previous.Get(key))
+		currentValue, _, _ := convert(key, current.Get(key))
+		if previousValue != currentValue {
+			changes = append(changes, key)
+		}
+	}
+	return changes
+}
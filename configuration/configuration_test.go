@@ -0,0 +1,146 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, name string, content string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(filename, []byte(content), 0600))
+	return filename
+}
+
+func setEnv(t *testing.T, key string, value string) {
+	assert.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() { os.Unsetenv(key) })
+}
+
+func TestLoadDefaults(t *testing.T) {
+	v := viper.New()
+	assert.NoError(t, Load(v, ""))
+	assert.Equal(t, 9000, v.GetInt("PORT"))
+	assert.Equal(t, "fs", v.GetString("ARCHIVE_BACKEND"))
+	assert.Equal(t, time.Hour, v.GetDuration("UPLOAD_SESSION_TIMEOUT"))
+	assert.True(t, v.GetBool("S3_USE_SSL"))
+}
+
+func TestLoadFile(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.yaml": "port: 9100\narchive_backend: s3\ns3_bucket: models\nretention_interval: 10m\ns3_use_ssl: false\n",
+		"config.toml": "port = 9100\narchive_backend = \"s3\"\ns3_bucket = \"models\"\nretention_interval = \"10m\"\ns3_use_ssl = false\n",
+		"config.json": `{"port": 9100, "archive_backend": "s3", "s3_bucket": "models", "retention_interval": "10m", "s3_use_ssl": false}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			v := viper.New()
+			assert.NoError(t, Load(v, writeFile(t, name, content)))
+			assert.Equal(t, 9100, v.GetInt("PORT"))
+			assert.Equal(t, "s3", v.GetString("ARCHIVE_BACKEND"))
+			assert.Equal(t, "models", v.GetString("S3_BUCKET"))
+			assert.Equal(t, 10*time.Minute, v.GetDuration("RETENTION_INTERVAL"))
+			assert.False(t, v.GetBool("S3_USE_SSL"))
+			// Settings missing from the file keep their default
+			assert.Equal(t, "info", v.GetString("LOG_LEVEL"))
+		})
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	setEnv(t, "COGMENT_MODEL_REGISTRY_PORT", "9200")
+	setEnv(t, "COGMENT_MODEL_REGISTRY_LOG_LEVEL", "debug")
+	v := viper.New()
+	assert.NoError(t, Load(v, writeFile(t, "config.yaml", "port: 9100\narchive_backend: s3\n")))
+	assert.Equal(t, 9200, v.GetInt("PORT"))
+	assert.Equal(t, "debug", v.GetString("LOG_LEVEL"))
+	assert.Equal(t, "s3", v.GetString("ARCHIVE_BACKEND"))
+}
+
+func TestLoadUnknownSetting(t *testing.T) {
+	filename := writeFile(t, "config.yaml", "prot: 9100\n")
+	err := Load(viper.New(), filename)
+	assert.Equal(t, &UnknownSettingError{Filename: filename, Key: "prot"}, err)
+
+	filename = writeFile(t, "config.yaml", "s3:\n  bucket: models\n")
+	err = Load(viper.New(), filename)
+	assert.Equal(t, &UnknownSettingError{Filename: filename, Key: "s3.bucket", Suggestion: "s3_bucket"}, err)
+	assert.EqualError(t, err, `unknown setting "s3.bucket" in "`+filename+`", did you mean "s3_bucket"?`)
+}
+
+func TestLoadInvalidSetting(t *testing.T) {
+	err := Load(viper.New(), writeFile(t, "config.yaml", "retention_interval: often\n"))
+	assert.Equal(t, &InvalidSettingError{Key: "RETENTION_INTERVAL", Value: "often", Expected: "a duration, e.g. `10m` or `72h`"}, err)
+	assert.EqualError(t, err, "invalid value \"often\" for setting \"retention_interval\" (COGMENT_MODEL_REGISTRY_RETENTION_INTERVAL), expecting a duration, e.g. `10m` or `72h`")
+
+	setEnv(t, "COGMENT_MODEL_REGISTRY_PORT", "ninety")
+	err = Load(viper.New(), "")
+	assert.IsType(t, &InvalidSettingError{}, err)
+
+	assert.Error(t, Load(viper.New(), filepath.Join(t.TempDir(), "missing.yaml")))
+}
+
+func TestChanges(t *testing.T) {
+	previous := viper.New()
+	assert.NoError(t, Load(previous, writeFile(t, "config.yaml", "log_level: info\nretention_max_age: 60m\nport: 9100\n")))
+	current := viper.New()
+	assert.NoError(t, Load(current, writeFile(t, "config.yaml", "log_level: debug\nretention_max_age: 1h\nport: 9200\n")))
+	// Equivalent values, e.g. `60m` and `1h`, aren't changes
+	assert.Equal(t, []string{"LOG_LEVEL", "PORT"}, Changes(previous, current))
+	assert.Equal(t, []string{}, Changes(current, current))
+
+	assert.True(t, IsReloadable("LOG_LEVEL"))
+	assert.False(t, IsReloadable("PORT"))
+}
+
+func TestLoadTenants(t *testing.T) {
+	base := viper.New()
+	assert.NoError(t, Load(base, writeFile(t, "config.yaml", "archive_backend: s3\ns3_endpoint: minio:9000\ns3_bucket: models\nport: 9100\n")))
+	tenants, err := LoadTenants(base, writeFile(t, "tenants.yaml", `
+customer_a:
+  s3_bucket: customer-a-models
+customer_b:
+  archive_backend: fs
+  archive_dir: /var/lib/customer_b
+`))
+	assert.NoError(t, err)
+	assert.Len(t, tenants, 2)
+	assert.Equal(t, "customer-a-models", tenants["customer_a"].GetString("S3_BUCKET"))
+	assert.Equal(t, "minio:9000", tenants["customer_a"].GetString("S3_ENDPOINT"))
+	assert.Equal(t, "fs", tenants["customer_b"].GetString("ARCHIVE_BACKEND"))
+	assert.Equal(t, "/var/lib/customer_b", tenants["customer_b"].GetString("ARCHIVE_DIR"))
+	assert.Equal(t, 9100, tenants["customer_b"].GetInt("PORT"))
+	// The base settings aren't changed
+	assert.Equal(t, "models", base.GetString("S3_BUCKET"))
+
+	for name, content := range map[string]string{
+		"not a map":       "customer_a: s3\n",
+		"invalid name":    "customer*a:\n  s3_bucket: models\n",
+		"unknown setting": "customer_a:\n  s3_buckett: models\n",
+		"global setting":  "customer_a:\n  port: 9200\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadTenants(base, writeFile(t, "tenants.yaml", content))
+			assert.IsType(t, &InvalidTenantError{}, err)
+		})
+	}
+	_, err = LoadTenants(base, writeFile(t, "tenants.yaml", "customer_a:\n  redis_db: first\n"))
+	assert.Error(t, err)
+}
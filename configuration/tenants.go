@@ -0,0 +1,139 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// tenantKeys are the settings a tenant can override, the ones defining where and how its models are stored
+var tenantKeys = map[string]bool{
+	"ARCHIVE_BACKEND":                 true,
+	"ARCHIVE_URI":                     true,
+	"ARCHIVE_DIR":                     true,
+	"S3_ENDPOINT":                     true,
+	"S3_BUCKET":                       true,
+	"S3_PREFIX":                       true,
+	"S3_REGION":                       true,
+	"S3_ACCESS_KEY_ID":                true,
+	"S3_SECRET_ACCESS_KEY":            true,
+	"S3_USE_SSL":                      true,
+	"GCS_BUCKET":                      true,
+	"GCS_PREFIX":                      true,
+	"GCS_CREDENTIALS_FILE":            true,
+	"POSTGRES_URL":                    true,
+	"BBOLT_FILENAME":                  true,
+	"REDIS_ADDRESS":                   true,
+	"REDIS_PASSWORD":                  true,
+	"REDIS_DB":                        true,
+	"REDIS_PREFIX":                    true,
+	"REDIS_TTL":                       true,
+	"HYBRID_BLOB_STORE":               true,
+	"HYBRID_METADATA_STORE":           true,
+	"HYBRID_WAL_DIR":                  true,
+	"HYBRID_WAL_COMPACTION_THRESHOLD": true,
+	"COMPRESSION":                     true,
+	"ENCRYPTION_KEYS":                 true,
+	"DELTA_SNAPSHOT_INTERVAL":         true,
+	"VERSION_CACHE_MAX_ITEMS":         true,
+	"READ_CACHE_MAX_BYTES":            true,
+	"SCRUB_INTERVAL":                  true,
+	"SCRUB_MAX_BYTES_PER_SECOND":      true,
+	"SCRUB_WEBHOOK_URL":               true,
+	"BACKUP_INTERVAL":                 true,
+	"BACKUP_FULL_INTERVAL":            true,
+	"BACKUP_TARGET":                   true,
+	"BACKUP_DIR":                      true,
+	"BACKUP_BUCKET":                   true,
+	"BACKUP_PREFIX":                   true,
+	"SNAPSHOT_DIR":                    true,
+	"RESTORE_FROM":                    true,
+}
+
+var tenantNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// InvalidTenantError is raised when a tenants file defines an invalid tenant
+type InvalidTenantError struct {
+	Filename string
+	Tenant   string
+	Reason   string
+}
+
+func (e *InvalidTenantError) Error() string {
+	return fmt.Sprintf("invalid tenant %q in %q, %s", e.Tenant, e.Filename, e.Reason)
+}
+
+// IsTenantScoped tells whether a tenant can override a setting, see LoadTenants
+func IsTenantScoped(key string) bool {
+	return tenantKeys[key]
+}
+
+// LoadTenants loads the settings of the tenants defined in a file, each tenant overriding the storage settings of base
+//
+// The file maps the name of each tenant to the settings it overrides, in any format supported by viper, e.g. in YAML
+// `customer_a: {archive_backend: s3, s3_bucket: customer-a-models}`. The other settings are the ones of base.
+func LoadTenants(base *viper.Viper, filename string) (map[string]*viper.Viper, error) {
+	file := viper.New()
+	file.SetConfigFile(filename)
+	err := file.ReadInConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the tenants file %q: %w", filename, err)
+	}
+
+	overrides := map[string]map[string]interface{}{}
+	fileKeys := file.AllKeys()
+	sort.Strings(fileKeys)
+	for _, fileKey := range fileKeys {
+		separatorIndex := strings.Index(fileKey, ".")
+		if separatorIndex < 0 {
+			return nil, &InvalidTenantError{Filename: filename, Tenant: fileKey, Reason: "expecting a map of settings"}
+		}
+		tenant, key := fileKey[:separatorIndex], strings.ToUpper(fileKey[separatorIndex+1:])
+		if !tenantNameRegexp.MatchString(tenant) {
+			return nil, &InvalidTenantError{Filename: filename, Tenant: tenant, Reason: "expecting letters, digits, \"_\" and \"-\", starting with a letter or a digit"}
+		}
+		if _, ok := defaults[key]; !ok {
+			return nil, &InvalidTenantError{Filename: filename, Tenant: tenant, Reason: fmt.Sprintf("unknown setting %q", strings.ToLower(key))}
+		}
+		if !IsTenantScoped(key) {
+			return nil, &InvalidTenantError{Filename: filename, Tenant: tenant, Reason: fmt.Sprintf("setting %q can't be defined per tenant", strings.ToLower(key))}
+		}
+		if overrides[tenant] == nil {
+			overrides[tenant] = map[string]interface{}{}
+		}
+		overrides[tenant][key] = file.Get(fileKey)
+	}
+
+	tenants := make(map[string]*viper.Viper, len(overrides))
+	for tenant, tenantOverrides := range overrides {
+		settings := viper.New()
+		for _, key := range Keys() {
+			settings.Set(key, base.Get(key))
+		}
+		for key, value := range tenantOverrides {
+			settings.Set(key, value)
+		}
+		if err := Validate(settings); err != nil {
+			return nil, fmt.Errorf("invalid tenant %q in %q: %w", tenant, filename, err)
+		}
+		tenants[tenant] = settings
+	}
+	return tenants, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deadlines
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics published under `/debug/vars`
+var deadlineExceededMetric = expvar.NewInt("rpc_deadline_exceeded")
+
+// Configuration defines the default deadlines of the calls, applied by the interceptors
+type Configuration struct {
+	UnaryTimeout  time.Duration            // Default deadline of the unary calls, 0 means none
+	StreamTimeout time.Duration            // Default deadline of the streaming calls, 0 means none
+	Unbounded     func(method string) bool // Optional, the methods without any default deadline, e.g. the watches
+}
+
+// withTimeout applies the default deadline of a method, an earlier deadline set by the client is kept
+func (c Configuration) withTimeout(ctx context.Context, method string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 || (c.Unbounded != nil && c.Unbounded(method)) {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// deadlineError reports the failures of the calls past their deadline as `DEADLINE_EXCEEDED`, whatever the step failing
+func deadlineError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	deadlineExceededMetric.Add(1)
+	if status.Code(err) == codes.DeadlineExceeded {
+		return err
+	}
+	return status.Errorf(codes.DeadlineExceeded, "deadline exceeded: %s", status.Convert(err).Message())
+}
+
+// UnaryServerInterceptor creates an interceptor applying the default deadline of the unary calls
+func UnaryServerInterceptor(configuration Configuration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel := configuration.withTimeout(ctx, info.FullMethod, configuration.UnaryTimeout)
+		defer cancel()
+		rep, err := handler(ctx, req)
+		return rep, deadlineError(ctx, err)
+	}
+}
+
+// serverStream is a stream whose context has its default deadline
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor creates an interceptor applying the default deadline of the streaming calls
+func StreamServerInterceptor(configuration Configuration) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := configuration.withTimeout(stream.Context(), info.FullMethod, configuration.StreamTimeout)
+		defer cancel()
+		err := handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+		return deadlineError(ctx, err)
+	}
+}
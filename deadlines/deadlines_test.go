@@ -0,0 +1,98 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deadlines
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var configuration = Configuration{
+	UnaryTimeout:  50 * time.Millisecond,
+	StreamTimeout: time.Hour,
+	Unbounded: func(method string) bool {
+		return strings.Contains(method, "/Watch")
+	},
+}
+
+func TestUnaryDeadlines(t *testing.T) {
+	interceptor := UnaryServerInterceptor(configuration)
+	info := &grpc.UnaryServerInfo{FullMethod: "/cogmentAPI.ModelRegistrySP/RetrieveModels"}
+
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(50*time.Millisecond), deadline, 10*time.Millisecond)
+		return nil, nil
+	})
+	assert.NoError(t, err)
+
+	// An earlier deadline set by the client is kept
+	clientCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	clientDeadline, _ := clientCtx.Deadline()
+	_, err = interceptor(clientCtx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		deadline, _ := ctx.Deadline()
+		assert.Equal(t, clientDeadline, deadline)
+		return nil, nil
+	})
+	assert.NoError(t, err)
+
+	// The calls failing after their deadline fail with DEADLINE_EXCEEDED
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, status.Errorf(codes.Internal, "unexpected error while retrieving models: %s", ctx.Err())
+	})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Errorf(codes.NotFound, "no model \"foo\" found")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+}
+
+func (s *testServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestStreamDeadlines(t *testing.T) {
+	interceptor := StreamServerInterceptor(configuration)
+
+	downloadInfo := &grpc.StreamServerInfo{FullMethod: "/cogmentAPI.ModelRegistrySP/RetrieveVersionData", IsServerStream: true}
+	assert.NoError(t, interceptor(nil, &testServerStream{}, downloadInfo, func(srv interface{}, stream grpc.ServerStream) error {
+		deadline, ok := stream.Context().Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), deadline, time.Second)
+		return nil
+	}))
+
+	// The watches don't have any
+	watchInfo := &grpc.StreamServerInfo{FullMethod: "/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/WatchVersions", IsServerStream: true}
+	assert.NoError(t, interceptor(nil, &testServerStream{}, watchInfo, func(srv interface{}, stream grpc.ServerStream) error {
+		_, ok := stream.Context().Deadline()
+		assert.False(t, ok)
+		return nil
+	}))
+}
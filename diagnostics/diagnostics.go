@@ -0,0 +1,121 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostics
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Server publishes the profiles, the metrics and a dump of the state of the registry
+type Server struct {
+	mutex     sync.Mutex
+	startTime time.Time
+	names     []string
+	states    map[string]func() interface{}
+}
+
+// CreateServer creates a diagnostics server without any registered state
+func CreateServer() *Server {
+	return &Server{
+		startTime: time.Now(),
+		states:    make(map[string]func() interface{}),
+	}
+}
+
+// AddState registers a function called on each dump, its result is serialized as JSON under the given name
+func (s *Server) AddState(name string, state func() interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.states[name]; !ok {
+		s.names = append(s.names, name)
+	}
+	s.states[name] = state
+}
+
+// Handler serves net/http/pprof under `/debug/pprof/`, the metrics under `/debug/vars` and the state dump under `/debug/state`
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/state", s.serveState)
+	return mux
+}
+
+// Runtime summarizes the goroutines and the memory of the process
+type Runtime struct {
+	Uptime         string `json:"uptime"`
+	Goroutines     int    `json:"goroutines"`
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapInuseBytes uint64 `json:"heap_inuse_bytes"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+}
+
+// State is the content of the state dump
+type State struct {
+	Runtime Runtime                `json:"runtime"`
+	States  map[string]interface{} `json:"states"`
+}
+
+// Dump calls every registered state function
+func (s *Server) Dump() State {
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+	dump := State{
+		Runtime: Runtime{
+			Uptime:         time.Since(s.startTime).Round(time.Second).String(),
+			Goroutines:     runtime.NumGoroutine(),
+			HeapAllocBytes: memStats.HeapAlloc,
+			HeapInuseBytes: memStats.HeapInuse,
+			SysBytes:       memStats.Sys,
+			NumGC:          memStats.NumGC,
+		},
+		States: make(map[string]interface{}),
+	}
+
+	s.mutex.Lock()
+	names := append([]string{}, s.names...)
+	states := make([]func() interface{}, len(names))
+	for index, name := range names {
+		states[index] = s.states[name]
+	}
+	s.mutex.Unlock()
+
+	// The state functions may take locks of their own, the lock isn't held in between
+	for index, name := range names {
+		dump.States[name] = states[index]()
+	}
+	return dump
+}
+
+func (s *Server) serveState(w http.ResponseWriter, r *http.Request) {
+	body, err := json.MarshalIndent(s.Dump(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
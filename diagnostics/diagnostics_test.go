@@ -0,0 +1,66 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func get(t *testing.T, s *Server, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func TestState(t *testing.T) {
+	s := CreateServer()
+	s.AddState("maintenance", func() interface{} { return "off" })
+	s.AddState("circuits", func() interface{} { return map[string]string{"default": "closed"} })
+
+	rep := get(t, s, "/debug/state")
+	assert.Equal(t, http.StatusOK, rep.Code)
+	assert.Equal(t, "application/json", rep.Header().Get("Content-Type"))
+	dump := struct {
+		Runtime Runtime                    `json:"runtime"`
+		States  map[string]json.RawMessage `json:"states"`
+	}{}
+	assert.NoError(t, json.Unmarshal(rep.Body.Bytes(), &dump))
+	assert.Greater(t, dump.Runtime.Goroutines, 0)
+	assert.Greater(t, dump.Runtime.SysBytes, uint64(0))
+	assert.JSONEq(t, `"off"`, string(dump.States["maintenance"]))
+	assert.JSONEq(t, `{"default":"closed"}`, string(dump.States["circuits"]))
+
+	// Registering a state again replaces it
+	s.AddState("maintenance", func() interface{} { return "read-only" })
+	assert.Equal(t, "read-only", s.Dump().States["maintenance"])
+	assert.Len(t, s.Dump().States, 2)
+}
+
+func TestHandler(t *testing.T) {
+	s := CreateServer()
+	assert.Equal(t, http.StatusOK, get(t, s, "/debug/pprof/").Code)
+	rep := get(t, s, "/debug/pprof/goroutine?debug=2")
+	assert.Equal(t, http.StatusOK, rep.Code)
+	assert.Contains(t, rep.Body.String(), "goroutine")
+	rep = get(t, s, "/debug/vars")
+	assert.Equal(t, http.StatusOK, rep.Code)
+	assert.Contains(t, rep.Body.String(), "memstats")
+	assert.Equal(t, http.StatusNotFound, get(t, s, "/metrics").Code)
+}
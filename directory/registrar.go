@@ -0,0 +1,226 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package directory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+)
+
+// ModelRegistryServiceType is the type of service the registry registers as
+//
+// It is the value of `MODEL_REGISTRY_SERVICE` in the later versions of the Cogment API, the version used here predates it.
+const ModelRegistryServiceType = grpcapi.ServiceType(7)
+
+// Default delay between two registration attempts
+const DefaultRetryBackoff = 5 * time.Second
+
+type Configuration struct {
+	Address             string            // Address of the Cogment directory, e.g. `localhost:9005`
+	AuthenticationToken string            // If defined, sent as an `authentication-token` metadata
+	Hostname            string            // Hostname at which the registry is reachable
+	Port                uint32            // Port at which the registry is reachable
+	SSL                 bool              // Whether the registry serves gRPC over TLS
+	Properties          map[string]string // Properties registered with the service
+	RetryBackoff        time.Duration     // Delay between two registration attempts, DefaultRetryBackoff when 0
+}
+
+// UnsuccessfulCallError is raised when the directory replies with another status than OK
+type UnsuccessfulCallError struct {
+	Method  string
+	Message string
+}
+
+func (e *UnsuccessfulCallError) Error() string {
+	return fmt.Sprintf("%s failed: %s", e.Method, e.Message)
+}
+
+// ParseProperties parses properties formatted as a comma separated list of `<key>=<value>`
+func ParseProperties(serializedProperties string) (map[string]string, error) {
+	properties := make(map[string]string)
+	for _, serializedProperty := range strings.Split(serializedProperties, ",") {
+		if strings.TrimSpace(serializedProperty) == "" {
+			continue
+		}
+		keyValue := strings.SplitN(serializedProperty, "=", 2)
+		key := strings.TrimSpace(keyValue[0])
+		if len(keyValue) != 2 || key == "" {
+			return nil, fmt.Errorf("invalid directory property %q, expecting \"<key>=<value>\"", serializedProperty)
+		}
+		properties[key] = strings.TrimSpace(keyValue[1])
+	}
+	return properties, nil
+}
+
+// Registrar registers the registry with a Cogment directory and deregisters it
+type Registrar struct {
+	configuration Configuration
+	connection    *grpc.ClientConn
+	discovery     grpcapi.DiscoveryClient
+
+	mutex      sync.Mutex
+	registered bool
+	serviceID  uint64
+	secret     string
+}
+
+// CreateRegistrar creates a registrar connecting to the configured directory
+func CreateRegistrar(configuration Configuration) (*Registrar, error) {
+	if configuration.RetryBackoff <= 0 {
+		configuration.RetryBackoff = DefaultRetryBackoff
+	}
+	connection, err := grpc.Dial(configuration.Address, grpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the directory at %q: %w", configuration.Address, err)
+	}
+	return &Registrar{
+		configuration: configuration,
+		connection:    connection,
+		discovery:     grpcapi.NewDiscoveryClient(connection),
+	}, nil
+}
+
+// Close closes the connection to the directory
+func (r *Registrar) Close() error {
+	return r.connection.Close()
+}
+
+func (r *Registrar) outgoingContext(ctx context.Context) context.Context {
+	if r.configuration.AuthenticationToken == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authentication-token", r.configuration.AuthenticationToken)
+}
+
+// Registered returns the id attributed by the directory, and whether the registry is registered
+func (r *Registrar) Registered() (uint64, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.serviceID, r.registered
+}
+
+// Register registers the registry with the directory, it does nothing if it is already registered
+func (r *Registrar) Register(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.registered {
+		return nil
+	}
+
+	protocol := grpcapi.ServiceEndpoint_GRPC
+	if r.configuration.SSL {
+		protocol = grpcapi.ServiceEndpoint_GRPC_SSL
+	}
+	stream, err := r.discovery.Register(r.outgoingContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to register with the directory: %w", err)
+	}
+	err = stream.Send(&grpcapi.RegisterRequest{
+		Endpoint: &grpcapi.ServiceEndpoint{
+			Protocol: protocol,
+			Hostname: r.configuration.Hostname,
+			Port:     r.configuration.Port,
+		},
+		Details: &grpcapi.ServiceDetails{
+			Type:       ModelRegistryServiceType,
+			Properties: r.configuration.Properties,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to register with the directory: %w", err)
+	}
+	err = stream.CloseSend()
+	if err != nil {
+		return fmt.Errorf("unable to register with the directory: %w", err)
+	}
+	rep, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("unable to register with the directory: %w", err)
+	}
+	if rep.Status != grpcapi.RegisterReply_OK {
+		return &UnsuccessfulCallError{Method: "Register", Message: rep.ErrorMsg}
+	}
+
+	r.registered = true
+	r.serviceID = rep.ServiceId
+	r.secret = rep.Secret
+	return nil
+}
+
+// Run registers the registry, retrying every configured backoff until it succeeds or the context is done
+func (r *Registrar) Run(ctx context.Context) {
+	for {
+		err := r.Register(ctx)
+		if err == nil {
+			serviceID, _ := r.Registered()
+			logrus.WithFields(logrus.Fields{"address": r.configuration.Address, "service_id": serviceID}).Info("Registered with the directory")
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logrus.WithError(err).Warnf("Directory registration failed, retrying in %s", r.configuration.RetryBackoff)
+		timer := time.NewTimer(r.configuration.RetryBackoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Deregister removes the registration of the registry from the directory, it does nothing if it isn't registered
+func (r *Registrar) Deregister(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.registered {
+		return nil
+	}
+
+	stream, err := r.discovery.Deregister(r.outgoingContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to deregister from the directory: %w", err)
+	}
+	err = stream.Send(&grpcapi.DeregisterRequest{ServiceId: r.serviceID, Secret: r.secret})
+	if err != nil {
+		return fmt.Errorf("unable to deregister from the directory: %w", err)
+	}
+	err = stream.CloseSend()
+	if err != nil {
+		return fmt.Errorf("unable to deregister from the directory: %w", err)
+	}
+	rep, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("unable to deregister from the directory: %w", err)
+	}
+	if rep.Status != grpcapi.DeregisterReply_OK {
+		return &UnsuccessfulCallError{Method: "Deregister", Message: rep.ErrorMsg}
+	}
+
+	r.registered = false
+	r.serviceID = 0
+	r.secret = ""
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package directory
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+)
+
+// fakeDirectory records the registered services, failing the first registrations if needed
+type fakeDirectory struct {
+	grpcapi.UnimplementedDiscoveryServer
+
+	mutex               sync.Mutex
+	failedRegistrations int
+	services            map[uint64]*grpcapi.RegisterRequest
+	tokens              []string
+	nextServiceID       uint64
+}
+
+func (d *fakeDirectory) Register(stream grpcapi.Discovery_RegisterServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok {
+		d.tokens = append(d.tokens, md.Get("authentication-token")...)
+	}
+	if d.failedRegistrations > 0 {
+		d.failedRegistrations--
+		return stream.Send(&grpcapi.RegisterReply{Status: grpcapi.RegisterReply_INTERNAL_ERROR, ErrorMsg: "not ready"})
+	}
+	d.nextServiceID++
+	d.services[d.nextServiceID] = req
+	return stream.Send(&grpcapi.RegisterReply{Status: grpcapi.RegisterReply_OK, ServiceId: d.nextServiceID, Secret: "secret"})
+}
+
+func (d *fakeDirectory) Deregister(stream grpcapi.Discovery_DeregisterServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, ok := d.services[req.ServiceId]; !ok || req.Secret != "secret" {
+		return stream.Send(&grpcapi.DeregisterReply{Status: grpcapi.DeregisterReply_INTERNAL_ERROR, ErrorMsg: "unknown service"})
+	}
+	delete(d.services, req.ServiceId)
+	return stream.Send(&grpcapi.DeregisterReply{Status: grpcapi.DeregisterReply_OK})
+}
+
+func (d *fakeDirectory) servicesCount() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return len(d.services)
+}
+
+func startDirectory(t *testing.T, failedRegistrations int) (*fakeDirectory, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	t.Cleanup(server.Stop)
+	directory := &fakeDirectory{failedRegistrations: failedRegistrations, services: make(map[uint64]*grpcapi.RegisterRequest)}
+	grpcapi.RegisterDiscoveryServer(server, directory)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return directory, listener.Addr().String()
+}
+
+func TestRegisterAndDeregister(t *testing.T) {
+	directory, address := startDirectory(t, 0)
+	registrar, err := CreateRegistrar(Configuration{
+		Address:             address,
+		AuthenticationToken: "token",
+		Hostname:            "registry.local",
+		Port:                9000,
+		SSL:                 true,
+		Properties:          map[string]string{"team": "a"},
+	})
+	assert.NoError(t, err)
+	defer registrar.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, registrar.Register(ctx))
+	// Registering again keeps the existing registration
+	assert.NoError(t, registrar.Register(ctx))
+	serviceID, registered := registrar.Registered()
+	assert.True(t, registered)
+	assert.Equal(t, uint64(1), serviceID)
+	assert.Equal(t, 1, directory.servicesCount())
+
+	req := directory.services[serviceID]
+	assert.Equal(t, grpcapi.ServiceEndpoint_GRPC_SSL, req.Endpoint.Protocol)
+	assert.Equal(t, "registry.local", req.Endpoint.Hostname)
+	assert.Equal(t, uint32(9000), req.Endpoint.Port)
+	assert.Equal(t, ModelRegistryServiceType, req.Details.Type)
+	assert.Equal(t, map[string]string{"team": "a"}, req.Details.Properties)
+	assert.Equal(t, []string{"token"}, directory.tokens)
+
+	assert.NoError(t, registrar.Deregister(ctx))
+	_, registered = registrar.Registered()
+	assert.False(t, registered)
+	assert.Equal(t, 0, directory.servicesCount())
+	// Deregistering again does nothing
+	assert.NoError(t, registrar.Deregister(ctx))
+}
+
+func TestRunRetries(t *testing.T) {
+	directory, address := startDirectory(t, 2)
+	registrar, err := CreateRegistrar(Configuration{Address: address, Hostname: "localhost", Port: 9000, RetryBackoff: 10 * time.Millisecond})
+	assert.NoError(t, err)
+	defer registrar.Close()
+
+	err = registrar.Register(context.Background())
+	assert.IsType(t, &UnsuccessfulCallError{}, err)
+
+	done := make(chan struct{})
+	go func() {
+		registrar.Run(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the registration didn't succeed")
+	}
+	_, registered := registrar.Registered()
+	assert.True(t, registered)
+	assert.Equal(t, 1, directory.servicesCount())
+}
+
+func TestRunStopsWithContext(t *testing.T) {
+	registrar, err := CreateRegistrar(Configuration{Address: "127.0.0.1:1", Hostname: "localhost", Port: 9000, RetryBackoff: time.Hour})
+	assert.NoError(t, err)
+	defer registrar.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		registrar.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the registration didn't stop")
+	}
+	_, registered := registrar.Registered()
+	assert.False(t, registered)
+}
+
+func TestParseProperties(t *testing.T) {
+	properties, err := ParseProperties("team=a, zone = eu-west=1,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "a", "zone": "eu-west=1"}, properties)
+
+	properties, err = ParseProperties("")
+	assert.NoError(t, err)
+	assert.Empty(t, properties)
+
+	_, err = ParseProperties("team")
+	assert.Error(t, err)
+	_, err = ParseProperties("=a")
+	assert.Error(t, err)
+}
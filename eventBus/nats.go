@@ -0,0 +1,227 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventBus
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/version"
+)
+
+// natsConnection is a minimal client of the NATS core protocol, only able to publish messages
+//
+// See https://docs.nats.io/reference/reference-protocols/nats-protocol
+type natsConnection struct {
+	conn       net.Conn
+	maxPayload int // Size of the largest payload accepted by the server, 0 if it isn't announced
+	writeMutex sync.Mutex
+	pongs      chan struct{}
+	failure    chan error // Receives the error ending the connection
+}
+
+// natsServerInfo is the part of the INFO message sent by the server on connection the client relies on
+type natsServerInfo struct {
+	TLSRequired  bool `json:"tls_required"`
+	TLSAvailable bool `json:"tls_available"`
+	MaxPayload   int  `json:"max_payload"`
+}
+
+type natsConnectOptions struct {
+	Verbose     bool   `json:"verbose"`
+	Pedantic    bool   `json:"pedantic"`
+	Name        string `json:"name"`
+	Lang        string `json:"lang"`
+	Version     string `json:"version"`
+	Protocol    int    `json:"protocol"`
+	TLSRequired bool   `json:"tls_required"`
+	User        string `json:"user,omitempty"`
+	Pass        string `json:"pass,omitempty"`
+	AuthToken   string `json:"auth_token,omitempty"`
+}
+
+// dialNATS connects to the NATS server of a `nats://` or `tls://` URL, its user info holding the credentials, either
+// `user:password` or a token
+//
+// Like the official clients, the connection is upgraded to TLS once the server sent its INFO in plaintext, for `tls://`
+// URLs or when the server requires it. The given TLS configuration, if any, is used for the upgrade.
+func dialNATS(ctx context.Context, serverURL *url.URL, tlsConfig *tls.Config, timeout time.Duration) (*natsConnection, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", serverURL.Host)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %q: %w", serverURL.Host, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	infoLine, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to read the NATS server info: %w", err)
+	}
+	if !strings.HasPrefix(infoLine, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected NATS server greeting %q", strings.TrimSpace(infoLine))
+	}
+	info := natsServerInfo{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(infoLine, "INFO ")), &info); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to parse the NATS server info: %w", err)
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	secure := serverURL.Scheme == "tls"
+	if secure && !info.TLSRequired && !info.TLSAvailable {
+		conn.Close()
+		return nil, fmt.Errorf("the NATS server at %q doesn't support TLS", serverURL.Host)
+	}
+	if secure || info.TLSRequired {
+		config := &tls.Config{}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = serverURL.Hostname()
+		}
+		tlsConn := tls.Client(conn, config)
+		_ = tlsConn.SetDeadline(time.Now().Add(timeout))
+		if err := tlsConn.Handshake(); err != nil {
+			tlsConn.Close()
+			return nil, fmt.Errorf("unable to upgrade the connection to %q to TLS: %w", serverURL.Host, err)
+		}
+		_ = tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+
+	options := natsConnectOptions{
+		Name:        "cogment-model-registry",
+		Lang:        "go",
+		Version:     version.Version,
+		Protocol:    1,
+		TLSRequired: secure || info.TLSRequired,
+	}
+	if serverURL.User != nil {
+		if password, ok := serverURL.User.Password(); ok {
+			options.User = serverURL.User.Username()
+			options.Pass = password
+		} else {
+			options.AuthToken = serverURL.User.Username()
+		}
+	}
+	connectOptions, err := json.Marshal(options)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to serialize the NATS connect options: %w", err)
+	}
+
+	c := &natsConnection{
+		conn:       conn,
+		maxPayload: info.MaxPayload,
+		pongs:      make(chan struct{}, 16),
+		failure:    make(chan error, 1),
+	}
+	go c.read(reader)
+	if err := c.write([]byte(fmt.Sprintf("CONNECT %s\r\n", connectOptions))); err != nil {
+		c.close()
+		return nil, err
+	}
+	// The PONG replying to the first PING confirms the connection was accepted, an authentication failure is sent before
+	if err := c.flush(timeout); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// read handles the protocol messages sent by the server until the connection ends
+func (c *natsConnection) read(reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			c.fail(fmt.Errorf("NATS connection lost: %w", err))
+			return
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PING":
+			if err := c.write([]byte("PONG\r\n")); err != nil {
+				c.fail(err)
+				return
+			}
+		case line == "PONG":
+			c.pongs <- struct{}{}
+		case strings.HasPrefix(line, "-ERR"):
+			c.fail(fmt.Errorf("NATS server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR"))))
+			return
+		}
+		// +OK and INFO updates are ignored
+	}
+}
+
+func (c *natsConnection) fail(err error) {
+	select {
+	case c.failure <- err:
+	default:
+	}
+}
+
+func (c *natsConnection) write(data []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if _, err := c.conn.Write(data); err != nil {
+		return fmt.Errorf("unable to write to the NATS server: %w", err)
+	}
+	return nil
+}
+
+// publish sends a message, it is only known to be received by the server once flush succeeds
+func (c *natsConnection) publish(subject string, payload []byte) error {
+	message := make([]byte, 0, len(subject)+len(payload)+32)
+	message = append(message, fmt.Sprintf("PUB %s %d\r\n", subject, len(payload))...)
+	message = append(message, payload...)
+	message = append(message, "\r\n"...)
+	return c.write(message)
+}
+
+// flush waits for the server to process the messages published so far
+func (c *natsConnection) flush(timeout time.Duration) error {
+	if err := c.write([]byte("PING\r\n")); err != nil {
+		return err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-c.pongs:
+		return nil
+	case err := <-c.failure:
+		c.fail(err)
+		return err
+	case <-timer.C:
+		return fmt.Errorf("no reply from the NATS server after %s", timeout)
+	}
+}
+
+func (c *natsConnection) close() {
+	c.conn.Close()
+}
@@ -0,0 +1,307 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventBus
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"expvar"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+type natsMessage struct {
+	subject string
+	payload []byte
+}
+
+// fakeNATSServer records the messages it receives, closing the first connections without acknowledging them
+//
+// With a TLS configuration, it requires the connections to be upgraded to TLS after its INFO like nats-server does.
+type fakeNATSServer struct {
+	listener        net.Listener
+	info            natsServerInfo
+	tlsConfig       *tls.Config
+	mutex           sync.Mutex
+	droppedConns    int
+	connectOptions  []natsConnectOptions
+	messages        []natsMessage
+	acknowledgments int
+}
+
+func startFakeNATSServer(t *testing.T, droppedConns int, maxPayload int, tlsConfig *tls.Config) *fakeNATSServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	s := &fakeNATSServer{
+		listener:     listener,
+		info:         natsServerInfo{TLSRequired: tlsConfig != nil, MaxPayload: maxPayload},
+		tlsConfig:    tlsConfig,
+		droppedConns: droppedConns,
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNATSServer) serve(conn net.Conn) {
+	defer conn.Close()
+	info, err := json.Marshal(s.info)
+	if err != nil {
+		return
+	}
+	if _, err := conn.Write([]byte("INFO " + string(info) + "\r\n")); err != nil {
+		return
+	}
+	if s.tlsConfig != nil {
+		tlsConn := tls.Server(conn, s.tlsConfig)
+		defer tlsConn.Close()
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		conn = tlsConn
+	}
+	reader := bufio.NewReader(conn)
+	connected := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, "CONNECT "):
+			options := natsConnectOptions{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &options); err != nil {
+				return
+			}
+			s.mutex.Lock()
+			s.connectOptions = append(s.connectOptions, options)
+			s.mutex.Unlock()
+		case fields[0] == "PUB":
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			s.mutex.Lock()
+			dropped := s.droppedConns > 0
+			if dropped {
+				s.droppedConns--
+			} else {
+				s.messages = append(s.messages, natsMessage{subject: fields[1], payload: payload[:size]})
+			}
+			s.mutex.Unlock()
+			if dropped {
+				return
+			}
+		case fields[0] == "PING":
+			if connected {
+				s.mutex.Lock()
+				s.acknowledgments++
+				s.mutex.Unlock()
+			}
+			connected = true
+			if _, err := conn.Write([]byte("PONG\r\n")); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *fakeNATSServer) receivedMessages() []natsMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]natsMessage{}, s.messages...)
+}
+
+func startPublisher(t *testing.T, configuration Configuration) *Publisher {
+	publisher, err := CreatePublisher(configuration)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go publisher.Run(ctx)
+	return publisher
+}
+
+func TestPublisher(t *testing.T) {
+	server := startFakeNATSServer(t, 0, 0, nil)
+	publisher := startPublisher(t, Configuration{
+		URL:      "nats://user:password@" + server.listener.Addr().String(),
+		Subject:  "registry",
+		Encoding: JSONEncoding,
+		Tenant:   "team_a",
+	})
+	publisher.ModelEvent(extensionsapi.ModelEventType_MODEL_CREATED, backend.ModelInfo{ModelID: "foo"})
+	publisher.VersionEvent(extensionsapi.VersionEventType_VERSION_CREATED, backend.VersionInfo{ModelID: "foo", VersionNumber: 1, DataHash: "hash", DataSize: 4})
+
+	assert.Eventually(t, func() bool {
+		return len(server.receivedMessages()) == 2
+	}, time.Second, 10*time.Millisecond)
+	messages := server.receivedMessages()
+	assert.Equal(t, "registry.team_a.model_created", messages[0].subject)
+	assert.Equal(t, "registry.team_a.version_created", messages[1].subject)
+	event := &extensionsapi.WatchRegistryReply{}
+	assert.NoError(t, protojson.Unmarshal(messages[1].payload, event))
+	assert.Equal(t, "foo", event.GetVersionEvent().GetVersionInfo().GetModelId())
+	assert.Equal(t, uint32(1), event.GetVersionEvent().GetVersionInfo().GetVersionNumber())
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	assert.Equal(t, "user", server.connectOptions[0].User)
+	assert.Equal(t, "password", server.connectOptions[0].Pass)
+	assert.Equal(t, "cogment-model-registry", server.connectOptions[0].Name)
+}
+
+func TestPublisherReconnects(t *testing.T) {
+	server := startFakeNATSServer(t, 2, 0, nil)
+	publisher := startPublisher(t, Configuration{
+		URL:              "nats://token@" + server.listener.Addr().String(),
+		Subject:          "registry",
+		Encoding:         ProtobufEncoding,
+		ReconnectBackoff: 10 * time.Millisecond,
+	})
+	publisher.VersionEvent(extensionsapi.VersionEventType_VERSION_DELETED, backend.VersionInfo{ModelID: "foo", VersionNumber: 2})
+
+	// The event isn't acknowledged by the first connections, it is published again once connected again
+	assert.Eventually(t, func() bool {
+		return len(server.receivedMessages()) == 1
+	}, time.Second, 10*time.Millisecond)
+	message := server.receivedMessages()[0]
+	assert.Equal(t, "registry.version_deleted", message.subject)
+	event := &extensionsapi.WatchRegistryReply{}
+	assert.NoError(t, proto.Unmarshal(message.payload, event))
+	assert.Equal(t, extensionsapi.VersionEventType_VERSION_DELETED, event.GetVersionEvent().GetEventType())
+	assert.Equal(t, uint32(2), event.GetVersionEvent().GetVersionInfo().GetVersionNumber())
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	assert.Len(t, server.connectOptions, 3)
+	assert.Equal(t, "token", server.connectOptions[0].AuthToken)
+}
+
+// createTestTLSConfigs creates the TLS configurations of a server with a self signed certificate for 127.0.0.1 and
+// of a client trusting it
+func createTestTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(certificate)
+	serverConfig := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return serverConfig, &tls.Config{RootCAs: roots}
+}
+
+func TestPublisherTLS(t *testing.T) {
+	serverTLSConfig, clientTLSConfig := createTestTLSConfigs(t)
+	server := startFakeNATSServer(t, 0, 0, serverTLSConfig)
+	for _, scheme := range []string{"tls", "nats"} {
+		// The connection is upgraded after the plaintext INFO, for `tls://` URLs or because the server requires it
+		publisher, err := CreatePublisher(Configuration{URL: scheme + "://" + server.listener.Addr().String(), Subject: scheme, Encoding: JSONEncoding})
+		assert.NoError(t, err)
+		publisher.tlsConfig = clientTLSConfig
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go publisher.Run(ctx)
+		publisher.ModelEvent(extensionsapi.ModelEventType_MODEL_CREATED, backend.ModelInfo{ModelID: "foo"})
+		assert.Eventually(t, func() bool {
+			for _, message := range server.receivedMessages() {
+				if message.subject == scheme+".model_created" {
+					return true
+				}
+			}
+			return false
+		}, time.Second, 10*time.Millisecond, scheme)
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	assert.True(t, server.connectOptions[0].TLSRequired)
+
+	// A `tls://` URL requires the server to support TLS
+	plaintextServer := startFakeNATSServer(t, 0, 0, nil)
+	serverURL, err := url.Parse("tls://" + plaintextServer.listener.Addr().String())
+	assert.NoError(t, err)
+	_, err = dialNATS(context.Background(), serverURL, clientTLSConfig, time.Second)
+	assert.Error(t, err)
+}
+
+func TestPublisherDropsOversizedEvents(t *testing.T) {
+	server := startFakeNATSServer(t, 0, 256, nil)
+	publisher := startPublisher(t, Configuration{
+		URL:      "nats://" + server.listener.Addr().String(),
+		Subject:  "registry",
+		Encoding: JSONEncoding,
+	})
+	droppedEvents := expvar.Get("event_bus_dropped_events").(*expvar.Int).Value()
+	publisher.ModelEvent(extensionsapi.ModelEventType_MODEL_CREATED, backend.ModelInfo{ModelID: "foo", UserData: map[string]string{"description": strings.Repeat("a", 512)}})
+	publisher.ModelEvent(extensionsapi.ModelEventType_MODEL_DELETED, backend.ModelInfo{ModelID: "foo"})
+
+	// The oversized event is dropped instead of being published again forever, the following events are published
+	assert.Eventually(t, func() bool {
+		return len(server.receivedMessages()) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "registry.model_deleted", server.receivedMessages()[0].subject)
+	assert.Equal(t, droppedEvents+1, expvar.Get("event_bus_dropped_events").(*expvar.Int).Value())
+}
+
+func TestCreatePublisher(t *testing.T) {
+	_, err := CreatePublisher(Configuration{URL: "kafka://localhost:9092", Subject: "registry", Encoding: JSONEncoding})
+	assert.IsType(t, &UnsupportedEventBusError{}, err)
+	_, err = CreatePublisher(Configuration{URL: "nats://localhost:4222", Subject: "registry", Encoding: "avro"})
+	assert.Error(t, err)
+	_, err = CreatePublisher(Configuration{URL: "nats://localhost:4222", Encoding: JSONEncoding})
+	assert.Error(t, err)
+}
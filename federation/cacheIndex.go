@@ -0,0 +1,95 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package federation
+
+import (
+	"container/list"
+	"time"
+)
+
+type versionKey struct {
+	modelID       string
+	versionNumber uint
+}
+
+type cachedVersion struct {
+	key      versionKey
+	dataSize int64
+}
+
+// cacheIndex keeps track of the time the cached models were last refreshed from their upstream and of the use of the
+// cached versions, evicting the least recently used ones beyond a total data size, it isn't safe for concurrent use
+type cacheIndex struct {
+	maxBytes  int64 // No limit when 0
+	bytes     int64
+	refreshed map[string]time.Time // Last successful retrieval from their upstream, by model id
+	elements  map[versionKey]*list.Element
+	order     *list.List // From the most to the least recently used version
+}
+
+func createCacheIndex(maxBytes int64) *cacheIndex {
+	return &cacheIndex{
+		maxBytes:  maxBytes,
+		refreshed: make(map[string]time.Time),
+		elements:  make(map[versionKey]*list.Element),
+		order:     list.New(),
+	}
+}
+
+// use marks a cached version as the most recently used, adding it if needed, and returns the least recently used
+// versions to evict beyond the maximum size. A version larger than the maximum size is returned right away.
+func (c *cacheIndex) use(key versionKey, dataSize int64) []versionKey {
+	if c.maxBytes <= 0 {
+		return nil
+	}
+	if element, ok := c.elements[key]; ok {
+		c.order.MoveToFront(element)
+		version := element.Value.(*cachedVersion)
+		c.bytes += dataSize - version.dataSize
+		version.dataSize = dataSize
+	} else {
+		c.elements[key] = c.order.PushFront(&cachedVersion{key: key, dataSize: dataSize})
+		c.bytes += dataSize
+	}
+	evicted := []versionKey{}
+	for c.bytes > c.maxBytes {
+		version := c.removeElement(c.order.Back())
+		evicted = append(evicted, version.key)
+	}
+	return evicted
+}
+
+func (c *cacheIndex) remove(key versionKey) {
+	if element, ok := c.elements[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+// removeModel forgets a model and every one of its versions
+func (c *cacheIndex) removeModel(modelID string) {
+	delete(c.refreshed, modelID)
+	for key, element := range c.elements {
+		if key.modelID == modelID {
+			c.removeElement(element)
+		}
+	}
+}
+
+func (c *cacheIndex) removeElement(element *list.Element) *cachedVersion {
+	version := c.order.Remove(element).(*cachedVersion)
+	delete(c.elements, version.key)
+	c.bytes -= version.dataSize
+	return version
+}
@@ -0,0 +1,821 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package federation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/client"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// UpstreamUserDataKey is the model user data key holding the address of the upstream registry a proxied model is served
+// from, it is set by the federated backend and can't be set on the local models
+const UpstreamUserDataKey = "cogment_model_registry.upstream"
+
+// DefaultTimeout is the maximum duration of a call to an upstream registry when the configuration doesn't define it
+const DefaultTimeout = 30 * time.Second
+
+// Metrics published by every federated backend under `/debug/vars`
+var (
+	upstreamCallsMetric   = expvar.NewInt("federation_upstream_calls")
+	cachedVersionsMetric  = expvar.NewInt("federation_cached_versions")
+	staleRetrievalsMetric = expvar.NewInt("federation_stale_retrievals")
+	freshRetrievalsMetric = expvar.NewInt("federation_fresh_retrievals")
+	evictedVersionsMetric = expvar.NewInt("federation_evicted_versions")
+	cachedBytesMetric     = expvar.NewInt("federation_cached_bytes")
+)
+
+// Upstream is a registry serving the models the local backend doesn't know
+type Upstream struct {
+	Address string // Identifies the upstream in the user data of the proxied models
+	Client  *client.Client
+}
+
+type Configuration struct {
+	Cache         bool          // Whether the versions whose data is retrieved from an upstream are stored in the local backend
+	CacheTTL      time.Duration // Duration a cached model is served without calling its upstream once refreshed, never when 0
+	CacheMaxBytes int64         // Total data size of the cached versions beyond which the least recently used are evicted, no limit when 0
+	Timeout       time.Duration // Maximum duration of a call to an upstream, DefaultTimeout when 0
+}
+
+// ProxiedModelError is raised when trying to change a model served from an upstream registry
+type ProxiedModelError struct {
+	ModelID  string
+	Upstream string
+}
+
+func (e *ProxiedModelError) Error() string {
+	return fmt.Sprintf("model %q is served from the upstream registry at %q, it can only be changed there", e.ModelID, e.Upstream)
+}
+
+// GRPCStatus rejects the change with FAILED_PRECONDITION, as a follower does
+func (e *ProxiedModelError) GRPCStatus() *status.Status {
+	return status.New(codes.FailedPrecondition, e.Error())
+}
+
+// ParseUpstreamAddresses parses a comma separated list of upstream registry addresses
+func ParseUpstreamAddresses(value string) []string {
+	addresses := []string{}
+	for _, address := range strings.Split(value, ",") {
+		address = strings.TrimSpace(address)
+		if address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// route tells where a model is served from
+type route struct {
+	upstream       *Upstream         // Nil for the local models
+	cached         bool              // Whether the proxied model is cached in the local backend
+	cachedUserData map[string]string // User data of the cached model
+}
+
+// federationState is shared by a federated backend and the views bound to a context
+type federationState struct {
+	mutex  sync.Mutex
+	routes map[string]int // Index of the upstream serving the proxied models that aren't cached, by model id
+	cache  *cacheIndex
+	now    func() time.Time
+}
+
+type federatedBackend struct {
+	*federationState
+	backend       backend.Backend
+	upstreams     []Upstream
+	configuration Configuration
+	ctx           context.Context // Nil unless bound to a context
+}
+
+// CreateBackend creates a backend serving the models of another backend and proxying the retrievals of the models it
+// doesn't know to upstream registries, asked in order
+//
+// With caching, the versions whose data is retrieved from an upstream are stored in the local backend along with their
+// model, their data is then read from there while their info is still retrieved from the upstream. The cached models
+// are served from the local backend while their upstream is unreachable. The proxied models can't be changed, deleting
+// a cached model or version only evicts it from the cache. The models are only listed from the local backend. The
+// underlying backend is not destroyed with the created backend, the clients of the upstreams are closed.
+//
+// With a cache TTL, a cached model is served from the local backend without calling its upstream for this duration
+// after it was last retrieved from there, only the versions that aren't cached are then retrieved from the upstream.
+// With a maximum cache size, the versions already cached in the local backend are taken into account and the least
+// recently used versions are evicted beyond this size, the versions larger than this size aren't cached.
+func CreateBackend(b backend.Backend, upstreams []Upstream, configuration Configuration) (backend.Backend, error) {
+	if len(upstreams) == 0 {
+		return nil, errors.New("unable to create the federated backend, no upstream registry defined")
+	}
+	if configuration.Timeout <= 0 {
+		configuration.Timeout = DefaultTimeout
+	}
+	federated := &federatedBackend{
+		federationState: &federationState{
+			routes: make(map[string]int),
+			cache:  createCacheIndex(configuration.CacheMaxBytes),
+			now:    time.Now,
+		},
+		backend:       b,
+		upstreams:     upstreams,
+		configuration: configuration,
+	}
+	if configuration.Cache && configuration.CacheMaxBytes > 0 {
+		if err := federated.indexCachedVersions(); err != nil {
+			return nil, err
+		}
+	}
+	return federated, nil
+}
+
+// indexCachedVersions tracks the versions cached in the local backend before its creation, as the least recently used
+func (b *federatedBackend) indexCachedVersions() error {
+	modelInfos, err := b.backend.ListModels(0, 0)
+	if err != nil {
+		return fmt.Errorf("unable to list the cached models: %w", err)
+	}
+	for _, modelInfo := range modelInfos {
+		if b.lookupUpstream(modelInfo.UserData[UpstreamUserDataKey]) == nil {
+			continue
+		}
+		versionInfos, err := b.backend.ListModelVersionInfos(modelInfo.ModelID, 0, 0)
+		if err != nil {
+			return fmt.Errorf("unable to list the cached versions of model %q: %w", modelInfo.ModelID, err)
+		}
+		for _, versionInfo := range versionInfos {
+			b.useCachedVersion(versionInfo.ModelID, versionInfo.VersionNumber, int64(versionInfo.DataSize))
+		}
+	}
+	return nil
+}
+
+func (b *federatedBackend) Destroy() {
+	for _, upstream := range b.upstreams {
+		upstream.Client.Close()
+	}
+}
+
+// BindContext binds the local backend and the calls to the upstreams to the context, the bound view shares the routes
+// and the cache index
+func (b *federatedBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	boundBackend, ok := backend.BindContext(b.backend, ctx)
+	if !ok {
+		return nil, false
+	}
+	return &federatedBackend{
+		federationState: b.federationState,
+		backend:         boundBackend,
+		upstreams:       b.upstreams,
+		configuration:   b.configuration,
+		ctx:             ctx,
+	}, true
+}
+
+func (b *federatedBackend) Ping() error {
+	return b.backend.Ping()
+}
+
+func (b *federatedBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	return b.backend.RetrieveStorageCapacity()
+}
+
+func isNotFound(err error) bool {
+	return status.Code(err) == codes.NotFound
+}
+
+// isUnreachable tells whether an upstream failed to answer, the cached models are then served from the local backend
+func isUnreachable(err error) bool {
+	code := status.Code(err)
+	return code == codes.Unavailable || code == codes.DeadlineExceeded
+}
+
+func userDataEqual(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if otherValue, ok := b[key]; !ok || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+func withoutUpstream(userData map[string]string) map[string]string {
+	localUserData := make(map[string]string, len(userData))
+	for key, value := range userData {
+		if key != UpstreamUserDataKey {
+			localUserData[key] = value
+		}
+	}
+	return localUserData
+}
+
+func createProxiedModelInfo(upstream *Upstream, modelInfo client.ModelInfo) backend.ModelInfo {
+	userData := make(map[string]string, len(modelInfo.UserData)+1)
+	for key, value := range modelInfo.UserData {
+		userData[key] = value
+	}
+	userData[UpstreamUserDataKey] = upstream.Address
+	return backend.ModelInfo{ModelID: modelInfo.ModelID, UserData: userData}
+}
+
+func createProxiedVersionInfo(versionInfo client.VersionInfo) backend.VersionInfo {
+	return backend.VersionInfo{
+		ModelID:           versionInfo.ModelID,
+		VersionNumber:     versionInfo.VersionNumber,
+		CreationTimestamp: versionInfo.CreationTimestamp,
+		Archived:          versionInfo.Archived,
+		DataHash:          versionInfo.DataHash,
+		DataSize:          int(versionInfo.DataSize),
+		UserData:          versionInfo.UserData,
+	}
+}
+
+func upstreamError(upstream *Upstream, modelID string, err error) error {
+	return fmt.Errorf("unable to retrieve model %q from the upstream registry at %q: %w", modelID, upstream.Address, err)
+}
+
+// call calls an upstream within the configured timeout, stopping earlier when the bound context is done
+func (b *federatedBackend) call(f func(ctx context.Context) error) error {
+	upstreamCallsMetric.Add(1)
+	parent := b.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, b.configuration.Timeout)
+	defer cancel()
+	return f(ctx)
+}
+
+func (b *federatedBackend) lookupUpstream(address string) *Upstream {
+	for index := range b.upstreams {
+		if b.upstreams[index].Address == address {
+			return &b.upstreams[index]
+		}
+	}
+	return nil
+}
+
+// resolveLocal finds the models of the local backend, cached or not, false if the local backend doesn't know the model
+//
+// A cached model whose upstream is no longer configured is a local model.
+func (b *federatedBackend) resolveLocal(modelID string) (route, bool, error) {
+	modelInfo, err := b.backend.RetrieveModelInfo(modelID)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return route{}, false, nil
+		}
+		return route{}, false, err
+	}
+	upstream := b.lookupUpstream(modelInfo.UserData[UpstreamUserDataKey])
+	if upstream == nil {
+		return route{}, true, nil
+	}
+	return route{upstream: upstream, cached: true, cachedUserData: modelInfo.UserData}, true, nil
+}
+
+// locate finds the first upstream knowing a model that isn't cached, an upstream failing to answer is skipped but its
+// error is returned if no other upstream knows the model
+func (b *federatedBackend) locate(modelID string) (*Upstream, error) {
+	b.mutex.Lock()
+	index, ok := b.routes[modelID]
+	b.mutex.Unlock()
+	if ok {
+		return &b.upstreams[index], nil
+	}
+
+	var upstreamErr error
+	for index := range b.upstreams {
+		upstream := &b.upstreams[index]
+		err := b.call(func(ctx context.Context) error {
+			_, err := upstream.Client.RetrieveModelInfo(ctx, modelID)
+			return err
+		})
+		if err == nil {
+			b.mutex.Lock()
+			b.routes[modelID] = index
+			b.mutex.Unlock()
+			return upstream, nil
+		}
+		if !isNotFound(err) && upstreamErr == nil {
+			upstreamErr = upstreamError(upstream, modelID, err)
+		}
+	}
+	if upstreamErr != nil {
+		return nil, upstreamErr
+	}
+	return nil, &backend.UnknownModelError{ModelID: modelID}
+}
+
+// resolve finds where a model is served from, the local backend first then the upstreams
+func (b *federatedBackend) resolve(modelID string) (route, error) {
+	r, found, err := b.resolveLocal(modelID)
+	if err != nil || found {
+		return r, err
+	}
+	upstream, err := b.locate(modelID)
+	if err != nil {
+		return route{}, err
+	}
+	return route{upstream: upstream}, nil
+}
+
+func (b *federatedBackend) forget(modelID string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.routes, modelID)
+}
+
+// fresh tells whether a cached model was retrieved from its upstream within the cache TTL, it is then served from the
+// local backend
+func (b *federatedBackend) fresh(r route, modelID string) bool {
+	if !r.cached || b.configuration.CacheTTL <= 0 {
+		return false
+	}
+	b.mutex.Lock()
+	refreshed, ok := b.cache.refreshed[modelID]
+	b.mutex.Unlock()
+	return ok && b.now().Sub(refreshed) < b.configuration.CacheTTL
+}
+
+// refreshed records that a cached model was just retrieved from its upstream
+func (b *federatedBackend) refreshed(r route, modelID string) {
+	if !r.cached || b.configuration.CacheTTL <= 0 {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.cache.refreshed[modelID] = b.now()
+}
+
+// useCachedVersion marks a cached version as the most recently used and evicts the least recently used versions beyond
+// the maximum cache size
+func (b *federatedBackend) useCachedVersion(modelID string, versionNumber uint, dataSize int64) {
+	b.mutex.Lock()
+	evicted := b.cache.use(versionKey{modelID: modelID, versionNumber: versionNumber}, dataSize)
+	cachedBytesMetric.Set(b.cache.bytes)
+	b.mutex.Unlock()
+	for _, key := range evicted {
+		if err := b.backend.DeleteModelVersion(key.modelID, int(key.versionNumber)); err != nil && !errors.Is(err, backend.ErrNotFound) {
+			logrus.WithFields(logrus.Fields{"model_id": key.modelID, "version_number": key.versionNumber}).WithError(err).Warn("Unable to evict a cached version")
+			continue
+		}
+		evictedVersionsMetric.Add(1)
+	}
+}
+
+// uncache forgets the cached versions of a model, or one of them when versionNumber is positive, once deleted from the
+// local backend
+func (b *federatedBackend) uncache(modelID string, versionNumber int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if versionNumber > 0 {
+		b.cache.remove(versionKey{modelID: modelID, versionNumber: uint(versionNumber)})
+	} else {
+		b.cache.removeModel(modelID)
+	}
+	cachedBytesMetric.Set(b.cache.bytes)
+}
+
+// modelDeleted tells whether the upstream of a model no longer knows it, e.g. after one of its versions wasn't found
+func (b *federatedBackend) modelDeleted(r route, modelID string, err error) bool {
+	if client.ErrorReason(err) == extensionsapi.ErrorReason_MODEL_NOT_FOUND {
+		return true
+	}
+	err = b.call(func(ctx context.Context) error {
+		_, err := r.upstream.Client.RetrieveModelInfo(ctx, modelID)
+		return err
+	})
+	return isNotFound(err)
+}
+
+// notFound handles a model, or a version when versionNumber isn't 0, its upstream doesn't know, or no longer knows,
+// it is evicted from the cache
+func (b *federatedBackend) notFound(r route, modelID string, versionNumber int, err error) error {
+	if versionNumber == 0 || b.modelDeleted(r, modelID, err) {
+		b.forget(modelID)
+		if r.cached {
+			if err := b.backend.DeleteModel(modelID); err != nil && !errors.Is(err, backend.ErrNotFound) {
+				logrus.WithField("model_id", modelID).WithError(err).Warn("Unable to evict a model deleted from its upstream registry")
+			}
+			b.uncache(modelID, 0)
+		}
+		return &backend.UnknownModelError{ModelID: modelID}
+	}
+	if r.cached && versionNumber > 0 {
+		if err := b.backend.DeleteModelVersion(modelID, versionNumber); err != nil && !errors.Is(err, backend.ErrNotFound) {
+			logrus.WithFields(logrus.Fields{"model_id": modelID, "version_number": versionNumber}).WithError(err).Warn("Unable to evict a version deleted from its upstream registry")
+		}
+		b.uncache(modelID, versionNumber)
+	}
+	return &backend.UnknownModelVersionError{ModelID: modelID, VersionNumber: versionNumber}
+}
+
+// failed handles the failure of a call to the upstream of a model, about one of its versions when versionNumber isn't
+// 0, it returns true if the cached model is served instead
+func (b *federatedBackend) failed(r route, modelID string, versionNumber int, err error) (bool, error) {
+	if isNotFound(err) {
+		return false, b.notFound(r, modelID, versionNumber, err)
+	}
+	if r.cached && isUnreachable(err) {
+		staleRetrievalsMetric.Add(1)
+		logrus.WithField("model_id", modelID).WithError(err).Debug("Upstream registry unreachable, serving the cached model")
+		return true, nil
+	}
+	return false, upstreamError(r.upstream, modelID, err)
+}
+
+// checkChangeable rejects the changes of the proxied models, unless evicting is set and the model is cached
+//
+// A model unknown to every reachable upstream is local.
+func (b *federatedBackend) checkChangeable(modelID string, evicting bool) error {
+	r, found, err := b.resolveLocal(modelID)
+	if err != nil {
+		return err
+	}
+	if found {
+		if r.cached && !evicting {
+			return &ProxiedModelError{ModelID: modelID, Upstream: r.upstream.Address}
+		}
+		return nil
+	}
+	if upstream, err := b.locate(modelID); err == nil {
+		return &ProxiedModelError{ModelID: modelID, Upstream: upstream.Address}
+	}
+	return nil
+}
+
+// cacheVersion stores a version retrieved from an upstream in the local backend, creating its model if needed, a
+// failure only prevents the version from being cached
+func (b *federatedBackend) cacheVersion(r route, versionInfo backend.VersionInfo, data []byte) {
+	log := logrus.WithFields(logrus.Fields{"model_id": versionInfo.ModelID, "version_number": versionInfo.VersionNumber})
+	if b.configuration.CacheMaxBytes > 0 && int64(len(data)) > b.configuration.CacheMaxBytes {
+		log.Debug("Version larger than the cache, not caching it")
+		return
+	}
+	if !r.cached {
+		var modelInfo client.ModelInfo
+		err := b.call(func(ctx context.Context) error {
+			var err error
+			modelInfo, err = r.upstream.Client.RetrieveModelInfo(ctx, versionInfo.ModelID)
+			return err
+		})
+		if err == nil {
+			_, err = b.backend.CreateOrUpdateModel(createProxiedModelInfo(r.upstream, modelInfo))
+		}
+		if err != nil {
+			log.WithError(err).Warn("Unable to cache a version retrieved from an upstream registry")
+			return
+		}
+		b.forget(versionInfo.ModelID)
+		r = route{upstream: r.upstream, cached: true}
+		b.refreshed(r, versionInfo.ModelID)
+	}
+	_, err := b.backend.CreateOrUpdateModelVersion(versionInfo.ModelID, backend.VersionArgs{
+		VersionNumber:     versionInfo.VersionNumber,
+		CreationTimestamp: versionInfo.CreationTimestamp,
+		Archived:          versionInfo.Archived,
+		DataHash:          versionInfo.DataHash,
+		Data:              data,
+		UserData:          versionInfo.UserData,
+	})
+	if err != nil {
+		log.WithError(err).Warn("Unable to cache a version retrieved from an upstream registry")
+		return
+	}
+	cachedVersionsMetric.Add(1)
+	b.useCachedVersion(versionInfo.ModelID, versionInfo.VersionNumber, int64(len(data)))
+}
+
+func (b *federatedBackend) CreateOrUpdateModel(modelInfo backend.ModelInfo) (backend.ModelInfo, error) {
+	if err := b.checkChangeable(modelInfo.ModelID, false); err != nil {
+		return backend.ModelInfo{}, err
+	}
+	return b.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: modelInfo.ModelID, UserData: withoutUpstream(modelInfo.UserData)})
+}
+
+func (b *federatedBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	r, err := b.resolve(modelID)
+	if err != nil {
+		return backend.ModelInfo{}, err
+	}
+	if r.upstream == nil {
+		return b.backend.RetrieveModelInfo(modelID)
+	}
+	if b.fresh(r, modelID) {
+		freshRetrievalsMetric.Add(1)
+		return b.backend.RetrieveModelInfo(modelID)
+	}
+	var modelInfo client.ModelInfo
+	err = b.call(func(ctx context.Context) error {
+		var err error
+		modelInfo, err = r.upstream.Client.RetrieveModelInfo(ctx, modelID)
+		return err
+	})
+	if err != nil {
+		if stale, err := b.failed(r, modelID, 0, err); !stale {
+			return backend.ModelInfo{}, err
+		}
+		return b.backend.RetrieveModelInfo(modelID)
+	}
+	b.refreshed(r, modelID)
+	proxiedModelInfo := createProxiedModelInfo(r.upstream, modelInfo)
+	if r.cached && !userDataEqual(r.cachedUserData, proxiedModelInfo.UserData) {
+		if _, err := b.backend.CreateOrUpdateModel(proxiedModelInfo); err != nil {
+			logrus.WithField("model_id", modelID).WithError(err).Warn("Unable to update a cached model")
+		}
+	}
+	return proxiedModelInfo, nil
+}
+
+func (b *federatedBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	r, err := b.resolve(modelID)
+	if err != nil {
+		return 0, err
+	}
+	if r.upstream == nil {
+		return b.backend.RetrieveModelLatestVersionNumber(modelID)
+	}
+	if b.fresh(r, modelID) {
+		freshRetrievalsMetric.Add(1)
+		return b.backend.RetrieveModelLatestVersionNumber(modelID)
+	}
+	var versionInfo client.VersionInfo
+	err = b.call(func(ctx context.Context) error {
+		var err error
+		versionInfo, err = r.upstream.Client.RetrieveVersionInfo(ctx, modelID, -1)
+		return err
+	})
+	if err != nil {
+		if isNotFound(err) && !b.modelDeleted(r, modelID, err) {
+			return 0, &backend.UnknownModelVersionError{ModelID: modelID}
+		}
+		if stale, err := b.failed(r, modelID, 0, err); !stale {
+			return 0, err
+		}
+		return b.backend.RetrieveModelLatestVersionNumber(modelID)
+	}
+	b.refreshed(r, modelID)
+	return versionInfo.VersionNumber, nil
+}
+
+func (b *federatedBackend) HasModel(modelID string) (bool, error) {
+	_, err := b.resolve(modelID)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *federatedBackend) DeleteModel(modelID string) error {
+	if err := b.checkChangeable(modelID, true); err != nil {
+		return err
+	}
+	if err := b.backend.DeleteModel(modelID); err != nil {
+		return err
+	}
+	b.uncache(modelID, 0)
+	return nil
+}
+
+func (b *federatedBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.backend.ListModels(offset, limit)
+}
+
+func (b *federatedBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	return b.backend.QueryModels(filter, offset, limit)
+}
+
+func (b *federatedBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	if err := b.checkChangeable(modelID, false); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return b.backend.CreateOrUpdateModelVersion(modelID, versionArgs)
+}
+
+func (b *federatedBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	if err := b.checkChangeable(modelID, false); err != nil {
+		return nil, err
+	}
+	return b.backend.CreateOrUpdateModelVersionStream(modelID, versionArgs)
+}
+
+// retrieveProxiedVersionInfo retrieves the info of a version of a proxied model from its upstream, or from the cache
+// while the model is fresh or the upstream is unreachable
+func (b *federatedBackend) retrieveProxiedVersionInfo(r route, modelID string, versionNumber int) (backend.VersionInfo, error) {
+	if b.fresh(r, modelID) {
+		versionInfo, err := b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+		if err == nil {
+			freshRetrievalsMetric.Add(1)
+			return versionInfo, nil
+		}
+		if !errors.Is(err, backend.ErrNotFound) {
+			return backend.VersionInfo{}, err
+		}
+	}
+	var versionInfo client.VersionInfo
+	err := b.call(func(ctx context.Context) error {
+		var err error
+		versionInfo, err = r.upstream.Client.RetrieveVersionInfo(ctx, modelID, versionNumber)
+		return err
+	})
+	if err != nil {
+		if stale, err := b.failed(r, modelID, versionNumber, err); !stale {
+			return backend.VersionInfo{}, err
+		}
+		return b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+	}
+	b.refreshed(r, modelID)
+	return createProxiedVersionInfo(versionInfo), nil
+}
+
+// retrieveProxiedVersion retrieves a version of a proxied model and its data, read from the cache when it holds the
+// same data, otherwise retrieved from the upstream and cached if enabled
+func (b *federatedBackend) retrieveProxiedVersion(r route, modelID string, versionNumber int) (backend.VersionInfo, []byte, error) {
+	versionInfo, err := b.retrieveProxiedVersionInfo(r, modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, nil, err
+	}
+	if r.cached {
+		cachedVersionInfo, err := b.backend.RetrieveModelVersionInfo(modelID, int(versionInfo.VersionNumber))
+		if err == nil && cachedVersionInfo.DataHash == versionInfo.DataHash {
+			data, err := b.backend.RetrieveModelVersionData(modelID, int(versionInfo.VersionNumber))
+			if err == nil {
+				b.useCachedVersion(modelID, versionInfo.VersionNumber, int64(len(data)))
+				return versionInfo, data, nil
+			}
+			logrus.WithFields(logrus.Fields{"model_id": modelID, "version_number": versionInfo.VersionNumber}).WithError(err).Warn("Unable to read a cached version, retrieving it from its upstream registry")
+		}
+	}
+
+	data := bytes.Buffer{}
+	err = b.call(func(ctx context.Context) error {
+		_, err := r.upstream.Client.RetrieveVersionData(ctx, modelID, int(versionInfo.VersionNumber), &data, true)
+		return err
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return backend.VersionInfo{}, nil, b.notFound(r, modelID, int(versionInfo.VersionNumber), err)
+		}
+		return backend.VersionInfo{}, nil, upstreamError(r.upstream, modelID, err)
+	}
+	if b.configuration.Cache {
+		b.cacheVersion(r, versionInfo, data.Bytes())
+	}
+	return versionInfo, data.Bytes(), nil
+}
+
+func (b *federatedBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	r, err := b.resolve(modelID)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	if r.upstream == nil {
+		return b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+	}
+	return b.retrieveProxiedVersionInfo(r, modelID, versionNumber)
+}
+
+func (b *federatedBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	r, err := b.resolve(modelID)
+	if err != nil {
+		return nil, err
+	}
+	if r.upstream == nil {
+		return b.backend.RetrieveModelVersionData(modelID, versionNumber)
+	}
+	_, data, err := b.retrieveProxiedVersion(r, modelID, versionNumber)
+	return data, err
+}
+
+func (b *federatedBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	r, err := b.resolve(modelID)
+	if err != nil {
+		return nil, err
+	}
+	if r.upstream == nil {
+		return b.backend.RetrieveModelVersionDataRange(modelID, versionNumber, offset, length)
+	}
+	_, data, err := b.retrieveProxiedVersion(r, modelID, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+	return backend.SliceDataRange(modelID, versionNumber, data, offset, length)
+}
+
+// OpenModelVersionData opens the data of the local versions if the local backend is able to, the data of the proxied
+// versions is retrieved once and read from memory
+func (b *federatedBackend) OpenModelVersionData(modelID string, versionNumber int) (backend.VersionInfo, backend.VersionDataReader, bool, error) {
+	r, err := b.resolve(modelID)
+	if err != nil {
+		return backend.VersionInfo{}, nil, false, err
+	}
+	if r.upstream == nil {
+		return backend.OpenModelVersionData(b.backend, modelID, versionNumber)
+	}
+	versionInfo, data, err := b.retrieveProxiedVersion(r, modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, nil, false, err
+	}
+	return versionInfo, backend.CreateBytesVersionDataReader(data), true, nil
+}
+
+func (b *federatedBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	if err := b.checkChangeable(modelID, false); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return b.backend.UpdateModelVersionArchived(modelID, versionNumber, archived)
+}
+
+func (b *federatedBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	if err := b.checkChangeable(modelID, false); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return b.backend.UpdateModelVersionUserData(modelID, versionNumber, userData)
+}
+
+func (b *federatedBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	if err := b.checkChangeable(modelID, true); err != nil {
+		return err
+	}
+	if err := b.backend.DeleteModelVersion(modelID, versionNumber); err != nil {
+		return err
+	}
+	b.uncache(modelID, versionNumber)
+	return nil
+}
+
+func (b *federatedBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	r, err := b.resolve(modelID)
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+	if r.upstream == nil {
+		return b.backend.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+	}
+	if b.fresh(r, modelID) {
+		freshRetrievalsMetric.Add(1)
+		return b.backend.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+	}
+	versionInfos := []backend.VersionInfo{}
+	err = b.call(func(ctx context.Context) error {
+		versions := r.upstream.Client.Versions(ctx, modelID)
+		for versions.Next() {
+			versionInfo := versions.VersionInfo()
+			if versionInfo.VersionNumber < initialVersionNumber {
+				continue
+			}
+			versionInfos = append(versionInfos, createProxiedVersionInfo(versionInfo))
+			if limit > 0 && len(versionInfos) >= limit {
+				return nil
+			}
+		}
+		return versions.Err()
+	})
+	if err != nil {
+		if stale, err := b.failed(r, modelID, 0, err); !stale {
+			return []backend.VersionInfo{}, err
+		}
+		return b.backend.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+	}
+	b.refreshed(r, modelID)
+	return versionInfos, nil
+}
+
+func (b *federatedBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	r, err := b.resolve(modelID)
+	if err != nil {
+		return []backend.VersionInfo{}, err
+	}
+	if r.upstream == nil {
+		return b.backend.QueryModelVersionInfos(modelID, filter, initialVersionNumber, limit)
+	}
+	return backend.QueryModelVersionInfosByListing(b, modelID, filter, initialVersionNumber, limit)
+}
@@ -0,0 +1,301 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package federation
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+type upstreamRegistry struct {
+	upstream Upstream
+	backend  backend.Backend
+	server   *grpc.Server
+}
+
+// startUpstream starts a model registry server on a local port and returns an upstream connected to it
+func startUpstream(t *testing.T) upstreamRegistry {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	t.Cleanup(server.Stop)
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(b.Destroy)
+	modelRegistryServer, err := grpcservers.RegisterModelRegistryServer(server, grpcservers.ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 16,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+	})
+	assert.NoError(t, err)
+	modelRegistryServer.SetBackend(b)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	c, err := client.CreateClient(context.Background(), client.Configuration{Address: listener.Addr().String()})
+	assert.NoError(t, err)
+	return upstreamRegistry{
+		upstream: Upstream{Address: listener.Addr().String(), Client: c},
+		backend:  b,
+		server:   server,
+	}
+}
+
+func createFederatedBackend(t *testing.T, configuration Configuration, upstreams ...upstreamRegistry) (backend.Backend, backend.Backend) {
+	local, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(local.Destroy)
+	federatedUpstreams := []Upstream{}
+	for _, upstream := range upstreams {
+		federatedUpstreams = append(federatedUpstreams, upstream.upstream)
+	}
+	b, err := CreateBackend(local, federatedUpstreams, configuration)
+	assert.NoError(t, err)
+	t.Cleanup(b.Destroy)
+	return b, local
+}
+
+func createVersion(t *testing.T, b backend.Backend, modelID string, data []byte) {
+	_, err := b.CreateOrUpdateModelVersion(modelID, backend.VersionArgs{
+		CreationTimestamp: time.Now(),
+		DataHash:          backend.ComputeSHA256Hash(data),
+		Data:              data,
+		UserData:          map[string]string{"step": "10"},
+	})
+	assert.NoError(t, err)
+}
+
+func TestProxiedRetrievals(t *testing.T) {
+	first := startUpstream(t)
+	second := startUpstream(t)
+	_, err := first.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{"type": "policy"}})
+	assert.NoError(t, err)
+	createVersion(t, first.backend, "foo", data)
+	createVersion(t, first.backend, "foo", data[:10])
+	// The first upstream knowing a model serves it
+	_, err = second.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{}})
+	assert.NoError(t, err)
+	_, err = second.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "bar", UserData: map[string]string{}})
+	assert.NoError(t, err)
+	createVersion(t, second.backend, "bar", data)
+
+	b, local := createFederatedBackend(t, Configuration{Timeout: 5 * time.Second}, first, second)
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "baz", UserData: map[string]string{UpstreamUserDataKey: "elsewhere"}})
+	assert.NoError(t, err)
+	createVersion(t, b, "baz", data)
+
+	modelInfo, err := b.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"type": "policy", UpstreamUserDataKey: first.upstream.Address}, modelInfo.UserData)
+	modelInfo, err = b.RetrieveModelInfo("bar")
+	assert.NoError(t, err)
+	assert.Equal(t, second.upstream.Address, modelInfo.UserData[UpstreamUserDataKey])
+	modelInfo, err = b.RetrieveModelInfo("baz")
+	assert.NoError(t, err)
+	assert.Empty(t, modelInfo.UserData)
+	_, err = b.RetrieveModelInfo("qux")
+	assert.True(t, errors.As(err, new(*backend.UnknownModelError)))
+
+	hasModel, err := b.HasModel("foo")
+	assert.NoError(t, err)
+	assert.True(t, hasModel)
+	hasModel, err = b.HasModel("qux")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+
+	latestVersionNumber, err := b.RetrieveModelLatestVersionNumber("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), latestVersionNumber)
+	versionInfo, err := b.RetrieveModelVersionInfo("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, backend.ComputeSHA256Hash(data), versionInfo.DataHash)
+	assert.Equal(t, len(data), versionInfo.DataSize)
+	assert.Equal(t, "10", versionInfo.UserData["step"])
+	_, err = b.RetrieveModelVersionInfo("foo", 3)
+	assert.True(t, errors.As(err, new(*backend.UnknownModelVersionError)))
+	retrievedData, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, data, retrievedData)
+	retrievedData, err = b.RetrieveModelVersionDataRange("foo", 1, 6, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, data[6:11], retrievedData)
+	_, reader, opened, err := backend.OpenModelVersionData(b, "bar", -1)
+	assert.NoError(t, err)
+	assert.True(t, opened)
+	assert.NoError(t, reader.Close())
+
+	versionInfos, err := b.ListModelVersionInfos("foo", 2, 0)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 1)
+	assert.Equal(t, uint(2), versionInfos[0].VersionNumber)
+	versionInfos, err = b.QueryModelVersionInfos("foo", backend.VersionFilter{UserDataEquals: map[string]string{"step": "10"}}, 0, 1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 1)
+
+	// Without caching, nothing is stored locally and the proxied models can't be changed
+	hasModel, err = local.HasModel("foo")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Data: data})
+	assert.True(t, errors.As(err, new(*ProxiedModelError)))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "bar"})
+	assert.True(t, errors.As(err, new(*ProxiedModelError)))
+	assert.True(t, errors.As(b.DeleteModel("foo"), new(*ProxiedModelError)))
+	modelInfos, err := b.ListModels(0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, modelInfos, 1)
+
+	// Models deleted upstream aren't served anymore
+	assert.NoError(t, second.backend.DeleteModel("bar"))
+	_, err = b.RetrieveModelVersionInfo("bar", 1)
+	assert.True(t, errors.As(err, new(*backend.UnknownModelError)))
+}
+
+func TestCachedRetrievals(t *testing.T) {
+	upstream := startUpstream(t)
+	_, err := upstream.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{"type": "policy"}})
+	assert.NoError(t, err)
+	createVersion(t, upstream.backend, "foo", data)
+	createVersion(t, upstream.backend, "foo", data[:10])
+
+	b, local := createFederatedBackend(t, Configuration{Cache: true, Timeout: 5 * time.Second}, upstream)
+	retrievedData, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, data, retrievedData)
+	retrievedData, err = b.RetrieveModelVersionDataRange("foo", 2, 4, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, data[4:10], retrievedData)
+
+	// The versions are cached with their model
+	cachedModelInfo, err := local.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, upstream.upstream.Address, cachedModelInfo.UserData[UpstreamUserDataKey])
+	cachedVersionInfo, err := local.RetrieveModelVersionInfo("foo", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, backend.ComputeSHA256Hash(data[:10]), cachedVersionInfo.DataHash)
+	_, err = b.UpdateModelVersionArchived("foo", 1, true)
+	assert.True(t, errors.As(err, new(*ProxiedModelError)))
+
+	// The cache follows the changes made upstream
+	_, err = upstream.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{"type": "world_model"}})
+	assert.NoError(t, err)
+	modelInfo, err := b.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "world_model", modelInfo.UserData["type"])
+	cachedModelInfo, err = local.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "world_model", cachedModelInfo.UserData["type"])
+	assert.NoError(t, upstream.backend.DeleteModelVersion("foo", 2))
+	_, err = b.RetrieveModelVersionInfo("foo", 2)
+	assert.True(t, errors.As(err, new(*backend.UnknownModelVersionError)))
+	_, err = local.RetrieveModelVersionInfo("foo", 2)
+	assert.True(t, errors.As(err, new(*backend.UnknownModelVersionError)))
+
+	// The cached versions are served while the upstream is unreachable
+	upstream.server.Stop()
+	retrievedData, err = b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, data, retrievedData)
+	versionInfos, err := b.ListModelVersionInfos("foo", 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 1)
+
+	// Deleting a cached model evicts it
+	assert.NoError(t, b.DeleteModel("foo"))
+	hasModel, err := local.HasModel("foo")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+}
+
+func TestCacheExpirationAndEviction(t *testing.T) {
+	upstream := startUpstream(t)
+	for _, modelID := range []string{"foo", "bar"} {
+		_, err := upstream.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: modelID, UserData: map[string]string{}})
+		assert.NoError(t, err)
+		createVersion(t, upstream.backend, modelID, data)
+	}
+	createVersion(t, upstream.backend, "foo", data[:10])
+
+	b, local := createFederatedBackend(t, Configuration{
+		Cache:         true,
+		CacheTTL:      time.Minute,
+		CacheMaxBytes: int64(2 * len(data)),
+		Timeout:       5 * time.Second,
+	}, upstream)
+	now := time.Now()
+	b.(*federatedBackend).now = func() time.Time { return now }
+
+	_, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+
+	// While fresh, the cached model is served without calling the upstream, only the missing versions are retrieved
+	createVersion(t, upstream.backend, "foo", data[:20])
+	latestVersionNumber, err := b.RetrieveModelLatestVersionNumber("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), latestVersionNumber)
+	retrievedData, err := b.RetrieveModelVersionData("foo", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:10], retrievedData)
+
+	// Once expired, the cached model is refreshed from the upstream
+	now = now.Add(time.Minute)
+	latestVersionNumber, err = b.RetrieveModelLatestVersionNumber("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), latestVersionNumber)
+
+	// The least recently used versions are evicted beyond the maximum size
+	_, err = b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	_, err = b.RetrieveModelVersionData("bar", 1)
+	assert.NoError(t, err)
+	_, err = local.RetrieveModelVersionInfo("foo", 2)
+	assert.True(t, errors.As(err, new(*backend.UnknownModelVersionError)))
+	_, err = local.RetrieveModelVersionInfo("foo", 1)
+	assert.NoError(t, err)
+	_, err = local.RetrieveModelVersionInfo("bar", 1)
+	assert.NoError(t, err)
+
+	// The versions already cached are taken into account when the backend is created again
+	restarted, err := CreateBackend(local, []Upstream{upstream.upstream}, Configuration{Cache: true, CacheMaxBytes: int64(len(data))})
+	assert.NoError(t, err)
+	versionInfos, err := local.ListModelVersionInfos("foo", 0, 0)
+	assert.NoError(t, err)
+	barVersionInfos, err := local.ListModelVersionInfos("bar", 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, append(versionInfos, barVersionInfos...), 1)
+
+	// A version larger than the cache isn't cached
+	createVersion(t, upstream.backend, "foo", append(append([]byte{}, data...), data...))
+	_, err = restarted.RetrieveModelVersionData("foo", 4)
+	assert.NoError(t, err)
+	_, err = local.RetrieveModelVersionInfo("foo", 4)
+	assert.True(t, errors.As(err, new(*backend.UnknownModelVersionError)))
+}
@@ -0,0 +1,221 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsck
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// Number of models or versions listed at once while walking the backend
+const pageSize = 100
+
+// ProblemKind is the kind of inconsistency in the numbering of the versions of a model
+type ProblemKind string
+
+const (
+	DuplicateVersionNumber ProblemKind = "duplicate"    // Several versions are listed with the same number
+	MismatchedVersion      ProblemKind = "mismatch"     // The version retrieved under a number has another number
+	MissingVersions        ProblemKind = "gap"          // Numbers below the latest one have no version, usually because of deletions
+	StaleLatestVersion     ProblemKind = "stale_latest" // The latest version isn't the one with the highest number
+)
+
+// Problem describes an inconsistency in the numbering of the versions of a model
+type Problem struct {
+	Kind          ProblemKind
+	ModelID       string
+	VersionNumber uint
+	Description   string
+	Repaired      bool
+}
+
+// Report summarizes one check of the backend
+type Report struct {
+	CheckedModels   int
+	CheckedVersions int
+	Problems        []Problem
+}
+
+// Check walks the given models, or every model if none is given, and reports the inconsistencies in the numbering of their versions
+//
+// If repair is true, the mismatched and stale versions are rewritten under their number, which also resolves the duplicates
+// they caused. Gaps are never repaired, renumbering versions would break the references to them.
+func Check(b backend.Backend, modelIDs []string, repair bool) (Report, error) {
+	report := Report{}
+	if len(modelIDs) > 0 {
+		for _, modelID := range modelIDs {
+			if err := checkModel(b, modelID, repair, &report); err != nil {
+				return report, err
+			}
+		}
+		return report, nil
+	}
+	for modelOffset := 0; ; modelOffset += pageSize {
+		modelInfos, err := b.ListModels(modelOffset, pageSize)
+		if err != nil {
+			return report, fmt.Errorf("unable to list models: %w", err)
+		}
+		for _, modelInfo := range modelInfos {
+			if err := checkModel(b, modelInfo.ModelID, repair, &report); err != nil {
+				if errors.As(err, new(*backend.UnknownModelError)) {
+					// Deleted during the check
+					continue
+				}
+				return report, err
+			}
+		}
+		if len(modelInfos) < pageSize {
+			return report, nil
+		}
+	}
+}
+
+// listVersionNumbers counts how many times each version number of a model is listed
+func listVersionNumbers(b backend.Backend, modelID string) (map[uint]int, uint, int, error) {
+	listedVersionNumbers := map[uint]int{}
+	maxVersionNumber := uint(0)
+	listedCount := 0
+	for initialVersionNumber := uint(0); ; {
+		versionInfos, err := b.ListModelVersionInfos(modelID, initialVersionNumber, pageSize)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("unable to list the versions of model %q: %w", modelID, err)
+		}
+		for _, versionInfo := range versionInfos {
+			listedVersionNumbers[versionInfo.VersionNumber]++
+			if versionInfo.VersionNumber > maxVersionNumber {
+				maxVersionNumber = versionInfo.VersionNumber
+			}
+			listedCount++
+		}
+		if len(versionInfos) < pageSize || maxVersionNumber+1 <= initialVersionNumber {
+			return listedVersionNumbers, maxVersionNumber, listedCount, nil
+		}
+		initialVersionNumber = maxVersionNumber + 1
+	}
+}
+
+func checkModel(b backend.Backend, modelID string, repair bool, report *Report) error {
+	listedVersionNumbers, maxVersionNumber, listedCount, err := listVersionNumbers(b, modelID)
+	if err != nil {
+		return err
+	}
+	report.CheckedModels++
+	report.CheckedVersions += listedCount
+
+	problems := []Problem{}
+	addProblem := func(kind ProblemKind, versionNumber uint, description string, repairable bool) {
+		problem := Problem{Kind: kind, ModelID: modelID, VersionNumber: versionNumber, Description: description}
+		if repair && repairable {
+			if err := rewriteVersion(b, modelID, versionNumber); err != nil {
+				problem.Description = fmt.Sprintf("%s, unable to repair: %s", description, err)
+			} else {
+				problem.Repaired = true
+			}
+		}
+		problems = append(problems, problem)
+	}
+
+	// Each duplicate hides a version stored under another number, either in a gap or above the highest listed number
+	hiddenCount := listedCount - len(listedVersionNumbers)
+	gapStart := uint(0)
+	for versionNumber := uint(1); versionNumber <= maxVersionNumber+uint(hiddenCount); versionNumber++ {
+		versionListedCount := listedVersionNumbers[versionNumber]
+		if versionListedCount > 1 {
+			// Repaired once the hidden versions are
+			addProblem(DuplicateVersionNumber, versionNumber, fmt.Sprintf("version %d is listed %d times", versionNumber, versionListedCount), false)
+		}
+		missing := false
+		versionInfo, err := b.RetrieveModelVersionInfo(modelID, int(versionNumber))
+		if err != nil {
+			if !errors.As(err, new(*backend.UnknownModelVersionError)) {
+				addProblem(MismatchedVersion, versionNumber, fmt.Sprintf("version %d can't be retrieved: %s", versionNumber, err), false)
+			} else {
+				// Listed versions are deleted during the check
+				missing = versionListedCount == 0 && versionNumber < maxVersionNumber
+			}
+		} else if versionInfo.VersionNumber != versionNumber {
+			addProblem(MismatchedVersion, versionNumber, fmt.Sprintf("version %d is retrieved as version %d", versionNumber, versionInfo.VersionNumber), true)
+		} else if versionListedCount == 0 {
+			addProblem(MismatchedVersion, versionNumber, fmt.Sprintf("version %d is stored but not listed", versionNumber), true)
+		}
+
+		if missing && gapStart == 0 {
+			gapStart = versionNumber
+		} else if !missing && gapStart > 0 {
+			if versionNumber-1 == gapStart {
+				addProblem(MissingVersions, gapStart, fmt.Sprintf("version %d is missing", gapStart), false)
+			} else {
+				addProblem(MissingVersions, gapStart, fmt.Sprintf("versions %d to %d are missing", gapStart, versionNumber-1), false)
+			}
+			gapStart = 0
+		}
+	}
+
+	if maxVersionNumber > 0 {
+		latestVersionInfo, err := b.RetrieveModelVersionInfo(modelID, -1)
+		if err != nil {
+			if !errors.As(err, new(*backend.UnknownModelVersionError)) {
+				return fmt.Errorf("unable to retrieve the latest version of model %q: %w", modelID, err)
+			}
+		}
+		if latestVersionInfo.VersionNumber < maxVersionNumber {
+			addProblem(StaleLatestVersion, maxVersionNumber, fmt.Sprintf("the latest version is version %d instead of version %d", latestVersionInfo.VersionNumber, maxVersionNumber), true)
+		}
+	}
+
+	if repair && hiddenCount > 0 {
+		listedVersionNumbers, _, _, err := listVersionNumbers(b, modelID)
+		if err != nil {
+			return err
+		}
+		for index := range problems {
+			if problems[index].Kind == DuplicateVersionNumber {
+				problems[index].Repaired = listedVersionNumbers[problems[index].VersionNumber] == 1
+			}
+		}
+	}
+	report.Problems = append(report.Problems, problems...)
+	return nil
+}
+
+// rewriteVersion stores again the version retrieved under a number, with this number, once its data is checked against its hash
+func rewriteVersion(b backend.Backend, modelID string, versionNumber uint) error {
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, int(versionNumber))
+	if err != nil {
+		return err
+	}
+	data, err := b.RetrieveModelVersionData(modelID, int(versionNumber))
+	if err != nil {
+		return err
+	}
+	matches, err := backend.VerifyDataHash(versionInfo.DataHash, data)
+	if err != nil {
+		return err
+	}
+	if !matches {
+		return fmt.Errorf("the data of version %d doesn't match its hash", versionNumber)
+	}
+	_, err = b.CreateOrUpdateModelVersion(modelID, backend.VersionArgs{
+		VersionNumber:     versionNumber,
+		CreationTimestamp: versionInfo.CreationTimestamp,
+		Archived:          versionInfo.Archived,
+		DataHash:          versionInfo.DataHash,
+		Data:              data,
+		UserData:          versionInfo.UserData,
+	})
+	return err
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsck
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+func copyFile(t *testing.T, sourceFilename string, targetFilename string) {
+	content, err := os.ReadFile(sourceFilename)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(targetFilename, content, 0o600))
+}
+
+func TestCheck(t *testing.T) {
+	rootDirname := t.TempDir()
+	b, err := fs.CreateBackend(rootDirname)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{Archived: true, DataHash: backend.ComputeSHA256Hash(data), Data: data})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, b.DeleteModelVersion("foo", 2))
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "bar"})
+	assert.NoError(t, err)
+
+	// Simulating a partially failed creation which stored the info of version 3 as version 4
+	modelDirname := path.Join(rootDirname, "foo")
+	copyFile(t, path.Join(modelDirname, "foo-v000003.yaml"), path.Join(modelDirname, "foo-v000004.yaml"))
+	copyFile(t, path.Join(modelDirname, "foo-v000003.data"), path.Join(modelDirname, "foo-v000004.data"))
+
+	report, err := Check(b, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.CheckedModels)
+	assert.Equal(t, 3, report.CheckedVersions)
+	assert.Equal(t, []Problem{
+		{Kind: DuplicateVersionNumber, ModelID: "foo", VersionNumber: 3, Description: "version 3 is listed 2 times"},
+		{Kind: MissingVersions, ModelID: "foo", VersionNumber: 2, Description: "version 2 is missing"},
+		{Kind: MismatchedVersion, ModelID: "foo", VersionNumber: 4, Description: "version 4 is retrieved as version 3"},
+	}, report.Problems)
+
+	report, err = Check(b, []string{"foo"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.CheckedModels)
+	assert.Equal(t, []Problem{
+		{Kind: DuplicateVersionNumber, ModelID: "foo", VersionNumber: 3, Description: "version 3 is listed 2 times", Repaired: true},
+		{Kind: MissingVersions, ModelID: "foo", VersionNumber: 2, Description: "version 2 is missing"},
+		{Kind: MismatchedVersion, ModelID: "foo", VersionNumber: 4, Description: "version 4 is retrieved as version 3", Repaired: true},
+	}, report.Problems)
+
+	// Only the gap left by the deletion remains
+	report, err = Check(b, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.CheckedVersions)
+	assert.Equal(t, []Problem{
+		{Kind: MissingVersions, ModelID: "foo", VersionNumber: 2, Description: "version 2 is missing"},
+	}, report.Problems)
+	versionInfo, err := b.RetrieveModelVersionInfo("foo", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(4), versionInfo.VersionNumber)
+}
@@ -3,18 +3,30 @@ module github.com/cogment/cogment-model-registry
 go 1.16
 
 require (
-	github.com/golang/protobuf v1.5.2 // indirect
+	cloud.google.com/go/storage v1.18.2
+	github.com/alicebob/miniredis/v2 v2.23.0
+	github.com/cespare/xxhash/v2 v2.1.2
+	github.com/go-redis/redis/v8 v8.11.5
 	github.com/hashicorp/golang-lru v0.5.4
-	github.com/jstemmer/go-junit-report v0.0.0-20190106144839-af01ea7f8024
+	github.com/jstemmer/go-junit-report v0.9.1
+	github.com/klauspost/compress v1.13.6
+	github.com/lib/pq v1.10.4
+	github.com/minio/minio-go/v7 v7.0.14
 	github.com/rogpeppe/go-internal v1.3.0
+	github.com/sirupsen/logrus v1.8.1
+	github.com/spf13/afero v1.2.1 // indirect
+	github.com/spf13/cast v1.3.0
+	github.com/spf13/cobra v1.1.3
+	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.1
 	github.com/stretchr/testify v1.7.0
-	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4 // indirect
-	golang.org/x/sys v0.0.0-20210510120138-977fb7262007 // indirect
-	golang.org/x/text v0.3.6 // indirect
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.0.0-20201216223049-8b5274cf687f
+	google.golang.org/api v0.58.0
 	google.golang.org/grpc v1.40.0
 	google.golang.org/grpc/cmd/protoc-gen-go-grpc v1.1.0
 	google.golang.org/protobuf v1.27.1
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
-	gopkg.in/yaml.v2 v2.2.4
+	gopkg.in/yaml.v2 v2.4.0
+	lukechampine.com/blake3 v1.1.7
 )
@@ -16,15 +16,25 @@ package grpcservers
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
 
 	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/circuitBreaker"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
+// Trailer metadata key set when the backend circuit is open, the number of seconds after which the call can be retried
+const retryAfterMetadataKey = "retry-after"
+
 type BackendPromise struct {
 	backend backend.Backend
 	updated chan struct{}
+	breaker atomic.Value // *circuitBreaker.Breaker, the calls fail fast while its circuit is open
 }
 
 func CreateBackendPromise() BackendPromise {
@@ -43,10 +53,23 @@ func (bp *BackendPromise) Set(b backend.Backend) {
 	}
 }
 
+// SetCircuitBreaker makes Await fail with `UNAVAILABLE` while the circuit of the breaker is open
+func (bp *BackendPromise) SetCircuitBreaker(breaker *circuitBreaker.Breaker) {
+	bp.breaker.Store(breaker)
+}
+
+// Await waits for the backend to be set and returns it bound to the context, its operations return once it is done
 func (bp *BackendPromise) Await(ctx context.Context) (backend.Backend, error) {
+	if breaker, ok := bp.breaker.Load().(*circuitBreaker.Breaker); ok {
+		if retryAfter := breaker.RetryAfter(); retryAfter > 0 {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			_ = grpc.SetTrailer(ctx, metadata.Pairs(retryAfterMetadataKey, fmt.Sprint(seconds)))
+			return nil, status.Errorf(codes.Unavailable, "the backend is failing, retry in %ds", seconds)
+		}
+	}
 	for {
 		if bp.backend != nil {
-			return bp.backend, nil
+			return bindContext(bp.backend, ctx), nil
 		}
 		select {
 		case <-bp.updated:
@@ -0,0 +1,418 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/recovery"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxAbandonedCalls bounds the operations of unbound backends still running in the background after their call is done,
+// beyond it the calls wait for their operations to complete
+const maxAbandonedCalls = 256
+
+var abandonedCalls int64
+
+// contextBackend is the backend seen by a call, its operations return as soon as the context of the call is done
+//
+// When every layer of the backend can be bound to the context, the operations themselves stop once it is done.
+// Otherwise the calls can't be stuck reading the storage after their deadline, an abandoned read still completes in
+// the background and the writer or the reader it created is then aborted or closed. The mutations aren't abandoned as
+// they could still commit after the call failed, they only fail right away when the context is already done.
+type contextBackend struct {
+	backend backend.Backend
+	ctx     context.Context
+	bound   bool // Whether the operations of the backend stop by themselves once the context is done
+}
+
+// bindContext binds a backend to the context of a call, if it can be done
+func bindContext(b backend.Backend, ctx context.Context) backend.Backend {
+	if ctx.Done() == nil {
+		return b
+	}
+	if boundBackend, ok := backend.BindContext(b, ctx); ok {
+		return &contextBackend{backend: boundBackend, ctx: ctx, bound: true}
+	}
+	return &contextBackend{backend: b, ctx: ctx}
+}
+
+func contextDoneError(err error) error {
+	if err == context.DeadlineExceeded {
+		return status.Errorf(codes.DeadlineExceeded, "deadline exceeded while waiting for the backend")
+	}
+	return status.Errorf(codes.Canceled, "call canceled while waiting for the backend")
+}
+
+type callResult struct {
+	err   error
+	panic *recovery.Panic
+}
+
+// pendingCall is an operation running in the background of a call, until it is done or abandoned
+type pendingCall struct {
+	mutex     sync.Mutex
+	abandoned bool
+	done      chan callResult
+}
+
+// call runs do until it completes or the context is done, release is called if do succeeds after being abandoned
+//
+// A panic of do is raised again by call, or only reported once abandoned.
+func (b *contextBackend) call(do func() error, release func()) error {
+	if err := b.ctx.Err(); err != nil {
+		return contextDoneError(err)
+	}
+	if b.bound {
+		return b.boundError(do())
+	}
+	pending := &pendingCall{done: make(chan callResult, 1)}
+	go func() {
+		result := callResult{}
+		result.panic = recovery.Capture(func() { result.err = do() })
+		pending.mutex.Lock()
+		abandoned := pending.abandoned
+		if !abandoned {
+			pending.done <- result
+		}
+		pending.mutex.Unlock()
+		if !abandoned {
+			return
+		}
+		if result.panic != nil {
+			recovery.Report(b.ctx, result.panic)
+		} else if result.err == nil && release != nil {
+			release()
+		}
+		atomic.AddInt64(&abandonedCalls, -1)
+	}()
+	select {
+	case result := <-pending.done:
+		return completed(result)
+	case <-b.ctx.Done():
+	}
+	pending.mutex.Lock()
+	select {
+	case result := <-pending.done:
+		pending.mutex.Unlock()
+		return completed(result)
+	default:
+	}
+	if atomic.AddInt64(&abandonedCalls, 1) > maxAbandonedCalls {
+		atomic.AddInt64(&abandonedCalls, -1)
+		pending.mutex.Unlock()
+		return completed(<-pending.done)
+	}
+	pending.abandoned = true
+	pending.mutex.Unlock()
+	return contextDoneError(b.ctx.Err())
+}
+
+func completed(result callResult) error {
+	if result.panic != nil {
+		// Raised again in the goroutine of the call for it to be recovered like the panics of the handlers
+		panic(result.panic)
+	}
+	return result.err
+}
+
+// mutate runs do, changing the storage, without abandoning it as it could still commit after the context is done
+func (b *contextBackend) mutate(do func() error) error {
+	if err := b.ctx.Err(); err != nil {
+		return contextDoneError(err)
+	}
+	if b.bound {
+		return b.boundError(do())
+	}
+	return do()
+}
+
+// boundError reports the failures of the bound operations stopped by the end of the context like the abandoned ones
+func (b *contextBackend) boundError(err error) error {
+	if backend.IsContextDone(b.ctx, err) {
+		return contextDoneError(b.ctx.Err())
+	}
+	return err
+}
+
+// Destroy doesn't destroy the underlying backend, it outlives the call
+func (b *contextBackend) Destroy() {
+}
+
+func (b *contextBackend) Ping() error {
+	return b.call(b.backend.Ping, nil)
+}
+
+func (b *contextBackend) CreateOrUpdateModel(modelArgs backend.ModelInfo) (backend.ModelInfo, error) {
+	var modelInfo backend.ModelInfo
+	if err := b.mutate(func() error {
+		var err error
+		modelInfo, err = b.backend.CreateOrUpdateModel(modelArgs)
+		return err
+	}); err != nil {
+		return backend.ModelInfo{}, err
+	}
+	return modelInfo, nil
+}
+
+func (b *contextBackend) RetrieveModelInfo(modelID string) (backend.ModelInfo, error) {
+	var modelInfo backend.ModelInfo
+	if err := b.call(func() error {
+		var err error
+		modelInfo, err = b.backend.RetrieveModelInfo(modelID)
+		return err
+	}, nil); err != nil {
+		return backend.ModelInfo{}, err
+	}
+	return modelInfo, nil
+}
+
+func (b *contextBackend) RetrieveModelLatestVersionNumber(modelID string) (uint, error) {
+	var versionNumber uint
+	if err := b.call(func() error {
+		var err error
+		versionNumber, err = b.backend.RetrieveModelLatestVersionNumber(modelID)
+		return err
+	}, nil); err != nil {
+		return 0, err
+	}
+	return versionNumber, nil
+}
+
+func (b *contextBackend) HasModel(modelID string) (bool, error) {
+	var hasModel bool
+	if err := b.call(func() error {
+		var err error
+		hasModel, err = b.backend.HasModel(modelID)
+		return err
+	}, nil); err != nil {
+		return false, err
+	}
+	return hasModel, nil
+}
+
+func (b *contextBackend) DeleteModel(modelID string) error {
+	return b.mutate(func() error {
+		return b.backend.DeleteModel(modelID)
+	})
+}
+
+func (b *contextBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	var modelInfos []backend.ModelInfo
+	if err := b.call(func() error {
+		var err error
+		modelInfos, err = b.backend.ListModels(offset, limit)
+		return err
+	}, nil); err != nil {
+		return nil, err
+	}
+	return modelInfos, nil
+}
+
+func (b *contextBackend) QueryModels(filter backend.ModelFilter, offset int, limit int) ([]backend.ModelInfo, error) {
+	var modelInfos []backend.ModelInfo
+	if err := b.call(func() error {
+		var err error
+		modelInfos, err = b.backend.QueryModels(filter, offset, limit)
+		return err
+	}, nil); err != nil {
+		return nil, err
+	}
+	return modelInfos, nil
+}
+
+func (b *contextBackend) CreateOrUpdateModelVersion(modelID string, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	if err := b.mutate(func() error {
+		var err error
+		versionInfo, err = b.backend.CreateOrUpdateModelVersion(modelID, versionArgs)
+		return err
+	}); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return versionInfo, nil
+}
+
+func (b *contextBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	var writer backend.VersionDataWriter
+	if err := b.call(func() error {
+		var err error
+		writer, err = b.backend.CreateOrUpdateModelVersionStream(modelID, versionArgs)
+		return err
+	}, func() {
+		_ = writer.Abort()
+	}); err != nil {
+		return nil, err
+	}
+	return &contextVersionDataWriter{VersionDataWriter: writer, backend: b}, nil
+}
+
+// contextVersionDataWriter stops waiting for the commit of a version once the context of the call is done
+type contextVersionDataWriter struct {
+	backend.VersionDataWriter
+	backend *contextBackend
+}
+
+func (w *contextVersionDataWriter) Commit() (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	if err := w.backend.mutate(func() error {
+		var err error
+		versionInfo, err = w.VersionDataWriter.Commit()
+		return err
+	}); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return versionInfo, nil
+}
+
+func (b *contextBackend) RetrieveModelVersionInfo(modelID string, versionNumber int) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	if err := b.call(func() error {
+		var err error
+		versionInfo, err = b.backend.RetrieveModelVersionInfo(modelID, versionNumber)
+		return err
+	}, nil); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return versionInfo, nil
+}
+
+func (b *contextBackend) RetrieveModelVersionData(modelID string, versionNumber int) ([]byte, error) {
+	var data []byte
+	if err := b.call(func() error {
+		var err error
+		data, err = b.backend.RetrieveModelVersionData(modelID, versionNumber)
+		return err
+	}, nil); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (b *contextBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	var data []byte
+	if err := b.call(func() error {
+		var err error
+		data, err = b.backend.RetrieveModelVersionDataRange(modelID, versionNumber, offset, length)
+		return err
+	}, nil); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (b *contextBackend) OpenModelVersionData(modelID string, versionNumber int) (backend.VersionInfo, backend.VersionDataReader, bool, error) {
+	var versionInfo backend.VersionInfo
+	var reader backend.VersionDataReader
+	var opened bool
+	if err := b.call(func() error {
+		var err error
+		versionInfo, reader, opened, err = backend.OpenModelVersionData(b.backend, modelID, versionNumber)
+		return err
+	}, func() {
+		if opened {
+			reader.Close()
+		}
+	}); err != nil {
+		return backend.VersionInfo{}, nil, false, err
+	}
+	return versionInfo, reader, opened, nil
+}
+
+func (b *contextBackend) PresignModelVersionData(modelID string, versionNumber int, expiration time.Duration) (backend.VersionInfo, string, bool, error) {
+	var versionInfo backend.VersionInfo
+	var url string
+	var presigned bool
+	if err := b.call(func() error {
+		var err error
+		versionInfo, url, presigned, err = backend.PresignModelVersionData(b.backend, modelID, versionNumber, expiration)
+		return err
+	}, nil); err != nil {
+		return backend.VersionInfo{}, "", false, err
+	}
+	return versionInfo, url, presigned, nil
+}
+
+func (b *contextBackend) UpdateModelVersionArchived(modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	if err := b.mutate(func() error {
+		var err error
+		versionInfo, err = b.backend.UpdateModelVersionArchived(modelID, versionNumber, archived)
+		return err
+	}); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return versionInfo, nil
+}
+
+func (b *contextBackend) UpdateModelVersionUserData(modelID string, versionNumber int, userData map[string]string) (backend.VersionInfo, error) {
+	var versionInfo backend.VersionInfo
+	if err := b.mutate(func() error {
+		var err error
+		versionInfo, err = b.backend.UpdateModelVersionUserData(modelID, versionNumber, userData)
+		return err
+	}); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return versionInfo, nil
+}
+
+func (b *contextBackend) DeleteModelVersion(modelID string, versionNumber int) error {
+	return b.mutate(func() error {
+		return b.backend.DeleteModelVersion(modelID, versionNumber)
+	})
+}
+
+func (b *contextBackend) ListModelVersionInfos(modelID string, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	var versionInfos []backend.VersionInfo
+	if err := b.call(func() error {
+		var err error
+		versionInfos, err = b.backend.ListModelVersionInfos(modelID, initialVersionNumber, limit)
+		return err
+	}, nil); err != nil {
+		return nil, err
+	}
+	return versionInfos, nil
+}
+
+func (b *contextBackend) QueryModelVersionInfos(modelID string, filter backend.VersionFilter, initialVersionNumber uint, limit int) ([]backend.VersionInfo, error) {
+	var versionInfos []backend.VersionInfo
+	if err := b.call(func() error {
+		var err error
+		versionInfos, err = b.backend.QueryModelVersionInfos(modelID, filter, initialVersionNumber, limit)
+		return err
+	}, nil); err != nil {
+		return nil, err
+	}
+	return versionInfos, nil
+}
+
+func (b *contextBackend) RetrieveStorageCapacity() (backend.StorageCapacity, error) {
+	var capacity backend.StorageCapacity
+	if err := b.call(func() error {
+		var err error
+		capacity, err = b.backend.RetrieveStorageCapacity()
+		return err
+	}, nil); err != nil {
+		return backend.StorageCapacity{}, err
+	}
+	return capacity, nil
+}
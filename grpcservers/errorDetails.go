@@ -0,0 +1,87 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+	"github.com/cogment/cogment-model-registry/namespaces"
+)
+
+// reasonStatus creates a status error whose details carry the reason of the error and the entities involved
+func reasonStatus(c codes.Code, reason extensionsapi.ErrorReason, metadata map[string]string, format string, a ...interface{}) error {
+	st := status.New(c, fmt.Sprintf(format, a...))
+	detailedSt, err := st.WithDetails(&extensionsapi.ErrorDetails{Reason: reason, Metadata: metadata})
+	if err != nil {
+		return st.Err()
+	}
+	return detailedSt.Err()
+}
+
+// errorStatus creates a status error from an error, the reason of the known backend errors is carried in its details
+func errorStatus(c codes.Code, err error) error {
+	var unknownModelErr *backend.UnknownModelError
+	var unknownModelVersionErr *backend.UnknownModelVersionError
+	var dataHashMismatchErr *backend.DataHashMismatchError
+	var corruptedDataErr *backend.CorruptedDataError
+	var namespaceQuotaExceededErr *namespaces.QuotaExceededError
+	var quotaExceededErr *backend.QuotaExceededError
+	var statusErr interface{ GRPCStatus() *status.Status }
+	switch {
+	case errors.As(err, &unknownModelErr):
+		return reasonStatus(c, extensionsapi.ErrorReason_MODEL_NOT_FOUND, map[string]string{
+			"model_id": unknownModelErr.ModelID,
+		}, "%s", err)
+	case errors.As(err, &unknownModelVersionErr):
+		return reasonStatus(c, extensionsapi.ErrorReason_VERSION_NOT_FOUND, map[string]string{
+			"model_id":       unknownModelVersionErr.ModelID,
+			"version_number": strconv.Itoa(unknownModelVersionErr.VersionNumber),
+		}, "%s", err)
+	case errors.As(err, &dataHashMismatchErr):
+		return reasonStatus(c, extensionsapi.ErrorReason_HASH_MISMATCH, map[string]string{
+			"model_id":           dataHashMismatchErr.ModelID,
+			"expected_data_hash": dataHashMismatchErr.ExpectedDataHash,
+			"data_hash":          dataHashMismatchErr.DataHash,
+		}, "%s", err)
+	case errors.As(err, &corruptedDataErr):
+		return reasonStatus(c, extensionsapi.ErrorReason_HASH_MISMATCH, map[string]string{
+			"model_id":       corruptedDataErr.ModelID,
+			"version_number": strconv.FormatUint(uint64(corruptedDataErr.VersionNumber), 10),
+			"data_hash":      corruptedDataErr.DataHash,
+		}, "%s", err)
+	case errors.As(err, &namespaceQuotaExceededErr):
+		return reasonStatus(c, extensionsapi.ErrorReason_QUOTA_EXCEEDED, map[string]string{
+			"namespace": namespaceQuotaExceededErr.Namespace,
+			"resource":  namespaceQuotaExceededErr.Resource,
+			"limit":     strconv.FormatInt(namespaceQuotaExceededErr.Limit, 10),
+		}, "%s", err)
+	case errors.As(err, &quotaExceededErr):
+		return reasonStatus(c, extensionsapi.ErrorReason_QUOTA_EXCEEDED, map[string]string{
+			"resource": quotaExceededErr.Resource,
+			"limit":    strconv.FormatInt(quotaExceededErr.Limit, 10),
+		}, "%s", err)
+	case errors.As(err, &statusErr):
+		// Backend errors carrying their own status, e.g. the changes rejected by a federated backend
+		return statusErr.GRPCStatus().Err()
+	}
+	return status.Errorf(c, "%s", err)
+}
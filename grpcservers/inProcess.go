@@ -0,0 +1,208 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+	"github.com/cogment/cogment-model-registry/namespaces"
+)
+
+// Size of the reads of the data of the versions published in process
+const publishedDataReadSize = 32 * 1024
+
+// PublishedVersionArgs are the arguments of a version published in process
+type PublishedVersionArgs struct {
+	CreationTimestamp time.Time // Defaults to the time of the publication
+	Archived          bool
+	DataHash          string // If defined, the data needs to match it, required when the signatures are verified
+	UserData          map[string]string
+}
+
+// PublishVersion creates a version of a model with data read in process, without serializing nor chunking it
+//
+// The version is validated like the ones created by CreateVersion and its watchers are notified the same way, the
+// errors carry the same gRPC status.
+func (s *ModelRegistryServer) PublishVersion(ctx context.Context, modelID string, versionArgs PublishedVersionArgs, data io.Reader) (backend.VersionInfo, error) {
+	b, err := s.backendPromise.Await(ctx)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return backend.VersionInfo{}, contextDoneError(err)
+	}
+
+	if err := s.validateModelID(modelID); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	if _, err := backend.ParseDataHashAlgorithm(versionArgs.DataHash); err != nil {
+		return backend.VersionInfo{}, status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if err := s.verifySignature(&grpcapi.ModelVersionInfo{ModelId: modelID, DataHash: versionArgs.DataHash, UserData: versionArgs.UserData}); err != nil {
+		return backend.VersionInfo{}, err
+	}
+	if err := validateVersionUserData(b, modelID, versionArgs.UserData); err != nil {
+		return backend.VersionInfo{}, err
+	}
+
+	creationTimestamp := versionArgs.CreationTimestamp
+	if creationTimestamp.IsZero() {
+		creationTimestamp = time.Now()
+	}
+	versionDataWriter, err := b.CreateOrUpdateModelVersionStream(modelID, backend.VersionArgs{
+		CreationTimestamp: creationTimestamp,
+		Archived:          versionArgs.Archived,
+		DataHash:          versionArgs.DataHash,
+		DataHashAlgorithm: s.hashAlgorithm.Name,
+		UserData:          versionArgs.UserData,
+	})
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return backend.VersionInfo{}, errorStatus(codes.NotFound, err)
+		}
+		return backend.VersionInfo{}, status.Errorf(codes.Internal, "unexpected error while creating a version for model %q: %s", modelID, err)
+	}
+	versionDataWriter = s.checkDependenciesOnCommit(b, versionDataWriter, versionArgs.UserData)
+
+	// The size of the data is only known once it is read, the limits are checked before committing the version
+	dataSize := uint64(0)
+	buffer := make([]byte, publishedDataReadSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			_ = versionDataWriter.Abort()
+			return backend.VersionInfo{}, contextDoneError(err)
+		}
+		n, readErr := data.Read(buffer)
+		if n > 0 {
+			dataSize += uint64(n)
+			if err := s.checkVersionDataSize(modelID, dataSize); err != nil {
+				_ = versionDataWriter.Abort()
+				return backend.VersionInfo{}, err
+			}
+			if _, err := versionDataWriter.Write(buffer[:n]); err != nil {
+				_ = versionDataWriter.Abort()
+				return backend.VersionInfo{}, status.Errorf(codes.Internal, "unexpected error while writing the data of a version for model %q: %s", modelID, err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			_ = versionDataWriter.Abort()
+			return backend.VersionInfo{}, status.Errorf(codes.InvalidArgument, "unable to read the data of a version for model %q: %s", modelID, readErr)
+		}
+	}
+	if err := s.checkNamespaceQuota(b, modelID, namespaces.Usage{VersionsCount: 1, DataSize: int64(dataSize)}); err != nil {
+		_ = versionDataWriter.Abort()
+		return backend.VersionInfo{}, err
+	}
+
+	versionInfo, err := versionDataWriter.Commit()
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return backend.VersionInfo{}, err
+		}
+		switch {
+		case errors.As(err, new(*backend.DataHashMismatchError)):
+			return backend.VersionInfo{}, errorStatus(codes.InvalidArgument, err)
+		case errors.As(err, new(*backend.UnknownModelError)):
+			return backend.VersionInfo{}, errorStatus(codes.NotFound, err)
+		}
+		return backend.VersionInfo{}, status.Errorf(codes.Internal, "unexpected error while creating a version for model %q: %s", modelID, err)
+	}
+
+	s.publishVersionEvent(versionCreated, versionInfo)
+	return versionInfo, nil
+}
+
+// VersionSubscription receives in process the versions of a model created after the subscription
+type VersionSubscription struct {
+	ctx          context.Context
+	server       *ModelRegistryServer
+	modelID      string
+	subscription *versionSubscription
+	versionInfo  backend.VersionInfo
+	err          error
+}
+
+// SubscribeVersions subscribes to the versions of a model created afterward, like WatchVersions, until the context is
+// done or the subscription is closed
+func (s *ModelRegistryServer) SubscribeVersions(ctx context.Context, modelID string) (*VersionSubscription, error) {
+	b, err := s.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Subscribing before checking the model existence makes sure no version created in between is missed
+	subscription := s.versionBroadcaster.subscribe(modelID)
+	hasModel, err := b.HasModel(modelID)
+	if err != nil {
+		s.versionBroadcaster.unsubscribe(modelID, subscription)
+		return nil, status.Errorf(codes.Internal, "unexpected error while subscribing to the versions of model %q: %s", modelID, err)
+	}
+	if !hasModel {
+		s.versionBroadcaster.unsubscribe(modelID, subscription)
+		return nil, errorStatus(codes.NotFound, &backend.UnknownModelError{ModelID: modelID})
+	}
+	return &VersionSubscription{ctx: ctx, server: s, modelID: modelID, subscription: subscription}, nil
+}
+
+// Next waits for the next created version, it returns false once the subscription ended, because the model was deleted
+// or, with an error, because the subscriber didn't keep up, the context is done or the server is shutting down
+func (v *VersionSubscription) Next() bool {
+	if v.err != nil {
+		return false
+	}
+	select {
+	case versionInfo, ok := <-v.subscription.versions:
+		if !ok {
+			if v.subscription.overflowed {
+				v.err = status.Errorf(codes.ResourceExhausted, "too many versions of model %q created while the subscriber was busy, subscribe again to resume", v.modelID)
+			}
+			return false
+		}
+		v.versionInfo = versionInfo
+		return true
+	case <-v.ctx.Done():
+		v.err = status.Errorf(codes.Canceled, "versions subscription canceled")
+	case <-v.server.shutdown:
+		v.err = status.Errorf(codes.Unavailable, "the server is shutting down, subscribe again to resume")
+	}
+	v.Close()
+	return false
+}
+
+// VersionInfo returns the version received by the last call to Next
+func (v *VersionSubscription) VersionInfo() backend.VersionInfo {
+	return v.versionInfo
+}
+
+// Err returns the error having ended the subscription, nil if it is ongoing or if the model was deleted
+func (v *VersionSubscription) Err() error {
+	return v.err
+}
+
+// Close ends the subscription
+func (v *VersionSubscription) Close() {
+	v.server.versionBroadcaster.unsubscribe(v.modelID, v.subscription)
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// Number of model events buffered for a subscriber before it is considered too slow and unsubscribed
+const modelSubscriptionBufferSize = 32
+
+type modelEventType int
+
+const (
+	modelCreated modelEventType = iota
+	modelUpdated
+	modelDeleted
+)
+
+type modelEvent struct {
+	eventType modelEventType
+	modelInfo backend.ModelInfo
+}
+
+// modelFilter selects the models whose ID starts with modelIDPrefix and whose user data has all the userDataKeys
+type modelFilter struct {
+	modelIDPrefix string
+	userDataKeys  []string
+}
+
+func (f modelFilter) matches(modelInfo backend.ModelInfo) bool {
+	if !strings.HasPrefix(modelInfo.ModelID, f.modelIDPrefix) {
+		return false
+	}
+	for _, key := range f.userDataKeys {
+		if _, ok := modelInfo.UserData[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+type modelSubscription struct {
+	filter modelFilter
+	events chan modelEvent
+	// overflowed is set when the subscription was closed because the subscriber didn't keep up
+	overflowed bool
+}
+
+// modelBroadcaster dispatches the changes made to the models through the server to the matching subscribers
+type modelBroadcaster struct {
+	mutex         sync.Mutex
+	subscriptions map[*modelSubscription]struct{}
+}
+
+func createModelBroadcaster() *modelBroadcaster {
+	return &modelBroadcaster{
+		subscriptions: make(map[*modelSubscription]struct{}),
+	}
+}
+
+// subscribe registers a subscription to the events of the models matching the given filter, its channel is
+// closed when the subscriber doesn't keep up or when unsubscribe is called.
+func (mb *modelBroadcaster) subscribe(filter modelFilter) *modelSubscription {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	subscription := &modelSubscription{filter: filter, events: make(chan modelEvent, modelSubscriptionBufferSize)}
+	mb.subscriptions[subscription] = struct{}{}
+	return subscription
+}
+
+func (mb *modelBroadcaster) unsubscribe(subscription *modelSubscription) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	if _, ok := mb.subscriptions[subscription]; !ok {
+		return
+	}
+	close(subscription.events)
+	delete(mb.subscriptions, subscription)
+}
+
+// publish sends an event to every matching subscriber without blocking
+func (mb *modelBroadcaster) publish(eventType modelEventType, modelInfo backend.ModelInfo) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	for subscription := range mb.subscriptions {
+		if !subscription.filter.matches(modelInfo) {
+			continue
+		}
+		select {
+		case subscription.events <- modelEvent{eventType: eventType, modelInfo: modelInfo}:
+		default:
+			subscription.overflowed = true
+			close(subscription.events)
+			delete(mb.subscriptions, subscription)
+		}
+	}
+}
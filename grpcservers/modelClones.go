@@ -0,0 +1,136 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/signature"
+)
+
+// Size of the chunks read from the data of a version while it is copied
+const copiedVersionDataChunkSize = 1024 * 1024
+
+// retrieveClonedVersionInfos retrieves the versions of a model copied by a clone ordered by version number, every
+// version when versionNumbers is empty
+func retrieveClonedVersionInfos(b backend.Backend, modelID string, versionNumbers []uint32) ([]backend.VersionInfo, error) {
+	versionInfos := []backend.VersionInfo{}
+	if len(versionNumbers) == 0 {
+		for initialVersionNumber := uint(0); ; {
+			listedVersionInfos, err := b.ListModelVersionInfos(modelID, initialVersionNumber, storageInfoPageSize)
+			if err != nil {
+				return nil, err
+			}
+			versionInfos = append(versionInfos, listedVersionInfos...)
+			if len(listedVersionInfos) < storageInfoPageSize {
+				return versionInfos, nil
+			}
+			initialVersionNumber = listedVersionInfos[len(listedVersionInfos)-1].VersionNumber + 1
+		}
+	}
+	retrieved := map[uint32]bool{}
+	for _, versionNumber := range versionNumbers {
+		if versionNumber == 0 || retrieved[versionNumber] {
+			continue
+		}
+		retrieved[versionNumber] = true
+		versionInfo, err := b.RetrieveModelVersionInfo(modelID, int(versionNumber))
+		if err != nil {
+			return nil, err
+		}
+		versionInfos = append(versionInfos, versionInfo)
+	}
+	sort.Slice(versionInfos, func(i, j int) bool { return versionInfos[i].VersionNumber < versionInfos[j].VersionNumber })
+	return versionInfos, nil
+}
+
+// clonedModelUserData is the user data of a cloned model, its aliases, stages and revision aren't cloned
+func clonedModelUserData(userData map[string]string) map[string]string {
+	clonedUserData := make(map[string]string, len(userData))
+	for key, value := range userData {
+		if _, protected := protectedUserDataKey(key); protected || key == ModelRevisionUserDataKey {
+			continue
+		}
+		clonedUserData[key] = value
+	}
+	return clonedUserData
+}
+
+// clonedVersionUserData is the user data of the copy of a version, which isn't locked nor signed, the signatures
+// covering the model id. A parent in the source model that isn't copied remains the parent of the copy.
+func clonedVersionUserData(sourceModelID string, userData map[string]string, copiedVersionNumbers map[uint]bool) map[string]string {
+	clonedUserData := make(map[string]string, len(userData)+1)
+	for key, value := range userData {
+		if key == VersionLockedUserDataKey || key == signature.SignatureUserDataKey || key == signature.KeyIDUserDataKey {
+			continue
+		}
+		clonedUserData[key] = value
+	}
+	parentModelID := userData[ParentModelIDUserDataKey]
+	parentVersionNumber, err := strconv.ParseUint(userData[ParentVersionNumberUserDataKey], 10, 32)
+	if err == nil && (parentModelID == "" || parentModelID == sourceModelID) && !copiedVersionNumbers[uint(parentVersionNumber)] {
+		clonedUserData[ParentModelIDUserDataKey] = sourceModelID
+	}
+	return clonedUserData
+}
+
+// copyVersionData writes the data of a version chunk by chunk, the written data is checked against the hash of the
+// version when committed
+func copyVersionData(b backend.Backend, versionInfo backend.VersionInfo, writer io.Writer) error {
+	readChunk := backendChunkReader(b, versionInfo)
+	_, reader, opened, err := backend.OpenModelVersionData(b, versionInfo.ModelID, int(versionInfo.VersionNumber))
+	if err != nil {
+		return err
+	}
+	if opened {
+		defer reader.Close()
+		readChunk = openedChunkReader(reader)
+	}
+	dataSize := uint64(versionInfo.DataSize)
+	for offset := uint64(0); offset < dataSize; {
+		length := dataSize - offset
+		if length > copiedVersionDataChunkSize {
+			length = copiedVersionDataChunkSize
+		}
+		chunk, err := readChunk(offset, length)
+		if err != nil {
+			return err
+		}
+		if len(chunk) == 0 {
+			return fmt.Errorf("data of version \"%d\" of model %q is shorter than its %d bytes", versionInfo.VersionNumber, versionInfo.ModelID, versionInfo.DataSize)
+		}
+		if _, err := writer.Write(chunk); err != nil {
+			return err
+		}
+		offset += uint64(len(chunk))
+	}
+	return nil
+}
+
+// cloneError is the status of a clone failing while retrieving the source model or its versions
+func cloneError(sourceModelID string, err error) error {
+	if errors.Is(err, backend.ErrNotFound) {
+		return errorStatus(codes.NotFound, err)
+	}
+	return status.Errorf(codes.Internal, "unexpected error while cloning model %q: %s", sourceModelID, err)
+}
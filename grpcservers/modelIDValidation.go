@@ -0,0 +1,29 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validateModelID rejects with INVALID_ARGUMENT the model ids that aren't safe for every backend or don't satisfy the
+// configured rules
+func (s *ModelRegistryServer) validateModelID(modelID string) error {
+	if err := s.modelIDRules.Validate(modelID); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	return nil
+}
@@ -0,0 +1,2398 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/fsck"
+	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+	"github.com/cogment/cogment-model-registry/logging"
+	"github.com/cogment/cogment-model-registry/maintenance"
+	"github.com/cogment/cogment-model-registry/namespaces"
+	"github.com/cogment/cogment-model-registry/pagination"
+	"github.com/cogment/cogment-model-registry/registryArchive"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Maximum number of times a version is resolved again when it changes while being retrieved
+const maxRetrieveVersionAttempts = 5
+
+type modelRegistryExtensionsServer struct {
+	extensionsapi.UnimplementedModelRegistryExtensionsSPServer
+	server *ModelRegistryServer
+}
+
+// retrieveVerifiedVersion resolves a version of a model, -1 being the latest, and retrieves its data by explicit version
+// number, it starts over if the resolved version is deleted or updated in between.
+//
+// The data is checked against the hash of the version, a mismatch that isn't explained by an update is a data loss.
+func retrieveVerifiedVersion(b backend.Backend, modelID string, versionNumber int) (backend.VersionInfo, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+		if err != nil {
+			return backend.VersionInfo{}, nil, err
+		}
+		data, err := b.RetrieveModelVersionData(modelID, int(versionInfo.VersionNumber))
+		if err == nil {
+			matches, err := backend.VerifyDataHash(versionInfo.DataHash, data)
+			if err != nil {
+				return backend.VersionInfo{}, nil, err
+			}
+			if matches {
+				return versionInfo, data, nil
+			}
+			currentVersionInfo, err := b.RetrieveModelVersionInfo(modelID, int(versionInfo.VersionNumber))
+			if err == nil && currentVersionInfo.DataHash == versionInfo.DataHash {
+				return backend.VersionInfo{}, nil, errorStatus(codes.DataLoss, &backend.CorruptedDataError{ModelID: modelID, VersionNumber: versionInfo.VersionNumber, DataHash: versionInfo.DataHash})
+			}
+		} else if !errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return backend.VersionInfo{}, nil, err
+		}
+		if attempt+1 >= maxRetrieveVersionAttempts {
+			return backend.VersionInfo{}, nil, status.Errorf(codes.Aborted, "version \"%d\" of model %q kept changing while being retrieved", versionNumber, modelID)
+		}
+	}
+}
+
+func (s *modelRegistryExtensionsServer) CreateModel(ctx context.Context, req *extensionsapi.CreateModelRequest) (*extensionsapi.CreateModelReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.GetModelInfo().GetModelId(), "user_data": req.GetModelInfo().GetUserData()}).Info("CreateModel")
+
+	err := s.server.writeModel(ctx, backend.ModelInfo{
+		ModelID:  req.GetModelInfo().GetModelId(),
+		UserData: req.GetModelInfo().GetUserData(),
+	}, createModelMode)
+	if err != nil {
+		return nil, err
+	}
+	return &extensionsapi.CreateModelReply{}, nil
+}
+
+func (s *modelRegistryExtensionsServer) UpdateModel(ctx context.Context, req *extensionsapi.UpdateModelRequest) (*extensionsapi.UpdateModelReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.GetModelInfo().GetModelId(), "user_data": req.GetModelInfo().GetUserData()}).Info("UpdateModel")
+
+	err := s.server.writeModel(ctx, backend.ModelInfo{
+		ModelID:  req.GetModelInfo().GetModelId(),
+		UserData: req.GetModelInfo().GetUserData(),
+	}, updateModelMode)
+	if err != nil {
+		return nil, err
+	}
+	return &extensionsapi.UpdateModelReply{}, nil
+}
+
+func (s *modelRegistryExtensionsServer) CloneModel(ctx context.Context, req *extensionsapi.CloneModelRequest) (*extensionsapi.CloneModelReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"source_model_id": req.SourceModelId, "model_id": req.ModelId, "version_numbers": req.VersionNumbers}).Info("CloneModel")
+
+	if err := s.server.validateModelID(req.ModelId); err != nil {
+		return nil, err
+	}
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceModelInfo, err := b.RetrieveModelInfo(req.SourceModelId)
+	if err != nil {
+		return nil, cloneError(req.SourceModelId, err)
+	}
+	sourceVersionInfos, err := retrieveClonedVersionInfos(b, req.SourceModelId, req.VersionNumbers)
+	if err != nil {
+		return nil, cloneError(req.SourceModelId, err)
+	}
+
+	copiedVersionNumbers := make(map[uint]bool, len(sourceVersionInfos))
+	added := namespaces.Usage{ModelsCount: 1, VersionsCount: len(sourceVersionInfos)}
+	for _, sourceVersionInfo := range sourceVersionInfos {
+		copiedVersionNumbers[sourceVersionInfo.VersionNumber] = true
+		added.DataSize += int64(sourceVersionInfo.DataSize)
+	}
+	versionArgs := make([]backend.VersionArgs, 0, len(sourceVersionInfos))
+	creationTimestamp := time.Now()
+	for _, sourceVersionInfo := range sourceVersionInfos {
+		userData := clonedVersionUserData(req.SourceModelId, sourceVersionInfo.UserData, copiedVersionNumbers)
+		// Unsigned, the copies are rejected when signatures are required
+		if err := s.server.verifySignature(&grpcapi.ModelVersionInfo{ModelId: req.ModelId, DataHash: sourceVersionInfo.DataHash, UserData: userData}); err != nil {
+			return nil, err
+		}
+		versionArgs = append(versionArgs, backend.VersionArgs{
+			VersionNumber:     sourceVersionInfo.VersionNumber,
+			CreationTimestamp: creationTimestamp,
+			Archived:          sourceVersionInfo.Archived,
+			DataHash:          sourceVersionInfo.DataHash,
+			DataHashAlgorithm: s.server.hashAlgorithm.Name,
+			UserData:          userData,
+		})
+	}
+
+	unlock := s.server.modelUserDataLocks.Lock(req.ModelId)
+	defer unlock()
+
+	exists, err := b.HasModel(req.ModelId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error while cloning model %q: %s", req.SourceModelId, err)
+	}
+	if exists {
+		return nil, status.Errorf(codes.AlreadyExists, "unable to clone model %q as %q, it already exists", req.SourceModelId, req.ModelId)
+	}
+	if err := s.server.checkModelNamespace(req.ModelId); err != nil {
+		return nil, err
+	}
+	if err := s.server.checkNamespaceQuota(b, req.ModelId, added); err != nil {
+		return nil, err
+	}
+
+	modelInfo, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: req.ModelId, UserData: clonedModelUserData(sourceModelInfo.UserData)})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error while creating model %q: %s", req.ModelId, err)
+	}
+	versionInfos := make([]backend.VersionInfo, 0, len(sourceVersionInfos))
+	copyVersion := func(sourceVersionInfo backend.VersionInfo, versionArgs backend.VersionArgs) (backend.VersionInfo, error) {
+		versionArgs.DataSize = sourceVersionInfo.DataSize
+		writer, err := b.CreateOrUpdateModelVersionStream(req.ModelId, versionArgs)
+		if err != nil {
+			return backend.VersionInfo{}, err
+		}
+		if err := copyVersionData(b, sourceVersionInfo, writer); err != nil {
+			_ = writer.Abort()
+			return backend.VersionInfo{}, err
+		}
+		return writer.Commit()
+	}
+	for index, sourceVersionInfo := range sourceVersionInfos {
+		versionInfo, err := copyVersion(sourceVersionInfo, versionArgs[index])
+		if err != nil {
+			// Nothing is published before the clone completes, the partially cloned model can be deleted silently
+			if deleteErr := b.DeleteModel(req.ModelId); deleteErr != nil {
+				logging.FromContext(ctx).WithField("model_id", req.ModelId).WithError(deleteErr).Error("Unable to delete a partially cloned model")
+			}
+			if errors.As(err, new(*backend.DataHashMismatchError)) {
+				return nil, errorStatus(codes.DataLoss, err)
+			}
+			return nil, status.Errorf(codes.Internal, `unexpected error while copying version "%d" of model %q: %s`, sourceVersionInfo.VersionNumber, req.SourceModelId, err)
+		}
+		versionInfos = append(versionInfos, versionInfo)
+	}
+
+	s.server.publishModelEvent(modelCreated, modelInfo)
+	pbVersionInfos := make([]*grpcapi.ModelVersionInfo, 0, len(versionInfos))
+	for _, versionInfo := range versionInfos {
+		s.server.publishVersionEvent(versionCreated, versionInfo)
+		pbVersionInfo := createPbModelVersionInfo(versionInfo)
+		pbVersionInfos = append(pbVersionInfos, &pbVersionInfo)
+	}
+	return &extensionsapi.CloneModelReply{
+		ModelInfo:    &grpcapi.ModelInfo{ModelId: modelInfo.ModelID, UserData: modelInfo.UserData},
+		VersionInfos: pbVersionInfos,
+	}, nil
+}
+
+func (s *modelRegistryExtensionsServer) RetrieveLatestVersion(req *extensionsapi.RetrieveLatestVersionRequest, outStream extensionsapi.ModelRegistryExtensionsSP_RetrieveLatestVersionServer) error {
+	logging.FromContext(outStream.Context()).WithField("model_id", req.ModelId).Info("RetrieveLatestVersion")
+
+	b, err := s.server.backendPromise.Await(outStream.Context())
+	if err != nil {
+		return err
+	}
+
+	var unchanged func(backend.VersionInfo) bool
+	if req.KnownDataHash != "" {
+		unchanged = func(versionInfo backend.VersionInfo) bool {
+			return versionInfo.DataHash == req.KnownDataHash
+		}
+	}
+	return s.sendLatestVersion(outStream, b, req.ModelId, int(req.PreferredChunkSize), unchanged)
+}
+
+func (s *modelRegistryExtensionsServer) RetrieveLatestVersionDataIfChanged(req *extensionsapi.RetrieveLatestVersionDataIfChangedRequest, outStream extensionsapi.ModelRegistryExtensionsSP_RetrieveLatestVersionDataIfChangedServer) error {
+	logging.FromContext(outStream.Context()).WithFields(logrus.Fields{
+		"model_id":             req.ModelId,
+		"known_version_number": req.KnownVersionNumber,
+		"known_data_hash":      req.KnownDataHash,
+	}).Info("RetrieveLatestVersionDataIfChanged")
+
+	b, err := s.server.backendPromise.Await(outStream.Context())
+	if err != nil {
+		return err
+	}
+
+	return s.sendLatestVersion(outStream, b, req.ModelId, int(req.PreferredChunkSize), func(versionInfo backend.VersionInfo) bool {
+		return versionInfo.VersionNumber <= uint(req.KnownVersionNumber) || versionInfo.DataHash == req.KnownDataHash
+	})
+}
+
+// latestVersionChunkSender is implemented by the streams sending the latest version of a model
+type latestVersionChunkSender interface {
+	Send(*extensionsapi.RetrieveLatestVersionReplyChunk) error
+}
+
+// sendLatestVersion sends the info of the latest version of a model followed by its data, unless unchanged is defined
+// and returns true for it, the header is then the only message.
+//
+// The data is only retrieved once the latest version is known to have changed.
+func (s *modelRegistryExtensionsServer) sendLatestVersion(outStream latestVersionChunkSender, b backend.Backend, modelID string, preferredChunkSize int, unchanged func(backend.VersionInfo) bool) error {
+	sendHeader := func(versionInfo backend.VersionInfo, notModified bool) error {
+		pbVersionInfo := createPbModelVersionInfo(versionInfo)
+		return outStream.Send(&extensionsapi.RetrieveLatestVersionReplyChunk{
+			Msg: &extensionsapi.RetrieveLatestVersionReplyChunk_Header_{
+				Header: &extensionsapi.RetrieveLatestVersionReplyChunk_Header{VersionInfo: &pbVersionInfo, NotModified: notModified},
+			},
+		})
+	}
+
+	if unchanged != nil {
+		versionInfo, err := b.RetrieveModelVersionInfo(modelID, -1)
+		if err != nil {
+			return retrieveLatestVersionError(modelID, err)
+		}
+		if unchanged(versionInfo) {
+			return sendHeader(versionInfo, true)
+		}
+	}
+
+	versionInfo, modelData, err := retrieveVerifiedVersion(b, modelID, -1)
+	if err != nil {
+		return retrieveLatestVersionError(modelID, err)
+	}
+	// The latest version can change in between, the retrieved one is checked as well
+	if unchanged != nil && unchanged(versionInfo) {
+		return sendHeader(versionInfo, true)
+	}
+	if err := sendHeader(versionInfo, false); err != nil {
+		return err
+	}
+
+	chunkSize := s.server.negotiateChunkSize(preferredChunkSize)
+	for i := 0; i < len(modelData); i += chunkSize {
+		end := i + chunkSize
+		if end > len(modelData) {
+			end = len(modelData)
+		}
+		err := outStream.Send(&extensionsapi.RetrieveLatestVersionReplyChunk{
+			Msg: &extensionsapi.RetrieveLatestVersionReplyChunk_Body_{
+				Body: &extensionsapi.RetrieveLatestVersionReplyChunk_Body{DataChunk: modelData[i:end]},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func retrieveLatestVersionError(modelID string, err error) error {
+	if errors.As(err, new(*backend.UnknownModelError)) {
+		return errorStatus(codes.NotFound, err)
+	}
+	if errors.As(err, new(*backend.UnknownModelVersionError)) {
+		return errorStatus(codes.NotFound, err)
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Errorf(codes.Internal, `unexpected error while retrieving the latest version for model %q: %s`, modelID, err)
+}
+
+func (s *modelRegistryExtensionsServer) RetrieveVersionDataRange(req *extensionsapi.RetrieveVersionDataRangeRequest, outStream extensionsapi.ModelRegistryExtensionsSP_RetrieveVersionDataRangeServer) error {
+	logging.FromContext(outStream.Context()).WithFields(logrus.Fields{
+		"model_id":       req.ModelId,
+		"version_number": req.VersionNumber,
+		"offset":         req.Offset,
+		"length":         req.Length,
+	}).Info("RetrieveVersionDataRange")
+
+	b, err := s.server.backendPromise.Await(outStream.Context())
+	if err != nil {
+		return err
+	}
+
+	modelData, err := b.RetrieveModelVersionDataRange(req.ModelId, int(req.VersionNumber), req.Offset, req.Length)
+	if err != nil {
+		switch {
+		case errors.Is(err, backend.ErrNotFound):
+			return errorStatus(codes.NotFound, err)
+		case errors.As(err, new(*backend.InvalidDataRangeError)):
+			return status.Errorf(codes.OutOfRange, "%s", err)
+		}
+		return status.Errorf(codes.Internal, `unexpected error while retrieving version "%d" for model %q: %s`, req.VersionNumber, req.ModelId, err)
+	}
+
+	return s.server.sendVersionData(outStream, modelData, s.server.negotiateChunkSize(int(req.PreferredChunkSize)))
+}
+
+func (s *modelRegistryExtensionsServer) RetrieveVersionDataURL(ctx context.Context, req *extensionsapi.RetrieveVersionDataURLRequest) (*extensionsapi.RetrieveVersionDataURLReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"model_id":           req.ModelId,
+		"version_number":     req.VersionNumber,
+		"expiration_seconds": req.ExpirationSeconds,
+	}).Info("RetrieveVersionDataURL")
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	expiration := s.server.presignedURLExpiration
+	if req.ExpirationSeconds > 0 && req.ExpirationSeconds < uint64(expiration/time.Second) {
+		expiration = time.Duration(req.ExpirationSeconds) * time.Second
+	}
+	// The data downloaded from a URL can't be verified by the server, those calls fall back to RetrieveVersionData
+	if expiration > 0 && !s.server.verifyDataHash && !requestsDataHashVerification(ctx) {
+		expirationTime := time.Now().Add(expiration)
+		versionInfo, url, presigned, err := backend.PresignModelVersionData(b, req.ModelId, int(req.VersionNumber), expiration)
+		if err != nil {
+			return nil, retrieveVersionDataError(req.ModelId, int(req.VersionNumber), err)
+		}
+		if presigned {
+			pbVersionInfo := createPbModelVersionInfo(versionInfo)
+			return &extensionsapi.RetrieveVersionDataURLReply{
+				VersionInfo:         &pbVersionInfo,
+				Url:                 url,
+				ExpirationTimestamp: nsTimestampFromTime(expirationTime),
+			}, nil
+		}
+	}
+
+	versionInfo, err := b.RetrieveModelVersionInfo(req.ModelId, int(req.VersionNumber))
+	if err != nil {
+		return nil, retrieveVersionDataError(req.ModelId, int(req.VersionNumber), err)
+	}
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	return &extensionsapi.RetrieveVersionDataURLReply{VersionInfo: &pbVersionInfo}, nil
+}
+
+func (s *modelRegistryExtensionsServer) RetrieveArtifactData(req *extensionsapi.RetrieveArtifactDataRequest, outStream extensionsapi.ModelRegistryExtensionsSP_RetrieveArtifactDataServer) error {
+	logging.FromContext(outStream.Context()).WithFields(logrus.Fields{
+		"model_id":       req.ModelId,
+		"version_number": req.VersionNumber,
+		"artifact_name":  req.ArtifactName,
+	}).Info("RetrieveArtifactData")
+
+	b, err := s.server.backendPromise.Await(outStream.Context())
+	if err != nil {
+		return err
+	}
+
+	versionInfo, artifact, err := retrieveVersionArtifact(b, req.ModelId, int(req.VersionNumber), req.ArtifactName)
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return errorStatus(codes.NotFound, err)
+		}
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.Internal, `unexpected error while retrieving artifact %q of version "%d" for model %q: %s`, req.ArtifactName, req.VersionNumber, req.ModelId, err)
+	}
+
+	// A length of 0 retrieves the data up to its end
+	artifactData := []byte{}
+	if artifact.dataSize > 0 {
+		artifactData, err = b.RetrieveModelVersionDataRange(req.ModelId, int(versionInfo.VersionNumber), artifact.offset, artifact.dataSize)
+		if err != nil {
+			if errors.Is(err, backend.ErrNotFound) {
+				return errorStatus(codes.NotFound, err)
+			}
+			return status.Errorf(codes.Internal, `unexpected error while retrieving artifact %q of version "%d" for model %q: %s`, req.ArtifactName, versionInfo.VersionNumber, req.ModelId, err)
+		}
+	}
+
+	if s.server.verifyDataHash || requestsDataHashVerification(outStream.Context()) {
+		matches, err := backend.VerifyDataHash(artifact.dataHash, artifactData)
+		if err != nil {
+			return status.Errorf(codes.Internal, `unexpected error while verifying artifact %q of version "%d" for model %q: %s`, req.ArtifactName, versionInfo.VersionNumber, req.ModelId, err)
+		}
+		if !matches {
+			return reasonStatus(codes.DataLoss, extensionsapi.ErrorReason_HASH_MISMATCH, map[string]string{
+				"model_id":       req.ModelId,
+				"version_number": strconv.FormatUint(uint64(versionInfo.VersionNumber), 10),
+				"artifact_name":  req.ArtifactName,
+				"data_hash":      artifact.dataHash,
+			}, "data of artifact %q of version \"%d\" for model %q doesn't match its hash %q", req.ArtifactName, versionInfo.VersionNumber, req.ModelId, artifact.dataHash)
+		}
+	}
+
+	return s.server.sendVersionData(outStream, artifactData, s.server.negotiateChunkSize(int(req.PreferredChunkSize)))
+}
+
+func (s *modelRegistryExtensionsServer) QueryModels(ctx context.Context, req *extensionsapi.QueryModelsRequest) (*extensionsapi.QueryModelsReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"namespace":          req.Namespace,
+		"model_id_glob":      req.ModelIdGlob,
+		"user_data_equals":   req.UserDataEquals,
+		"user_data_prefixes": req.UserDataPrefixes,
+		"models_count":       req.ModelsCount,
+		"model_handle":       req.ModelHandle,
+	}).Info("QueryModels")
+
+	cursor := pagination.Cursor{}
+	if req.ModelHandle != "" {
+		var err error
+		cursor, err = s.server.paginationCodec.Decode(modelsPaginationScope, req.ModelHandle)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid value for `model_handle` (%q) only empty or values provided by a previous call should be used", req.ModelHandle)
+		}
+	}
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := backend.ModelFilter{
+		ModelIDGlob:      req.ModelIdGlob,
+		UserDataEquals:   req.UserDataEquals,
+		UserDataPrefixes: req.UserDataPrefixes,
+	}
+	if req.Namespace != "" {
+		if err := namespaces.ValidateName(req.Namespace); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+		}
+		filter.ModelIDGlob = namespaces.ModelIDPrefix(req.Namespace) + "*"
+		if req.ModelIdGlob != "" {
+			filter.ModelIDGlob = namespaces.ModelIDPrefix(req.Namespace) + req.ModelIdGlob
+		}
+	}
+	pbModelInfos, nextCursor, err := retrieveModelsPage(cursor, req.ModelHandle != "", int(req.ModelsCount), func(offset int, limit int) ([]backend.ModelInfo, error) {
+		return b.QueryModels(filter, offset, limit)
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error while querying models: %s", err)
+	}
+
+	return &extensionsapi.QueryModelsReply{
+		ModelInfos:      pbModelInfos,
+		NextModelHandle: s.server.paginationCodec.Encode(modelsPaginationScope, nextCursor),
+	}, nil
+}
+
+func (s *modelRegistryExtensionsServer) QueryVersionInfos(ctx context.Context, req *extensionsapi.QueryVersionInfosRequest) (*extensionsapi.QueryVersionInfosReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"model_id":              req.ModelId,
+		"created_after":         req.CreatedAfter,
+		"created_before":        req.CreatedBefore,
+		"archived":              req.Archived.String(),
+		"user_data_equals":      req.UserDataEquals,
+		"user_data_comparisons": req.UserDataComparisons,
+		"metric_comparisons":    req.MetricComparisons,
+		"order_by_metric":       req.OrderByMetric,
+		"descending":            req.Descending,
+		"framework":             req.Framework,
+		"framework_version":     req.FrameworkVersion,
+		"versions_count":        req.VersionsCount,
+		"version_handle":        req.VersionHandle,
+	}).Info("QueryVersionInfos")
+
+	paginationScope := versionsPaginationScope(req.ModelId)
+	if req.OrderByMetric != "" {
+		if err := validateVersionMetricName(req.OrderByMetric); err != nil {
+			return nil, err
+		}
+		paginationScope = versionsByMetricPaginationScope(req.ModelId, req.OrderByMetric, req.Descending)
+	}
+	cursor := pagination.Cursor{}
+	if req.VersionHandle != "" {
+		var err error
+		cursor, err = s.server.paginationCodec.Decode(paginationScope, req.VersionHandle)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid value for `version_handle` (%q) only empty or values provided by a previous call should be used", req.VersionHandle)
+		}
+	}
+
+	filter := backend.VersionFilter{UserDataEquals: req.UserDataEquals}
+	if req.Framework != "" || req.FrameworkVersion != "" {
+		filter.UserDataEquals = make(map[string]string, len(req.UserDataEquals)+2)
+		for key, value := range req.UserDataEquals {
+			filter.UserDataEquals[key] = value
+		}
+		if req.Framework != "" {
+			filter.UserDataEquals[FrameworkUserDataKey] = req.Framework
+		}
+		if req.FrameworkVersion != "" {
+			filter.UserDataEquals[FrameworkVersionUserDataKey] = req.FrameworkVersion
+		}
+	}
+	if req.CreatedAfter > 0 {
+		filter.CreatedAfter = timeFromNsTimestamp(req.CreatedAfter)
+	}
+	if req.CreatedBefore > 0 {
+		filter.CreatedBefore = timeFromNsTimestamp(req.CreatedBefore)
+	}
+	switch req.Archived {
+	case extensionsapi.ArchivedFilter_ANY_ARCHIVED:
+		filter.Archived = backend.AnyArchived
+	case extensionsapi.ArchivedFilter_ARCHIVED_ONLY:
+		filter.Archived = backend.ArchivedOnly
+	case extensionsapi.ArchivedFilter_NON_ARCHIVED_ONLY:
+		filter.Archived = backend.NonArchivedOnly
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown archived filter %d", req.Archived)
+	}
+	for _, pbComparison := range req.UserDataComparisons {
+		comparison, err := createUserDataComparison(pbComparison.Key, pbComparison)
+		if err != nil {
+			return nil, err
+		}
+		filter.UserDataComparisons = append(filter.UserDataComparisons, comparison)
+	}
+	for _, pbComparison := range req.MetricComparisons {
+		if err := validateVersionMetricName(pbComparison.Key); err != nil {
+			return nil, err
+		}
+		comparison, err := createUserDataComparison(VersionMetricUserDataKeyPrefix+pbComparison.Key, pbComparison)
+		if err != nil {
+			return nil, err
+		}
+		filter.UserDataComparisons = append(filter.UserDataComparisons, comparison)
+	}
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.OrderByMetric != "" {
+		return s.queryVersionInfosByMetric(b, req, filter, cursor, paginationScope)
+	}
+
+	// The cursor offset is the next version number
+	initialVersionNumber := uint(cursor.Offset)
+	versionInfos, err := b.QueryModelVersionInfos(req.ModelId, filter, initialVersionNumber, int(req.VersionsCount))
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return nil, errorStatus(codes.NotFound, err)
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error while querying the versions of model %q: %s", req.ModelId, err)
+	}
+
+	pbVersionInfos := []*grpcapi.ModelVersionInfo{}
+	nextVersionNumber := initialVersionNumber
+	for _, versionInfo := range versionInfos {
+		pbVersionInfo := createPbModelVersionInfo(versionInfo)
+		pbVersionInfos = append(pbVersionInfos, &pbVersionInfo)
+		nextVersionNumber = versionInfo.VersionNumber + 1
+	}
+
+	return &extensionsapi.QueryVersionInfosReply{
+		VersionInfos:      pbVersionInfos,
+		NextVersionHandle: s.server.paginationCodec.Encode(versionsPaginationScope(req.ModelId), pagination.Cursor{Offset: int(nextVersionNumber)}),
+	}, nil
+}
+
+func createUserDataComparison(key string, pbComparison *extensionsapi.UserDataComparison) (backend.UserDataComparison, error) {
+	comparison := backend.UserDataComparison{Key: key, Value: pbComparison.Value}
+	switch pbComparison.Operator {
+	case extensionsapi.ComparisonOperator_LESS_THAN:
+		comparison.Operator = backend.LessThan
+	case extensionsapi.ComparisonOperator_LESS_OR_EQUAL:
+		comparison.Operator = backend.LessOrEqual
+	case extensionsapi.ComparisonOperator_GREATER_THAN:
+		comparison.Operator = backend.GreaterThan
+	case extensionsapi.ComparisonOperator_GREATER_OR_EQUAL:
+		comparison.Operator = backend.GreaterOrEqual
+	default:
+		return backend.UserDataComparison{}, status.Errorf(codes.InvalidArgument, "unknown comparison operator %d for user data key %q", pbComparison.Operator, key)
+	}
+	return comparison, nil
+}
+
+// queryVersionInfosByMetric sorts every selected version by a metric, the cursor offset is then the position in the sorted versions
+func (s *modelRegistryExtensionsServer) queryVersionInfosByMetric(b backend.Backend, req *extensionsapi.QueryVersionInfosRequest, filter backend.VersionFilter, cursor pagination.Cursor, paginationScope string) (*extensionsapi.QueryVersionInfosReply, error) {
+	versionInfos, err := b.QueryModelVersionInfos(req.ModelId, filter, 0, 0)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return nil, errorStatus(codes.NotFound, err)
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error while querying the versions of model %q: %s", req.ModelId, err)
+	}
+	versionInfos = sortVersionInfosByMetric(versionInfos, req.OrderByMetric, req.Descending)
+
+	offset := cursor.Offset
+	if offset > len(versionInfos) {
+		offset = len(versionInfos)
+	}
+	versionInfos = versionInfos[offset:]
+	if req.VersionsCount > 0 && len(versionInfos) > int(req.VersionsCount) {
+		versionInfos = versionInfos[:req.VersionsCount]
+	}
+	pbVersionInfos := []*grpcapi.ModelVersionInfo{}
+	for _, versionInfo := range versionInfos {
+		pbVersionInfo := createPbModelVersionInfo(versionInfo)
+		pbVersionInfos = append(pbVersionInfos, &pbVersionInfo)
+	}
+
+	return &extensionsapi.QueryVersionInfosReply{
+		VersionInfos:      pbVersionInfos,
+		NextVersionHandle: s.server.paginationCodec.Encode(paginationScope, pagination.Cursor{Offset: offset + len(versionInfos)}),
+	}, nil
+}
+
+func (s *modelRegistryExtensionsServer) BeginUpload(ctx context.Context, req *extensionsapi.BeginUploadRequest) (*extensionsapi.BeginUploadReply, error) {
+	receivedVersionInfo := req.GetVersionInfo()
+	if receivedVersionInfo == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "request do not include a VersionInfo")
+	}
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": receivedVersionInfo.ModelId, "data_size": receivedVersionInfo.DataSize}).Info("BeginUpload")
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.server.validateModelID(receivedVersionInfo.ModelId); err != nil {
+		return nil, err
+	}
+	hasModel, err := b.HasModel(receivedVersionInfo.ModelId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error while checking the existence of model %q: %s", receivedVersionInfo.ModelId, err)
+	}
+	if !hasModel {
+		return nil, errorStatus(codes.NotFound, &backend.UnknownModelError{ModelID: receivedVersionInfo.ModelId})
+	}
+
+	if _, err := backend.ParseDataHashAlgorithm(receivedVersionInfo.DataHash); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if err := s.server.verifySignature(receivedVersionInfo); err != nil {
+		return nil, err
+	}
+	if err := validateVersionUserData(b, receivedVersionInfo.ModelId, receivedVersionInfo.UserData); err != nil {
+		return nil, err
+	}
+	if err := s.server.checkVersionDataSize(receivedVersionInfo.ModelId, receivedVersionInfo.DataSize); err != nil {
+		return nil, err
+	}
+	if err := s.server.checkNamespaceQuota(b, receivedVersionInfo.ModelId, namespaces.Usage{VersionsCount: 1, DataSize: int64(receivedVersionInfo.DataSize)}); err != nil {
+		return nil, err
+	}
+
+	creationTimestamp := time.Time{}
+	if receivedVersionInfo.CreationTimestamp > 0 {
+		creationTimestamp = timeFromNsTimestamp(receivedVersionInfo.CreationTimestamp)
+	}
+
+	session, err := s.server.uploadSessions.begin(receivedVersionInfo.ModelId, backend.VersionArgs{
+		CreationTimestamp: creationTimestamp,
+		Archived:          receivedVersionInfo.Archived,
+		DataHash:          receivedVersionInfo.DataHash,
+		DataHashAlgorithm: s.server.hashAlgorithm.Name,
+		UserData:          receivedVersionInfo.UserData,
+	}, receivedVersionInfo.DataSize)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error while starting an upload for model %q: %s", receivedVersionInfo.ModelId, err)
+	}
+
+	return &extensionsapi.BeginUploadReply{
+		UploadId:            session.id,
+		ExpirationTimestamp: nsTimestampFromTime(session.expiresAt),
+	}, nil
+}
+
+// authorizeUpload checks that the client is allowed to write the model of an upload, its id doesn't grant any access
+func (s *modelRegistryExtensionsServer) authorizeUpload(ctx context.Context, uploadID string) (string, error) {
+	modelID, err := s.server.uploadSessions.modelID(uploadID)
+	if err != nil {
+		return "", err
+	}
+	if s.server.authorizeModel != nil {
+		if err := s.server.authorizeModel(ctx, modelID); err != nil {
+			return "", err
+		}
+	}
+	return modelID, nil
+}
+
+func (s *modelRegistryExtensionsServer) AppendChunk(ctx context.Context, req *extensionsapi.AppendChunkRequest) (*extensionsapi.AppendChunkReply, error) {
+	if _, err := s.authorizeUpload(ctx, req.UploadId); err != nil {
+		return nil, err
+	}
+
+	receivedSize, expiresAt, err := s.server.uploadSessions.append(req.UploadId, req.Offset, req.DataChunk)
+	if err != nil {
+		return nil, err
+	}
+
+	return &extensionsapi.AppendChunkReply{
+		ReceivedSize:        receivedSize,
+		ExpirationTimestamp: nsTimestampFromTime(expiresAt),
+	}, nil
+}
+
+func (s *modelRegistryExtensionsServer) CommitUpload(ctx context.Context, req *extensionsapi.CommitUploadRequest) (*extensionsapi.CommitUploadReply, error) {
+	modelID, err := s.authorizeUpload(ctx, req.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	// The upload id grants writing the version, it isn't logged
+	logging.FromContext(ctx).WithField("model_id", modelID).Info("CommitUpload")
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versionInfo, err := s.server.uploadSessions.commit(req.UploadId, func(session *uploadSession) (backend.VersionDataWriter, error) {
+		versionArgs := session.versionArgs
+		if versionArgs.CreationTimestamp.IsZero() {
+			versionArgs.CreationTimestamp = time.Now()
+		}
+		versionArgs.DataSize = int(session.dataSize)
+		writer, err := b.CreateOrUpdateModelVersionStream(session.modelID, versionArgs)
+		if err != nil {
+			return nil, err
+		}
+		return s.server.checkDependenciesOnCommit(b, writer, versionArgs.UserData), nil
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		switch {
+		case errors.As(err, new(*backend.UnknownModelError)):
+			return nil, errorStatus(codes.NotFound, err)
+		case errors.As(err, new(*backend.DataHashMismatchError)):
+			return nil, errorStatus(codes.InvalidArgument, err)
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error while committing upload %q: %s", req.UploadId, err)
+	}
+
+	s.server.publishVersionEvent(versionCreated, versionInfo)
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	return &extensionsapi.CommitUploadReply{VersionInfo: &pbVersionInfo}, nil
+}
+
+// pendingVersion is a version received by CreateVersions whose data is being written
+type pendingVersion struct {
+	receivedVersionInfo *grpcapi.ModelVersionInfo
+	writer              backend.VersionDataWriter
+	receivedDataSize    uint64
+}
+
+func abortPendingVersions(pendingVersions []pendingVersion) {
+	for _, pendingVersion := range pendingVersions {
+		_ = pendingVersion.writer.Abort()
+	}
+}
+
+// rollbackVersions deletes versions committed by CreateVersions before one failed
+func rollbackVersions(b backend.Backend, versionInfos []backend.VersionInfo) {
+	for _, versionInfo := range versionInfos {
+		err := b.DeleteModelVersion(versionInfo.ModelID, int(versionInfo.VersionNumber))
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"model_id": versionInfo.ModelID, "version_number": versionInfo.VersionNumber}).WithError(err).Error("unable to rollback the creation of a version")
+		}
+	}
+}
+
+func (s *modelRegistryExtensionsServer) CreateVersions(inStream extensionsapi.ModelRegistryExtensionsSP_CreateVersionsServer) error {
+	logging.FromContext(inStream.Context()).Info("CreateVersions")
+
+	b, err := s.server.backendPromise.Await(inStream.Context())
+	if err != nil {
+		return err
+	}
+
+	pendingVersions := []pendingVersion{}
+	// Versions pending in the stream count in the quotas of their namespaces
+	pendingNamespaceUsages := map[string]namespaces.Usage{}
+	checkLastPendingVersionComplete := func() error {
+		if len(pendingVersions) == 0 {
+			return nil
+		}
+		lastPendingVersion := pendingVersions[len(pendingVersions)-1]
+		if lastPendingVersion.receivedDataSize != lastPendingVersion.receivedVersionInfo.DataSize {
+			return status.Errorf(codes.InvalidArgument, "version %d of the stream ended while having not received the expected data, expected %d bytes, received %d bytes", len(pendingVersions), lastPendingVersion.receivedVersionInfo.DataSize, lastPendingVersion.receivedDataSize)
+		}
+		return nil
+	}
+
+	for {
+		chunk, err := inStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			abortPendingVersions(pendingVersions)
+			return err
+		}
+
+		if header := chunk.GetHeader(); header != nil {
+			if err := checkLastPendingVersionComplete(); err != nil {
+				abortPendingVersions(pendingVersions)
+				return err
+			}
+
+			receivedVersionInfo := header.GetVersionInfo()
+			if receivedVersionInfo == nil {
+				abortPendingVersions(pendingVersions)
+				return status.Errorf(codes.InvalidArgument, "request chunk Header do not include a VersionInfo")
+			}
+			creationTimestamp := time.Now()
+			if receivedVersionInfo.CreationTimestamp > 0 {
+				creationTimestamp = timeFromNsTimestamp(receivedVersionInfo.CreationTimestamp)
+			}
+			if err := s.server.validateModelID(receivedVersionInfo.ModelId); err != nil {
+				abortPendingVersions(pendingVersions)
+				return err
+			}
+			hasModel, err := b.HasModel(receivedVersionInfo.ModelId)
+			if err != nil {
+				abortPendingVersions(pendingVersions)
+				return status.Errorf(codes.Internal, "unexpected error while creating a version for model %q: %s", receivedVersionInfo.ModelId, err)
+			}
+			if !hasModel {
+				abortPendingVersions(pendingVersions)
+				return errorStatus(codes.NotFound, &backend.UnknownModelError{ModelID: receivedVersionInfo.ModelId})
+			}
+			if _, err := backend.ParseDataHashAlgorithm(receivedVersionInfo.DataHash); err != nil {
+				abortPendingVersions(pendingVersions)
+				return status.Errorf(codes.InvalidArgument, "%s", err)
+			}
+			if err := s.server.verifySignature(receivedVersionInfo); err != nil {
+				abortPendingVersions(pendingVersions)
+				return err
+			}
+			if err := validateVersionUserData(b, receivedVersionInfo.ModelId, receivedVersionInfo.UserData); err != nil {
+				abortPendingVersions(pendingVersions)
+				return err
+			}
+			if err := s.server.checkVersionDataSize(receivedVersionInfo.ModelId, receivedVersionInfo.DataSize); err != nil {
+				abortPendingVersions(pendingVersions)
+				return err
+			}
+			namespace := namespaces.Namespace(receivedVersionInfo.ModelId)
+			pendingUsage := pendingNamespaceUsages[namespace]
+			pendingUsage.VersionsCount++
+			pendingUsage.DataSize += int64(receivedVersionInfo.DataSize)
+			if err := s.server.checkNamespaceQuota(b, receivedVersionInfo.ModelId, pendingUsage); err != nil {
+				abortPendingVersions(pendingVersions)
+				return err
+			}
+			pendingNamespaceUsages[namespace] = pendingUsage
+			// Backends streaming the data might reserve the version number when the writer is created,
+			// buffering lets several versions of the same model be pending at once.
+			writer := s.server.checkDependenciesOnCommit(b, backend.CreateBufferedVersionDataWriter(b, receivedVersionInfo.ModelId, backend.VersionArgs{
+				CreationTimestamp: creationTimestamp,
+				Archived:          receivedVersionInfo.Archived,
+				DataHash:          receivedVersionInfo.DataHash,
+				DataHashAlgorithm: s.server.hashAlgorithm.Name,
+				UserData:          receivedVersionInfo.UserData,
+			}), receivedVersionInfo.UserData)
+			pendingVersions = append(pendingVersions, pendingVersion{receivedVersionInfo: receivedVersionInfo, writer: writer})
+			continue
+		}
+
+		if chunk.GetBody() == nil || len(pendingVersions) == 0 {
+			abortPendingVersions(pendingVersions)
+			return status.Errorf(codes.InvalidArgument, "request chunk do not include a Body or is not preceded by a Header")
+		}
+		currentPendingVersion := &pendingVersions[len(pendingVersions)-1]
+		currentPendingVersion.receivedDataSize += uint64(len(chunk.GetBody().DataChunk))
+		if currentPendingVersion.receivedDataSize > currentPendingVersion.receivedVersionInfo.DataSize {
+			abortPendingVersions(pendingVersions)
+			return status.Errorf(codes.InvalidArgument, "version %d of the stream received more data than expected, expected %d bytes, received %d bytes", len(pendingVersions), currentPendingVersion.receivedVersionInfo.DataSize, currentPendingVersion.receivedDataSize)
+		}
+		_, err = currentPendingVersion.writer.Write(chunk.GetBody().DataChunk)
+		if err != nil {
+			abortPendingVersions(pendingVersions)
+			return status.Errorf(codes.Internal, "unexpected error while writing the data of a version for model %q: %s", currentPendingVersion.receivedVersionInfo.ModelId, err)
+		}
+	}
+
+	if len(pendingVersions) == 0 {
+		return status.Errorf(codes.InvalidArgument, "empty request")
+	}
+	if err := checkLastPendingVersionComplete(); err != nil {
+		abortPendingVersions(pendingVersions)
+		return err
+	}
+
+	// Versions are only committed once all of them have been received
+	versionInfos := make([]backend.VersionInfo, 0, len(pendingVersions))
+	for pendingVersionIdx, pendingVersion := range pendingVersions {
+		versionInfo, err := pendingVersion.writer.Commit()
+		if err != nil {
+			abortPendingVersions(pendingVersions[pendingVersionIdx+1:])
+			rollbackVersions(b, versionInfos)
+			if _, ok := status.FromError(err); ok {
+				return err
+			}
+			if errors.As(err, new(*backend.DataHashMismatchError)) {
+				return errorStatus(codes.InvalidArgument, err)
+			}
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				return errorStatus(codes.NotFound, err)
+			}
+			return status.Errorf(codes.Internal, "unexpected error while creating a version for model %q: %s", pendingVersion.receivedVersionInfo.ModelId, err)
+		}
+		versionInfos = append(versionInfos, versionInfo)
+	}
+
+	pbVersionInfos := []*grpcapi.ModelVersionInfo{}
+	for _, versionInfo := range versionInfos {
+		s.server.publishVersionEvent(versionCreated, versionInfo)
+		pbVersionInfo := createPbModelVersionInfo(versionInfo)
+		pbVersionInfos = append(pbVersionInfos, &pbVersionInfo)
+	}
+
+	return inStream.SendAndClose(&extensionsapi.CreateVersionsReply{VersionInfos: pbVersionInfos})
+}
+
+// receivedArtifact is an artifact received by CreateVersionWithArtifacts whose data is being hashed
+type receivedArtifact struct {
+	artifact         versionArtifact
+	expectedDataHash string
+	hasher           backend.Hasher
+}
+
+func (s *modelRegistryExtensionsServer) CreateVersionWithArtifacts(inStream extensionsapi.ModelRegistryExtensionsSP_CreateVersionWithArtifactsServer) error {
+	logging.FromContext(inStream.Context()).Info("CreateVersionWithArtifacts")
+
+	firstChunk, err := inStream.Recv()
+	if err == io.EOF {
+		return status.Errorf(codes.InvalidArgument, "empty request")
+	}
+	if err != nil {
+		return err
+	}
+	receivedVersionInfo := firstChunk.GetHeader().GetVersionInfo()
+	if receivedVersionInfo == nil {
+		return status.Errorf(codes.InvalidArgument, "first request chunk do not include a Header with a VersionInfo")
+	}
+
+	b, err := s.server.backendPromise.Await(inStream.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := s.server.validateModelID(receivedVersionInfo.ModelId); err != nil {
+		return err
+	}
+	if _, err := backend.ParseDataHashAlgorithm(receivedVersionInfo.DataHash); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if err := s.server.verifySignature(receivedVersionInfo); err != nil {
+		return err
+	}
+	if err := validateVersionUserData(b, receivedVersionInfo.ModelId, receivedVersionInfo.UserData); err != nil {
+		return err
+	}
+
+	// The artifacts are stored in the user data of the version, it is only created once all of them are received
+	data := new(bytes.Buffer)
+	receivedArtifacts := []receivedArtifact{}
+	checkLastArtifactComplete := func() error {
+		if len(receivedArtifacts) == 0 {
+			return nil
+		}
+		lastArtifact := &receivedArtifacts[len(receivedArtifacts)-1]
+		receivedDataSize := uint64(data.Len()) - lastArtifact.artifact.offset
+		if receivedDataSize != lastArtifact.artifact.dataSize {
+			return status.Errorf(codes.InvalidArgument, "artifact %q ended while having not received the expected data, expected %d bytes, received %d bytes", lastArtifact.artifact.name, lastArtifact.artifact.dataSize, receivedDataSize)
+		}
+		lastArtifact.artifact.dataHash = lastArtifact.hasher.Hash()
+		if lastArtifact.expectedDataHash != "" && lastArtifact.expectedDataHash != lastArtifact.artifact.dataHash {
+			return reasonStatus(codes.InvalidArgument, extensionsapi.ErrorReason_HASH_MISMATCH, map[string]string{
+				"artifact_name":      lastArtifact.artifact.name,
+				"expected_data_hash": lastArtifact.expectedDataHash,
+				"data_hash":          lastArtifact.artifact.dataHash,
+			}, "data of artifact %q did not match the expected hash, expected %q, received %q", lastArtifact.artifact.name, lastArtifact.expectedDataHash, lastArtifact.artifact.dataHash)
+		}
+		return nil
+	}
+
+	artifactNames := map[string]bool{}
+	for {
+		chunk, err := inStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if artifactHeader := chunk.GetArtifactHeader(); artifactHeader != nil {
+			if err := checkLastArtifactComplete(); err != nil {
+				return err
+			}
+			if artifactHeader.Name == "" {
+				return status.Errorf(codes.InvalidArgument, "artifact %d of the stream do not have a name", len(receivedArtifacts)+1)
+			}
+			if artifactNames[artifactHeader.Name] {
+				return status.Errorf(codes.InvalidArgument, "artifact %q is defined more than once", artifactHeader.Name)
+			}
+			artifactNames[artifactHeader.Name] = true
+			// The data of the version is the concatenation of its artifacts
+			if err := s.server.checkVersionDataSize(receivedVersionInfo.ModelId, uint64(data.Len())+artifactHeader.DataSize); err != nil {
+				return err
+			}
+			hasher, err := backend.CreateVersionHasher(backend.VersionArgs{DataHash: artifactHeader.DataHash, DataHashAlgorithm: s.server.hashAlgorithm.Name})
+			if err != nil {
+				return status.Errorf(codes.InvalidArgument, "%s", err)
+			}
+			receivedArtifacts = append(receivedArtifacts, receivedArtifact{
+				artifact:         versionArtifact{name: artifactHeader.Name, offset: uint64(data.Len()), dataSize: artifactHeader.DataSize},
+				expectedDataHash: artifactHeader.DataHash,
+				hasher:           hasher,
+			})
+			continue
+		}
+
+		if chunk.GetBody() == nil || len(receivedArtifacts) == 0 {
+			return status.Errorf(codes.InvalidArgument, "request chunk do not include a Body or is not preceded by an ArtifactHeader")
+		}
+		currentArtifact := &receivedArtifacts[len(receivedArtifacts)-1]
+		dataChunk := chunk.GetBody().DataChunk
+		receivedDataSize := uint64(data.Len()) - currentArtifact.artifact.offset + uint64(len(dataChunk))
+		if receivedDataSize > currentArtifact.artifact.dataSize {
+			return status.Errorf(codes.InvalidArgument, "artifact %q received more data than expected, expected %d bytes, received %d bytes", currentArtifact.artifact.name, currentArtifact.artifact.dataSize, receivedDataSize)
+		}
+		data.Write(dataChunk)
+		_, _ = currentArtifact.hasher.Write(dataChunk)
+	}
+
+	if len(receivedArtifacts) == 0 {
+		return status.Errorf(codes.InvalidArgument, "request do not include any artifact")
+	}
+	if err := checkLastArtifactComplete(); err != nil {
+		return err
+	}
+
+	if err := s.server.checkNamespaceQuota(b, receivedVersionInfo.ModelId, namespaces.Usage{VersionsCount: 1, DataSize: int64(data.Len())}); err != nil {
+		return err
+	}
+
+	userData := make(map[string]string, len(receivedVersionInfo.UserData)+len(receivedArtifacts))
+	for key, value := range receivedVersionInfo.UserData {
+		userData[key] = value
+	}
+	for _, receivedArtifact := range receivedArtifacts {
+		userData[VersionArtifactUserDataKeyPrefix+receivedArtifact.artifact.name] = formatVersionArtifact(receivedArtifact.artifact)
+	}
+	creationTimestamp := time.Now()
+	if receivedVersionInfo.CreationTimestamp > 0 {
+		creationTimestamp = timeFromNsTimestamp(receivedVersionInfo.CreationTimestamp)
+	}
+	writer := s.server.checkDependenciesOnCommit(b, backend.CreateBufferedVersionDataWriter(b, receivedVersionInfo.ModelId, backend.VersionArgs{
+		CreationTimestamp: creationTimestamp,
+		Archived:          receivedVersionInfo.Archived,
+		DataHash:          receivedVersionInfo.DataHash,
+		DataHashAlgorithm: s.server.hashAlgorithm.Name,
+		UserData:          userData,
+	}), userData)
+	if _, err := writer.Write(data.Bytes()); err != nil {
+		return status.Errorf(codes.Internal, "unexpected error while writing the data of a version for model %q: %s", receivedVersionInfo.ModelId, err)
+	}
+	versionInfo, err := writer.Commit()
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		switch {
+		case errors.As(err, new(*backend.DataHashMismatchError)):
+			return errorStatus(codes.InvalidArgument, err)
+		case errors.As(err, new(*backend.UnknownModelError)):
+			return errorStatus(codes.NotFound, err)
+		}
+		return status.Errorf(codes.Internal, "unexpected error while creating a version for model %q: %s", receivedVersionInfo.ModelId, err)
+	}
+
+	s.server.publishVersionEvent(versionCreated, versionInfo)
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	pbArtifacts := make([]*extensionsapi.VersionArtifact, 0, len(receivedArtifacts))
+	for _, receivedArtifact := range receivedArtifacts {
+		pbArtifacts = append(pbArtifacts, createPbVersionArtifact(receivedArtifact.artifact))
+	}
+	return inStream.SendAndClose(&extensionsapi.CreateVersionWithArtifactsReply{VersionInfo: &pbVersionInfo, Artifacts: pbArtifacts})
+}
+
+func (s *modelRegistryExtensionsServer) DeleteVersion(ctx context.Context, req *extensionsapi.DeleteVersionRequest) (*extensionsapi.DeleteVersionReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber, "force": req.Force, "cascade": req.Cascade}).Info("DeleteVersion")
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolving the version first to check if it is archived or locked and to delete the
+	// resolved version even if a new one is created in between
+	versionInfo, err := b.RetrieveModelVersionInfo(req.ModelId, int(req.VersionNumber))
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return nil, errorStatus(codes.NotFound, err)
+		}
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return nil, errorStatus(codes.NotFound, err)
+		}
+		return nil, status.Errorf(codes.Internal, `unexpected error while deleting version "%d" for model %q: %s`, req.VersionNumber, req.ModelId, err)
+	}
+	if err := s.checkVersionDeletable(ctx, versionInfo, req.Force); err != nil {
+		return nil, err
+	}
+
+	dependents, unlock, err := s.server.lockTransitiveDependents(b, versionInfo)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, `unexpected error while retrieving the dependents of version "%d" for model %q: %s`, versionInfo.VersionNumber, req.ModelId, err)
+	}
+	defer unlock()
+	if len(dependents) > 0 {
+		if !req.Cascade {
+			return nil, versionDependedUponStatus(req.ModelId, versionInfo.VersionNumber, dependents, `versions %s depend on version "%d" for model %q, set cascade to delete them as well`, versionReferences(dependents), versionInfo.VersionNumber, req.ModelId)
+		}
+		// Every dependent is checked before deleting anything
+		for _, dependent := range dependents {
+			if err := s.checkVersionDeletable(ctx, dependent, req.Force); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	pbDeletedDependents := make([]*grpcapi.ModelVersionInfo, 0, len(dependents))
+	for _, dependent := range dependents {
+		if err := s.deleteResolvedVersion(ctx, b, dependent); err != nil {
+			return nil, err
+		}
+		pbDependent := createPbModelVersionInfo(dependent)
+		pbDeletedDependents = append(pbDeletedDependents, &pbDependent)
+	}
+	if err := s.deleteResolvedVersion(ctx, b, versionInfo); err != nil {
+		return nil, err
+	}
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	return &extensionsapi.DeleteVersionReply{VersionInfo: &pbVersionInfo, DeletedDependents: pbDeletedDependents}, nil
+}
+
+// checkVersionDeletable rejects the deletion of locked versions and, unless forced, of leased or archived versions
+func (s *modelRegistryExtensionsServer) checkVersionDeletable(ctx context.Context, versionInfo backend.VersionInfo, force bool) error {
+	if isVersionLocked(versionInfo) {
+		return versionLockedStatus(versionInfo, "delete")
+	}
+	if leases := s.server.versionLeases.list(versionInfo.ModelID, versionInfo.VersionNumber); len(leases) > 0 {
+		if !force {
+			return versionLeasedStatus(leases, `version "%d" for model %q is leased by %s, set force to delete it`, versionInfo.VersionNumber, versionInfo.ModelID, leaseHolders(leases))
+		}
+		logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": versionInfo.ModelID, "version_number": versionInfo.VersionNumber, "holders": leaseHolders(leases)}).Warn("Deleting a leased version")
+	}
+	if versionInfo.Archived && !force {
+		return status.Errorf(codes.FailedPrecondition, `version "%d" for model %q is archived, set force to delete it`, versionInfo.VersionNumber, versionInfo.ModelID)
+	}
+	return nil
+}
+
+// deleteResolvedVersion deletes a version, releases its leases and forgets its stage history
+func (s *modelRegistryExtensionsServer) deleteResolvedVersion(ctx context.Context, b backend.Backend, versionInfo backend.VersionInfo) error {
+	err := b.DeleteModelVersion(versionInfo.ModelID, int(versionInfo.VersionNumber))
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return errorStatus(codes.NotFound, err)
+		}
+		if errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return errorStatus(codes.NotFound, err)
+		}
+		return status.Errorf(codes.Internal, `unexpected error while deleting version "%d" for model %q: %s`, versionInfo.VersionNumber, versionInfo.ModelID, err)
+	}
+
+	s.server.publishVersionEvent(versionDeleted, versionInfo)
+	s.server.versionLeases.releaseVersion(versionInfo.ModelID, versionInfo.VersionNumber)
+
+	unlock := s.server.modelUserDataLocks.Lock(versionInfo.ModelID)
+	modelInfo, updated, err := forgetVersionStageHistory(b, versionInfo.ModelID, versionInfo.VersionNumber)
+	unlock()
+	if err != nil {
+		logging.FromContext(ctx).WithField("model_id", versionInfo.ModelID).WithError(err).Warn("Unable to remove the stage history of a deleted version")
+	} else if updated {
+		s.server.publishModelEvent(modelUpdated, modelInfo)
+	}
+	return nil
+}
+
+func (s *modelRegistryExtensionsServer) updateVersionArchived(ctx context.Context, modelID string, versionNumber int, archived bool) (backend.VersionInfo, error) {
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+
+	// Serialized with UpdateVersionInfo, which checks the etag of the version before changing it
+	unlock := s.server.versionInfoLocks.Lock(modelID)
+	defer unlock()
+
+	updateError := func(err error) error {
+		if errors.Is(err, backend.ErrNotFound) {
+			return errorStatus(codes.NotFound, err)
+		}
+		return status.Errorf(codes.Internal, `unexpected error while updating version "%d" for model %q: %s`, versionNumber, modelID, err)
+	}
+
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, updateError(err)
+	}
+	if isVersionLocked(versionInfo) {
+		if archived {
+			return backend.VersionInfo{}, versionLockedStatus(versionInfo, "archive")
+		}
+		return backend.VersionInfo{}, versionLockedStatus(versionInfo, "unarchive")
+	}
+	versionInfo, err = b.UpdateModelVersionArchived(modelID, int(versionInfo.VersionNumber), archived)
+	if err != nil {
+		return backend.VersionInfo{}, updateError(err)
+	}
+	s.server.publishVersionEvent(versionUpdated, versionInfo)
+	return versionInfo, nil
+}
+
+func (s *modelRegistryExtensionsServer) updateVersionLocked(ctx context.Context, modelID string, versionNumber int, locked bool) (backend.VersionInfo, error) {
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+
+	// Serialized with UpdateVersionInfo, the lock is checked before changing the version
+	unlock := s.server.versionInfoLocks.Lock(modelID)
+	defer unlock()
+
+	updateError := func(err error) error {
+		if errors.Is(err, backend.ErrNotFound) {
+			return errorStatus(codes.NotFound, err)
+		}
+		return status.Errorf(codes.Internal, `unexpected error while updating version "%d" for model %q: %s`, versionNumber, modelID, err)
+	}
+
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, updateError(err)
+	}
+	if isVersionLocked(versionInfo) == locked {
+		return versionInfo, nil
+	}
+	versionInfo, err = b.UpdateModelVersionUserData(modelID, int(versionInfo.VersionNumber), lockedUserData(versionInfo.UserData, locked))
+	if err != nil {
+		return backend.VersionInfo{}, updateError(err)
+	}
+	s.server.publishVersionEvent(versionUpdated, versionInfo)
+	return versionInfo, nil
+}
+
+func (s *modelRegistryExtensionsServer) ArchiveVersion(ctx context.Context, req *extensionsapi.ArchiveVersionRequest) (*extensionsapi.ArchiveVersionReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber}).Info("ArchiveVersion")
+
+	versionInfo, err := s.updateVersionArchived(ctx, req.ModelId, int(req.VersionNumber), true)
+	if err != nil {
+		return nil, err
+	}
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	return &extensionsapi.ArchiveVersionReply{VersionInfo: &pbVersionInfo}, nil
+}
+
+func (s *modelRegistryExtensionsServer) UnarchiveVersion(ctx context.Context, req *extensionsapi.UnarchiveVersionRequest) (*extensionsapi.UnarchiveVersionReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber}).Info("UnarchiveVersion")
+
+	versionInfo, err := s.updateVersionArchived(ctx, req.ModelId, int(req.VersionNumber), false)
+	if err != nil {
+		return nil, err
+	}
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	return &extensionsapi.UnarchiveVersionReply{VersionInfo: &pbVersionInfo}, nil
+}
+
+func (s *modelRegistryExtensionsServer) LockVersion(ctx context.Context, req *extensionsapi.LockVersionRequest) (*extensionsapi.LockVersionReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber}).Info("LockVersion")
+
+	versionInfo, err := s.updateVersionLocked(ctx, req.ModelId, int(req.VersionNumber), true)
+	if err != nil {
+		return nil, err
+	}
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	return &extensionsapi.LockVersionReply{VersionInfo: &pbVersionInfo}, nil
+}
+
+func (s *modelRegistryExtensionsServer) UnlockVersion(ctx context.Context, req *extensionsapi.UnlockVersionRequest) (*extensionsapi.UnlockVersionReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber}).Info("UnlockVersion")
+
+	versionInfo, err := s.updateVersionLocked(ctx, req.ModelId, int(req.VersionNumber), false)
+	if err != nil {
+		return nil, err
+	}
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	return &extensionsapi.UnlockVersionReply{VersionInfo: &pbVersionInfo}, nil
+}
+
+func (s *modelRegistryExtensionsServer) AcquireVersionLease(ctx context.Context, req *extensionsapi.AcquireVersionLeaseRequest) (*extensionsapi.AcquireVersionLeaseReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber, "holder": req.Holder}).Info("AcquireVersionLease")
+
+	if req.Holder == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "unable to acquire a lease without holder")
+	}
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versionInfo, err := b.RetrieveModelVersionInfo(req.ModelId, int(req.VersionNumber))
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return nil, errorStatus(codes.NotFound, err)
+		}
+		return nil, status.Errorf(codes.Internal, `unexpected error while leasing version "%d" for model %q: %s`, req.VersionNumber, req.ModelId, err)
+	}
+	lease, err := s.server.versionLeases.acquire(req.ModelId, versionInfo.VersionNumber, req.Holder)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, `unexpected error while leasing version "%d" for model %q: %s`, versionInfo.VersionNumber, req.ModelId, err)
+	}
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	return &extensionsapi.AcquireVersionLeaseReply{Lease: createPbVersionLease(lease), VersionInfo: &pbVersionInfo}, nil
+}
+
+// authorizeLease checks that the client is allowed to write the model of a lease, its id doesn't grant any access
+func (s *modelRegistryExtensionsServer) authorizeLease(ctx context.Context, leaseID string) (string, error) {
+	modelID, err := s.server.versionLeases.modelID(leaseID)
+	if err != nil {
+		return "", err
+	}
+	if s.server.authorizeModel != nil {
+		if err := s.server.authorizeModel(ctx, modelID); err != nil {
+			return "", err
+		}
+	}
+	return modelID, nil
+}
+
+func (s *modelRegistryExtensionsServer) RenewVersionLease(ctx context.Context, req *extensionsapi.RenewVersionLeaseRequest) (*extensionsapi.RenewVersionLeaseReply, error) {
+	modelID, err := s.authorizeLease(ctx, req.LeaseId)
+	if err != nil {
+		return nil, err
+	}
+	logging.FromContext(ctx).WithField("model_id", modelID).Debug("RenewVersionLease")
+
+	lease, err := s.server.versionLeases.renew(req.LeaseId)
+	if err != nil {
+		return nil, err
+	}
+	return &extensionsapi.RenewVersionLeaseReply{Lease: createPbVersionLease(lease)}, nil
+}
+
+func (s *modelRegistryExtensionsServer) ReleaseVersionLease(ctx context.Context, req *extensionsapi.ReleaseVersionLeaseRequest) (*extensionsapi.ReleaseVersionLeaseReply, error) {
+	modelID, err := s.authorizeLease(ctx, req.LeaseId)
+	if err != nil {
+		return nil, err
+	}
+	logging.FromContext(ctx).WithField("model_id", modelID).Info("ReleaseVersionLease")
+
+	if _, err := s.server.versionLeases.release(req.LeaseId); err != nil {
+		return nil, err
+	}
+	return &extensionsapi.ReleaseVersionLeaseReply{}, nil
+}
+
+func (s *modelRegistryExtensionsServer) ListVersionLeases(ctx context.Context, req *extensionsapi.ListVersionLeasesRequest) (*extensionsapi.ListVersionLeasesReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber}).Info("ListVersionLeases")
+
+	leases := s.server.versionLeases.list(req.ModelId, uint(req.VersionNumber))
+	pbLeases := make([]*extensionsapi.VersionLease, 0, len(leases))
+	for _, lease := range leases {
+		// The ids are only known by the holders, they are the ones renewing and releasing their leases
+		lease.id = ""
+		pbLeases = append(pbLeases, createPbVersionLease(lease))
+	}
+	return &extensionsapi.ListVersionLeasesReply{Leases: pbLeases}, nil
+}
+
+func (s *modelRegistryExtensionsServer) RestoreVersion(ctx context.Context, req *extensionsapi.RestoreVersionRequest) (*extensionsapi.RestoreVersionReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber}).Info("RestoreVersion")
+
+	coldStorageBackend := s.server.getColdStorageBackend()
+	if coldStorageBackend == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "unable to restore versions, no cold storage backend is configured")
+	}
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	restoreError := func(err error) error {
+		if errors.Is(err, backend.ErrNotFound) {
+			return errorStatus(codes.NotFound, err)
+		}
+		return status.Errorf(codes.Internal, `unexpected error while restoring version "%d" for model %q: %s`, req.VersionNumber, req.ModelId, err)
+	}
+
+	versionInfo, err := b.RetrieveModelVersionInfo(req.ModelId, int(req.VersionNumber))
+	if err != nil {
+		return nil, restoreError(err)
+	}
+	restored, err := coldStorageBackend.RestoreModelVersion(req.ModelId, versionInfo.VersionNumber)
+	if err != nil {
+		if !errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return nil, restoreError(err)
+		}
+		// Non-archived versions may only be stored in memory, they are never moved
+		restored = false
+	}
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	return &extensionsapi.RestoreVersionReply{VersionInfo: &pbVersionInfo, Restored: restored}, nil
+}
+
+func (s *modelRegistryExtensionsServer) UpdateVersionInfo(ctx context.Context, req *extensionsapi.UpdateVersionInfoRequest) (*extensionsapi.UpdateVersionInfoReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber}).Info("UpdateVersionInfo")
+
+	if req.Archive && req.Unarchive {
+		return nil, status.Errorf(codes.InvalidArgument, "unable to both archive and unarchive a version")
+	}
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := s.server.versionInfoLocks.Lock(req.ModelId)
+	defer unlock()
+
+	updateError := func(err error) error {
+		if errors.Is(err, backend.ErrNotFound) {
+			return errorStatus(codes.NotFound, err)
+		}
+		return status.Errorf(codes.Internal, `unexpected error while updating version "%d" for model %q: %s`, req.VersionNumber, req.ModelId, err)
+	}
+
+	versionInfo, err := b.RetrieveModelVersionInfo(req.ModelId, int(req.VersionNumber))
+	if err != nil {
+		return nil, updateError(err)
+	}
+	if req.ExpectedEtag != "" && req.ExpectedEtag != versionETag(versionInfo) {
+		return nil, status.Errorf(codes.Aborted, `unable to update version "%d" of model %q, it changed since etag %q was returned`, versionInfo.VersionNumber, req.ModelId, req.ExpectedEtag)
+	}
+	if isVersionLocked(versionInfo) {
+		return nil, versionLockedStatus(versionInfo, "update")
+	}
+	userData, err := patchVersionUserData(versionInfo.UserData, req.Description, req.ClearDescription, req.UserData, req.RemovedUserDataKeys)
+	if err != nil {
+		return nil, err
+	}
+	if err := patchVersionMetrics(userData, req.Metrics, req.RemovedMetricNames); err != nil {
+		return nil, err
+	}
+
+	updated := false
+	if (req.Archive && !versionInfo.Archived) || (req.Unarchive && versionInfo.Archived) {
+		versionInfo, err = b.UpdateModelVersionArchived(req.ModelId, int(versionInfo.VersionNumber), req.Archive)
+		if err != nil {
+			return nil, updateError(err)
+		}
+		updated = true
+	}
+	if !userDataEqual(userData, versionInfo.UserData) {
+		versionInfo, err = b.UpdateModelVersionUserData(req.ModelId, int(versionInfo.VersionNumber), userData)
+		if err != nil {
+			return nil, updateError(err)
+		}
+		updated = true
+	}
+	if updated {
+		s.server.publishVersionEvent(versionUpdated, versionInfo)
+	}
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	return &extensionsapi.UpdateVersionInfoReply{VersionInfo: &pbVersionInfo, Etag: versionETag(versionInfo)}, nil
+}
+
+func (s *modelRegistryExtensionsServer) RetrieveLineage(ctx context.Context, req *extensionsapi.RetrieveLineageRequest) (*extensionsapi.RetrieveLineageReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber, "max_depth": req.MaxDepth}).Info("RetrieveLineage")
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestors, err := retrieveVersionAncestors(b, req.ModelId, int(req.VersionNumber), int(req.MaxDepth))
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return nil, errorStatus(codes.NotFound, err)
+		}
+		return nil, status.Errorf(codes.Internal, `unexpected error while retrieving the lineage of version "%d" for model %q: %s`, req.VersionNumber, req.ModelId, err)
+	}
+
+	pbAncestors := make([]*extensionsapi.VersionAncestor, 0, len(ancestors))
+	for _, ancestor := range ancestors {
+		pbVersionInfo := createPbModelVersionInfo(ancestor.versionInfo)
+		pbAncestors = append(pbAncestors, &extensionsapi.VersionAncestor{VersionInfo: &pbVersionInfo, Lineage: createPbVersionLineage(ancestor.lineage)})
+	}
+	return &extensionsapi.RetrieveLineageReply{Ancestors: pbAncestors}, nil
+}
+
+func (s *modelRegistryExtensionsServer) RetrieveDependencyGraph(ctx context.Context, req *extensionsapi.RetrieveDependencyGraphRequest) (*extensionsapi.RetrieveDependencyGraphReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber, "include_dependents": req.IncludeDependents}).Info("RetrieveDependencyGraph")
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	graph, err := retrieveDependencyGraph(b, req.ModelId, int(req.VersionNumber), req.IncludeDependents)
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return nil, errorStatus(codes.NotFound, err)
+		}
+		return nil, status.Errorf(codes.Internal, `unexpected error while retrieving the dependency graph of version "%d" for model %q: %s`, req.VersionNumber, req.ModelId, err)
+	}
+
+	pbVersionInfos := make([]*grpcapi.ModelVersionInfo, 0, len(graph.versionInfos))
+	for _, versionInfo := range graph.versionInfos {
+		pbVersionInfo := createPbModelVersionInfo(versionInfo)
+		pbVersionInfos = append(pbVersionInfos, &pbVersionInfo)
+	}
+	pbEdges := make([]*extensionsapi.VersionDependencyEdge, 0, len(graph.edges))
+	for _, edge := range graph.edges {
+		pbEdges = append(pbEdges, &extensionsapi.VersionDependencyEdge{Dependent: createPbVersionReference(edge[0]), Dependency: createPbVersionReference(edge[1])})
+	}
+	return &extensionsapi.RetrieveDependencyGraphReply{Versions: pbVersionInfos, Edges: pbEdges}, nil
+}
+
+func (s *modelRegistryExtensionsServer) RetrieveVersionManifest(ctx context.Context, req *extensionsapi.RetrieveVersionManifestRequest) (*extensionsapi.RetrieveVersionManifestReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber}).Info("RetrieveVersionManifest")
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versionInfo, err := b.RetrieveModelVersionInfo(req.ModelId, int(req.VersionNumber))
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return nil, errorStatus(codes.NotFound, err)
+		}
+		return nil, status.Errorf(codes.Internal, `unexpected error while retrieving version "%d" for model %q: %s`, req.VersionNumber, req.ModelId, err)
+	}
+	manifest, err := parseVersionManifest(versionInfo.UserData)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, `invalid manifest for version "%d" of model %q: %s`, versionInfo.VersionNumber, req.ModelId, err)
+	}
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	rep := &extensionsapi.RetrieveVersionManifestReply{VersionInfo: &pbVersionInfo}
+	if manifest != nil {
+		rep.Manifest = createPbVersionManifest(*manifest)
+	}
+	return rep, nil
+}
+
+func (s *modelRegistryExtensionsServer) SetVersionAlias(ctx context.Context, req *extensionsapi.SetVersionAliasRequest) (*extensionsapi.SetVersionAliasReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "alias": req.Alias, "version_number": req.VersionNumber}).Info("SetVersionAlias")
+
+	if err := validateVersionAlias(req.Alias); err != nil {
+		return nil, err
+	}
+	if reservedVersionAliases[req.Alias] {
+		return nil, status.Errorf(codes.InvalidArgument, "alias %q is reserved", req.Alias)
+	}
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := s.server.modelUserDataLocks.Lock(req.ModelId)
+	defer unlock()
+
+	modelInfo, err := b.RetrieveModelInfo(req.ModelId)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return nil, errorStatus(codes.NotFound, err)
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error while setting alias %q for model %q: %s", req.Alias, req.ModelId, err)
+	}
+
+	userData := make(map[string]string, len(modelInfo.UserData)+1)
+	for key, value := range modelInfo.UserData {
+		userData[key] = value
+	}
+	reply := &extensionsapi.SetVersionAliasReply{}
+	if req.VersionNumber == 0 {
+		delete(userData, VersionAliasUserDataKeyPrefix+req.Alias)
+	} else {
+		// Resolving the n-th to last version now, the alias keeps pointing at it when new versions are created
+		versionInfo, err := b.RetrieveModelVersionInfo(req.ModelId, int(req.VersionNumber))
+		if err != nil {
+			if errors.Is(err, backend.ErrNotFound) {
+				return nil, errorStatus(codes.NotFound, err)
+			}
+			return nil, status.Errorf(codes.Internal, `unexpected error while setting alias %q for version "%d" of model %q: %s`, req.Alias, req.VersionNumber, req.ModelId, err)
+		}
+		userData[VersionAliasUserDataKeyPrefix+req.Alias] = strconv.FormatUint(uint64(versionInfo.VersionNumber), 10)
+		pbVersionInfo := createPbModelVersionInfo(versionInfo)
+		reply.VersionInfo = &pbVersionInfo
+	}
+
+	updatedModelInfo, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: req.ModelId, UserData: userData})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error while setting alias %q for model %q: %s", req.Alias, req.ModelId, err)
+	}
+	s.server.publishModelEvent(modelUpdated, updatedModelInfo)
+
+	return reply, nil
+}
+
+func (s *modelRegistryExtensionsServer) TransitionVersionStage(ctx context.Context, req *extensionsapi.TransitionVersionStageRequest) (*extensionsapi.TransitionVersionStageReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber, "stage": req.Stage}).Info("TransitionVersionStage")
+
+	if _, ok := versionStageNames[req.Stage]; !ok || req.Stage == extensionsapi.VersionStage_NO_STAGE {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid stage %q, versions can only be transitioned to staging, production or retired", req.Stage)
+	}
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := s.server.modelUserDataLocks.Lock(req.ModelId)
+	defer unlock()
+
+	modelInfo, versionInfo, history, retiredVersionNumbers, err := transitionVersionStage(b, req.ModelId, int(req.VersionNumber), req.Stage, req.Comment, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	s.server.publishModelEvent(modelUpdated, modelInfo)
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	pbRetiredVersionNumbers := []uint32{}
+	for _, retiredVersionNumber := range retiredVersionNumbers {
+		pbRetiredVersionNumbers = append(pbRetiredVersionNumbers, uint32(retiredVersionNumber))
+	}
+	return &extensionsapi.TransitionVersionStageReply{
+		VersionInfo:           &pbVersionInfo,
+		History:               createPbVersionStageHistory(history),
+		RetiredVersionNumbers: pbRetiredVersionNumbers,
+	}, nil
+}
+
+func (s *modelRegistryExtensionsServer) RetrieveVersionStage(ctx context.Context, req *extensionsapi.RetrieveVersionStageRequest) (*extensionsapi.RetrieveVersionStageReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber}).Info("RetrieveVersionStage")
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versionInfo, err := b.RetrieveModelVersionInfo(req.ModelId, int(req.VersionNumber))
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return nil, errorStatus(codes.NotFound, err)
+		}
+		return nil, status.Errorf(codes.Internal, `unexpected error while retrieving version "%d" for model %q: %s`, req.VersionNumber, req.ModelId, err)
+	}
+	modelInfo, err := b.RetrieveModelInfo(req.ModelId)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return nil, errorStatus(codes.NotFound, err)
+		}
+		return nil, status.Errorf(codes.Internal, `unexpected error while retrieving version "%d" for model %q: %s`, req.VersionNumber, req.ModelId, err)
+	}
+	history, err := retrieveVersionStageHistory(modelInfo.UserData, versionInfo.VersionNumber)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error while retrieving a version of model %q: %s", req.ModelId, err)
+	}
+
+	pbVersionInfo := createPbModelVersionInfo(versionInfo)
+	return &extensionsapi.RetrieveVersionStageReply{
+		VersionInfo: &pbVersionInfo,
+		Stage:       history.stage(),
+		History:     createPbVersionStageHistory(history),
+	}, nil
+}
+
+// Number of models or versions listed at once while computing the storage info
+const storageInfoPageSize = 100
+
+func retrieveModelStorageInfo(b backend.Backend, modelID string) (*extensionsapi.ModelStorageInfo, error) {
+	modelStorageInfo := &extensionsapi.ModelStorageInfo{ModelId: modelID}
+	for initialVersionNumber := uint(0); ; {
+		versionInfos, err := b.ListModelVersionInfos(modelID, initialVersionNumber, storageInfoPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, versionInfo := range versionInfos {
+			modelStorageInfo.DataSize += uint64(versionInfo.DataSize)
+			modelStorageInfo.VersionsCount++
+			if versionInfo.Archived {
+				modelStorageInfo.ArchivedVersionsCount++
+			}
+			initialVersionNumber = versionInfo.VersionNumber + 1
+		}
+		if len(versionInfos) < storageInfoPageSize {
+			return modelStorageInfo, nil
+		}
+	}
+}
+
+func (s *modelRegistryExtensionsServer) RetrieveStorageInfo(ctx context.Context, req *extensionsapi.RetrieveStorageInfoRequest) (*extensionsapi.RetrieveStorageInfoReply, error) {
+	logging.FromContext(ctx).WithField("namespace", req.Namespace).Info("RetrieveStorageInfo")
+
+	listModels := func(b backend.Backend, offset int, limit int) ([]backend.ModelInfo, error) {
+		return b.ListModels(offset, limit)
+	}
+	if req.Namespace != "" {
+		if err := namespaces.ValidateName(req.Namespace); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+		}
+		filter := namespaces.ModelFilter(req.Namespace)
+		listModels = func(b backend.Backend, offset int, limit int) ([]backend.ModelInfo, error) {
+			return b.QueryModels(filter, offset, limit)
+		}
+	}
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &extensionsapi.RetrieveStorageInfoReply{}
+	for modelOffset := 0; ; modelOffset += storageInfoPageSize {
+		modelInfos, err := listModels(b, modelOffset, storageInfoPageSize)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unexpected error while listing models: %s", err)
+		}
+		for _, modelInfo := range modelInfos {
+			modelStorageInfo, err := retrieveModelStorageInfo(b, modelInfo.ModelID)
+			if err != nil {
+				if errors.As(err, new(*backend.UnknownModelError)) {
+					// Deleted in between
+					continue
+				}
+				return nil, status.Errorf(codes.Internal, "unexpected error while listing versions for model %q: %s", modelInfo.ModelID, err)
+			}
+			rep.DataSize += modelStorageInfo.DataSize
+			rep.ModelsCount++
+			rep.VersionsCount += modelStorageInfo.VersionsCount
+			rep.ModelStorageInfos = append(rep.ModelStorageInfos, modelStorageInfo)
+		}
+		if len(modelInfos) < storageInfoPageSize {
+			break
+		}
+	}
+
+	capacity, err := b.RetrieveStorageCapacity()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error while retrieving the storage capacity: %s", err)
+	}
+	rep.Capacity = &extensionsapi.StorageCapacity{
+		TotalBytes:     capacity.TotalBytes,
+		AvailableBytes: capacity.AvailableBytes,
+	}
+	if req.Namespace != "" && s.server.namespaces != nil {
+		quota := s.server.namespaces.Quota(req.Namespace)
+		rep.Quota = &extensionsapi.NamespaceQuota{
+			MaxModels:   uint32(quota.MaxModels),
+			MaxVersions: uint32(quota.MaxVersions),
+			MaxDataSize: uint64(quota.MaxDataSize),
+		}
+	}
+
+	return rep, nil
+}
+
+func (s *modelRegistryExtensionsServer) RunGarbageCollection(ctx context.Context, req *extensionsapi.RunGarbageCollectionRequest) (*extensionsapi.RunGarbageCollectionReply, error) {
+	logging.FromContext(ctx).WithField("dry_run", req.DryRun).Info("RunGarbageCollection")
+
+	collector := s.server.getRetentionCollector()
+	if collector == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "unable to run a garbage collection, the retention isn't available")
+	}
+
+	report, err := collector.CollectReport(time.Now(), req.DryRun)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error while running a garbage collection: %s", err)
+	}
+
+	rep := &extensionsapi.RunGarbageCollectionReply{
+		DryRun:            report.DryRun,
+		CollectedVersions: make([]*extensionsapi.CollectedVersion, 0, len(report.CollectedVersions)),
+		ReclaimedBytes:    uint64(report.ReclaimedBytes),
+	}
+	for _, collectedVersion := range report.CollectedVersions {
+		rep.CollectedVersions = append(rep.CollectedVersions, &extensionsapi.CollectedVersion{
+			ModelId:       collectedVersion.ModelID,
+			VersionNumber: uint32(collectedVersion.VersionNumber),
+			DataSize:      uint64(collectedVersion.DataSize),
+		})
+	}
+	return rep, nil
+}
+
+func (s *modelRegistryExtensionsServer) RunFsck(ctx context.Context, req *extensionsapi.RunFsckRequest) (*extensionsapi.RunFsckReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"repair": req.Repair, "model_ids": req.ModelIds}).Info("RunFsck")
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := fsck.Check(b, req.ModelIds, req.Repair)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return nil, errorStatus(codes.NotFound, err)
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error while checking the versions numbering: %s", err)
+	}
+
+	rep := &extensionsapi.RunFsckReply{
+		CheckedModels:   uint32(report.CheckedModels),
+		CheckedVersions: uint32(report.CheckedVersions),
+		Problems:        make([]*extensionsapi.FsckProblem, 0, len(report.Problems)),
+	}
+	for _, problem := range report.Problems {
+		rep.Problems = append(rep.Problems, &extensionsapi.FsckProblem{
+			Kind:          string(problem.Kind),
+			ModelId:       problem.ModelID,
+			VersionNumber: uint32(problem.VersionNumber),
+			Description:   problem.Description,
+			Repaired:      problem.Repaired,
+		})
+		if problem.Repaired && problem.Kind != fsck.DuplicateVersionNumber {
+			// The repaired version was rewritten
+			if versionInfo, err := b.RetrieveModelVersionInfo(problem.ModelID, int(problem.VersionNumber)); err == nil {
+				s.server.publishVersionEvent(versionUpdated, versionInfo)
+			}
+		}
+	}
+	logging.FromContext(ctx).WithFields(logrus.Fields{"checked_models": report.CheckedModels, "problems": len(report.Problems)}).Info("RunFsck completed")
+	return rep, nil
+}
+
+func (s *modelRegistryExtensionsServer) WatchVersions(req *extensionsapi.WatchVersionsRequest, outStream extensionsapi.ModelRegistryExtensionsSP_WatchVersionsServer) error {
+	logging.FromContext(outStream.Context()).WithField("model_id", req.ModelId).Info("WatchVersions")
+
+	b, err := s.server.backendPromise.Await(outStream.Context())
+	if err != nil {
+		return err
+	}
+
+	// Subscribing before checking the model existence makes sure no version created in between is missed
+	subscription := s.server.versionBroadcaster.subscribe(req.ModelId)
+	defer s.server.versionBroadcaster.unsubscribe(req.ModelId, subscription)
+
+	hasModel, err := b.HasModel(req.ModelId)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unexpected error while watching the versions of model %q: %s", req.ModelId, err)
+	}
+	if !hasModel {
+		return errorStatus(codes.NotFound, &backend.UnknownModelError{ModelID: req.ModelId})
+	}
+
+	// Sending the headers right away lets the clients know the watch is active
+	err = outStream.SendHeader(metadata.MD{})
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case versionInfo, ok := <-subscription.versions:
+			if !ok {
+				if subscription.overflowed {
+					return status.Errorf(codes.ResourceExhausted, "too many versions of model %q created while the watcher was busy, watch again to resume", req.ModelId)
+				}
+				// The model was deleted
+				return nil
+			}
+			pbVersionInfo := createPbModelVersionInfo(versionInfo)
+			err := outStream.Send(&extensionsapi.WatchVersionsReply{VersionInfo: &pbVersionInfo})
+			if err != nil {
+				return err
+			}
+		case <-outStream.Context().Done():
+			return status.Errorf(codes.Canceled, "versions watch canceled")
+		case <-s.server.shutdown:
+			return status.Errorf(codes.Unavailable, "the server is shutting down, watch again to resume")
+		}
+	}
+}
+
+func createPbModelEventType(eventType modelEventType) extensionsapi.ModelEventType {
+	switch eventType {
+	case modelCreated:
+		return extensionsapi.ModelEventType_MODEL_CREATED
+	case modelUpdated:
+		return extensionsapi.ModelEventType_MODEL_UPDATED
+	case modelDeleted:
+		return extensionsapi.ModelEventType_MODEL_DELETED
+	default:
+		return extensionsapi.ModelEventType_UNKNOWN_MODEL_EVENT
+	}
+}
+
+func (s *modelRegistryExtensionsServer) WatchModels(req *extensionsapi.WatchModelsRequest, outStream extensionsapi.ModelRegistryExtensionsSP_WatchModelsServer) error {
+	logging.FromContext(outStream.Context()).WithFields(logrus.Fields{"model_id_prefix": req.ModelIdPrefix, "user_data_keys": req.UserDataKeys}).Info("WatchModels")
+
+	subscription := s.server.modelBroadcaster.subscribe(modelFilter{
+		modelIDPrefix: req.ModelIdPrefix,
+		userDataKeys:  req.UserDataKeys,
+	})
+	defer s.server.modelBroadcaster.unsubscribe(subscription)
+
+	// Sending the headers right away lets the clients know the watch is active
+	err := outStream.SendHeader(metadata.MD{})
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event, ok := <-subscription.events:
+			if !ok {
+				if subscription.overflowed {
+					return status.Errorf(codes.ResourceExhausted, "too many models changed while the watcher was busy, watch again to resume")
+				}
+				return nil
+			}
+			err := outStream.Send(&extensionsapi.WatchModelsReply{
+				EventType: createPbModelEventType(event.eventType),
+				ModelInfo: &grpcapi.ModelInfo{ModelId: event.modelInfo.ModelID, UserData: event.modelInfo.UserData},
+			})
+			if err != nil {
+				return err
+			}
+		case <-outStream.Context().Done():
+			return status.Errorf(codes.Canceled, "models watch canceled")
+		case <-s.server.shutdown:
+			return status.Errorf(codes.Unavailable, "the server is shutting down, watch again to resume")
+		}
+	}
+}
+
+func createPbVersionEventType(eventType versionEventType) extensionsapi.VersionEventType {
+	switch eventType {
+	case versionCreated:
+		return extensionsapi.VersionEventType_VERSION_CREATED
+	case versionUpdated:
+		return extensionsapi.VersionEventType_VERSION_UPDATED
+	case versionDeleted:
+		return extensionsapi.VersionEventType_VERSION_DELETED
+	default:
+		return extensionsapi.VersionEventType_UNKNOWN_VERSION_EVENT
+	}
+}
+
+func createPbRegistryEvent(event registryEvent) *extensionsapi.WatchRegistryReply {
+	if event.modelEvent != nil {
+		return &extensionsapi.WatchRegistryReply{Event: &extensionsapi.WatchRegistryReply_ModelEvent_{ModelEvent: &extensionsapi.WatchRegistryReply_ModelEvent{
+			EventType: createPbModelEventType(event.modelEvent.eventType),
+			ModelInfo: &grpcapi.ModelInfo{ModelId: event.modelEvent.modelInfo.ModelID, UserData: event.modelEvent.modelInfo.UserData},
+		}}}
+	}
+	pbVersionInfo := createPbModelVersionInfo(event.versionEvent.versionInfo)
+	return &extensionsapi.WatchRegistryReply{Event: &extensionsapi.WatchRegistryReply_VersionEvent_{VersionEvent: &extensionsapi.WatchRegistryReply_VersionEvent{
+		EventType:   createPbVersionEventType(event.versionEvent.eventType),
+		VersionInfo: &pbVersionInfo,
+	}}}
+}
+
+func (s *modelRegistryExtensionsServer) WatchRegistry(req *extensionsapi.WatchRegistryRequest, outStream extensionsapi.ModelRegistryExtensionsSP_WatchRegistryServer) error {
+	logging.FromContext(outStream.Context()).Info("WatchRegistry")
+
+	subscription := s.server.registryBroadcaster.subscribe()
+	defer s.server.registryBroadcaster.unsubscribe(subscription)
+
+	// Sending the headers right away lets the clients know the watch is active
+	err := outStream.SendHeader(metadata.MD{})
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event, ok := <-subscription.events:
+			if !ok {
+				if subscription.overflowed {
+					return status.Errorf(codes.ResourceExhausted, "too many changes made while the watcher was busy, watch again to resume")
+				}
+				return nil
+			}
+			err := outStream.Send(createPbRegistryEvent(event))
+			if err != nil {
+				return err
+			}
+		case <-outStream.Context().Done():
+			return status.Errorf(codes.Canceled, "registry watch canceled")
+		case <-s.server.shutdown:
+			return status.Errorf(codes.Unavailable, "the server is shutting down, watch again to resume")
+		}
+	}
+}
+
+// exportStreamWriter sends the data written to it as ExportRegistry reply chunks of at most chunkSize bytes
+type exportStreamWriter struct {
+	outStream extensionsapi.ModelRegistryExtensionsSP_ExportRegistryServer
+	chunkSize int
+}
+
+func (w *exportStreamWriter) Write(data []byte) (int, error) {
+	writtenSize := 0
+	for writtenSize < len(data) {
+		chunkSize := len(data) - writtenSize
+		if chunkSize > w.chunkSize {
+			chunkSize = w.chunkSize
+		}
+		// The chunk is copied as the sent message might be serialized after Write returns
+		chunk := append([]byte{}, data[writtenSize:writtenSize+chunkSize]...)
+		if err := w.outStream.Send(&extensionsapi.ExportRegistryReplyChunk{DataChunk: chunk}); err != nil {
+			return writtenSize, err
+		}
+		writtenSize += chunkSize
+	}
+	return writtenSize, nil
+}
+
+func (s *modelRegistryExtensionsServer) ExportRegistry(req *extensionsapi.ExportRegistryRequest, outStream extensionsapi.ModelRegistryExtensionsSP_ExportRegistryServer) error {
+	logging.FromContext(outStream.Context()).WithField("model_ids", req.ModelIds).Info("ExportRegistry")
+
+	b, err := s.server.backendPromise.Await(outStream.Context())
+	if err != nil {
+		return err
+	}
+
+	chunkSize := s.server.chunkSize()
+	w := bufio.NewWriterSize(&exportStreamWriter{outStream: outStream, chunkSize: chunkSize}, chunkSize)
+	summary, err := registryArchive.Export(b, w, req.ModelIds)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return errorStatus(codes.NotFound, err)
+		}
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.Internal, "unexpected error while exporting the registry: %s", err)
+	}
+	logging.FromContext(outStream.Context()).WithFields(logrus.Fields{"models_count": len(summary.ModelInfos), "versions_count": len(summary.VersionInfos)}).Info("ExportRegistry completed")
+	return nil
+}
+
+// importStreamReader reads the data received as ImportRegistry request chunks
+type importStreamReader struct {
+	inStream extensionsapi.ModelRegistryExtensionsSP_ImportRegistryServer
+	chunk    []byte
+}
+
+func (r *importStreamReader) Read(data []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		chunk, err := r.inStream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.chunk = chunk.DataChunk
+	}
+	readSize := copy(data, r.chunk)
+	r.chunk = r.chunk[readSize:]
+	return readSize, nil
+}
+
+func (s *modelRegistryExtensionsServer) ImportRegistry(inStream extensionsapi.ModelRegistryExtensionsSP_ImportRegistryServer) error {
+	logging.FromContext(inStream.Context()).Info("ImportRegistry")
+
+	b, err := s.server.backendPromise.Await(inStream.Context())
+	if err != nil {
+		return err
+	}
+
+	summary, err := registryArchive.Import(b, &importStreamReader{inStream: inStream}, func(modelID string, versionArgs backend.VersionArgs) error {
+		if err := rejectReservedVersionUserData(versionArgs.UserData, true); err != nil {
+			return err
+		}
+		return s.server.verifySignature(&grpcapi.ModelVersionInfo{ModelId: modelID, DataHash: versionArgs.DataHash, UserData: versionArgs.UserData})
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		switch {
+		case errors.As(err, new(*registryArchive.InvalidArchiveError)), errors.As(err, new(*backend.DataHashMismatchError)):
+			return errorStatus(codes.InvalidArgument, err)
+		case errors.As(err, new(*registryArchive.ExistingModelError)):
+			return status.Errorf(codes.AlreadyExists, "%s", err)
+		}
+		return status.Errorf(codes.Internal, "unexpected error while importing the registry: %s", err)
+	}
+
+	for _, modelInfo := range summary.ModelInfos {
+		s.server.publishModelEvent(modelCreated, modelInfo)
+	}
+	for _, versionInfo := range summary.VersionInfos {
+		s.server.publishVersionEvent(versionCreated, versionInfo)
+	}
+
+	return inStream.SendAndClose(&extensionsapi.ImportRegistryReply{
+		ModelsCount:   uint32(len(summary.ModelInfos)),
+		VersionsCount: uint32(len(summary.VersionInfos)),
+	})
+}
+
+// snapshotFilename returns the path of a snapshot file in the snapshot directory, its name can't be a path
+func (s *modelRegistryExtensionsServer) snapshotFilename(name string) (string, error) {
+	if s.server.snapshotDir == "" {
+		return "", status.Errorf(codes.FailedPrecondition, "no snapshot directory is defined")
+	}
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return "", status.Errorf(codes.InvalidArgument, "invalid snapshot name %q, expecting a file name", name)
+	}
+	return filepath.Join(s.server.snapshotDir, name), nil
+}
+
+func (s *modelRegistryExtensionsServer) SaveSnapshot(ctx context.Context, req *extensionsapi.SaveSnapshotRequest) (*extensionsapi.SaveSnapshotReply, error) {
+	logging.FromContext(ctx).WithField("name", req.Name).Info("SaveSnapshot")
+
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("snapshot-%s.tar", time.Now().UTC().Format("20060102T150405.000000000Z"))
+	}
+	filename, err := s.snapshotFilename(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(s.server.snapshotDir, 0755); err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to create the snapshot directory: %s", err)
+	}
+	// The snapshot is written to a temporary file then linked to its name, an existing snapshot is never overwritten
+	file, err := os.CreateTemp(s.server.snapshotDir, ".snapshot-*.tmp")
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to create the snapshot file: %s", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	summary, err := registryArchive.Export(b, w, nil)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error while saving snapshot %q: %s", name, err)
+	}
+	if err := os.Link(file.Name(), filename); err != nil {
+		if os.IsExist(err) {
+			return nil, status.Errorf(codes.AlreadyExists, "snapshot %q already exists", name)
+		}
+		return nil, status.Errorf(codes.Internal, "unexpected error while saving snapshot %q: %s", name, err)
+	}
+
+	logging.FromContext(ctx).WithFields(logrus.Fields{"name": name, "models_count": len(summary.ModelInfos), "versions_count": len(summary.VersionInfos)}).Info("SaveSnapshot completed")
+	return &extensionsapi.SaveSnapshotReply{
+		Name:          name,
+		ModelsCount:   uint32(len(summary.ModelInfos)),
+		VersionsCount: uint32(len(summary.VersionInfos)),
+	}, nil
+}
+
+// deleteModels deletes every model of the backend and notifies the watchers
+//
+// The models are checked like DeleteModel does before deleting any of them, a locked or leased version, or a version
+// of a model created meanwhile depending on them, rejects the whole deletion with a status error.
+func (s *modelRegistryExtensionsServer) deleteModels(b backend.Backend) (int, error) {
+	modelInfos := []backend.ModelInfo{}
+	for offset := 0; ; offset += storageInfoPageSize {
+		pageModelInfos, err := b.ListModels(offset, storageInfoPageSize)
+		if err != nil {
+			return 0, status.Errorf(codes.Internal, "unexpected error while listing the models: %s", err)
+		}
+		modelInfos = append(modelInfos, pageModelInfos...)
+		if len(pageModelInfos) < storageInfoPageSize {
+			break
+		}
+	}
+
+	deletedModelIDs := make(map[string]bool, len(modelInfos))
+	modelIDs := make([]string, 0, len(modelInfos))
+	for _, modelInfo := range modelInfos {
+		if err := s.server.checkModelDeletion(b, modelInfo.ModelID); err != nil {
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+			return 0, err
+		}
+		deletedModelIDs[modelInfo.ModelID] = true
+		modelIDs = append(modelIDs, modelInfo.ModelID)
+	}
+	unlockDependencies := s.server.lockDependencyModels(modelIDs)
+	defer unlockDependencies()
+	for _, modelID := range modelIDs {
+		dependents, err := retrieveModelDependents(b, modelID)
+		if err != nil {
+			return 0, status.Errorf(codes.Internal, "unexpected error while retrieving the dependents of model %q: %s", modelID, err)
+		}
+		for _, dependent := range dependents {
+			if !deletedModelIDs[dependent.ModelID] {
+				versionNumber := dependedUponVersionNumber(dependent, modelID)
+				return 0, versionDependedUponStatus(modelID, versionNumber, []backend.VersionInfo{dependent}, `unable to delete model %q, versions %s of other models depend on it`, modelID, versionReferences([]backend.VersionInfo{dependent}))
+			}
+		}
+	}
+
+	deletedModelsCount := 0
+	for _, modelInfo := range modelInfos {
+		if !deletedModelIDs[modelInfo.ModelID] {
+			continue
+		}
+		err := b.DeleteModel(modelInfo.ModelID)
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				continue
+			}
+			return deletedModelsCount, status.Errorf(codes.Internal, "unexpected error while deleting model %q: %s", modelInfo.ModelID, err)
+		}
+		deletedModelsCount++
+		s.server.publishModelEvent(modelDeleted, modelInfo)
+	}
+	return deletedModelsCount, nil
+}
+
+// snapshotError converts an error met while verifying or loading a snapshot to a status error
+func snapshotError(name string, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.As(err, new(*registryArchive.InvalidArchiveError)), errors.As(err, new(*backend.DataHashMismatchError)):
+		return status.Errorf(codes.InvalidArgument, "invalid snapshot %q: %s", name, err)
+	case errors.As(err, new(*registryArchive.ExistingModelError)):
+		return status.Errorf(codes.AlreadyExists, "%s", err)
+	}
+	return status.Errorf(codes.Internal, "unexpected error while loading snapshot %q: %s", name, err)
+}
+
+func (s *modelRegistryExtensionsServer) LoadSnapshot(ctx context.Context, req *extensionsapi.LoadSnapshotRequest) (*extensionsapi.LoadSnapshotReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"name": req.Name, "overwrite": req.Overwrite}).Info("LoadSnapshot")
+
+	filename, err := s.snapshotFilename(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := s.server.backendPromise.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, status.Errorf(codes.NotFound, "unknown snapshot %q", req.Name)
+		}
+		return nil, status.Errorf(codes.Internal, "unable to open snapshot %q: %s", req.Name, err)
+	}
+	defer file.Close()
+
+	validate := func(modelID string, versionArgs backend.VersionArgs) error {
+		return s.server.verifySignature(&grpcapi.ModelVersionInfo{ModelId: modelID, DataHash: versionArgs.DataHash, UserData: versionArgs.UserData})
+	}
+
+	// The whole snapshot is verified before deleting anything, an invalid snapshot leaves the registry untouched
+	deletedModelsCount := 0
+	if req.Overwrite {
+		if _, err := registryArchive.Verify(bufio.NewReader(file), validate); err != nil {
+			return nil, snapshotError(req.Name, err)
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, status.Errorf(codes.Internal, "unable to read snapshot %q: %s", req.Name, err)
+		}
+		deletedModelsCount, err = s.deleteModels(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	summary, err := registryArchive.Import(b, bufio.NewReader(file), validate)
+	if err != nil {
+		return nil, snapshotError(req.Name, err)
+	}
+
+	for _, modelInfo := range summary.ModelInfos {
+		s.server.publishModelEvent(modelCreated, modelInfo)
+	}
+	for _, versionInfo := range summary.VersionInfos {
+		s.server.publishVersionEvent(versionCreated, versionInfo)
+	}
+
+	return &extensionsapi.LoadSnapshotReply{
+		ModelsCount:        uint32(len(summary.ModelInfos)),
+		VersionsCount:      uint32(len(summary.VersionInfos)),
+		DeletedModelsCount: uint32(deletedModelsCount),
+	}, nil
+}
+
+func createPbMaintenanceReply(state maintenance.State) *extensionsapi.SetMaintenanceReply {
+	rep := &extensionsapi.SetMaintenanceReply{Enabled: state.Active, Reason: state.Reason, QueuedRequests: uint32(state.QueuedRequests)}
+	if state.Active {
+		rep.Since = uint64(state.Since.UnixNano())
+	}
+	return rep
+}
+
+func (s *modelRegistryExtensionsServer) SetMaintenance(ctx context.Context, req *extensionsapi.SetMaintenanceRequest) (*extensionsapi.SetMaintenanceReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"enabled": req.Enabled, "reason": req.Reason}).Info("SetMaintenance")
+
+	if s.server.maintenance == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "the maintenance mode isn't available")
+	}
+	if !req.Enabled {
+		s.server.maintenance.End()
+		logging.FromContext(ctx).Info("Maintenance ended")
+		return createPbMaintenanceReply(s.server.maintenance.State()), nil
+	}
+	err := s.server.maintenance.Begin(ctx, req.Reason)
+	if err != nil {
+		if _, ok := err.(*maintenance.AlreadyInMaintenanceError); !ok {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	} else {
+		logging.FromContext(ctx).WithField("reason", req.Reason).Info("Maintenance started, the mutations are queued until it ends")
+	}
+	return createPbMaintenanceReply(s.server.maintenance.State()), nil
+}
@@ -16,15 +16,32 @@ package grpcservers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
-	"log"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/circuitBreaker"
+	"github.com/cogment/cogment-model-registry/backend/coldStorage"
 	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+	"github.com/cogment/cogment-model-registry/logging"
+	"github.com/cogment/cogment-model-registry/maintenance"
+	"github.com/cogment/cogment-model-registry/modelIDs"
+	"github.com/cogment/cogment-model-registry/namespaces"
+	"github.com/cogment/cogment-model-registry/pagination"
+	"github.com/cogment/cogment-model-registry/retention"
+	"github.com/cogment/cogment-model-registry/signature"
+	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	// Registers the gzip compressor, clients can compress requests and receive compressed replies using the "gzip" grpc encoding
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -38,8 +55,76 @@ func nsTimestampFromTime(timestamp time.Time) uint64 {
 
 type ModelRegistryServer struct {
 	grpcapi.UnimplementedModelRegistrySPServer
-	backendPromise                BackendPromise
-	sentModelVersionDataChunkSize int
+	backendPromise                   BackendPromise
+	sentModelVersionDataChunkSize    int64 // Accessed atomically, see SetSentModelVersionDataChunkSize
+	minSentModelVersionDataChunkSize int
+	maxSentModelVersionDataChunkSize int
+	versionBroadcaster               *versionBroadcaster
+	modelBroadcaster                 *modelBroadcaster
+	registryBroadcaster              *registryBroadcaster
+	paginationCodec                  *pagination.Codec
+	uploadSessions                   *uploadSessions
+	versionLeases                    *versionLeases
+	hashAlgorithm                    backend.HashAlgorithm
+	verifyDataHash                   bool
+	signatureVerifier                *signature.Verifier
+	namespaces                       *namespaces.Configuration
+	modelIDRules                     *modelIDs.Rules
+	maxVersionDataSize               uint64
+	sentVersionDataBufferedChunks    int
+	presignedURLExpiration           time.Duration
+	snapshotDir                      string
+	maintenance                      *maintenance.Gate
+	authorizeModel                   func(ctx context.Context, modelID string) error
+	// modelUserDataLocks serialize the updates of the user data of each model, aliases and stages are read then written back
+	modelUserDataLocks backend.ModelLocks
+	// versionInfoLocks serialize the updates of the versions info of each model, they are read, checked against their etag
+	// then written back
+	versionInfoLocks backend.ModelLocks
+	// dependencyLocks serialize the checks of the dependencies of the created versions with the deletion of the versions
+	// they depend on
+	dependencyLocks backend.ModelLocks
+	// versionCreationListeners are notified of the created versions
+	versionCreationListeners      []VersionCreationListener
+	versionCreationListenersMutex sync.Mutex
+	// eventListeners are notified of every change made to the models and versions
+	eventListeners      []EventListener
+	eventListenersMutex sync.Mutex
+	// coldStorageBackend restores the versions moved to the cold storage backend, nil without cold storage
+	coldStorageBackend      coldStorage.Backend
+	coldStorageBackendMutex sync.Mutex
+	// retentionCollector runs the garbage collections requested by RunGarbageCollection, nil without retention
+	retentionCollector      *retention.Collector
+	retentionCollectorMutex sync.Mutex
+	// shutdown is closed when the server shuts down, ending the watches
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+// Metadata key letting clients request the verification of the data retrieved by RetrieveVersionData
+const verifyDataHashMetadataKey = "cogment-model-registry-verify-data-hash"
+
+// Metadata key letting clients choose the size of the data chunks sent by RetrieveVersionData
+const preferredChunkSizeMetadataKey = "cogment-model-registry-preferred-chunk-size"
+
+// Metadata key letting clients provide the hash of the data they already have, RetrieveVersionData doesn't send it
+// again if unchanged
+const knownDataHashMetadataKey = "cogment-model-registry-known-data-hash"
+
+// Header metadata key set by RetrieveVersionData when the data matches the known hash and isn't sent
+const notModifiedMetadataKey = "cogment-model-registry-not-modified"
+
+const (
+	modelsPaginationScope   = "models"
+	modelIDsPaginationScope = "model_ids"
+)
+
+func versionsPaginationScope(modelID string) string {
+	return "versions/" + modelID
+}
+
+func versionNumbersPaginationScope(modelID string) string {
+	return "version_numbers/" + modelID
 }
 
 func createPbModelVersionInfo(modelVersionInfo backend.VersionInfo) grpcapi.ModelVersionInfo {
@@ -58,57 +143,375 @@ func (s *ModelRegistryServer) SetBackend(b backend.Backend) {
 	s.backendPromise.Set(b)
 }
 
+// SetCircuitBreaker makes the calls fail fast with `UNAVAILABLE`, and a `retry-after` trailer, while the circuit of the
+// breaker of the backend is open
+func (s *ModelRegistryServer) SetCircuitBreaker(breaker *circuitBreaker.Breaker) {
+	s.backendPromise.SetCircuitBreaker(breaker)
+}
+
+// SetColdStorageBackend enables RestoreVersion, the backend being the one of the stack moving versions to the cold
+// storage backend, nil disables it
+func (s *ModelRegistryServer) SetColdStorageBackend(b coldStorage.Backend) {
+	s.coldStorageBackendMutex.Lock()
+	defer s.coldStorageBackendMutex.Unlock()
+	s.coldStorageBackend = b
+}
+
+func (s *ModelRegistryServer) getColdStorageBackend() coldStorage.Backend {
+	s.coldStorageBackendMutex.Lock()
+	defer s.coldStorageBackendMutex.Unlock()
+	return s.coldStorageBackend
+}
+
+// SetRetentionCollector enables RunGarbageCollection, nil disables it
+func (s *ModelRegistryServer) SetRetentionCollector(collector *retention.Collector) {
+	s.retentionCollectorMutex.Lock()
+	defer s.retentionCollectorMutex.Unlock()
+	s.retentionCollector = collector
+}
+
+func (s *ModelRegistryServer) getRetentionCollector() *retention.Collector {
+	s.retentionCollectorMutex.Lock()
+	defer s.retentionCollectorMutex.Unlock()
+	return s.retentionCollector
+}
+
+// Shutdown ends the ongoing watches and the ones started afterward, they would otherwise prevent a graceful stop of
+// the gRPC server from completing
+func (s *ModelRegistryServer) Shutdown() {
+	s.shutdownOnce.Do(func() {
+		close(s.shutdown)
+	})
+}
+
+// SetSentModelVersionDataChunkSize changes the maximum size of the data chunks sent by the calls started afterward
+func (s *ModelRegistryServer) SetSentModelVersionDataChunkSize(chunkSize int) {
+	atomic.StoreInt64(&s.sentModelVersionDataChunkSize, int64(chunkSize))
+}
+
+func (s *ModelRegistryServer) chunkSize() int {
+	return int(atomic.LoadInt64(&s.sentModelVersionDataChunkSize))
+}
+
+// negotiateChunkSize clamps the chunk size preferred by a client to the limits of the server, 0 means no preference
+func (s *ModelRegistryServer) negotiateChunkSize(preferredChunkSize int) int {
+	if preferredChunkSize <= 0 {
+		return s.chunkSize()
+	}
+	if preferredChunkSize < s.minSentModelVersionDataChunkSize {
+		return s.minSentModelVersionDataChunkSize
+	}
+	if s.maxSentModelVersionDataChunkSize > 0 && preferredChunkSize > s.maxSentModelVersionDataChunkSize {
+		return s.maxSentModelVersionDataChunkSize
+	}
+	return preferredChunkSize
+}
+
+// EventListener is notified of the changes made to the models and versions through the server, or published by a
+// replication follower, e.g. to call webhooks
+type EventListener interface {
+	ModelEvent(eventType extensionsapi.ModelEventType, modelInfo backend.ModelInfo)
+	VersionEvent(eventType extensionsapi.VersionEventType, versionInfo backend.VersionInfo)
+}
+
+// AddEventListener notifies a listener of the changes made afterward, it must not block
+func (s *ModelRegistryServer) AddEventListener(listener EventListener) {
+	s.eventListenersMutex.Lock()
+	defer s.eventListenersMutex.Unlock()
+	s.eventListeners = append(s.eventListeners, listener)
+}
+
+func (s *ModelRegistryServer) getEventListeners() []EventListener {
+	s.eventListenersMutex.Lock()
+	defer s.eventListenersMutex.Unlock()
+	return s.eventListeners
+}
+
+// publishModelEvent notifies the models and registry watchers of a change made to a model, deleting a model ends the
+// watches of its versions
+func (s *ModelRegistryServer) publishModelEvent(eventType modelEventType, modelInfo backend.ModelInfo) {
+	if eventType == modelDeleted {
+		s.versionBroadcaster.closeModel(modelInfo.ModelID)
+	}
+	s.modelBroadcaster.publish(eventType, modelInfo)
+	s.registryBroadcaster.publish(registryEvent{modelEvent: &modelEvent{eventType: eventType, modelInfo: modelInfo}})
+	for _, listener := range s.getEventListeners() {
+		listener.ModelEvent(createPbModelEventType(eventType), modelInfo)
+	}
+}
+
+// VersionCreationListener is notified of the versions created through the server, e.g. to enforce a retention policy
+type VersionCreationListener interface {
+	VersionCreated(versionInfo backend.VersionInfo)
+}
+
+// AddVersionCreationListener notifies a listener of the versions created afterward, it must not block
+func (s *ModelRegistryServer) AddVersionCreationListener(listener VersionCreationListener) {
+	s.versionCreationListenersMutex.Lock()
+	defer s.versionCreationListenersMutex.Unlock()
+	s.versionCreationListeners = append(s.versionCreationListeners, listener)
+}
+
+// publishVersionEvent notifies the versions and registry watchers of a change made to a version
+func (s *ModelRegistryServer) publishVersionEvent(eventType versionEventType, versionInfo backend.VersionInfo) {
+	if eventType == versionCreated {
+		s.versionBroadcaster.publish(versionInfo)
+		s.versionCreationListenersMutex.Lock()
+		listeners := s.versionCreationListeners
+		s.versionCreationListenersMutex.Unlock()
+		for _, listener := range listeners {
+			listener.VersionCreated(versionInfo)
+		}
+	}
+	s.registryBroadcaster.publish(registryEvent{versionEvent: &versionEvent{eventType: eventType, versionInfo: versionInfo}})
+	for _, listener := range s.getEventListeners() {
+		listener.VersionEvent(createPbVersionEventType(eventType), versionInfo)
+	}
+}
+
+// PublishModelEvent notifies the watchers of a change made to a model without going through the server, e.g. by a
+// replication follower
+func (s *ModelRegistryServer) PublishModelEvent(eventType extensionsapi.ModelEventType, modelInfo backend.ModelInfo) {
+	switch eventType {
+	case extensionsapi.ModelEventType_MODEL_CREATED:
+		s.publishModelEvent(modelCreated, modelInfo)
+	case extensionsapi.ModelEventType_MODEL_UPDATED:
+		s.publishModelEvent(modelUpdated, modelInfo)
+	case extensionsapi.ModelEventType_MODEL_DELETED:
+		s.publishModelEvent(modelDeleted, modelInfo)
+	}
+}
+
+// PublishVersionEvent notifies the watchers of a change made to a version without going through the server, e.g. by a
+// replication follower
+func (s *ModelRegistryServer) PublishVersionEvent(eventType extensionsapi.VersionEventType, versionInfo backend.VersionInfo) {
+	switch eventType {
+	case extensionsapi.VersionEventType_VERSION_CREATED:
+		s.publishVersionEvent(versionCreated, versionInfo)
+	case extensionsapi.VersionEventType_VERSION_UPDATED:
+		s.publishVersionEvent(versionUpdated, versionInfo)
+	case extensionsapi.VersionEventType_VERSION_DELETED:
+		s.publishVersionEvent(versionDeleted, versionInfo)
+	}
+}
+
 func (s *ModelRegistryServer) CreateOrUpdateModel(ctx context.Context, req *grpcapi.CreateOrUpdateModelRequest) (*grpcapi.CreateOrUpdateModelReply, error) {
-	log.Printf("CreateOrUpdateModel(req={ModelId: %q, UserData: %#v})\n", req.ModelInfo.ModelId, req.ModelInfo.UserData)
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_id": req.ModelInfo.ModelId, "user_data": req.ModelInfo.UserData}).Info("CreateOrUpdateModel")
 
-	modelInfo := backend.ModelInfo{
+	err := s.writeModel(ctx, backend.ModelInfo{
 		ModelID:  req.ModelInfo.ModelId,
 		UserData: req.ModelInfo.UserData,
+	}, createOrUpdateModelMode)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcapi.CreateOrUpdateModelReply{}, nil
+}
+
+// modelWriteMode restricts whether writing a model can create a missing one and update an existing one
+type modelWriteMode int
+
+const (
+	createOrUpdateModelMode modelWriteMode = iota
+	createModelMode
+	updateModelMode
+)
+
+// writeModel creates or updates a model as allowed by the mode, it is shared by CreateOrUpdateModel, CreateModel and UpdateModel
+func (s *ModelRegistryServer) writeModel(ctx context.Context, modelInfo backend.ModelInfo, mode modelWriteMode) error {
+	if err := s.validateModelID(modelInfo.ModelID); err != nil {
+		return err
+	}
+	expectedRevision, expectsRevision, err := requestedExpectedModelRevision(ctx)
+	if err != nil {
+		return err
 	}
 
 	b, err := s.backendPromise.Await(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	_, err = b.CreateOrUpdateModel(modelInfo)
+	unlock := s.modelUserDataLocks.Lock(modelInfo.ModelID)
+	defer unlock()
+
+	existed, err := b.HasModel(modelInfo.ModelID)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "unexpected error while creating model %q: %s", modelInfo.ModelID, err)
+		return status.Errorf(codes.Internal, "unexpected error while creating model %q: %s", modelInfo.ModelID, err)
+	}
+	if existed && mode == createModelMode {
+		return status.Errorf(codes.AlreadyExists, "unable to create model %q, it already exists", modelInfo.ModelID)
+	}
+	if !existed && mode == updateModelMode {
+		return reasonStatus(codes.NotFound, extensionsapi.ErrorReason_MODEL_NOT_FOUND, map[string]string{"model_id": modelInfo.ModelID}, "unable to update model %q, it doesn't exist", modelInfo.ModelID)
 	}
 
-	return &grpcapi.CreateOrUpdateModelReply{}, nil
+	if !existed {
+		if err := s.checkModelNamespace(modelInfo.ModelID); err != nil {
+			return err
+		}
+		if err := s.checkNamespaceQuota(b, modelInfo.ModelID, namespaces.Usage{ModelsCount: 1}); err != nil {
+			return err
+		}
+	}
+
+	currentUserData := map[string]string{}
+	if existed {
+		currentModelInfo, err := b.RetrieveModelInfo(modelInfo.ModelID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "unexpected error while updating model %q: %s", modelInfo.ModelID, err)
+		}
+		currentUserData = currentModelInfo.UserData
+	}
+	if expectsRevision {
+		if err := checkExpectedModelRevision(modelInfo.ModelID, currentUserData, expectedRevision); err != nil {
+			return err
+		}
+	}
+	modelInfo.UserData, err = mergeProtectedUserData(modelInfo.ModelID, modelInfo.UserData, currentUserData)
+	if err != nil {
+		return err
+	}
+	// The revision sent back by clients updating a retrieved model is the one they retrieved, it is overwritten
+	if _, ok := currentUserData[ModelRevisionUserDataKey]; ok || expectsRevision {
+		modelInfo.UserData[ModelRevisionUserDataKey] = strconv.FormatUint(modelRevision(currentUserData)+1, 10)
+	} else {
+		delete(modelInfo.UserData, ModelRevisionUserDataKey)
+	}
+
+	createdModelInfo, err := b.CreateOrUpdateModel(modelInfo)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unexpected error while creating model %q: %s", modelInfo.ModelID, err)
+	}
+
+	if existed {
+		s.publishModelEvent(modelUpdated, createdModelInfo)
+	} else {
+		s.publishModelEvent(modelCreated, createdModelInfo)
+	}
+
+	return nil
 }
 
 func (s *ModelRegistryServer) DeleteModel(ctx context.Context, req *grpcapi.DeleteModelRequest) (*grpcapi.DeleteModelReply, error) {
-	log.Printf("DeleteModel(req={ModelId: %q})\n", req.ModelId)
+	logging.FromContext(ctx).WithField("model_id", req.ModelId).Info("DeleteModel")
 
 	b, err := s.backendPromise.Await(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	// Retrieved beforehand to be able to filter the deletion event, the deletion reports a missing model anyway
+	modelInfo, err := b.RetrieveModelInfo(req.ModelId)
+	if err != nil {
+		modelInfo = backend.ModelInfo{ModelID: req.ModelId}
+	}
+
+	if err := s.checkModelDeletion(b, req.ModelId); err != nil {
+		return nil, err
+	}
+	unlockDependencies := s.lockDependencyModels([]string{req.ModelId})
+	defer unlockDependencies()
+	dependents, err := retrieveModelDependents(b, req.ModelId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected error while retrieving the dependents of model %q: %s", req.ModelId, err)
+	}
+	if len(dependents) > 0 {
+		versionNumber := dependedUponVersionNumber(dependents[0], req.ModelId)
+		return nil, versionDependedUponStatus(req.ModelId, versionNumber, dependents, `unable to delete model %q, versions %s of other models depend on it`, req.ModelId, versionReferences(dependents))
+	}
+
 	err = b.DeleteModel(req.ModelId)
 	if err != nil {
-		if _, ok := err.(*backend.UnknownModelError); ok {
-			return nil, status.Errorf(codes.NotFound, "%s", err)
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return nil, errorStatus(codes.NotFound, err)
 		}
 		return nil, status.Errorf(codes.Internal, "unexpected error while deleting model %q: %s", req.ModelId, err)
 	}
 
+	s.publishModelEvent(modelDeleted, modelInfo)
+
 	return &grpcapi.DeleteModelReply{}, nil
 }
 
-func (s *ModelRegistryServer) RetrieveModels(ctx context.Context, req *grpcapi.RetrieveModelsRequest) (*grpcapi.RetrieveModelsReply, error) {
-	log.Printf("RetrieveModels(req={ModelIds: %#v, ModelsCount: %d, ModelHandle: %q})\n", req.ModelIds, req.ModelsCount, req.ModelHandle)
+// checkModelDeletion rejects the deletion of a model having a locked or a leased version, it returns status errors
+func (s *ModelRegistryServer) checkModelDeletion(b backend.Backend, modelID string) error {
+	lockedVersionInfo, locked, err := retrieveLockedVersion(b, modelID)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return errorStatus(codes.NotFound, err)
+		}
+		return status.Errorf(codes.Internal, "unexpected error while deleting model %q: %s", modelID, err)
+	}
+	if locked {
+		return reasonStatus(codes.FailedPrecondition, extensionsapi.ErrorReason_VERSION_LOCKED, map[string]string{
+			"model_id":       modelID,
+			"version_number": strconv.FormatUint(uint64(lockedVersionInfo.VersionNumber), 10),
+		}, `unable to delete model %q, its version "%d" is locked`, modelID, lockedVersionInfo.VersionNumber)
+	}
+	if leases := s.versionLeases.list(modelID, 0); len(leases) > 0 {
+		leases = s.versionLeases.list(modelID, leases[0].versionNumber)
+		return versionLeasedStatus(leases, `unable to delete model %q, its version "%d" is leased by %s`, modelID, leases[0].versionNumber, leaseHolders(leases))
+	}
+	return nil
+}
 
+// retrieveModelsPage lists the models following the cursor, it resumes after the cursor's last model
+// even if models listed before it were created or deleted since the cursor was created.
+func retrieveModelsPage(
+	cursor pagination.Cursor,
+	resume bool,
+	count int,
+	listModels func(offset int, limit int) ([]backend.ModelInfo, error),
+) ([]*grpcapi.ModelInfo, pagination.Cursor, error) {
 	offset := 0
+	if resume {
+		var err error
+		offset, err = pagination.ResolveOffset(cursor, func(offset int) (string, bool, error) {
+			modelInfos, err := listModels(offset, 1)
+			if err != nil || len(modelInfos) == 0 {
+				return "", false, err
+			}
+			return modelInfos[0].ModelID, true, nil
+		})
+		if err != nil {
+			return nil, cursor, err
+		}
+	}
+
+	modelInfos, err := listModels(offset, count)
+	if err != nil {
+		return nil, cursor, err
+	}
+
+	pbModelInfos := []*grpcapi.ModelInfo{}
+	for _, modelInfo := range modelInfos {
+		pbModelInfo := grpcapi.ModelInfo{ModelId: modelInfo.ModelID, UserData: modelInfo.UserData}
+		pbModelInfos = append(pbModelInfos, &pbModelInfo)
+	}
+
+	nextCursor := pagination.Cursor{Offset: offset + len(modelInfos), LastKey: cursor.LastKey}
+	if len(modelInfos) > 0 {
+		nextCursor.LastKey = modelInfos[len(modelInfos)-1].ModelID
+	}
+	return pbModelInfos, nextCursor, nil
+}
+
+func (s *ModelRegistryServer) RetrieveModels(ctx context.Context, req *grpcapi.RetrieveModelsRequest) (*grpcapi.RetrieveModelsReply, error) {
+	logging.FromContext(ctx).WithFields(logrus.Fields{"model_ids": req.ModelIds, "models_count": req.ModelsCount, "model_handle": req.ModelHandle}).Info("RetrieveModels")
+
+	// Listing all the models is keyed by model id, a list of model ids is paginated by position
+	paginationScope := modelsPaginationScope
+	if len(req.ModelIds) > 0 {
+		paginationScope = modelIDsPaginationScope
+	}
+	cursor := pagination.Cursor{}
 	if req.ModelHandle != "" {
 		var err error
-		offset64, err := strconv.ParseInt(req.ModelHandle, 10, 0)
+		cursor, err = s.paginationCodec.Decode(paginationScope, req.ModelHandle)
 		if err != nil {
 			return nil, status.Errorf(codes.InvalidArgument, "Invalid value for `model_handle` (%q) only empty or values provided by a previous call should be used", req.ModelHandle)
 		}
-		offset = int(offset64)
 	}
 
 	b, err := s.backendPromise.Await(ctx)
@@ -117,28 +520,27 @@ func (s *ModelRegistryServer) RetrieveModels(ctx context.Context, req *grpcapi.R
 	}
 
 	pbModelInfos := []*grpcapi.ModelInfo{}
+	nextCursor := cursor
 
 	if len(req.ModelIds) == 0 {
 		// Retrieve all models
-		modelInfos, err := b.ListModels(offset, int(req.ModelsCount))
+		pbModelInfos, nextCursor, err = retrieveModelsPage(cursor, req.ModelHandle != "", int(req.ModelsCount), b.ListModels)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "unexpected error while retrieving models: %s", err)
 		}
-
-		for _, modelInfo := range modelInfos {
-			pbModelInfo := grpcapi.ModelInfo{ModelId: modelInfo.ModelID, UserData: modelInfo.UserData}
-			pbModelInfos = append(pbModelInfos, &pbModelInfo)
-		}
 	} else {
-		modelIDsSlice := req.ModelIds[offset:]
-		if req.ModelsCount > 0 {
+		modelIDsSlice := []string{}
+		if cursor.Offset < len(req.ModelIds) {
+			modelIDsSlice = req.ModelIds[cursor.Offset:]
+		}
+		if req.ModelsCount > 0 && int(req.ModelsCount) < len(modelIDsSlice) {
 			modelIDsSlice = modelIDsSlice[:req.ModelsCount]
 		}
 		for _, modelID := range modelIDsSlice {
 			modelInfo, err := b.RetrieveModelInfo(modelID)
 			if err != nil {
-				if _, ok := err.(*backend.UnknownModelError); ok {
-					return nil, status.Errorf(codes.NotFound, "%s", err)
+				if errors.As(err, new(*backend.UnknownModelError)) {
+					return nil, errorStatus(codes.NotFound, err)
 				}
 				return nil, status.Errorf(codes.Internal, `unexpected error while retrieving models: %s`, err)
 			}
@@ -146,18 +548,44 @@ func (s *ModelRegistryServer) RetrieveModels(ctx context.Context, req *grpcapi.R
 			pbModelInfo := grpcapi.ModelInfo{ModelId: modelInfo.ModelID, UserData: modelInfo.UserData}
 			pbModelInfos = append(pbModelInfos, &pbModelInfo)
 		}
-	}
 
-	nextOffset := offset + len(pbModelInfos)
+		nextCursor.Offset = cursor.Offset + len(pbModelInfos)
+	}
 
 	return &grpcapi.RetrieveModelsReply{
 		ModelInfos:      pbModelInfos,
-		NextModelHandle: strconv.FormatInt(int64(nextOffset), 10),
+		NextModelHandle: s.paginationCodec.Encode(paginationScope, nextCursor),
 	}, nil
 }
 
+// checkVersionDataSize rejects with RESOURCE_EXHAUSTED the versions larger than the configured maximum size
+//
+// The declared size is checked before any data is received, the received data is then rejected if it exceeds it.
+func (s *ModelRegistryServer) checkVersionDataSize(modelID string, dataSize uint64) error {
+	if s.maxVersionDataSize > 0 && dataSize > s.maxVersionDataSize {
+		return reasonStatus(codes.ResourceExhausted, extensionsapi.ErrorReason_QUOTA_EXCEEDED, map[string]string{
+			"model_id": modelID,
+			"resource": "bytes",
+			"limit":    strconv.FormatUint(s.maxVersionDataSize, 10),
+		}, "unable to create a version of model %q, its data size %d bytes exceeds the maximum of %d bytes", modelID, dataSize, s.maxVersionDataSize)
+	}
+	return nil
+}
+
+// verifySignature checks the signature of a received version when signatures verification is enabled
+func (s *ModelRegistryServer) verifySignature(receivedVersionInfo *grpcapi.ModelVersionInfo) error {
+	if s.signatureVerifier == nil {
+		return nil
+	}
+	err := s.signatureVerifier.Verify(receivedVersionInfo.ModelId, receivedVersionInfo.DataHash, receivedVersionInfo.UserData)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	return nil
+}
+
 func (s *ModelRegistryServer) CreateVersion(inStream grpcapi.ModelRegistrySP_CreateVersionServer) error {
-	log.Printf("CreateVersion(stream=...)\n")
+	logging.FromContext(inStream.Context()).Info("CreateVersion")
 
 	firstChunk, err := inStream.Recv()
 	if err == io.EOF {
@@ -172,39 +600,27 @@ func (s *ModelRegistryServer) CreateVersion(inStream grpcapi.ModelRegistrySP_Cre
 
 	receivedVersionInfo := firstChunk.GetHeader().GetVersionInfo()
 
-	modelData := []byte{}
-
-	for {
-		chunk, err := inStream.Recv()
-		if err == io.EOF {
-			receivedDataSize := uint64(len(modelData))
-			if receivedDataSize == receivedVersionInfo.DataSize && err == io.EOF {
-				break
-			}
-			if err == io.EOF {
-				return status.Errorf(codes.InvalidArgument, "stream ended while having not received the expected data, expected %d bytes, received %d bytes", receivedVersionInfo.DataSize, receivedDataSize)
-			}
-			if receivedDataSize > receivedVersionInfo.DataSize {
-				return status.Errorf(codes.InvalidArgument, "received more data than expected, expected %d bytes, received %d bytes", receivedVersionInfo.DataSize, receivedDataSize)
-			}
-		}
-		if err != nil {
-			return err
-		}
-		if chunk.GetBody() == nil {
-			return status.Errorf(codes.InvalidArgument, "subsequent request chunk do not include a Body")
-		}
-		modelData = append(modelData, chunk.GetBody().DataChunk...)
+	b, err := s.backendPromise.Await(inStream.Context())
+	if err != nil {
+		return err
 	}
 
-	receivedHash := backend.ComputeSHA256Hash(modelData)
-
-	if receivedVersionInfo.DataHash != "" && receivedVersionInfo.DataHash != receivedHash {
-		return status.Errorf(codes.InvalidArgument, "received data did not match the expected hash, expected %q, received %q", receivedVersionInfo.DataHash, receivedHash)
+	if err := s.validateModelID(receivedVersionInfo.ModelId); err != nil {
+		return err
 	}
-
-	b, err := s.backendPromise.Await(inStream.Context())
-	if err != nil {
+	if _, err := backend.ParseDataHashAlgorithm(receivedVersionInfo.DataHash); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if err := s.verifySignature(receivedVersionInfo); err != nil {
+		return err
+	}
+	if err := validateVersionUserData(b, receivedVersionInfo.ModelId, receivedVersionInfo.UserData); err != nil {
+		return err
+	}
+	if err := s.checkVersionDataSize(receivedVersionInfo.ModelId, receivedVersionInfo.DataSize); err != nil {
+		return err
+	}
+	if err := s.checkNamespaceQuota(b, receivedVersionInfo.ModelId, namespaces.Usage{VersionsCount: 1, DataSize: int64(receivedVersionInfo.DataSize)}); err != nil {
 		return err
 	}
 
@@ -213,32 +629,94 @@ func (s *ModelRegistryServer) CreateVersion(inStream grpcapi.ModelRegistrySP_Cre
 		creationTimestamp = timeFromNsTimestamp(receivedVersionInfo.CreationTimestamp)
 	}
 
-	versionInfo, err := b.CreateOrUpdateModelVersion(receivedVersionInfo.ModelId, backend.VersionArgs{
+	versionDataWriter, err := b.CreateOrUpdateModelVersionStream(receivedVersionInfo.ModelId, backend.VersionArgs{
 		CreationTimestamp: creationTimestamp,
 		Archived:          receivedVersionInfo.Archived,
-		DataHash:          receivedHash,
-		Data:              modelData,
+		DataHash:          receivedVersionInfo.DataHash,
+		DataHashAlgorithm: s.hashAlgorithm.Name,
+		DataSize:          int(receivedVersionInfo.DataSize),
 		UserData:          receivedVersionInfo.UserData,
 	})
 	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return errorStatus(codes.NotFound, err)
+		}
+		return status.Errorf(codes.Internal, "unexpected error while creating a version for model %q: %s", receivedVersionInfo.ModelId, err)
+	}
+	versionDataWriter = s.checkDependenciesOnCommit(b, versionDataWriter, receivedVersionInfo.UserData)
+
+	receivedDataSize := uint64(0)
+	for {
+		chunk, err := inStream.Recv()
+		if err == io.EOF {
+			if receivedDataSize == receivedVersionInfo.DataSize {
+				break
+			}
+			_ = versionDataWriter.Abort()
+			return status.Errorf(codes.InvalidArgument, "stream ended while having not received the expected data, expected %d bytes, received %d bytes", receivedVersionInfo.DataSize, receivedDataSize)
+		}
+		if err != nil {
+			_ = versionDataWriter.Abort()
+			return err
+		}
+		if chunk.GetBody() == nil {
+			_ = versionDataWriter.Abort()
+			return status.Errorf(codes.InvalidArgument, "subsequent request chunk do not include a Body")
+		}
+		receivedDataSize += uint64(len(chunk.GetBody().DataChunk))
+		if receivedDataSize > receivedVersionInfo.DataSize {
+			_ = versionDataWriter.Abort()
+			return status.Errorf(codes.InvalidArgument, "received more data than expected, expected %d bytes, received %d bytes", receivedVersionInfo.DataSize, receivedDataSize)
+		}
+		_, err = versionDataWriter.Write(chunk.GetBody().DataChunk)
+		if err != nil {
+			_ = versionDataWriter.Abort()
+			return status.Errorf(codes.Internal, "unexpected error while writing the data of a version for model %q: %s", receivedVersionInfo.ModelId, err)
+		}
+	}
+
+	versionInfo, err := versionDataWriter.Commit()
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		if errors.As(err, new(*backend.DataHashMismatchError)) {
+			return errorStatus(codes.InvalidArgument, err)
+		}
 		return status.Errorf(codes.Internal, "unexpected error while creating a version for model %q: %s", receivedVersionInfo.ModelId, err)
 	}
 
+	s.publishVersionEvent(versionCreated, versionInfo)
+
 	pbVersionInfo := createPbModelVersionInfo(versionInfo)
 	return inStream.SendAndClose(&grpcapi.CreateVersionReply{VersionInfo: &pbVersionInfo})
 }
 
 func (s *ModelRegistryServer) RetrieveVersionInfos(ctx context.Context, req *grpcapi.RetrieveVersionInfosRequest) (*grpcapi.RetrieveVersionInfosReply, error) {
-	log.Printf("RetrieveVersionInfos(req={ModelId: %q, VersionNumbers: %#v, VersionsCount: %d, VersionHandle: %q})\n", req.ModelId, req.VersionNumbers, req.VersionsCount, req.VersionHandle)
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"model_id":        req.ModelId,
+		"version_numbers": req.VersionNumbers,
+		"versions_count":  req.VersionsCount,
+		"version_handle":  req.VersionHandle,
+	}).Info("RetrieveVersionInfos")
 
-	initialVersionNumber := uint(0)
+	// An alias targets a single version, taking precedence over the requested version numbers
+	alias, err := requestedVersionAlias(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Listing all the versions is keyed by version number, a list of version numbers is paginated by position
+	paginationScope := versionsPaginationScope(req.ModelId)
+	if len(req.VersionNumbers) > 0 || alias != "" {
+		paginationScope = versionNumbersPaginationScope(req.ModelId)
+	}
+	cursor := pagination.Cursor{}
 	if req.VersionHandle != "" {
-		var err error
-		initialVersionNumber64, err := strconv.ParseUint(req.VersionHandle, 10, 0)
+		cursor, err = s.paginationCodec.Decode(paginationScope, req.VersionHandle)
 		if err != nil {
 			return nil, status.Errorf(codes.InvalidArgument, "Invalid value for `version_handle` (%q) only empty or values provided by a previous call should be used", req.VersionHandle)
 		}
-		initialVersionNumber = uint(initialVersionNumber64)
 	}
 
 	b, err := s.backendPromise.Await(ctx)
@@ -246,12 +724,22 @@ func (s *ModelRegistryServer) RetrieveVersionInfos(ctx context.Context, req *grp
 		return nil, err
 	}
 
-	if len(req.VersionNumbers) == 0 {
-		// Retrieve all version infos
+	versionNumbers := req.VersionNumbers
+	if alias != "" {
+		aliasedVersionNumber, err := resolveVersionAlias(b, req.ModelId, alias)
+		if err != nil {
+			return nil, err
+		}
+		versionNumbers = []int32{int32(aliasedVersionNumber)}
+	}
+
+	if len(versionNumbers) == 0 {
+		// Retrieve all version infos, the cursor offset is the next version number
+		initialVersionNumber := uint(cursor.Offset)
 		versionInfos, err := b.ListModelVersionInfos(req.ModelId, initialVersionNumber, int(req.VersionsCount))
 		if err != nil {
-			if _, ok := err.(*backend.UnknownModelError); ok {
-				return nil, status.Errorf(codes.NotFound, "%s", err)
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				return nil, errorStatus(codes.NotFound, err)
 			}
 			return nil, status.Errorf(codes.Internal, "unexpected error while deleting model %q: %s", req.ModelId, err)
 		}
@@ -267,69 +755,189 @@ func (s *ModelRegistryServer) RetrieveVersionInfos(ctx context.Context, req *grp
 
 		return &grpcapi.RetrieveVersionInfosReply{
 			VersionInfos:      pbVersionInfos,
-			NextVersionHandle: strconv.FormatUint(uint64(nextVersionNumber), 10),
+			NextVersionHandle: s.paginationCodec.Encode(paginationScope, pagination.Cursor{Offset: int(nextVersionNumber)}),
 		}, nil
 	}
 
 	pbVersionInfos := []*grpcapi.ModelVersionInfo{}
-	versionNumberSlice := req.VersionNumbers[initialVersionNumber:]
-	if req.VersionsCount > 0 {
+	versionNumberSlice := []int32{}
+	if cursor.Offset < len(versionNumbers) {
+		versionNumberSlice = versionNumbers[cursor.Offset:]
+	}
+	if req.VersionsCount > 0 && int(req.VersionsCount) < len(versionNumberSlice) {
 		versionNumberSlice = versionNumberSlice[:req.VersionsCount]
 	}
-	nextVersionNumber := initialVersionNumber
 	for _, versionNumber := range versionNumberSlice {
 		versionInfo, err := b.RetrieveModelVersionInfo(req.ModelId, int(versionNumber))
 		if err != nil {
-			if _, ok := err.(*backend.UnknownModelError); ok {
-				return nil, status.Errorf(codes.NotFound, "%s", err)
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				return nil, errorStatus(codes.NotFound, err)
 			}
-			if _, ok := err.(*backend.UnknownModelVersionError); ok {
-				return nil, status.Errorf(codes.NotFound, "%s", err)
+			if errors.As(err, new(*backend.UnknownModelVersionError)) {
+				return nil, errorStatus(codes.NotFound, err)
 			}
 			return nil, status.Errorf(codes.Internal, `unexpected error while retrieving version "%d" for model %q: %s`, versionNumber, req.ModelId, err)
 		}
 
 		pbVersionInfo := createPbModelVersionInfo(versionInfo)
 		pbVersionInfos = append(pbVersionInfos, &pbVersionInfo)
-		nextVersionNumber = versionInfo.VersionNumber + 1
 	}
 
 	return &grpcapi.RetrieveVersionInfosReply{
 		VersionInfos:      pbVersionInfos,
-		NextVersionHandle: strconv.FormatUint(uint64(nextVersionNumber), 10),
+		NextVersionHandle: s.paginationCodec.Encode(paginationScope, pagination.Cursor{Offset: cursor.Offset + len(pbVersionInfos)}),
 	}, nil
 }
 
+// requestsDataHashVerification checks if the client requested the verification of the retrieved data using the
+// `cogment-model-registry-verify-data-hash: true` metadata
+func requestsDataHashVerification(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	for _, value := range md.Get(verifyDataHashMetadataKey) {
+		if verify, err := strconv.ParseBool(value); err == nil && verify {
+			return true
+		}
+	}
+	return false
+}
+
+// requestedChunkSize retrieves the chunk size preferred by the client using the
+// `cogment-model-registry-preferred-chunk-size: <bytes>` metadata, 0 if not provided
+func requestedChunkSize(ctx context.Context) (int, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(preferredChunkSizeMetadataKey)
+	if len(values) == 0 {
+		return 0, nil
+	}
+	chunkSize, err := strconv.ParseUint(values[0], 10, 31)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid %q metadata %q, expecting a number of bytes", preferredChunkSizeMetadataKey, values[0])
+	}
+	return int(chunkSize), nil
+}
+
+// requestedKnownDataHash retrieves the hash of the data the client already has using the
+// `cogment-model-registry-known-data-hash: <hash>` metadata, empty if not provided
+func requestedKnownDataHash(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(knownDataHashMetadataKey)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
 func (s *ModelRegistryServer) RetrieveVersionData(req *grpcapi.RetrieveVersionDataRequest, outStream grpcapi.ModelRegistrySP_RetrieveVersionDataServer) error {
-	log.Printf("RetrieveVersionData(req={ModelId: %q, VersionNumber: %d})\n", req.ModelId, req.VersionNumber)
+	logging.FromContext(outStream.Context()).WithFields(logrus.Fields{"model_id": req.ModelId, "version_number": req.VersionNumber}).Info("RetrieveVersionData")
 
-	b, err := s.backendPromise.Await(outStream.Context())
+	preferredChunkSize, err := requestedChunkSize(outStream.Context())
 	if err != nil {
 		return err
 	}
 
-	modelData, err := b.RetrieveModelVersionData(req.ModelId, int(req.VersionNumber))
+	alias, err := requestedVersionAlias(outStream.Context())
 	if err != nil {
-		if _, ok := err.(*backend.UnknownModelError); ok {
-			return status.Errorf(codes.NotFound, "%s", err)
+		return err
+	}
+
+	b, err := s.backendPromise.Await(outStream.Context())
+	if err != nil {
+		return err
+	}
+
+	versionNumber := int(req.VersionNumber)
+	if alias != "" {
+		versionNumber, err = resolveVersionAlias(b, req.ModelId, alias)
+		if err != nil {
+			return err
+		}
+	}
+
+	if knownDataHash := requestedKnownDataHash(outStream.Context()); knownDataHash != "" {
+		versionInfo, err := b.RetrieveModelVersionInfo(req.ModelId, versionNumber)
+		if err != nil {
+			return retrieveVersionDataError(req.ModelId, versionNumber, err)
+		}
+		if versionInfo.DataHash == knownDataHash {
+			// The stream ends without any chunk, even empty data is sent as one empty chunk
+			return outStream.SetHeader(metadata.Pairs(notModifiedMetadataKey, "true"))
+		}
+	}
+
+	if s.verifyDataHash || requestsDataHashVerification(outStream.Context()) {
+		// The whole data is needed to verify it before sending any of it
+		versionInfo, modelData, err := retrieveVerifiedVersion(b, req.ModelId, versionNumber)
+		if err != nil {
+			return retrieveVersionDataError(req.ModelId, versionNumber, err)
 		}
-		if _, ok := err.(*backend.UnknownModelVersionError); ok {
-			return status.Errorf(codes.NotFound, "%s", err)
+		trackedStream := startVersionDataStream(outStream, versionInfo)
+		defer trackedStream.stop(outStream.Context())
+		return s.sendVersionData(trackedStream, modelData, s.negotiateChunkSize(preferredChunkSize))
+	}
+
+	// Versions stored in files or cached in memory are read from there without any copy of their whole data
+	versionInfo, reader, opened, err := backend.OpenModelVersionData(b, req.ModelId, versionNumber)
+	if err != nil {
+		return retrieveVersionDataError(req.ModelId, versionNumber, err)
+	}
+	if opened {
+		defer reader.Close()
+		trackedStream := startVersionDataStream(outStream, versionInfo)
+		defer trackedStream.stop(outStream.Context())
+		return s.streamVersionData(outStream.Context(), trackedStream, b, versionInfo, s.negotiateChunkSize(preferredChunkSize), openedChunkReader(reader))
+	}
+
+	versionInfo, err = b.RetrieveModelVersionInfo(req.ModelId, versionNumber)
+	if err != nil {
+		return retrieveVersionDataError(req.ModelId, versionNumber, err)
+	}
+	trackedStream := startVersionDataStream(outStream, versionInfo)
+	defer trackedStream.stop(outStream.Context())
+	// Reading a range of the data stored compressed or encrypted decodes all of it, it is then only decoded once
+	if s.sentVersionDataBufferedChunks <= 0 || versionInfo.DataCompression != "" || versionInfo.DataEncryptionKeyID != "" {
+		modelData, err := b.RetrieveModelVersionData(req.ModelId, int(versionInfo.VersionNumber))
+		if err != nil {
+			return retrieveVersionDataError(req.ModelId, versionNumber, err)
 		}
-		return status.Errorf(codes.Internal, `unexpected error while retrieving version "%d" for model %q: %s`, req.VersionNumber, req.ModelId, err)
+		return s.sendVersionData(trackedStream, modelData, s.negotiateChunkSize(preferredChunkSize))
+	}
+	return s.streamVersionData(outStream.Context(), trackedStream, b, versionInfo, s.negotiateChunkSize(preferredChunkSize), backendChunkReader(b, versionInfo))
+}
+
+func retrieveVersionDataError(modelID string, versionNumber int, err error) error {
+	if errors.As(err, new(*backend.UnknownModelError)) {
+		return errorStatus(codes.NotFound, err)
 	}
+	if errors.As(err, new(*backend.UnknownModelVersionError)) {
+		return errorStatus(codes.NotFound, err)
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Errorf(codes.Internal, `unexpected error while retrieving version "%d" for model %q: %s`, versionNumber, modelID, err)
+}
 
+// versionDataChunkSender is implemented by the streams sending the data of a version
+type versionDataChunkSender interface {
+	Send(*grpcapi.RetrieveVersionDataReplyChunk) error
+}
+
+// sendVersionData sends the data of a version split in chunks of at most chunkSize bytes
+func (s *ModelRegistryServer) sendVersionData(outStream versionDataChunkSender, modelData []byte, chunkSize int) error {
 	dataLen := len(modelData)
 	if dataLen == 0 {
 		return outStream.Send(&grpcapi.RetrieveVersionDataReplyChunk{})
 	}
 
-	for i := 0; i < dataLen; i += s.sentModelVersionDataChunkSize {
+	for i := 0; i < dataLen; i += chunkSize {
 		var replyChunk grpcapi.RetrieveVersionDataReplyChunk
-		if i+s.sentModelVersionDataChunkSize >= dataLen {
+		if i+chunkSize >= dataLen {
 			replyChunk = grpcapi.RetrieveVersionDataReplyChunk{DataChunk: modelData[i:dataLen]}
 		} else {
-			replyChunk = grpcapi.RetrieveVersionDataReplyChunk{DataChunk: modelData[i : i+s.sentModelVersionDataChunkSize]}
+			replyChunk = grpcapi.RetrieveVersionDataReplyChunk{DataChunk: modelData[i : i+chunkSize]}
 		}
 		err := outStream.Send(&replyChunk)
 		if err != nil {
@@ -340,11 +948,82 @@ func (s *ModelRegistryServer) RetrieveVersionData(req *grpcapi.RetrieveVersionDa
 	return nil
 }
 
-func RegisterModelRegistryServer(grpcServer grpc.ServiceRegistrar, sentModelVersionDataChunkSize int) (*ModelRegistryServer, error) {
+// ModelRegistryServerConfiguration configures the behavior of the model registry server
+type ModelRegistryServerConfiguration struct {
+	SentModelVersionDataChunkSize    int
+	MinSentModelVersionDataChunkSize int // Smallest chunk size clients can prefer, 1 when 0
+	MaxSentModelVersionDataChunkSize int // Largest chunk size clients can prefer, unlimited when 0
+	PaginationSecret                 []byte
+	UploadSessionTimeout             time.Duration
+	MaxUploadSessions                int           // Most uploads started with BeginUpload open at once, unlimited when 0
+	VersionLeaseTTL                  time.Duration // Duration after which a lease that isn't renewed expires, 1 minute when 0
+	HashAlgorithm                    backend.HashAlgorithm
+	VerifyDataHash                   bool                      // Verify the data retrieved by every RetrieveVersionData call against its hash
+	SignatureVerifier                *signature.Verifier       // If defined, verify the signature of the created versions
+	Namespaces                       *namespaces.Configuration // If defined, enforce the declared namespaces and their quotas
+	ModelIDRules                     *modelIDs.Rules           // If defined, the created models and versions ids must satisfy them
+	MaxVersionDataSize               uint64                    // If not 0, the maximum size in bytes of the data of a created version
+	SentVersionDataBufferedChunks    int                       // Chunks read ahead of the client by RetrieveVersionData, the whole data is read at once when 0
+	PresignedURLExpiration           time.Duration             // Longest validity of the URLs returned by RetrieveVersionDataURL, no URL is returned when 0
+	SnapshotDir                      string                    // Directory of the snapshots saved and loaded by SaveSnapshot and LoadSnapshot, unavailable when empty
+	Maintenance                      *maintenance.Gate         // If defined, SetMaintenance enters and leaves its maintenance mode
+	// If defined, checks the client of an RPC is allowed to write a model only known from the request by the server, i.e.
+	// the model of an upload or of a lease, the ids of the uploads and leases don't grant any access
+	AuthorizeModel func(ctx context.Context, modelID string) error
+}
+
+func RegisterModelRegistryServer(grpcServer grpc.ServiceRegistrar, configuration ModelRegistryServerConfiguration) (*ModelRegistryServer, error) {
+	server, err := CreateModelRegistryServer(configuration)
+	if err != nil {
+		return nil, err
+	}
+	server.Register(grpcServer)
+	return server, nil
+}
+
+// CreateModelRegistryServer creates a server without registering it, it can then be registered on several gRPC servers
+func CreateModelRegistryServer(configuration ModelRegistryServerConfiguration) (*ModelRegistryServer, error) {
+	paginationCodec, err := pagination.CreateCodec(configuration.PaginationSecret)
+	if err != nil {
+		return nil, err
+	}
+	minChunkSize := configuration.MinSentModelVersionDataChunkSize
+	if minChunkSize <= 0 {
+		minChunkSize = 1
+	}
+	if configuration.MaxSentModelVersionDataChunkSize > 0 && minChunkSize > configuration.MaxSentModelVersionDataChunkSize {
+		return nil, fmt.Errorf("invalid sent chunk size limits, the minimum %d is greater than the maximum %d", minChunkSize, configuration.MaxSentModelVersionDataChunkSize)
+	}
+
 	server := &ModelRegistryServer{
-		sentModelVersionDataChunkSize: sentModelVersionDataChunkSize,
+		paginationCodec:                  paginationCodec,
+		sentModelVersionDataChunkSize:    int64(configuration.SentModelVersionDataChunkSize),
+		minSentModelVersionDataChunkSize: minChunkSize,
+		maxSentModelVersionDataChunkSize: configuration.MaxSentModelVersionDataChunkSize,
+		versionBroadcaster:               createVersionBroadcaster(),
+		modelBroadcaster:                 createModelBroadcaster(),
+		registryBroadcaster:              createRegistryBroadcaster(),
+		uploadSessions:                   createUploadSessions(configuration.UploadSessionTimeout, configuration.MaxUploadSessions),
+		versionLeases:                    createVersionLeases(configuration.VersionLeaseTTL),
+		hashAlgorithm:                    configuration.HashAlgorithm,
+		verifyDataHash:                   configuration.VerifyDataHash,
+		signatureVerifier:                configuration.SignatureVerifier,
+		namespaces:                       configuration.Namespaces,
+		modelIDRules:                     configuration.ModelIDRules,
+		maxVersionDataSize:               configuration.MaxVersionDataSize,
+		sentVersionDataBufferedChunks:    configuration.SentVersionDataBufferedChunks,
+		presignedURLExpiration:           configuration.PresignedURLExpiration,
+		snapshotDir:                      configuration.SnapshotDir,
+		maintenance:                      configuration.Maintenance,
+		authorizeModel:                   configuration.AuthorizeModel,
+		shutdown:                         make(chan struct{}),
 	}
 
-	grpcapi.RegisterModelRegistrySPServer(grpcServer, server)
 	return server, nil
 }
+
+// Register registers the services of the server on a gRPC server
+func (s *ModelRegistryServer) Register(grpcServer grpc.ServiceRegistrar) {
+	grpcapi.RegisterModelRegistrySPServer(grpcServer, s)
+	extensionsapi.RegisterModelRegistryExtensionsSPServer(grpcServer, &modelRegistryExtensionsServer{server: s})
+}
@@ -15,32 +15,64 @@
 package grpcservers
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"math"
 	"net"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/circuitBreaker"
+	"github.com/cogment/cogment-model-registry/backend/coldStorage"
 	"github.com/cogment/cogment-model-registry/backend/fs"
 	"github.com/cogment/cogment-model-registry/backend/memoryCache"
 	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+	"github.com/cogment/cogment-model-registry/logging"
+	"github.com/cogment/cogment-model-registry/maintenance"
+	"github.com/cogment/cogment-model-registry/modelIDs"
+	"github.com/cogment/cogment-model-registry/namespaces"
+	"github.com/cogment/cogment-model-registry/pagination"
+	"github.com/cogment/cogment-model-registry/recovery"
+	"github.com/cogment/cogment-model-registry/retention"
+	"github.com/cogment/cogment-model-registry/signature"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 )
 
 type testContext struct {
-	backend    backend.Backend
-	grpcCtx    context.Context
-	client     grpcapi.ModelRegistrySPClient
-	connection *grpc.ClientConn
+	server           *grpc.Server
+	registryServer   *ModelRegistryServer
+	backend          backend.Backend
+	grpcCtx          context.Context
+	client           grpcapi.ModelRegistrySPClient
+	extensionsClient extensionsapi.ModelRegistryExtensionsSPClient
+	connection       *grpc.ClientConn
+	paginationCodec  *pagination.Codec
 }
 
+var paginationSecret = []byte("pagination secret")
+
+// Short enough for the expiration of upload sessions to be tested
+const uploadSessionTimeout = 500 * time.Millisecond
+
 var modelData = []byte(`Lorem ipsum dolor sit amet, consectetuer adipiscing elit. Aenean commodo ligula
 eget dolor. Aenean massa. Cum sociis natoque penatibus et magnis dis parturient
 montes, nascetur ridiculus mus. Donec quam felis, ultricies nec, pellentesque
@@ -53,8 +85,20 @@ enim. Aliquam lorem ante, dapibus in, viverra quis, feugiat a, tellus. Phasellus
 viverra nulla ut metus varius laoreet.`)
 
 func createContext(t *testing.T, sentModelVersionDataChunkSize int) (testContext, error) {
+	return createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: sentModelVersionDataChunkSize,
+		PaginationSecret:              paginationSecret,
+		UploadSessionTimeout:          uploadSessionTimeout,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+	})
+}
+
+func createContextWithConfiguration(t *testing.T, configuration ModelRegistryServerConfiguration) (testContext, error) {
 	listener := bufconn.Listen(1024 * 1024)
-	server := grpc.NewServer()
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor(), recovery.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor(), recovery.StreamServerInterceptor()),
+	)
 	archiveBackend, err := fs.CreateBackend(t.TempDir())
 	if err != nil {
 		return testContext{}, err
@@ -66,7 +110,7 @@ func createContext(t *testing.T, sentModelVersionDataChunkSize int) (testContext
 	if err != nil {
 		return testContext{}, err
 	}
-	modelRegistryServer, err := RegisterModelRegistryServer(server, sentModelVersionDataChunkSize)
+	modelRegistryServer, err := RegisterModelRegistryServer(server, configuration)
 	if err != nil {
 		return testContext{}, err
 	}
@@ -81,6 +125,11 @@ func createContext(t *testing.T, sentModelVersionDataChunkSize int) (testContext
 		return listener.Dial()
 	}
 
+	paginationCodec, err := pagination.CreateCodec(paginationSecret)
+	if err != nil {
+		return testContext{}, err
+	}
+
 	grpcCtx := context.Background()
 
 	connection, err := grpc.DialContext(grpcCtx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithInsecure())
@@ -89,18 +138,260 @@ func createContext(t *testing.T, sentModelVersionDataChunkSize int) (testContext
 	}
 
 	return testContext{
-		backend:    backend,
-		grpcCtx:    grpcCtx,
-		client:     grpcapi.NewModelRegistrySPClient(connection),
-		connection: connection,
+		server:           server,
+		registryServer:   modelRegistryServer,
+		backend:          backend,
+		grpcCtx:          grpcCtx,
+		client:           grpcapi.NewModelRegistrySPClient(connection),
+		extensionsClient: extensionsapi.NewModelRegistryExtensionsSPClient(connection),
+		connection:       connection,
+		paginationCodec:  paginationCodec,
 	}, nil
 }
 
+func (ctx *testContext) versionsHandle(modelID string, nextVersionNumber int) string {
+	return ctx.paginationCodec.Encode(versionsPaginationScope(modelID), pagination.Cursor{Offset: nextVersionNumber})
+}
+
 func (ctx *testContext) destroy() {
 	ctx.connection.Close()
 	ctx.backend.Destroy()
 }
 
+// unreachableBackend fails listing the models as an unreachable storage would
+type unreachableBackend struct {
+	backend.Backend
+}
+
+func (b unreachableBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	return nil, &backend.TransientError{Err: fmt.Errorf("connection refused")}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	breaker := circuitBreaker.CreateBreaker(circuitBreaker.Configuration{FailureThreshold: 1, OpenDuration: time.Hour})
+	ctx.registryServer.SetCircuitBreaker(breaker)
+	_, err = ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{})
+	assert.NoError(t, err)
+
+	failingBackend, err := circuitBreaker.CreateBackend(unreachableBackend{Backend: ctx.backend}, breaker)
+	assert.NoError(t, err)
+	_, err = failingBackend.ListModels(0, -1)
+	assert.Error(t, err)
+
+	{
+		trailer := metadata.MD{}
+		_, err := ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{}, grpc.Trailer(&trailer))
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, []string{"3600"}, trailer.Get(retryAfterMetadataKey))
+	}
+	{
+		stream, err := ctx.client.RetrieveVersionData(ctx.grpcCtx, &grpcapi.RetrieveVersionDataRequest{ModelId: "foo", VersionNumber: 1})
+		assert.NoError(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, []string{"3600"}, stream.Trailer().Get(retryAfterMetadataKey))
+	}
+}
+
+// stuckBackend blocks listing the models and creating version streams until the gate is open
+type stuckBackend struct {
+	backend.Backend
+	gate    chan struct{}
+	aborted chan struct{}
+}
+
+func (b stuckBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	<-b.gate
+	return b.Backend.ListModels(offset, limit)
+}
+
+type abortRecordingWriter struct {
+	backend.VersionDataWriter
+	aborted chan struct{}
+}
+
+func (w abortRecordingWriter) Abort() error {
+	close(w.aborted)
+	return w.VersionDataWriter.Abort()
+}
+
+func (b stuckBackend) CreateOrUpdateModelVersionStream(modelID string, versionArgs backend.VersionArgs) (backend.VersionDataWriter, error) {
+	<-b.gate
+	writer, err := b.Backend.CreateOrUpdateModelVersionStream(modelID, versionArgs)
+	if err != nil {
+		return nil, err
+	}
+	return abortRecordingWriter{VersionDataWriter: writer, aborted: b.aborted}, nil
+}
+
+func TestContextBackend(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	stuck := stuckBackend{Backend: ctx.backend, gate: make(chan struct{}), aborted: make(chan struct{})}
+
+	callCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	b := bindContext(stuck, callCtx)
+	_, err = b.ListModels(0, -1)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	// Once done, the context fails the operations right away
+	hasModel, err := b.HasModel("foo")
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.False(t, hasModel)
+
+	streamCtx, cancelStream := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelStream()
+	_, err = bindContext(stuck, streamCtx).CreateOrUpdateModelVersionStream("foo", backend.VersionArgs{})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	// The abandoned writer is aborted once created
+	close(stuck.gate)
+	select {
+	case <-stuck.aborted:
+	case <-time.After(time.Second):
+		assert.Fail(t, "the abandoned writer wasn't aborted")
+	}
+
+	b = bindContext(stuck, context.Background())
+	modelInfos, err := b.ListModels(0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, modelInfos, 1)
+}
+
+// slowDeletionBackend deletes the models once the gate is open
+type slowDeletionBackend struct {
+	backend.Backend
+	gate chan struct{}
+}
+
+func (b slowDeletionBackend) DeleteModel(modelID string) error {
+	<-b.gate
+	return b.Backend.DeleteModel(modelID)
+}
+
+func TestContextBackendMutations(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	slow := slowDeletionBackend{Backend: ctx.backend, gate: make(chan struct{})}
+
+	callCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	go func() {
+		<-callCtx.Done()
+		close(slow.gate)
+	}()
+	// The deletion isn't abandoned at the deadline as it would still complete
+	b := bindContext(slow, callCtx)
+	err = b.DeleteModel("foo")
+	assert.NoError(t, err)
+	hasModel, err := ctx.backend.HasModel("foo")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+
+	// Once done, the context fails the mutations before they start
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	hasModel, err = ctx.backend.HasModel("foo")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+}
+
+// contextBoundBackend lists the models until the context it is bound to is done
+type contextBoundBackend struct {
+	backend.Backend
+	ctx context.Context
+}
+
+func (b contextBoundBackend) BindContext(ctx context.Context) (backend.Backend, bool) {
+	return contextBoundBackend{Backend: b.Backend, ctx: ctx}, true
+}
+
+func (b contextBoundBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	<-b.ctx.Done()
+	return nil, fmt.Errorf("unable to list the models: %w", b.ctx.Err())
+}
+
+func TestBoundContextBackend(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	callCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// The operation itself stops with the context, its failure is reported like an abandoned one
+	_, err = bindContext(contextBoundBackend{Backend: ctx.backend}, callCtx).ListModels(0, -1)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+// panickingBackend panics while listing the models as a buggy backend would
+type panickingBackend struct {
+	backend.Backend
+}
+
+func (b panickingBackend) ListModels(offset int, limit int) ([]backend.ModelInfo, error) {
+	var modelInfos []backend.ModelInfo
+	return modelInfos[:1], nil
+}
+
+func TestPanicRecovery(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	ctx.registryServer.SetBackend(panickingBackend{Backend: ctx.backend})
+	// The panic happens in the goroutine running the backend operation
+	_, err = ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "/cogmentAPI.ModelRegistrySP/RetrieveModels")
+
+	// The server keeps handling the other calls
+	rep, err := ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{ModelIds: []string{"foo"}})
+	assert.NoError(t, err)
+	assert.Len(t, rep.ModelInfos, 1)
+}
+
+func TestRequestID(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		header := metadata.MD{}
+		_, err := ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{}, grpc.Header(&header))
+		assert.NoError(t, err)
+		assert.Len(t, header.Get(logging.RequestIDMetadataKey), 1)
+		assert.NotEmpty(t, header.Get(logging.RequestIDMetadataKey)[0])
+	}
+	{
+		header := metadata.MD{}
+		grpcCtx := metadata.AppendToOutgoingContext(ctx.grpcCtx, logging.RequestIDMetadataKey, "my_request")
+		_, err := ctx.client.RetrieveModels(grpcCtx, &grpcapi.RetrieveModelsRequest{}, grpc.Header(&header))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"my_request"}, header.Get(logging.RequestIDMetadataKey))
+	}
+	{
+		stream, err := ctx.client.RetrieveVersionData(ctx.grpcCtx, &grpcapi.RetrieveVersionDataRequest{ModelId: "foo", VersionNumber: 1})
+		assert.NoError(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		message := status.Convert(err).Message()
+		header, err := stream.Header()
+		assert.NoError(t, err)
+		assert.Len(t, header.Get(logging.RequestIDMetadataKey), 1)
+		// The error messages include the request id
+		assert.Contains(t, message, header.Get(logging.RequestIDMetadataKey)[0])
+	}
+}
+
 func TestCreateOrUpdateModel(t *testing.T) {
 
 	modelUserData := make(map[string]string)
@@ -119,7 +410,7 @@ func TestCreateOrUpdateModel(t *testing.T) {
 		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "foo"})
 		assert.NoError(t, err)
 		assert.Len(t, rep.VersionInfos, 0)
-		assert.Equal(t, "0", rep.NextVersionHandle)
+		assert.Equal(t, ctx.versionsHandle("foo", 0), rep.NextVersionHandle)
 	}
 	{
 		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "bar", UserData: modelUserData}})
@@ -129,7 +420,7 @@ func TestCreateOrUpdateModel(t *testing.T) {
 		rep, err := ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{})
 		assert.NoError(t, err)
 		assert.Len(t, rep.ModelInfos, 2)
-		assert.Equal(t, "2", rep.NextModelHandle)
+		assert.Equal(t, ctx.paginationCodec.Encode(modelsPaginationScope, pagination.Cursor{Offset: 2, LastKey: "foo"}), rep.NextModelHandle)
 
 		assert.Equal(t, rep.ModelInfos[0].ModelId, "bar")
 		assert.Equal(t, rep.ModelInfos[0].UserData["model_test1"], "model_test1")
@@ -180,6 +471,150 @@ func TestDeleteModel(t *testing.T) {
 	}
 }
 
+func TestModelRevisions(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	createOrUpdateModel := func(expectedRevision string, userData map[string]string) error {
+		grpcCtx := ctx.grpcCtx
+		if expectedRevision != "" {
+			grpcCtx = metadata.AppendToOutgoingContext(grpcCtx, expectedModelRevisionMetadataKey, expectedRevision)
+		}
+		_, err := ctx.client.CreateOrUpdateModel(grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo", UserData: userData}})
+		return err
+	}
+	retrieveUserData := func() map[string]string {
+		rep, err := ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{ModelIds: []string{"foo"}})
+		assert.NoError(t, err)
+		assert.Len(t, rep.ModelInfos, 1)
+		return rep.ModelInfos[0].UserData
+	}
+
+	// Without an expected revision, models don't have one
+	assert.NoError(t, createOrUpdateModel("", map[string]string{"team": "a"}))
+	assert.Equal(t, map[string]string{"team": "a"}, retrieveUserData())
+
+	assert.Equal(t, codes.FailedPrecondition, status.Code(createOrUpdateModel("1", map[string]string{"team": "b"})))
+	assert.NoError(t, createOrUpdateModel("0", map[string]string{"team": "b"}))
+	assert.Equal(t, map[string]string{"team": "b", ModelRevisionUserDataKey: "1"}, retrieveUserData())
+
+	// Two clients updating the same retrieved model, the second one is stale
+	retrievedUserData := retrieveUserData()
+	retrievedUserData["team"] = "c"
+	assert.NoError(t, createOrUpdateModel(retrievedUserData[ModelRevisionUserDataKey], retrievedUserData))
+	retrievedUserData["team"] = "d"
+	err = createOrUpdateModel(retrievedUserData[ModelRevisionUserDataKey], retrievedUserData)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, err.Error(), "it is at revision \"2\"")
+	assert.Equal(t, map[string]string{"team": "c", ModelRevisionUserDataKey: "2"}, retrieveUserData())
+
+	// Once defined, the revision is incremented by unconditional updates and can't be changed by the clients
+	assert.NoError(t, createOrUpdateModel("", map[string]string{"team": "e", ModelRevisionUserDataKey: "10"}))
+	assert.Equal(t, map[string]string{"team": "e", ModelRevisionUserDataKey: "3"}, retrieveUserData())
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(createOrUpdateModel("latest", nil)))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(createOrUpdateModel("0", nil)))
+}
+
+func TestCreateModelAndUpdateModel(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	_, err = ctx.extensionsClient.UpdateModel(ctx.grpcCtx, &extensionsapi.UpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo", UserData: map[string]string{"team": "a"}}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	rep, err := ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, rep.ModelInfos, 0)
+
+	_, err = ctx.extensionsClient.CreateModel(ctx.grpcCtx, &extensionsapi.CreateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo", UserData: map[string]string{"team": "a"}}})
+	assert.NoError(t, err)
+	_, err = ctx.extensionsClient.CreateModel(ctx.grpcCtx, &extensionsapi.CreateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo", UserData: map[string]string{"team": "b"}}})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = ctx.extensionsClient.UpdateModel(ctx.grpcCtx, &extensionsapi.UpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo", UserData: map[string]string{"team": "c"}}})
+	assert.NoError(t, err)
+
+	rep, err = ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{ModelIds: []string{"foo"}})
+	assert.NoError(t, err)
+	assert.Len(t, rep.ModelInfos, 1)
+	assert.Equal(t, map[string]string{"team": "c"}, rep.ModelInfos[0].UserData)
+}
+
+func TestCloneModel(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		_, err := ctx.extensionsClient.CloneModel(ctx.grpcCtx, &extensionsapi.CloneModelRequest{SourceModelId: "foo", ModelId: "bar"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo", UserData: map[string]string{"team": "a"}}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "foo", false, modelData)
+	ctx.createVersionWithUserData(t, "foo", true, map[string]string{ParentVersionNumberUserDataKey: "1"}, modelData[:100])
+	ctx.createVersionWithUserData(t, "foo", false, map[string]string{ParentVersionNumberUserDataKey: "2"}, modelData[:10])
+	{
+		_, err := ctx.extensionsClient.LockVersion(ctx.grpcCtx, &extensionsapi.LockVersionRequest{ModelId: "foo", VersionNumber: 3})
+		assert.NoError(t, err)
+		_, err = ctx.extensionsClient.SetVersionAlias(ctx.grpcCtx, &extensionsapi.SetVersionAliasRequest{ModelId: "foo", Alias: "candidate", VersionNumber: 3})
+		assert.NoError(t, err)
+	}
+	{
+		_, err := ctx.extensionsClient.CloneModel(ctx.grpcCtx, &extensionsapi.CloneModelRequest{SourceModelId: "foo", ModelId: "bar", VersionNumbers: []uint32{3, 12}})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		// The selected versions keep their numbers
+		rep, err := ctx.extensionsClient.CloneModel(ctx.grpcCtx, &extensionsapi.CloneModelRequest{SourceModelId: "foo", ModelId: "bar", VersionNumbers: []uint32{3, 2}})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"team": "a"}, rep.ModelInfo.UserData)
+		assert.Len(t, rep.VersionInfos, 2)
+		assert.Equal(t, uint32(2), rep.VersionInfos[0].VersionNumber)
+		assert.True(t, rep.VersionInfos[0].Archived)
+		assert.Equal(t, "1", rep.VersionInfos[0].UserData[ParentVersionNumberUserDataKey])
+		// The parent that isn't cloned remains in the source model
+		assert.Equal(t, "foo", rep.VersionInfos[0].UserData[ParentModelIDUserDataKey])
+		assert.Equal(t, uint32(3), rep.VersionInfos[1].VersionNumber)
+		assert.NotContains(t, rep.VersionInfos[1].UserData, ParentModelIDUserDataKey)
+		assert.NotContains(t, rep.VersionInfos[1].UserData, VersionLockedUserDataKey)
+	}
+	{
+		stream, err := ctx.client.RetrieveVersionData(ctx.grpcCtx, &grpcapi.RetrieveVersionDataRequest{ModelId: "bar", VersionNumber: 2})
+		assert.NoError(t, err)
+		data := []byte{}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			data = append(data, chunk.DataChunk...)
+		}
+		assert.Equal(t, modelData[:100], data)
+	}
+	{
+		// The aliases aren't cloned
+		rep, err := ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{ModelIds: []string{"bar"}})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"team": "a"}, rep.ModelInfos[0].UserData)
+	}
+	{
+		_, err := ctx.extensionsClient.CloneModel(ctx.grpcCtx, &extensionsapi.CloneModelRequest{SourceModelId: "foo", ModelId: "bar"})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	}
+	{
+		rep, err := ctx.extensionsClient.CloneModel(ctx.grpcCtx, &extensionsapi.CloneModelRequest{SourceModelId: "foo", ModelId: "baz"})
+		assert.NoError(t, err)
+		assert.Len(t, rep.VersionInfos, 3)
+		// New versions follow the cloned ones
+		created := ctx.createVersion(t, "baz", false, modelData)
+		assert.Equal(t, uint32(4), created.VersionNumber)
+	}
+}
+
 func TestCreateVersion(t *testing.T) {
 
 	modelUserData := make(map[string]string)
@@ -280,7 +715,7 @@ func TestCreateVersion(t *testing.T) {
 	{
 		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "foo"})
 		assert.NoError(t, err)
-		assert.Equal(t, "3", rep.NextVersionHandle)
+		assert.Equal(t, ctx.versionsHandle("foo", 3), rep.NextVersionHandle)
 		assert.Len(t, rep.VersionInfos, 2)
 		assert.Equal(t, "foo", rep.VersionInfos[0].ModelId)
 		assert.Equal(t, 1, int(rep.VersionInfos[0].VersionNumber))
@@ -294,6 +729,98 @@ func TestCreateVersion(t *testing.T) {
 	}
 }
 
+func TestCreateVersionInvalidData(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+		assert.NoError(t, err)
+	}
+	{
+		// Mismatching hash
+		stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{
+			Msg: &grpcapi.CreateVersionRequestChunk_Header_{
+				Header: &grpcapi.CreateVersionRequestChunk_Header{
+					VersionInfo: &grpcapi.ModelVersionInfo{
+						ModelId:  "foo",
+						Archived: true,
+						DataHash: backend.ComputeSHA256Hash(modelData[:20]),
+						DataSize: uint64(len(modelData)),
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{
+			Msg: &grpcapi.CreateVersionRequestChunk_Body_{
+				Body: &grpcapi.CreateVersionRequestChunk_Body{
+					DataChunk: modelData,
+				},
+			},
+		})
+		assert.NoError(t, err)
+		rep, err := stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Nil(t, rep)
+	}
+	{
+		// Missing data
+		stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{
+			Msg: &grpcapi.CreateVersionRequestChunk_Header_{
+				Header: &grpcapi.CreateVersionRequestChunk_Header{
+					VersionInfo: &grpcapi.ModelVersionInfo{
+						ModelId:  "foo",
+						Archived: false,
+						DataSize: uint64(len(modelData)),
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{
+			Msg: &grpcapi.CreateVersionRequestChunk_Body_{
+				Body: &grpcapi.CreateVersionRequestChunk_Body{
+					DataChunk: modelData[:20],
+				},
+			},
+		})
+		assert.NoError(t, err)
+		rep, err := stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Nil(t, rep)
+	}
+	{
+		// Unknown model
+		stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{
+			Msg: &grpcapi.CreateVersionRequestChunk_Header_{
+				Header: &grpcapi.CreateVersionRequestChunk_Header{
+					VersionInfo: &grpcapi.ModelVersionInfo{
+						ModelId:  "bar",
+						Archived: true,
+						DataSize: uint64(len(modelData)),
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		rep, err := stream.CloseAndRecv()
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		assert.Nil(t, rep)
+	}
+	{
+		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "foo"})
+		assert.NoError(t, err)
+		assert.Len(t, rep.VersionInfos, 0)
+	}
+}
+
 func TestRetrieveVersionInfosAll(t *testing.T) {
 	modelUserData := make(map[string]string)
 	modelUserData["model_test1"] = "model_test1"
@@ -345,7 +872,7 @@ func TestRetrieveVersionInfosAll(t *testing.T) {
 		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "bar", VersionsCount: 5})
 		assert.NoError(t, err)
 
-		assert.Equal(t, "6", rep.NextVersionHandle)
+		assert.Equal(t, ctx.versionsHandle("bar", 6), rep.NextVersionHandle)
 		assert.Len(t, rep.VersionInfos, 5)
 
 		assert.Equal(t, "bar", rep.VersionInfos[0].ModelId)
@@ -361,10 +888,10 @@ func TestRetrieveVersionInfosAll(t *testing.T) {
 		assert.GreaterOrEqual(t, rep.VersionInfos[4].CreationTimestamp, rep.VersionInfos[0].CreationTimestamp)
 	}
 	{
-		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "bar", VersionsCount: 5, VersionHandle: "7"})
+		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "bar", VersionsCount: 5, VersionHandle: ctx.versionsHandle("bar", 7)})
 		assert.NoError(t, err)
 
-		assert.Equal(t, "11", rep.NextVersionHandle)
+		assert.Equal(t, ctx.versionsHandle("bar", 11), rep.NextVersionHandle)
 		assert.Len(t, rep.VersionInfos, 4)
 
 		assert.Equal(t, "bar", rep.VersionInfos[0].ModelId)
@@ -380,10 +907,10 @@ func TestRetrieveVersionInfosAll(t *testing.T) {
 		assert.GreaterOrEqual(t, rep.VersionInfos[3].CreationTimestamp, rep.VersionInfos[0].CreationTimestamp)
 	}
 	{
-		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "bar", VersionsCount: 5, VersionHandle: "11"})
+		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "bar", VersionsCount: 5, VersionHandle: ctx.versionsHandle("bar", 11)})
 		assert.NoError(t, err)
 
-		assert.Equal(t, "11", rep.NextVersionHandle)
+		assert.Equal(t, ctx.versionsHandle("bar", 11), rep.NextVersionHandle)
 		assert.Len(t, rep.VersionInfos, 0)
 	}
 }
@@ -520,7 +1047,7 @@ func TestRetrieveVersionInfosSome(t *testing.T) {
 		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "bar", VersionNumbers: []int32{1}})
 		assert.NoError(t, err)
 		assert.Len(t, rep.VersionInfos, 1)
-		assert.Equal(t, "2", rep.NextVersionHandle)
+		assert.Equal(t, ctx.paginationCodec.Encode(versionNumbersPaginationScope("bar"), pagination.Cursor{Offset: 1}), rep.NextVersionHandle)
 
 		assert.Equal(t, "bar", rep.VersionInfos[0].ModelId)
 		assert.Equal(t, 1, int(rep.VersionInfos[0].VersionNumber))
@@ -532,7 +1059,7 @@ func TestRetrieveVersionInfosSome(t *testing.T) {
 		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "bar", VersionNumbers: []int32{5}})
 		assert.NoError(t, err)
 		assert.Len(t, rep.VersionInfos, 1)
-		assert.Equal(t, "6", rep.NextVersionHandle)
+		assert.Equal(t, ctx.paginationCodec.Encode(versionNumbersPaginationScope("bar"), pagination.Cursor{Offset: 1}), rep.NextVersionHandle)
 
 		assert.Equal(t, "bar", rep.VersionInfos[0].ModelId)
 		assert.Equal(t, 5, int(rep.VersionInfos[0].VersionNumber))
@@ -544,7 +1071,7 @@ func TestRetrieveVersionInfosSome(t *testing.T) {
 		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "bar", VersionNumbers: []int32{-1}})
 		assert.NoError(t, err)
 		assert.Len(t, rep.VersionInfos, 1)
-		assert.Equal(t, "11", rep.NextVersionHandle)
+		assert.Equal(t, ctx.paginationCodec.Encode(versionNumbersPaginationScope("bar"), pagination.Cursor{Offset: 1}), rep.NextVersionHandle)
 
 		assert.Equal(t, "bar", rep.VersionInfos[0].ModelId)
 		assert.Equal(t, 10, int(rep.VersionInfos[0].VersionNumber))
@@ -634,3 +1161,3368 @@ func TestGetModelVersionData(t *testing.T) {
 		assert.Nil(t, chunk)
 	}
 }
+
+func TestRetrieveLatestVersion(t *testing.T) {
+	ctx, err := createContext(t, 16) // For the purpose of the test we limit the sent chunk size drastically
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "baz"}})
+		assert.NoError(t, err)
+	}
+	{
+		stream, err := ctx.extensionsClient.RetrieveLatestVersion(ctx.grpcCtx, &extensionsapi.RetrieveLatestVersionRequest{ModelId: "baz"})
+		assert.NoError(t, err)
+		chunk, err := stream.Recv()
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		assert.Nil(t, chunk)
+	}
+	for _, data := range [][]byte{[]byte("first version"), modelData} {
+		stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{
+			Msg: &grpcapi.CreateVersionRequestChunk_Header_{
+				Header: &grpcapi.CreateVersionRequestChunk_Header{
+					VersionInfo: &grpcapi.ModelVersionInfo{
+						ModelId:  "baz",
+						DataHash: backend.ComputeSHA256Hash(data),
+						DataSize: uint64(len(data)),
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{
+			DataChunk: data,
+		}}})
+		assert.NoError(t, err)
+		_, err = stream.CloseAndRecv()
+		assert.NoError(t, err)
+	}
+	{
+		stream, err := ctx.extensionsClient.RetrieveLatestVersion(ctx.grpcCtx, &extensionsapi.RetrieveLatestVersionRequest{ModelId: "baz"})
+		assert.NoError(t, err)
+		chunk, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.NotNil(t, chunk.GetHeader())
+		versionInfo := chunk.GetHeader().VersionInfo
+		assert.Equal(t, "baz", versionInfo.ModelId)
+		assert.Equal(t, 2, int(versionInfo.VersionNumber))
+		assert.Equal(t, backend.ComputeSHA256Hash(modelData), versionInfo.DataHash)
+		assert.Equal(t, len(modelData), int(versionInfo.DataSize))
+		data := []byte{}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, chunk.GetBody())
+			assert.GreaterOrEqual(t, 16, len(chunk.GetBody().DataChunk))
+			data = append(data, chunk.GetBody().DataChunk...)
+		}
+		assert.Equal(t, modelData, data)
+	}
+	{
+		stream, err := ctx.extensionsClient.RetrieveLatestVersion(ctx.grpcCtx, &extensionsapi.RetrieveLatestVersionRequest{ModelId: "unknown"})
+		assert.NoError(t, err)
+		chunk, err := stream.Recv()
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		assert.Nil(t, chunk)
+	}
+}
+
+func TestWatchVersions(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		stream, err := ctx.extensionsClient.WatchVersions(ctx.grpcCtx, &extensionsapi.WatchVersionsRequest{ModelId: "foo"})
+		assert.NoError(t, err)
+		rep, err := stream.Recv()
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		assert.Nil(t, rep)
+	}
+	{
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+		assert.NoError(t, err)
+	}
+	stream, err := ctx.extensionsClient.WatchVersions(ctx.grpcCtx, &extensionsapi.WatchVersionsRequest{ModelId: "foo"})
+	assert.NoError(t, err)
+	_, err = stream.Header()
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		versionStream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = versionStream.Send(&grpcapi.CreateVersionRequestChunk{
+			Msg: &grpcapi.CreateVersionRequestChunk_Header_{
+				Header: &grpcapi.CreateVersionRequestChunk_Header{
+					VersionInfo: &grpcapi.ModelVersionInfo{
+						ModelId:  "foo",
+						Archived: i%2 == 0,
+						DataHash: backend.ComputeSHA256Hash(modelData),
+						DataSize: uint64(len(modelData)),
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = versionStream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{
+			DataChunk: modelData,
+		}}})
+		assert.NoError(t, err)
+		_, err = versionStream.CloseAndRecv()
+		assert.NoError(t, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		rep, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, "foo", rep.VersionInfo.ModelId)
+		assert.Equal(t, i+1, int(rep.VersionInfo.VersionNumber))
+		assert.Equal(t, i%2 == 0, rep.VersionInfo.Archived)
+		assert.Equal(t, backend.ComputeSHA256Hash(modelData), rep.VersionInfo.DataHash)
+	}
+
+	{
+		_, err := ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "foo"})
+		assert.NoError(t, err)
+	}
+	rep, err := stream.Recv()
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, rep)
+}
+
+func TestWatchModels(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	allStream, err := ctx.extensionsClient.WatchModels(ctx.grpcCtx, &extensionsapi.WatchModelsRequest{})
+	assert.NoError(t, err)
+	_, err = allStream.Header()
+	assert.NoError(t, err)
+
+	filteredStream, err := ctx.extensionsClient.WatchModels(ctx.grpcCtx, &extensionsapi.WatchModelsRequest{ModelIdPrefix: "policy_", UserDataKeys: []string{"env"}})
+	assert.NoError(t, err)
+	_, err = filteredStream.Header()
+	assert.NoError(t, err)
+
+	for _, modelInfo := range []*grpcapi.ModelInfo{
+		{ModelId: "policy_a", UserData: map[string]string{"env": "cartpole"}},
+		{ModelId: "policy_b"},
+		{ModelId: "value_a", UserData: map[string]string{"env": "cartpole"}},
+		{ModelId: "policy_a", UserData: map[string]string{"env": "pendulum"}},
+	} {
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: modelInfo})
+		assert.NoError(t, err)
+	}
+	{
+		_, err := ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "policy_a"})
+		assert.NoError(t, err)
+	}
+
+	type event struct {
+		eventType extensionsapi.ModelEventType
+		modelID   string
+		env       string
+	}
+
+	expectedAllEvents := []event{
+		{extensionsapi.ModelEventType_MODEL_CREATED, "policy_a", "cartpole"},
+		{extensionsapi.ModelEventType_MODEL_CREATED, "policy_b", ""},
+		{extensionsapi.ModelEventType_MODEL_CREATED, "value_a", "cartpole"},
+		{extensionsapi.ModelEventType_MODEL_UPDATED, "policy_a", "pendulum"},
+		{extensionsapi.ModelEventType_MODEL_DELETED, "policy_a", "pendulum"},
+	}
+	for _, expectedEvent := range expectedAllEvents {
+		rep, err := allStream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, expectedEvent, event{rep.EventType, rep.ModelInfo.ModelId, rep.ModelInfo.UserData["env"]})
+	}
+
+	expectedFilteredEvents := []event{
+		{extensionsapi.ModelEventType_MODEL_CREATED, "policy_a", "cartpole"},
+		{extensionsapi.ModelEventType_MODEL_UPDATED, "policy_a", "pendulum"},
+		{extensionsapi.ModelEventType_MODEL_DELETED, "policy_a", "pendulum"},
+	}
+	for _, expectedEvent := range expectedFilteredEvents {
+		rep, err := filteredStream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, expectedEvent, event{rep.EventType, rep.ModelInfo.ModelId, rep.ModelInfo.UserData["env"]})
+	}
+}
+
+func (ctx *testContext) createVersion(t *testing.T, modelID string, archived bool, data []byte) *grpcapi.ModelVersionInfo {
+	return ctx.createVersionWithUserData(t, modelID, archived, nil, data)
+}
+
+func (ctx *testContext) createVersionWithUserData(t *testing.T, modelID string, archived bool, userData map[string]string, data []byte) *grpcapi.ModelVersionInfo {
+	stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+	assert.NoError(t, err)
+	err = stream.Send(&grpcapi.CreateVersionRequestChunk{
+		Msg: &grpcapi.CreateVersionRequestChunk_Header_{
+			Header: &grpcapi.CreateVersionRequestChunk_Header{
+				VersionInfo: &grpcapi.ModelVersionInfo{
+					ModelId:  modelID,
+					Archived: archived,
+					DataHash: backend.ComputeSHA256Hash(data),
+					DataSize: uint64(len(data)),
+					UserData: userData,
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{
+		DataChunk: data,
+	}}})
+	assert.NoError(t, err)
+	rep, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	return rep.VersionInfo
+}
+
+func TestDeleteVersion(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 1})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "foo", true, modelData)
+	ctx.createVersion(t, "foo", false, modelData)
+	ctx.createVersion(t, "foo", false, modelData)
+	{
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 12})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		rep, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: -1})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, int(rep.VersionInfo.VersionNumber))
+	}
+	{
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 1})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	{
+		rep, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 1, Force: true})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, int(rep.VersionInfo.VersionNumber))
+		assert.True(t, rep.VersionInfo.Archived)
+	}
+	{
+		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "foo"})
+		assert.NoError(t, err)
+		assert.Len(t, rep.VersionInfos, 1)
+		assert.Equal(t, 2, int(rep.VersionInfos[0].VersionNumber))
+	}
+}
+
+func TestArchiveVersion(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		_, err := ctx.extensionsClient.ArchiveVersion(ctx.grpcCtx, &extensionsapi.ArchiveVersionRequest{ModelId: "foo", VersionNumber: 1})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "foo", false, modelData)
+	ctx.createVersion(t, "foo", false, modelData)
+	{
+		_, err := ctx.extensionsClient.UnarchiveVersion(ctx.grpcCtx, &extensionsapi.UnarchiveVersionRequest{ModelId: "foo", VersionNumber: 12})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		rep, err := ctx.extensionsClient.ArchiveVersion(ctx.grpcCtx, &extensionsapi.ArchiveVersionRequest{ModelId: "foo", VersionNumber: -1})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, int(rep.VersionInfo.VersionNumber))
+		assert.True(t, rep.VersionInfo.Archived)
+	}
+	{
+		// Archived versions are only deleted when forced
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 2})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	{
+		rep, err := ctx.extensionsClient.UnarchiveVersion(ctx.grpcCtx, &extensionsapi.UnarchiveVersionRequest{ModelId: "foo", VersionNumber: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, int(rep.VersionInfo.VersionNumber))
+		assert.False(t, rep.VersionInfo.Archived)
+	}
+	{
+		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "foo"})
+		assert.NoError(t, err)
+		assert.Len(t, rep.VersionInfos, 2)
+		assert.False(t, rep.VersionInfos[0].Archived)
+		assert.False(t, rep.VersionInfos[1].Archived)
+	}
+	{
+		stream, err := ctx.client.RetrieveVersionData(ctx.grpcCtx, &grpcapi.RetrieveVersionDataRequest{ModelId: "foo", VersionNumber: 2})
+		assert.NoError(t, err)
+		data := []byte{}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			data = append(data, chunk.DataChunk...)
+		}
+		assert.Equal(t, modelData, data)
+	}
+}
+
+func TestLockVersion(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		_, err := ctx.extensionsClient.LockVersion(ctx.grpcCtx, &extensionsapi.LockVersionRequest{ModelId: "foo", VersionNumber: 1})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "foo", true, modelData)
+	ctx.createVersion(t, "foo", false, modelData)
+	{
+		rep, err := ctx.extensionsClient.LockVersion(ctx.grpcCtx, &extensionsapi.LockVersionRequest{ModelId: "foo", VersionNumber: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, "true", rep.VersionInfo.UserData[VersionLockedUserDataKey])
+	}
+	{
+		// Locking again doesn't change the version
+		rep, err := ctx.extensionsClient.LockVersion(ctx.grpcCtx, &extensionsapi.LockVersionRequest{ModelId: "foo", VersionNumber: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, "true", rep.VersionInfo.UserData[VersionLockedUserDataKey])
+	}
+	{
+		// Locked versions are never deleted, even when forced
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 1, Force: true})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		details := status.Convert(err).Details()
+		assert.Len(t, details, 1)
+		assert.Equal(t, extensionsapi.ErrorReason_VERSION_LOCKED, details[0].(*extensionsapi.ErrorDetails).Reason)
+		assert.Equal(t, map[string]string{"model_id": "foo", "version_number": "1"}, details[0].(*extensionsapi.ErrorDetails).Metadata)
+	}
+	{
+		_, err := ctx.extensionsClient.UnarchiveVersion(ctx.grpcCtx, &extensionsapi.UnarchiveVersionRequest{ModelId: "foo", VersionNumber: 1})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	{
+		_, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, Description: "deployed"})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	{
+		// The lock is only changed by LockVersion and UnlockVersion
+		_, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 2, UserData: map[string]string{VersionLockedUserDataKey: "true"}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		_, err := ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "foo"})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	{
+		// The other versions are unaffected
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 2})
+		assert.NoError(t, err)
+	}
+	{
+		rep, err := ctx.extensionsClient.UnlockVersion(ctx.grpcCtx, &extensionsapi.UnlockVersionRequest{ModelId: "foo", VersionNumber: -1})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, int(rep.VersionInfo.VersionNumber))
+		assert.NotContains(t, rep.VersionInfo.UserData, VersionLockedUserDataKey)
+	}
+	{
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 1, Force: true})
+		assert.NoError(t, err)
+	}
+	{
+		_, err := ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "foo"})
+		assert.NoError(t, err)
+	}
+}
+
+func TestVersionLeases(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	now := time.Now()
+	ctx.registryServer.versionLeases.now = func() time.Time { return now }
+	{
+		_, err := ctx.extensionsClient.AcquireVersionLease(ctx.grpcCtx, &extensionsapi.AcquireVersionLeaseRequest{ModelId: "foo", VersionNumber: 1, Holder: "orchestrator_x"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "foo", false, modelData)
+	ctx.createVersion(t, "foo", false, modelData)
+	{
+		_, err := ctx.extensionsClient.AcquireVersionLease(ctx.grpcCtx, &extensionsapi.AcquireVersionLeaseRequest{ModelId: "foo", VersionNumber: 1})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	var leaseID string
+	{
+		rep, err := ctx.extensionsClient.AcquireVersionLease(ctx.grpcCtx, &extensionsapi.AcquireVersionLeaseRequest{ModelId: "foo", VersionNumber: -2, Holder: "orchestrator_x"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, int(rep.VersionInfo.VersionNumber))
+		assert.Equal(t, 1, int(rep.Lease.VersionNumber))
+		assert.Equal(t, uint64(now.Add(defaultVersionLeaseTTL).UnixNano()), rep.Lease.ExpirationTimestamp)
+		assert.NotEmpty(t, rep.Lease.LeaseId)
+		leaseID = rep.Lease.LeaseId
+	}
+	{
+		// Acquiring again renews the lease of the holder
+		now = now.Add(time.Second)
+		rep, err := ctx.extensionsClient.AcquireVersionLease(ctx.grpcCtx, &extensionsapi.AcquireVersionLeaseRequest{ModelId: "foo", VersionNumber: 1, Holder: "orchestrator_x"})
+		assert.NoError(t, err)
+		assert.Equal(t, leaseID, rep.Lease.LeaseId)
+		assert.Equal(t, uint64(now.Add(defaultVersionLeaseTTL).UnixNano()), rep.Lease.ExpirationTimestamp)
+	}
+	{
+		_, err := ctx.extensionsClient.AcquireVersionLease(ctx.grpcCtx, &extensionsapi.AcquireVersionLeaseRequest{ModelId: "foo", VersionNumber: 1, Holder: "orchestrator_y"})
+		assert.NoError(t, err)
+	}
+	{
+		rep, err := ctx.extensionsClient.ListVersionLeases(ctx.grpcCtx, &extensionsapi.ListVersionLeasesRequest{ModelId: "foo"})
+		assert.NoError(t, err)
+		assert.Len(t, rep.Leases, 2)
+		assert.Equal(t, "orchestrator_x", rep.Leases[0].Holder)
+		assert.Equal(t, "orchestrator_y", rep.Leases[1].Holder)
+		assert.Empty(t, rep.Leases[0].LeaseId)
+	}
+	{
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 1})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		details := status.Convert(err).Details()
+		assert.Len(t, details, 1)
+		assert.Equal(t, extensionsapi.ErrorReason_VERSION_LEASED, details[0].(*extensionsapi.ErrorDetails).Reason)
+		assert.Equal(t, map[string]string{"model_id": "foo", "version_number": "1", "holders": "orchestrator_x,orchestrator_y"}, details[0].(*extensionsapi.ErrorDetails).Metadata)
+	}
+	{
+		_, err := ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "foo"})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	assert.True(t, ctx.registryServer.IsVersionLeased("foo", 1))
+	assert.False(t, ctx.registryServer.IsVersionLeased("foo", 2))
+	{
+		// Heartbeats postpone the expiration
+		now = now.Add(defaultVersionLeaseTTL / 2)
+		rep, err := ctx.extensionsClient.RenewVersionLease(ctx.grpcCtx, &extensionsapi.RenewVersionLeaseRequest{LeaseId: leaseID})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(now.Add(defaultVersionLeaseTTL).UnixNano()), rep.Lease.ExpirationTimestamp)
+	}
+	{
+		// Only the lease that wasn't renewed expired
+		now = now.Add(defaultVersionLeaseTTL * 3 / 4)
+		rep, err := ctx.extensionsClient.ListVersionLeases(ctx.grpcCtx, &extensionsapi.ListVersionLeasesRequest{ModelId: "foo", VersionNumber: 1})
+		assert.NoError(t, err)
+		assert.Len(t, rep.Leases, 1)
+		assert.Equal(t, "orchestrator_x", rep.Leases[0].Holder)
+	}
+	{
+		_, err := ctx.extensionsClient.ReleaseVersionLease(ctx.grpcCtx, &extensionsapi.ReleaseVersionLeaseRequest{LeaseId: leaseID})
+		assert.NoError(t, err)
+		_, err = ctx.extensionsClient.RenewVersionLease(ctx.grpcCtx, &extensionsapi.RenewVersionLeaseRequest{LeaseId: leaseID})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		_, err = ctx.extensionsClient.ReleaseVersionLease(ctx.grpcCtx, &extensionsapi.ReleaseVersionLeaseRequest{LeaseId: leaseID})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 1})
+		assert.NoError(t, err)
+	}
+	{
+		// Leased versions are deleted when forced, along with their leases
+		_, err := ctx.extensionsClient.AcquireVersionLease(ctx.grpcCtx, &extensionsapi.AcquireVersionLeaseRequest{ModelId: "foo", VersionNumber: 2, Holder: "orchestrator_x"})
+		assert.NoError(t, err)
+		_, err = ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 2, Force: true})
+		assert.NoError(t, err)
+		assert.False(t, ctx.registryServer.IsVersionLeased("foo", 2))
+	}
+	{
+		_, err := ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "foo"})
+		assert.NoError(t, err)
+	}
+}
+
+func TestUpdateVersionInfo(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		_, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, Description: "Baseline"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "foo", true, modelData)
+	{
+		_, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, Description: "Baseline", ClearDescription: true})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		_, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, UserData: map[string]string{"reward": "0.5"}, RemovedUserDataKeys: []string{"reward"}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		rep, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: -1, Description: "Baseline", UserData: map[string]string{"reward": "0.5", "episodes": "100"}})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, int(rep.VersionInfo.VersionNumber))
+		assert.True(t, rep.VersionInfo.Archived)
+		assert.Equal(t, map[string]string{DescriptionUserDataKey: "Baseline", "reward": "0.5", "episodes": "100"}, rep.VersionInfo.UserData)
+	}
+	{
+		// Entries that aren't mentioned are kept
+		rep, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, ClearDescription: true, UserData: map[string]string{"reward": "0.7"}, RemovedUserDataKeys: []string{"episodes"}})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"reward": "0.7"}, rep.VersionInfo.UserData)
+	}
+	{
+		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "foo", VersionNumbers: []int32{1}})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"reward": "0.7"}, rep.VersionInfos[0].UserData)
+		assert.Equal(t, backend.ComputeSHA256Hash(modelData), rep.VersionInfos[0].DataHash)
+	}
+	{
+		_, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, Archive: true, Unarchive: true})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		// An update without changes retrieves the current etag
+		rep, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1})
+		assert.NoError(t, err)
+		etag := rep.Etag
+		assert.NotEmpty(t, etag)
+
+		rep, err = ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, Unarchive: true, UserData: map[string]string{"reward": "0.8"}, ExpectedEtag: etag})
+		assert.NoError(t, err)
+		assert.False(t, rep.VersionInfo.Archived)
+		assert.Equal(t, map[string]string{"reward": "0.8"}, rep.VersionInfo.UserData)
+		assert.NotEqual(t, etag, rep.Etag)
+
+		// A concurrent writer using the previous etag is rejected and the version is left unchanged
+		_, err = ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, UserData: map[string]string{"reward": "0.9"}, ExpectedEtag: etag})
+		assert.Equal(t, codes.Aborted, status.Code(err))
+
+		// Archiving with ArchiveVersion changes the etag as well
+		newEtag := rep.Etag
+		_, err = ctx.extensionsClient.ArchiveVersion(ctx.grpcCtx, &extensionsapi.ArchiveVersionRequest{ModelId: "foo", VersionNumber: 1})
+		assert.NoError(t, err)
+		_, err = ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, ExpectedEtag: newEtag})
+		assert.Equal(t, codes.Aborted, status.Code(err))
+	}
+	{
+		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "foo", VersionNumbers: []int32{1}})
+		assert.NoError(t, err)
+		assert.True(t, rep.VersionInfos[0].Archived)
+		assert.Equal(t, map[string]string{"reward": "0.8"}, rep.VersionInfos[0].UserData)
+	}
+}
+
+func TestReservedVersionUserData(t *testing.T) {
+	ctx, err := createContext(t, 16)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	for _, userData := range []map[string]string{
+		{"cogment_model_registry.encryption_key_id": "k1"},
+		{"cogment_model_registry.compression": "gzip"},
+		{VersionLockedUserDataKey: "true"},
+		{VersionAliasUserDataKeyPrefix + "best": "1"},
+	} {
+		_, err := ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData)), UserData: userData}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), userData)
+
+		stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Header_{Header: &grpcapi.CreateVersionRequestChunk_Header{
+			VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData)), UserData: userData},
+		}}})
+		assert.NoError(t, err)
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), userData)
+
+		_, err = ctx.registryServer.PublishVersion(ctx.grpcCtx, "foo", PublishedVersionArgs{UserData: userData}, bytes.NewReader(modelData))
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), userData)
+	}
+
+	// The documented entries can be set when creating a version
+	versionInfo := ctx.createVersionWithUserData(t, "foo", false, map[string]string{
+		DescriptionUserDataKey:                     "Baseline",
+		VersionLineageUserDataKeyPrefix + "run_id": "run_1",
+		VersionMetricUserDataKeyPrefix + "reward":  "0.5",
+	}, modelData)
+	assert.Equal(t, uint32(1), versionInfo.VersionNumber)
+
+	// The imported versions keep their lock but can't define the other reserved entries
+	_, err = ctx.extensionsClient.LockVersion(ctx.grpcCtx, &extensionsapi.LockVersionRequest{ModelId: "foo", VersionNumber: 1})
+	assert.NoError(t, err)
+	_, err = ctx.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "bar"})
+	assert.NoError(t, err)
+	_, err = ctx.backend.CreateOrUpdateModelVersion("bar", backend.VersionArgs{
+		DataHash: backend.ComputeSHA256Hash(modelData),
+		Data:     modelData,
+		UserData: map[string]string{"cogment_model_registry.encryption_key_id": "k1"},
+	})
+	assert.NoError(t, err)
+	for modelID, expectedCode := range map[string]codes.Code{"foo": codes.OK, "bar": codes.InvalidArgument} {
+		archive, err := ctx.exportRegistry(t, []string{modelID})
+		assert.NoError(t, err)
+		assert.NoError(t, ctx.backend.DeleteModel(modelID))
+		_, err = ctx.importRegistry(t, archive)
+		assert.Equal(t, expectedCode, status.Code(err), modelID)
+	}
+}
+
+func TestRetrieveLineage(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	for _, modelID := range []string{"pretrained", "foo"} {
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "pretrained", true, modelData)
+	ctx.createVersionWithUserData(t, "foo", false, map[string]string{ParentModelIDUserDataKey: "pretrained", ParentVersionNumberUserDataKey: "1", RunIDUserDataKey: "run-1"}, modelData)
+	ctx.createVersionWithUserData(t, "foo", false, map[string]string{ParentVersionNumberUserDataKey: "1", RunIDUserDataKey: "run-2", TrialIDUserDataKey: "trial-3"}, modelData)
+	ctx.createVersionWithUserData(t, "foo", false, map[string]string{ParentVersionNumberUserDataKey: "2"}, modelData)
+
+	for _, userData := range []map[string]string{
+		{ParentVersionNumberUserDataKey: "0"},
+		{ParentVersionNumberUserDataKey: "two"},
+		{ParentModelIDUserDataKey: "pretrained"},
+		{VersionLineageUserDataKeyPrefix + "experiment": "a"},
+	} {
+		_, err := ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData)), UserData: userData}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), userData)
+	}
+	{
+		_, err := ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData)), UserData: map[string]string{ParentVersionNumberUserDataKey: "12"}}})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	{
+		// The lineage can't be changed once the version is created
+		_, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 3, RemovedUserDataKeys: []string{ParentVersionNumberUserDataKey}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		rep, err := ctx.extensionsClient.RetrieveLineage(ctx.grpcCtx, &extensionsapi.RetrieveLineageRequest{ModelId: "foo", VersionNumber: -1})
+		assert.NoError(t, err)
+		assert.Len(t, rep.Ancestors, 3)
+		for index, versionNumber := range []uint32{3, 2, 1} {
+			assert.Equal(t, versionNumber, rep.Ancestors[index].VersionInfo.VersionNumber)
+		}
+		assert.Equal(t, &extensionsapi.VersionLineage{ParentModelId: "foo", ParentVersionNumber: 1, RunId: "run-2", TrialId: "trial-3"}, rep.Ancestors[1].Lineage)
+		// The ancestry continues in another model
+		assert.Equal(t, "pretrained", rep.Ancestors[2].Lineage.ParentModelId)
+		assert.Equal(t, uint32(1), rep.Ancestors[2].Lineage.ParentVersionNumber)
+	}
+	{
+		rep, err := ctx.extensionsClient.RetrieveLineage(ctx.grpcCtx, &extensionsapi.RetrieveLineageRequest{ModelId: "foo", VersionNumber: 3, MaxDepth: 2})
+		assert.NoError(t, err)
+		assert.Len(t, rep.Ancestors, 2)
+	}
+	{
+		// A deleted parent ends the ancestry
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 2})
+		assert.NoError(t, err)
+		rep, err := ctx.extensionsClient.RetrieveLineage(ctx.grpcCtx, &extensionsapi.RetrieveLineageRequest{ModelId: "foo", VersionNumber: 3})
+		assert.NoError(t, err)
+		assert.Len(t, rep.Ancestors, 1)
+		assert.Equal(t, uint32(2), rep.Ancestors[0].Lineage.ParentVersionNumber)
+	}
+	{
+		_, err := ctx.extensionsClient.RetrieveLineage(ctx.grpcCtx, &extensionsapi.RetrieveLineageRequest{ModelId: "foo", VersionNumber: 12})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+}
+
+func TestVersionDependencies(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	for _, modelID := range []string{"world_model", "policy", "evaluator"} {
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "world_model", false, modelData)
+	ctx.createVersion(t, "world_model", false, modelData)
+	ctx.createVersionWithUserData(t, "policy", false, map[string]string{VersionDependencyUserDataKeyPrefix + "world_model": "1"}, modelData)
+	ctx.createVersionWithUserData(t, "evaluator", false, map[string]string{VersionDependencyUserDataKeyPrefix + "policy": "1", VersionDependencyUserDataKeyPrefix + "world_model": "1"}, modelData)
+
+	for _, userData := range []map[string]string{
+		{VersionDependencyUserDataKeyPrefix: "1"},
+		{VersionDependencyUserDataKeyPrefix + "world_model": "0"},
+		{VersionDependencyUserDataKeyPrefix + "world_model": "latest"},
+	} {
+		_, err := ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "policy", DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData)), UserData: userData}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), userData)
+	}
+	{
+		// Dependencies need to exist
+		_, err := ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "policy", DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData)), UserData: map[string]string{VersionDependencyUserDataKeyPrefix + "world_model": "12"}}})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	{
+		// The dependencies can't be changed once the version is created
+		_, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "policy", VersionNumber: 1, UserData: map[string]string{VersionDependencyUserDataKeyPrefix + "world_model": "2"}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		rep, err := ctx.extensionsClient.RetrieveDependencyGraph(ctx.grpcCtx, &extensionsapi.RetrieveDependencyGraphRequest{ModelId: "evaluator", VersionNumber: -1})
+		assert.NoError(t, err)
+		assert.Len(t, rep.Versions, 3)
+		assert.Equal(t, "evaluator", rep.Versions[0].ModelId)
+		assert.Len(t, rep.Edges, 3)
+		assert.Equal(t, &extensionsapi.VersionReference{ModelId: "evaluator", VersionNumber: 1}, rep.Edges[0].Dependent)
+		assert.Equal(t, &extensionsapi.VersionReference{ModelId: "policy", VersionNumber: 1}, rep.Edges[0].Dependency)
+	}
+	{
+		rep, err := ctx.extensionsClient.RetrieveDependencyGraph(ctx.grpcCtx, &extensionsapi.RetrieveDependencyGraphRequest{ModelId: "world_model", VersionNumber: 1, IncludeDependents: true})
+		assert.NoError(t, err)
+		assert.Len(t, rep.Versions, 3)
+		assert.Len(t, rep.Edges, 3)
+	}
+	{
+		rep, err := ctx.extensionsClient.RetrieveDependencyGraph(ctx.grpcCtx, &extensionsapi.RetrieveDependencyGraphRequest{ModelId: "world_model", VersionNumber: 2, IncludeDependents: true})
+		assert.NoError(t, err)
+		assert.Len(t, rep.Versions, 1)
+		assert.Len(t, rep.Edges, 0)
+	}
+	{
+		_, err := ctx.extensionsClient.RetrieveDependencyGraph(ctx.grpcCtx, &extensionsapi.RetrieveDependencyGraphRequest{ModelId: "world_model", VersionNumber: 12})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	assert.True(t, ctx.registryServer.IsVersionInUse("world_model", 1))
+	assert.False(t, ctx.registryServer.IsVersionInUse("world_model", 2))
+	{
+		// Depended upon versions and their models aren't deleted
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "world_model", VersionNumber: 1})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		details := status.Convert(err).Details()
+		assert.Len(t, details, 1)
+		assert.Equal(t, extensionsapi.ErrorReason_VERSION_DEPENDED_UPON, details[0].(*extensionsapi.ErrorDetails).Reason)
+		assert.Equal(t, "1", details[0].(*extensionsapi.ErrorDetails).Metadata["version_number"])
+		_, err = ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "world_model"})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	{
+		// Versions that aren't depended upon are deleted
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "world_model", VersionNumber: 2})
+		assert.NoError(t, err)
+	}
+	{
+		// Every dependent is checked before deleting anything
+		_, err := ctx.extensionsClient.LockVersion(ctx.grpcCtx, &extensionsapi.LockVersionRequest{ModelId: "evaluator", VersionNumber: 1})
+		assert.NoError(t, err)
+		_, err = ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "world_model", VersionNumber: 1, Cascade: true})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		_, err = ctx.extensionsClient.RetrieveDependencyGraph(ctx.grpcCtx, &extensionsapi.RetrieveDependencyGraphRequest{ModelId: "policy", VersionNumber: 1})
+		assert.NoError(t, err)
+		_, err = ctx.extensionsClient.UnlockVersion(ctx.grpcCtx, &extensionsapi.UnlockVersionRequest{ModelId: "evaluator", VersionNumber: 1})
+		assert.NoError(t, err)
+	}
+	{
+		// The dependents are deleted first
+		rep, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "world_model", VersionNumber: 1, Cascade: true})
+		assert.NoError(t, err)
+		assert.Len(t, rep.DeletedDependents, 2)
+		assert.Equal(t, "evaluator", rep.DeletedDependents[0].ModelId)
+		assert.Equal(t, "policy", rep.DeletedDependents[1].ModelId)
+	}
+	for _, modelID := range []string{"world_model", "policy", "evaluator"} {
+		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: modelID})
+		assert.NoError(t, err)
+		assert.Len(t, rep.VersionInfos, 0)
+	}
+	{
+		_, err := ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "world_model"})
+		assert.NoError(t, err)
+	}
+}
+
+func TestVersionDependenciesCheckedOnCommit(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	for _, modelID := range []string{"world_model", "policy"} {
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "world_model", false, modelData)
+	ctx.createVersion(t, "world_model", false, modelData)
+
+	beginUpload := func(dependedUponVersionNumber string) string {
+		rep, err := ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: &grpcapi.ModelVersionInfo{
+			ModelId:  "policy",
+			DataHash: backend.ComputeSHA256Hash(modelData),
+			DataSize: uint64(len(modelData)),
+			UserData: map[string]string{VersionDependencyUserDataKeyPrefix + "world_model": dependedUponVersionNumber},
+		}})
+		assert.NoError(t, err)
+		_, err = ctx.extensionsClient.AppendChunk(ctx.grpcCtx, &extensionsapi.AppendChunkRequest{UploadId: rep.UploadId, Offset: 0, DataChunk: modelData})
+		assert.NoError(t, err)
+		return rep.UploadId
+	}
+
+	{
+		// The dependency is deleted between the beginning and the commit of the upload
+		uploadID := beginUpload("2")
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "world_model", VersionNumber: 2})
+		assert.NoError(t, err)
+		_, err = ctx.extensionsClient.CommitUpload(ctx.grpcCtx, &extensionsapi.CommitUploadRequest{UploadId: uploadID})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "policy"})
+		assert.NoError(t, err)
+		assert.Len(t, rep.VersionInfos, 0)
+	}
+	{
+		// The commit waits for the depended upon model to be unlocked, e.g. by the retention checking if it is in use
+		uploadID := beginUpload("1")
+		unlock := ctx.registryServer.LockDependedUponModel("world_model")
+		committed := make(chan error)
+		go func() {
+			_, err := ctx.extensionsClient.CommitUpload(ctx.grpcCtx, &extensionsapi.CommitUploadRequest{UploadId: uploadID})
+			committed <- err
+		}()
+		select {
+		case <-committed:
+			assert.Fail(t, "the upload was committed while the depended upon model was locked")
+		case <-time.After(50 * time.Millisecond):
+		}
+		assert.False(t, ctx.registryServer.IsVersionInUse("world_model", 1))
+		unlock()
+		assert.NoError(t, <-committed)
+		assert.True(t, ctx.registryServer.IsVersionInUse("world_model", 1))
+	}
+}
+
+func TestVersionManifests(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+	ctx.createVersionWithUserData(t, "foo", false, map[string]string{
+		FrameworkUserDataKey:          "pytorch",
+		FrameworkVersionUserDataKey:   "2.1.0",
+		InputsUserDataKey:             `[{"name":"observation","dtype":"float32","shape":[-1,84,84]}]`,
+		OutputsUserDataKey:            `[{"name":"action","dtype":"int64","shape":[-1]}]`,
+		PythonDependenciesUserDataKey: `["torch[cuda] >=2.0, <3", "numpy"]`,
+	}, modelData)
+	ctx.createVersionWithUserData(t, "foo", false, map[string]string{FrameworkUserDataKey: "tensorflow"}, modelData)
+	ctx.createVersion(t, "foo", false, modelData)
+
+	for _, userData := range []map[string]string{
+		{FrameworkVersionUserDataKey: "2.1.0"},
+		{FrameworkUserDataKey: "pytorch", InputsUserDataKey: `{"name":"observation"}`},
+		{FrameworkUserDataKey: "pytorch", InputsUserDataKey: `[{"name":"observation","dtype":"float128"}]`},
+		{FrameworkUserDataKey: "pytorch", InputsUserDataKey: `[{"dtype":"float32"}]`},
+		{FrameworkUserDataKey: "pytorch", OutputsUserDataKey: `[{"name":"action","dtype":"int64"},{"name":"action","dtype":"int64"}]`},
+		{FrameworkUserDataKey: "pytorch", OutputsUserDataKey: `[{"name":"action","dtype":"int64","shape":[-2]}]`},
+		{FrameworkUserDataKey: "pytorch", PythonDependenciesUserDataKey: `["torch; python_version < '3.8'"]`},
+		{FrameworkUserDataKey: "pytorch", VersionManifestUserDataKeyPrefix + "license": "MIT"},
+	} {
+		_, err := ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData)), UserData: userData}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), userData)
+	}
+	{
+		// The manifest can't be changed once the version is created
+		_, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 2, UserData: map[string]string{FrameworkVersionUserDataKey: "2.12"}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		rep, err := ctx.extensionsClient.RetrieveVersionManifest(ctx.grpcCtx, &extensionsapi.RetrieveVersionManifestRequest{ModelId: "foo", VersionNumber: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(1), rep.VersionInfo.VersionNumber)
+		assert.Equal(t, "pytorch", rep.Manifest.Framework)
+		assert.Equal(t, "2.1.0", rep.Manifest.FrameworkVersion)
+		assert.Len(t, rep.Manifest.Inputs, 1)
+		assert.Equal(t, "observation", rep.Manifest.Inputs[0].Name)
+		assert.Equal(t, "float32", rep.Manifest.Inputs[0].Dtype)
+		assert.Equal(t, []int64{-1, 84, 84}, rep.Manifest.Inputs[0].Shape)
+		assert.Len(t, rep.Manifest.Outputs, 1)
+		assert.Equal(t, []string{"torch[cuda] >=2.0, <3", "numpy"}, rep.Manifest.PythonDependencies)
+	}
+	{
+		rep, err := ctx.extensionsClient.RetrieveVersionManifest(ctx.grpcCtx, &extensionsapi.RetrieveVersionManifestRequest{ModelId: "foo", VersionNumber: -1})
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(3), rep.VersionInfo.VersionNumber)
+		assert.Nil(t, rep.Manifest)
+	}
+	{
+		_, err := ctx.extensionsClient.RetrieveVersionManifest(ctx.grpcCtx, &extensionsapi.RetrieveVersionManifestRequest{ModelId: "foo", VersionNumber: 12})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	for framework, expectedVersionNumbers := range map[[2]string][]uint32{
+		{"pytorch", ""}:      {1},
+		{"pytorch", "2.1.0"}: {1},
+		{"pytorch", "1.13"}:  {},
+		{"tensorflow", ""}:   {2},
+	} {
+		rep, err := ctx.extensionsClient.QueryVersionInfos(ctx.grpcCtx, &extensionsapi.QueryVersionInfosRequest{ModelId: "foo", Framework: framework[0], FrameworkVersion: framework[1]})
+		assert.NoError(t, err)
+		versionNumbers := []uint32{}
+		for _, versionInfo := range rep.VersionInfos {
+			versionNumbers = append(versionNumbers, versionInfo.VersionNumber)
+		}
+		assert.Equal(t, expectedVersionNumbers, versionNumbers, framework)
+	}
+}
+
+func TestVersionAliases(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		_, err := ctx.extensionsClient.SetVersionAlias(ctx.grpcCtx, &extensionsapi.SetVersionAliasRequest{ModelId: "foo", Alias: "candidate", VersionNumber: 1})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo", UserData: map[string]string{"team": "a"}}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "foo", false, modelData)
+	ctx.createVersion(t, "foo", false, modelData[:10])
+	for _, alias := range []string{"latest", "production", "pro duction", ""} {
+		_, err := ctx.extensionsClient.SetVersionAlias(ctx.grpcCtx, &extensionsapi.SetVersionAliasRequest{ModelId: "foo", Alias: alias, VersionNumber: 1})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), alias)
+	}
+	{
+		_, err := ctx.extensionsClient.SetVersionAlias(ctx.grpcCtx, &extensionsapi.SetVersionAliasRequest{ModelId: "foo", Alias: "candidate", VersionNumber: 12})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		// The n-th to last version is resolved when the alias is set
+		rep, err := ctx.extensionsClient.SetVersionAlias(ctx.grpcCtx, &extensionsapi.SetVersionAliasRequest{ModelId: "foo", Alias: "candidate", VersionNumber: -2})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, int(rep.VersionInfo.VersionNumber))
+	}
+	ctx.createVersion(t, "foo", false, modelData[:20])
+
+	aliasCtx := func(alias string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx.grpcCtx, versionAliasMetadataKey, alias)
+	}
+	retrieveAliasedVersionNumbers := func(alias string, versionNumbers ...int32) ([]int, error) {
+		rep, err := ctx.client.RetrieveVersionInfos(aliasCtx(alias), &grpcapi.RetrieveVersionInfosRequest{ModelId: "foo", VersionNumbers: versionNumbers})
+		if err != nil {
+			return nil, err
+		}
+		aliasedVersionNumbers := []int{}
+		for _, versionInfo := range rep.VersionInfos {
+			aliasedVersionNumbers = append(aliasedVersionNumbers, int(versionInfo.VersionNumber))
+		}
+		return aliasedVersionNumbers, nil
+	}
+	{
+		// The alias takes precedence over the requested version numbers
+		versionNumbers, err := retrieveAliasedVersionNumbers("candidate")
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1}, versionNumbers)
+		versionNumbers, err = retrieveAliasedVersionNumbers("candidate", 2, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1}, versionNumbers)
+		versionNumbers, err = retrieveAliasedVersionNumbers("latest")
+		assert.NoError(t, err)
+		assert.Equal(t, []int{3}, versionNumbers)
+		_, err = retrieveAliasedVersionNumbers("staging")
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		_, err = retrieveAliasedVersionNumbers("pro duction")
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		stream, err := ctx.client.RetrieveVersionData(aliasCtx("candidate"), &grpcapi.RetrieveVersionDataRequest{ModelId: "foo"})
+		assert.NoError(t, err)
+		data := []byte{}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			data = append(data, chunk.DataChunk...)
+		}
+		assert.Equal(t, modelData, data)
+	}
+	{
+		stream, err := ctx.client.RetrieveVersionData(aliasCtx("staging"), &grpcapi.RetrieveVersionDataRequest{ModelId: "foo", VersionNumber: 1})
+		assert.NoError(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		// Updating the model keeps its aliases, they can only be changed with SetVersionAlias
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo", UserData: map[string]string{"team": "b"}}})
+		assert.NoError(t, err)
+		_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo", UserData: map[string]string{VersionAliasUserDataKeyPrefix + "candidate": "2"}}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		rep, err := ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{ModelIds: []string{"foo"}})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"team": "b", VersionAliasUserDataKeyPrefix + "candidate": "1"}, rep.ModelInfos[0].UserData)
+		// Sending back the retrieved user data doesn't change the aliases
+		_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: rep.ModelInfos[0]})
+		assert.NoError(t, err)
+		_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "bar", UserData: map[string]string{VersionAliasUserDataKeyPrefix + "candidate": "1"}}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		// A dangling alias, pointing at a deleted version, isn't resolved
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 1})
+		assert.NoError(t, err)
+		_, err = retrieveAliasedVersionNumbers("candidate")
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		rep, err := ctx.extensionsClient.SetVersionAlias(ctx.grpcCtx, &extensionsapi.SetVersionAliasRequest{ModelId: "foo", Alias: "candidate", VersionNumber: 0})
+		assert.NoError(t, err)
+		assert.Nil(t, rep.VersionInfo)
+		modelInfo, err := ctx.backend.RetrieveModelInfo("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"team": "b"}, modelInfo.UserData)
+	}
+}
+
+func TestVersionStages(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo", UserData: map[string]string{
+			VersionStageRequirementsUserDataKeyPrefix + "production": "score, reviewer",
+		}}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "foo", false, modelData)
+	ctx.createVersionWithUserData(t, "foo", false, map[string]string{"score": "0.9", "reviewer": "a"}, modelData)
+	ctx.createVersionWithUserData(t, "foo", false, map[string]string{"score": "0.8"}, modelData)
+
+	transition := func(versionNumber int32, stage extensionsapi.VersionStage) (*extensionsapi.TransitionVersionStageReply, error) {
+		return ctx.extensionsClient.TransitionVersionStage(ctx.grpcCtx, &extensionsapi.TransitionVersionStageRequest{ModelId: "foo", VersionNumber: versionNumber, Stage: stage, Comment: "test"})
+	}
+	aliasedVersionNumber := func(alias string) int {
+		rep, err := ctx.client.RetrieveVersionInfos(metadata.AppendToOutgoingContext(ctx.grpcCtx, versionAliasMetadataKey, alias), &grpcapi.RetrieveVersionInfosRequest{ModelId: "foo"})
+		if err != nil {
+			return 0
+		}
+		return int(rep.VersionInfos[0].VersionNumber)
+	}
+	stage := func(versionNumber int32) extensionsapi.VersionStage {
+		rep, err := ctx.extensionsClient.RetrieveVersionStage(ctx.grpcCtx, &extensionsapi.RetrieveVersionStageRequest{ModelId: "foo", VersionNumber: versionNumber})
+		assert.NoError(t, err)
+		return rep.Stage
+	}
+	{
+		_, err := transition(1, extensionsapi.VersionStage_NO_STAGE)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = transition(12, extensionsapi.VersionStage_STAGING)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		// Versions go through staging before production
+		_, err = transition(1, extensionsapi.VersionStage_PRODUCTION)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	{
+		rep, err := transition(1, extensionsapi.VersionStage_STAGING)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, int(rep.VersionInfo.VersionNumber))
+		assert.Len(t, rep.History, 1)
+		assert.Equal(t, extensionsapi.VersionStage_STAGING, rep.History[0].Stage)
+		assert.Equal(t, "test", rep.History[0].Comment)
+		assert.Equal(t, 1, aliasedVersionNumber(StagingVersionAlias))
+		// Version 1 doesn't define the user data required to enter production
+		_, err = transition(1, extensionsapi.VersionStage_PRODUCTION)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	{
+		// The version previously in staging is retired
+		rep, err := transition(2, extensionsapi.VersionStage_STAGING)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint32{1}, rep.RetiredVersionNumbers)
+		assert.Equal(t, extensionsapi.VersionStage_RETIRED, stage(1))
+		assert.Equal(t, 2, aliasedVersionNumber(StagingVersionAlias))
+
+		rep, err = transition(2, extensionsapi.VersionStage_PRODUCTION)
+		assert.NoError(t, err)
+		assert.Empty(t, rep.RetiredVersionNumbers)
+		assert.Len(t, rep.History, 2)
+		assert.Equal(t, 2, aliasedVersionNumber(ProductionVersionAlias))
+		assert.Equal(t, 0, aliasedVersionNumber(StagingVersionAlias))
+	}
+	{
+		// Retired versions stay retired
+		_, err := transition(1, extensionsapi.VersionStage_STAGING)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		_, err = transition(1, extensionsapi.VersionStage_RETIRED)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	{
+		// The stage aliases and histories can only be changed by the transitions
+		_, err := ctx.extensionsClient.SetVersionAlias(ctx.grpcCtx, &extensionsapi.SetVersionAliasRequest{ModelId: "foo", Alias: ProductionVersionAlias, VersionNumber: 3})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo", UserData: map[string]string{VersionStageUserDataKeyPrefix + "3": "[]"}}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+		assert.NoError(t, err)
+		assert.Equal(t, extensionsapi.VersionStage_PRODUCTION, stage(2))
+	}
+	{
+		// The requirements were removed with the previous update, version 3 replaces version 2 in production
+		_, err := transition(3, extensionsapi.VersionStage_STAGING)
+		assert.NoError(t, err)
+		rep, err := transition(-1, extensionsapi.VersionStage_PRODUCTION)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint32{2}, rep.RetiredVersionNumbers)
+		assert.Equal(t, 3, aliasedVersionNumber(ProductionVersionAlias))
+		retrieveRep, err := ctx.extensionsClient.RetrieveVersionStage(ctx.grpcCtx, &extensionsapi.RetrieveVersionStageRequest{ModelId: "foo", VersionNumber: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, extensionsapi.VersionStage_RETIRED, retrieveRep.Stage)
+		assert.Len(t, retrieveRep.History, 3)
+		assert.Equal(t, `Replaced by version "3"`, retrieveRep.History[2].Comment)
+	}
+	{
+		// Deleting a version forgets its history, its number could be reused
+		_, err := ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 3})
+		assert.NoError(t, err)
+		modelInfo, err := ctx.backend.RetrieveModelInfo("foo")
+		assert.NoError(t, err)
+		assert.NotContains(t, modelInfo.UserData, VersionStageUserDataKeyPrefix+"3")
+		assert.Contains(t, modelInfo.UserData, VersionStageUserDataKeyPrefix+"2")
+	}
+}
+
+func TestRetrieveStorageInfo(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		rep, err := ctx.extensionsClient.RetrieveStorageInfo(ctx.grpcCtx, &extensionsapi.RetrieveStorageInfoRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, int(rep.DataSize))
+		assert.Equal(t, 0, int(rep.ModelsCount))
+		assert.Len(t, rep.ModelStorageInfos, 0)
+	}
+	for _, modelID := range []string{"bar", "foo"} {
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "foo", true, modelData)
+	ctx.createVersion(t, "foo", false, modelData)
+	ctx.createVersion(t, "bar", false, modelData)
+	{
+		rep, err := ctx.extensionsClient.RetrieveStorageInfo(ctx.grpcCtx, &extensionsapi.RetrieveStorageInfoRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, 3*len(modelData), int(rep.DataSize))
+		assert.Equal(t, 2, int(rep.ModelsCount))
+		assert.Equal(t, 3, int(rep.VersionsCount))
+		assert.Len(t, rep.ModelStorageInfos, 2)
+		assert.Equal(t, "bar", rep.ModelStorageInfos[0].ModelId)
+		assert.Equal(t, len(modelData), int(rep.ModelStorageInfos[0].DataSize))
+		assert.Equal(t, 1, int(rep.ModelStorageInfos[0].VersionsCount))
+		assert.Equal(t, 0, int(rep.ModelStorageInfos[0].ArchivedVersionsCount))
+		assert.Equal(t, "foo", rep.ModelStorageInfos[1].ModelId)
+		assert.Equal(t, 2*len(modelData), int(rep.ModelStorageInfos[1].DataSize))
+		assert.Equal(t, 2, int(rep.ModelStorageInfos[1].VersionsCount))
+		assert.Equal(t, 1, int(rep.ModelStorageInfos[1].ArchivedVersionsCount))
+		// The versions are archived on the filesystem
+		assert.Greater(t, rep.Capacity.TotalBytes, uint64(0))
+		assert.LessOrEqual(t, rep.Capacity.AvailableBytes, rep.Capacity.TotalBytes)
+	}
+}
+
+func TestCreateVersions(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	for _, modelID := range []string{"agent_1", "agent_2"} {
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID}})
+		assert.NoError(t, err)
+	}
+
+	sendVersion := func(stream extensionsapi.ModelRegistryExtensionsSP_CreateVersionsClient, modelID string, archived bool, dataHash string, data []byte) {
+		err := stream.Send(&grpcapi.CreateVersionRequestChunk{
+			Msg: &grpcapi.CreateVersionRequestChunk_Header_{
+				Header: &grpcapi.CreateVersionRequestChunk_Header{
+					VersionInfo: &grpcapi.ModelVersionInfo{
+						ModelId:  modelID,
+						Archived: archived,
+						DataHash: dataHash,
+						DataSize: uint64(len(data)),
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		for i := 0; i < len(data); i += 100 {
+			end := i + 100
+			if end > len(data) {
+				end = len(data)
+			}
+			err := stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{
+				DataChunk: data[i:end],
+			}}})
+			assert.NoError(t, err)
+		}
+	}
+	{
+		stream, err := ctx.extensionsClient.CreateVersions(ctx.grpcCtx)
+		assert.NoError(t, err)
+		sendVersion(stream, "agent_1", true, backend.ComputeSHA256Hash(modelData), modelData)
+		sendVersion(stream, "agent_2", false, backend.ComputeSHA256Hash(modelData[:10]), modelData[:10])
+		sendVersion(stream, "agent_1", true, backend.ComputeSHA256Hash([]byte{}), []byte{})
+		rep, err := stream.CloseAndRecv()
+		assert.NoError(t, err)
+		assert.Len(t, rep.VersionInfos, 3)
+		assert.Equal(t, "agent_1", rep.VersionInfos[0].ModelId)
+		assert.Equal(t, 1, int(rep.VersionInfos[0].VersionNumber))
+		assert.Equal(t, len(modelData), int(rep.VersionInfos[0].DataSize))
+		assert.Equal(t, "agent_2", rep.VersionInfos[1].ModelId)
+		assert.Equal(t, 1, int(rep.VersionInfos[1].VersionNumber))
+		assert.Equal(t, 10, int(rep.VersionInfos[1].DataSize))
+		assert.Equal(t, "agent_1", rep.VersionInfos[2].ModelId)
+		assert.Equal(t, 2, int(rep.VersionInfos[2].VersionNumber))
+		assert.Equal(t, 0, int(rep.VersionInfos[2].DataSize))
+	}
+	{
+		// The invalid hash of the last version prevents the creation of all the versions
+		stream, err := ctx.extensionsClient.CreateVersions(ctx.grpcCtx)
+		assert.NoError(t, err)
+		sendVersion(stream, "agent_1", false, backend.ComputeSHA256Hash(modelData), modelData)
+		sendVersion(stream, "agent_2", false, backend.ComputeSHA256Hash(modelData), modelData[:10])
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		stream, err := ctx.extensionsClient.CreateVersions(ctx.grpcCtx)
+		assert.NoError(t, err)
+		sendVersion(stream, "agent_1", false, backend.ComputeSHA256Hash(modelData), modelData)
+		sendVersion(stream, "unknown", false, backend.ComputeSHA256Hash(modelData), modelData)
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	{
+		stream, err := ctx.extensionsClient.CreateVersions(ctx.grpcCtx)
+		assert.NoError(t, err)
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	for modelID, expectedVersionsCount := range map[string]int{"agent_1": 2, "agent_2": 1} {
+		rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: modelID})
+		assert.NoError(t, err)
+		assert.Len(t, rep.VersionInfos, expectedVersionsCount)
+	}
+}
+
+func TestCreateVersionWithArtifacts(t *testing.T) {
+	ctx, err := createContext(t, 16)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	type artifact struct {
+		name     string
+		dataHash string
+		data     []byte
+	}
+	createVersion := func(userData map[string]string, artifacts ...artifact) (*extensionsapi.CreateVersionWithArtifactsReply, error) {
+		stream, err := ctx.extensionsClient.CreateVersionWithArtifacts(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = stream.Send(&extensionsapi.CreateVersionWithArtifactsRequestChunk{
+			Msg: &extensionsapi.CreateVersionWithArtifactsRequestChunk_Header_{
+				Header: &extensionsapi.CreateVersionWithArtifactsRequestChunk_Header{
+					VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", UserData: userData},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		for _, artifact := range artifacts {
+			err := stream.Send(&extensionsapi.CreateVersionWithArtifactsRequestChunk{
+				Msg: &extensionsapi.CreateVersionWithArtifactsRequestChunk_ArtifactHeader_{
+					ArtifactHeader: &extensionsapi.CreateVersionWithArtifactsRequestChunk_ArtifactHeader{
+						Name:     artifact.name,
+						DataSize: uint64(len(artifact.data)),
+						DataHash: artifact.dataHash,
+					},
+				},
+			})
+			assert.NoError(t, err)
+			for i := 0; i < len(artifact.data); i += 10 {
+				end := i + 10
+				if end > len(artifact.data) {
+					end = len(artifact.data)
+				}
+				err := stream.Send(&extensionsapi.CreateVersionWithArtifactsRequestChunk{
+					Msg: &extensionsapi.CreateVersionWithArtifactsRequestChunk_Body_{
+						Body: &extensionsapi.CreateVersionWithArtifactsRequestChunk_Body{DataChunk: artifact.data[i:end]},
+					},
+				})
+				assert.NoError(t, err)
+			}
+		}
+		return stream.CloseAndRecv()
+	}
+	retrieveArtifact := func(req *extensionsapi.RetrieveArtifactDataRequest) ([]byte, error) {
+		stream, err := ctx.extensionsClient.RetrieveArtifactData(ctx.grpcCtx, req)
+		assert.NoError(t, err)
+		data := []byte{}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				return data, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			assert.GreaterOrEqual(t, 16, len(chunk.DataChunk))
+			data = append(data, chunk.DataChunk...)
+		}
+	}
+
+	rep, err := createVersion(
+		map[string]string{"step": "10"},
+		artifact{name: "weights.pt", dataHash: backend.ComputeSHA256Hash(modelData[:100]), data: modelData[:100]},
+		artifact{name: "empty", data: []byte{}},
+		artifact{name: "tokenizer/vocab.json", data: modelData[100:]},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, int(rep.VersionInfo.VersionNumber))
+	assert.Equal(t, len(modelData), int(rep.VersionInfo.DataSize))
+	assert.Equal(t, backend.ComputeSHA256Hash(modelData), rep.VersionInfo.DataHash)
+	assert.Equal(t, "10", rep.VersionInfo.UserData["step"])
+	assert.Len(t, rep.Artifacts, 3)
+	assert.Equal(t, "weights.pt", rep.Artifacts[0].Name)
+	assert.Equal(t, 0, int(rep.Artifacts[0].Offset))
+	assert.Equal(t, 100, int(rep.Artifacts[0].DataSize))
+	assert.Equal(t, "empty", rep.Artifacts[1].Name)
+	assert.Equal(t, 100, int(rep.Artifacts[1].Offset))
+	assert.Equal(t, 0, int(rep.Artifacts[1].DataSize))
+	assert.Equal(t, "tokenizer/vocab.json", rep.Artifacts[2].Name)
+	assert.Equal(t, 100, int(rep.Artifacts[2].Offset))
+	assert.Equal(t, len(modelData)-100, int(rep.Artifacts[2].DataSize))
+	assert.Equal(t, backend.ComputeSHA256Hash(modelData[100:]), rep.Artifacts[2].DataHash)
+	assert.Equal(t, fmt.Sprintf("100:%d:%s", len(modelData)-100, backend.ComputeSHA256Hash(modelData[100:])), rep.VersionInfo.UserData[VersionArtifactUserDataKeyPrefix+"tokenizer/vocab.json"])
+
+	data, err := retrieveArtifact(&extensionsapi.RetrieveArtifactDataRequest{ModelId: "foo", VersionNumber: 1, ArtifactName: "weights.pt"})
+	assert.NoError(t, err)
+	assert.Equal(t, modelData[:100], data)
+	data, err = retrieveArtifact(&extensionsapi.RetrieveArtifactDataRequest{ModelId: "foo", VersionNumber: -1, ArtifactName: "tokenizer/vocab.json"})
+	assert.NoError(t, err)
+	assert.Equal(t, modelData[100:], data)
+	data, err = retrieveArtifact(&extensionsapi.RetrieveArtifactDataRequest{ModelId: "foo", VersionNumber: 1, ArtifactName: "empty"})
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+	_, err = retrieveArtifact(&extensionsapi.RetrieveArtifactDataRequest{ModelId: "foo", VersionNumber: 1, ArtifactName: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = retrieveArtifact(&extensionsapi.RetrieveArtifactDataRequest{ModelId: "foo", VersionNumber: 2, ArtifactName: "weights.pt"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// The whole data of the version is the concatenation of its artifacts
+	dataStream, err := ctx.client.RetrieveVersionData(ctx.grpcCtx, &grpcapi.RetrieveVersionDataRequest{ModelId: "foo", VersionNumber: 1})
+	assert.NoError(t, err)
+	data = []byte{}
+	for {
+		chunk, err := dataStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		data = append(data, chunk.DataChunk...)
+	}
+	assert.Equal(t, modelData, data)
+
+	// The artifacts can't be changed afterward
+	_, err = ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, RemovedUserDataKeys: []string{VersionArtifactUserDataKeyPrefix + "empty"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = createVersion(nil, artifact{name: "weights.pt", dataHash: backend.ComputeSHA256Hash(modelData[:10]), data: modelData[:100]})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = createVersion(nil, artifact{name: "weights.pt", data: modelData[:10]}, artifact{name: "weights.pt", data: modelData[:10]})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = createVersion(nil, artifact{name: "", data: modelData[:10]})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = createVersion(nil)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = createVersion(map[string]string{VersionArtifactUserDataKeyPrefix + "weights.pt": "0:10:hash"}, artifact{name: "weights.pt", data: modelData[:10]})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Only CreateVersionWithArtifacts defines artifacts
+	stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+	assert.NoError(t, err)
+	err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Header_{Header: &grpcapi.CreateVersionRequestChunk_Header{
+		VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", UserData: map[string]string{VersionArtifactUserDataKeyPrefix + "weights.pt": "0:0:hash"}},
+	}}})
+	assert.NoError(t, err)
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	versionsRep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "foo"})
+	assert.NoError(t, err)
+	assert.Len(t, versionsRep.VersionInfos, 1)
+}
+
+func TestRetrieveModelsPagination(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	for _, modelID := range []string{"model_2", "model_4", "model_6", "model_8", "model_a", "model_c"} {
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID}})
+		assert.NoError(t, err)
+	}
+
+	retrievedModelIDs := []string{}
+	rep, err := ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{ModelsCount: 2})
+	assert.NoError(t, err)
+	for _, modelInfo := range rep.ModelInfos {
+		retrievedModelIDs = append(retrievedModelIDs, modelInfo.ModelId)
+	}
+
+	// Models inserted and deleted before the cursor don't shift the following pages
+	{
+		_, err := ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "model_2"})
+		assert.NoError(t, err)
+		for _, modelID := range []string{"model_1", "model_3"} {
+			_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID}})
+			assert.NoError(t, err)
+		}
+	}
+	rep, err = ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{ModelsCount: 2, ModelHandle: rep.NextModelHandle})
+	assert.NoError(t, err)
+	for _, modelInfo := range rep.ModelInfos {
+		retrievedModelIDs = append(retrievedModelIDs, modelInfo.ModelId)
+	}
+
+	// Models inserted after the cursor are part of the following pages
+	{
+		_, err := ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "model_4"})
+		assert.NoError(t, err)
+		_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "model_b"}})
+		assert.NoError(t, err)
+	}
+	for rep.NextModelHandle != "" && len(rep.ModelInfos) > 0 {
+		rep, err = ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{ModelsCount: 2, ModelHandle: rep.NextModelHandle})
+		assert.NoError(t, err)
+		for _, modelInfo := range rep.ModelInfos {
+			retrievedModelIDs = append(retrievedModelIDs, modelInfo.ModelId)
+		}
+	}
+
+	assert.Equal(t, []string{"model_2", "model_4", "model_6", "model_8", "model_a", "model_b", "model_c"}, retrievedModelIDs)
+
+	{
+		tamperedHandle := []byte(ctx.paginationCodec.Encode(modelsPaginationScope, pagination.Cursor{Offset: 2, LastKey: "model_4"}))
+		tamperedHandle[0] ^= 1
+		_, err := ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{ModelHandle: string(tamperedHandle)})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		_, err := ctx.client.RetrieveModels(ctx.grpcCtx, &grpcapi.RetrieveModelsRequest{ModelHandle: "2"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestQueryModels(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	for _, modelInfo := range []*grpcapi.ModelInfo{
+		{ModelId: "policy_a", UserData: map[string]string{"env": "cartpole-v1", "algo": "dqn"}},
+		{ModelId: "policy_b", UserData: map[string]string{"env": "cartpole-v0", "algo": "ppo"}},
+		{ModelId: "policy_c", UserData: map[string]string{"env": "cartpole-v1", "algo": "ppo"}},
+		{ModelId: "value_a", UserData: map[string]string{"env": "cartpole-v1", "algo": "ppo"}},
+	} {
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: modelInfo})
+		assert.NoError(t, err)
+	}
+
+	req := &extensionsapi.QueryModelsRequest{
+		ModelIdGlob:      "policy_*",
+		UserDataEquals:   map[string]string{"algo": "ppo"},
+		UserDataPrefixes: map[string]string{"env": "cartpole"},
+		ModelsCount:      1,
+	}
+	rep, err := ctx.extensionsClient.QueryModels(ctx.grpcCtx, req)
+	assert.NoError(t, err)
+	assert.Len(t, rep.ModelInfos, 1)
+	assert.Equal(t, "policy_b", rep.ModelInfos[0].ModelId)
+	assert.Equal(t, "ppo", rep.ModelInfos[0].UserData["algo"])
+
+	req.ModelHandle = rep.NextModelHandle
+	rep, err = ctx.extensionsClient.QueryModels(ctx.grpcCtx, req)
+	assert.NoError(t, err)
+	assert.Len(t, rep.ModelInfos, 1)
+	assert.Equal(t, "policy_c", rep.ModelInfos[0].ModelId)
+
+	req.ModelHandle = rep.NextModelHandle
+	rep, err = ctx.extensionsClient.QueryModels(ctx.grpcCtx, req)
+	assert.NoError(t, err)
+	assert.Len(t, rep.ModelInfos, 0)
+
+	req.ModelHandle = "1"
+	_, err = ctx.extensionsClient.QueryModels(ctx.grpcCtx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestQueryVersionInfos(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	{
+		_, err := ctx.extensionsClient.QueryVersionInfos(ctx.grpcCtx, &extensionsapi.QueryVersionInfosRequest{ModelId: "foo"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	ctx.createVersionWithUserData(t, "foo", true, map[string]string{"step": "100", "stage": "train"}, []byte("1"))
+	v2 := ctx.createVersionWithUserData(t, "foo", false, map[string]string{"step": "200", "stage": "train"}, []byte("2"))
+	v3 := ctx.createVersionWithUserData(t, "foo", true, map[string]string{"step": "300", "stage": "train"}, []byte("3"))
+	ctx.createVersionWithUserData(t, "foo", true, map[string]string{"step": "400", "stage": "eval"}, []byte("4"))
+
+	req := &extensionsapi.QueryVersionInfosRequest{
+		ModelId:        "foo",
+		UserDataEquals: map[string]string{"stage": "train"},
+		UserDataComparisons: []*extensionsapi.UserDataComparison{
+			{Key: "step", Operator: extensionsapi.ComparisonOperator_GREATER_THAN, Value: 150},
+		},
+		VersionsCount: 1,
+	}
+	rep, err := ctx.extensionsClient.QueryVersionInfos(ctx.grpcCtx, req)
+	assert.NoError(t, err)
+	assert.Len(t, rep.VersionInfos, 1)
+	assert.Equal(t, v2.VersionNumber, rep.VersionInfos[0].VersionNumber)
+
+	req.VersionHandle = rep.NextVersionHandle
+	rep, err = ctx.extensionsClient.QueryVersionInfos(ctx.grpcCtx, req)
+	assert.NoError(t, err)
+	assert.Len(t, rep.VersionInfos, 1)
+	assert.Equal(t, v3.VersionNumber, rep.VersionInfos[0].VersionNumber)
+
+	req.VersionHandle = rep.NextVersionHandle
+	rep, err = ctx.extensionsClient.QueryVersionInfos(ctx.grpcCtx, req)
+	assert.NoError(t, err)
+	assert.Len(t, rep.VersionInfos, 0)
+
+	rep, err = ctx.extensionsClient.QueryVersionInfos(ctx.grpcCtx, &extensionsapi.QueryVersionInfosRequest{
+		ModelId:       "foo",
+		Archived:      extensionsapi.ArchivedFilter_NON_ARCHIVED_ONLY,
+		CreatedBefore: v3.CreationTimestamp,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, rep.VersionInfos, 1)
+	assert.Equal(t, v2.VersionNumber, rep.VersionInfos[0].VersionNumber)
+
+	_, err = ctx.extensionsClient.QueryVersionInfos(ctx.grpcCtx, &extensionsapi.QueryVersionInfosRequest{ModelId: "foo", VersionHandle: "1"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestQueryVersionInfosByMetric(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	for _, reward := range []float64{0.5, 0.9, 0.2, 0.9} {
+		versionInfo := ctx.createVersion(t, "foo", false, modelData[:10])
+		_, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: int32(versionInfo.VersionNumber), Metrics: map[string]float64{"reward": reward}})
+		assert.NoError(t, err)
+	}
+	// Versions without the metric or with other metrics are ignored
+	ctx.createVersion(t, "foo", false, modelData[:10])
+	ctx.createVersionWithUserData(t, "foo", false, map[string]string{VersionMetricUserDataKeyPrefix + "loss": "0.1"}, modelData[:10])
+	{
+		rep, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, Metrics: map[string]float64{"loss": 0.3}})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{VersionMetricUserDataKeyPrefix + "reward": "0.5", VersionMetricUserDataKeyPrefix + "loss": "0.3"}, rep.VersionInfo.UserData)
+	}
+	{
+		rep, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, RemovedMetricNames: []string{"loss"}})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{VersionMetricUserDataKeyPrefix + "reward": "0.5"}, rep.VersionInfo.UserData)
+	}
+	for _, metrics := range []map[string]float64{{"re ward": 1}, {"reward": math.NaN()}, {"reward": math.Inf(1)}} {
+		_, err := ctx.extensionsClient.UpdateVersionInfo(ctx.grpcCtx, &extensionsapi.UpdateVersionInfoRequest{ModelId: "foo", VersionNumber: 1, Metrics: metrics})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	queryVersionNumbers := func(req *extensionsapi.QueryVersionInfosRequest) ([]int, string) {
+		rep, err := ctx.extensionsClient.QueryVersionInfos(ctx.grpcCtx, req)
+		assert.NoError(t, err)
+		versionNumbers := []int{}
+		for _, versionInfo := range rep.VersionInfos {
+			versionNumbers = append(versionNumbers, int(versionInfo.VersionNumber))
+		}
+		return versionNumbers, rep.NextVersionHandle
+	}
+
+	req := &extensionsapi.QueryVersionInfosRequest{ModelId: "foo", OrderByMetric: "reward", Descending: true, VersionsCount: 3}
+	versionNumbers, nextVersionHandle := queryVersionNumbers(req)
+	assert.Equal(t, []int{2, 4, 1}, versionNumbers)
+	req.VersionHandle = nextVersionHandle
+	versionNumbers, _ = queryVersionNumbers(req)
+	assert.Equal(t, []int{3}, versionNumbers)
+
+	versionNumbers, _ = queryVersionNumbers(&extensionsapi.QueryVersionInfosRequest{
+		ModelId:           "foo",
+		OrderByMetric:     "reward",
+		MetricComparisons: []*extensionsapi.UserDataComparison{{Key: "reward", Operator: extensionsapi.ComparisonOperator_GREATER_OR_EQUAL, Value: 0.5}},
+	})
+	assert.Equal(t, []int{1, 2, 4}, versionNumbers)
+
+	// Handles can't be used with another order
+	_, err = ctx.extensionsClient.QueryVersionInfos(ctx.grpcCtx, &extensionsapi.QueryVersionInfosRequest{ModelId: "foo", OrderByMetric: "reward", VersionHandle: nextVersionHandle})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = ctx.extensionsClient.QueryVersionInfos(ctx.grpcCtx, &extensionsapi.QueryVersionInfosRequest{ModelId: "foo", OrderByMetric: "re ward"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestResumableUpload(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	versionInfo := &grpcapi.ModelVersionInfo{
+		ModelId:  "foo",
+		Archived: true,
+		DataHash: backend.ComputeSHA256Hash(modelData),
+		DataSize: uint64(len(modelData)),
+	}
+	{
+		_, err := ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: versionInfo})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	beginRep, err := ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: versionInfo})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, beginRep.UploadId)
+	uploadID := beginRep.UploadId
+
+	appendRep, err := ctx.extensionsClient.AppendChunk(ctx.grpcCtx, &extensionsapi.AppendChunkRequest{UploadId: uploadID, Offset: 0, DataChunk: modelData[:100]})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), appendRep.ReceivedSize)
+
+	// Chunks can't leave a gap
+	_, err = ctx.extensionsClient.AppendChunk(ctx.grpcCtx, &extensionsapi.AppendChunkRequest{UploadId: uploadID, Offset: 150, DataChunk: modelData[150:200]})
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+
+	// An incomplete upload can't be committed
+	_, err = ctx.extensionsClient.CommitUpload(ctx.grpcCtx, &extensionsapi.CommitUploadRequest{UploadId: uploadID})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// Resuming after a lost acknowledgment, the already received part of the chunk is skipped
+	appendRep, err = ctx.extensionsClient.AppendChunk(ctx.grpcCtx, &extensionsapi.AppendChunkRequest{UploadId: uploadID, Offset: 50, DataChunk: modelData[50:200]})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(200), appendRep.ReceivedSize)
+
+	// An empty chunk retrieves the received size
+	appendRep, err = ctx.extensionsClient.AppendChunk(ctx.grpcCtx, &extensionsapi.AppendChunkRequest{UploadId: uploadID})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(200), appendRep.ReceivedSize)
+
+	appendRep, err = ctx.extensionsClient.AppendChunk(ctx.grpcCtx, &extensionsapi.AppendChunkRequest{UploadId: uploadID, Offset: 200, DataChunk: modelData[200:]})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(len(modelData)), appendRep.ReceivedSize)
+
+	commitRep, err := ctx.extensionsClient.CommitUpload(ctx.grpcCtx, &extensionsapi.CommitUploadRequest{UploadId: uploadID})
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", commitRep.VersionInfo.ModelId)
+	assert.Equal(t, uint32(1), commitRep.VersionInfo.VersionNumber)
+	assert.Equal(t, versionInfo.DataHash, commitRep.VersionInfo.DataHash)
+
+	data, err := ctx.backend.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, modelData, data)
+
+	// A committed upload no longer exists
+	_, err = ctx.extensionsClient.CommitUpload(ctx.grpcCtx, &extensionsapi.CommitUploadRequest{UploadId: uploadID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Abandoned uploads expire
+	beginRep, err = ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: versionInfo})
+	assert.NoError(t, err)
+	time.Sleep(2 * uploadSessionTimeout)
+	_, err = ctx.extensionsClient.AppendChunk(ctx.grpcCtx, &extensionsapi.AppendChunkRequest{UploadId: beginRep.UploadId, DataChunk: modelData})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestUploadSessionsLimit(t *testing.T) {
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 1024 * 1024,
+		PaginationSecret:              paginationSecret,
+		UploadSessionTimeout:          uploadSessionTimeout,
+		MaxUploadSessions:             2,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	versionInfo := &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData))}
+	uploadIDs := []string{}
+	for i := 0; i < 2; i++ {
+		beginRep, err := ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: versionInfo})
+		assert.NoError(t, err)
+		uploadIDs = append(uploadIDs, beginRep.UploadId)
+	}
+	_, err = ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: versionInfo})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// A failed commit keeps the upload
+	_, err = ctx.extensionsClient.AppendChunk(ctx.grpcCtx, &extensionsapi.AppendChunkRequest{UploadId: uploadIDs[0], DataChunk: modelData})
+	assert.NoError(t, err)
+	_, err = ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "foo"})
+	assert.NoError(t, err)
+	_, err = ctx.extensionsClient.CommitUpload(ctx.grpcCtx, &extensionsapi.CommitUploadRequest{UploadId: uploadIDs[0]})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: versionInfo})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+	_, err = ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: versionInfo})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	commitRep, err := ctx.extensionsClient.CommitUpload(ctx.grpcCtx, &extensionsapi.CommitUploadRequest{UploadId: uploadIDs[0]})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), commitRep.VersionInfo.VersionNumber)
+
+	// The committed upload no longer counts
+	_, err = ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: versionInfo})
+	assert.NoError(t, err)
+}
+
+func TestRetrieveVersionDataRange(t *testing.T) {
+	ctx, err := createContext(t, 16) // For the purpose of the test we limit the sent chunk size drastically
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "baz"}})
+	assert.NoError(t, err)
+	ctx.createVersion(t, "baz", true, modelData)
+
+	retrieveRange := func(req *extensionsapi.RetrieveVersionDataRangeRequest) ([]byte, error) {
+		stream, err := ctx.extensionsClient.RetrieveVersionDataRange(ctx.grpcCtx, req)
+		assert.NoError(t, err)
+		data := []byte{}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				return data, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			assert.GreaterOrEqual(t, 16, len(chunk.DataChunk))
+			data = append(data, chunk.DataChunk...)
+		}
+	}
+
+	data, err := retrieveRange(&extensionsapi.RetrieveVersionDataRangeRequest{ModelId: "baz", VersionNumber: 1, Offset: 10, Length: 40})
+	assert.NoError(t, err)
+	assert.Equal(t, modelData[10:50], data)
+
+	data, err = retrieveRange(&extensionsapi.RetrieveVersionDataRangeRequest{ModelId: "baz", VersionNumber: -1, Offset: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, modelData[100:], data)
+
+	_, err = retrieveRange(&extensionsapi.RetrieveVersionDataRangeRequest{ModelId: "baz", VersionNumber: 1, Offset: uint64(len(modelData) + 1)})
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+
+	_, err = retrieveRange(&extensionsapi.RetrieveVersionDataRangeRequest{ModelId: "baz", VersionNumber: 2})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGzipTransferCompression(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}}, grpc.UseCompressor(gzip.Name))
+	assert.NoError(t, err)
+
+	stream, err := ctx.client.CreateVersion(ctx.grpcCtx, grpc.UseCompressor(gzip.Name))
+	assert.NoError(t, err)
+	err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Header_{Header: &grpcapi.CreateVersionRequestChunk_Header{
+		VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData))},
+	}}})
+	assert.NoError(t, err)
+	err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{DataChunk: modelData}}})
+	assert.NoError(t, err)
+	_, err = stream.CloseAndRecv()
+	assert.NoError(t, err)
+
+	dataStream, err := ctx.client.RetrieveVersionData(ctx.grpcCtx, &grpcapi.RetrieveVersionDataRequest{ModelId: "foo", VersionNumber: 1}, grpc.UseCompressor(gzip.Name))
+	assert.NoError(t, err)
+	data := []byte{}
+	for {
+		chunk, err := dataStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		data = append(data, chunk.DataChunk...)
+	}
+	assert.Equal(t, modelData, data)
+}
+
+func TestHashAlgorithm(t *testing.T) {
+	hashAlgorithm, err := backend.LookupHashAlgorithm("xxhash64")
+	assert.NoError(t, err)
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 1024 * 1024,
+		PaginationSecret:              paginationSecret,
+		UploadSessionTimeout:          uploadSessionTimeout,
+		HashAlgorithm:                 hashAlgorithm,
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	createVersion := func(dataHash string) (*grpcapi.CreateVersionReply, error) {
+		stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Header_{Header: &grpcapi.CreateVersionRequestChunk_Header{
+			VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: dataHash, DataSize: uint64(len(modelData))},
+		}}})
+		assert.NoError(t, err)
+		_ = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{DataChunk: modelData}}})
+		return stream.CloseAndRecv()
+	}
+	retrieveVersionData := func(versionNumber uint32) ([]byte, error) {
+		stream, err := ctx.client.RetrieveVersionData(ctx.grpcCtx, &grpcapi.RetrieveVersionDataRequest{ModelId: "foo", VersionNumber: int32(versionNumber)})
+		assert.NoError(t, err)
+		data := []byte{}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				return data, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, chunk.DataChunk...)
+		}
+	}
+
+	{
+		// Without an expected hash the configured algorithm is used
+		rep, err := createVersion("")
+		assert.NoError(t, err)
+		assert.Equal(t, hashAlgorithm.ComputeHash(modelData), rep.VersionInfo.DataHash)
+		assert.True(t, strings.HasPrefix(rep.VersionInfo.DataHash, "xxhash64:"))
+
+		data, err := retrieveVersionData(rep.VersionInfo.VersionNumber)
+		assert.NoError(t, err)
+		assert.Equal(t, modelData, data)
+	}
+	{
+		// The algorithm of the expected hash is used
+		rep, err := createVersion(backend.ComputeSHA256Hash(modelData))
+		assert.NoError(t, err)
+		assert.Equal(t, backend.ComputeSHA256Hash(modelData), rep.VersionInfo.DataHash)
+
+		sha512HashAlgorithm, err := backend.LookupHashAlgorithm("sha512")
+		assert.NoError(t, err)
+		rep, err = createVersion(sha512HashAlgorithm.ComputeHash(modelData))
+		assert.NoError(t, err)
+		assert.Equal(t, sha512HashAlgorithm.ComputeHash(modelData), rep.VersionInfo.DataHash)
+		assert.True(t, strings.HasPrefix(rep.VersionInfo.DataHash, "sha512:"))
+	}
+	{
+		// BLAKE3 hashes are 256 bits long, e.g. the reference hash of the empty input
+		blake3HashAlgorithm, err := backend.LookupHashAlgorithm("blake3")
+		assert.NoError(t, err)
+		rawHash, err := hex.DecodeString("af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262")
+		assert.NoError(t, err)
+		assert.Equal(t, "blake3:"+base64.StdEncoding.EncodeToString(rawHash), blake3HashAlgorithm.ComputeHash([]byte{}))
+
+		rep, err := createVersion(blake3HashAlgorithm.ComputeHash(modelData))
+		assert.NoError(t, err)
+		assert.Equal(t, blake3HashAlgorithm.ComputeHash(modelData), rep.VersionInfo.DataHash)
+	}
+	{
+		// Unknown algorithm
+		_, err := createVersion("md5:1B2M2Y8AsgTpgAmY7PhCfg==")
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestVerifyDataHash(t *testing.T) {
+	for _, verifyDataHash := range []bool{false, true} {
+		ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+			SentModelVersionDataChunkSize: 1024 * 1024,
+			PaginationSecret:              paginationSecret,
+			UploadSessionTimeout:          uploadSessionTimeout,
+			HashAlgorithm:                 backend.SHA256HashAlgorithm,
+			VerifyDataHash:                verifyDataHash,
+		})
+		assert.NoError(t, err)
+		_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+		assert.NoError(t, err)
+
+		// Stored data not matching its hash, as if it was corrupted
+		_, err = ctx.backend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+			CreationTimestamp: time.Now(),
+			Archived:          true,
+			DataHash:          backend.ComputeSHA256Hash(modelData[:20]),
+			Data:              modelData,
+		})
+		assert.NoError(t, err)
+
+		retrieveVersionData := func(grpcCtx context.Context) ([]byte, error) {
+			stream, err := ctx.client.RetrieveVersionData(grpcCtx, &grpcapi.RetrieveVersionDataRequest{ModelId: "foo", VersionNumber: 1})
+			assert.NoError(t, err)
+			data := []byte{}
+			for {
+				chunk, err := stream.Recv()
+				if err == io.EOF {
+					return data, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				data = append(data, chunk.DataChunk...)
+			}
+		}
+
+		data, err := retrieveVersionData(ctx.grpcCtx)
+		if verifyDataHash {
+			assert.Equal(t, codes.DataLoss, status.Code(err))
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, modelData, data)
+		}
+
+		_, err = retrieveVersionData(metadata.AppendToOutgoingContext(ctx.grpcCtx, verifyDataHashMetadataKey, "true"))
+		assert.Equal(t, codes.DataLoss, status.Code(err))
+
+		ctx.destroy()
+	}
+}
+
+func TestSignatureVerification(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 1024 * 1024,
+		PaginationSecret:              paginationSecret,
+		UploadSessionTimeout:          uploadSessionTimeout,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		SignatureVerifier:             signature.CreateVerifier(map[string]ed25519.PublicKey{"trainer": publicKey}, true),
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	createVersion := func(data []byte, userData map[string]string) (*grpcapi.CreateVersionReply, error) {
+		stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Header_{Header: &grpcapi.CreateVersionRequestChunk_Header{
+			VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(data)), UserData: userData},
+		}}})
+		assert.NoError(t, err)
+		_ = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{DataChunk: data}}})
+		return stream.CloseAndRecv()
+	}
+
+	signedUserData := map[string]string{
+		signature.SignatureUserDataKey: signature.Sign(privateKey, "foo", backend.ComputeSHA256Hash(modelData)),
+		signature.KeyIDUserDataKey:     "trainer",
+	}
+	{
+		rep, err := createVersion(modelData, signedUserData)
+		assert.NoError(t, err)
+		// The signature is exposed to the consumers
+		assert.Equal(t, signedUserData, rep.VersionInfo.UserData)
+		signatureBytes, err := base64.StdEncoding.DecodeString(rep.VersionInfo.UserData[signature.SignatureUserDataKey])
+		assert.NoError(t, err)
+		assert.True(t, ed25519.Verify(publicKey, signature.SignedMessage(rep.VersionInfo.ModelId, rep.VersionInfo.DataHash), signatureBytes))
+	}
+	{
+		// Data not matching the signed hash
+		_, err := createVersion(modelData[:20], signedUserData)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		// Unsigned versions are rejected when signatures are required
+		_, err := createVersion(modelData, nil)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		// Signature of another model
+		_, err := createVersion(modelData, map[string]string{
+			signature.SignatureUserDataKey: signature.Sign(privateKey, "bar", backend.ComputeSHA256Hash(modelData)),
+			signature.KeyIDUserDataKey:     "trainer",
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		// Resumable uploads are verified as well
+		_, err := ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: &grpcapi.ModelVersionInfo{
+			ModelId:  "foo",
+			DataHash: backend.ComputeSHA256Hash(modelData),
+			DataSize: uint64(len(modelData)),
+		}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	versionInfos, err := ctx.backend.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 1)
+}
+
+func TestNamespaces(t *testing.T) {
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 1024 * 1024,
+		PaginationSecret:              paginationSecret,
+		UploadSessionTimeout:          uploadSessionTimeout,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		Namespaces: &namespaces.Configuration{
+			Namespaces: map[string]namespaces.Quota{
+				"team_a": {MaxModels: 2, MaxVersions: 2},
+				"team_b": {MaxDataSize: int64(len(modelData))},
+			},
+			Required: true,
+		},
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	createModel := func(modelID string) error {
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID}})
+		return err
+	}
+	assert.Equal(t, codes.InvalidArgument, status.Code(createModel("foo")))
+	assert.Equal(t, codes.InvalidArgument, status.Code(createModel("team_c.foo")))
+	assert.NoError(t, createModel("team_a.foo"))
+	assert.NoError(t, createModel("team_a.bar"))
+	assert.NoError(t, createModel("team_b.foo"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(createModel("team_a.baz")))
+	// Updating a model doesn't count in the quota
+	assert.NoError(t, createModel("team_a.foo"))
+
+	createVersion := func(modelID string) error {
+		stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Header_{Header: &grpcapi.CreateVersionRequestChunk_Header{
+			VersionInfo: &grpcapi.ModelVersionInfo{ModelId: modelID, DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData))},
+		}}})
+		assert.NoError(t, err)
+		_ = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{DataChunk: modelData}}})
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	assert.NoError(t, createVersion("team_a.foo"))
+	assert.NoError(t, createVersion("team_a.bar"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(createVersion("team_a.foo")))
+	_, err = ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: &grpcapi.ModelVersionInfo{
+		ModelId:  "team_a.bar",
+		DataHash: backend.ComputeSHA256Hash(modelData),
+		DataSize: uint64(len(modelData)),
+	}})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.NoError(t, createVersion("team_b.foo"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(createVersion("team_b.foo")))
+
+	{
+		rep, err := ctx.extensionsClient.QueryModels(ctx.grpcCtx, &extensionsapi.QueryModelsRequest{Namespace: "team_a"})
+		assert.NoError(t, err)
+		assert.Len(t, rep.ModelInfos, 2)
+		rep, err = ctx.extensionsClient.QueryModels(ctx.grpcCtx, &extensionsapi.QueryModelsRequest{Namespace: "team_a", ModelIdGlob: "f*"})
+		assert.NoError(t, err)
+		assert.Len(t, rep.ModelInfos, 1)
+		assert.Equal(t, "team_a.foo", rep.ModelInfos[0].ModelId)
+		_, err = ctx.extensionsClient.QueryModels(ctx.grpcCtx, &extensionsapi.QueryModelsRequest{Namespace: "team_a.foo"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	{
+		rep, err := ctx.extensionsClient.RetrieveStorageInfo(ctx.grpcCtx, &extensionsapi.RetrieveStorageInfoRequest{Namespace: "team_a"})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, int(rep.ModelsCount))
+		assert.Equal(t, 2, int(rep.VersionsCount))
+		assert.Equal(t, 2*len(modelData), int(rep.DataSize))
+		assert.Equal(t, 2, int(rep.Quota.MaxModels))
+		assert.Equal(t, 2, int(rep.Quota.MaxVersions))
+		assert.Equal(t, 0, int(rep.Quota.MaxDataSize))
+	}
+}
+
+func (ctx *testContext) exportRegistry(t *testing.T, modelIDs []string) ([]byte, error) {
+	stream, err := ctx.extensionsClient.ExportRegistry(ctx.grpcCtx, &extensionsapi.ExportRegistryRequest{ModelIds: modelIDs})
+	assert.NoError(t, err)
+	archive := []byte{}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return archive, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		assert.LessOrEqual(t, len(chunk.DataChunk), 16)
+		archive = append(archive, chunk.DataChunk...)
+	}
+}
+
+func (ctx *testContext) importRegistry(t *testing.T, archive []byte) (*extensionsapi.ImportRegistryReply, error) {
+	stream, err := ctx.extensionsClient.ImportRegistry(ctx.grpcCtx)
+	assert.NoError(t, err)
+	for offset := 0; offset < len(archive); offset += 1000 {
+		end := offset + 1000
+		if end > len(archive) {
+			end = len(archive)
+		}
+		if err := stream.Send(&extensionsapi.ImportRegistryRequestChunk{DataChunk: archive[offset:end]}); err != nil {
+			break
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestModelIDValidation(t *testing.T) {
+	rules, err := modelIDs.ParseRules(`^[a-z_]+$`, 8, "tmp_")
+	assert.NoError(t, err)
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 1024 * 1024,
+		PaginationSecret:              paginationSecret,
+		UploadSessionTimeout:          uploadSessionTimeout,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		ModelIDRules:                  rules,
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	createModel := func(modelID string) error {
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID}})
+		return err
+	}
+	assert.NoError(t, createModel("foo"))
+	for _, modelID := range []string{"Foo", "tmp_foo", "foo_bar_baz", "", "../foo"} {
+		err := createModel(modelID)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), modelID)
+	}
+	err = createModel("tmp_foo")
+	assert.Contains(t, err.Error(), `invalid model id "tmp_foo", prefix "tmp_" is reserved`)
+	_, err = ctx.extensionsClient.CreateModel(ctx.grpcCtx, &extensionsapi.CreateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "Foo"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	createVersion := func(modelID string) error {
+		stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Header_{Header: &grpcapi.CreateVersionRequestChunk_Header{
+			VersionInfo: &grpcapi.ModelVersionInfo{ModelId: modelID, DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData))},
+		}}})
+		assert.NoError(t, err)
+		_ = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{DataChunk: modelData}}})
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	assert.NoError(t, createVersion("foo"))
+	assert.Equal(t, codes.InvalidArgument, status.Code(createVersion("foo/../bar")))
+	_, err = ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: &grpcapi.ModelVersionInfo{
+		ModelId:  "Foo",
+		DataHash: backend.ComputeSHA256Hash(modelData),
+		DataSize: uint64(len(modelData)),
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestMaxVersionDataSize(t *testing.T) {
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 1024 * 1024,
+		PaginationSecret:              paginationSecret,
+		UploadSessionTimeout:          uploadSessionTimeout,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		MaxVersionDataSize:            uint64(len(modelData)),
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	createVersion := func(data []byte, declaredDataSize uint64) error {
+		stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Header_{Header: &grpcapi.CreateVersionRequestChunk_Header{
+			VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: backend.ComputeSHA256Hash(data), DataSize: declaredDataSize},
+		}}})
+		assert.NoError(t, err)
+		_ = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{DataChunk: data}}})
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	largeData := append(append([]byte{}, modelData...), modelData...)
+	assert.NoError(t, createVersion(modelData, uint64(len(modelData))))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(createVersion(largeData, uint64(len(largeData)))))
+	// Sending more than declared is rejected while streaming
+	assert.Equal(t, codes.InvalidArgument, status.Code(createVersion(largeData, uint64(len(modelData)))))
+
+	_, err = ctx.extensionsClient.BeginUpload(ctx.grpcCtx, &extensionsapi.BeginUploadRequest{VersionInfo: &grpcapi.ModelVersionInfo{
+		ModelId:  "foo",
+		DataHash: backend.ComputeSHA256Hash(largeData),
+		DataSize: uint64(len(largeData)),
+	}})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	stream, err := ctx.extensionsClient.CreateVersionWithArtifacts(ctx.grpcCtx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&extensionsapi.CreateVersionWithArtifactsRequestChunk{Msg: &extensionsapi.CreateVersionWithArtifactsRequestChunk_Header_{Header: &extensionsapi.CreateVersionWithArtifactsRequestChunk_Header{
+		VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo"},
+	}}}))
+	for _, name := range []string{"weights", "optimizer"} {
+		_ = stream.Send(&extensionsapi.CreateVersionWithArtifactsRequestChunk{Msg: &extensionsapi.CreateVersionWithArtifactsRequestChunk_ArtifactHeader_{ArtifactHeader: &extensionsapi.CreateVersionWithArtifactsRequestChunk_ArtifactHeader{
+			Name:     name,
+			DataHash: backend.ComputeSHA256Hash(modelData),
+			DataSize: uint64(len(modelData)),
+		}}})
+		_ = stream.Send(&extensionsapi.CreateVersionWithArtifactsRequestChunk{Msg: &extensionsapi.CreateVersionWithArtifactsRequestChunk_Body_{Body: &extensionsapi.CreateVersionWithArtifactsRequestChunk_Body{DataChunk: modelData}}})
+	}
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestExportImportRegistry(t *testing.T) {
+	ctx, err := createContext(t, 16) // For the purpose of the test we limit the sent chunk size drastically
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	for _, modelID := range []string{"bar", "foo"} {
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID, UserData: map[string]string{"team": modelID}}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "foo", true, modelData)
+	ctx.createVersionWithUserData(t, "foo", false, map[string]string{"step": "10"}, modelData[:100])
+	ctx.createVersion(t, "bar", false, modelData)
+
+	{
+		_, err := ctx.exportRegistry(t, []string{"unknown"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+
+	archive, err := ctx.exportRegistry(t, []string{"foo"})
+	assert.NoError(t, err)
+
+	// The exported models already exist
+	{
+		_, err := ctx.importRegistry(t, archive)
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	}
+
+	_, err = ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "foo"})
+	assert.NoError(t, err)
+
+	// A truncated archive imports nothing
+	{
+		_, err := ctx.importRegistry(t, archive[:len(archive)/2])
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = ctx.backend.RetrieveModelInfo("foo")
+		assert.Error(t, err)
+	}
+
+	watchStream, err := ctx.extensionsClient.WatchModels(ctx.grpcCtx, &extensionsapi.WatchModelsRequest{})
+	assert.NoError(t, err)
+	_, err = watchStream.Header()
+	assert.NoError(t, err)
+
+	rep, err := ctx.importRegistry(t, archive)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), rep.ModelsCount)
+	assert.Equal(t, uint32(2), rep.VersionsCount)
+
+	// Imported models are notified as created
+	watchRep, err := watchStream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, extensionsapi.ModelEventType_MODEL_CREATED, watchRep.EventType)
+	assert.Equal(t, "foo", watchRep.ModelInfo.ModelId)
+
+	modelInfo, err := ctx.backend.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "foo"}, modelInfo.UserData)
+	versionInfos, err := ctx.backend.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 2)
+	assert.True(t, versionInfos[0].Archived)
+	assert.Equal(t, map[string]string{"step": "10"}, versionInfos[1].UserData)
+	data, err := ctx.backend.RetrieveModelVersionData("foo", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, modelData[:100], data)
+}
+
+func TestWatchRegistry(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	stream, err := ctx.extensionsClient.WatchRegistry(ctx.grpcCtx, &extensionsapi.WatchRegistryRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Header()
+	assert.NoError(t, err)
+
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+	ctx.createVersion(t, "foo", false, modelData)
+	_, err = ctx.extensionsClient.ArchiveVersion(ctx.grpcCtx, &extensionsapi.ArchiveVersionRequest{ModelId: "foo", VersionNumber: 1})
+	assert.NoError(t, err)
+	_, err = ctx.extensionsClient.DeleteVersion(ctx.grpcCtx, &extensionsapi.DeleteVersionRequest{ModelId: "foo", VersionNumber: 1, Force: true})
+	assert.NoError(t, err)
+	_, err = ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "foo"})
+	assert.NoError(t, err)
+
+	type event struct {
+		modelEventType   extensionsapi.ModelEventType
+		versionEventType extensionsapi.VersionEventType
+		archived         bool
+	}
+	expectedEvents := []event{
+		{modelEventType: extensionsapi.ModelEventType_MODEL_CREATED},
+		{versionEventType: extensionsapi.VersionEventType_VERSION_CREATED},
+		{versionEventType: extensionsapi.VersionEventType_VERSION_UPDATED, archived: true},
+		{versionEventType: extensionsapi.VersionEventType_VERSION_DELETED, archived: true},
+		{modelEventType: extensionsapi.ModelEventType_MODEL_DELETED},
+	}
+	for _, expectedEvent := range expectedEvents {
+		rep, err := stream.Recv()
+		assert.NoError(t, err)
+		if modelEvent := rep.GetModelEvent(); modelEvent != nil {
+			assert.Equal(t, "foo", modelEvent.ModelInfo.ModelId)
+			assert.Equal(t, expectedEvent, event{modelEventType: modelEvent.EventType})
+		} else {
+			versionEvent := rep.GetVersionEvent()
+			assert.Equal(t, "foo", versionEvent.VersionInfo.ModelId)
+			assert.Equal(t, uint32(1), versionEvent.VersionInfo.VersionNumber)
+			assert.Equal(t, expectedEvent, event{versionEventType: versionEvent.EventType, archived: versionEvent.VersionInfo.Archived})
+		}
+	}
+}
+
+func TestSetSentModelVersionDataChunkSize(t *testing.T) {
+	ctx, err := createContext(t, 16)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	_, err = ctx.backend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+		CreationTimestamp: time.Now(),
+		Archived:          true,
+		DataHash:          backend.ComputeSHA256Hash(modelData),
+		Data:              modelData,
+	})
+	assert.NoError(t, err)
+
+	chunkSizes := func() []int {
+		stream, err := ctx.client.RetrieveVersionData(ctx.grpcCtx, &grpcapi.RetrieveVersionDataRequest{ModelId: "foo", VersionNumber: -1})
+		assert.NoError(t, err)
+		chunkSizes := []int{}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				return chunkSizes
+			}
+			assert.NoError(t, err)
+			chunkSizes = append(chunkSizes, len(chunk.DataChunk))
+		}
+	}
+	assert.Equal(t, 16, chunkSizes()[0])
+
+	ctx.registryServer.SetSentModelVersionDataChunkSize(256)
+	sizes := chunkSizes()
+	assert.Equal(t, 256, sizes[0])
+	assert.Len(t, sizes, (len(modelData)+255)/256)
+}
+
+func TestPreferredChunkSize(t *testing.T) {
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize:    16,
+		MinSentModelVersionDataChunkSize: 8,
+		MaxSentModelVersionDataChunkSize: 64,
+		PaginationSecret:                 paginationSecret,
+		HashAlgorithm:                    backend.SHA256HashAlgorithm,
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	_, err = ctx.backend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+		CreationTimestamp: time.Now(),
+		Archived:          true,
+		DataHash:          backend.ComputeSHA256Hash(modelData),
+		Data:              modelData,
+	})
+	assert.NoError(t, err)
+
+	firstChunkSize := func(preferredChunkSize string) (int, error) {
+		grpcCtx := ctx.grpcCtx
+		if preferredChunkSize != "" {
+			grpcCtx = metadata.AppendToOutgoingContext(grpcCtx, preferredChunkSizeMetadataKey, preferredChunkSize)
+		}
+		stream, err := ctx.client.RetrieveVersionData(grpcCtx, &grpcapi.RetrieveVersionDataRequest{ModelId: "foo", VersionNumber: -1})
+		assert.NoError(t, err)
+		chunk, err := stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		return len(chunk.DataChunk), nil
+	}
+	for preferredChunkSize, expectedChunkSize := range map[string]int{"": 16, "0": 16, "32": 32, "4": 8, "1000": 64} {
+		chunkSize, err := firstChunkSize(preferredChunkSize)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedChunkSize, chunkSize, preferredChunkSize)
+	}
+	_, err = firstChunkSize("lots")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	rangeStream, err := ctx.extensionsClient.RetrieveVersionDataRange(ctx.grpcCtx, &extensionsapi.RetrieveVersionDataRangeRequest{ModelId: "foo", VersionNumber: -1, PreferredChunkSize: 32})
+	assert.NoError(t, err)
+	rangeChunk, err := rangeStream.Recv()
+	assert.NoError(t, err)
+	assert.Len(t, rangeChunk.DataChunk, 32)
+
+	latestStream, err := ctx.extensionsClient.RetrieveLatestVersion(ctx.grpcCtx, &extensionsapi.RetrieveLatestVersionRequest{ModelId: "foo", PreferredChunkSize: 1000})
+	assert.NoError(t, err)
+	_, err = latestStream.Recv()
+	assert.NoError(t, err)
+	latestChunk, err := latestStream.Recv()
+	assert.NoError(t, err)
+	assert.Len(t, latestChunk.GetBody().DataChunk, 64)
+
+	_, err = RegisterModelRegistryServer(grpc.NewServer(), ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize:    16,
+		MinSentModelVersionDataChunkSize: 128,
+		MaxSentModelVersionDataChunkSize: 64,
+	})
+	assert.Error(t, err)
+}
+
+func TestShutdown(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+	watchStream, err := ctx.extensionsClient.WatchRegistry(ctx.grpcCtx, &extensionsapi.WatchRegistryRequest{})
+	assert.NoError(t, err)
+	_, err = watchStream.Header()
+	assert.NoError(t, err)
+
+	// An upload in progress when the server stops
+	createStream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+	assert.NoError(t, err)
+	err = createStream.Send(&grpcapi.CreateVersionRequestChunk{
+		Msg: &grpcapi.CreateVersionRequestChunk_Header_{
+			Header: &grpcapi.CreateVersionRequestChunk_Header{
+				VersionInfo: &grpcapi.ModelVersionInfo{
+					ModelId:  "foo",
+					DataHash: backend.ComputeSHA256Hash(modelData),
+					DataSize: uint64(len(modelData)),
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	// Letting the call reach the server
+	time.Sleep(50 * time.Millisecond)
+
+	ctx.registryServer.Shutdown()
+	stopped := make(chan struct{})
+	go func() {
+		ctx.server.GracefulStop()
+		close(stopped)
+	}()
+
+	_, err = watchStream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	select {
+	case <-stopped:
+		t.Fatal("the server stopped before the upload finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	err = createStream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{
+		DataChunk: modelData,
+	}}})
+	assert.NoError(t, err)
+	rep, err := createStream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), rep.VersionInfo.VersionNumber)
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the server didn't stop once the upload finished")
+	}
+}
+
+func TestStreamedVersionData(t *testing.T) {
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 16,
+		PaginationSecret:              paginationSecret,
+		UploadSessionTimeout:          uploadSessionTimeout,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		SentVersionDataBufferedChunks: 2,
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+	ctx.createVersion(t, "foo", true, modelData)
+	ctx.createVersion(t, "foo", true, []byte{})
+
+	retrieveData := func(versionNumber int32) ([]byte, error) {
+		stream, err := ctx.client.RetrieveVersionData(ctx.grpcCtx, &grpcapi.RetrieveVersionDataRequest{ModelId: "foo", VersionNumber: versionNumber})
+		assert.NoError(t, err)
+		data := []byte{}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				return data, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			assert.GreaterOrEqual(t, 16, len(chunk.DataChunk))
+			data = append(data, chunk.DataChunk...)
+		}
+	}
+	data, err := retrieveData(1)
+	assert.NoError(t, err)
+	assert.Equal(t, modelData, data)
+	data, err = retrieveData(-1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{}, data)
+	_, err = retrieveData(3)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// countingBackend counts the ranges of version data read from a backend
+type countingBackend struct {
+	backend.Backend
+	mutex      sync.Mutex
+	readRanges int
+}
+
+func (b *countingBackend) RetrieveModelVersionDataRange(modelID string, versionNumber int, offset uint64, length uint64) ([]byte, error) {
+	b.mutex.Lock()
+	b.readRanges++
+	b.mutex.Unlock()
+	return b.Backend.RetrieveModelVersionDataRange(modelID, versionNumber, offset, length)
+}
+
+func (b *countingBackend) countedReadRanges() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.readRanges
+}
+
+// blockingSender receives the sent chunks once released
+type blockingSender struct {
+	release chan struct{}
+	data    []byte
+}
+
+func (s *blockingSender) Send(chunk *grpcapi.RetrieveVersionDataReplyChunk) error {
+	<-s.release
+	s.data = append(s.data, chunk.DataChunk...)
+	return nil
+}
+
+func TestStreamedVersionDataBackpressure(t *testing.T) {
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	versionInfo, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+		CreationTimestamp: time.Now(),
+		DataHash:          backend.ComputeSHA256Hash(modelData),
+		Data:              modelData,
+	})
+	assert.NoError(t, err)
+
+	server := &ModelRegistryServer{sentVersionDataBufferedChunks: 2}
+	countingBackend := &countingBackend{Backend: b}
+	sender := &blockingSender{release: make(chan struct{})}
+	trackedStream := startVersionDataStream(sender, versionInfo)
+	done := make(chan error)
+	go func() {
+		done <- server.streamVersionData(context.Background(), trackedStream, countingBackend, versionInfo, 16, backendChunkReader(countingBackend, versionInfo))
+	}()
+
+	// A blocked client holds one chunk being sent, the buffered ones and one waiting to be buffered
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 4, countingBackend.countedReadRanges())
+	stats := trackedStream.currentStats()
+	assert.Equal(t, 0, stats.SentBytes)
+	assert.Equal(t, len(modelData), stats.DataSize)
+
+	close(sender.release)
+	assert.NoError(t, <-done)
+	trackedStream.stop(context.Background())
+	assert.Equal(t, modelData, sender.data)
+	stats = trackedStream.currentStats()
+	assert.Equal(t, len(modelData), stats.SentBytes)
+	assert.Greater(t, stats.SendBlockedSeconds, 0.05)
+}
+
+func TestStreamedVersionDataChange(t *testing.T) {
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	versionInfo, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+		CreationTimestamp: time.Now(),
+		DataHash:          backend.ComputeSHA256Hash(modelData),
+		Data:              modelData,
+	})
+	assert.NoError(t, err)
+
+	server := &ModelRegistryServer{sentVersionDataBufferedChunks: 2}
+	sender := &blockingSender{release: make(chan struct{})}
+	trackedStream := startVersionDataStream(sender, versionInfo)
+	defer trackedStream.stop(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- server.streamVersionData(context.Background(), trackedStream, b, versionInfo, 16, backendChunkReader(b, versionInfo))
+	}()
+
+	// Updated while being sent, the client can't use data mixing both versions
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+		VersionNumber:     versionInfo.VersionNumber,
+		CreationTimestamp: time.Now(),
+		DataHash:          backend.ComputeSHA256Hash(modelData[:100]),
+		Data:              modelData[:100],
+	})
+	assert.NoError(t, err)
+	close(sender.release)
+	assert.Equal(t, codes.Aborted, status.Code(<-done))
+}
+
+// presigningBackend presigns fake URLs describing the presigned version
+type presigningBackend struct {
+	backend.Backend
+}
+
+func (b *presigningBackend) PresignModelVersionData(modelID string, versionNumber int, expiration time.Duration) (backend.VersionInfo, string, bool, error) {
+	versionInfo, err := b.Backend.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, "", false, err
+	}
+	return versionInfo, fmt.Sprintf("https://store.test/%s/%d?expiration=%s", modelID, versionInfo.VersionNumber, expiration), true, nil
+}
+
+func TestRetrieveVersionDataURL(t *testing.T) {
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 16,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		PresignedURLExpiration:        time.Hour,
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	_, err = ctx.backend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+		CreationTimestamp: time.Now(),
+		Archived:          true,
+		DataHash:          backend.ComputeSHA256Hash(modelData),
+		Data:              modelData,
+	})
+	assert.NoError(t, err)
+
+	// Backends unable to presign only return the version info
+	rep, err := ctx.extensionsClient.RetrieveVersionDataURL(ctx.grpcCtx, &extensionsapi.RetrieveVersionDataURLRequest{ModelId: "foo", VersionNumber: -1})
+	assert.NoError(t, err)
+	assert.Equal(t, "", rep.Url)
+	assert.Equal(t, uint64(0), rep.ExpirationTimestamp)
+	assert.Equal(t, uint32(1), rep.VersionInfo.VersionNumber)
+	assert.Equal(t, uint64(len(modelData)), rep.VersionInfo.DataSize)
+
+	_, err = ctx.extensionsClient.RetrieveVersionDataURL(ctx.grpcCtx, &extensionsapi.RetrieveVersionDataURLRequest{ModelId: "bar", VersionNumber: 1})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	ctx.registryServer.SetBackend(&presigningBackend{Backend: ctx.backend})
+	before := time.Now()
+	rep, err = ctx.extensionsClient.RetrieveVersionDataURL(ctx.grpcCtx, &extensionsapi.RetrieveVersionDataURLRequest{ModelId: "foo", VersionNumber: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://store.test/foo/1?expiration=1h0m0s", rep.Url)
+	assert.GreaterOrEqual(t, rep.ExpirationTimestamp, nsTimestampFromTime(before.Add(time.Hour)))
+	assert.Equal(t, backend.ComputeSHA256Hash(modelData), rep.VersionInfo.DataHash)
+
+	// The requested expiration is capped by the configured one
+	rep, err = ctx.extensionsClient.RetrieveVersionDataURL(ctx.grpcCtx, &extensionsapi.RetrieveVersionDataURLRequest{ModelId: "foo", VersionNumber: 1, ExpirationSeconds: 60})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://store.test/foo/1?expiration=1m0s", rep.Url)
+	rep, err = ctx.extensionsClient.RetrieveVersionDataURL(ctx.grpcCtx, &extensionsapi.RetrieveVersionDataURLRequest{ModelId: "foo", VersionNumber: 1, ExpirationSeconds: 7200})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://store.test/foo/1?expiration=1h0m0s", rep.Url)
+
+	// Verified retrievals go through the server
+	rep, err = ctx.extensionsClient.RetrieveVersionDataURL(metadata.AppendToOutgoingContext(ctx.grpcCtx, verifyDataHashMetadataKey, "true"), &extensionsapi.RetrieveVersionDataURLRequest{ModelId: "foo", VersionNumber: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "", rep.Url)
+}
+
+func TestRetrieveVersionDataKnownDataHash(t *testing.T) {
+	ctx, err := createContext(t, 16)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	for _, data := range [][]byte{[]byte("first version"), modelData} {
+		_, err = ctx.backend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+			CreationTimestamp: time.Now(),
+			DataHash:          backend.ComputeSHA256Hash(data),
+			Data:              data,
+		})
+		assert.NoError(t, err)
+	}
+
+	receiveVersionData := func(knownDataHash string) ([]byte, int, metadata.MD) {
+		stream, err := ctx.client.RetrieveVersionData(metadata.AppendToOutgoingContext(ctx.grpcCtx, knownDataHashMetadataKey, knownDataHash), &grpcapi.RetrieveVersionDataRequest{ModelId: "foo", VersionNumber: -1})
+		assert.NoError(t, err)
+		data := []byte{}
+		chunks := 0
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			data = append(data, chunk.DataChunk...)
+			chunks++
+		}
+		header, err := stream.Header()
+		assert.NoError(t, err)
+		return data, chunks, header
+	}
+
+	// The data of the latest version isn't sent again
+	data, chunks, header := receiveVersionData(backend.ComputeSHA256Hash(modelData))
+	assert.Equal(t, 0, chunks)
+	assert.Len(t, data, 0)
+	assert.Equal(t, []string{"true"}, header.Get(notModifiedMetadataKey))
+
+	data, _, header = receiveVersionData(backend.ComputeSHA256Hash([]byte("first version")))
+	assert.Equal(t, modelData, data)
+	assert.Len(t, header.Get(notModifiedMetadataKey), 0)
+
+	{
+		stream, err := ctx.extensionsClient.RetrieveLatestVersion(ctx.grpcCtx, &extensionsapi.RetrieveLatestVersionRequest{ModelId: "foo", KnownDataHash: backend.ComputeSHA256Hash(modelData)})
+		assert.NoError(t, err)
+		chunk, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.True(t, chunk.GetHeader().NotModified)
+		assert.Equal(t, 2, int(chunk.GetHeader().VersionInfo.VersionNumber))
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err)
+	}
+	{
+		stream, err := ctx.extensionsClient.RetrieveLatestVersion(ctx.grpcCtx, &extensionsapi.RetrieveLatestVersionRequest{ModelId: "foo", KnownDataHash: backend.ComputeSHA256Hash([]byte("first version"))})
+		assert.NoError(t, err)
+		chunk, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.False(t, chunk.GetHeader().NotModified)
+		chunk, err = stream.Recv()
+		assert.NoError(t, err)
+		assert.NotNil(t, chunk.GetBody())
+	}
+}
+
+func TestRetrieveLatestVersionDataIfChanged(t *testing.T) {
+	ctx, err := createContext(t, 16)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	for _, data := range [][]byte{modelData, []byte("second version"), modelData} {
+		_, err = ctx.backend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+			CreationTimestamp: time.Now(),
+			DataHash:          backend.ComputeSHA256Hash(data),
+			Data:              data,
+		})
+		assert.NoError(t, err)
+	}
+
+	retrieve := func(req *extensionsapi.RetrieveLatestVersionDataIfChangedRequest) (*extensionsapi.RetrieveLatestVersionReplyChunk_Header, []byte) {
+		stream, err := ctx.extensionsClient.RetrieveLatestVersionDataIfChanged(ctx.grpcCtx, req)
+		assert.NoError(t, err)
+		chunk, err := stream.Recv()
+		assert.NoError(t, err)
+		data := []byte{}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			data = append(data, chunk.GetBody().DataChunk...)
+		}
+		return chunk.GetHeader(), data
+	}
+
+	header, data := retrieve(&extensionsapi.RetrieveLatestVersionDataIfChangedRequest{ModelId: "foo"})
+	assert.False(t, header.NotModified)
+	assert.Equal(t, 3, int(header.VersionInfo.VersionNumber))
+	assert.Equal(t, modelData, data)
+
+	header, data = retrieve(&extensionsapi.RetrieveLatestVersionDataIfChangedRequest{ModelId: "foo", KnownVersionNumber: 2})
+	assert.False(t, header.NotModified)
+	assert.Equal(t, modelData, data)
+
+	header, data = retrieve(&extensionsapi.RetrieveLatestVersionDataIfChangedRequest{ModelId: "foo", KnownVersionNumber: 3})
+	assert.True(t, header.NotModified)
+	assert.Equal(t, 3, int(header.VersionInfo.VersionNumber))
+	assert.Len(t, data, 0)
+
+	// A newer version with the same data isn't sent again
+	header, data = retrieve(&extensionsapi.RetrieveLatestVersionDataIfChangedRequest{ModelId: "foo", KnownVersionNumber: 1, KnownDataHash: backend.ComputeSHA256Hash(modelData)})
+	assert.True(t, header.NotModified)
+	assert.Len(t, data, 0)
+
+	stream, err := ctx.extensionsClient.RetrieveLatestVersionDataIfChanged(ctx.grpcCtx, &extensionsapi.RetrieveLatestVersionDataIfChangedRequest{ModelId: "bar"})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// recordingListener records the created versions it is notified of
+type recordingListener struct {
+	mutex        sync.Mutex
+	versionInfos []backend.VersionInfo
+}
+
+func (l *recordingListener) VersionCreated(versionInfo backend.VersionInfo) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.versionInfos = append(l.versionInfos, versionInfo)
+}
+
+func TestVersionCreationListener(t *testing.T) {
+	ctx, err := createContext(t, 16)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	listener := &recordingListener{}
+	ctx.registryServer.AddVersionCreationListener(listener)
+
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+	stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+	assert.NoError(t, err)
+	err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Header_{Header: &grpcapi.CreateVersionRequestChunk_Header{
+		VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData))},
+	}}})
+	assert.NoError(t, err)
+	err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{DataChunk: modelData}}})
+	assert.NoError(t, err)
+	_, err = stream.CloseAndRecv()
+	assert.NoError(t, err)
+
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+	assert.Len(t, listener.versionInfos, 1)
+	assert.Equal(t, "foo", listener.versionInfos[0].ModelID)
+	assert.Equal(t, uint(1), listener.versionInfos[0].VersionNumber)
+}
+
+func TestRestoreVersion(t *testing.T) {
+	ctx, err := createContext(t, 16)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	_, err = ctx.extensionsClient.RestoreVersion(ctx.grpcCtx, &extensionsapi.RestoreVersionRequest{ModelId: "foo", VersionNumber: 1})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	primaryBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer primaryBackend.Destroy()
+	coldBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer coldBackend.Destroy()
+	coldStorageBackend, err := coldStorage.CreateBackend(primaryBackend, coldBackend)
+	assert.NoError(t, err)
+	b, err := memoryCache.CreateBackend(memoryCache.VersionCacheConfiguration{MaxItems: 20}, coldStorageBackend)
+	assert.NoError(t, err)
+	defer b.Destroy()
+	ctx.registryServer.SetBackend(b)
+	ctx.registryServer.SetColdStorageBackend(coldStorageBackend)
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	_, err = b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+		CreationTimestamp: time.Now(),
+		Archived:          true,
+		DataHash:          backend.ComputeSHA256Hash(modelData),
+		Data:              modelData,
+	})
+	assert.NoError(t, err)
+
+	_, err = ctx.extensionsClient.RestoreVersion(ctx.grpcCtx, &extensionsapi.RestoreVersionRequest{ModelId: "foo", VersionNumber: 2})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Not moved yet
+	rep, err := ctx.extensionsClient.RestoreVersion(ctx.grpcCtx, &extensionsapi.RestoreVersionRequest{ModelId: "foo", VersionNumber: -1})
+	assert.NoError(t, err)
+	assert.False(t, rep.Restored)
+
+	moved, err := coldStorageBackend.MoveModelVersion("foo", 1, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, moved)
+
+	rep, err = ctx.extensionsClient.RestoreVersion(ctx.grpcCtx, &extensionsapi.RestoreVersionRequest{ModelId: "foo", VersionNumber: 1})
+	assert.NoError(t, err)
+	assert.True(t, rep.Restored)
+	assert.Equal(t, uint32(1), rep.VersionInfo.VersionNumber)
+	assert.Equal(t, backend.ComputeSHA256Hash(modelData), rep.VersionInfo.DataHash)
+	assert.Empty(t, rep.VersionInfo.UserData)
+	coldVersionInfos, err := coldBackend.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Empty(t, coldVersionInfos)
+	data, err := primaryBackend.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, modelData, data)
+}
+
+func TestRunGarbageCollection(t *testing.T) {
+	ctx, err := createContext(t, 16)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	_, err = ctx.extensionsClient.RunGarbageCollection(ctx.grpcCtx, &extensionsapi.RunGarbageCollectionRequest{DryRun: true})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = ctx.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{retention.MaxCountUserDataKey: "1"}})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = ctx.backend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+			CreationTimestamp: time.Now(),
+			DataHash:          backend.ComputeSHA256Hash(modelData),
+			Data:              modelData,
+		})
+		assert.NoError(t, err)
+	}
+	ctx.registryServer.SetRetentionCollector(retention.CreateCollector(ctx.backend, retention.Configuration{Interval: time.Hour}))
+
+	rep, err := ctx.extensionsClient.RunGarbageCollection(ctx.grpcCtx, &extensionsapi.RunGarbageCollectionRequest{DryRun: true})
+	assert.NoError(t, err)
+	assert.True(t, rep.DryRun)
+	assert.Len(t, rep.CollectedVersions, 2)
+	assert.Equal(t, "foo", rep.CollectedVersions[0].ModelId)
+	assert.Equal(t, uint32(1), rep.CollectedVersions[0].VersionNumber)
+	assert.Equal(t, uint64(len(modelData)), rep.CollectedVersions[0].DataSize)
+	assert.Equal(t, uint64(2*len(modelData)), rep.ReclaimedBytes)
+	versionInfos, err := ctx.backend.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 3)
+
+	rep, err = ctx.extensionsClient.RunGarbageCollection(ctx.grpcCtx, &extensionsapi.RunGarbageCollectionRequest{})
+	assert.NoError(t, err)
+	assert.False(t, rep.DryRun)
+	assert.Len(t, rep.CollectedVersions, 2)
+	versionInfos, err = ctx.backend.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 1)
+	assert.Equal(t, uint(3), versionInfos[0].VersionNumber)
+}
+
+func TestRunFsck(t *testing.T) {
+	ctx, err := createContext(t, 16)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	_, err = ctx.backend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = ctx.backend.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+			CreationTimestamp: time.Now(),
+			DataHash:          backend.ComputeSHA256Hash(modelData),
+			Data:              modelData,
+		})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, ctx.backend.DeleteModelVersion("foo", 2))
+
+	rep, err := ctx.extensionsClient.RunFsck(ctx.grpcCtx, &extensionsapi.RunFsckRequest{Repair: true})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), rep.CheckedModels)
+	assert.Equal(t, uint32(2), rep.CheckedVersions)
+	assert.Len(t, rep.Problems, 1)
+	assert.Equal(t, "gap", rep.Problems[0].Kind)
+	assert.Equal(t, uint32(2), rep.Problems[0].VersionNumber)
+	assert.False(t, rep.Problems[0].Repaired)
+
+	_, err = ctx.extensionsClient.RunFsck(ctx.grpcCtx, &extensionsapi.RunFsckRequest{ModelIds: []string{"bar"}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+type recordingEventListener struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (l *recordingEventListener) ModelEvent(eventType extensionsapi.ModelEventType, modelInfo backend.ModelInfo) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.events = append(l.events, fmt.Sprintf("%s %s", eventType, modelInfo.ModelID))
+}
+
+func (l *recordingEventListener) VersionEvent(eventType extensionsapi.VersionEventType, versionInfo backend.VersionInfo) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.events = append(l.events, fmt.Sprintf("%s %s/%d archived=%t", eventType, versionInfo.ModelID, versionInfo.VersionNumber, versionInfo.Archived))
+}
+
+func TestEventListener(t *testing.T) {
+	ctx, err := createContext(t, 16)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	listener := &recordingEventListener{}
+	ctx.registryServer.AddEventListener(listener)
+
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+	stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+	assert.NoError(t, err)
+	err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Header_{Header: &grpcapi.CreateVersionRequestChunk_Header{
+		VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: backend.ComputeSHA256Hash(modelData), DataSize: uint64(len(modelData))},
+	}}})
+	assert.NoError(t, err)
+	err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{DataChunk: modelData}}})
+	assert.NoError(t, err)
+	_, err = stream.CloseAndRecv()
+	assert.NoError(t, err)
+	_, err = ctx.extensionsClient.ArchiveVersion(ctx.grpcCtx, &extensionsapi.ArchiveVersionRequest{ModelId: "foo", VersionNumber: 1})
+	assert.NoError(t, err)
+	_, err = ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "foo"})
+	assert.NoError(t, err)
+
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+	assert.Equal(t, []string{
+		"MODEL_CREATED foo",
+		"VERSION_CREATED foo/1 archived=false",
+		"VERSION_UPDATED foo/1 archived=true",
+		"MODEL_DELETED foo",
+	}, listener.events)
+}
+
+func TestSnapshots(t *testing.T) {
+	{
+		ctx, err := createContext(t, 16)
+		assert.NoError(t, err)
+		defer ctx.destroy()
+		_, err = ctx.extensionsClient.SaveSnapshot(ctx.grpcCtx, &extensionsapi.SaveSnapshotRequest{})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+
+	snapshotDir := t.TempDir()
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 16,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		SnapshotDir:                   snapshotDir,
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	for _, modelID := range []string{"bar", "foo"} {
+		_, err := ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: modelID}})
+		assert.NoError(t, err)
+	}
+	ctx.createVersion(t, "foo", true, modelData)
+	// Non-archived versions are only held in memory, they are saved as well
+	ctx.createVersion(t, "foo", false, modelData[:100])
+	ctx.createVersion(t, "bar", false, modelData)
+
+	rep, err := ctx.extensionsClient.SaveSnapshot(ctx.grpcCtx, &extensionsapi.SaveSnapshotRequest{Name: "fixtures.tar"})
+	assert.NoError(t, err)
+	assert.Equal(t, "fixtures.tar", rep.Name)
+	assert.Equal(t, uint32(2), rep.ModelsCount)
+	assert.Equal(t, uint32(3), rep.VersionsCount)
+	_, err = ctx.extensionsClient.SaveSnapshot(ctx.grpcCtx, &extensionsapi.SaveSnapshotRequest{Name: "fixtures.tar"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	for _, name := range []string{"..", "../fixtures.tar", "snapshots/fixtures.tar"} {
+		_, err = ctx.extensionsClient.SaveSnapshot(ctx.grpcCtx, &extensionsapi.SaveSnapshotRequest{Name: name})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), name)
+	}
+	rep, err = ctx.extensionsClient.SaveSnapshot(ctx.grpcCtx, &extensionsapi.SaveSnapshotRequest{})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rep.Name, "snapshot-"))
+	entries, err := ioutil.ReadDir(snapshotDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "baz"}})
+	assert.NoError(t, err)
+	ctx.createVersion(t, "foo", false, modelData[:10])
+
+	_, err = ctx.extensionsClient.LoadSnapshot(ctx.grpcCtx, &extensionsapi.LoadSnapshotRequest{Name: "unknown.tar"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	// Without overwrite, the existing models are rejected
+	_, err = ctx.extensionsClient.LoadSnapshot(ctx.grpcCtx, &extensionsapi.LoadSnapshotRequest{Name: "fixtures.tar"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	// A truncated snapshot is rejected before deleting the existing models
+	snapshotContent, err := ioutil.ReadFile(filepath.Join(snapshotDir, "fixtures.tar"))
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(snapshotDir, "truncated.tar"), snapshotContent[:len(snapshotContent)/2], 0644))
+	_, err = ctx.extensionsClient.LoadSnapshot(ctx.grpcCtx, &extensionsapi.LoadSnapshotRequest{Name: "truncated.tar", Overwrite: true})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	for _, modelID := range []string{"bar", "baz", "foo"} {
+		hasModel, err := ctx.backend.HasModel(modelID)
+		assert.NoError(t, err)
+		assert.True(t, hasModel, modelID)
+	}
+	versionInfos, err := ctx.backend.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 3)
+
+	// A locked version prevents the deletion of the existing models, like for DeleteModel
+	_, err = ctx.extensionsClient.LockVersion(ctx.grpcCtx, &extensionsapi.LockVersionRequest{ModelId: "foo", VersionNumber: 3})
+	assert.NoError(t, err)
+	_, err = ctx.extensionsClient.LoadSnapshot(ctx.grpcCtx, &extensionsapi.LoadSnapshotRequest{Name: "fixtures.tar", Overwrite: true})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	hasModel, err := ctx.backend.HasModel("baz")
+	assert.NoError(t, err)
+	assert.True(t, hasModel)
+	_, err = ctx.extensionsClient.UnlockVersion(ctx.grpcCtx, &extensionsapi.UnlockVersionRequest{ModelId: "foo", VersionNumber: 3})
+	assert.NoError(t, err)
+
+	loadRep, err := ctx.extensionsClient.LoadSnapshot(ctx.grpcCtx, &extensionsapi.LoadSnapshotRequest{Name: "fixtures.tar", Overwrite: true})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), loadRep.DeletedModelsCount)
+	assert.Equal(t, uint32(2), loadRep.ModelsCount)
+	assert.Equal(t, uint32(3), loadRep.VersionsCount)
+	hasModel, err = ctx.backend.HasModel("baz")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+	versionInfos, err = ctx.backend.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 2)
+	data, err := ctx.backend.RetrieveModelVersionData("foo", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, modelData[:100], data)
+}
+
+func TestSetMaintenance(t *testing.T) {
+	{
+		ctx, err := createContext(t, 16)
+		assert.NoError(t, err)
+		defer ctx.destroy()
+		_, err = ctx.extensionsClient.SetMaintenance(ctx.grpcCtx, &extensionsapi.SetMaintenanceRequest{Enabled: true})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+
+	gate := maintenance.CreateGate(maintenance.Configuration{MaxQueuedRequests: 1, QueueTimeout: time.Minute}, func(method string) bool { return true })
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 16,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		Maintenance:                   gate,
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	rep, err := ctx.extensionsClient.SetMaintenance(ctx.grpcCtx, &extensionsapi.SetMaintenanceRequest{Enabled: true, Reason: "swap"})
+	assert.NoError(t, err)
+	assert.True(t, rep.Enabled)
+	assert.Equal(t, "swap", rep.Reason)
+	assert.NotZero(t, rep.Since)
+	assert.True(t, gate.State().Active)
+	// Enabling it again reports the current maintenance
+	rep, err = ctx.extensionsClient.SetMaintenance(ctx.grpcCtx, &extensionsapi.SetMaintenanceRequest{Enabled: true, Reason: "other"})
+	assert.NoError(t, err)
+	assert.Equal(t, "swap", rep.Reason)
+
+	rep, err = ctx.extensionsClient.SetMaintenance(ctx.grpcCtx, &extensionsapi.SetMaintenanceRequest{})
+	assert.NoError(t, err)
+	assert.False(t, rep.Enabled)
+	assert.Zero(t, rep.Since)
+	assert.False(t, gate.State().Active)
+}
+
+func TestErrorDetails(t *testing.T) {
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 1024 * 1024,
+		PaginationSecret:              paginationSecret,
+		UploadSessionTimeout:          uploadSessionTimeout,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		MaxVersionDataSize:            uint64(len(modelData)),
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	errorDetails := func(err error) (extensionsapi.ErrorReason, map[string]string) {
+		for _, detail := range status.Convert(err).Details() {
+			if errorDetails, ok := detail.(*extensionsapi.ErrorDetails); ok {
+				return errorDetails.Reason, errorDetails.Metadata
+			}
+		}
+		return extensionsapi.ErrorReason_UNKNOWN_ERROR_REASON, nil
+	}
+	createVersion := func(dataHash string, data []byte) error {
+		stream, err := ctx.client.CreateVersion(ctx.grpcCtx)
+		assert.NoError(t, err)
+		err = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Header_{Header: &grpcapi.CreateVersionRequestChunk_Header{
+			VersionInfo: &grpcapi.ModelVersionInfo{ModelId: "foo", DataHash: dataHash, DataSize: uint64(len(data))},
+		}}})
+		assert.NoError(t, err)
+		_ = stream.Send(&grpcapi.CreateVersionRequestChunk{Msg: &grpcapi.CreateVersionRequestChunk_Body_{Body: &grpcapi.CreateVersionRequestChunk_Body{DataChunk: data}}})
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+
+	_, err = ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "bar"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	reason, metadata := errorDetails(err)
+	assert.Equal(t, extensionsapi.ErrorReason_MODEL_NOT_FOUND, reason)
+	assert.Equal(t, map[string]string{"model_id": "bar"}, metadata)
+
+	_, err = ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "foo", VersionNumbers: []int32{3}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	reason, metadata = errorDetails(err)
+	assert.Equal(t, extensionsapi.ErrorReason_VERSION_NOT_FOUND, reason)
+	assert.Equal(t, map[string]string{"model_id": "foo", "version_number": "3"}, metadata)
+
+	err = createVersion(backend.ComputeSHA256Hash(modelData[:20]), modelData)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	reason, metadata = errorDetails(err)
+	assert.Equal(t, extensionsapi.ErrorReason_HASH_MISMATCH, reason)
+	assert.Equal(t, map[string]string{
+		"model_id":           "foo",
+		"expected_data_hash": backend.ComputeSHA256Hash(modelData[:20]),
+		"data_hash":          backend.ComputeSHA256Hash(modelData),
+	}, metadata)
+
+	largeData := append(append([]byte{}, modelData...), modelData...)
+	err = createVersion(backend.ComputeSHA256Hash(largeData), largeData)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	reason, metadata = errorDetails(err)
+	assert.Equal(t, extensionsapi.ErrorReason_QUOTA_EXCEEDED, reason)
+	assert.Equal(t, "bytes", metadata["resource"])
+
+	// Errors whose reason isn't known don't have details
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: ""}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	reason, _ = errorDetails(err)
+	assert.Equal(t, extensionsapi.ErrorReason_UNKNOWN_ERROR_REASON, reason)
+}
+
+func TestPublishVersion(t *testing.T) {
+	ctx, err := createContextWithConfiguration(t, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 1024 * 1024,
+		PaginationSecret:              paginationSecret,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		MaxVersionDataSize:            uint64(len(modelData)),
+	})
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	_, err = ctx.registryServer.PublishVersion(ctx.grpcCtx, "foo", PublishedVersionArgs{}, bytes.NewReader(modelData))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	creationTimestamp := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	versionInfo, err := ctx.registryServer.PublishVersion(ctx.grpcCtx, "foo", PublishedVersionArgs{
+		CreationTimestamp: creationTimestamp,
+		UserData:          map[string]string{"step": "1"},
+	}, bytes.NewReader(modelData))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	assert.True(t, creationTimestamp.Equal(versionInfo.CreationTimestamp))
+	assert.Equal(t, backend.ComputeSHA256Hash(modelData), versionInfo.DataHash)
+	assert.Equal(t, len(modelData), versionInfo.DataSize)
+
+	// The published versions are the ones served through the API
+	rep, err := ctx.client.RetrieveVersionInfos(ctx.grpcCtx, &grpcapi.RetrieveVersionInfosRequest{ModelId: "foo", VersionNumbers: []int32{1}})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", rep.VersionInfos[0].UserData["step"])
+
+	_, err = ctx.registryServer.PublishVersion(ctx.grpcCtx, "foo", PublishedVersionArgs{DataHash: backend.ComputeSHA256Hash([]byte("other"))}, bytes.NewReader(modelData))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	largeData := append(append([]byte{}, modelData...), modelData...)
+	_, err = ctx.registryServer.PublishVersion(ctx.grpcCtx, "foo", PublishedVersionArgs{}, bytes.NewReader(largeData))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = ctx.registryServer.PublishVersion(ctx.grpcCtx, "foo", PublishedVersionArgs{}, iotest.TimeoutReader(bytes.NewReader(modelData)))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	canceledCtx, cancel := context.WithCancel(ctx.grpcCtx)
+	cancel()
+	_, err = ctx.registryServer.PublishVersion(canceledCtx, "foo", PublishedVersionArgs{}, bytes.NewReader(modelData))
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	// The rejected publications didn't create any version
+	latestVersionNumber, err := ctx.backend.RetrieveModelLatestVersionNumber("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), latestVersionNumber)
+}
+
+func TestSubscribeVersions(t *testing.T) {
+	ctx, err := createContext(t, 1024*1024)
+	assert.NoError(t, err)
+	defer ctx.destroy()
+
+	_, err = ctx.registryServer.SubscribeVersions(ctx.grpcCtx, "foo")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+
+	subscription, err := ctx.registryServer.SubscribeVersions(ctx.grpcCtx, "foo")
+	assert.NoError(t, err)
+	watchStream, err := ctx.extensionsClient.WatchVersions(ctx.grpcCtx, &extensionsapi.WatchVersionsRequest{ModelId: "foo"})
+	assert.NoError(t, err)
+	_, err = watchStream.Header()
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := ctx.registryServer.PublishVersion(ctx.grpcCtx, "foo", PublishedVersionArgs{Archived: i%2 == 0}, bytes.NewReader(modelData))
+		assert.NoError(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		assert.True(t, subscription.Next())
+		assert.Equal(t, uint(i+1), subscription.VersionInfo().VersionNumber)
+		assert.Equal(t, i%2 == 0, subscription.VersionInfo().Archived)
+		// The watchers through the API are notified as well
+		rep, err := watchStream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, i+1, int(rep.VersionInfo.VersionNumber))
+	}
+
+	// The subscription ends without error when the model is deleted
+	_, err = ctx.client.DeleteModel(ctx.grpcCtx, &grpcapi.DeleteModelRequest{ModelId: "foo"})
+	assert.NoError(t, err)
+	assert.False(t, subscription.Next())
+	assert.NoError(t, subscription.Err())
+
+	_, err = ctx.client.CreateOrUpdateModel(ctx.grpcCtx, &grpcapi.CreateOrUpdateModelRequest{ModelInfo: &grpcapi.ModelInfo{ModelId: "foo"}})
+	assert.NoError(t, err)
+	subscriptionCtx, cancel := context.WithCancel(ctx.grpcCtx)
+	subscription, err = ctx.registryServer.SubscribeVersions(subscriptionCtx, "foo")
+	assert.NoError(t, err)
+	cancel()
+	assert.False(t, subscription.Next())
+	assert.Equal(t, codes.Canceled, status.Code(subscription.Err()))
+
+	subscription, err = ctx.registryServer.SubscribeVersions(ctx.grpcCtx, "foo")
+	assert.NoError(t, err)
+	ctx.registryServer.Shutdown()
+	assert.False(t, subscription.Next())
+	assert.Equal(t, codes.Unavailable, status.Code(subscription.Err()))
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"context"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Model user data key storing the revision of a model, set once the model is updated with an expected revision and
+// then incremented by every CreateOrUpdateModel call
+const ModelRevisionUserDataKey = "cogment_model_registry.revision"
+
+// Metadata key letting clients update a model with CreateOrUpdateModel only if it is still at a revision, missing
+// models and models without a revision are at revision 0
+const expectedModelRevisionMetadataKey = "cogment-model-registry-expected-revision"
+
+// requestedExpectedModelRevision retrieves the revision expected by the client using the
+// `cogment-model-registry-expected-revision: <revision>` metadata, false if not provided
+func requestedExpectedModelRevision(ctx context.Context) (uint64, bool, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(expectedModelRevisionMetadataKey)
+	if len(values) == 0 {
+		return 0, false, nil
+	}
+	revision, err := strconv.ParseUint(values[0], 10, 64)
+	if err != nil {
+		return 0, false, status.Errorf(codes.InvalidArgument, "invalid %q metadata %q, expecting a revision number", expectedModelRevisionMetadataKey, values[0])
+	}
+	return revision, true, nil
+}
+
+// modelRevision retrieves the revision of a model from its user data, 0 when it has none
+func modelRevision(userData map[string]string) uint64 {
+	revision, err := strconv.ParseUint(userData[ModelRevisionUserDataKey], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return revision
+}
+
+// checkExpectedModelRevision rejects the update of a model that isn't at the revision expected by the client
+func checkExpectedModelRevision(modelID string, currentUserData map[string]string, expectedRevision uint64) error {
+	if currentRevision := modelRevision(currentUserData); currentRevision != expectedRevision {
+		return status.Errorf(codes.FailedPrecondition, "unable to update model %q expected at revision \"%d\", it is at revision \"%d\"", modelID, expectedRevision, currentRevision)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/namespaces"
+)
+
+// checkModelNamespace rejects the creation of a model outside of the declared namespaces when they are required
+func (s *ModelRegistryServer) checkModelNamespace(modelID string) error {
+	if s.namespaces == nil {
+		return nil
+	}
+	if err := s.namespaces.CheckModelID(modelID); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	return nil
+}
+
+// checkNamespaceQuota rejects with RESOURCE_EXHAUSTED the additions making the namespace of a model exceed its quota
+//
+// The usage is computed when the addition starts, concurrent additions to the same namespace can exceed the quota.
+func (s *ModelRegistryServer) checkNamespaceQuota(b backend.Backend, modelID string, added namespaces.Usage) error {
+	if s.namespaces == nil {
+		return nil
+	}
+	namespace := namespaces.Namespace(modelID)
+	quota := s.namespaces.Quota(namespace)
+	if !quota.IsLimited() {
+		return nil
+	}
+	usage, err := namespaces.RetrieveUsage(b, namespace)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unexpected error while checking the quota of namespace %q: %s", namespace, err)
+	}
+	if err := quota.Check(namespace, usage, added); err != nil {
+		return errorStatus(codes.ResourceExhausted, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"sync"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// Number of registry events buffered for a subscriber before it is considered too slow and unsubscribed, larger than
+// for the other watches as every change of every model is dispatched
+const registrySubscriptionBufferSize = 256
+
+type versionEventType int
+
+const (
+	versionCreated versionEventType = iota
+	versionUpdated
+	versionDeleted
+)
+
+type versionEvent struct {
+	eventType   versionEventType
+	versionInfo backend.VersionInfo
+}
+
+// registryEvent is a change made to a model or to a version, exactly one of its fields is defined
+type registryEvent struct {
+	modelEvent   *modelEvent
+	versionEvent *versionEvent
+}
+
+type registrySubscription struct {
+	events chan registryEvent
+	// overflowed is set when the subscription was closed because the subscriber didn't keep up
+	overflowed bool
+}
+
+// registryBroadcaster dispatches every change made to the models and versions through the server to the subscribers
+type registryBroadcaster struct {
+	mutex         sync.Mutex
+	subscriptions map[*registrySubscription]struct{}
+}
+
+func createRegistryBroadcaster() *registryBroadcaster {
+	return &registryBroadcaster{
+		subscriptions: make(map[*registrySubscription]struct{}),
+	}
+}
+
+// subscribe registers a subscription to every change, its channel is closed when the subscriber doesn't keep up or
+// when unsubscribe is called.
+func (rb *registryBroadcaster) subscribe() *registrySubscription {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	subscription := &registrySubscription{events: make(chan registryEvent, registrySubscriptionBufferSize)}
+	rb.subscriptions[subscription] = struct{}{}
+	return subscription
+}
+
+func (rb *registryBroadcaster) unsubscribe(subscription *registrySubscription) {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	if _, ok := rb.subscriptions[subscription]; !ok {
+		return
+	}
+	close(subscription.events)
+	delete(rb.subscriptions, subscription)
+}
+
+// publish sends an event to every subscriber without blocking
+func (rb *registryBroadcaster) publish(event registryEvent) {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	for subscription := range rb.subscriptions {
+		select {
+		case subscription.events <- event:
+		default:
+			subscription.overflowed = true
+			close(subscription.events)
+			delete(rb.subscriptions, subscription)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSConfiguration configures the TLS credentials of the server
+type TLSConfiguration struct {
+	CertFile     string // PEM encoded certificate chain of the server
+	KeyFile      string // PEM encoded private key of the server
+	ClientCAFile string // If defined, clients need to present a certificate signed by one of these PEM encoded CAs
+}
+
+// CreateTLSCredentials creates the transport credentials serving TLS, and verifying client certificates if a client CA is configured
+func CreateTLSCredentials(configuration TLSConfiguration) (credentials.TransportCredentials, error) {
+	certificate, err := tls.LoadX509KeyPair(configuration.CertFile, configuration.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the TLS certificate from %q and %q: %w", configuration.CertFile, configuration.KeyFile, err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if configuration.ClientCAFile != "" {
+		clientCAs, err := os.ReadFile(configuration.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the TLS client CA from %q: %w", configuration.ClientCAFile, err)
+		}
+		clientCAPool := x509.NewCertPool()
+		if !clientCAPool.AppendCertsFromPEM(clientCAs) {
+			return nil, fmt.Errorf("unable to parse the TLS client CA from %q: no PEM encoded certificate found", configuration.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = clientCAPool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certPEM     []byte
+	keyPEM      []byte
+}
+
+// createTestCertificate creates a certificate for "bufnet", self signed if no parent is given
+func createTestCertificate(t *testing.T, serialNumber int64, isCA bool, parent *testCertificate) testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serialNumber),
+		Subject:               pkix.Name{CommonName: "bufnet"},
+		DNSNames:              []string{"bufnet"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	parentCertificate, parentKey := template, key
+	if parent != nil {
+		parentCertificate, parentKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCertificate, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return testCertificate{
+		certificate: certificate,
+		key:         key,
+		certPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:      pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeTestFile(t *testing.T, dirname string, filename string, content []byte) string {
+	path := filepath.Join(dirname, filename)
+	assert.NoError(t, os.WriteFile(path, content, 0600))
+	return path
+}
+
+// dialTLSServer starts a server using the given credentials and returns a client using the given TLS configuration
+func dialTLSServer(t *testing.T, serverCredentials credentials.TransportCredentials, clientTLSConfig *tls.Config) (grpcapi.ModelRegistrySPClient, func()) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.Creds(serverCredentials))
+	modelRegistryServer, err := RegisterModelRegistryServer(server, ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 1024 * 1024,
+		PaginationSecret:              paginationSecret,
+		UploadSessionTimeout:          uploadSessionTimeout,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+	})
+	assert.NoError(t, err)
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	modelRegistryServer.SetBackend(b)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	connection, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(credentials.NewTLS(clientTLSConfig)),
+	)
+	assert.NoError(t, err)
+	return grpcapi.NewModelRegistrySPClient(connection), func() {
+		connection.Close()
+		server.Stop()
+		b.Destroy()
+	}
+}
+
+func TestTLSCredentials(t *testing.T) {
+	dirname := t.TempDir()
+	ca := createTestCertificate(t, 1, true, nil)
+	serverCertificate := createTestCertificate(t, 2, false, &ca)
+	clientCertificate := createTestCertificate(t, 3, false, &ca)
+	otherCA := createTestCertificate(t, 4, true, nil)
+	otherClientCertificate := createTestCertificate(t, 5, false, &otherCA)
+
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca.certificate)
+	configuration := TLSConfiguration{
+		CertFile: writeTestFile(t, dirname, "server.crt", serverCertificate.certPEM),
+		KeyFile:  writeTestFile(t, dirname, "server.key", serverCertificate.keyPEM),
+	}
+
+	{
+		// Without client certificate verification
+		serverCredentials, err := CreateTLSCredentials(configuration)
+		assert.NoError(t, err)
+		client, closeServer := dialTLSServer(t, serverCredentials, &tls.Config{RootCAs: caPool})
+		defer closeServer()
+		_, err = client.RetrieveModels(context.Background(), &grpcapi.RetrieveModelsRequest{})
+		assert.NoError(t, err)
+	}
+
+	configuration.ClientCAFile = writeTestFile(t, dirname, "ca.crt", ca.certPEM)
+	serverCredentials, err := CreateTLSCredentials(configuration)
+	assert.NoError(t, err)
+	for _, c := range []struct {
+		name              string
+		clientCertificate *testCertificate
+		expectSuccess     bool
+	}{
+		{name: "without client certificate", clientCertificate: nil, expectSuccess: false},
+		{name: "with an unknown client certificate", clientCertificate: &otherClientCertificate, expectSuccess: false},
+		{name: "with a client certificate", clientCertificate: &clientCertificate, expectSuccess: true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			clientTLSConfig := &tls.Config{RootCAs: caPool}
+			if c.clientCertificate != nil {
+				keyPair, err := tls.X509KeyPair(c.clientCertificate.certPEM, c.clientCertificate.keyPEM)
+				assert.NoError(t, err)
+				clientTLSConfig.Certificates = []tls.Certificate{keyPair}
+			}
+			client, closeServer := dialTLSServer(t, serverCredentials, clientTLSConfig)
+			defer closeServer()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err := client.RetrieveModels(ctx, &grpcapi.RetrieveModelsRequest{})
+			if c.expectSuccess {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestTLSCredentialsErrors(t *testing.T) {
+	dirname := t.TempDir()
+	certificate := createTestCertificate(t, 1, false, nil)
+	configuration := TLSConfiguration{
+		CertFile: writeTestFile(t, dirname, "server.crt", certificate.certPEM),
+		KeyFile:  filepath.Join(dirname, "missing.key"),
+	}
+	_, err := CreateTLSCredentials(configuration)
+	assert.Error(t, err)
+
+	configuration.KeyFile = writeTestFile(t, dirname, "server.key", certificate.keyPEM)
+	configuration.ClientCAFile = writeTestFile(t, dirname, "ca.crt", []byte("not a certificate"))
+	_, err = CreateTLSCredentials(configuration)
+	assert.Error(t, err)
+}
@@ -0,0 +1,250 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// uploadSession accumulates the data of a version in a temporary file until it is committed
+type uploadSession struct {
+	mutex        sync.Mutex
+	id           string
+	modelID      string
+	versionArgs  backend.VersionArgs
+	dataSize     uint64
+	file         *os.File
+	receivedSize uint64
+	expiresAt    time.Time
+	timer        *time.Timer
+	// closed is set once the session is committed or discarded
+	closed bool
+}
+
+// append writes the part of the chunk starting at the given offset that wasn't received yet
+func (session *uploadSession) append(offset uint64, chunk []byte, timeout time.Duration) error {
+	if offset > session.receivedSize {
+		return status.Errorf(codes.OutOfRange, "unable to append a chunk at offset %d to upload %q, only %d bytes were received", offset, session.id, session.receivedSize)
+	}
+	chunkEnd := offset + uint64(len(chunk))
+	if chunkEnd > session.dataSize {
+		return status.Errorf(codes.InvalidArgument, "received more data than expected for upload %q, expected %d bytes, received %d bytes", session.id, session.dataSize, chunkEnd)
+	}
+	if chunkEnd > session.receivedSize {
+		if _, err := session.file.Write(chunk[session.receivedSize-offset:]); err != nil {
+			return status.Errorf(codes.Internal, "unexpected error while writing the data of upload %q: %s", session.id, err)
+		}
+		session.receivedSize = chunkEnd
+	}
+	session.expiresAt = time.Now().Add(timeout)
+	session.timer.Reset(timeout)
+	return nil
+}
+
+// close stops the expiration timer and removes the temporary file
+func (session *uploadSession) close() {
+	session.closed = true
+	session.timer.Stop()
+	session.file.Close()
+	if err := os.Remove(session.file.Name()); err != nil {
+		logrus.WithFields(logrus.Fields{"model_id": session.modelID, "filename": session.file.Name()}).WithError(err).Warn("unable to remove the temporary file of an upload")
+	}
+}
+
+// uploadSessions keeps track of the ongoing uploads, a session is discarded when no chunk is appended to it
+// during the timeout
+//
+// The mutex of the sessions is never held while waiting for the mutex of a session, a session being committed doesn't
+// block the others.
+type uploadSessions struct {
+	mutex       sync.Mutex
+	timeout     time.Duration
+	maxSessions int // Unlimited when 0
+	sessions    map[string]*uploadSession
+}
+
+// unknownUploadError is returned for uploads that were never started, already committed or expired
+func unknownUploadError(id string) error {
+	return status.Errorf(codes.NotFound, "no upload %q, it might have expired", id)
+}
+
+func createUploadSessions(timeout time.Duration, maxSessions int) *uploadSessions {
+	return &uploadSessions{
+		timeout:     timeout,
+		maxSessions: maxSessions,
+		sessions:    make(map[string]*uploadSession),
+	}
+}
+
+func generateUploadID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("unable to generate an upload id: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// tooManyUploadsError is returned when starting an upload while the maximum number of sessions are open
+func tooManyUploadsError(maxSessions int) error {
+	return status.Errorf(codes.ResourceExhausted, "unable to start an upload, %d uploads are already ongoing, retry once some of them are committed or expired", maxSessions)
+}
+
+// begin starts a new session spooling the data of a version of the given model to a temporary file
+func (us *uploadSessions) begin(modelID string, versionArgs backend.VersionArgs, dataSize uint64) (*uploadSession, error) {
+	id, err := generateUploadID()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &uploadSession{
+		id:          id,
+		modelID:     modelID,
+		versionArgs: versionArgs,
+		dataSize:    dataSize,
+		expiresAt:   time.Now().Add(us.timeout),
+	}
+	// The session is reserved before creating its file for the maximum number of sessions to be respected
+	us.mutex.Lock()
+	if us.maxSessions > 0 && len(us.sessions) >= us.maxSessions {
+		us.mutex.Unlock()
+		return nil, tooManyUploadsError(us.maxSessions)
+	}
+	us.sessions[id] = session
+	session.mutex.Lock()
+	us.mutex.Unlock()
+	defer session.mutex.Unlock()
+
+	session.file, err = os.CreateTemp("", "cogment_model_registry_upload_*")
+	if err != nil {
+		session.closed = true
+		us.remove(session)
+		return nil, fmt.Errorf("unable to create the temporary file of upload %q: %w", id, err)
+	}
+	session.timer = time.AfterFunc(us.timeout, func() { us.expire(session) })
+	return session, nil
+}
+
+// lookup retrieves an open session
+func (us *uploadSessions) lookup(id string) (*uploadSession, bool) {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+	session, ok := us.sessions[id]
+	return session, ok
+}
+
+// modelID retrieves the model of an open session, the clients using its id are checked against it
+func (us *uploadSessions) modelID(id string) (string, error) {
+	session, ok := us.lookup(id)
+	if !ok {
+		return "", unknownUploadError(id)
+	}
+	return session.modelID, nil
+}
+
+// remove forgets a closed session
+func (us *uploadSessions) remove(session *uploadSession) {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+	if us.sessions[session.id] == session {
+		delete(us.sessions, session.id)
+	}
+}
+
+// expire discards a session unless a chunk was appended since the timer was started
+func (us *uploadSessions) expire(session *uploadSession) {
+	session.mutex.Lock()
+	if session.closed || time.Now().Before(session.expiresAt) {
+		session.mutex.Unlock()
+		return
+	}
+	logrus.WithFields(logrus.Fields{"model_id": session.modelID, "received_size": session.receivedSize}).Info("Upload expired")
+	session.close()
+	session.mutex.Unlock()
+	us.remove(session)
+}
+
+// append appends a chunk to a session and returns its received size and expiration time
+func (us *uploadSessions) append(id string, offset uint64, chunk []byte) (uint64, time.Time, error) {
+	session, ok := us.lookup(id)
+	if !ok {
+		return 0, time.Time{}, unknownUploadError(id)
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if session.closed {
+		return 0, time.Time{}, unknownUploadError(id)
+	}
+	if err := session.append(offset, chunk, us.timeout); err != nil {
+		return 0, time.Time{}, err
+	}
+	return session.receivedSize, session.expiresAt, nil
+}
+
+// commit streams the data of a complete session to the given writer, the session is discarded once the version is
+// created, it can be committed again until it expires otherwise
+func (us *uploadSessions) commit(id string, createWriter func(session *uploadSession) (backend.VersionDataWriter, error)) (backend.VersionInfo, error) {
+	session, ok := us.lookup(id)
+	if !ok {
+		return backend.VersionInfo{}, unknownUploadError(id)
+	}
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if session.closed {
+		return backend.VersionInfo{}, unknownUploadError(id)
+	}
+	if session.receivedSize != session.dataSize {
+		return backend.VersionInfo{}, status.Errorf(codes.FailedPrecondition, "upload %q is incomplete, expected %d bytes, received %d bytes", id, session.dataSize, session.receivedSize)
+	}
+
+	versionInfo, err := us.write(session, createWriter)
+	if err != nil {
+		// The timeout starts again for the commit to be retried
+		session.expiresAt = time.Now().Add(us.timeout)
+		session.timer.Reset(us.timeout)
+		return backend.VersionInfo{}, err
+	}
+	session.close()
+	us.remove(session)
+	return versionInfo, nil
+}
+
+// write creates the version from the data of a session
+func (us *uploadSessions) write(session *uploadSession, createWriter func(session *uploadSession) (backend.VersionDataWriter, error)) (backend.VersionInfo, error) {
+	writer, err := createWriter(session)
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	if _, err := session.file.Seek(0, io.SeekStart); err != nil {
+		_ = writer.Abort()
+		return backend.VersionInfo{}, fmt.Errorf("unable to read the data of upload %q: %w", session.id, err)
+	}
+	if _, err := io.Copy(writer, session.file); err != nil {
+		_ = writer.Abort()
+		return backend.VersionInfo{}, fmt.Errorf("unable to write the data of upload %q: %w", session.id, err)
+	}
+	return writer.Commit()
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Model user data keys starting with this prefix store the version number an alias points at
+const VersionAliasUserDataKeyPrefix = "cogment_model_registry.alias."
+
+// LatestVersionAlias is a reserved alias always resolving to the latest version of a model
+const LatestVersionAlias = "latest"
+
+// Aliases that can't be set with SetVersionAlias, the stage aliases follow the transitions of the versions
+var reservedVersionAliases = map[string]bool{
+	LatestVersionAlias:     true,
+	StagingVersionAlias:    true,
+	ProductionVersionAlias: true,
+}
+
+// Metadata key letting clients retrieve the version an alias points at with RetrieveVersionInfos and RetrieveVersionData
+const versionAliasMetadataKey = "cogment-model-registry-version-alias"
+
+var versionAliasRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func validateVersionAlias(alias string) error {
+	if !versionAliasRegexp.MatchString(alias) {
+		return status.Errorf(codes.InvalidArgument, "invalid version alias %q, only letters, digits, `_`, `.` and `-` are allowed", alias)
+	}
+	return nil
+}
+
+// requestedVersionAlias retrieves the alias requested by the client using the
+// `cogment-model-registry-version-alias: <alias>` metadata, empty if not provided
+func requestedVersionAlias(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(versionAliasMetadataKey)
+	if len(values) == 0 {
+		return "", nil
+	}
+	if err := validateVersionAlias(values[0]); err != nil {
+		return "", err
+	}
+	return values[0], nil
+}
+
+// resolveVersionAlias retrieves the version number an alias of a model points at
+//
+// The aliased version might have been deleted since, retrieving it then fails as any unknown version would.
+func resolveVersionAlias(b backend.Backend, modelID string, alias string) (int, error) {
+	if alias == LatestVersionAlias {
+		return -1, nil
+	}
+	modelInfo, err := b.RetrieveModelInfo(modelID)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return 0, errorStatus(codes.NotFound, err)
+		}
+		return 0, status.Errorf(codes.Internal, "unexpected error while resolving alias %q for model %q: %s", alias, modelID, err)
+	}
+	value, ok := modelInfo.UserData[VersionAliasUserDataKeyPrefix+alias]
+	if !ok {
+		return 0, status.Errorf(codes.NotFound, "no alias %q for model %q", alias, modelID)
+	}
+	versionNumber, err := strconv.ParseUint(value, 10, 31)
+	if err != nil || versionNumber == 0 {
+		return 0, status.Errorf(codes.Internal, "invalid alias %q for model %q, %q isn't a version number", alias, modelID, value)
+	}
+	return int(versionNumber), nil
+}
+
+// Model user data keys managed by the server, with the call changing them
+var protectedUserDataKeyPrefixes = map[string]string{
+	VersionAliasUserDataKeyPrefix: "SetVersionAlias",
+	VersionStageUserDataKeyPrefix: "TransitionVersionStage",
+}
+
+func protectedUserDataKey(key string) (string, bool) {
+	for prefix, method := range protectedUserDataKeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return method, true
+		}
+	}
+	return "", false
+}
+
+// mergeProtectedUserData builds the user data of an updated model, keeping its aliases and stages that can only be
+// changed by the dedicated calls
+//
+// The updated user data can include the current protected entries, e.g. when it was retrieved then modified, but not
+// change them.
+func mergeProtectedUserData(modelID string, userData map[string]string, currentUserData map[string]string) (map[string]string, error) {
+	mergedUserData := make(map[string]string, len(userData))
+	for key, value := range userData {
+		if method, ok := protectedUserDataKey(key); ok && currentUserData[key] != value {
+			return nil, status.Errorf(codes.InvalidArgument, "unable to update model %q, user data key %q can only be changed with %s", modelID, key, method)
+		}
+		mergedUserData[key] = value
+	}
+	for key, value := range currentUserData {
+		if _, ok := protectedUserDataKey(key); ok {
+			mergedUserData[key] = value
+		}
+	}
+	return mergedUserData, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// VersionArtifactUserDataKeyPrefix prefixes the version user data keys locating its artifacts in its data, they are
+// set by CreateVersionWithArtifacts as `<offset>:<data_size>:<data_hash>`
+const VersionArtifactUserDataKeyPrefix = "cogment_model_registry.artifact."
+
+type versionArtifact struct {
+	name     string
+	offset   uint64
+	dataSize uint64
+	dataHash string
+}
+
+func formatVersionArtifact(artifact versionArtifact) string {
+	return fmt.Sprintf("%d:%d:%s", artifact.offset, artifact.dataSize, artifact.dataHash)
+}
+
+// parseVersionArtifacts retrieves the artifacts of a version from its user data, ordered by offset
+func parseVersionArtifacts(userData map[string]string) ([]versionArtifact, error) {
+	artifacts := []versionArtifact{}
+	for key, value := range userData {
+		if !strings.HasPrefix(key, VersionArtifactUserDataKeyPrefix) {
+			continue
+		}
+		artifact := versionArtifact{name: strings.TrimPrefix(key, VersionArtifactUserDataKeyPrefix)}
+		// The hash itself might include a colon separating its algorithm
+		fields := strings.SplitN(value, ":", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid artifact %q %q, expecting `<offset>:<data_size>:<data_hash>`", artifact.name, value)
+		}
+		var err error
+		if artifact.offset, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid offset for artifact %q: %w", artifact.name, err)
+		}
+		if artifact.dataSize, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid data size for artifact %q: %w", artifact.name, err)
+		}
+		artifact.dataHash = fields[2]
+		artifacts = append(artifacts, artifact)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		if artifacts[i].offset != artifacts[j].offset {
+			return artifacts[i].offset < artifacts[j].offset
+		}
+		return artifacts[i].name < artifacts[j].name
+	})
+	return artifacts, nil
+}
+
+// rejectVersionArtifactsUserData checks that the user data of a version about to be created doesn't define artifacts,
+// only CreateVersionWithArtifacts computes them
+func rejectVersionArtifactsUserData(userData map[string]string) error {
+	for key := range userData {
+		if strings.HasPrefix(key, VersionArtifactUserDataKeyPrefix) {
+			return status.Errorf(codes.InvalidArgument, "user data key %q is reserved to the artifacts created by CreateVersionWithArtifacts", key)
+		}
+	}
+	return nil
+}
+
+// retrieveVersionArtifact resolves a version of a model, -1 being the latest, and locates one of its artifacts
+func retrieveVersionArtifact(b backend.Backend, modelID string, versionNumber int, name string) (backend.VersionInfo, versionArtifact, error) {
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return backend.VersionInfo{}, versionArtifact{}, err
+	}
+	artifacts, err := parseVersionArtifacts(versionInfo.UserData)
+	if err != nil {
+		return backend.VersionInfo{}, versionArtifact{}, fmt.Errorf("invalid artifacts for version \"%d\" of model %q: %w", versionInfo.VersionNumber, modelID, err)
+	}
+	for _, artifact := range artifacts {
+		if artifact.name == name {
+			if artifact.offset+artifact.dataSize > uint64(versionInfo.DataSize) {
+				return backend.VersionInfo{}, versionArtifact{}, fmt.Errorf("artifact %q is out of the data of version \"%d\" of model %q", name, versionInfo.VersionNumber, modelID)
+			}
+			return versionInfo, artifact, nil
+		}
+	}
+	return backend.VersionInfo{}, versionArtifact{}, status.Errorf(codes.NotFound, "no artifact %q in version \"%d\" of model %q", name, versionInfo.VersionNumber, modelID)
+}
+
+func createPbVersionArtifact(artifact versionArtifact) *extensionsapi.VersionArtifact {
+	return &extensionsapi.VersionArtifact{
+		Name:     artifact.name,
+		Offset:   artifact.offset,
+		DataSize: artifact.dataSize,
+		DataHash: artifact.dataHash,
+	}
+}
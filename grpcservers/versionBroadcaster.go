@@ -0,0 +1,106 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"sync"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// Number of version infos buffered for a subscriber before it is considered too slow and unsubscribed
+const versionSubscriptionBufferSize = 32
+
+type versionSubscription struct {
+	versions chan backend.VersionInfo
+	// overflowed is set when the subscription was closed because the subscriber didn't keep up
+	overflowed bool
+}
+
+// versionBroadcaster dispatches the versions created through the server to the subscribers of their model
+type versionBroadcaster struct {
+	mutex         sync.Mutex
+	subscriptions map[string]map[*versionSubscription]struct{}
+}
+
+func createVersionBroadcaster() *versionBroadcaster {
+	return &versionBroadcaster{
+		subscriptions: make(map[string]map[*versionSubscription]struct{}),
+	}
+}
+
+// subscribe registers a subscription to the versions of the given model, its channel is closed when the
+// model is deleted, when the subscriber doesn't keep up or when unsubscribe is called.
+func (vb *versionBroadcaster) subscribe(modelID string) *versionSubscription {
+	vb.mutex.Lock()
+	defer vb.mutex.Unlock()
+
+	subscription := &versionSubscription{versions: make(chan backend.VersionInfo, versionSubscriptionBufferSize)}
+	modelSubscriptions, ok := vb.subscriptions[modelID]
+	if !ok {
+		modelSubscriptions = make(map[*versionSubscription]struct{})
+		vb.subscriptions[modelID] = modelSubscriptions
+	}
+	modelSubscriptions[subscription] = struct{}{}
+	return subscription
+}
+
+func (vb *versionBroadcaster) unsubscribe(modelID string, subscription *versionSubscription) {
+	vb.mutex.Lock()
+	defer vb.mutex.Unlock()
+
+	modelSubscriptions, ok := vb.subscriptions[modelID]
+	if !ok {
+		return
+	}
+	if _, ok := modelSubscriptions[subscription]; !ok {
+		return
+	}
+	vb.remove(modelID, subscription)
+}
+
+// publish sends a version info to every subscriber of its model without blocking
+func (vb *versionBroadcaster) publish(versionInfo backend.VersionInfo) {
+	vb.mutex.Lock()
+	defer vb.mutex.Unlock()
+
+	for subscription := range vb.subscriptions[versionInfo.ModelID] {
+		select {
+		case subscription.versions <- versionInfo:
+		default:
+			subscription.overflowed = true
+			vb.remove(versionInfo.ModelID, subscription)
+		}
+	}
+}
+
+// closeModel ends every subscription to the given model
+func (vb *versionBroadcaster) closeModel(modelID string) {
+	vb.mutex.Lock()
+	defer vb.mutex.Unlock()
+
+	for subscription := range vb.subscriptions[modelID] {
+		vb.remove(modelID, subscription)
+	}
+}
+
+// remove needs to be called with the mutex locked
+func (vb *versionBroadcaster) remove(modelID string, subscription *versionSubscription) {
+	close(subscription.versions)
+	delete(vb.subscriptions[modelID], subscription)
+	if len(vb.subscriptions[modelID]) == 0 {
+		delete(vb.subscriptions, modelID)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	grpcapi "github.com/cogment/cogment-model-registry/grpcapi/cogment/api"
+	"github.com/cogment/cogment-model-registry/logging"
+)
+
+// Metrics of the streams sending the data of versions, published under `/debug/vars`
+var (
+	sentVersionDataBytesMetric       = expvar.NewInt("sent_version_data_bytes")
+	sentVersionDataSendBlockedMetric = expvar.NewFloat("sent_version_data_send_blocked_seconds")
+	sentVersionDataReadBlockedMetric = expvar.NewFloat("sent_version_data_read_blocked_seconds")
+	ongoingVersionDataStreams        = &versionDataStreams{streams: make(map[*versionDataStream]struct{})}
+)
+
+func init() {
+	expvar.Publish("sent_version_data_streams", expvar.Func(ongoingVersionDataStreams.stats))
+}
+
+// versionDataStreamStats describes the progress of a stream sending the data of a version
+type versionDataStreamStats struct {
+	ModelID            string  `json:"model_id"`
+	VersionNumber      uint    `json:"version_number"`
+	DataSize           int     `json:"data_size"`
+	SentBytes          int     `json:"sent_bytes"`
+	ElapsedSeconds     float64 `json:"elapsed_seconds"`
+	BytesPerSecond     float64 `json:"bytes_per_second"`
+	SendBlockedSeconds float64 `json:"send_blocked_seconds"` // Time waiting for the client to consume the sent chunks
+	ReadBlockedSeconds float64 `json:"read_blocked_seconds"` // Time waiting for the chunks to be read from the backend
+}
+
+// versionDataStream tracks a stream sending the data of a version
+type versionDataStream struct {
+	outStream versionDataChunkSender
+	startTime time.Time
+
+	mutex sync.Mutex
+	stats versionDataStreamStats
+}
+
+type versionDataStreams struct {
+	mutex   sync.Mutex
+	streams map[*versionDataStream]struct{}
+}
+
+func (s *versionDataStreams) stats() interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := make([]versionDataStreamStats, 0, len(s.streams))
+	for stream := range s.streams {
+		stats = append(stats, stream.currentStats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ElapsedSeconds > stats[j].ElapsedSeconds })
+	return stats
+}
+
+// startVersionDataStream starts tracking the data of a version sent to a stream, stop needs to be called once done
+func startVersionDataStream(outStream versionDataChunkSender, versionInfo backend.VersionInfo) *versionDataStream {
+	stream := &versionDataStream{
+		outStream: outStream,
+		startTime: time.Now(),
+		stats: versionDataStreamStats{
+			ModelID:       versionInfo.ModelID,
+			VersionNumber: versionInfo.VersionNumber,
+			DataSize:      versionInfo.DataSize,
+		},
+	}
+	ongoingVersionDataStreams.mutex.Lock()
+	defer ongoingVersionDataStreams.mutex.Unlock()
+	ongoingVersionDataStreams.streams[stream] = struct{}{}
+	return stream
+}
+
+func (s *versionDataStream) currentStats() versionDataStreamStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := s.stats
+	stats.ElapsedSeconds = time.Since(s.startTime).Seconds()
+	if stats.ElapsedSeconds > 0 {
+		stats.BytesPerSecond = float64(stats.SentBytes) / stats.ElapsedSeconds
+	}
+	return stats
+}
+
+func (s *versionDataStream) Send(chunk *grpcapi.RetrieveVersionDataReplyChunk) error {
+	sendStart := time.Now()
+	err := s.outStream.Send(chunk)
+	sendBlocked := time.Since(sendStart).Seconds()
+	sentVersionDataSendBlockedMetric.Add(sendBlocked)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stats.SendBlockedSeconds += sendBlocked
+	if err == nil {
+		s.stats.SentBytes += len(chunk.DataChunk)
+		sentVersionDataBytesMetric.Add(int64(len(chunk.DataChunk)))
+	}
+	return err
+}
+
+func (s *versionDataStream) readBlocked(duration time.Duration) {
+	sentVersionDataReadBlockedMetric.Add(duration.Seconds())
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stats.ReadBlockedSeconds += duration.Seconds()
+}
+
+// stop stops tracking the stream and logs its stats
+func (s *versionDataStream) stop(ctx context.Context) {
+	ongoingVersionDataStreams.mutex.Lock()
+	delete(ongoingVersionDataStreams.streams, s)
+	ongoingVersionDataStreams.mutex.Unlock()
+	stats := s.currentStats()
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"model_id":             stats.ModelID,
+		"version_number":       stats.VersionNumber,
+		"sent_bytes":           stats.SentBytes,
+		"bytes_per_second":     stats.BytesPerSecond,
+		"send_blocked_seconds": stats.SendBlockedSeconds,
+		"read_blocked_seconds": stats.ReadBlockedSeconds,
+	}).Debug("Version data sent")
+}
+
+// chunkReader reads length bytes of the data of a version starting at offset
+type chunkReader func(offset uint64, length uint64) ([]byte, error)
+
+// backendChunkReader reads the chunks of a version as ranges of its data retrieved from the backend
+func backendChunkReader(b backend.Backend, versionInfo backend.VersionInfo) chunkReader {
+	return func(offset uint64, length uint64) ([]byte, error) {
+		return b.RetrieveModelVersionDataRange(versionInfo.ModelID, int(versionInfo.VersionNumber), offset, length)
+	}
+}
+
+// openedChunkReader reads the chunks of a version from its opened data
+func openedChunkReader(reader backend.VersionDataReader) chunkReader {
+	return func(offset uint64, length uint64) ([]byte, error) {
+		chunk := make([]byte, length)
+		n, err := reader.ReadAt(chunk, int64(offset))
+		if err == io.EOF {
+			// Shorter than its info, the version changed
+			err = nil
+		}
+		return chunk[:n], err
+	}
+}
+
+// streamVersionData sends the data of a version read chunk by chunk
+//
+// At most the configured number of chunks are read ahead of the client, a slow client slows down the reads instead of
+// having the data pile up in memory. The stream fails with `ABORTED` if the version changes while being sent.
+func (s *ModelRegistryServer) streamVersionData(ctx context.Context, outStream *versionDataStream, b backend.Backend, versionInfo backend.VersionInfo, chunkSize int, readChunk chunkReader) error {
+	dataSize := uint64(versionInfo.DataSize)
+	if dataSize == 0 {
+		return outStream.Send(&grpcapi.RetrieveVersionDataReplyChunk{})
+	}
+
+	readCtx, cancelRead := context.WithCancel(ctx)
+	defer cancelRead()
+	chunks := make(chan []byte, s.sentVersionDataBufferedChunks)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		for offset := uint64(0); offset < dataSize; {
+			length := uint64(chunkSize)
+			if length > dataSize-offset {
+				length = dataSize - offset
+			}
+			chunk, err := readChunk(offset, length)
+			if err == nil && len(chunk) == 0 {
+				err = status.Errorf(codes.Aborted, "version \"%d\" of model %q changed while being retrieved", versionInfo.VersionNumber, versionInfo.ModelID)
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case chunks <- chunk:
+			case <-readCtx.Done():
+				return
+			}
+			offset += uint64(len(chunk))
+		}
+		// The chunks of a version updated in between would mix two datas
+		currentVersionInfo, err := b.RetrieveModelVersionInfo(versionInfo.ModelID, int(versionInfo.VersionNumber))
+		if err == nil && (currentVersionInfo.DataHash != versionInfo.DataHash || !currentVersionInfo.CreationTimestamp.Equal(versionInfo.CreationTimestamp)) {
+			err = status.Errorf(codes.Aborted, "version \"%d\" of model %q changed while being retrieved", versionInfo.VersionNumber, versionInfo.ModelID)
+		}
+		if err != nil {
+			readErr <- err
+		}
+	}()
+
+	for {
+		readStart := time.Now()
+		chunk, ok := <-chunks
+		outStream.readBlocked(time.Since(readStart))
+		if !ok {
+			break
+		}
+		if err := outStream.Send(&grpcapi.RetrieveVersionDataReplyChunk{DataChunk: chunk}); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case err := <-readErr:
+		switch {
+		case errors.Is(err, backend.ErrNotFound):
+			return status.Errorf(codes.Aborted, "version \"%d\" of model %q was deleted while being retrieved", versionInfo.VersionNumber, versionInfo.ModelID)
+		case errors.As(err, new(*backend.InvalidDataRangeError)):
+			return status.Errorf(codes.Aborted, "version \"%d\" of model %q changed while being retrieved", versionInfo.VersionNumber, versionInfo.ModelID)
+		}
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.Internal, `unexpected error while retrieving version "%d" for model %q: %s`, versionInfo.VersionNumber, versionInfo.ModelID, err)
+	default:
+		return nil
+	}
+}
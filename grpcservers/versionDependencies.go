@@ -0,0 +1,368 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// Version user data keys starting with this prefix, followed by a model id, store the version of this model a version
+// depends on, e.g. `cogment_model_registry.dependency.world_model=3`. They are set when the version is created.
+const VersionDependencyUserDataKeyPrefix = "cogment_model_registry.dependency."
+
+// versionReference identifies a version of a model
+type versionReference struct {
+	modelID       string
+	versionNumber uint
+}
+
+func (r versionReference) String() string {
+	return fmt.Sprintf("%s:%d", r.modelID, r.versionNumber)
+}
+
+func versionDependencyKey(modelID string) string {
+	return VersionDependencyUserDataKeyPrefix + modelID
+}
+
+// parseVersionDependencies retrieves the versions a version depends on from its user data, ordered by model id
+func parseVersionDependencies(userData map[string]string) ([]versionReference, error) {
+	dependencies := []versionReference{}
+	for key, value := range userData {
+		if !strings.HasPrefix(key, VersionDependencyUserDataKeyPrefix) {
+			continue
+		}
+		modelID := strings.TrimPrefix(key, VersionDependencyUserDataKeyPrefix)
+		if modelID == "" {
+			return nil, fmt.Errorf("invalid dependency user data key %q, a model id is expected after %q", key, VersionDependencyUserDataKeyPrefix)
+		}
+		versionNumber, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || versionNumber == 0 {
+			return nil, fmt.Errorf("invalid version number %q for the dependency on model %q, a positive integer is expected", value, modelID)
+		}
+		dependencies = append(dependencies, versionReference{modelID: modelID, versionNumber: uint(versionNumber)})
+	}
+	sort.Slice(dependencies, func(i, j int) bool { return dependencies[i].modelID < dependencies[j].modelID })
+	return dependencies, nil
+}
+
+// validateVersionDependencies checks the dependencies of a version about to be created, they need to exist
+func validateVersionDependencies(b backend.Backend, userData map[string]string) error {
+	dependencies, err := parseVersionDependencies(userData)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	for _, dependency := range dependencies {
+		_, err := b.RetrieveModelVersionInfo(dependency.modelID, int(dependency.versionNumber))
+		if err != nil {
+			if errors.Is(err, backend.ErrNotFound) {
+				return status.Errorf(codes.FailedPrecondition, "unknown dependency: %s", err)
+			}
+			return status.Errorf(codes.Internal, `unexpected error while retrieving dependency "%d" of model %q: %s`, dependency.versionNumber, dependency.modelID, err)
+		}
+	}
+	return nil
+}
+
+// lockDependencyModels locks the given models for the versions depending on their versions, in order for concurrent
+// calls not to deadlock. No version depending on them is created and none of their versions is deleted by the registry
+// until the returned function is called.
+func (s *ModelRegistryServer) lockDependencyModels(modelIDs []string) func() {
+	sortedModelIDs := make([]string, 0, len(modelIDs))
+	unique := make(map[string]bool, len(modelIDs))
+	for _, modelID := range modelIDs {
+		if !unique[modelID] {
+			unique[modelID] = true
+			sortedModelIDs = append(sortedModelIDs, modelID)
+		}
+	}
+	sort.Strings(sortedModelIDs)
+	unlocks := make([]func(), 0, len(sortedModelIDs))
+	for _, modelID := range sortedModelIDs {
+		unlocks = append(unlocks, s.dependencyLocks.Lock(modelID))
+	}
+	return func() {
+		for index := len(unlocks) - 1; index >= 0; index-- {
+			unlocks[index]()
+		}
+	}
+}
+
+// LockDependedUponModel blocks the creation of the versions depending on the versions of a model until the returned
+// function is called, e.g. to check that a version isn't in use then delete it
+func (s *ModelRegistryServer) LockDependedUponModel(modelID string) func() {
+	return s.lockDependencyModels([]string{modelID})
+}
+
+// dependenciesCheckedWriter checks the dependencies of a version again when it is committed, while the models it
+// depends on are locked, for them not to be deleted between the check and the creation of the version
+type dependenciesCheckedWriter struct {
+	backend.VersionDataWriter
+	server       *ModelRegistryServer
+	backend      backend.Backend
+	userData     map[string]string
+	dependencies []versionReference
+}
+
+// checkDependenciesOnCommit wraps the writer of a version having dependencies for them to be checked on commit
+func (s *ModelRegistryServer) checkDependenciesOnCommit(b backend.Backend, writer backend.VersionDataWriter, userData map[string]string) backend.VersionDataWriter {
+	dependencies, err := parseVersionDependencies(userData)
+	if err == nil && len(dependencies) == 0 {
+		return writer
+	}
+	return &dependenciesCheckedWriter{VersionDataWriter: writer, server: s, backend: b, userData: userData, dependencies: dependencies}
+}
+
+func (w *dependenciesCheckedWriter) Commit() (backend.VersionInfo, error) {
+	modelIDs := make([]string, 0, len(w.dependencies))
+	for _, dependency := range w.dependencies {
+		modelIDs = append(modelIDs, dependency.modelID)
+	}
+	unlock := w.server.lockDependencyModels(modelIDs)
+	defer unlock()
+	if err := validateVersionDependencies(w.backend, w.userData); err != nil {
+		_ = w.VersionDataWriter.Abort()
+		return backend.VersionInfo{}, err
+	}
+	return w.VersionDataWriter.Commit()
+}
+
+// retrieveDependents retrieves the versions directly depending on a version of a model, or on any of its versions when
+// versionNumber is 0, by querying the versions of every model
+func retrieveDependents(b backend.Backend, modelID string, versionNumber uint) ([]backend.VersionInfo, error) {
+	filter := backend.VersionFilter{}
+	if versionNumber == 0 {
+		filter.UserDataComparisons = []backend.UserDataComparison{{Key: versionDependencyKey(modelID), Operator: backend.GreaterOrEqual, Value: 1}}
+	} else {
+		filter.UserDataEquals = map[string]string{versionDependencyKey(modelID): strconv.FormatUint(uint64(versionNumber), 10)}
+	}
+	dependents := []backend.VersionInfo{}
+	for modelOffset := 0; ; modelOffset += storageInfoPageSize {
+		modelInfos, err := b.ListModels(modelOffset, storageInfoPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the models: %w", err)
+		}
+		for _, modelInfo := range modelInfos {
+			versionInfos, err := b.QueryModelVersionInfos(modelInfo.ModelID, filter, 0, 0)
+			if err != nil {
+				if errors.As(err, new(*backend.UnknownModelError)) {
+					continue
+				}
+				return nil, fmt.Errorf("unable to query the versions of model %q: %w", modelInfo.ModelID, err)
+			}
+			dependents = append(dependents, versionInfos...)
+		}
+		if len(modelInfos) < storageInfoPageSize {
+			return dependents, nil
+		}
+	}
+}
+
+// retrieveModelDependents retrieves the versions of other models depending on any version of a model
+func retrieveModelDependents(b backend.Backend, modelID string) ([]backend.VersionInfo, error) {
+	dependents, err := retrieveDependents(b, modelID, 0)
+	if err != nil {
+		return nil, err
+	}
+	otherModelsDependents := []backend.VersionInfo{}
+	for _, dependent := range dependents {
+		if dependent.ModelID != modelID {
+			otherModelsDependents = append(otherModelsDependents, dependent)
+		}
+	}
+	return otherModelsDependents, nil
+}
+
+// dependedUponVersionNumber is the version of a model a version depends on, 0 if it doesn't depend on this model
+func dependedUponVersionNumber(dependent backend.VersionInfo, modelID string) uint {
+	versionNumber, err := strconv.ParseUint(dependent.UserData[versionDependencyKey(modelID)], 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint(versionNumber)
+}
+
+// retrieveTransitiveDependents retrieves the versions depending on a version, directly or not, each one before the
+// versions it depends on so that they can be deleted in order
+func retrieveTransitiveDependents(b backend.Backend, versionInfo backend.VersionInfo) ([]backend.VersionInfo, error) {
+	visited := map[versionReference]bool{{modelID: versionInfo.ModelID, versionNumber: versionInfo.VersionNumber}: true}
+	ordered := []backend.VersionInfo{}
+	var visit func(versionInfo backend.VersionInfo) error
+	visit = func(versionInfo backend.VersionInfo) error {
+		dependents, err := retrieveDependents(b, versionInfo.ModelID, versionInfo.VersionNumber)
+		if err != nil {
+			return err
+		}
+		for _, dependent := range dependents {
+			reference := versionReference{modelID: dependent.ModelID, versionNumber: dependent.VersionNumber}
+			if visited[reference] {
+				continue
+			}
+			visited[reference] = true
+			if err := visit(dependent); err != nil {
+				return err
+			}
+			ordered = append(ordered, dependent)
+		}
+		return nil
+	}
+	if err := visit(versionInfo); err != nil {
+		return nil, err
+	}
+	return ordered, nil
+}
+
+// lockTransitiveDependents locks the model of a version and the models of the versions depending on it, directly or
+// not, then retrieves these versions, no version depending on them is created until the returned function is called
+func (s *ModelRegistryServer) lockTransitiveDependents(b backend.Backend, versionInfo backend.VersionInfo) ([]backend.VersionInfo, func(), error) {
+	lockedModelIDs := []string{versionInfo.ModelID}
+	for {
+		unlock := s.lockDependencyModels(lockedModelIDs)
+		dependents, err := retrieveTransitiveDependents(b, versionInfo)
+		if err != nil {
+			unlock()
+			return nil, nil, err
+		}
+		locked := make(map[string]bool, len(lockedModelIDs))
+		for _, modelID := range lockedModelIDs {
+			locked[modelID] = true
+		}
+		complete := true
+		for _, dependent := range dependents {
+			if !locked[dependent.ModelID] {
+				locked[dependent.ModelID] = true
+				lockedModelIDs = append(lockedModelIDs, dependent.ModelID)
+				complete = false
+			}
+		}
+		if complete {
+			return dependents, unlock, nil
+		}
+		// Locking every model at once, in order, dependents might have been created in the meantime
+		unlock()
+	}
+}
+
+func versionReferences(versionInfos []backend.VersionInfo) string {
+	references := make([]string, 0, len(versionInfos))
+	for _, versionInfo := range versionInfos {
+		references = append(references, versionReference{modelID: versionInfo.ModelID, versionNumber: versionInfo.VersionNumber}.String())
+	}
+	return strings.Join(references, ",")
+}
+
+// versionDependedUponStatus is the error of a deletion rejected because other versions depend on a version
+func versionDependedUponStatus(modelID string, versionNumber uint, dependents []backend.VersionInfo, format string, a ...interface{}) error {
+	return reasonStatus(codes.FailedPrecondition, extensionsapi.ErrorReason_VERSION_DEPENDED_UPON, map[string]string{
+		"model_id":       modelID,
+		"version_number": strconv.FormatUint(uint64(versionNumber), 10),
+		"dependents":     versionReferences(dependents),
+	}, format, a...)
+}
+
+// dependencyGraph is the graph of the dependencies between versions reachable from a version
+type dependencyGraph struct {
+	versionInfos []backend.VersionInfo
+	edges        [][2]versionReference // Dependent version, then the version it depends on
+}
+
+// retrieveDependencyGraph walks the dependencies of a version and, if requested, its dependents, a dependency deleted
+// outside of the registry, e.g. by an import, only appears in the edges
+func retrieveDependencyGraph(b backend.Backend, modelID string, versionNumber int, includeDependents bool) (dependencyGraph, error) {
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return dependencyGraph{}, err
+	}
+	graph := dependencyGraph{versionInfos: []backend.VersionInfo{versionInfo}}
+	visited := map[versionReference]bool{{modelID: versionInfo.ModelID, versionNumber: versionInfo.VersionNumber}: true}
+
+	// Dependencies, breadth first
+	for index := 0; index < len(graph.versionInfos); index++ {
+		current := graph.versionInfos[index]
+		dependencies, err := parseVersionDependencies(current.UserData)
+		if err != nil {
+			return dependencyGraph{}, fmt.Errorf("invalid dependencies for version \"%d\" of model %q: %w", current.VersionNumber, current.ModelID, err)
+		}
+		for _, dependency := range dependencies {
+			graph.edges = append(graph.edges, [2]versionReference{{modelID: current.ModelID, versionNumber: current.VersionNumber}, dependency})
+			if visited[dependency] {
+				continue
+			}
+			visited[dependency] = true
+			dependencyInfo, err := b.RetrieveModelVersionInfo(dependency.modelID, int(dependency.versionNumber))
+			if err != nil {
+				if errors.Is(err, backend.ErrNotFound) {
+					continue
+				}
+				return dependencyGraph{}, err
+			}
+			graph.versionInfos = append(graph.versionInfos, dependencyInfo)
+		}
+	}
+	if !includeDependents {
+		return graph, nil
+	}
+
+	// Dependents, breadth first from the requested version
+	pending := []backend.VersionInfo{versionInfo}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		dependents, err := retrieveDependents(b, current.ModelID, current.VersionNumber)
+		if err != nil {
+			return dependencyGraph{}, err
+		}
+		for _, dependent := range dependents {
+			reference := versionReference{modelID: dependent.ModelID, versionNumber: dependent.VersionNumber}
+			graph.edges = append(graph.edges, [2]versionReference{reference, {modelID: current.ModelID, versionNumber: current.VersionNumber}})
+			if visited[reference] {
+				continue
+			}
+			visited[reference] = true
+			graph.versionInfos = append(graph.versionInfos, dependent)
+			pending = append(pending, dependent)
+		}
+	}
+	return graph, nil
+}
+
+func createPbVersionReference(reference versionReference) *extensionsapi.VersionReference {
+	return &extensionsapi.VersionReference{ModelId: reference.modelID, VersionNumber: uint32(reference.versionNumber)}
+}
+
+// IsVersionInUse tells whether a version is leased or other versions depend on it, the retention never collects these
+// versions. A version is considered in use when its dependents can't be retrieved. LockDependedUponModel keeps it from
+// starting to be depended upon until it is deleted.
+func (s *ModelRegistryServer) IsVersionInUse(modelID string, versionNumber uint) bool {
+	if s.IsVersionLeased(modelID, versionNumber) {
+		return true
+	}
+	b, err := s.backendPromise.Await(context.Background())
+	if err != nil {
+		return true
+	}
+	dependents, err := retrieveDependents(b, modelID, versionNumber)
+	return err != nil || len(dependents) > 0
+}
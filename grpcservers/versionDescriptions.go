@@ -0,0 +1,171 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/signature"
+)
+
+// DescriptionUserDataKey is the user data key holding the human readable description of a model or version
+const DescriptionUserDataKey = "cogment_model_registry.description"
+
+// reservedUserDataKeyPrefix starts the user data keys managed by the registry and its backends
+const reservedUserDataKeyPrefix = "cogment_model_registry."
+
+// versionCreationUserDataKeys are the reserved version user data keys, or key prefixes when ending with `.`, the clients
+// can set when creating a version
+var versionCreationUserDataKeys = []string{
+	DescriptionUserDataKey,
+	VersionLineageUserDataKeyPrefix,
+	VersionManifestUserDataKeyPrefix,
+	VersionDependencyUserDataKeyPrefix,
+	VersionMetricUserDataKeyPrefix,
+	signature.SignatureUserDataKey,
+	signature.KeyIDUserDataKey,
+}
+
+// rejectReservedVersionUserData checks the user data of a version about to be created doesn't define the reserved
+// entries the registry and its backends manage, e.g. the encryption key id or the lock
+//
+// The artifacts are checked by rejectVersionArtifactsUserData, imported versions keep their artifacts and lock.
+func rejectReservedVersionUserData(userData map[string]string, imported bool) error {
+	for key := range userData {
+		if !strings.HasPrefix(key, reservedUserDataKeyPrefix) || strings.HasPrefix(key, VersionArtifactUserDataKeyPrefix) {
+			continue
+		}
+		if imported && key == VersionLockedUserDataKey {
+			continue
+		}
+		settable := false
+		for _, settableKey := range versionCreationUserDataKeys {
+			if key == settableKey || (strings.HasSuffix(settableKey, ".") && strings.HasPrefix(key, settableKey)) {
+				settable = true
+				break
+			}
+		}
+		if !settable {
+			return status.Errorf(codes.InvalidArgument, "user data key %q is reserved to the registry", key)
+		}
+	}
+	return nil
+}
+
+// validateVersionUserData checks the user data entries managed by the registry of a version about to be created
+func validateVersionUserData(b backend.Backend, modelID string, userData map[string]string) error {
+	if err := rejectVersionArtifactsUserData(userData); err != nil {
+		return err
+	}
+	if err := rejectReservedVersionUserData(userData, false); err != nil {
+		return err
+	}
+	if err := validateVersionManifest(userData); err != nil {
+		return err
+	}
+	if err := validateVersionLineage(b, modelID, userData); err != nil {
+		return err
+	}
+	return validateVersionDependencies(b, userData)
+}
+
+// checkVersionUserDataKeyMutable rejects the changes to the user data entries set when the version is created
+func checkVersionUserDataKeyMutable(key string) error {
+	if strings.HasPrefix(key, VersionLineageUserDataKeyPrefix) {
+		return status.Errorf(codes.InvalidArgument, "unable to change user data key %q, the lineage is set when the version is created", key)
+	}
+	if strings.HasPrefix(key, VersionManifestUserDataKeyPrefix) {
+		return status.Errorf(codes.InvalidArgument, "unable to change user data key %q, the manifest is set when the version is created", key)
+	}
+	if strings.HasPrefix(key, VersionDependencyUserDataKeyPrefix) {
+		return status.Errorf(codes.InvalidArgument, "unable to change user data key %q, the dependencies are set when the version is created", key)
+	}
+	if key == VersionLockedUserDataKey {
+		return status.Errorf(codes.InvalidArgument, "unable to change user data key %q, use LockVersion and UnlockVersion", key)
+	}
+	if strings.HasPrefix(key, VersionArtifactUserDataKeyPrefix) {
+		return status.Errorf(codes.InvalidArgument, "unable to change user data key %q, the artifacts are set when the version is created", key)
+	}
+	return nil
+}
+
+// patchVersionUserData applies the changes requested by UpdateVersionInfo to the user data of a version
+func patchVersionUserData(userData map[string]string, description string, clearDescription bool, updatedUserData map[string]string, removedUserDataKeys []string) (map[string]string, error) {
+	if clearDescription && description != "" {
+		return nil, status.Errorf(codes.InvalidArgument, "unable to both set and clear the description")
+	}
+	patchedUserData := make(map[string]string, len(userData)+len(updatedUserData))
+	for key, value := range userData {
+		patchedUserData[key] = value
+	}
+	for key, value := range updatedUserData {
+		if err := checkVersionUserDataKeyMutable(key); err != nil {
+			return nil, err
+		}
+		patchedUserData[key] = value
+	}
+	for _, key := range removedUserDataKeys {
+		if err := checkVersionUserDataKeyMutable(key); err != nil {
+			return nil, err
+		}
+		if _, ok := updatedUserData[key]; ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unable to both set and remove user data key %q", key)
+		}
+		delete(patchedUserData, key)
+	}
+	if description != "" {
+		patchedUserData[DescriptionUserDataKey] = description
+	} else if clearDescription {
+		delete(patchedUserData, DescriptionUserDataKey)
+	}
+	return patchedUserData, nil
+}
+
+// versionETag computes an opaque tag of the state of a version, it changes whenever the version info is updated
+func versionETag(versionInfo backend.VersionInfo) string {
+	// encoding/json sorts the keys of the user data, the serialization is deterministic
+	serializedVersionInfo, _ := json.Marshal(struct {
+		CreationTimestamp int64
+		Archived          bool
+		DataHash          string
+		UserData          map[string]string
+	}{
+		CreationTimestamp: versionInfo.CreationTimestamp.UnixNano(),
+		Archived:          versionInfo.Archived,
+		DataHash:          versionInfo.DataHash,
+		UserData:          versionInfo.UserData,
+	})
+	hash := sha256.Sum256(serializedVersionInfo)
+	return base64.RawURLEncoding.EncodeToString(hash[:12])
+}
+
+func userDataEqual(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if otherValue, ok := b[key]; !ok || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,215 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// Duration after which a lease that isn't renewed expires, when the configuration doesn't define it
+const defaultVersionLeaseTTL = time.Minute
+
+// versionLease marks a version as in use by a consumer until it expires
+type versionLease struct {
+	id            string
+	modelID       string
+	versionNumber uint
+	holder        string
+	expiresAt     time.Time
+}
+
+func (lease versionLease) expired(now time.Time) bool {
+	return !now.Before(lease.expiresAt)
+}
+
+// versionLeases keeps track of the leases on the versions, expired leases are removed as they are encountered
+type versionLeases struct {
+	mutex  sync.Mutex
+	ttl    time.Duration
+	leases map[string]*versionLease
+	now    func() time.Time
+}
+
+// unknownVersionLeaseError is returned for leases that were never acquired, already released or expired
+func unknownVersionLeaseError(id string) error {
+	return status.Errorf(codes.NotFound, "no lease %q, it might have expired", id)
+}
+
+func createVersionLeases(ttl time.Duration) *versionLeases {
+	if ttl <= 0 {
+		ttl = defaultVersionLeaseTTL
+	}
+	return &versionLeases{
+		ttl:    ttl,
+		leases: make(map[string]*versionLease),
+		now:    time.Now,
+	}
+}
+
+func generateVersionLeaseID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("unable to generate a lease id: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// acquire creates a lease of a holder on a version, or renews the one it already holds
+func (vl *versionLeases) acquire(modelID string, versionNumber uint, holder string) (versionLease, error) {
+	vl.mutex.Lock()
+	defer vl.mutex.Unlock()
+	now := vl.now()
+	vl.removeExpired(now)
+	for _, lease := range vl.leases {
+		if lease.modelID == modelID && lease.versionNumber == versionNumber && lease.holder == holder {
+			lease.expiresAt = now.Add(vl.ttl)
+			return *lease, nil
+		}
+	}
+
+	id, err := generateVersionLeaseID()
+	if err != nil {
+		return versionLease{}, err
+	}
+	lease := &versionLease{
+		id:            id,
+		modelID:       modelID,
+		versionNumber: versionNumber,
+		holder:        holder,
+		expiresAt:     now.Add(vl.ttl),
+	}
+	vl.leases[id] = lease
+	return *lease, nil
+}
+
+// modelID retrieves the model of a lease, the clients using its id are checked against it
+func (vl *versionLeases) modelID(id string) (string, error) {
+	vl.mutex.Lock()
+	defer vl.mutex.Unlock()
+	lease, ok := vl.leases[id]
+	if !ok || lease.expired(vl.now()) {
+		return "", unknownVersionLeaseError(id)
+	}
+	return lease.modelID, nil
+}
+
+// renew postpones the expiration of a lease
+func (vl *versionLeases) renew(id string) (versionLease, error) {
+	vl.mutex.Lock()
+	defer vl.mutex.Unlock()
+	now := vl.now()
+	lease, ok := vl.leases[id]
+	if !ok || lease.expired(now) {
+		delete(vl.leases, id)
+		return versionLease{}, unknownVersionLeaseError(id)
+	}
+	lease.expiresAt = now.Add(vl.ttl)
+	return *lease, nil
+}
+
+func (vl *versionLeases) release(id string) (versionLease, error) {
+	vl.mutex.Lock()
+	defer vl.mutex.Unlock()
+	lease, ok := vl.leases[id]
+	delete(vl.leases, id)
+	if !ok || lease.expired(vl.now()) {
+		return versionLease{}, unknownVersionLeaseError(id)
+	}
+	return *lease, nil
+}
+
+// releaseVersion releases the leases on a version, e.g. once it is deleted
+func (vl *versionLeases) releaseVersion(modelID string, versionNumber uint) {
+	vl.mutex.Lock()
+	defer vl.mutex.Unlock()
+	for id, lease := range vl.leases {
+		if lease.modelID == modelID && lease.versionNumber == versionNumber {
+			delete(vl.leases, id)
+		}
+	}
+}
+
+// list retrieves the unexpired leases on the versions of a model, on every version when versionNumber is 0, ordered
+// by version number and holder
+func (vl *versionLeases) list(modelID string, versionNumber uint) []versionLease {
+	vl.mutex.Lock()
+	defer vl.mutex.Unlock()
+	vl.removeExpired(vl.now())
+	leases := []versionLease{}
+	for _, lease := range vl.leases {
+		if lease.modelID == modelID && (versionNumber == 0 || lease.versionNumber == versionNumber) {
+			leases = append(leases, *lease)
+		}
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		if leases[i].versionNumber != leases[j].versionNumber {
+			return leases[i].versionNumber < leases[j].versionNumber
+		}
+		return leases[i].holder < leases[j].holder
+	})
+	return leases
+}
+
+func (vl *versionLeases) removeExpired(now time.Time) {
+	for id, lease := range vl.leases {
+		if lease.expired(now) {
+			delete(vl.leases, id)
+		}
+	}
+}
+
+func leaseHolders(leases []versionLease) string {
+	holders := make([]string, 0, len(leases))
+	for _, lease := range leases {
+		holders = append(holders, lease.holder)
+	}
+	return strings.Join(holders, ",")
+}
+
+// versionLeasedStatus is the error of a deletion rejected because a version is leased
+func versionLeasedStatus(leases []versionLease, format string, a ...interface{}) error {
+	return reasonStatus(codes.FailedPrecondition, extensionsapi.ErrorReason_VERSION_LEASED, map[string]string{
+		"model_id":       leases[0].modelID,
+		"version_number": strconv.FormatUint(uint64(leases[0].versionNumber), 10),
+		"holders":        leaseHolders(leases),
+	}, format, a...)
+}
+
+func createPbVersionLease(lease versionLease) *extensionsapi.VersionLease {
+	return &extensionsapi.VersionLease{
+		LeaseId:             lease.id,
+		ModelId:             lease.modelID,
+		VersionNumber:       uint32(lease.versionNumber),
+		Holder:              lease.holder,
+		ExpirationTimestamp: uint64(lease.expiresAt.UnixNano()),
+	}
+}
+
+// IsVersionLeased tells whether a version has unexpired leases, the retention never collects these versions
+func (s *ModelRegistryServer) IsVersionLeased(modelID string, versionNumber uint) bool {
+	return len(s.versionLeases.list(modelID, versionNumber)) > 0
+}
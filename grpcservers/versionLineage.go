@@ -0,0 +1,144 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// Version user data keys recording where a version comes from, they are set when the version is created
+const (
+	VersionLineageUserDataKeyPrefix = "cogment_model_registry.lineage."
+	ParentModelIDUserDataKey        = VersionLineageUserDataKeyPrefix + "parent_model_id"       // Defaults to the model of the version
+	ParentVersionNumberUserDataKey  = VersionLineageUserDataKeyPrefix + "parent_version_number" // Version the version was trained from
+	RunIDUserDataKey                = VersionLineageUserDataKeyPrefix + "run_id"
+	TrialIDUserDataKey              = VersionLineageUserDataKeyPrefix + "trial_id"
+)
+
+type versionLineage struct {
+	parentModelID       string
+	parentVersionNumber uint // 0 if the version has no parent
+	runID               string
+	trialID             string
+}
+
+// parseVersionLineage retrieves the lineage of a version of a model from its user data
+func parseVersionLineage(modelID string, userData map[string]string) (versionLineage, error) {
+	lineage := versionLineage{
+		parentModelID: userData[ParentModelIDUserDataKey],
+		runID:         userData[RunIDUserDataKey],
+		trialID:       userData[TrialIDUserDataKey],
+	}
+	for key := range userData {
+		switch key {
+		case ParentModelIDUserDataKey, ParentVersionNumberUserDataKey, RunIDUserDataKey, TrialIDUserDataKey:
+		default:
+			if strings.HasPrefix(key, VersionLineageUserDataKeyPrefix) {
+				return versionLineage{}, fmt.Errorf("unknown lineage user data key %q", key)
+			}
+		}
+	}
+	value, ok := userData[ParentVersionNumberUserDataKey]
+	if !ok {
+		if lineage.parentModelID != "" {
+			return versionLineage{}, fmt.Errorf("%q is required along with %q", ParentVersionNumberUserDataKey, ParentModelIDUserDataKey)
+		}
+		return lineage, nil
+	}
+	parentVersionNumber, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || parentVersionNumber == 0 {
+		return versionLineage{}, fmt.Errorf("invalid parent version number %q, a positive integer is expected", value)
+	}
+	lineage.parentVersionNumber = uint(parentVersionNumber)
+	if lineage.parentModelID == "" {
+		lineage.parentModelID = modelID
+	}
+	return lineage, nil
+}
+
+// validateVersionLineage checks the lineage of a version about to be created, its parent needs to exist
+func validateVersionLineage(b backend.Backend, modelID string, userData map[string]string) error {
+	lineage, err := parseVersionLineage(modelID, userData)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if lineage.parentVersionNumber == 0 {
+		return nil
+	}
+	_, err = b.RetrieveModelVersionInfo(lineage.parentModelID, int(lineage.parentVersionNumber))
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return status.Errorf(codes.FailedPrecondition, "unknown parent version: %s", err)
+		}
+		return status.Errorf(codes.Internal, `unexpected error while retrieving parent version "%d" of model %q: %s`, lineage.parentVersionNumber, lineage.parentModelID, err)
+	}
+	return nil
+}
+
+func createPbVersionLineage(lineage versionLineage) *extensionsapi.VersionLineage {
+	return &extensionsapi.VersionLineage{
+		ParentModelId:       lineage.parentModelID,
+		ParentVersionNumber: uint32(lineage.parentVersionNumber),
+		RunId:               lineage.runID,
+		TrialId:             lineage.trialID,
+	}
+}
+
+type versionAncestor struct {
+	versionInfo backend.VersionInfo
+	lineage     versionLineage
+}
+
+// retrieveVersionAncestors walks the ancestry of a version, from the version itself to its furthest ancestor in the same model
+//
+// The walk stops at a parent in another model, its ancestry being retrieved separately, or at a deleted parent.
+func retrieveVersionAncestors(b backend.Backend, modelID string, versionNumber int, maxDepth int) ([]versionAncestor, error) {
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+	ancestors := []versionAncestor{}
+	visitedVersionNumbers := map[uint]bool{}
+	for {
+		lineage, err := parseVersionLineage(modelID, versionInfo.UserData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lineage for version \"%d\": %w", versionInfo.VersionNumber, err)
+		}
+		ancestors = append(ancestors, versionAncestor{versionInfo: versionInfo, lineage: lineage})
+		visitedVersionNumbers[versionInfo.VersionNumber] = true
+		if lineage.parentVersionNumber == 0 || lineage.parentModelID != modelID || visitedVersionNumbers[lineage.parentVersionNumber] {
+			return ancestors, nil
+		}
+		if maxDepth > 0 && len(ancestors) >= maxDepth {
+			return ancestors, nil
+		}
+		versionInfo, err = b.RetrieveModelVersionInfo(modelID, int(lineage.parentVersionNumber))
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelVersionError)) {
+				return ancestors, nil
+			}
+			return nil, err
+		}
+	}
+}
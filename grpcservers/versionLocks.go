@@ -0,0 +1,75 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"fmt"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// VersionLockedUserDataKey is the version user data key set on the locked versions, only changed by LockVersion and
+// UnlockVersion
+const VersionLockedUserDataKey = "cogment_model_registry.locked"
+
+func isVersionLocked(versionInfo backend.VersionInfo) bool {
+	_, locked := versionInfo.UserData[VersionLockedUserDataKey]
+	return locked
+}
+
+// versionLockedStatus is the error of an operation rejected because the version it operates on is locked
+func versionLockedStatus(versionInfo backend.VersionInfo, operation string) error {
+	return reasonStatus(codes.FailedPrecondition, extensionsapi.ErrorReason_VERSION_LOCKED, map[string]string{
+		"model_id":       versionInfo.ModelID,
+		"version_number": strconv.FormatUint(uint64(versionInfo.VersionNumber), 10),
+	}, `unable to %s version "%d" of model %q, it is locked`, operation, versionInfo.VersionNumber, versionInfo.ModelID)
+}
+
+// retrieveLockedVersion retrieves a locked version of a model, false if none of its versions is locked
+func retrieveLockedVersion(b backend.Backend, modelID string) (backend.VersionInfo, bool, error) {
+	for initialVersionNumber := uint(0); ; {
+		versionInfos, err := b.ListModelVersionInfos(modelID, initialVersionNumber, storageInfoPageSize)
+		if err != nil {
+			return backend.VersionInfo{}, false, fmt.Errorf("unable to list the versions of model %q: %w", modelID, err)
+		}
+		for _, versionInfo := range versionInfos {
+			if isVersionLocked(versionInfo) {
+				return versionInfo, true, nil
+			}
+			initialVersionNumber = versionInfo.VersionNumber + 1
+		}
+		if len(versionInfos) < storageInfoPageSize {
+			return backend.VersionInfo{}, false, nil
+		}
+	}
+}
+
+// lockedUserData is the user data of a version once locked or unlocked
+func lockedUserData(userData map[string]string, locked bool) map[string]string {
+	updatedUserData := make(map[string]string, len(userData)+1)
+	for key, value := range userData {
+		updatedUserData[key] = value
+	}
+	if locked {
+		updatedUserData[VersionLockedUserDataKey] = "true"
+	} else {
+		delete(updatedUserData, VersionLockedUserDataKey)
+	}
+	return updatedUserData
+}
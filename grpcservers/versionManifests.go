@@ -0,0 +1,160 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// Version user data keys describing what is needed to serve a version, they are set when the version is created
+const (
+	VersionManifestUserDataKeyPrefix = "cogment_model_registry.manifest."
+	FrameworkUserDataKey             = VersionManifestUserDataKeyPrefix + "framework"           // e.g. "pytorch", required by the other entries
+	FrameworkVersionUserDataKey      = VersionManifestUserDataKeyPrefix + "framework_version"   // e.g. "2.1.0"
+	InputsUserDataKey                = VersionManifestUserDataKeyPrefix + "inputs"              // JSON array of tensor specs
+	OutputsUserDataKey               = VersionManifestUserDataKeyPrefix + "outputs"             // JSON array of tensor specs
+	PythonDependenciesUserDataKey    = VersionManifestUserDataKeyPrefix + "python_dependencies" // JSON array of requirement specifiers, e.g. "numpy>=1.21"
+)
+
+var tensorDTypes = map[string]bool{
+	"bool": true, "string": true,
+	"int8": true, "int16": true, "int32": true, "int64": true,
+	"uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float16": true, "bfloat16": true, "float32": true, "float64": true,
+}
+
+// A requirement specifier as defined by PEP 508, without environment markers, e.g. "torch[cuda] >=2.0, <3"
+var pythonDependencyRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?(\[[A-Za-z0-9._, -]+\])?\s*((===|==|!=|~=|<=|>=|<|>)\s*[A-Za-z0-9.*+!_-]+(\s*,\s*(===|==|!=|~=|<=|>=|<|>)\s*[A-Za-z0-9.*+!_-]+)*)?$`)
+
+type tensorSpec struct {
+	Name  string  `json:"name"`
+	DType string  `json:"dtype"`
+	Shape []int64 `json:"shape"` // -1 for a dynamic dimension
+}
+
+type versionManifest struct {
+	framework          string
+	frameworkVersion   string
+	inputs             []tensorSpec
+	outputs            []tensorSpec
+	pythonDependencies []string
+}
+
+func parseTensorSpecs(key string, value string) ([]tensorSpec, error) {
+	specs := []tensorSpec{}
+	if err := json.Unmarshal([]byte(value), &specs); err != nil {
+		return nil, fmt.Errorf("invalid %q, expecting a JSON array of tensor specs: %w", key, err)
+	}
+	names := map[string]bool{}
+	for _, spec := range specs {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("invalid %q, every tensor needs a name", key)
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("invalid %q, tensor %q is defined more than once", key, spec.Name)
+		}
+		names[spec.Name] = true
+		if !tensorDTypes[spec.DType] {
+			return nil, fmt.Errorf("invalid %q, unknown dtype %q for tensor %q", key, spec.DType, spec.Name)
+		}
+		for _, dimension := range spec.Shape {
+			if dimension < -1 {
+				return nil, fmt.Errorf("invalid %q, dimension %d of tensor %q is neither positive nor -1", key, dimension, spec.Name)
+			}
+		}
+	}
+	return specs, nil
+}
+
+// parseVersionManifest retrieves the manifest of a version from its user data, nil if it has none
+func parseVersionManifest(userData map[string]string) (*versionManifest, error) {
+	hasManifest := false
+	for key := range userData {
+		switch key {
+		case FrameworkUserDataKey, FrameworkVersionUserDataKey, InputsUserDataKey, OutputsUserDataKey, PythonDependenciesUserDataKey:
+			hasManifest = true
+		default:
+			if strings.HasPrefix(key, VersionManifestUserDataKeyPrefix) {
+				return nil, fmt.Errorf("unknown manifest user data key %q", key)
+			}
+		}
+	}
+	if !hasManifest {
+		return nil, nil
+	}
+	manifest := versionManifest{
+		framework:        userData[FrameworkUserDataKey],
+		frameworkVersion: userData[FrameworkVersionUserDataKey],
+	}
+	if manifest.framework == "" {
+		return nil, fmt.Errorf("%q is required by the other manifest entries", FrameworkUserDataKey)
+	}
+	var err error
+	if value, ok := userData[InputsUserDataKey]; ok {
+		if manifest.inputs, err = parseTensorSpecs(InputsUserDataKey, value); err != nil {
+			return nil, err
+		}
+	}
+	if value, ok := userData[OutputsUserDataKey]; ok {
+		if manifest.outputs, err = parseTensorSpecs(OutputsUserDataKey, value); err != nil {
+			return nil, err
+		}
+	}
+	if value, ok := userData[PythonDependenciesUserDataKey]; ok {
+		if err := json.Unmarshal([]byte(value), &manifest.pythonDependencies); err != nil {
+			return nil, fmt.Errorf("invalid %q, expecting a JSON array of requirement specifiers: %w", PythonDependenciesUserDataKey, err)
+		}
+		for _, dependency := range manifest.pythonDependencies {
+			if !pythonDependencyRegexp.MatchString(dependency) {
+				return nil, fmt.Errorf("invalid %q, %q is not a requirement specifier", PythonDependenciesUserDataKey, dependency)
+			}
+		}
+	}
+	return &manifest, nil
+}
+
+// validateVersionManifest checks the manifest of a version about to be created
+func validateVersionManifest(userData map[string]string) error {
+	if _, err := parseVersionManifest(userData); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	return nil
+}
+
+func createPbTensorSpecs(specs []tensorSpec) []*extensionsapi.TensorSpec {
+	pbSpecs := make([]*extensionsapi.TensorSpec, 0, len(specs))
+	for _, spec := range specs {
+		pbSpecs = append(pbSpecs, &extensionsapi.TensorSpec{Name: spec.Name, Dtype: spec.DType, Shape: spec.Shape})
+	}
+	return pbSpecs
+}
+
+func createPbVersionManifest(manifest versionManifest) *extensionsapi.VersionManifest {
+	return &extensionsapi.VersionManifest{
+		Framework:          manifest.framework,
+		FrameworkVersion:   manifest.frameworkVersion,
+		Inputs:             createPbTensorSpecs(manifest.inputs),
+		Outputs:            createPbTensorSpecs(manifest.outputs),
+		PythonDependencies: manifest.pythonDependencies,
+	}
+}
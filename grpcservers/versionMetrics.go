@@ -0,0 +1,107 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// VersionMetricUserDataKeyPrefix prefixes the version user data keys holding its metrics, e.g. evaluation scores
+const VersionMetricUserDataKeyPrefix = "cogment_model_registry.metric."
+
+var versionMetricNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func validateVersionMetricName(name string) error {
+	if !versionMetricNameRegexp.MatchString(name) {
+		return status.Errorf(codes.InvalidArgument, "invalid metric name %q, only letters, digits, `_`, `.` and `-` are allowed", name)
+	}
+	return nil
+}
+
+// versionMetric retrieves a metric of a version, entries that aren't numbers are ignored
+func versionMetric(versionInfo backend.VersionInfo, name string) (float64, bool) {
+	value, ok := versionInfo.UserData[VersionMetricUserDataKeyPrefix+name]
+	if !ok {
+		return 0, false
+	}
+	metric, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(metric) {
+		return 0, false
+	}
+	return metric, true
+}
+
+// patchVersionMetrics applies the metrics changes requested by UpdateVersionInfo to the user data of a version
+func patchVersionMetrics(userData map[string]string, metrics map[string]float64, removedMetricNames []string) error {
+	for name, metric := range metrics {
+		if err := validateVersionMetricName(name); err != nil {
+			return err
+		}
+		if math.IsNaN(metric) || math.IsInf(metric, 0) {
+			return status.Errorf(codes.InvalidArgument, "invalid value for metric %q, it needs to be a finite number", name)
+		}
+		userData[VersionMetricUserDataKeyPrefix+name] = strconv.FormatFloat(metric, 'g', -1, 64)
+	}
+	for _, name := range removedMetricNames {
+		if _, ok := metrics[name]; ok {
+			return status.Errorf(codes.InvalidArgument, "unable to both set and remove metric %q", name)
+		}
+		delete(userData, VersionMetricUserDataKeyPrefix+name)
+	}
+	return nil
+}
+
+// sortVersionInfosByMetric orders the versions having a metric by its value, ties are ordered by version number
+func sortVersionInfosByMetric(versionInfos []backend.VersionInfo, name string, descending bool) []backend.VersionInfo {
+	type measuredVersionInfo struct {
+		versionInfo backend.VersionInfo
+		metric      float64
+	}
+	measuredVersionInfos := []measuredVersionInfo{}
+	for _, versionInfo := range versionInfos {
+		if metric, ok := versionMetric(versionInfo, name); ok {
+			measuredVersionInfos = append(measuredVersionInfos, measuredVersionInfo{versionInfo: versionInfo, metric: metric})
+		}
+	}
+	sort.SliceStable(measuredVersionInfos, func(i, j int) bool {
+		if measuredVersionInfos[i].metric == measuredVersionInfos[j].metric {
+			return measuredVersionInfos[i].versionInfo.VersionNumber < measuredVersionInfos[j].versionInfo.VersionNumber
+		}
+		if descending {
+			return measuredVersionInfos[i].metric > measuredVersionInfos[j].metric
+		}
+		return measuredVersionInfos[i].metric < measuredVersionInfos[j].metric
+	})
+	sortedVersionInfos := make([]backend.VersionInfo, 0, len(measuredVersionInfos))
+	for _, measuredVersionInfo := range measuredVersionInfos {
+		sortedVersionInfos = append(sortedVersionInfos, measuredVersionInfo.versionInfo)
+	}
+	return sortedVersionInfos
+}
+
+func versionsByMetricPaginationScope(modelID string, name string, descending bool) string {
+	if descending {
+		return "versions_by_metric_desc/" + name + "/" + modelID
+	}
+	return "versions_by_metric/" + name + "/" + modelID
+}
@@ -0,0 +1,260 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcservers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Model user data keys starting with this prefix, followed by a version number, store the stage history of the version
+const VersionStageUserDataKeyPrefix = "cogment_model_registry.stage."
+
+// Model user data keys starting with this prefix, followed by a stage name, list the comma separated version user data
+// keys a version needs to define to enter the stage, e.g. `cogment_model_registry.stage_requirements.production=score`
+const VersionStageRequirementsUserDataKeyPrefix = "cogment_model_registry.stage_requirements."
+
+// Aliases of the versions in the staging and production stages, a single version of a model is in each
+const (
+	StagingVersionAlias    = "staging"
+	ProductionVersionAlias = "production"
+)
+
+var versionStageNames = map[extensionsapi.VersionStage]string{
+	extensionsapi.VersionStage_NO_STAGE:   "none",
+	extensionsapi.VersionStage_STAGING:    "staging",
+	extensionsapi.VersionStage_PRODUCTION: "production",
+	extensionsapi.VersionStage_RETIRED:    "retired",
+}
+
+var versionStageAliases = map[extensionsapi.VersionStage]string{
+	extensionsapi.VersionStage_STAGING:    StagingVersionAlias,
+	extensionsapi.VersionStage_PRODUCTION: ProductionVersionAlias,
+}
+
+// versionStageTransition is the JSON representation of a transition in the stage history of a version
+type versionStageTransition struct {
+	Stage     string    `json:"stage"`
+	Timestamp time.Time `json:"timestamp"`
+	Comment   string    `json:"comment,omitempty"`
+}
+
+// versionStageHistory is the stage history of a version, by chronological order
+type versionStageHistory []versionStageTransition
+
+func versionStageKey(versionNumber uint) string {
+	return VersionStageUserDataKeyPrefix + strconv.FormatUint(uint64(versionNumber), 10)
+}
+
+func parseVersionStage(name string) (extensionsapi.VersionStage, bool) {
+	for stage, stageName := range versionStageNames {
+		if stageName == name {
+			return stage, true
+		}
+	}
+	return extensionsapi.VersionStage_NO_STAGE, false
+}
+
+// retrieveVersionStageHistory reads the stage history of a version from the user data of its model
+func retrieveVersionStageHistory(userData map[string]string, versionNumber uint) (versionStageHistory, error) {
+	value, ok := userData[versionStageKey(versionNumber)]
+	if !ok {
+		return versionStageHistory{}, nil
+	}
+	history := versionStageHistory{}
+	if err := json.Unmarshal([]byte(value), &history); err != nil {
+		return nil, fmt.Errorf("invalid stage history for version \"%d\": %w", versionNumber, err)
+	}
+	for _, transition := range history {
+		if _, ok := parseVersionStage(transition.Stage); !ok {
+			return nil, fmt.Errorf("invalid stage history for version \"%d\": unknown stage %q", versionNumber, transition.Stage)
+		}
+	}
+	return history, nil
+}
+
+func (h versionStageHistory) stage() extensionsapi.VersionStage {
+	if len(h) == 0 {
+		return extensionsapi.VersionStage_NO_STAGE
+	}
+	stage, _ := parseVersionStage(h[len(h)-1].Stage)
+	return stage
+}
+
+// record appends a transition to the history and stores it in the user data of the model
+func (h versionStageHistory) record(userData map[string]string, versionNumber uint, transition versionStageTransition) (versionStageHistory, error) {
+	history := append(append(versionStageHistory{}, h...), transition)
+	value, err := json.Marshal(history)
+	if err != nil {
+		return nil, fmt.Errorf("unable to serialize the stage history for version \"%d\": %w", versionNumber, err)
+	}
+	userData[versionStageKey(versionNumber)] = string(value)
+	return history, nil
+}
+
+func createPbVersionStageHistory(history versionStageHistory) []*extensionsapi.VersionStageTransition {
+	pbHistory := []*extensionsapi.VersionStageTransition{}
+	for _, transition := range history {
+		stage, _ := parseVersionStage(transition.Stage)
+		pbHistory = append(pbHistory, &extensionsapi.VersionStageTransition{
+			Stage:     stage,
+			Timestamp: nsTimestampFromTime(transition.Timestamp),
+			Comment:   transition.Comment,
+		})
+	}
+	return pbHistory
+}
+
+// validVersionStageTransition checks if a version can go from a stage to another, versions move forward one stage at
+// a time and can be retired from any stage
+func validVersionStageTransition(from extensionsapi.VersionStage, to extensionsapi.VersionStage) bool {
+	switch to {
+	case extensionsapi.VersionStage_STAGING:
+		return from == extensionsapi.VersionStage_NO_STAGE
+	case extensionsapi.VersionStage_PRODUCTION:
+		return from == extensionsapi.VersionStage_STAGING
+	case extensionsapi.VersionStage_RETIRED:
+		return from != extensionsapi.VersionStage_RETIRED
+	}
+	return false
+}
+
+// missingVersionStageRequirements lists the version user data keys required by the model to enter a stage that the
+// version doesn't define
+func missingVersionStageRequirements(modelInfo backend.ModelInfo, versionInfo backend.VersionInfo, stage extensionsapi.VersionStage) []string {
+	missingKeys := []string{}
+	requirements, ok := modelInfo.UserData[VersionStageRequirementsUserDataKeyPrefix+versionStageNames[stage]]
+	if !ok {
+		return missingKeys
+	}
+	for _, key := range strings.Split(requirements, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if _, ok := versionInfo.UserData[key]; !ok {
+			missingKeys = append(missingKeys, key)
+		}
+	}
+	return missingKeys
+}
+
+// transitionVersionStage moves a version to a stage, the version previously in this stage is retired
+//
+// It returns the updated model info, the info and history of the transitioned version and the retired version numbers.
+func transitionVersionStage(b backend.Backend, modelID string, versionNumber int, stage extensionsapi.VersionStage, comment string, now time.Time) (backend.ModelInfo, backend.VersionInfo, versionStageHistory, []uint, error) {
+	modelInfo, err := b.RetrieveModelInfo(modelID)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return backend.ModelInfo{}, backend.VersionInfo{}, nil, nil, errorStatus(codes.NotFound, err)
+		}
+		return backend.ModelInfo{}, backend.VersionInfo{}, nil, nil, status.Errorf(codes.Internal, "unexpected error while transitioning a version of model %q: %s", modelID, err)
+	}
+	versionInfo, err := b.RetrieveModelVersionInfo(modelID, versionNumber)
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return backend.ModelInfo{}, backend.VersionInfo{}, nil, nil, errorStatus(codes.NotFound, err)
+		}
+		return backend.ModelInfo{}, backend.VersionInfo{}, nil, nil, status.Errorf(codes.Internal, `unexpected error while transitioning version "%d" of model %q: %s`, versionNumber, modelID, err)
+	}
+
+	history, err := retrieveVersionStageHistory(modelInfo.UserData, versionInfo.VersionNumber)
+	if err != nil {
+		return backend.ModelInfo{}, backend.VersionInfo{}, nil, nil, status.Errorf(codes.Internal, "unexpected error while transitioning a version of model %q: %s", modelID, err)
+	}
+	currentStage := history.stage()
+	if !validVersionStageTransition(currentStage, stage) {
+		return backend.ModelInfo{}, backend.VersionInfo{}, nil, nil, status.Errorf(codes.FailedPrecondition, `version "%d" of model %q can't go from stage %q to stage %q`, versionInfo.VersionNumber, modelID, versionStageNames[currentStage], versionStageNames[stage])
+	}
+	if missingKeys := missingVersionStageRequirements(modelInfo, versionInfo, stage); len(missingKeys) > 0 {
+		return backend.ModelInfo{}, backend.VersionInfo{}, nil, nil, status.Errorf(codes.FailedPrecondition, `version "%d" of model %q needs to define the user data %q to enter stage %q`, versionInfo.VersionNumber, modelID, missingKeys, versionStageNames[stage])
+	}
+
+	userData := make(map[string]string, len(modelInfo.UserData)+2)
+	for key, value := range modelInfo.UserData {
+		userData[key] = value
+	}
+	aliasedVersionNumber := strconv.FormatUint(uint64(versionInfo.VersionNumber), 10)
+	// Leaving a stage unsets its alias
+	if alias, ok := versionStageAliases[currentStage]; ok && userData[VersionAliasUserDataKeyPrefix+alias] == aliasedVersionNumber {
+		delete(userData, VersionAliasUserDataKeyPrefix+alias)
+	}
+	retiredVersionNumbers := []uint{}
+	if alias, ok := versionStageAliases[stage]; ok {
+		// The version previously in the stage is retired, unless it was deleted since
+		if previousValue, ok := userData[VersionAliasUserDataKeyPrefix+alias]; ok {
+			previousVersionNumber, err := strconv.ParseUint(previousValue, 10, 32)
+			if err == nil {
+				previousHistory, err := retrieveVersionStageHistory(userData, uint(previousVersionNumber))
+				if err == nil && previousHistory.stage() == stage {
+					_, err = previousHistory.record(userData, uint(previousVersionNumber), versionStageTransition{
+						Stage:     versionStageNames[extensionsapi.VersionStage_RETIRED],
+						Timestamp: now,
+						Comment:   fmt.Sprintf("Replaced by version \"%d\"", versionInfo.VersionNumber),
+					})
+					if err != nil {
+						return backend.ModelInfo{}, backend.VersionInfo{}, nil, nil, status.Errorf(codes.Internal, "unexpected error while transitioning a version of model %q: %s", modelID, err)
+					}
+					retiredVersionNumbers = append(retiredVersionNumbers, uint(previousVersionNumber))
+				}
+			}
+		}
+		userData[VersionAliasUserDataKeyPrefix+alias] = aliasedVersionNumber
+	}
+	history, err = history.record(userData, versionInfo.VersionNumber, versionStageTransition{
+		Stage:     versionStageNames[stage],
+		Timestamp: now,
+		Comment:   comment,
+	})
+	if err != nil {
+		return backend.ModelInfo{}, backend.VersionInfo{}, nil, nil, status.Errorf(codes.Internal, "unexpected error while transitioning a version of model %q: %s", modelID, err)
+	}
+
+	updatedModelInfo, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: modelID, UserData: userData})
+	if err != nil {
+		return backend.ModelInfo{}, backend.VersionInfo{}, nil, nil, status.Errorf(codes.Internal, `unexpected error while transitioning version "%d" of model %q: %s`, versionInfo.VersionNumber, modelID, err)
+	}
+	return updatedModelInfo, versionInfo, history, retiredVersionNumbers, nil
+}
+
+// forgetVersionStageHistory removes the stage history of a deleted version, a later version could reuse its number
+func forgetVersionStageHistory(b backend.Backend, modelID string, versionNumber uint) (backend.ModelInfo, bool, error) {
+	modelInfo, err := b.RetrieveModelInfo(modelID)
+	if err != nil {
+		return backend.ModelInfo{}, false, err
+	}
+	if _, ok := modelInfo.UserData[versionStageKey(versionNumber)]; !ok {
+		return modelInfo, false, nil
+	}
+	userData := make(map[string]string, len(modelInfo.UserData))
+	for key, value := range modelInfo.UserData {
+		userData[key] = value
+	}
+	delete(userData, versionStageKey(versionNumber))
+	updatedModelInfo, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: modelID, UserData: userData})
+	if err != nil {
+		return backend.ModelInfo{}, false, err
+	}
+	return updatedModelInfo, true, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthapi "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// Metrics published under `/debug/vars`
+var (
+	backendHealthyMetric      = expvar.NewMap("backend_healthy") // 1 for each healthy backend, 0 otherwise
+	backendPingFailuresMetric = expvar.NewInt("backend_ping_failures")
+)
+
+type Configuration struct {
+	Interval time.Duration // Delay between two probes of the backends
+	Services []string      // Services whose status is the one of the backends, besides the overall "" one
+}
+
+type probedBackend struct {
+	name          string
+	backend       backend.Backend
+	healthy       bool
+	probed        bool
+	healthyMetric *expvar.Int
+}
+
+// Monitor probes the backends of the registry and reports their state through the gRPC health service
+//
+// The registry is serving once every added backend answers its ping, it starts as not serving until the first probe.
+type Monitor struct {
+	configuration Configuration
+	server        *grpchealth.Server
+	mutex         sync.Mutex
+	backends      []*probedBackend
+	healthy       bool
+}
+
+// CreateMonitor creates a monitor without any backend
+func CreateMonitor(configuration Configuration) *Monitor {
+	m := &Monitor{
+		configuration: configuration,
+		server:        grpchealth.NewServer(),
+	}
+	m.setServingStatus(healthapi.HealthCheckResponse_NOT_SERVING)
+	return m
+}
+
+// Register registers the gRPC health service
+func (m *Monitor) Register(registrar grpc.ServiceRegistrar) {
+	healthapi.RegisterHealthServer(registrar, m.server)
+}
+
+// AddBackend adds a backend to probe, the registry isn't serving until it is probed
+func (m *Monitor) AddBackend(name string, b backend.Backend) {
+	healthyMetric := new(expvar.Int)
+	backendHealthyMetric.Set(name, healthyMetric)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.backends = append(m.backends, &probedBackend{name: name, backend: b, healthyMetric: healthyMetric})
+}
+
+// Healthy returns true if every backend answered its latest ping
+func (m *Monitor) Healthy() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.healthy
+}
+
+// BackendState is the outcome of the latest probe of a backend
+type BackendState struct {
+	Name    string `json:"name"`
+	Probed  bool   `json:"probed"`
+	Healthy bool   `json:"healthy"`
+}
+
+// BackendStates returns the state of every added backend
+func (m *Monitor) BackendStates() []BackendState {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	states := make([]BackendState, 0, len(m.backends))
+	for _, probed := range m.backends {
+		states = append(states, BackendState{Name: probed.name, Probed: probed.probed, Healthy: probed.healthy})
+	}
+	return states
+}
+
+// Run probes the backends every configured interval until the context is done
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.configuration.Interval)
+	defer ticker.Stop()
+	for {
+		m.Probe()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Probe pings every backend once, updates the serving status and returns whether every backend is healthy
+func (m *Monitor) Probe() bool {
+	m.mutex.Lock()
+	backends := append([]*probedBackend{}, m.backends...)
+	m.mutex.Unlock()
+
+	// Pinging may be slow, the lock isn't held in between
+	errs := make([]error, len(backends))
+	for index, probed := range backends {
+		errs[index] = probed.backend.Ping()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	healthy := len(backends) > 0
+	for index, probed := range backends {
+		log := logrus.WithField("backend", probed.name)
+		if err := errs[index]; err != nil {
+			healthy = false
+			backendPingFailuresMetric.Add(1)
+			probed.healthyMetric.Set(0)
+			if probed.healthy || !probed.probed {
+				log.WithError(err).Warn("Backend unhealthy")
+			}
+		} else {
+			probed.healthyMetric.Set(1)
+			if !probed.healthy && probed.probed {
+				log.Info("Backend healthy again")
+			}
+		}
+		probed.healthy = errs[index] == nil
+		probed.probed = true
+	}
+	if healthy != m.healthy {
+		m.healthy = healthy
+		if healthy {
+			m.setServingStatus(healthapi.HealthCheckResponse_SERVING)
+		} else {
+			m.setServingStatus(healthapi.HealthCheckResponse_NOT_SERVING)
+		}
+	}
+	return healthy
+}
+
+// Shutdown sets every service as not serving for good, e.g. while the registry stops
+func (m *Monitor) Shutdown() {
+	m.server.Shutdown()
+}
+
+func (m *Monitor) setServingStatus(servingStatus healthapi.HealthCheckResponse_ServingStatus) {
+	m.server.SetServingStatus("", servingStatus)
+	for _, service := range m.configuration.Services {
+		m.server.SetServingStatus(service, servingStatus)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	healthapi "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+)
+
+type unreliableBackend struct {
+	backend.Backend
+	unreachable int32
+}
+
+func (b *unreliableBackend) Ping() error {
+	if atomic.LoadInt32(&b.unreachable) == 1 {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func servingStatus(t *testing.T, m *Monitor, service string) healthapi.HealthCheckResponse_ServingStatus {
+	rep, err := m.server.Check(context.Background(), &healthapi.HealthCheckRequest{Service: service})
+	assert.NoError(t, err)
+	return rep.Status
+}
+
+func TestProbe(t *testing.T) {
+	m := CreateMonitor(Configuration{Services: []string{"cogmentAPI.ModelRegistrySP"}})
+	assert.Equal(t, healthapi.HealthCheckResponse_NOT_SERVING, servingStatus(t, m, ""))
+	// Not serving until a backend is added
+	assert.False(t, m.Probe())
+
+	fsBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	b := &unreliableBackend{Backend: fsBackend}
+	m.AddBackend("default", b)
+	assert.Equal(t, []BackendState{{Name: "default"}}, m.BackendStates())
+	assert.True(t, m.Probe())
+	assert.Equal(t, []BackendState{{Name: "default", Probed: true, Healthy: true}}, m.BackendStates())
+	assert.True(t, m.Healthy())
+	assert.Equal(t, healthapi.HealthCheckResponse_SERVING, servingStatus(t, m, ""))
+	assert.Equal(t, healthapi.HealthCheckResponse_SERVING, servingStatus(t, m, "cogmentAPI.ModelRegistrySP"))
+	assert.Equal(t, "1", backendHealthyMetric.Get("default").String())
+
+	atomic.StoreInt32(&b.unreachable, 1)
+	assert.False(t, m.Probe())
+	assert.Equal(t, healthapi.HealthCheckResponse_NOT_SERVING, servingStatus(t, m, "cogmentAPI.ModelRegistrySP"))
+	assert.Equal(t, []BackendState{{Name: "default", Probed: true}}, m.BackendStates())
+	assert.Equal(t, "0", backendHealthyMetric.Get("default").String())
+
+	atomic.StoreInt32(&b.unreachable, 0)
+	assert.True(t, m.Probe())
+	assert.Equal(t, healthapi.HealthCheckResponse_SERVING, servingStatus(t, m, ""))
+
+	m.Shutdown()
+	assert.Equal(t, healthapi.HealthCheckResponse_NOT_SERVING, servingStatus(t, m, ""))
+}
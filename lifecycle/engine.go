@@ -0,0 +1,124 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/coldStorage"
+	"github.com/sirupsen/logrus"
+)
+
+// Number of models or versions listed at once while walking the backend
+const pageSize = 100
+
+var movedVersionsMetric = expvar.NewInt("lifecycle_moved_versions")
+
+type Configuration struct {
+	Interval time.Duration // Delay between two applications of the rules
+	MinAge   time.Duration // Archived versions created, or restored, longer ago are moved to the cold backend
+}
+
+type Engine struct {
+	backend       coldStorage.Backend
+	configuration Configuration
+}
+
+// CreateEngine creates an engine moving the old archived versions of a backend to its cold backend
+func CreateEngine(b coldStorage.Backend, configuration Configuration) *Engine {
+	return &Engine{
+		backend:       b,
+		configuration: configuration,
+	}
+}
+
+// Run applies the rules every configured interval until the context is done
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.configuration.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			movedVersions, err := e.Apply(ctx, time.Now())
+			if err != nil && ctx.Err() == nil {
+				logrus.WithError(err).Error("Lifecycle rules application failed")
+			} else if movedVersions > 0 {
+				logrus.WithField("moved_versions", movedVersions).Info("Lifecycle rules moved archived versions to the cold backend")
+			}
+		}
+	}
+}
+
+// Apply moves the archived versions older than the minimum age at the given time and returns how many were moved
+func (e *Engine) Apply(ctx context.Context, now time.Time) (int, error) {
+	movedVersions := 0
+	before := now.Add(-e.configuration.MinAge)
+	for modelOffset := 0; ; modelOffset += pageSize {
+		modelInfos, err := e.backend.ListModels(modelOffset, pageSize)
+		if err != nil {
+			return movedVersions, fmt.Errorf("unable to list models: %w", err)
+		}
+		for _, modelInfo := range modelInfos {
+			modelMovedVersions, err := e.applyModel(ctx, modelInfo.ModelID, before)
+			movedVersions += modelMovedVersions
+			if err != nil {
+				return movedVersions, err
+			}
+		}
+		if len(modelInfos) < pageSize {
+			return movedVersions, nil
+		}
+	}
+}
+
+func (e *Engine) applyModel(ctx context.Context, modelID string, before time.Time) (int, error) {
+	movedVersions := 0
+	// Restored versions are created earlier than they are restored, the backend checks their actual age
+	filter := backend.VersionFilter{Archived: backend.ArchivedOnly, CreatedBefore: before}
+	for initialVersionNumber := uint(0); ; {
+		versionInfos, err := e.backend.QueryModelVersionInfos(modelID, filter, initialVersionNumber, pageSize)
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				// Deleted in between
+				return movedVersions, nil
+			}
+			return movedVersions, fmt.Errorf("unable to list the versions of model %q: %w", modelID, err)
+		}
+		for _, versionInfo := range versionInfos {
+			if err := ctx.Err(); err != nil {
+				return movedVersions, err
+			}
+			moved, err := e.backend.MoveModelVersion(modelID, versionInfo.VersionNumber, before)
+			if err != nil && !errors.Is(err, backend.ErrNotFound) {
+				return movedVersions, fmt.Errorf("unable to move version \"%d\" of model %q: %w", versionInfo.VersionNumber, modelID, err)
+			}
+			if moved {
+				movedVersions++
+				movedVersionsMetric.Add(1)
+			}
+			initialVersionNumber = versionInfo.VersionNumber + 1
+		}
+		if len(versionInfos) < pageSize {
+			return movedVersions, nil
+		}
+	}
+}
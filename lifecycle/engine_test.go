@@ -0,0 +1,73 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/coldStorage"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+var now = time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestApply(t *testing.T) {
+	primary, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer primary.Destroy()
+	cold, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer cold.Destroy()
+	b, err := coldStorage.CreateBackend(primary, cold)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	// Versions created every day until `now`, the last two being archived
+	for i := 0; i < 4; i++ {
+		_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+			CreationTimestamp: now.Add(-time.Duration(3-i) * 24 * time.Hour),
+			Archived:          i >= 2,
+			DataHash:          backend.ComputeSHA256Hash(data),
+			Data:              data,
+		})
+		assert.NoError(t, err)
+	}
+
+	engine := CreateEngine(b, Configuration{Interval: time.Hour, MinAge: 12 * time.Hour})
+	movedVersions, err := engine.Apply(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, movedVersions)
+	coldVersionInfos, err := cold.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, coldVersionInfos, 1)
+	assert.Equal(t, uint(3), coldVersionInfos[0].VersionNumber)
+
+	movedVersions, err = engine.Apply(context.Background(), now.Add(24*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, movedVersions)
+	for versionNumber := 1; versionNumber <= 4; versionNumber++ {
+		retrievedData, err := b.RetrieveModelVersionData("foo", versionNumber)
+		assert.NoError(t, err)
+		assert.Equal(t, data, retrievedData)
+	}
+}
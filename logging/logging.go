@@ -0,0 +1,171 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDMetadataKey is the gRPC metadata key holding the id of a request, generated when not provided by the client
+const RequestIDMetadataKey = "x-request-id"
+
+type Configuration struct {
+	Level  string // One of "trace", "debug", "info", "warning", "error", "fatal" or "panic"
+	Format string // Either "text" or "json"
+}
+
+// UnknownFormatError is raised when configuring an unsupported log format
+type UnknownFormatError struct {
+	Format string
+}
+
+func (e *UnknownFormatError) Error() string {
+	return fmt.Sprintf("unknown log format %q, expecting \"text\" or \"json\"", e.Format)
+}
+
+// Configure sets the level and the format of the standard logger
+func Configure(configuration Configuration) error {
+	level, err := logrus.ParseLevel(configuration.Level)
+	if err != nil {
+		return fmt.Errorf("unable to configure logging: %w", err)
+	}
+	switch configuration.Format {
+	case "text":
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return &UnknownFormatError{Format: configuration.Format}
+	}
+	logrus.SetLevel(level)
+	return nil
+}
+
+type contextKey struct{}
+
+// FromContext retrieves the logger of the RPC handled in the given context, the standard logger if none is defined
+func FromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(contextKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// WithFields adds fields to the logger of the RPC handled in the given context
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	return context.WithValue(ctx, contextKey{}, FromContext(ctx).WithFields(fields))
+}
+
+func generateRequestID() string {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// createRPCContext adds a logger with the request id, the method and the peer as fields to the context of an RPC
+func createRPCContext(ctx context.Context, method string) (context.Context, string, *logrus.Entry) {
+	requestID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDMetadataKey); len(values) > 0 {
+			requestID = values[0]
+		}
+	}
+	if requestID == "" {
+		requestID = generateRequestID()
+	}
+	// Sending back the request id, the header might already be sent by the handler
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, requestID))
+
+	fields := logrus.Fields{
+		"request_id": requestID,
+		"method":     method,
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		fields["peer"] = p.Addr.String()
+	}
+	entry := logrus.WithFields(fields)
+	entry.Debug("RPC started")
+	return context.WithValue(ctx, contextKey{}, entry), requestID, entry
+}
+
+// withRequestID adds the request id to the message of an error, keeping its code and details, for the clients to report it
+func withRequestID(err error, requestID string) error {
+	if err == nil {
+		return nil
+	}
+	pbStatus := status.Convert(err).Proto()
+	pbStatus.Message = fmt.Sprintf("%s (request id %q)", pbStatus.Message, requestID)
+	return status.FromProto(pbStatus).Err()
+}
+
+// logCompletion logs the outcome of an RPC, errors caused by the server are logged as errors
+func logCompletion(entry *logrus.Entry, startTime time.Time, err error) {
+	code := status.Code(err)
+	entry = entry.WithFields(logrus.Fields{
+		"code":     code.String(),
+		"duration": time.Since(startTime).String(),
+	})
+	switch code {
+	case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unavailable:
+		entry.WithError(err).Error("RPC failed")
+	default:
+		entry.Debug("RPC completed")
+	}
+}
+
+// UnaryServerInterceptor makes a logger with the request fields available to unary RPC handlers through FromContext
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		startTime := time.Now()
+		ctx, requestID, entry := createRPCContext(ctx, info.FullMethod)
+		rep, err := handler(ctx, req)
+		logCompletion(entry, startTime, err)
+		return rep, withRequestID(err, requestID)
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor makes a logger with the request fields available to streaming RPC handlers through FromContext
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		startTime := time.Now()
+		ctx, requestID, entry := createRPCContext(stream.Context(), info.FullMethod)
+		err := handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+		logCompletion(entry, startTime, err)
+		return withRequestID(err, requestID)
+	}
+}
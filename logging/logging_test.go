@@ -0,0 +1,99 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestConfigure(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+	defer logrus.SetFormatter(logrus.StandardLogger().Formatter)
+
+	assert.NoError(t, Configure(Configuration{Level: "warning", Format: "json"}))
+	assert.Equal(t, logrus.WarnLevel, logrus.GetLevel())
+	assert.IsType(t, &logrus.JSONFormatter{}, logrus.StandardLogger().Formatter)
+
+	assert.Error(t, Configure(Configuration{Level: "loud", Format: "json"}))
+
+	err := Configure(Configuration{Level: "info", Format: "xml"})
+	assert.Error(t, err)
+	assert.IsType(t, &UnknownFormatError{}, err)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+	logrus.SetLevel(logrus.DebugLevel)
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/cogmentAPI.ModelRegistrySP/RetrieveModels"}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDMetadataKey, "foo"))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4242}})
+	_, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		entry := FromContext(ctx)
+		assert.Equal(t, "foo", entry.Data["request_id"])
+		assert.Equal(t, info.FullMethod, entry.Data["method"])
+		assert.Equal(t, "127.0.0.1:4242", entry.Data["peer"])
+		assert.Equal(t, "RPC started", hook.LastEntry().Message)
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, logrus.DebugLevel, hook.LastEntry().Level)
+	assert.Equal(t, "foo", hook.LastEntry().Data["request_id"])
+	assert.Equal(t, codes.OK.String(), hook.LastEntry().Data["code"])
+	assert.NotEmpty(t, hook.LastEntry().Data["duration"])
+
+	// The request id is added to the error messages, their code and details are kept
+	_, err = interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		st, err := status.New(codes.NotFound, "no model \"bar\" found").WithDetails(&emptypb.Empty{})
+		assert.NoError(t, err)
+		return nil, st.Err()
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, `no model "bar" found (request id "foo")`, status.Convert(err).Message())
+	assert.Len(t, status.Convert(err).Details(), 1)
+
+	requestIDs := []interface{}{}
+	for i := 0; i < 2; i++ {
+		_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			requestIDs = append(requestIDs, FromContext(ctx).Data["request_id"])
+			return nil, status.Errorf(codes.Internal, "failure")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, logrus.ErrorLevel, hook.LastEntry().Level)
+		assert.Equal(t, codes.Internal.String(), hook.LastEntry().Data["code"])
+	}
+	// Request ids are generated when not provided
+	assert.NotEmpty(t, requestIDs[0])
+	assert.NotEqual(t, requestIDs[0], requestIDs[1])
+
+	// Outside of an RPC the standard logger is used
+	assert.Empty(t, FromContext(context.Background()).Data)
+}
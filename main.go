@@ -15,81 +15,703 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"fmt"
-	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/cogment/cogment-model-registry/authorization"
 	"github.com/cogment/cogment-model-registry/backend"
-	"github.com/cogment/cogment-model-registry/backend/fs"
-	"github.com/cogment/cogment-model-registry/backend/memoryCache"
+	"github.com/cogment/cogment-model-registry/backend/circuitBreaker"
+	"github.com/cogment/cogment-model-registry/cli"
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/configuration"
+	"github.com/cogment/cogment-model-registry/deadlines"
+	"github.com/cogment/cogment-model-registry/diagnostics"
+	"github.com/cogment/cogment-model-registry/directory"
+	"github.com/cogment/cogment-model-registry/eventBus"
+	"github.com/cogment/cogment-model-registry/federation"
 	"github.com/cogment/cogment-model-registry/grpcservers"
+	"github.com/cogment/cogment-model-registry/health"
+	"github.com/cogment/cogment-model-registry/logging"
+	"github.com/cogment/cogment-model-registry/maintenance"
+	"github.com/cogment/cogment-model-registry/modelIDs"
+	"github.com/cogment/cogment-model-registry/namespaces"
+	"github.com/cogment/cogment-model-registry/recovery"
+	"github.com/cogment/cogment-model-registry/replication"
+	"github.com/cogment/cogment-model-registry/retention"
+	"github.com/cogment/cogment-model-registry/signature"
+	"github.com/cogment/cogment-model-registry/tenants"
+	"github.com/cogment/cogment-model-registry/throttling"
 	"github.com/cogment/cogment-model-registry/version"
+	"github.com/cogment/cogment-model-registry/webhooks"
 )
 
 func main() {
-	viper.AutomaticEnv()
-	viper.SetDefault("PORT", 9000)
-	viper.SetDefault("ARCHIVE_DIR", ".cogment_model_registry")
-	viper.SetDefault("VERSION_CACHE_MAX_ITEMS", memoryCache.DefaultVersionCacheConfiguration.MaxItems)
-	viper.SetDefault("SENT_MODEL_VERSION_DATA_CHUNK_SIZE", 1024*1024*5) // Default chunk size is 5 MB
-	viper.SetDefault("GRPC_REFLECTION", false)
-	viper.SetEnvPrefix("COGMENT_MODEL_REGISTRY")
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		if err := runBackupCommand(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	// Without any argument or with flags only, the server is started
+	var flagSettings map[string]string
+	if len(os.Args) > 1 && strings.HasPrefix(os.Args[1], "--restore-from") {
+		var err error
+		flagSettings, err = parseServerFlags(os.Args[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else if len(os.Args) > 1 {
+		if err := cli.Run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	configurationFilename := os.Getenv(configuration.FileEnvVar)
+	err := configuration.Load(viper.GetViper(), configurationFilename)
+	if err != nil {
+		logrus.Fatalf("%v", err)
+	}
+	for key, value := range flagSettings {
+		if value != "" {
+			viper.Set(key, value)
+		}
+	}
+
+	err = logging.Configure(logging.Configuration{
+		Level:  viper.GetString("LOG_LEVEL"),
+		Format: viper.GetString("LOG_FORMAT"),
+	})
+	if err != nil {
+		logrus.Fatalf("%v", err)
+	}
 
 	port := viper.GetInt("PORT")
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
-		log.Fatalf("unable to listen to tcp port %d: %v", port, err)
+		logrus.Fatalf("unable to listen to tcp port %d: %v", port, err)
 	}
-	var opts []grpc.ServerOption
-	server := grpc.NewServer(opts...)
-	modelRegistryServer, err := grpcservers.RegisterModelRegistryServer(server, viper.GetInt("SENT_MODEL_VERSION_DATA_CHUNK_SIZE"))
+	hashAlgorithm, err := backend.LookupHashAlgorithm(viper.GetString("HASH_ALGORITHM"))
 	if err != nil {
-		log.Fatalf("%v", err)
+		logrus.Fatalf("%v", err)
 	}
 
-	var archiveBackend backend.Backend
-	var backend backend.Backend
+	var signatureVerifier *signature.Verifier
+	if signaturePublicKeys := viper.GetString("SIGNATURE_PUBLIC_KEYS"); signaturePublicKeys != "" {
+		publicKeys, err := signature.ParsePublicKeys(signaturePublicKeys)
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+		signatureVerifier = signature.CreateVerifier(publicKeys, viper.GetBool("SIGNATURE_REQUIRED"))
+		logrus.WithField("required", viper.GetBool("SIGNATURE_REQUIRED")).Infof("Versions signatures verified against %d public keys", len(publicKeys))
+	} else if viper.GetBool("SIGNATURE_REQUIRED") {
+		logrus.Fatalf("COGMENT_MODEL_REGISTRY_SIGNATURE_REQUIRED requires COGMENT_MODEL_REGISTRY_SIGNATURE_PUBLIC_KEYS to be defined")
+	}
 
-	go func() {
-		archiveDir := viper.GetString("ARCHIVE_DIR")
-		archiveBackend, err = fs.CreateBackend(archiveDir)
+	var namespacesConfiguration *namespaces.Configuration
+	if namespacesFilename := viper.GetString("NAMESPACES_FILE"); namespacesFilename != "" {
+		namespacesConfiguration, err = namespaces.LoadConfiguration(namespacesFilename)
 		if err != nil {
-			log.Fatalf("unable to create the archive filesystem backend: %v", err)
+			logrus.Fatalf("%v", err)
 		}
-		log.Printf("Filesystem backend created in %q for archived model versions\n", archiveDir)
+		logrus.WithField("required", namespacesConfiguration.Required).Infof("Namespaces loaded from %q with %d declared namespaces", namespacesFilename, len(namespacesConfiguration.Namespaces))
+	}
 
-		versionCacheConfiguration := memoryCache.VersionCacheConfiguration{
-			MaxItems: viper.GetInt("VERSION_CACHE_MAX_ITEMS"),
+	modelIDRules, err := modelIDs.ParseRules(viper.GetString("MODEL_ID_PATTERN"), viper.GetInt("MODEL_ID_MAX_LENGTH"), viper.GetString("MODEL_ID_RESERVED_PREFIXES"))
+	if err != nil {
+		logrus.Fatalf("%v", err)
+	}
+
+	maxVersionDataSize := viper.GetInt64("MAX_VERSION_DATA_SIZE")
+	if maxVersionDataSize < 0 {
+		logrus.Fatalf("invalid COGMENT_MODEL_REGISTRY_MAX_VERSION_DATA_SIZE %d, expecting a size in bytes or 0", maxVersionDataSize)
+	}
+
+	// The panics are recovered right after the logging, the failed calls are logged with their request id
+	unaryInterceptors := []grpc.UnaryServerInterceptor{logging.UnaryServerInterceptor(), recovery.UnaryServerInterceptor()}
+	streamInterceptors := []grpc.StreamServerInterceptor{logging.StreamServerInterceptor(), recovery.StreamServerInterceptor()}
+	deadlinesConfiguration := deadlines.Configuration{
+		UnaryTimeout:  viper.GetDuration("RPC_TIMEOUT"),
+		StreamTimeout: viper.GetDuration("STREAM_RPC_TIMEOUT"),
+		// The watches never finish by themselves
+		Unbounded: func(method string) bool {
+			return strings.Contains(method, "/Watch")
+		},
+	}
+	if deadlinesConfiguration.UnaryTimeout < 0 || deadlinesConfiguration.StreamTimeout < 0 {
+		logrus.Fatalf("invalid RPC timeouts, expecting positive durations or 0")
+	}
+	// Applied before the other interceptors, the time spent waiting in the maintenance queue or for an upload slot counts
+	unaryInterceptors = append(unaryInterceptors, deadlines.UnaryServerInterceptor(deadlinesConfiguration))
+	streamInterceptors = append(streamInterceptors, deadlines.StreamServerInterceptor(deadlinesConfiguration))
+	var policies *authorization.PolicyStore
+	if policyFilename := viper.GetString("AUTHORIZATION_POLICY_FILE"); policyFilename != "" {
+		policy, err := authorization.LoadPolicy(policyFilename)
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+		policies = authorization.CreatePolicyStore(policy)
+		unaryInterceptors = append(unaryInterceptors, authorization.UnaryServerInterceptorFromStore(policies))
+		streamInterceptors = append(streamInterceptors, authorization.StreamServerInterceptorFromStore(policies))
+		logrus.Infof("Authorization policy loaded from %q with %d tokens", policyFilename, len(policy.Tokens))
+	}
+	var tenantsSettings map[string]*viper.Viper
+	if tenantsFilename := viper.GetString("TENANTS_FILE"); tenantsFilename != "" {
+		if policies == nil {
+			logrus.Fatalf("COGMENT_MODEL_REGISTRY_TENANTS_FILE requires COGMENT_MODEL_REGISTRY_AUTHORIZATION_POLICY_FILE to be defined, the tenant of each request is the one of its token")
 		}
-		backend, err = memoryCache.CreateBackend(versionCacheConfiguration, archiveBackend)
+		tenantsSettings, err = configuration.LoadTenants(viper.GetViper(), tenantsFilename)
 		if err != nil {
-			log.Fatalf("unable to create the backend: %v", err)
+			logrus.Fatalf("%v", err)
 		}
+		for _, token := range policies.Policy().Tokens {
+			if tenant := strings.ToLower(token.Tenant); tenant != "" && tenantsSettings[tenant] == nil {
+				logrus.Fatalf("token %q belongs to tenant %q, not defined in %q", token.Name, token.Tenant, tenantsFilename)
+			}
+		}
+		logrus.Infof("Tenants loaded from %q with %d tenants", tenantsFilename, len(tenantsSettings))
+	}
+	tenantNames := make([]string, 0, len(tenantsSettings))
+	for tenant := range tenantsSettings {
+		tenantNames = append(tenantNames, tenant)
+	}
+	sort.Strings(tenantNames)
 
-		modelRegistryServer.SetBackend(backend)
+	sharedBackend := viper.GetBool("SHARED_BACKEND")
+	if sharedBackend {
+		checkSharedBackend(viper.GetViper(), logrus.NewEntry(logrus.StandardLogger()))
+		for _, tenant := range tenantNames {
+			checkSharedBackend(tenantsSettings[tenant], logrus.WithField("tenant", tenant))
+		}
+	}
+
+	primaryAddress := viper.GetString("REPLICATION_PRIMARY_ADDRESS")
+	if primaryAddress != "" {
+		if tenantsSettings != nil {
+			logrus.Fatalf("COGMENT_MODEL_REGISTRY_TENANTS_FILE can't be defined for a follower, it replicates a single registry")
+		}
+		if viper.GetDuration("RETENTION_INTERVAL") > 0 {
+			logrus.Fatalf("COGMENT_MODEL_REGISTRY_RETENTION_INTERVAL can't be defined for a follower, the retention of the primary is replicated")
+		}
+		unaryInterceptors = append(unaryInterceptors, replication.ReadOnlyUnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, replication.ReadOnlyStreamServerInterceptor())
+	}
+	upstreamAddresses := federation.ParseUpstreamAddresses(viper.GetString("FEDERATION_UPSTREAM_ADDRESSES"))
+	if len(upstreamAddresses) > 0 {
+		if primaryAddress != "" {
+			logrus.Fatalf("COGMENT_MODEL_REGISTRY_FEDERATION_UPSTREAM_ADDRESSES can't be defined for a follower, its backend only holds the models of the primary")
+		}
+		if tenantsSettings != nil {
+			logrus.Fatalf("COGMENT_MODEL_REGISTRY_FEDERATION_UPSTREAM_ADDRESSES can't be defined with COGMENT_MODEL_REGISTRY_TENANTS_FILE, the models of the upstream registries would be shared by every tenant")
+		}
+		if viper.GetDuration("FEDERATION_UPSTREAM_TIMEOUT") <= 0 {
+			logrus.Fatalf("invalid upstream registry timeout %s, expecting a positive duration", viper.GetDuration("FEDERATION_UPSTREAM_TIMEOUT"))
+		}
+		if viper.GetDuration("FEDERATION_CACHE_TTL") < 0 || viper.GetInt64("FEDERATION_CACHE_MAX_BYTES") < 0 {
+			logrus.Fatalf("invalid federation cache TTL %s or maximum size %d, expecting positive values or 0", viper.GetDuration("FEDERATION_CACHE_TTL"), viper.GetInt64("FEDERATION_CACHE_MAX_BYTES"))
+		}
+	}
+	maintenanceConfiguration := maintenance.Configuration{
+		MaxQueuedRequests: viper.GetInt("MAINTENANCE_MAX_QUEUED_REQUESTS"),
+		QueueTimeout:      viper.GetDuration("MAINTENANCE_QUEUE_TIMEOUT"),
+		MaxDuration:       viper.GetDuration("MAINTENANCE_MAX_DURATION"),
+	}
+	if maintenanceConfiguration.MaxQueuedRequests < 0 || maintenanceConfiguration.QueueTimeout < 0 || maintenanceConfiguration.MaxDuration < 0 {
+		logrus.Fatalf("invalid maintenance settings %+v, expecting positive values or 0", maintenanceConfiguration)
+	}
+	// Queued mutations, the methods requiring another scope than read, don't hold any upload slot, the gate comes before
+	// the throttling
+	maintenanceGate := maintenance.CreateGate(maintenanceConfiguration, func(method string) bool {
+		scope, ok := authorization.RequiredScope(method)
+		return ok && scope != authorization.ReadScope
+	})
+	unaryInterceptors = append(unaryInterceptors, maintenanceGate.UnaryServerInterceptor())
+	streamInterceptors = append(streamInterceptors, maintenanceGate.StreamServerInterceptor())
+	throttlingConfiguration := throttling.Configuration{
+		MaxConcurrentUploads:    viper.GetInt("MAX_CONCURRENT_UPLOADS"),
+		MaxBytesPerSecond:       viper.GetInt64("MAX_UPLOAD_BYTES_PER_SECOND"),
+		MaxClientBytesPerSecond: viper.GetInt64("MAX_CLIENT_UPLOAD_BYTES_PER_SECOND"),
+	}
+	if throttlingConfiguration.MaxConcurrentUploads < 0 || throttlingConfiguration.MaxBytesPerSecond < 0 || throttlingConfiguration.MaxClientBytesPerSecond < 0 {
+		logrus.Fatalf("invalid upload limits %+v, expecting positive values or 0", throttlingConfiguration)
+	}
+	if throttlingConfiguration != (throttling.Configuration{}) {
+		limiter := throttling.CreateLimiter(throttlingConfiguration)
+		unaryInterceptors = append(unaryInterceptors, limiter.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, limiter.StreamServerInterceptor())
+	}
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	}
+	if certFile := viper.GetString("TLS_CERT_FILE"); certFile != "" {
+		tlsCredentials, err := grpcservers.CreateTLSCredentials(grpcservers.TLSConfiguration{
+			CertFile:     certFile,
+			KeyFile:      viper.GetString("TLS_KEY_FILE"),
+			ClientCAFile: viper.GetString("TLS_CLIENT_CA_FILE"),
+		})
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+		opts = append(opts, grpc.Creds(tlsCredentials))
+		if viper.GetString("TLS_CLIENT_CA_FILE") != "" {
+			logrus.Infof("TLS enabled, client certificates are verified")
+		} else {
+			logrus.Infof("TLS enabled")
+		}
+	} else if viper.GetString("TLS_CLIENT_CA_FILE") != "" {
+		logrus.Fatalf("COGMENT_MODEL_REGISTRY_TLS_CLIENT_CA_FILE requires COGMENT_MODEL_REGISTRY_TLS_CERT_FILE to be defined")
+	}
+	server := grpc.NewServer(opts...)
+	healthCheckInterval := viper.GetDuration("HEALTH_CHECK_INTERVAL")
+	if healthCheckInterval <= 0 {
+		logrus.Fatalf("invalid health check interval %s, expecting a positive duration", healthCheckInterval)
+	}
+	if reconnectingConfiguration := reconnectingConfigurationFromSettings(viper.GetViper()); reconnectingConfiguration.InitialBackoff <= 0 || reconnectingConfiguration.MaxBackoff < reconnectingConfiguration.InitialBackoff {
+		logrus.Fatalf("invalid backend reconnection settings %+v, expecting a positive initial backoff not above the max one", reconnectingConfiguration)
+	}
+	if viper.GetInt("BACKEND_RETRY_MAX_ATTEMPTS") < 0 || viper.GetDuration("BACKEND_RETRY_INITIAL_BACKOFF") < 0 || viper.GetDuration("BACKEND_RETRY_MAX_BACKOFF") < viper.GetDuration("BACKEND_RETRY_INITIAL_BACKOFF") {
+		logrus.Fatalf("invalid backend retry settings, expecting positive values or 0 and an initial backoff not above the max one")
+	}
+	circuitBreakerConfiguration := circuitBreaker.Configuration{
+		FailureThreshold: viper.GetInt("CIRCUIT_BREAKER_FAILURE_THRESHOLD"),
+		OpenDuration:     viper.GetDuration("CIRCUIT_BREAKER_OPEN_DURATION"),
+		SlowCallDuration: viper.GetDuration("CIRCUIT_BREAKER_SLOW_CALL_DURATION"),
+	}
+	if circuitBreakerConfiguration.FailureThreshold < 0 || circuitBreakerConfiguration.OpenDuration < 0 || circuitBreakerConfiguration.SlowCallDuration < 0 {
+		logrus.Fatalf("invalid circuit breaker settings %+v, expecting positive values or 0", circuitBreakerConfiguration)
+	}
+	// Not serving until the backends are created and reachable
+	healthMonitor := health.CreateMonitor(health.Configuration{
+		Interval: healthCheckInterval,
+		Services: []string{"cogmentAPI.ModelRegistrySP", "cogmentModelRegistryAPI.ModelRegistryExtensionsSP"},
+	})
+	healthMonitor.Register(server)
+	// The services are registered on the in-process server of the MLflow API as well, if enabled
+	var serviceRegistrar grpc.ServiceRegistrar = server
+	var mlflowAPI *mlflowServer
+	if mlflowPort := viper.GetInt("MLFLOW_PORT"); mlflowPort > 0 {
+		if viper.GetString("TLS_CLIENT_CA_FILE") != "" && policies == nil {
+			logrus.Fatalf("COGMENT_MODEL_REGISTRY_MLFLOW_PORT requires COGMENT_MODEL_REGISTRY_AUTHORIZATION_POLICY_FILE to be defined when client certificates are verified, the MLflow API doesn't verify them")
+		}
+		mlflowAPI = createMLflowServer(mlflowPort, []grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(unaryInterceptors...),
+			grpc.ChainStreamInterceptor(streamInterceptors...),
+		}, viper.GetString("TLS_CERT_FILE"), viper.GetString("TLS_KEY_FILE"))
+		serviceRegistrar = serviceRegistrars{server, mlflowAPI.grpcServer}
+	}
+	modelRegistryServerConfiguration := grpcservers.ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize:    viper.GetInt("SENT_MODEL_VERSION_DATA_CHUNK_SIZE"),
+		MinSentModelVersionDataChunkSize: viper.GetInt("MIN_SENT_MODEL_VERSION_DATA_CHUNK_SIZE"),
+		MaxSentModelVersionDataChunkSize: viper.GetInt("MAX_SENT_MODEL_VERSION_DATA_CHUNK_SIZE"),
+		PaginationSecret:                 []byte(viper.GetString("PAGINATION_SECRET")),
+		UploadSessionTimeout:             viper.GetDuration("UPLOAD_SESSION_TIMEOUT"),
+		MaxUploadSessions:                viper.GetInt("MAX_UPLOAD_SESSIONS"),
+		VersionLeaseTTL:                  viper.GetDuration("VERSION_LEASE_TTL"),
+		HashAlgorithm:                    hashAlgorithm,
+		VerifyDataHash:                   viper.GetBool("VERIFY_DATA_HASH"),
+		SignatureVerifier:                signatureVerifier,
+		Namespaces:                       namespacesConfiguration,
+		ModelIDRules:                     modelIDRules,
+		MaxVersionDataSize:               uint64(maxVersionDataSize),
+		SentVersionDataBufferedChunks:    sentVersionDataBufferedChunks(viper.GetViper()),
+		PresignedURLExpiration:           viper.GetDuration("PRESIGNED_URL_EXPIRATION"),
+		SnapshotDir:                      viper.GetString("SNAPSHOT_DIR"),
+		Maintenance:                      maintenanceGate,
+	}
+	if policies != nil {
+		modelRegistryServerConfiguration.AuthorizeModel = func(ctx context.Context, modelID string) error {
+			return authorization.AuthorizeModel(ctx, authorization.WriteScope, modelID)
+		}
+	}
+	// Without tenants, the default tenant's server is registered directly
+	var modelRegistryServerRegistrar grpc.ServiceRegistrar = serviceRegistrar
+	var router *tenants.Router
+	if tenantsSettings != nil {
+		router = tenants.CreateRouter(policies.Tenant)
+		modelRegistryServerRegistrar = router.Registrar(tenants.DefaultTenant)
+	}
+	modelRegistryServer, err := grpcservers.RegisterModelRegistryServer(modelRegistryServerRegistrar, modelRegistryServerConfiguration)
+	if err != nil {
+		logrus.Fatalf("%v", err)
+	}
+	tenantModelRegistryServers := make(map[string]*grpcservers.ModelRegistryServer, len(tenantNames))
+	for _, tenant := range tenantNames {
+		tenantConfiguration := modelRegistryServerConfiguration
+		tenantConfiguration.SentVersionDataBufferedChunks = sentVersionDataBufferedChunks(tenantsSettings[tenant])
+		tenantConfiguration.SnapshotDir = tenantsSettings[tenant].GetString("SNAPSHOT_DIR")
+		tenantModelRegistryServers[tenant], err = grpcservers.RegisterModelRegistryServer(router.Registrar(tenant), tenantConfiguration)
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+	}
+	webhookURLs, err := webhooks.ParseURLs(viper.GetString("WEBHOOK_URLS"))
+	if err != nil {
+		logrus.Fatalf("%v", err)
+	}
+	webhookEventTypes, err := webhooks.ParseEventTypes(viper.GetString("WEBHOOK_EVENTS"))
+	if err != nil {
+		logrus.Fatalf("%v", err)
+	}
+	var notifiers []*webhooks.Notifier
+	if len(webhookURLs) > 0 {
+		webhookConfiguration := webhooks.Configuration{
+			URLs:        webhookURLs,
+			Secret:      viper.GetString("WEBHOOK_SECRET"),
+			EventTypes:  webhookEventTypes,
+			MaxAttempts: viper.GetInt("WEBHOOK_MAX_ATTEMPTS"),
+			Backoff:     viper.GetDuration("WEBHOOK_BACKOFF"),
+		}
+		notifier := webhooks.CreateNotifier(webhookConfiguration)
+		modelRegistryServer.AddEventListener(notifier)
+		notifiers = append(notifiers, notifier)
+		for _, tenant := range tenantNames {
+			tenantWebhookConfiguration := webhookConfiguration
+			tenantWebhookConfiguration.Tenant = tenant
+			tenantNotifier := webhooks.CreateNotifier(tenantWebhookConfiguration)
+			tenantModelRegistryServers[tenant].AddEventListener(tenantNotifier)
+			notifiers = append(notifiers, tenantNotifier)
+		}
+		logrus.Infof("Changes notified to %d webhooks", len(webhookURLs))
+	}
+	var eventBusPublishers []*eventBus.Publisher
+	if eventBusURL := viper.GetString("EVENT_BUS_URL"); eventBusURL != "" {
+		eventBusConfiguration := eventBus.Configuration{
+			URL:              eventBusURL,
+			Subject:          viper.GetString("EVENT_BUS_SUBJECT"),
+			Encoding:         eventBus.Encoding(viper.GetString("EVENT_BUS_ENCODING")),
+			ReconnectBackoff: 5 * time.Second,
+		}
+		publisher, err := eventBus.CreatePublisher(eventBusConfiguration)
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+		modelRegistryServer.AddEventListener(publisher)
+		eventBusPublishers = append(eventBusPublishers, publisher)
+		for _, tenant := range tenantNames {
+			tenantEventBusConfiguration := eventBusConfiguration
+			tenantEventBusConfiguration.Tenant = tenant
+			tenantPublisher, err := eventBus.CreatePublisher(tenantEventBusConfiguration)
+			if err != nil {
+				logrus.Fatalf("%v", err)
+			}
+			tenantModelRegistryServers[tenant].AddEventListener(tenantPublisher)
+			eventBusPublishers = append(eventBusPublishers, tenantPublisher)
+		}
+		logrus.Infof("Changes published to the event bus under %q", eventBusConfiguration.Subject)
+	}
+	if router != nil {
+		if err := router.RegisterServices(serviceRegistrar); err != nil {
+			logrus.Fatalf("%v", err)
+		}
+	}
+	modelRegistryServers := []*grpcservers.ModelRegistryServer{modelRegistryServer}
+	for _, tenant := range tenantNames {
+		modelRegistryServers = append(modelRegistryServers, tenantModelRegistryServers[tenant])
+	}
+	reloader := &reloader{
+		filename:             configurationFilename,
+		initial:              viper.GetViper(),
+		modelRegistryServers: modelRegistryServers,
+		policies:             policies,
+	}
+
+	var registrar *directory.Registrar
+	if directoryAddress := viper.GetString("DIRECTORY_ADDRESS"); directoryAddress != "" {
+		properties, err := directory.ParseProperties(viper.GetString("DIRECTORY_PROPERTIES"))
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+		hostname := viper.GetString("DIRECTORY_REGISTRATION_HOST")
+		if hostname == "" {
+			hostname, err = os.Hostname()
+			if err != nil {
+				logrus.Fatalf("unable to retrieve the hostname registered with the directory: %v", err)
+			}
+		}
+		registrationPort := viper.GetInt("DIRECTORY_REGISTRATION_PORT")
+		if registrationPort == 0 {
+			registrationPort = port
+		}
+		registrar, err = directory.CreateRegistrar(directory.Configuration{
+			Address:             directoryAddress,
+			AuthenticationToken: viper.GetString("DIRECTORY_AUTHENTICATION_TOKEN"),
+			Hostname:            hostname,
+			Port:                uint32(registrationPort),
+			SSL:                 viper.GetString("TLS_CERT_FILE") != "",
+			Properties:          properties,
+		})
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+		defer registrar.Close()
+		logrus.Infof("Registering in the directory at %q as \"%s:%d\"", directoryAddress, hostname, registrationPort)
+	}
+	// Canceled on shutdown, stopping the registration, the replication, the webhooks, the event bus, the health checks and
+	// the periodic tasks
+	backgroundCtx, cancelBackground := context.WithCancel(context.Background())
+	defer cancelBackground()
+	for _, notifier := range notifiers {
+		go notifier.Run(backgroundCtx)
+	}
+	for _, publisher := range eventBusPublishers {
+		go publisher.Run(backgroundCtx)
+	}
+
+	// Each storage has its own circuit, a failing tenant doesn't make the others fail
+	createCircuitBreaker := func() *circuitBreaker.Breaker {
+		if circuitBreakerConfiguration.FailureThreshold == 0 {
+			return nil
+		}
+		return circuitBreaker.CreateBreaker(circuitBreakerConfiguration)
+	}
+	defaultStorage := &storage{circuitBreaker: createCircuitBreaker()}
+	if defaultStorage.circuitBreaker != nil {
+		modelRegistryServer.SetCircuitBreaker(defaultStorage.circuitBreaker)
+	}
+	tenantStorages := make(map[string]*storage, len(tenantNames))
+	for _, tenant := range tenantNames {
+		tenantStorages[tenant] = &storage{circuitBreaker: createCircuitBreaker()}
+		if tenantStorages[tenant].circuitBreaker != nil {
+			tenantModelRegistryServers[tenant].SetCircuitBreaker(tenantStorages[tenant].circuitBreaker)
+		}
+	}
+
+	go func() {
+		defaultStorage.create(backgroundCtx, viper.GetViper(), sharedBackend, true, logrus.NewEntry(logrus.StandardLogger()))
+		restoreSnapshot(viper.GetViper(), defaultStorage.backend, logrus.NewEntry(logrus.StandardLogger()))
+		// Only the served backend proxies the upstream registries, the retention and the health checks use the local one
+		servedBackend := defaultStorage.backend
+		if len(upstreamAddresses) > 0 {
+			federatedBackend, err := createFederatedBackend(viper.GetViper(), upstreamAddresses, defaultStorage.backend)
+			if err != nil {
+				logrus.Fatalf("%v", err)
+			}
+			defaultStorage.federatedBackend = federatedBackend
+			servedBackend = federatedBackend
+			if viper.GetBool("FEDERATION_CACHE") {
+				logrus.WithFields(logrus.Fields{
+					"ttl":       viper.GetDuration("FEDERATION_CACHE_TTL"),
+					"max_bytes": viper.GetInt64("FEDERATION_CACHE_MAX_BYTES"),
+				}).Infof("Unknown models retrieved from the upstream registries at %q, their retrieved versions are cached", upstreamAddresses)
+			} else {
+				logrus.Infof("Unknown models retrieved from the upstream registries at %q", upstreamAddresses)
+			}
+		}
+		modelRegistryServer.SetBackend(servedBackend)
+		modelRegistryServer.SetColdStorageBackend(defaultStorage.coldStorageBackend)
+		for _, tenant := range tenantNames {
+			tenantStorages[tenant].create(backgroundCtx, tenantsSettings[tenant], sharedBackend, true, logrus.WithField("tenant", tenant))
+			restoreSnapshot(tenantsSettings[tenant], tenantStorages[tenant].backend, logrus.WithField("tenant", tenant))
+			tenantModelRegistryServers[tenant].SetBackend(tenantStorages[tenant].backend)
+			tenantModelRegistryServers[tenant].SetColdStorageBackend(tenantStorages[tenant].coldStorageBackend)
+		}
+		healthMonitor.AddBackend("default", defaultStorage.backend)
+		for _, tenant := range tenantNames {
+			healthMonitor.AddBackend(fmt.Sprintf("tenant %s", tenant), tenantStorages[tenant].backend)
+		}
+		go healthMonitor.Run(backgroundCtx)
+
+		if registrar != nil {
+			// Registering once the registry is able to serve requests
+			go registrar.Run(backgroundCtx)
+		}
+
+		if primaryAddress != "" {
+			primaryClient, err := client.CreateClient(context.Background(), client.Configuration{
+				Address:   primaryAddress,
+				Token:     viper.GetString("REPLICATION_PRIMARY_TOKEN"),
+				TLSCAFile: viper.GetString("REPLICATION_PRIMARY_TLS_CA_FILE"),
+				Retries:   3,
+			})
+			if err != nil {
+				logrus.Fatalf("unable to create the replication client: %v", err)
+			}
+			follower := replication.CreateFollower(defaultStorage.backend, primaryClient, modelRegistryServer, replication.Configuration{
+				ResyncInterval:   viper.GetDuration("REPLICATION_RESYNC_INTERVAL"),
+				ReconnectBackoff: 5 * time.Second,
+			})
+			go follower.Run(backgroundCtx)
+			logrus.Infof("Read-only follower replicating the primary at %q", primaryAddress)
+		}
+
+		// The retention of a follower is the one of its primary, without any collector
+		if primaryAddress == "" {
+			retentionInterval := viper.GetDuration("RETENTION_INTERVAL")
+			retentionConfiguration := retention.Configuration{
+				Interval: retentionInterval,
+				DefaultPolicy: retention.Policy{
+					MaxAge:   viper.GetDuration("RETENTION_MAX_AGE"),
+					MaxCount: viper.GetInt("RETENTION_MAX_COUNT"),
+				},
+				DryRun: viper.GetBool("RETENTION_DRY_RUN"),
+			}
+			collectedBackends := []backend.Backend{defaultStorage.backend}
+			collectedServers := []*grpcservers.ModelRegistryServer{modelRegistryServer}
+			for _, tenant := range tenantNames {
+				collectedBackends = append(collectedBackends, tenantStorages[tenant].backend)
+				collectedServers = append(collectedServers, tenantModelRegistryServers[tenant])
+			}
+			for index, collectedBackend := range collectedBackends {
+				collectorConfiguration := retentionConfiguration
+				collectorConfiguration.InUse = collectedServers[index].IsVersionInUse
+				collectorConfiguration.LockInUse = collectedServers[index].LockDependedUponModel
+				collector := retention.CreateCollector(collectedBackend, collectorConfiguration)
+				reloader.addCollector(collector)
+				// Garbage collections can be requested even without periodic ones
+				collectedServers[index].SetRetentionCollector(collector)
+				if retentionInterval > 0 {
+					collectedServers[index].AddVersionCreationListener(collector)
+					go collector.Run(backgroundCtx)
+				}
+			}
+			if retentionInterval > 0 && retentionConfiguration.DryRun {
+				logrus.Infof("Non-archived versions beyond their retention policy reported every %s and as versions are created, without being deleted", retentionInterval)
+			} else if retentionInterval > 0 {
+				logrus.Infof("Non-archived versions beyond their retention policy collected every %s and as versions are created", retentionInterval)
+			}
+		}
 	}()
 
 	defer func() {
-		if backend != nil {
-			backend.Destroy()
-		}
-		if archiveBackend != nil {
-			archiveBackend.Destroy()
+		defaultStorage.destroy()
+		for _, tenantStorage := range tenantStorages {
+			tenantStorage.destroy()
 		}
 	}()
 
+	if metricsPort := viper.GetInt("METRICS_PORT"); metricsPort > 0 {
+		go func() {
+			// Not the default mux, net/http/pprof registers the profiles on it
+			mux := http.NewServeMux()
+			mux.Handle("/debug/vars", expvar.Handler())
+			err := http.ListenAndServe(fmt.Sprintf(":%d", metricsPort), mux)
+			if err != nil {
+				logrus.Fatalf("unexpected error while serving metrics: %v", err)
+			}
+		}()
+		logrus.Infof("Metrics served at http://localhost:%d/debug/vars", metricsPort)
+	}
+
+	if debugPort := viper.GetInt("DEBUG_PORT"); debugPort > 0 {
+		diagnosticsServer := diagnostics.CreateServer()
+		diagnosticsServer.AddState("maintenance", func() interface{} { return maintenanceGate.State() })
+		diagnosticsServer.AddState("backends", func() interface{} { return healthMonitor.BackendStates() })
+		diagnosticsServer.AddState("circuits", func() interface{} {
+			circuits := map[string]string{}
+			if defaultStorage.circuitBreaker != nil {
+				circuits["default"] = defaultStorage.circuitBreaker.State()
+			}
+			for tenant, tenantStorage := range tenantStorages {
+				if tenantStorage.circuitBreaker != nil {
+					circuits[fmt.Sprintf("tenant %s", tenant)] = tenantStorage.circuitBreaker.State()
+				}
+			}
+			return circuits
+		})
+		go func() {
+			err := http.ListenAndServe(fmt.Sprintf(":%d", debugPort), diagnosticsServer.Handler())
+			if err != nil {
+				logrus.Fatalf("unexpected error while serving diagnostics: %v", err)
+			}
+		}()
+		logrus.Warnf("Profiles and state dump served at http://localhost:%d/debug/pprof/ and http://localhost:%d/debug/state, don't expose this port publicly", debugPort, debugPort)
+	}
+
+	if mlflowAPI != nil {
+		if err := mlflowAPI.serve(); err != nil {
+			logrus.Fatalf("%v", err)
+		}
+	}
+
 	if viper.GetBool("GRPC_REFLECTION") {
 		reflection.Register(server)
-		log.Printf("gRPC reflection registered")
+		logrus.Infof("gRPC reflection registered")
 	}
 
-	log.Printf("Cogment Model Registry v%s service starts on port %d...\n", version.Version, port)
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	go func() {
+		for range reloads {
+			logrus.Infof("Received %q, reloading the configuration", syscall.SIGHUP)
+			if err := reloader.reload(); err != nil {
+				logrus.WithError(err).Error("Configuration reload failed, the current settings are kept")
+			}
+		}
+	}()
+
+	stopped := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer close(stopped)
+		receivedSignal := <-signals
+		shutdownTimeout := viper.GetDuration("SHUTDOWN_TIMEOUT")
+		logrus.Infof("Received %q, stopping after the in-flight calls finish, at most %s", receivedSignal, shutdownTimeout)
+		cancelBackground()
+		healthMonitor.Shutdown()
+		if registrar != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := registrar.Deregister(ctx); err != nil {
+				logrus.WithError(err).Warn("Directory deregistration failed")
+			}
+		}
+
+		// The watches never finish by themselves
+		for _, modelRegistryServer := range modelRegistryServers {
+			modelRegistryServer.Shutdown()
+		}
+		gracefullyStopped := make(chan struct{})
+		go func() {
+			if mlflowAPI != nil {
+				mlflowAPI.gracefulStop()
+			}
+			server.GracefulStop()
+			close(gracefullyStopped)
+		}()
+		timer := time.NewTimer(shutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-gracefullyStopped:
+		case <-timer.C:
+			logrus.Warnf("In-flight calls not finished after %s, canceling them", shutdownTimeout)
+			if mlflowAPI != nil {
+				mlflowAPI.stop()
+			}
+			server.Stop()
+		case receivedSignal = <-signals:
+			logrus.Warnf("Received %q again, canceling the in-flight calls", receivedSignal)
+			if mlflowAPI != nil {
+				mlflowAPI.stop()
+			}
+			server.Stop()
+		}
+	}()
+
+	logrus.Infof("Cogment Model Registry v%s service starts on port %d...", version.Version, port)
 	err = server.Serve(listener)
 	if err != nil {
-		log.Fatalf("unexpected error while serving grpc services: %v", err)
+		logrus.Fatalf("unexpected error while serving grpc services: %v", err)
 	}
+	// Serve returns as soon as the server stops accepting connections, the backends are closed once the in-flight calls are finished
+	<-stopped
+	logrus.Infof("Cogment Model Registry stopped")
 }
@@ -0,0 +1,247 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Method entering and leaving the maintenance mode, it isn't held by the gate to be able to end the maintenance
+const setMaintenanceMethod = "/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/SetMaintenance"
+
+// Metrics published under `/debug/vars`
+var (
+	queuedRequestsMetric   = expvar.NewInt("maintenance_queued_requests")
+	rejectedRequestsMetric = expvar.NewInt("maintenance_rejected_requests")
+)
+
+type Configuration struct {
+	MaxQueuedRequests int           // Mutations waiting for the end of the maintenance, the next ones are rejected
+	QueueTimeout      time.Duration // Longest wait of a queued mutation before it is rejected
+	MaxDuration       time.Duration // The maintenance ends by itself after this delay, never when 0
+}
+
+// AlreadyInMaintenanceError is raised when entering the maintenance mode while already in it
+type AlreadyInMaintenanceError struct {
+	Reason string
+}
+
+func (e *AlreadyInMaintenanceError) Error() string {
+	return fmt.Sprintf("the registry is already in maintenance (%s)", e.Reason)
+}
+
+// State describes the maintenance mode of a gate
+type State struct {
+	Active         bool
+	Reason         string
+	Since          time.Time
+	QueuedRequests int
+}
+
+type period struct {
+	reason string
+	since  time.Time
+	ended  chan struct{}
+	timer  *time.Timer
+}
+
+// Gate holds the mutations received while the registry is in maintenance until it ends
+//
+// The reads are never held. Entering the maintenance waits for the ongoing mutations to complete, the maintenance
+// operation then has the backends to itself.
+type Gate struct {
+	configuration Configuration
+	mutation      func(method string) bool
+
+	mutex          sync.Mutex
+	maintenance    *period       // nil outside of the maintenance mode
+	ongoing        int           // Mutations let through and not completed yet
+	drained        chan struct{} // Closed once the ongoing mutations complete, while entering the maintenance
+	queuedRequests int
+}
+
+// CreateGate creates a gate of the mutations received by a server, mutation tells which methods are mutations
+func CreateGate(configuration Configuration, mutation func(method string) bool) *Gate {
+	return &Gate{configuration: configuration, mutation: mutation}
+}
+
+// Begin enters the maintenance mode, once the ongoing mutations complete or the context is done
+//
+// The maintenance mode isn't entered if the context is done first.
+func (g *Gate) Begin(ctx context.Context, reason string) error {
+	g.mutex.Lock()
+	if g.maintenance != nil {
+		g.mutex.Unlock()
+		return &AlreadyInMaintenanceError{Reason: g.maintenance.reason}
+	}
+	maintenance := &period{reason: reason, since: time.Now(), ended: make(chan struct{})}
+	g.maintenance = maintenance
+	if g.configuration.MaxDuration > 0 {
+		maintenance.timer = time.AfterFunc(g.configuration.MaxDuration, func() {
+			if g.end(maintenance) {
+				logrus.WithField("reason", reason).Warnf("Maintenance ended after its maximum duration of %s", g.configuration.MaxDuration)
+			}
+		})
+	}
+	var drained chan struct{}
+	if g.ongoing > 0 {
+		g.drained = make(chan struct{})
+		drained = g.drained
+	}
+	g.mutex.Unlock()
+
+	if drained == nil {
+		return nil
+	}
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		g.end(maintenance)
+		return fmt.Errorf("unable to wait for the ongoing mutations to complete: %w", ctx.Err())
+	}
+}
+
+// End leaves the maintenance mode, the queued mutations are let through
+func (g *Gate) End() {
+	g.mutex.Lock()
+	maintenance := g.maintenance
+	g.mutex.Unlock()
+	if maintenance != nil {
+		g.end(maintenance)
+	}
+}
+
+// end leaves a maintenance, false if it already ended
+func (g *Gate) end(maintenance *period) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.maintenance != maintenance {
+		return false
+	}
+	if maintenance.timer != nil {
+		maintenance.timer.Stop()
+	}
+	close(maintenance.ended)
+	g.maintenance = nil
+	g.drained = nil
+	return true
+}
+
+// State retrieves the current maintenance mode
+func (g *Gate) State() State {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.maintenance == nil {
+		return State{}
+	}
+	return State{Active: true, Reason: g.maintenance.reason, Since: g.maintenance.since, QueuedRequests: g.queuedRequests}
+}
+
+// enter waits for the end of the maintenance, if any, before letting a mutation through, leave must then be called
+// once it completes
+func (g *Gate) enter(ctx context.Context) error {
+	g.mutex.Lock()
+	for g.maintenance != nil {
+		if g.queuedRequests >= g.configuration.MaxQueuedRequests {
+			reason := g.maintenance.reason
+			g.mutex.Unlock()
+			rejectedRequestsMetric.Add(1)
+			return status.Errorf(codes.Unavailable, "the registry is in maintenance (%s) and too many requests are waiting, retry later", reason)
+		}
+		maintenance := g.maintenance
+		g.queuedRequests++
+		queuedRequestsMetric.Add(1)
+		g.mutex.Unlock()
+
+		err := wait(ctx, maintenance, g.configuration.QueueTimeout)
+
+		g.mutex.Lock()
+		g.queuedRequests--
+		if err != nil {
+			g.mutex.Unlock()
+			rejectedRequestsMetric.Add(1)
+			return err
+		}
+	}
+	g.ongoing++
+	g.mutex.Unlock()
+	return nil
+}
+
+func wait(ctx context.Context, maintenance *period, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-maintenance.ended:
+		return nil
+	case <-timer.C:
+		return status.Errorf(codes.Unavailable, "the registry is still in maintenance (%s) after %s, retry later", maintenance.reason, timeout)
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (g *Gate) leave() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.ongoing--
+	if g.ongoing == 0 && g.drained != nil {
+		close(g.drained)
+		g.drained = nil
+	}
+}
+
+// held tells whether the gate applies to a method
+func (g *Gate) held(method string) bool {
+	return method != setMaintenanceMethod && g.mutation(method)
+}
+
+// UnaryServerInterceptor holds the unary mutations during the maintenance
+func (g *Gate) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !g.held(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		if err := g.enter(ctx); err != nil {
+			return nil, err
+		}
+		defer g.leave()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor holds the streaming mutations, e.g. the uploads, during the maintenance
+func (g *Gate) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !g.held(info.FullMethod) {
+			return handler(srv, stream)
+		}
+		if err := g.enter(stream.Context()); err != nil {
+			return err
+		}
+		defer g.leave()
+		return handler(srv, stream)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	readMethod     = "/cogmentAPI.ModelRegistrySP/RetrieveVersionInfos"
+	mutationMethod = "/cogmentAPI.ModelRegistrySP/CreateOrUpdateModel"
+)
+
+// call runs a unary call through the gate in the background, its error is sent once it completes
+func call(gate *Gate, method string) chan error {
+	interceptor := gate.UnaryServerInterceptor()
+	done := make(chan error, 1)
+	go func() {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		done <- err
+	}()
+	return done
+}
+
+func mutation(method string) bool {
+	return method != readMethod
+}
+
+func queuedRequests(gate *Gate, expected int) func() bool {
+	return func() bool {
+		return gate.State().QueuedRequests == expected
+	}
+}
+
+func TestQueue(t *testing.T) {
+	gate := CreateGate(Configuration{MaxQueuedRequests: 1, QueueTimeout: time.Minute}, mutation)
+	assert.NoError(t, <-call(gate, mutationMethod))
+
+	assert.NoError(t, gate.Begin(context.Background(), "swap"))
+	state := gate.State()
+	assert.True(t, state.Active)
+	assert.Equal(t, "swap", state.Reason)
+	_, ok := gate.Begin(context.Background(), "other").(*AlreadyInMaintenanceError)
+	assert.True(t, ok)
+
+	// Reads and the end of the maintenance aren't held
+	assert.NoError(t, <-call(gate, readMethod))
+	assert.NoError(t, <-call(gate, setMaintenanceMethod))
+
+	queued := call(gate, mutationMethod)
+	assert.Eventually(t, queuedRequests(gate, 1), time.Second, time.Millisecond)
+	// The queue is full
+	assert.Equal(t, codes.Unavailable, status.Code(<-call(gate, mutationMethod)))
+
+	gate.End()
+	assert.NoError(t, <-queued)
+	assert.Equal(t, State{}, gate.State())
+}
+
+func TestQueueTimeout(t *testing.T) {
+	gate := CreateGate(Configuration{MaxQueuedRequests: 10, QueueTimeout: 20 * time.Millisecond}, mutation)
+	assert.NoError(t, gate.Begin(context.Background(), "compaction"))
+	err := <-call(gate, mutationMethod)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Contains(t, err.Error(), "compaction")
+	assert.Equal(t, 0, gate.State().QueuedRequests)
+}
+
+func TestBeginWaitsForOngoingMutations(t *testing.T) {
+	gate := CreateGate(Configuration{MaxQueuedRequests: 10, QueueTimeout: time.Minute}, mutation)
+	interceptor := gate.StreamServerInterceptor()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_ = interceptor(nil, &testServerStream{}, &grpc.StreamServerInfo{FullMethod: "/cogmentAPI.ModelRegistrySP/CreateVersion", IsClientStream: true}, func(srv interface{}, stream grpc.ServerStream) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	// The maintenance isn't entered while the upload is ongoing
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, gate.Begin(ctx, "swap"))
+	assert.False(t, gate.State().Active)
+
+	begun := make(chan error, 1)
+	go func() {
+		begun <- gate.Begin(context.Background(), "swap")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-begun:
+		assert.Fail(t, "the maintenance started before the upload completed")
+	default:
+	}
+	close(release)
+	assert.NoError(t, <-begun)
+	assert.True(t, gate.State().Active)
+}
+
+func TestMaxDuration(t *testing.T) {
+	gate := CreateGate(Configuration{MaxQueuedRequests: 10, QueueTimeout: time.Minute, MaxDuration: 20 * time.Millisecond}, mutation)
+	assert.NoError(t, gate.Begin(context.Background(), "forgotten"))
+	queued := call(gate, mutationMethod)
+	assert.NoError(t, <-queued)
+	assert.False(t, gate.State().Active)
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+}
+
+func (s *testServerStream) Context() context.Context {
+	return context.Background()
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mlflow
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+)
+
+// Version user data keys storing the fields of the MLflow model versions without a Cogment equivalent
+const (
+	SourceUserDataKey = "mlflow.source"
+	RunIDUserDataKey  = "mlflow.run_id"
+)
+
+// Prefix of the user data keys managed by the model registry, they aren't exposed as tags
+const managedUserDataKeyPrefix = "cogment_model_registry."
+
+// MLflow stages of the Cogment stages, the MLflow `Archived` stage is the Cogment `retired` stage
+var mlflowStages = map[client.VersionStage]string{
+	client.NoStage:    "None",
+	client.Staging:    "Staging",
+	client.Production: "Production",
+	client.Retired:    "Archived",
+}
+
+func parseStage(mlflowStage string) (client.VersionStage, bool) {
+	for stage, name := range mlflowStages {
+		if strings.EqualFold(name, mlflowStage) {
+			return stage, true
+		}
+	}
+	return client.NoStage, false
+}
+
+type tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type registeredModel struct {
+	Name           string         `json:"name"`
+	Description    string         `json:"description,omitempty"`
+	LatestVersions []modelVersion `json:"latest_versions,omitempty"`
+	Tags           []tag          `json:"tags,omitempty"`
+}
+
+type modelVersion struct {
+	Name                 string `json:"name"`
+	Version              string `json:"version"`
+	CreationTimestamp    int64  `json:"creation_timestamp"` // In milliseconds since the epoch
+	LastUpdatedTimestamp int64  `json:"last_updated_timestamp"`
+	CurrentStage         string `json:"current_stage"`
+	Description          string `json:"description,omitempty"`
+	Source               string `json:"source,omitempty"`
+	RunID                string `json:"run_id,omitempty"`
+	Status               string `json:"status"`
+	Tags                 []tag  `json:"tags,omitempty"`
+}
+
+// tags are the user data entries not managed by the registry nor storing an MLflow field, sorted by key
+func tags(userData map[string]string) []tag {
+	keys := make([]string, 0, len(userData))
+	for key := range userData {
+		if !strings.HasPrefix(key, managedUserDataKeyPrefix) && key != SourceUserDataKey && key != RunIDUserDataKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	tags := make([]tag, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, tag{Key: key, Value: userData[key]})
+	}
+	return tags
+}
+
+func validateTagKey(key string) error {
+	if key == "" {
+		return invalidParameterError("missing tag key")
+	}
+	if strings.HasPrefix(key, managedUserDataKeyPrefix) || key == SourceUserDataKey || key == RunIDUserDataKey {
+		return invalidParameterError("tag key %q is reserved", key)
+	}
+	return nil
+}
+
+func createRegisteredModel(modelInfo client.ModelInfo, latestVersions []modelVersion) registeredModel {
+	return registeredModel{
+		Name:           modelInfo.ModelID,
+		Description:    modelInfo.Description,
+		LatestVersions: latestVersions,
+		Tags:           tags(modelInfo.UserData),
+	}
+}
+
+// versionStage is the stage of a version, read from the stage history stored in the user data of its model
+func versionStage(modelUserData map[string]string, versionNumber uint) client.VersionStage {
+	value, ok := modelUserData[grpcservers.VersionStageUserDataKeyPrefix+strconv.FormatUint(uint64(versionNumber), 10)]
+	if !ok {
+		return client.NoStage
+	}
+	history := []client.VersionStageTransition{}
+	if err := json.Unmarshal([]byte(value), &history); err != nil || len(history) == 0 {
+		return client.NoStage
+	}
+	return history[len(history)-1].Stage
+}
+
+func createModelVersion(versionInfo client.VersionInfo, modelUserData map[string]string) modelVersion {
+	creationTimestamp := versionInfo.CreationTimestamp.UnixNano() / 1e6
+	return modelVersion{
+		Name:                 versionInfo.ModelID,
+		Version:              strconv.FormatUint(uint64(versionInfo.VersionNumber), 10),
+		CreationTimestamp:    creationTimestamp,
+		LastUpdatedTimestamp: creationTimestamp,
+		CurrentStage:         mlflowStages[versionStage(modelUserData, versionInfo.VersionNumber)],
+		Description:          versionInfo.Description,
+		Source:               versionInfo.UserData[SourceUserDataKey],
+		RunID:                versionInfo.UserData[RunIDUserDataKey],
+		Status:               "READY",
+		Tags:                 tags(versionInfo.UserData),
+	}
+}
+
+// parseVersion parses the version of an MLflow model version, a string holding a positive version number
+func parseVersion(version string) (int, error) {
+	versionNumber, err := strconv.ParseUint(version, 10, 31)
+	if err != nil || versionNumber == 0 {
+		return 0, invalidParameterError("invalid version %q, expecting a positive version number", version)
+	}
+	return int(versionNumber), nil
+}
+
+// flexibleInt is an integer parameter, a JSON number in the request bodies or a string in the queries
+type flexibleInt int64
+
+func (i *flexibleInt) UnmarshalJSON(data []byte) error {
+	value, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = flexibleInt(value)
+	return nil
+}
+
+// flexibleStrings is a list of strings parameter, a single value in a query is a list of one string
+type flexibleStrings []string
+
+func (l *flexibleStrings) UnmarshalJSON(data []byte) error {
+	value := ""
+	if err := json.Unmarshal(data, &value); err == nil {
+		*l = flexibleStrings{value}
+		return nil
+	}
+	values := []string{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*l = values
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mlflow
+
+import (
+	"regexp"
+	"strings"
+)
+
+// condition is a comparison of a search filter, e.g. `name LIKE 'my_%'`
+type condition struct {
+	key        string
+	comparator string
+	value      string
+}
+
+var conditionPattern = regexp.MustCompile("^\\s*(`[^`]+`|[\\w.]+)\\s*(=|!=|(?i:LIKE)|(?i:ILIKE))\\s*(?:'([^']*)'|\"([^\"]*)\")\\s*$")
+
+var andPattern = regexp.MustCompile(`(?i)\s+AND\s+`)
+
+// parseFilter parses the conditions of an MLflow search filter, joined by `AND`, on the allowed keys or on tags with
+// `tags.<key>`
+func parseFilter(filter string, allowedKeys ...string) ([]condition, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+	conditions := []condition{}
+	for _, expression := range andPattern.Split(filter, -1) {
+		match := conditionPattern.FindStringSubmatch(expression)
+		if match == nil {
+			return nil, invalidParameterError("invalid filter condition %q, expecting `<key> <=|!=|LIKE|ILIKE> '<value>'`", strings.TrimSpace(expression))
+		}
+		c := condition{key: strings.Trim(match[1], "`"), comparator: strings.ToUpper(match[2]), value: match[3] + match[4]}
+		allowed := strings.HasPrefix(c.key, "tags.")
+		for _, allowedKey := range allowedKeys {
+			allowed = allowed || c.key == allowedKey
+		}
+		if !allowed {
+			return nil, invalidParameterError("invalid filter key %q, expecting one of %q or `tags.<key>`", c.key, allowedKeys)
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, nil
+}
+
+// matches checks a value against the condition, `%` matches any sequence of characters and `_` any character in
+// `LIKE` patterns
+func (c condition) matches(value string, ok bool) bool {
+	switch c.comparator {
+	case "=":
+		return ok && value == c.value
+	case "!=":
+		return !ok || value != c.value
+	}
+	pattern := strings.Builder{}
+	pattern.WriteString("^")
+	if c.comparator == "ILIKE" {
+		pattern.WriteString("(?i)")
+	}
+	for _, r := range c.value {
+		switch r {
+		case '%':
+			pattern.WriteString(".*")
+		case '_':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	pattern.WriteString("$")
+	return ok && regexp.MustCompile(pattern.String()).MatchString(value)
+}
+
+// matchesAll checks the fields of an entity against every condition, `tags.<key>` conditions use its tags
+func matchesAll(conditions []condition, fields map[string]string, userData map[string]string) bool {
+	for _, c := range conditions {
+		var value string
+		var ok bool
+		if strings.HasPrefix(c.key, "tags.") {
+			value, ok = userData[strings.TrimPrefix(c.key, "tags.")]
+		} else {
+			value, ok = fields[c.key]
+		}
+		if !c.matches(value, ok) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalityValue is the value a key is required to be equal to by the conditions, if any
+func equalityValue(conditions []condition, key string) (string, bool) {
+	for _, c := range conditions {
+		if c.key == key && c.comparator == "=" {
+			return c.value, true
+		}
+	}
+	return "", false
+}
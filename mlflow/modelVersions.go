@@ -0,0 +1,317 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mlflow
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/cogment/cogment-model-registry/client"
+)
+
+// Default and maximum number of model versions returned by a search
+const (
+	defaultSearchedVersions = 1000
+	maxSearchedVersions     = 10000
+)
+
+// versionParams identifies a model version in the requests
+type versionParams struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func (p versionParams) parse() (int, error) {
+	if err := requireName(p.Name); err != nil {
+		return 0, err
+	}
+	return parseVersion(p.Version)
+}
+
+func (s *Server) retrieveModelVersion(ctx context.Context, name string, versionNumber int) (modelVersion, error) {
+	modelInfo, err := s.client.RetrieveModelInfo(ctx, name)
+	if err != nil {
+		return modelVersion{}, err
+	}
+	versionInfo, err := s.client.RetrieveVersionInfo(ctx, name, versionNumber)
+	if err != nil {
+		return modelVersion{}, err
+	}
+	return createModelVersion(versionInfo, modelInfo.UserData), nil
+}
+
+// createModelVersion registers a version without data, MLflow stores the artifacts of its versions at their source
+func (s *Server) createModelVersion(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		Name        string `json:"name"`
+		Source      string `json:"source"`
+		RunID       string `json:"run_id"`
+		Tags        []tag  `json:"tags"`
+		Description string `json:"description"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	if err := requireName(params.Name); err != nil {
+		return nil, err
+	}
+	userData := map[string]string{}
+	for _, tag := range params.Tags {
+		if err := validateTagKey(tag.Key); err != nil {
+			return nil, err
+		}
+		userData[tag.Key] = tag.Value
+	}
+	if params.Source != "" {
+		userData[SourceUserDataKey] = params.Source
+	}
+	if params.RunID != "" {
+		userData[RunIDUserDataKey] = params.RunID
+	}
+	versionInfo, err := s.client.CreateVersion(ctx, params.Name, client.VersionArgs{Description: params.Description, UserData: userData}, bytes.NewReader(nil))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"model_version": createModelVersion(versionInfo, nil)}, nil
+}
+
+func (s *Server) getModelVersion(ctx context.Context, r request) (interface{}, error) {
+	params := versionParams{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	versionNumber, err := params.parse()
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.retrieveModelVersion(ctx, params.Name, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"model_version": version}, nil
+}
+
+// updateVersionInfo applies an update to a version and retrieves it along with its stage
+func (s *Server) updateVersionInfo(ctx context.Context, name string, versionNumber int, update client.VersionInfoUpdate) (modelVersion, error) {
+	if _, _, err := s.client.UpdateVersionInfo(ctx, name, versionNumber, update); err != nil {
+		return modelVersion{}, err
+	}
+	return s.retrieveModelVersion(ctx, name, versionNumber)
+}
+
+func (s *Server) updateModelVersion(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		versionParams
+		Description string `json:"description"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	versionNumber, err := params.parse()
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.updateVersionInfo(ctx, params.Name, versionNumber, client.VersionInfoUpdate{
+		Description:      params.Description,
+		ClearDescription: params.Description == "",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"model_version": version}, nil
+}
+
+// deleteModelVersion deletes a version, archived versions are not deleted as they aren't through the gRPC API without
+// forcing it
+func (s *Server) deleteModelVersion(ctx context.Context, r request) (interface{}, error) {
+	params := versionParams{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	versionNumber, err := params.parse()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.client.DeleteVersion(ctx, params.Name, versionNumber, false); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{}, nil
+}
+
+// searchModelVersions searches the versions of the model required by the filter, or of every model
+func (s *Server) searchModelVersions(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		Filter     string      `json:"filter"`
+		MaxResults flexibleInt `json:"max_results"`
+		PageToken  string      `json:"page_token"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	conditions, err := parseFilter(params.Filter, "name", "run_id", "source_path")
+	if err != nil {
+		return nil, err
+	}
+	count, offset, err := parsePagination(params.MaxResults, params.PageToken, defaultSearchedVersions, maxSearchedVersions)
+	if err != nil {
+		return nil, err
+	}
+
+	modelInfos := []client.ModelInfo{}
+	if name, ok := equalityValue(conditions, "name"); ok {
+		modelInfo, err := s.client.RetrieveModelInfo(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		modelInfos = append(modelInfos, modelInfo)
+	} else {
+		it := s.client.Models(ctx)
+		for it.Next() {
+			modelInfos = append(modelInfos, it.ModelInfo())
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	versions := []modelVersion{}
+	matchingVersions := 0
+	for _, modelInfo := range modelInfos {
+		it := s.client.Versions(ctx, modelInfo.ModelID)
+		for it.Next() {
+			versionInfo := it.VersionInfo()
+			fields := map[string]string{
+				"name":        versionInfo.ModelID,
+				"run_id":      versionInfo.UserData[RunIDUserDataKey],
+				"source_path": versionInfo.UserData[SourceUserDataKey],
+			}
+			if !matchesAll(conditions, fields, versionInfo.UserData) {
+				continue
+			}
+			matchingVersions++
+			if matchingVersions <= offset {
+				continue
+			}
+			if len(versions) == count {
+				return map[string]interface{}{"model_versions": versions, "next_page_token": strconv.Itoa(offset + count)}, nil
+			}
+			versions = append(versions, createModelVersion(versionInfo, modelInfo.UserData))
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]interface{}{"model_versions": versions}, nil
+}
+
+// transitionModelVersionStage moves a version to a stage, the version previously in the staging or production stage is
+// always retired as Cogment has a single version in each
+func (s *Server) transitionModelVersionStage(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		versionParams
+		Stage string `json:"stage"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	versionNumber, err := params.parse()
+	if err != nil {
+		return nil, err
+	}
+	stage, ok := parseStage(params.Stage)
+	if !ok {
+		return nil, invalidParameterError("invalid stage %q, expecting None, Staging, Production or Archived", params.Stage)
+	}
+	stageInfo, err := s.client.TransitionVersionStage(ctx, params.Name, versionNumber, stage, "")
+	if err != nil {
+		return nil, err
+	}
+	version := createModelVersion(stageInfo.VersionInfo, nil)
+	version.CurrentStage = mlflowStages[stageInfo.Stage]
+	return map[string]interface{}{"model_version": version}, nil
+}
+
+// getModelVersionDownloadURI is the source of the version or, for the versions created through the gRPC API, the
+// presigned URL of its data if the backend provides one
+func (s *Server) getModelVersionDownloadURI(ctx context.Context, r request) (interface{}, error) {
+	params := versionParams{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	versionNumber, err := params.parse()
+	if err != nil {
+		return nil, err
+	}
+	versionInfo, err := s.client.RetrieveVersionInfo(ctx, params.Name, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+	uri := versionInfo.UserData[SourceUserDataKey]
+	if uri == "" {
+		_, uri, _, err = s.client.RetrieveVersionDataURL(ctx, params.Name, versionNumber, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if uri == "" {
+		return nil, &apiError{status: http.StatusBadRequest, errorCode: "INVALID_STATE", message: "no download URI for version " + params.Version + " of model " + strconv.Quote(params.Name) + ", its data is only retrievable through the gRPC API"}
+	}
+	return map[string]interface{}{"artifact_uri": uri}, nil
+}
+
+func (s *Server) setModelVersionTag(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		versionParams
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	versionNumber, err := params.parse()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTagKey(params.Key); err != nil {
+		return nil, err
+	}
+	if _, _, err := s.client.UpdateVersionInfo(ctx, params.Name, versionNumber, client.VersionInfoUpdate{UserData: map[string]string{params.Key: params.Value}}); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{}, nil
+}
+
+func (s *Server) deleteModelVersionTag(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		versionParams
+		Key string `json:"key"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	versionNumber, err := params.parse()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTagKey(params.Key); err != nil {
+		return nil, err
+	}
+	if _, _, err := s.client.UpdateVersionInfo(ctx, params.Name, versionNumber, client.VersionInfoUpdate{RemovedUserDataKeys: []string{params.Key}}); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{}, nil
+}
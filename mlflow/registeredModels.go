@@ -0,0 +1,322 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mlflow
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+)
+
+// Default and maximum number of registered models returned by a search
+const (
+	defaultSearchedModels = 100
+	maxSearchedModels     = 1000
+)
+
+// Stages of the latest versions of a registered model, when not requested otherwise
+var defaultStages = []client.VersionStage{client.NoStage, client.Staging, client.Production, client.Retired}
+
+func requireName(name string) error {
+	if name == "" {
+		return invalidParameterError("missing registered model name")
+	}
+	return nil
+}
+
+// copyUserData copies user data to update it
+func copyUserData(userData map[string]string) map[string]string {
+	copiedUserData := make(map[string]string, len(userData)+1)
+	for key, value := range userData {
+		copiedUserData[key] = value
+	}
+	return copiedUserData
+}
+
+// latestVersions retrieves the latest version of a model in each stage
+func (s *Server) latestVersions(ctx context.Context, modelInfo client.ModelInfo, stages []client.VersionStage) ([]modelVersion, error) {
+	latestVersionInfos := map[client.VersionStage]client.VersionInfo{}
+	it := s.client.Versions(ctx, modelInfo.ModelID)
+	for it.Next() {
+		versionInfo := it.VersionInfo()
+		latestVersionInfos[versionStage(modelInfo.UserData, versionInfo.VersionNumber)] = versionInfo
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	latestVersions := []modelVersion{}
+	for _, stage := range stages {
+		if versionInfo, ok := latestVersionInfos[stage]; ok {
+			latestVersions = append(latestVersions, createModelVersion(versionInfo, modelInfo.UserData))
+		}
+	}
+	return latestVersions, nil
+}
+
+func (s *Server) retrieveRegisteredModel(ctx context.Context, name string) (registeredModel, error) {
+	modelInfo, err := s.client.RetrieveModelInfo(ctx, name)
+	if err != nil {
+		return registeredModel{}, err
+	}
+	latestVersions, err := s.latestVersions(ctx, modelInfo, defaultStages)
+	if err != nil {
+		return registeredModel{}, err
+	}
+	return createRegisteredModel(modelInfo, latestVersions), nil
+}
+
+func (s *Server) createRegisteredModel(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		Name        string `json:"name"`
+		Tags        []tag  `json:"tags"`
+		Description string `json:"description"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	if err := requireName(params.Name); err != nil {
+		return nil, err
+	}
+	userData := map[string]string{}
+	for _, tag := range params.Tags {
+		if err := validateTagKey(tag.Key); err != nil {
+			return nil, err
+		}
+		userData[tag.Key] = tag.Value
+	}
+	modelInfo := client.ModelInfo{ModelID: params.Name, Description: params.Description, UserData: userData}
+	if err := s.client.CreateModel(ctx, modelInfo); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"registered_model": createRegisteredModel(modelInfo, nil)}, nil
+}
+
+func (s *Server) getRegisteredModel(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		Name string `json:"name"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	if err := requireName(params.Name); err != nil {
+		return nil, err
+	}
+	model, err := s.retrieveRegisteredModel(ctx, params.Name)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"registered_model": model}, nil
+}
+
+// updateModelUserData changes the user data of a model, it fails if the model is updated concurrently
+func (s *Server) updateModelUserData(ctx context.Context, name string, update func(userData map[string]string)) (registeredModel, error) {
+	modelInfo, err := s.client.RetrieveModelInfo(ctx, name)
+	if err != nil {
+		return registeredModel{}, err
+	}
+	userData := copyUserData(modelInfo.UserData)
+	update(userData)
+	if err := s.client.CreateOrUpdateModelAtRevision(ctx, client.ModelInfo{ModelID: name, UserData: userData}, modelInfo.Revision); err != nil {
+		return registeredModel{}, err
+	}
+	return s.retrieveRegisteredModel(ctx, name)
+}
+
+func (s *Server) updateRegisteredModel(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	if err := requireName(params.Name); err != nil {
+		return nil, err
+	}
+	model, err := s.updateModelUserData(ctx, params.Name, func(userData map[string]string) {
+		if params.Description == "" {
+			delete(userData, grpcservers.DescriptionUserDataKey)
+		} else {
+			userData[grpcservers.DescriptionUserDataKey] = params.Description
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"registered_model": model}, nil
+}
+
+func (s *Server) deleteRegisteredModel(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		Name string `json:"name"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	if err := requireName(params.Name); err != nil {
+		return nil, err
+	}
+	if err := s.client.DeleteModel(ctx, params.Name); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{}, nil
+}
+
+// parsePagination parses the maximum number of results and the page token, the offset of the first result
+func parsePagination(maxResults flexibleInt, pageToken string, defaultMaxResults int, maxMaxResults int) (int, int, error) {
+	count := int(maxResults)
+	if count == 0 {
+		count = defaultMaxResults
+	}
+	if count < 0 || count > maxMaxResults {
+		return 0, 0, invalidParameterError("invalid max_results %d, expecting at most %d", count, maxMaxResults)
+	}
+	offset := 0
+	if pageToken != "" {
+		var err error
+		offset, err = strconv.Atoi(pageToken)
+		if err != nil || offset < 0 {
+			return 0, 0, invalidParameterError("invalid page_token %q", pageToken)
+		}
+	}
+	return count, offset, nil
+}
+
+func (s *Server) searchRegisteredModels(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		Filter     string      `json:"filter"`
+		MaxResults flexibleInt `json:"max_results"`
+		PageToken  string      `json:"page_token"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	conditions, err := parseFilter(params.Filter, "name")
+	if err != nil {
+		return nil, err
+	}
+	count, offset, err := parsePagination(params.MaxResults, params.PageToken, defaultSearchedModels, maxSearchedModels)
+	if err != nil {
+		return nil, err
+	}
+
+	models := []registeredModel{}
+	matchingModels := 0
+	nextPageToken := ""
+	it := s.client.Models(ctx)
+	for it.Next() {
+		modelInfo := it.ModelInfo()
+		if !matchesAll(conditions, map[string]string{"name": modelInfo.ModelID}, modelInfo.UserData) {
+			continue
+		}
+		matchingModels++
+		if matchingModels <= offset {
+			continue
+		}
+		if len(models) == count {
+			nextPageToken = strconv.Itoa(offset + count)
+			break
+		}
+		latestVersions, err := s.latestVersions(ctx, modelInfo, defaultStages)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, createRegisteredModel(modelInfo, latestVersions))
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	rep := map[string]interface{}{"registered_models": models}
+	if nextPageToken != "" {
+		rep["next_page_token"] = nextPageToken
+	}
+	return rep, nil
+}
+
+func (s *Server) getLatestVersions(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		Name   string          `json:"name"`
+		Stages flexibleStrings `json:"stages"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	if err := requireName(params.Name); err != nil {
+		return nil, err
+	}
+	stages := defaultStages
+	if len(params.Stages) > 0 {
+		stages = []client.VersionStage{}
+		for _, mlflowStage := range params.Stages {
+			stage, ok := parseStage(mlflowStage)
+			if !ok {
+				return nil, invalidParameterError("invalid stage %q, expecting None, Staging, Production or Archived", mlflowStage)
+			}
+			stages = append(stages, stage)
+		}
+	}
+	modelInfo, err := s.client.RetrieveModelInfo(ctx, params.Name)
+	if err != nil {
+		return nil, err
+	}
+	latestVersions, err := s.latestVersions(ctx, modelInfo, stages)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"model_versions": latestVersions}, nil
+}
+
+func (s *Server) setRegisteredModelTag(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		Name  string `json:"name"`
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	if err := requireName(params.Name); err != nil {
+		return nil, err
+	}
+	if err := validateTagKey(params.Key); err != nil {
+		return nil, err
+	}
+	if _, err := s.updateModelUserData(ctx, params.Name, func(userData map[string]string) { userData[params.Key] = params.Value }); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{}, nil
+}
+
+func (s *Server) deleteRegisteredModelTag(ctx context.Context, r request) (interface{}, error) {
+	params := struct {
+		Name string `json:"name"`
+		Key  string `json:"key"`
+	}{}
+	if err := r.decode(&params); err != nil {
+		return nil, err
+	}
+	if err := requireName(params.Name); err != nil {
+		return nil, err
+	}
+	if err := validateTagKey(params.Key); err != nil {
+		return nil, err
+	}
+	if _, err := s.updateModelUserData(ctx, params.Name, func(userData map[string]string) { delete(userData, params.Key) }); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{}, nil
+}
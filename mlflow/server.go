@@ -0,0 +1,172 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mlflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/client"
+)
+
+// PathPrefix is the prefix of the paths of the MLflow REST API
+const PathPrefix = "/api/2.0/mlflow/"
+
+// apiError is an error of the MLflow REST API, serialized as `{"error_code":"...","message":"..."}`
+type apiError struct {
+	status    int
+	errorCode string
+	message   string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func invalidParameterError(format string, args ...interface{}) *apiError {
+	return &apiError{status: http.StatusBadRequest, errorCode: "INVALID_PARAMETER_VALUE", message: fmt.Sprintf(format, args...)}
+}
+
+// createAPIError converts the errors of the model registry calls to the error codes of MLflow
+func createAPIError(err error) *apiError {
+	if apiErr, ok := err.(*apiError); ok {
+		return apiErr
+	}
+	s := status.Convert(err)
+	switch s.Code() {
+	case codes.NotFound:
+		return &apiError{status: http.StatusNotFound, errorCode: "RESOURCE_DOES_NOT_EXIST", message: s.Message()}
+	case codes.AlreadyExists:
+		return &apiError{status: http.StatusBadRequest, errorCode: "RESOURCE_ALREADY_EXISTS", message: s.Message()}
+	case codes.InvalidArgument, codes.OutOfRange:
+		return &apiError{status: http.StatusBadRequest, errorCode: "INVALID_PARAMETER_VALUE", message: s.Message()}
+	case codes.FailedPrecondition, codes.Aborted:
+		return &apiError{status: http.StatusBadRequest, errorCode: "INVALID_STATE", message: s.Message()}
+	case codes.Unauthenticated:
+		return &apiError{status: http.StatusUnauthorized, errorCode: "UNAUTHENTICATED", message: s.Message()}
+	case codes.PermissionDenied:
+		return &apiError{status: http.StatusForbidden, errorCode: "PERMISSION_DENIED", message: s.Message()}
+	case codes.ResourceExhausted:
+		return &apiError{status: http.StatusTooManyRequests, errorCode: "REQUEST_LIMIT_EXCEEDED", message: s.Message()}
+	case codes.Unavailable:
+		return &apiError{status: http.StatusServiceUnavailable, errorCode: "TEMPORARILY_UNAVAILABLE", message: s.Message()}
+	default:
+		return &apiError{status: http.StatusInternalServerError, errorCode: "INTERNAL_ERROR", message: s.Message()}
+	}
+}
+
+// request is an MLflow REST API request, its parameters are in the query of GET requests and in the JSON body otherwise
+type request struct {
+	httpRequest *http.Request
+}
+
+// decode reads the parameters of the request, the values of the query are decoded as JSON strings or string arrays
+func (r request) decode(params interface{}) error {
+	if r.httpRequest.Method != http.MethodGet {
+		if err := json.NewDecoder(r.httpRequest.Body).Decode(params); err != nil {
+			return invalidParameterError("unable to parse the request body: %s", err)
+		}
+		return nil
+	}
+	values := map[string]interface{}{}
+	for key, queryValues := range r.httpRequest.URL.Query() {
+		if len(queryValues) == 1 {
+			values[key] = queryValues[0]
+		} else {
+			values[key] = queryValues
+		}
+	}
+	body, err := json.Marshal(values)
+	if err != nil {
+		return invalidParameterError("unable to parse the request query: %s", err)
+	}
+	if err := json.Unmarshal(body, params); err != nil {
+		return invalidParameterError("unable to parse the request query: %s", err)
+	}
+	return nil
+}
+
+type handler func(ctx context.Context, r request) (interface{}, error)
+
+// Server serves a subset of the MLflow Model Registry REST API, its registered models and model versions, by calling a
+// model registry
+type Server struct {
+	client *client.Client
+	routes map[string]handler // By method and path, e.g. `GET registered-models/get`
+}
+
+// CreateServer creates a server calling the model registry with a client, the authorization header of the requests is
+// forwarded with the calls
+func CreateServer(c *client.Client) *Server {
+	s := &Server{client: c}
+	s.routes = map[string]handler{
+		"POST registered-models/create":              s.createRegisteredModel,
+		"GET registered-models/get":                  s.getRegisteredModel,
+		"PATCH registered-models/update":             s.updateRegisteredModel,
+		"DELETE registered-models/delete":            s.deleteRegisteredModel,
+		"GET registered-models/search":               s.searchRegisteredModels,
+		"GET registered-models/get-latest-versions":  s.getLatestVersions,
+		"POST registered-models/get-latest-versions": s.getLatestVersions,
+		"POST registered-models/set-tag":             s.setRegisteredModelTag,
+		"DELETE registered-models/delete-tag":        s.deleteRegisteredModelTag,
+		"POST model-versions/create":                 s.createModelVersion,
+		"GET model-versions/get":                     s.getModelVersion,
+		"PATCH model-versions/update":                s.updateModelVersion,
+		"DELETE model-versions/delete":               s.deleteModelVersion,
+		"GET model-versions/search":                  s.searchModelVersions,
+		"POST model-versions/transition-stage":       s.transitionModelVersionStage,
+		"GET model-versions/get-download-uri":        s.getModelVersionDownloadURI,
+		"POST model-versions/set-tag":                s.setModelVersionTag,
+		"DELETE model-versions/delete-tag":           s.deleteModelVersionTag,
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := r.Method + " " + strings.TrimPrefix(r.URL.Path, PathPrefix)
+	handler, ok := s.routes[route]
+	if !ok || !strings.HasPrefix(r.URL.Path, PathPrefix) {
+		writeError(w, &apiError{status: http.StatusNotFound, errorCode: "ENDPOINT_NOT_FOUND", message: fmt.Sprintf("no MLflow endpoint for %s %s", r.Method, r.URL.Path)})
+		return
+	}
+
+	ctx := r.Context()
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", authorization)
+	}
+	rep, err := handler(ctx, request{httpRequest: r})
+	if err != nil {
+		writeError(w, createAPIError(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rep); err != nil {
+		logrus.WithError(err).WithField("route", route).Debug("Unable to write the MLflow reply")
+	}
+}
+
+func writeError(w http.ResponseWriter, err *apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error_code": err.errorCode, "message": err.message})
+}
@@ -0,0 +1,235 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mlflow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+)
+
+// startServer starts a model registry and an MLflow server calling it, it returns the URL of the MLflow API
+func startServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	t.Cleanup(server.Stop)
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(b.Destroy)
+	modelRegistryServer, err := grpcservers.RegisterModelRegistryServer(server, grpcservers.ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 16,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+	})
+	assert.NoError(t, err)
+	modelRegistryServer.SetBackend(b)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	c, err := client.CreateClient(context.Background(), client.Configuration{Address: listener.Addr().String()})
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	httpServer := httptest.NewServer(CreateServer(c))
+	t.Cleanup(httpServer.Close)
+	return httpServer.URL + PathPrefix
+}
+
+// call calls an endpoint of the MLflow API, the parameters of GET requests are sent in the query
+func call(t *testing.T, baseURL string, method string, path string, params map[string]interface{}) (int, map[string]interface{}) {
+	var req *http.Request
+	var err error
+	if method == http.MethodGet {
+		query := url.Values{}
+		for key, value := range params {
+			query.Set(key, value.(string))
+		}
+		req, err = http.NewRequest(method, baseURL+path+"?"+query.Encode(), nil)
+	} else {
+		body, marshalErr := json.Marshal(params)
+		assert.NoError(t, marshalErr)
+		req, err = http.NewRequest(method, baseURL+path, bytes.NewReader(body))
+	}
+	assert.NoError(t, err)
+	rep, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer rep.Body.Close()
+	result := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(rep.Body).Decode(&result))
+	return rep.StatusCode, result
+}
+
+func TestRegisteredModels(t *testing.T) {
+	baseURL := startServer(t)
+
+	status, rep := call(t, baseURL, http.MethodPost, "registered-models/create", map[string]interface{}{
+		"name":        "foo",
+		"description": "A model",
+		"tags":        []map[string]string{{"key": "team", "value": "a"}},
+	})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]interface{}{
+		"name":        "foo",
+		"description": "A model",
+		"tags":        []interface{}{map[string]interface{}{"key": "team", "value": "a"}},
+	}, rep["registered_model"])
+	status, rep = call(t, baseURL, http.MethodPost, "registered-models/create", map[string]interface{}{"name": "foo"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "RESOURCE_ALREADY_EXISTS", rep["error_code"])
+	status, _ = call(t, baseURL, http.MethodPost, "registered-models/create", map[string]interface{}{"name": "bar"})
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = call(t, baseURL, http.MethodPatch, "registered-models/update", map[string]interface{}{"name": "foo", "description": "The model"})
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = call(t, baseURL, http.MethodPost, "registered-models/set-tag", map[string]interface{}{"name": "foo", "key": "owner", "value": "me"})
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = call(t, baseURL, http.MethodDelete, "registered-models/delete-tag", map[string]interface{}{"name": "foo", "key": "team"})
+	assert.Equal(t, http.StatusOK, status)
+	status, rep = call(t, baseURL, http.MethodPost, "registered-models/set-tag", map[string]interface{}{"name": "foo", "key": "cogment_model_registry.revision", "value": "1"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "INVALID_PARAMETER_VALUE", rep["error_code"])
+
+	status, rep = call(t, baseURL, http.MethodGet, "registered-models/get", map[string]interface{}{"name": "foo"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]interface{}{
+		"name":        "foo",
+		"description": "The model",
+		"tags":        []interface{}{map[string]interface{}{"key": "owner", "value": "me"}},
+	}, rep["registered_model"])
+
+	status, rep = call(t, baseURL, http.MethodGet, "registered-models/search", map[string]interface{}{"filter": "name LIKE 'f%'"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, rep["registered_models"], 1)
+	status, rep = call(t, baseURL, http.MethodGet, "registered-models/search", map[string]interface{}{"max_results": "1"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, rep["registered_models"], 1)
+	status, rep = call(t, baseURL, http.MethodGet, "registered-models/search", map[string]interface{}{"max_results": "1", "page_token": rep["next_page_token"]})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, rep["registered_models"], 1)
+	assert.Nil(t, rep["next_page_token"])
+
+	status, _ = call(t, baseURL, http.MethodDelete, "registered-models/delete", map[string]interface{}{"name": "bar"})
+	assert.Equal(t, http.StatusOK, status)
+	status, rep = call(t, baseURL, http.MethodGet, "registered-models/get", map[string]interface{}{"name": "bar"})
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "RESOURCE_DOES_NOT_EXIST", rep["error_code"])
+}
+
+func TestModelVersions(t *testing.T) {
+	baseURL := startServer(t)
+	status, _ := call(t, baseURL, http.MethodPost, "registered-models/create", map[string]interface{}{"name": "foo"})
+	assert.Equal(t, http.StatusOK, status)
+
+	for _, runID := range []string{"run1", "run2"} {
+		status, rep := call(t, baseURL, http.MethodPost, "model-versions/create", map[string]interface{}{
+			"name":   "foo",
+			"source": "s3://bucket/" + runID + "/model",
+			"run_id": runID,
+			"tags":   []map[string]string{{"key": "framework", "value": "pytorch"}},
+		})
+		assert.Equal(t, http.StatusOK, status)
+		version := rep["model_version"].(map[string]interface{})
+		assert.Equal(t, "None", version["current_stage"])
+		assert.Equal(t, "READY", version["status"])
+		assert.Equal(t, runID, version["run_id"])
+	}
+
+	status, rep := call(t, baseURL, http.MethodGet, "model-versions/get", map[string]interface{}{"name": "foo", "version": "1"})
+	assert.Equal(t, http.StatusOK, status)
+	version := rep["model_version"].(map[string]interface{})
+	assert.Equal(t, "1", version["version"])
+	assert.Equal(t, "s3://bucket/run1/model", version["source"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"key": "framework", "value": "pytorch"}}, version["tags"])
+
+	for _, transition := range []struct{ version, stage, expectedStage string }{{"1", "Staging", "Staging"}, {"1", "Production", "Production"}, {"2", "staging", "Staging"}} {
+		status, rep = call(t, baseURL, http.MethodPost, "model-versions/transition-stage", map[string]interface{}{"name": "foo", "version": transition.version, "stage": transition.stage})
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, transition.expectedStage, rep["model_version"].(map[string]interface{})["current_stage"])
+	}
+	status, rep = call(t, baseURL, http.MethodPost, "model-versions/transition-stage", map[string]interface{}{"name": "foo", "version": "2", "stage": "Deployed"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "INVALID_PARAMETER_VALUE", rep["error_code"])
+
+	status, rep = call(t, baseURL, http.MethodPost, "registered-models/get-latest-versions", map[string]interface{}{"name": "foo", "stages": []string{"Production", "Staging"}})
+	assert.Equal(t, http.StatusOK, status)
+	latestVersions := rep["model_versions"].([]interface{})
+	assert.Len(t, latestVersions, 2)
+	assert.Equal(t, "1", latestVersions[0].(map[string]interface{})["version"])
+	assert.Equal(t, "Production", latestVersions[0].(map[string]interface{})["current_stage"])
+	assert.Equal(t, "2", latestVersions[1].(map[string]interface{})["version"])
+
+	status, rep = call(t, baseURL, http.MethodGet, "model-versions/search", map[string]interface{}{"filter": "name='foo' and run_id='run2'"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, rep["model_versions"], 1)
+	assert.Equal(t, "Staging", rep["model_versions"].([]interface{})[0].(map[string]interface{})["current_stage"])
+	status, rep = call(t, baseURL, http.MethodGet, "model-versions/search", map[string]interface{}{"filter": "creation_timestamp > 0"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "INVALID_PARAMETER_VALUE", rep["error_code"])
+
+	status, _ = call(t, baseURL, http.MethodPatch, "model-versions/update", map[string]interface{}{"name": "foo", "version": "2", "description": "Candidate"})
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = call(t, baseURL, http.MethodPost, "model-versions/set-tag", map[string]interface{}{"name": "foo", "version": "2", "key": "reviewed", "value": "yes"})
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = call(t, baseURL, http.MethodDelete, "model-versions/delete-tag", map[string]interface{}{"name": "foo", "version": "2", "key": "framework"})
+	assert.Equal(t, http.StatusOK, status)
+	status, rep = call(t, baseURL, http.MethodGet, "model-versions/get", map[string]interface{}{"name": "foo", "version": "2"})
+	assert.Equal(t, http.StatusOK, status)
+	version = rep["model_version"].(map[string]interface{})
+	assert.Equal(t, "Candidate", version["description"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"key": "reviewed", "value": "yes"}}, version["tags"])
+
+	status, rep = call(t, baseURL, http.MethodGet, "model-versions/get-download-uri", map[string]interface{}{"name": "foo", "version": "2"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "s3://bucket/run2/model", rep["artifact_uri"])
+
+	status, _ = call(t, baseURL, http.MethodDelete, "model-versions/delete", map[string]interface{}{"name": "foo", "version": "2"})
+	assert.Equal(t, http.StatusOK, status)
+	status, rep = call(t, baseURL, http.MethodGet, "model-versions/get", map[string]interface{}{"name": "foo", "version": "2"})
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "RESOURCE_DOES_NOT_EXIST", rep["error_code"])
+	status, rep = call(t, baseURL, http.MethodGet, "model-versions/get", map[string]interface{}{"name": "foo", "version": "latest"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "INVALID_PARAMETER_VALUE", rep["error_code"])
+	status, rep = call(t, baseURL, http.MethodGet, "experiments/list", map[string]interface{}{})
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "ENDPOINT_NOT_FOUND", rep["error_code"])
+}
+
+func TestParseFilter(t *testing.T) {
+	conditions, err := parseFilter(`name ILIKE 'FOO%' AND tags.team = "a"`, "name")
+	assert.NoError(t, err)
+	assert.Equal(t, []condition{{key: "name", comparator: "ILIKE", value: "FOO%"}, {key: "tags.team", comparator: "=", value: "a"}}, conditions)
+	assert.True(t, matchesAll(conditions, map[string]string{"name": "foo_bar"}, map[string]string{"team": "a"}))
+	assert.False(t, matchesAll(conditions, map[string]string{"name": "foo_bar"}, map[string]string{"team": "b"}))
+	assert.False(t, matchesAll(conditions, map[string]string{"name": "bar"}, map[string]string{"team": "a"}))
+
+	_, err = parseFilter("run_id = 'a'", "name")
+	assert.Error(t, err)
+	_, err = parseFilter("name = a", "name")
+	assert.Error(t, err)
+}
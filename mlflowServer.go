@@ -0,0 +1,108 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/mlflow"
+)
+
+// Size of the buffer of the in-process connections of the MLflow API
+const mlflowConnectionBufferSize = 1024 * 1024
+
+// serviceRegistrars registers the services on several servers
+type serviceRegistrars []grpc.ServiceRegistrar
+
+func (r serviceRegistrars) RegisterService(desc *grpc.ServiceDesc, implementation interface{}) {
+	for _, registrar := range r {
+		registrar.RegisterService(desc, implementation)
+	}
+}
+
+// mlflowServer serves the MLflow REST API by calling an in-process gRPC server, running the same services and
+// interceptors as the main one without TLS
+type mlflowServer struct {
+	port       int
+	grpcServer *grpc.Server
+	httpServer *http.Server
+	certFile   string
+	keyFile    string
+}
+
+func createMLflowServer(port int, opts []grpc.ServerOption, certFile string, keyFile string) *mlflowServer {
+	return &mlflowServer{
+		port:       port,
+		grpcServer: grpc.NewServer(opts...),
+		httpServer: &http.Server{Addr: fmt.Sprintf(":%d", port)},
+		certFile:   certFile,
+		keyFile:    keyFile,
+	}
+}
+
+// serve starts serving the MLflow REST API, the services need to be registered on the gRPC server beforehand
+func (s *mlflowServer) serve() error {
+	listener := bufconn.Listen(mlflowConnectionBufferSize)
+	go func() {
+		if err := s.grpcServer.Serve(listener); err != nil {
+			logrus.WithError(err).Error("Unexpected error while serving the in-process gRPC services of the MLflow API")
+		}
+	}()
+	c, err := client.CreateClient(context.Background(), client.Configuration{
+		Address: "in-process",
+		Dialer: func(ctx context.Context, address string) (net.Conn, error) {
+			return listener.Dial()
+		},
+	})
+	if err != nil {
+		return err
+	}
+	s.httpServer.Handler = mlflow.CreateServer(c)
+	go func() {
+		var err error
+		if s.certFile != "" {
+			err = s.httpServer.ListenAndServeTLS(s.certFile, s.keyFile)
+		} else {
+			err = s.httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logrus.Fatalf("unexpected error while serving the MLflow API: %v", err)
+		}
+	}()
+	logrus.Infof("MLflow Model Registry API served on port %d under %q", s.port, mlflow.PathPrefix)
+	return nil
+}
+
+// gracefulStop stops the server once the in-flight requests are finished
+func (s *mlflowServer) gracefulStop() {
+	if err := s.httpServer.Shutdown(context.Background()); err != nil {
+		logrus.WithError(err).Warn("Unable to stop the MLflow API")
+	}
+	s.grpcServer.GracefulStop()
+}
+
+// stop cancels the in-flight requests
+func (s *mlflowServer) stop() {
+	s.grpcServer.Stop()
+	_ = s.httpServer.Close()
+}
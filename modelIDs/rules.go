@@ -0,0 +1,102 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modelIDs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// InvalidModelIDError is raised when a model id doesn't satisfy the rules
+type InvalidModelIDError struct {
+	ModelID string
+	Reason  string
+}
+
+func (e *InvalidModelIDError) Error() string {
+	return fmt.Sprintf("invalid model id %q, %s", e.ModelID, e.Reason)
+}
+
+// Rules defines the model ids accepted by the registry on top of the ones safe for every backend
+type Rules struct {
+	Pattern          *regexp.Regexp // If defined, model ids must match it
+	MaxLength        int            // Maximum length in bytes, 0 means unlimited
+	ReservedPrefixes []string       // Model ids can't start with any of them
+}
+
+// ParseRules creates rules from their settings, reserved prefixes being a comma separated list
+func ParseRules(pattern string, maxLength int, reservedPrefixes string) (*Rules, error) {
+	rules := &Rules{MaxLength: maxLength}
+	if pattern != "" {
+		compiledPattern, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the model id pattern %q: %w", pattern, err)
+		}
+		rules.Pattern = compiledPattern
+	}
+	if maxLength < 0 {
+		return nil, fmt.Errorf("invalid model id maximum length \"%d\", expecting a positive length or 0", maxLength)
+	}
+	for _, prefix := range strings.Split(reservedPrefixes, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			rules.ReservedPrefixes = append(rules.ReservedPrefixes, prefix)
+		}
+	}
+	return rules, nil
+}
+
+// CheckPathSafety rejects the model ids the filesystem and object store backends can't map to a path or a key
+//
+// `/` is allowed to structure the ids but not as empty, `.` or `..` segments.
+func CheckPathSafety(modelID string) error {
+	if modelID == "" {
+		return &InvalidModelIDError{ModelID: modelID, Reason: "it is empty"}
+	}
+	for _, r := range modelID {
+		if unicode.IsControl(r) || r == '\\' {
+			return &InvalidModelIDError{ModelID: modelID, Reason: fmt.Sprintf("it contains %q", r)}
+		}
+	}
+	for _, segment := range strings.Split(modelID, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return &InvalidModelIDError{ModelID: modelID, Reason: fmt.Sprintf("it contains the path segment %q", segment)}
+		}
+	}
+	return nil
+}
+
+// Validate checks a model id is safe for every backend and satisfies the rules, nil rules only check the safety
+func (r *Rules) Validate(modelID string) error {
+	if err := CheckPathSafety(modelID); err != nil {
+		return err
+	}
+	if r == nil {
+		return nil
+	}
+	if r.MaxLength > 0 && len(modelID) > r.MaxLength {
+		return &InvalidModelIDError{ModelID: modelID, Reason: fmt.Sprintf("it is longer than %d bytes", r.MaxLength)}
+	}
+	for _, prefix := range r.ReservedPrefixes {
+		if strings.HasPrefix(modelID, prefix) {
+			return &InvalidModelIDError{ModelID: modelID, Reason: fmt.Sprintf("prefix %q is reserved", prefix)}
+		}
+	}
+	if r.Pattern != nil && !r.Pattern.MatchString(modelID) {
+		return &InvalidModelIDError{ModelID: modelID, Reason: fmt.Sprintf("it doesn't match %q", r.Pattern.String())}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modelIDs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathSafety(t *testing.T) {
+	var rules *Rules
+	assert.NoError(t, rules.Validate("foo"))
+	assert.NoError(t, rules.Validate("team_a.foo"))
+	assert.NoError(t, rules.Validate("team/foo/v1.2"))
+	for _, modelID := range []string{"", "/foo", "foo/", "foo//bar", "../foo", "foo/./bar", "foo\\bar", "foo\nbar"} {
+		assert.IsType(t, &InvalidModelIDError{}, rules.Validate(modelID), modelID)
+	}
+}
+
+func TestRules(t *testing.T) {
+	rules, err := ParseRules(`^[a-z0-9_.]+$`, 10, "internal., tmp_")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"internal.", "tmp_"}, rules.ReservedPrefixes)
+	assert.NoError(t, rules.Validate("foo"))
+	assert.NoError(t, rules.Validate("team_a.foo"))
+	assert.Error(t, rules.Validate("Foo"))
+	assert.Error(t, rules.Validate("foo_bar_baz"))
+	assert.Error(t, rules.Validate("tmp_foo"))
+	err = rules.Validate("internal.a")
+	assert.EqualError(t, err, `invalid model id "internal.a", prefix "internal." is reserved`)
+	assert.Error(t, rules.Validate("../foo"))
+
+	_, err = ParseRules(`[a-z`, 0, "")
+	assert.Error(t, err)
+	_, err = ParseRules("", -1, "")
+	assert.Error(t, err)
+	rules, err = ParseRules("", 0, "")
+	assert.NoError(t, err)
+	assert.NoError(t, rules.Validate("Any-model_ID"))
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namespaces
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/cogment/cogment-model-registry/backend"
+)
+
+// Separator separates the namespace of a model from the rest of its id, e.g. `team_a.my_model`
+//
+// It isn't "/", the filesystem and object store backends map it to nested directories or keys.
+const Separator = "."
+
+// Number of models or versions listed at once while computing the usage of a namespace
+const pageSize = 100
+
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// Namespace retrieves the namespace of a model, empty for the models outside of any namespace
+func Namespace(modelID string) string {
+	if index := strings.Index(modelID, Separator); index >= 0 {
+		return modelID[:index]
+	}
+	return ""
+}
+
+// ModelIDPrefix is the prefix of the ids of the models of a namespace, empty for the empty namespace
+func ModelIDPrefix(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return namespace + Separator
+}
+
+// ValidateName checks a namespace name is made of letters, digits, `_` and `-`, starting with a letter or a digit
+func ValidateName(namespace string) error {
+	if !nameRegexp.MatchString(namespace) {
+		return fmt.Errorf("invalid namespace %q, expecting letters, digits, \"_\" and \"-\", starting with a letter or a digit", namespace)
+	}
+	return nil
+}
+
+// Quota limits what the models of a namespace can store, a zero value disables the corresponding limit
+type Quota struct {
+	MaxModels   int   `yaml:"max_models"`
+	MaxVersions int   `yaml:"max_versions"`  // Versions of all the models of the namespace
+	MaxDataSize int64 `yaml:"max_data_size"` // Bytes of data of all the versions of the namespace
+}
+
+// Configuration defines the namespaces of a registry and their quotas
+type Configuration struct {
+	Namespaces   map[string]Quota `yaml:"namespaces"`    // Declared namespaces and their quota
+	DefaultQuota Quota            `yaml:"default_quota"` // Quota of the namespaces that aren't declared
+	Required     bool             `yaml:"required"`      // Reject the models outside of the declared namespaces
+}
+
+// InvalidConfigurationError is raised when a namespaces configuration is inconsistent
+type InvalidConfigurationError struct {
+	Reason string
+}
+
+func (e *InvalidConfigurationError) Error() string {
+	return fmt.Sprintf("invalid namespaces configuration, %s", e.Reason)
+}
+
+// UndeclaredNamespaceError is raised when a model is outside of the declared namespaces while they are required
+type UndeclaredNamespaceError struct {
+	ModelID string
+}
+
+func (e *UndeclaredNamespaceError) Error() string {
+	return fmt.Sprintf("model %q is not in a declared namespace, expecting an id like \"<namespace>%s<model>\"", e.ModelID, Separator)
+}
+
+// QuotaExceededError is raised when a namespace would store more than its quota allows
+type QuotaExceededError struct {
+	Namespace string
+	Resource  string // "models", "versions" or "bytes"
+	Limit     int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("namespace %q quota exceeded, it is limited to %d %s", e.Namespace, e.Limit, e.Resource)
+}
+
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == backend.ErrQuotaExceeded
+}
+
+// LoadConfiguration loads a namespaces configuration from a YAML file
+func LoadConfiguration(filename string) (*Configuration, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the namespaces configuration from %q: %w", filename, err)
+	}
+	configuration := &Configuration{}
+	err = yaml.UnmarshalStrict(content, configuration)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the namespaces configuration from %q: %w", filename, err)
+	}
+	err = configuration.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return configuration, nil
+}
+
+// Validate checks the names of the declared namespaces and that their limits aren't negative
+func (c *Configuration) Validate() error {
+	for namespace, quota := range c.Namespaces {
+		if err := ValidateName(namespace); err != nil {
+			return &InvalidConfigurationError{Reason: err.Error()}
+		}
+		if quota.MaxModels < 0 || quota.MaxVersions < 0 || quota.MaxDataSize < 0 {
+			return &InvalidConfigurationError{Reason: fmt.Sprintf("namespace %q has a negative quota", namespace)}
+		}
+	}
+	if c.DefaultQuota.MaxModels < 0 || c.DefaultQuota.MaxVersions < 0 || c.DefaultQuota.MaxDataSize < 0 {
+		return &InvalidConfigurationError{Reason: "the default quota is negative"}
+	}
+	return nil
+}
+
+// CheckModelID rejects the models whose id doesn't belong to a declared namespace when they are required
+func (c *Configuration) CheckModelID(modelID string) error {
+	if !c.Required {
+		return nil
+	}
+	if _, ok := c.Namespaces[Namespace(modelID)]; !ok {
+		return &UndeclaredNamespaceError{ModelID: modelID}
+	}
+	return nil
+}
+
+// Quota retrieves the quota of a namespace, the models outside of any namespace don't have one
+func (c *Configuration) Quota(namespace string) Quota {
+	if namespace == "" {
+		return Quota{}
+	}
+	if quota, ok := c.Namespaces[namespace]; ok {
+		return quota
+	}
+	return c.DefaultQuota
+}
+
+// Usage is what the models of a namespace store
+type Usage struct {
+	ModelsCount   int
+	VersionsCount int
+	DataSize      int64
+}
+
+// Check verifies the usage of a namespace stays within its quota once an addition is made
+func (q Quota) Check(namespace string, usage Usage, added Usage) error {
+	if q.MaxModels > 0 && added.ModelsCount > 0 && usage.ModelsCount+added.ModelsCount > q.MaxModels {
+		return &QuotaExceededError{Namespace: namespace, Resource: "models", Limit: int64(q.MaxModels)}
+	}
+	if q.MaxVersions > 0 && added.VersionsCount > 0 && usage.VersionsCount+added.VersionsCount > q.MaxVersions {
+		return &QuotaExceededError{Namespace: namespace, Resource: "versions", Limit: int64(q.MaxVersions)}
+	}
+	if q.MaxDataSize > 0 && added.DataSize > 0 && usage.DataSize+added.DataSize > q.MaxDataSize {
+		return &QuotaExceededError{Namespace: namespace, Resource: "bytes", Limit: q.MaxDataSize}
+	}
+	return nil
+}
+
+// IsLimited tells whether the quota defines any limit
+func (q Quota) IsLimited() bool {
+	return q.MaxModels > 0 || q.MaxVersions > 0 || q.MaxDataSize > 0
+}
+
+// ModelFilter selects the models of a non empty namespace
+func ModelFilter(namespace string) backend.ModelFilter {
+	return backend.ModelFilter{ModelIDGlob: ModelIDPrefix(namespace) + "*"}
+}
+
+// RetrieveUsage computes the usage of a non empty namespace by listing its models and their versions
+func RetrieveUsage(b backend.Backend, namespace string) (Usage, error) {
+	usage := Usage{}
+	filter := ModelFilter(namespace)
+	for modelOffset := 0; ; modelOffset += pageSize {
+		modelInfos, err := b.QueryModels(filter, modelOffset, pageSize)
+		if err != nil {
+			return usage, fmt.Errorf("unable to list the models of namespace %q: %w", namespace, err)
+		}
+		for _, modelInfo := range modelInfos {
+			usage.ModelsCount++
+			err := addVersionsUsage(b, modelInfo.ModelID, &usage)
+			if err != nil {
+				if errors.As(err, new(*backend.UnknownModelError)) {
+					// Deleted in between
+					continue
+				}
+				return usage, fmt.Errorf("unable to list the versions of model %q: %w", modelInfo.ModelID, err)
+			}
+		}
+		if len(modelInfos) < pageSize {
+			return usage, nil
+		}
+	}
+}
+
+func addVersionsUsage(b backend.Backend, modelID string, usage *Usage) error {
+	for initialVersionNumber := uint(0); ; {
+		versionInfos, err := b.ListModelVersionInfos(modelID, initialVersionNumber, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, versionInfo := range versionInfos {
+			usage.VersionsCount++
+			usage.DataSize += int64(versionInfo.DataSize)
+			initialVersionNumber = versionInfo.VersionNumber + 1
+		}
+		if len(versionInfos) < pageSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namespaces
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespace(t *testing.T) {
+	assert.Equal(t, "team_a", Namespace("team_a.foo"))
+	assert.Equal(t, "team_a", Namespace("team_a.foo.bar"))
+	assert.Equal(t, "", Namespace("foo"))
+	assert.Equal(t, "team_a.", ModelIDPrefix("team_a"))
+	assert.Equal(t, "", ModelIDPrefix(""))
+	assert.NoError(t, ValidateName("team-a_1"))
+	assert.Error(t, ValidateName(""))
+	assert.Error(t, ValidateName("team.a"))
+	assert.Error(t, ValidateName("team*"))
+}
+
+func TestLoadConfiguration(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "namespaces.yaml")
+	err := os.WriteFile(filename, []byte(`
+namespaces:
+  team_a:
+    max_models: 10
+  team_b: {}
+default_quota:
+  max_versions: 100
+  max_data_size: 1000000
+required: true
+`), 0600)
+	assert.NoError(t, err)
+
+	configuration, err := LoadConfiguration(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, Quota{MaxModels: 10}, configuration.Quota("team_a"))
+	assert.Equal(t, Quota{}, configuration.Quota("team_b"))
+	assert.Equal(t, Quota{MaxVersions: 100, MaxDataSize: 1000000}, configuration.Quota("team_c"))
+	assert.Equal(t, Quota{}, configuration.Quota(""))
+
+	assert.NoError(t, configuration.CheckModelID("team_a.foo"))
+	assert.IsType(t, &UndeclaredNamespaceError{}, configuration.CheckModelID("team_c.foo"))
+	assert.IsType(t, &UndeclaredNamespaceError{}, configuration.CheckModelID("foo"))
+
+	err = os.WriteFile(filename, []byte("namespaces:\n  team.a: {}\n"), 0600)
+	assert.NoError(t, err)
+	_, err = LoadConfiguration(filename)
+	assert.IsType(t, &InvalidConfigurationError{}, err)
+}
+
+func TestQuotaCheck(t *testing.T) {
+	quota := Quota{MaxModels: 2, MaxVersions: 3, MaxDataSize: 100}
+	usage := Usage{ModelsCount: 2, VersionsCount: 2, DataSize: 60}
+	err := quota.Check("team_a", usage, Usage{ModelsCount: 1})
+	assert.Equal(t, &QuotaExceededError{Namespace: "team_a", Resource: "models", Limit: 2}, err)
+	assert.NoError(t, quota.Check("team_a", usage, Usage{VersionsCount: 1, DataSize: 40}))
+	err = quota.Check("team_a", usage, Usage{VersionsCount: 2})
+	assert.Equal(t, &QuotaExceededError{Namespace: "team_a", Resource: "versions", Limit: 3}, err)
+	err = quota.Check("team_a", usage, Usage{VersionsCount: 1, DataSize: 41})
+	assert.Equal(t, &QuotaExceededError{Namespace: "team_a", Resource: "bytes", Limit: 100}, err)
+	// A usage already beyond the quota doesn't prevent other additions
+	assert.NoError(t, Quota{MaxModels: 1}.Check("team_a", usage, Usage{VersionsCount: 1}))
+}
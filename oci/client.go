@@ -0,0 +1,330 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Configuration struct {
+	Username  string // If defined, authenticates with the password, with basic auth or to obtain tokens
+	Password  string
+	PlainHTTP bool          // Connects to the registry over HTTP instead of HTTPS, e.g. for a local registry
+	Timeout   time.Duration // Timeout of the requests not transferring data, no timeout when 0
+}
+
+// Client calls the API of a container registry implementing the OCI distribution specification
+type Client struct {
+	configuration Configuration
+	httpClient    *http.Client
+
+	mutex  sync.Mutex
+	tokens map[string]string // Bearer tokens by scope, e.g. `repository:team/models:pull,push`
+}
+
+// CreateClient creates a client of the container registries
+func CreateClient(configuration Configuration) *Client {
+	return &Client{
+		configuration: configuration,
+		httpClient:    &http.Client{},
+		tokens:        map[string]string{},
+	}
+}
+
+// UnexpectedStatusError is raised when a container registry replies with an unexpected HTTP status
+type UnexpectedStatusError struct {
+	Operation  string
+	StatusCode int
+	Message    string
+}
+
+func (e *UnexpectedStatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unable to %s: unexpected status %d", e.Operation, e.StatusCode)
+	}
+	return fmt.Sprintf("unable to %s: unexpected status %d, %s", e.Operation, e.StatusCode, e.Message)
+}
+
+// createUnexpectedStatusError reads the errors listed in the body of a reply from the registry, if any
+func createUnexpectedStatusError(operation string, rep *http.Response) *UnexpectedStatusError {
+	body := struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+	messages := []string{}
+	if data, err := ioutil.ReadAll(io.LimitReader(rep.Body, 64*1024)); err == nil && json.Unmarshal(data, &body) == nil {
+		for _, e := range body.Errors {
+			messages = append(messages, e.Code+": "+e.Message)
+		}
+	}
+	return &UnexpectedStatusError{Operation: operation, StatusCode: rep.StatusCode, Message: strings.Join(messages, ", ")}
+}
+
+func (c *Client) url(ref Reference, path string) string {
+	scheme := "https"
+	if c.configuration.PlainHTTP {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/%s", scheme, ref.Registry, ref.Repository, path)
+}
+
+// scope is the scope of the tokens allowing the actions on the repository of a reference
+func scope(ref Reference, push bool) string {
+	if push {
+		return fmt.Sprintf("repository:%s:pull,push", ref.Repository)
+	}
+	return fmt.Sprintf("repository:%s:pull", ref.Repository)
+}
+
+func (c *Client) authorize(req *http.Request, tokenScope string) {
+	c.mutex.Lock()
+	token, ok := c.tokens[tokenScope]
+	c.mutex.Unlock()
+	if ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if c.configuration.Username != "" {
+		req.SetBasicAuth(c.configuration.Username, c.configuration.Password)
+	}
+}
+
+var challengeParameterPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// fetchToken obtains a token from the authorization service of a `WWW-Authenticate: Bearer ...` challenge
+func (c *Client) fetchToken(ctx context.Context, challenge string, tokenScope string) error {
+	parameters := map[string]string{}
+	for _, match := range challengeParameterPattern.FindAllStringSubmatch(challenge, -1) {
+		parameters[match[1]] = match[2]
+	}
+	realm, ok := parameters["realm"]
+	if !ok {
+		return fmt.Errorf("unable to authenticate, no realm in challenge %q", challenge)
+	}
+	query := url.Values{"scope": {tokenScope}}
+	if service, ok := parameters["service"]; ok {
+		query.Set("service", service)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("unable to request a token from %q: %w", realm, err)
+	}
+	if c.configuration.Username != "" {
+		req.SetBasicAuth(c.configuration.Username, c.configuration.Password)
+	}
+	rep, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to request a token from %q: %w", realm, err)
+	}
+	defer rep.Body.Close()
+	if rep.StatusCode != http.StatusOK {
+		return createUnexpectedStatusError(fmt.Sprintf("request a token from %q", realm), rep)
+	}
+	body := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(rep.Body).Decode(&body); err != nil {
+		return fmt.Errorf("unable to parse the token from %q: %w", realm, err)
+	}
+	token := body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tokens[tokenScope] = token
+	return nil
+}
+
+// do sends a request, created again to answer a bearer token challenge, a non nil reply has to be closed
+func (c *Client) do(ctx context.Context, tokenScope string, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.authorize(req, tokenScope)
+		rep, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("unable to call %q: %w", req.URL.Redacted(), err)
+		}
+		challenge := rep.Header.Get("WWW-Authenticate")
+		if rep.StatusCode != http.StatusUnauthorized || attempt > 0 || !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			return rep, nil
+		}
+		rep.Body.Close()
+		if err := c.fetchToken(ctx, challenge, tokenScope); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// withTimeout bounds the duration of the requests not transferring data
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.configuration.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.configuration.Timeout)
+}
+
+// hasBlob checks if the repository already has a blob
+func (c *Client) hasBlob(ctx context.Context, ref Reference, digest string) (bool, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	rep, err := c.do(ctx, scope(ref, true), func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodHead, c.url(ref, "blobs/"+digest), nil)
+	})
+	if err != nil {
+		return false, err
+	}
+	defer rep.Body.Close()
+	switch rep.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, createUnexpectedStatusError(fmt.Sprintf("check blob %q", digest), rep)
+	}
+}
+
+// pushBlob uploads a blob in a single request, unless the repository already has it
+func (c *Client) pushBlob(ctx context.Context, ref Reference, digest string, size int64, data io.ReadSeeker) error {
+	hasBlob, err := c.hasBlob(ctx, ref, digest)
+	if err != nil || hasBlob {
+		return err
+	}
+
+	startCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	rep, err := c.do(startCtx, scope(ref, true), func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, c.url(ref, "blobs/uploads/"), nil)
+	})
+	if err != nil {
+		return err
+	}
+	rep.Body.Close()
+	if rep.StatusCode != http.StatusAccepted {
+		return createUnexpectedStatusError(fmt.Sprintf("start the upload of blob %q", digest), rep)
+	}
+	location, err := rep.Request.URL.Parse(rep.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("unable to parse the upload location of blob %q: %w", digest, err)
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	rep, err = c.do(ctx, scope(ref, true), func(ctx context.Context) (*http.Request, error) {
+		if _, err := data.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("unable to rewind blob %q: %w", digest, err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, location.String(), ioutil.NopCloser(data))
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer rep.Body.Close()
+	if rep.StatusCode != http.StatusCreated {
+		return createUnexpectedStatusError(fmt.Sprintf("upload blob %q", digest), rep)
+	}
+	return nil
+}
+
+// pullBlob downloads a blob, the reply body has to be closed
+func (c *Client) pullBlob(ctx context.Context, ref Reference, digest string) (io.ReadCloser, error) {
+	rep, err := c.do(ctx, scope(ref, false), func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, c.url(ref, "blobs/"+digest), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rep.StatusCode != http.StatusOK {
+		defer rep.Body.Close()
+		return nil, createUnexpectedStatusError(fmt.Sprintf("download blob %q", digest), rep)
+	}
+	return rep.Body, nil
+}
+
+// pushManifest uploads a manifest, tagged by the tag of the reference
+func (c *Client) pushManifest(ctx context.Context, ref Reference, mediaType string, manifest []byte) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	rep, err := c.do(ctx, scope(ref, true), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url(ref, "manifests/"+ref.manifestReference()), strings.NewReader(string(manifest)))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", mediaType)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer rep.Body.Close()
+	if rep.StatusCode != http.StatusCreated {
+		return createUnexpectedStatusError(fmt.Sprintf("upload manifest %q", ref), rep)
+	}
+	return nil
+}
+
+// Maximum size of the downloaded manifests
+const maxManifestSize = 4 * 1024 * 1024
+
+// pullManifest downloads a manifest of one of the accepted media types
+func (c *Client) pullManifest(ctx context.Context, ref Reference, mediaType string) ([]byte, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	rep, err := c.do(ctx, scope(ref, false), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(ref, "manifests/"+ref.manifestReference()), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", mediaType)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rep.Body.Close()
+	if rep.StatusCode != http.StatusOK {
+		return nil, createUnexpectedStatusError(fmt.Sprintf("download manifest %q", ref), rep)
+	}
+	manifest, err := ioutil.ReadAll(io.LimitReader(rep.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to download manifest %q: %w", ref, err)
+	}
+	if len(manifest) > maxManifestSize {
+		return nil, fmt.Errorf("unable to download manifest %q, it is larger than %d bytes", ref, maxManifestSize)
+	}
+	return manifest, nil
+}
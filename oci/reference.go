@@ -0,0 +1,96 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Registry of the references without one
+const defaultRegistry = "registry-1.docker.io"
+
+// Reference identifies an artifact in a container registry, e.g. `registry.example.com/team/models:my_model-2`
+type Reference struct {
+	Registry   string // Host of the registry and optionally its port
+	Repository string
+	Tag        string // Empty when the artifact is identified by its digest
+	Digest     string // Empty when the artifact is identified by its tag
+}
+
+var repositoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+var digestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// ParseReference parses a reference of the form `[<registry>/]<repository>[:<tag>][@<digest>]`, the tag defaults to
+// `latest` and the registry to Docker Hub
+func ParseReference(reference string) (Reference, error) {
+	ref := Reference{}
+	name := reference
+	if index := strings.Index(name, "@"); index >= 0 {
+		ref.Digest = name[index+1:]
+		name = name[:index]
+		if !digestPattern.MatchString(ref.Digest) {
+			return Reference{}, fmt.Errorf("invalid reference %q, %q isn't a sha256 digest", reference, ref.Digest)
+		}
+	}
+	if index := strings.LastIndex(name, ":"); index >= 0 && !strings.Contains(name[index:], "/") {
+		ref.Tag = name[index+1:]
+		name = name[:index]
+		if !tagPattern.MatchString(ref.Tag) {
+			return Reference{}, fmt.Errorf("invalid reference %q, %q isn't a valid tag", reference, ref.Tag)
+		}
+	}
+	// The first component is a registry if it looks like a host
+	if index := strings.Index(name, "/"); index >= 0 && (strings.ContainsAny(name[:index], ".:") || name[:index] == "localhost") {
+		ref.Registry = name[:index]
+		ref.Repository = name[index+1:]
+	} else {
+		ref.Registry = defaultRegistry
+		ref.Repository = name
+		if !strings.Contains(name, "/") {
+			ref.Repository = "library/" + name
+		}
+	}
+	if !repositoryPattern.MatchString(ref.Repository) {
+		return Reference{}, fmt.Errorf("invalid reference %q, %q isn't a valid repository", reference, ref.Repository)
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, nil
+}
+
+// manifestReference is how the manifest of the artifact is requested, its digest if known or its tag
+func (r Reference) manifestReference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
@@ -0,0 +1,275 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/client"
+)
+
+// Media types of the OCI artifacts of the versions
+const (
+	ManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ConfigMediaType   = "application/vnd.cogment.model-registry.version.config.v1+json" // The JSON info of the version
+	DataMediaType     = "application/vnd.cogment.model-registry.version.data.v1"        // The data of the version
+)
+
+// Annotations of the manifests of the versions, mapping their info
+const (
+	AnnotationPrefix         = "io.cogment.model-registry."
+	ModelIDAnnotation        = AnnotationPrefix + "model-id"
+	VersionNumberAnnotation  = AnnotationPrefix + "version-number"
+	DataHashAnnotation       = AnnotationPrefix + "data-hash"
+	ArchivedAnnotation       = AnnotationPrefix + "archived"
+	UserDataAnnotationPrefix = AnnotationPrefix + "user-data." // Followed by the key of each user data entry
+	CreatedAnnotation        = "org.opencontainers.image.created"
+	DescriptionAnnotation    = "org.opencontainers.image.description"
+	TitleAnnotation          = "org.opencontainers.image.title"
+)
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Config        descriptor        `json:"config"`
+	Layers        []descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+func computeDigest(data []byte) string {
+	hash := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// Annotations maps the info of a version to the annotations of its manifest
+func Annotations(versionInfo client.VersionInfo) map[string]string {
+	annotations := map[string]string{
+		ModelIDAnnotation:       versionInfo.ModelID,
+		VersionNumberAnnotation: strconv.FormatUint(uint64(versionInfo.VersionNumber), 10),
+		DataHashAnnotation:      versionInfo.DataHash,
+		ArchivedAnnotation:      strconv.FormatBool(versionInfo.Archived),
+		CreatedAnnotation:       versionInfo.CreationTimestamp.UTC().Format(time.RFC3339Nano),
+	}
+	if versionInfo.Description != "" {
+		annotations[DescriptionAnnotation] = versionInfo.Description
+	}
+	for key, value := range versionInfo.UserData {
+		annotations[UserDataAnnotationPrefix+key] = value
+	}
+	return annotations
+}
+
+// parseAnnotations retrieves the model and the info of a version from the annotations of its manifest
+func parseAnnotations(annotations map[string]string) (string, client.VersionArgs, error) {
+	modelID, ok := annotations[ModelIDAnnotation]
+	if !ok {
+		return "", client.VersionArgs{}, fmt.Errorf("missing annotation %q", ModelIDAnnotation)
+	}
+	versionArgs := client.VersionArgs{
+		DataHash: annotations[DataHashAnnotation],
+		UserData: map[string]string{},
+	}
+	if value, ok := annotations[ArchivedAnnotation]; ok {
+		archived, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", client.VersionArgs{}, fmt.Errorf("invalid annotation %q, %q isn't a boolean", ArchivedAnnotation, value)
+		}
+		versionArgs.Archived = archived
+	}
+	if value, ok := annotations[CreatedAnnotation]; ok {
+		creationTimestamp, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return "", client.VersionArgs{}, fmt.Errorf("invalid annotation %q, %q isn't a RFC 3339 timestamp", CreatedAnnotation, value)
+		}
+		versionArgs.CreationTimestamp = creationTimestamp
+	}
+	for key, value := range annotations {
+		if strings.HasPrefix(key, UserDataAnnotationPrefix) {
+			versionArgs.UserData[strings.TrimPrefix(key, UserDataAnnotationPrefix)] = value
+		}
+	}
+	return modelID, versionArgs, nil
+}
+
+// tempFile is a temporary file storing downloaded data, removed when closed
+type tempFile struct {
+	*os.File
+	digest string
+	size   int64
+}
+
+// download writes data to a temporary file while computing its digest
+func download(write func(w io.Writer) error) (*tempFile, error) {
+	file, err := ioutil.TempFile("", "cogment-model-registry-oci-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create a temporary file: %w", err)
+	}
+	f := &tempFile{File: file}
+	hash := sha256.New()
+	counter := &countingWriter{}
+	if err := write(io.MultiWriter(file, hash, counter)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	f.digest = "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	f.size = counter.count
+	return f, nil
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.File.Name())
+	return err
+}
+
+type countingWriter struct {
+	count int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.count += int64(len(p))
+	return len(p), nil
+}
+
+// PushVersion pushes a version of a model, or the n-th to last version with -n, to a container registry as an OCI
+// artifact tagged by the reference and returns the digest of its manifest
+func (c *Client) PushVersion(ctx context.Context, registry *client.Client, modelID string, versionNumber int, ref Reference) (string, error) {
+	if ref.Tag == "" {
+		return "", fmt.Errorf("unable to push to %q, a tag is required", ref)
+	}
+	versionInfo, err := registry.RetrieveVersionInfo(ctx, modelID, versionNumber)
+	if err != nil {
+		return "", err
+	}
+	data, err := download(func(w io.Writer) error {
+		_, err := registry.RetrieveVersionData(ctx, modelID, int(versionInfo.VersionNumber), w, true)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	defer data.Close()
+	if err := c.pushBlob(ctx, ref, data.digest, data.size, data); err != nil {
+		return "", err
+	}
+
+	config, err := json.Marshal(versionInfo)
+	if err != nil {
+		return "", fmt.Errorf("unable to serialize the info of the version: %w", err)
+	}
+	configDigest := computeDigest(config)
+	if err := c.pushBlob(ctx, ref, configDigest, int64(len(config)), bytes.NewReader(config)); err != nil {
+		return "", err
+	}
+
+	m, err := json.Marshal(manifest{
+		SchemaVersion: 2,
+		MediaType:     ManifestMediaType,
+		Config:        descriptor{MediaType: ConfigMediaType, Digest: configDigest, Size: int64(len(config))},
+		Layers: []descriptor{{
+			MediaType:   DataMediaType,
+			Digest:      data.digest,
+			Size:        data.size,
+			Annotations: map[string]string{TitleAnnotation: fmt.Sprintf("%s-%d", versionInfo.ModelID, versionInfo.VersionNumber)},
+		}},
+		Annotations: Annotations(versionInfo),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to serialize the manifest: %w", err)
+	}
+	if err := c.pushManifest(ctx, ref, ManifestMediaType, m); err != nil {
+		return "", err
+	}
+	return computeDigest(m), nil
+}
+
+// PullVersion pulls an OCI artifact pushed by PushVersion and creates it as a version of a model, by default the model
+// of the pushed version, the model is created if needed
+func (c *Client) PullVersion(ctx context.Context, ref Reference, registry *client.Client, modelID string) (client.VersionInfo, error) {
+	rawManifest, err := c.pullManifest(ctx, ref, ManifestMediaType)
+	if err != nil {
+		return client.VersionInfo{}, err
+	}
+	if ref.Digest != "" && computeDigest(rawManifest) != ref.Digest {
+		return client.VersionInfo{}, fmt.Errorf("unable to pull %q, the manifest doesn't match its digest", ref)
+	}
+	m := manifest{}
+	if err := json.Unmarshal(rawManifest, &m); err != nil {
+		return client.VersionInfo{}, fmt.Errorf("unable to parse manifest %q: %w", ref, err)
+	}
+	if m.Config.MediaType != ConfigMediaType || len(m.Layers) != 1 || m.Layers[0].MediaType != DataMediaType {
+		return client.VersionInfo{}, fmt.Errorf("unable to pull %q, it isn't a version pushed by the model registry", ref)
+	}
+	pushedModelID, versionArgs, err := parseAnnotations(m.Annotations)
+	if err != nil {
+		return client.VersionInfo{}, fmt.Errorf("unable to pull %q: %w", ref, err)
+	}
+	if modelID == "" {
+		modelID = pushedModelID
+	}
+
+	layer := m.Layers[0]
+	data, err := download(func(w io.Writer) error {
+		blob, err := c.pullBlob(ctx, ref, layer.Digest)
+		if err != nil {
+			return err
+		}
+		defer blob.Close()
+		if _, err := io.Copy(w, blob); err != nil {
+			return fmt.Errorf("unable to download blob %q: %w", layer.Digest, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return client.VersionInfo{}, err
+	}
+	defer data.Close()
+	if data.digest != layer.Digest || data.size != layer.Size {
+		return client.VersionInfo{}, fmt.Errorf("unable to pull %q, the data doesn't match its digest", ref)
+	}
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return client.VersionInfo{}, fmt.Errorf("unable to rewind the data: %w", err)
+	}
+
+	if _, err := registry.RetrieveModelInfo(ctx, modelID); status.Code(err) == codes.NotFound {
+		if err := registry.CreateModel(ctx, client.ModelInfo{ModelID: modelID}); err != nil && status.Code(err) != codes.AlreadyExists {
+			return client.VersionInfo{}, err
+		}
+	} else if err != nil {
+		return client.VersionInfo{}, err
+	}
+	return registry.CreateVersion(ctx, modelID, versionArgs, data)
+}
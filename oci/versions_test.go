@@ -0,0 +1,248 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+// fakeContainerRegistry is an in-memory container registry requiring tokens obtained with basic auth
+type fakeContainerRegistry struct {
+	server    *httptest.Server
+	mutex     sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte // By tag and digest
+}
+
+func startFakeContainerRegistry(t *testing.T) *fakeContainerRegistry {
+	r := &fakeContainerRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+	r.server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *fakeContainerRegistry) host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+func (r *fakeContainerRegistry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if username, password, ok := req.BasicAuth(); !ok || username != "user" || password != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "token-" + req.URL.Query().Get("scope")})
+		return
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	index := strings.LastIndex(path, "/blobs/")
+	if index < 0 {
+		index = strings.LastIndex(path, "/manifests/")
+	}
+	repository, resource := path[:index], path[index+1:]
+	requiredScope := "repository:" + repository + ":pull"
+	if req.Method == http.MethodPost || req.Method == http.MethodPut {
+		requiredScope += ",push"
+	}
+	if req.Header.Get("Authorization") != "Bearer token-"+requiredScope && req.Header.Get("Authorization") != "Bearer token-repository:"+repository+":pull,push" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+r.server.URL+`/token",service="fake",scope="`+requiredScope+`"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	switch {
+	case req.Method == http.MethodPost && resource == "blobs/uploads/":
+		w.Header().Set("Location", "/v2/"+repository+"/blobs/uploads/session?state=1")
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPut && resource == "blobs/uploads/session":
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.URL.Query().Get("state") != "1" || computeDigest(body) != req.URL.Query().Get("digest") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[computeDigest(body)] = body
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(resource, "blobs/"):
+		blob, ok := r.blobs[strings.TrimPrefix(resource, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.Method == http.MethodGet {
+			_, _ = w.Write(blob)
+		}
+	case req.Method == http.MethodPut && strings.HasPrefix(resource, "manifests/"):
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.Header.Get("Content-Type") != ManifestMediaType {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.manifests[strings.TrimPrefix(resource, "manifests/")] = body
+		r.manifests[computeDigest(body)] = body
+		w.WriteHeader(http.StatusCreated)
+	case req.Method == http.MethodGet && strings.HasPrefix(resource, "manifests/"):
+		m, ok := r.manifests[strings.TrimPrefix(resource, "manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`))
+			return
+		}
+		w.Header().Set("Content-Type", ManifestMediaType)
+		_, _ = w.Write(m)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// startModelRegistry starts a model registry server on a local port and returns a client connected to it
+func startModelRegistry(t *testing.T) *client.Client {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	t.Cleanup(server.Stop)
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(b.Destroy)
+	modelRegistryServer, err := grpcservers.RegisterModelRegistryServer(server, grpcservers.ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 16,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+	})
+	assert.NoError(t, err)
+	modelRegistryServer.SetBackend(b)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	c, err := client.CreateClient(context.Background(), client.Configuration{Address: listener.Addr().String()})
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestPushPullVersion(t *testing.T) {
+	ctx := context.Background()
+	containerRegistry := startFakeContainerRegistry(t)
+	registry := startModelRegistry(t)
+	assert.NoError(t, registry.CreateModel(ctx, client.ModelInfo{ModelID: "foo"}))
+	creationTimestamp := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	versionInfo, err := registry.CreateVersion(ctx, "foo", client.VersionArgs{
+		CreationTimestamp: creationTimestamp,
+		Description:       "Best so far",
+		Metrics:           map[string]float64{"score": 0.9},
+		UserData:          map[string]string{"team": "a"},
+	}, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	c := CreateClient(Configuration{Username: "user", Password: "password", PlainHTTP: true})
+	ref, err := ParseReference(containerRegistry.host() + "/team/models:foo-1")
+	assert.NoError(t, err)
+	digest, err := c.PushVersion(ctx, registry, "foo", -1, ref)
+	assert.NoError(t, err)
+
+	m := manifest{}
+	assert.NoError(t, json.Unmarshal(containerRegistry.manifests["foo-1"], &m))
+	assert.Equal(t, computeDigest(containerRegistry.manifests["foo-1"]), digest)
+	assert.Equal(t, "foo", m.Annotations[ModelIDAnnotation])
+	assert.Equal(t, "1", m.Annotations[VersionNumberAnnotation])
+	assert.Equal(t, versionInfo.DataHash, m.Annotations[DataHashAnnotation])
+	assert.Equal(t, "2022-03-01T12:00:00Z", m.Annotations[CreatedAnnotation])
+	assert.Equal(t, "Best so far", m.Annotations[DescriptionAnnotation])
+	assert.Equal(t, "a", m.Annotations[UserDataAnnotationPrefix+"team"])
+	assert.Equal(t, data, containerRegistry.blobs[m.Layers[0].Digest])
+
+	// Pushing again reuses the blobs
+	_, err = c.PushVersion(ctx, registry, "foo", 1, Reference{Registry: ref.Registry, Repository: ref.Repository, Tag: "production"})
+	assert.NoError(t, err)
+	assert.Len(t, containerRegistry.blobs, 2)
+
+	pulledVersionInfo, err := c.PullVersion(ctx, Reference{Registry: ref.Registry, Repository: ref.Repository, Digest: digest}, registry, "bar")
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", pulledVersionInfo.ModelID)
+	assert.Equal(t, uint(1), pulledVersionInfo.VersionNumber)
+	assert.True(t, creationTimestamp.Equal(pulledVersionInfo.CreationTimestamp))
+	assert.Equal(t, versionInfo.DataHash, pulledVersionInfo.DataHash)
+	assert.Equal(t, "Best so far", pulledVersionInfo.Description)
+	assert.Equal(t, map[string]float64{"score": 0.9}, pulledVersionInfo.Metrics)
+	assert.Equal(t, "a", pulledVersionInfo.UserData["team"])
+	pulledData := &bytes.Buffer{}
+	_, err = registry.RetrieveVersionData(ctx, "bar", 1, pulledData, true)
+	assert.NoError(t, err)
+	assert.Equal(t, data, pulledData.Bytes())
+
+	// By default the version is pulled in the model it was pushed from
+	pulledVersionInfo, err = c.PullVersion(ctx, ref, registry, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", pulledVersionInfo.ModelID)
+	assert.Equal(t, uint(2), pulledVersionInfo.VersionNumber)
+
+	_, err = c.PullVersion(ctx, Reference{Registry: ref.Registry, Repository: ref.Repository, Tag: "unknown"}, registry, "")
+	assert.IsType(t, &UnexpectedStatusError{}, err)
+	assert.Equal(t, http.StatusNotFound, err.(*UnexpectedStatusError).StatusCode)
+
+	unauthorizedClient := CreateClient(Configuration{Username: "user", Password: "wrong", PlainHTTP: true})
+	_, err = unauthorizedClient.PushVersion(ctx, registry, "foo", 1, ref)
+	assert.IsType(t, &UnexpectedStatusError{}, err)
+}
+
+func TestPullForeignArtifact(t *testing.T) {
+	ctx := context.Background()
+	containerRegistry := startFakeContainerRegistry(t)
+	registry := startModelRegistry(t)
+	containerRegistry.manifests["latest"] = []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},"layers":[]}`)
+
+	c := CreateClient(Configuration{Username: "user", Password: "password", PlainHTTP: true})
+	_, err := c.PullVersion(ctx, Reference{Registry: containerRegistry.host(), Repository: "team/image", Tag: "latest"}, registry, "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "it isn't a version pushed by the model registry")
+}
+
+func TestParseReference(t *testing.T) {
+	for reference, expected := range map[string]Reference{
+		"registry.example.com/team/models:foo-1": {Registry: "registry.example.com", Repository: "team/models", Tag: "foo-1"},
+		"localhost:5000/models":                  {Registry: "localhost:5000", Repository: "models", Tag: "latest"},
+		"team/models@sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a": {Registry: defaultRegistry, Repository: "team/models", Digest: "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"},
+		"models:v1": {Registry: defaultRegistry, Repository: "library/models", Tag: "v1"},
+	} {
+		ref, err := ParseReference(reference)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, ref)
+	}
+	for _, reference := range []string{"registry.example.com/Team/models", "models:", "models@sha256:1234"} {
+		_, err := ParseReference(reference)
+		assert.Error(t, err, reference)
+	}
+}
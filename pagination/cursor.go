@@ -0,0 +1,162 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+// Size of the truncated HMAC signing the cursors
+const signatureSize = 16
+
+// Cursor identifies the position reached while paginating a list
+type Cursor struct {
+	Offset  int    // Position following the last returned item
+	LastKey string // Key of the last returned item, empty if the list is keyed by position
+}
+
+// InvalidCursorError is raised when decoding a handle that wasn't encoded by the codec
+type InvalidCursorError struct {
+	Handle string
+}
+
+func (e *InvalidCursorError) Error() string {
+	return fmt.Sprintf("invalid cursor %q", e.Handle)
+}
+
+// Codec encodes cursors to opaque signed handles and decodes them back
+type Codec struct {
+	secret []byte
+}
+
+// CreateCodec creates a codec signing the cursors with the given secret,
+// a random secret is generated if empty making handles valid for the lifetime of the codec only.
+func CreateCodec(secret []byte) (*Codec, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate a pagination secret: %w", err)
+		}
+	}
+	return &Codec{secret: secret}, nil
+}
+
+func (c *Codec) sign(scope string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	_, _ = mac.Write([]byte(scope))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write(payload)
+	return mac.Sum(nil)[:signatureSize]
+}
+
+// Encode encodes a cursor to a handle only valid for the given scope (i.e. the paginated list)
+func (c *Codec) Encode(scope string, cursor Cursor) string {
+	payload := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(cursor.LastKey)+signatureSize)
+	payload = payload[:binary.PutUvarint(payload, uint64(cursor.Offset))]
+	payload = append(payload, cursor.LastKey...)
+	return base64.RawURLEncoding.EncodeToString(append(payload, c.sign(scope, payload)...))
+}
+
+// Decode decodes a handle encoded by Encode for the same scope
+func (c *Codec) Decode(scope string, handle string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.Strict().DecodeString(handle)
+	if err != nil || len(data) < signatureSize {
+		return Cursor{}, &InvalidCursorError{Handle: handle}
+	}
+	payload, signature := data[:len(data)-signatureSize], data[len(data)-signatureSize:]
+	if !hmac.Equal(signature, c.sign(scope, payload)) {
+		return Cursor{}, &InvalidCursorError{Handle: handle}
+	}
+	offset, offsetSize := binary.Uvarint(payload)
+	if offsetSize <= 0 || offset > uint64(maxInt) {
+		return Cursor{}, &InvalidCursorError{Handle: handle}
+	}
+	return Cursor{Offset: int(offset), LastKey: string(payload[offsetSize:])}, nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// KeyAtFunc retrieves the key of the item at the given position of a list sorted by key, ok is false past the end of the list
+type KeyAtFunc func(offset int) (key string, ok bool, err error)
+
+// ResolveOffset finds the position following the cursor's last key in a list sorted by key,
+// starting from the cursor's offset it only needs a few lookups when few items were inserted or deleted.
+func ResolveOffset(cursor Cursor, keyAt KeyAtFunc) (int, error) {
+	// isAfter is false for the items up to the last key and true for the following ones (and past the end)
+	isAfter := func(offset int) (bool, error) {
+		key, ok, err := keyAt(offset)
+		if err != nil || !ok {
+			return true, err
+		}
+		return key > cursor.LastKey, nil
+	}
+
+	// Exponential search of an interval ]low, high] containing the resolved offset, -1 stands before the list
+	low, high := cursor.Offset-1, cursor.Offset
+	after, err := isAfter(cursor.Offset)
+	if err != nil {
+		return 0, err
+	}
+	if after {
+		for step := 1; low >= 0; step *= 2 {
+			after, err := isAfter(low)
+			if err != nil {
+				return 0, err
+			}
+			if !after {
+				break
+			}
+			high = low
+			low = cursor.Offset - 2*step
+			if low < 0 {
+				low = -1
+			}
+		}
+	} else {
+		low = cursor.Offset
+		for step := 1; ; step *= 2 {
+			high = cursor.Offset + step
+			after, err := isAfter(high)
+			if err != nil {
+				return 0, err
+			}
+			if after {
+				break
+			}
+			low = high
+		}
+	}
+
+	// Binary search in the interval
+	for high-low > 1 {
+		middle := low + (high-low)/2
+		after, err := isAfter(middle)
+		if err != nil {
+			return 0, err
+		}
+		if after {
+			high = middle
+		} else {
+			low = middle
+		}
+	}
+	return high, nil
+}
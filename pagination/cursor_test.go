@@ -0,0 +1,89 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagination
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	codec, err := CreateCodec([]byte("secret"))
+	assert.NoError(t, err)
+
+	for _, cursor := range []Cursor{{}, {Offset: 12}, {Offset: 3, LastKey: "my_model"}, {Offset: 1 << 40, LastKey: "ünicode/🔑"}} {
+		handle := codec.Encode("models", cursor)
+		decodedCursor, err := codec.Decode("models", handle)
+		assert.NoError(t, err)
+		assert.Equal(t, cursor, decodedCursor)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	codec, err := CreateCodec([]byte("secret"))
+	assert.NoError(t, err)
+	otherCodec, err := CreateCodec(nil)
+	assert.NoError(t, err)
+
+	handle := codec.Encode("models", Cursor{Offset: 3, LastKey: "my_model"})
+
+	tamperedHandle := []byte(handle)
+	tamperedHandle[0] ^= 1
+
+	for _, invalidHandle := range []string{"", "3", "not base64!", string(tamperedHandle), otherCodec.Encode("models", Cursor{Offset: 3, LastKey: "my_model"})} {
+		_, err := codec.Decode("models", invalidHandle)
+		assert.IsType(t, &InvalidCursorError{}, err)
+	}
+
+	_, err = codec.Decode("versions/my_model", handle)
+	assert.IsType(t, &InvalidCursorError{}, err)
+}
+
+func TestResolveOffset(t *testing.T) {
+	keys := []string{}
+	for i := 0; i < 100; i++ {
+		keys = append(keys, fmt.Sprintf("key_%03d", i*2))
+	}
+
+	lookupsCount := 0
+	keyAt := func(offset int) (string, bool, error) {
+		lookupsCount++
+		if offset < 0 || offset >= len(keys) {
+			return "", false, nil
+		}
+		return keys[offset], true, nil
+	}
+	expectedOffset := func(lastKey string) int {
+		return sort.Search(len(keys), func(i int) bool { return keys[i] > lastKey })
+	}
+
+	for _, lastKey := range []string{"", "a", "key_000", "key_001", "key_050", "key_051", "key_198", "z"} {
+		for _, offset := range []int{0, 1, 5, 25, 26, 27, 50, 99, 100, 150} {
+			resolvedOffset, err := ResolveOffset(Cursor{Offset: offset, LastKey: lastKey}, keyAt)
+			assert.NoError(t, err)
+			assert.Equal(t, expectedOffset(lastKey), resolvedOffset, "lastKey=%q, offset=%d", lastKey, offset)
+		}
+	}
+
+	// When the list didn't change only two lookups are needed
+	lookupsCount = 0
+	resolvedOffset, err := ResolveOffset(Cursor{Offset: 26, LastKey: "key_050"}, keyAt)
+	assert.NoError(t, err)
+	assert.Equal(t, 26, resolvedOffset)
+	assert.Equal(t, 2, lookupsCount)
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recovery
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/logging"
+)
+
+// Metrics published under `/debug/vars`
+var panicsMetric = expvar.NewInt("rpc_panics")
+
+// Panic is a recovered panic along with the stack of the goroutine where it happened
+type Panic struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *Panic) String() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Capture runs f and returns the panic it raised, nil if it returned normally
+//
+// A *Panic raised again in another goroutine, e.g. by the caller of an operation run in the background, is returned as is
+// to keep the stack where it happened.
+func Capture(f func()) (captured *Panic) {
+	defer func() {
+		if value := recover(); value != nil {
+			if p, ok := value.(*Panic); ok {
+				captured = p
+				return
+			}
+			captured = &Panic{Value: value, Stack: debug.Stack()}
+		}
+	}()
+	f()
+	return nil
+}
+
+// Report logs a recovered panic with its stack, using the logger of the RPC handled in the given context
+func Report(ctx context.Context, p *Panic) {
+	panicsMetric.Add(1)
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"panic": fmt.Sprint(p.Value),
+		"stack": string(p.Stack),
+	}).Error("Recovered from a panic")
+}
+
+func internalError(ctx context.Context, method string, p *Panic) error {
+	Report(ctx, p)
+	return status.Errorf(codes.Internal, "unexpected internal error while handling %q", method)
+}
+
+// UnaryServerInterceptor converts the panics of the unary RPC handlers to `INTERNAL` errors
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var rep interface{}
+		var err error
+		if p := Capture(func() { rep, err = handler(ctx, req) }); p != nil {
+			return nil, internalError(ctx, info.FullMethod, p)
+		}
+		return rep, err
+	}
+}
+
+// StreamServerInterceptor converts the panics of the streaming RPC handlers to `INTERNAL` errors
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		var err error
+		if p := Capture(func() { err = handler(srv, stream) }); p != nil {
+			return internalError(stream.Context(), info.FullMethod, p)
+		}
+		return err
+	}
+}
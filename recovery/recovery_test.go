@@ -0,0 +1,86 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recovery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type serverStream struct {
+	grpc.ServerStream
+}
+
+func (s serverStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestCapture(t *testing.T) {
+	assert.Nil(t, Capture(func() {}))
+
+	p := Capture(func() { panic("failure") })
+	assert.Equal(t, "failure", p.Value)
+	assert.Contains(t, string(p.Stack), "TestCapture")
+
+	// Raised again in another goroutine, the panic keeps its original stack
+	done := make(chan *Panic)
+	go func() {
+		done <- Capture(func() { panic("background failure") })
+	}()
+	backgroundPanic := <-done
+	assert.Same(t, backgroundPanic, Capture(func() { panic(backgroundPanic) }))
+}
+
+func TestInterceptors(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	before := panicsMetric.Value()
+
+	unaryInterceptor := UnaryServerInterceptor()
+	unaryInfo := &grpc.UnaryServerInfo{FullMethod: "/cogmentAPI.ModelRegistrySP/RetrieveModels"}
+	rep, err := unaryInterceptor(context.Background(), nil, unaryInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "rep", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "rep", rep)
+	_, err = unaryInterceptor(context.Background(), nil, unaryInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Errorf(codes.NotFound, "no model")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = unaryInterceptor(context.Background(), nil, unaryInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+		var modelIDs map[string]bool
+		modelIDs["foo"] = true
+		return nil, nil
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, logrus.ErrorLevel, hook.LastEntry().Level)
+	assert.Contains(t, hook.LastEntry().Data["stack"], "TestInterceptors")
+
+	streamInterceptor := StreamServerInterceptor()
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/cogmentAPI.ModelRegistrySP/RetrieveVersionData"}
+	err = streamInterceptor(nil, serverStream{}, streamInfo, func(srv interface{}, stream grpc.ServerStream) error {
+		panic("failure")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, "failure", hook.LastEntry().Data["panic"])
+	assert.Equal(t, before+2, panicsMetric.Value())
+}
@@ -0,0 +1,473 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registryArchive
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/modelIDs"
+	"github.com/sirupsen/logrus"
+)
+
+// FormatVersion is the version of the layout of the archives
+const FormatVersion = 1
+
+// Number of models or versions listed at once while walking the backend
+const pageSize = 100
+
+// Archives are laid out as
+//
+//	models/<escaped model id>/model.json
+//	models/<escaped model id>/versions/<version number>.json
+//	models/<escaped model id>/versions/<version number>.data
+//	...
+//	manifest.json
+//
+// each model entry precedes its versions entries and each version metadata entry precedes its data entry. The
+// manifest is written last, its counts let the import detect a truncated archive.
+const (
+	manifestEntryName = "manifest.json"
+	modelEntryName    = "model.json"
+	modelsDirname     = "models"
+	versionsDirname   = "versions"
+)
+
+type manifest struct {
+	FormatVersion   int       `json:"format_version"`
+	ExportTimestamp time.Time `json:"export_timestamp"`
+	ModelsCount     int       `json:"models_count"`
+	VersionsCount   int       `json:"versions_count"`
+}
+
+type modelEntry struct {
+	ModelID  string            `json:"model_id"`
+	UserData map[string]string `json:"user_data"`
+}
+
+type versionEntry struct {
+	ModelID           string            `json:"model_id"`
+	VersionNumber     uint              `json:"version_number"`
+	CreationTimestamp time.Time         `json:"creation_timestamp"`
+	Archived          bool              `json:"archived"`
+	DataHash          string            `json:"data_hash"`
+	DataSize          int               `json:"data_size"`
+	UserData          map[string]string `json:"user_data"`
+}
+
+// Summary lists the models and versions exported or imported
+type Summary struct {
+	ModelInfos   []backend.ModelInfo
+	VersionInfos []backend.VersionInfo
+}
+
+// InvalidArchiveError is raised when importing an archive that wasn't produced by Export or is truncated
+type InvalidArchiveError struct {
+	Reason string
+}
+
+func (e *InvalidArchiveError) Error() string {
+	return fmt.Sprintf("invalid registry archive, %s", e.Reason)
+}
+
+// ExistingModelError is raised when importing a model that already exists in the backend
+type ExistingModelError struct {
+	ModelID string
+}
+
+func (e *ExistingModelError) Error() string {
+	return fmt.Sprintf("model %q already exists", e.ModelID)
+}
+
+func (e *ExistingModelError) Is(target error) bool {
+	return target == backend.ErrAlreadyExists
+}
+
+func modelDirname(modelID string) string {
+	return path.Join(modelsDirname, url.PathEscape(modelID))
+}
+
+func writeJSONEntry(tw *tar.Writer, name string, modificationTime time.Time, value interface{}) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to serialize %q: %w", name, err)
+	}
+	return writeEntry(tw, name, modificationTime, content)
+}
+
+func writeEntry(tw *tar.Writer, name string, modificationTime time.Time, content []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(content)),
+		Mode:     0644,
+		ModTime:  modificationTime,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write %q: %w", name, err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		return fmt.Errorf("unable to write %q: %w", name, err)
+	}
+	return nil
+}
+
+// Export writes the given models, or every model if none is given, and all their versions to a tar archive
+func Export(b backend.Backend, w io.Writer, modelIDs []string) (Summary, error) {
+	summary := Summary{}
+	exportTimestamp := time.Now()
+	tw := tar.NewWriter(w)
+
+	exportModel := func(modelInfo backend.ModelInfo) error {
+		err := writeJSONEntry(tw, path.Join(modelDirname(modelInfo.ModelID), modelEntryName), exportTimestamp, modelEntry{
+			ModelID:  modelInfo.ModelID,
+			UserData: modelInfo.UserData,
+		})
+		if err != nil {
+			return err
+		}
+		summary.ModelInfos = append(summary.ModelInfos, modelInfo)
+		return exportVersions(b, tw, modelInfo.ModelID, &summary)
+	}
+
+	if len(modelIDs) > 0 {
+		for _, modelID := range modelIDs {
+			modelInfo, err := b.RetrieveModelInfo(modelID)
+			if err != nil {
+				return summary, err
+			}
+			if err := exportModel(modelInfo); err != nil {
+				return summary, err
+			}
+		}
+	} else {
+		for modelOffset := 0; ; modelOffset += pageSize {
+			modelInfos, err := b.ListModels(modelOffset, pageSize)
+			if err != nil {
+				return summary, fmt.Errorf("unable to list models: %w", err)
+			}
+			for _, modelInfo := range modelInfos {
+				if err := exportModel(modelInfo); err != nil {
+					return summary, err
+				}
+			}
+			if len(modelInfos) < pageSize {
+				break
+			}
+		}
+	}
+
+	err := writeJSONEntry(tw, manifestEntryName, exportTimestamp, manifest{
+		FormatVersion:   FormatVersion,
+		ExportTimestamp: exportTimestamp,
+		ModelsCount:     len(summary.ModelInfos),
+		VersionsCount:   len(summary.VersionInfos),
+	})
+	if err != nil {
+		return summary, err
+	}
+	if err := tw.Close(); err != nil {
+		return summary, fmt.Errorf("unable to write the registry archive: %w", err)
+	}
+	return summary, nil
+}
+
+func exportVersions(b backend.Backend, tw *tar.Writer, modelID string, summary *Summary) error {
+	versionsDirname := path.Join(modelDirname(modelID), versionsDirname)
+	for initialVersionNumber := uint(0); ; {
+		versionInfos, err := b.ListModelVersionInfos(modelID, initialVersionNumber, pageSize)
+		if err != nil {
+			return fmt.Errorf("unable to list the versions of model %q: %w", modelID, err)
+		}
+		for _, versionInfo := range versionInfos {
+			data, err := b.RetrieveModelVersionData(modelID, int(versionInfo.VersionNumber))
+			if err != nil {
+				return fmt.Errorf("unable to retrieve version \"%d\" of model %q: %w", versionInfo.VersionNumber, modelID, err)
+			}
+			entryName := path.Join(versionsDirname, fmt.Sprintf("%06d", versionInfo.VersionNumber))
+			err = writeJSONEntry(tw, entryName+".json", versionInfo.CreationTimestamp, versionEntry{
+				ModelID:           modelID,
+				VersionNumber:     versionInfo.VersionNumber,
+				CreationTimestamp: versionInfo.CreationTimestamp,
+				Archived:          versionInfo.Archived,
+				DataHash:          versionInfo.DataHash,
+				DataSize:          len(data),
+				UserData:          versionInfo.UserData,
+			})
+			if err != nil {
+				return err
+			}
+			if err := writeEntry(tw, entryName+".data", versionInfo.CreationTimestamp, data); err != nil {
+				return err
+			}
+			summary.VersionInfos = append(summary.VersionInfos, versionInfo)
+			initialVersionNumber = versionInfo.VersionNumber + 1
+		}
+		if len(versionInfos) < pageSize {
+			return nil
+		}
+	}
+}
+
+func readJSONEntry(tr *tar.Reader, header *tar.Header, value interface{}) error {
+	if err := json.NewDecoder(tr).Decode(value); err != nil {
+		return &InvalidArchiveError{Reason: fmt.Sprintf("unable to parse %q: %s", header.Name, err)}
+	}
+	return nil
+}
+
+// VersionValidator checks a version before it is imported, e.g. its signature
+type VersionValidator func(modelID string, versionArgs backend.VersionArgs) error
+
+// Import creates the models and versions of a tar archive produced by Export, either all of them are imported or none
+//
+// The archived models can't already exist. Versions are created in order, they keep their number unless versions
+// were deleted from the exported models. The model ids that aren't safe for every backend are rejected. If defined,
+// validate is called before creating each version.
+func Import(b backend.Backend, r io.Reader, validate VersionValidator) (Summary, error) {
+	summary := Summary{}
+	err := readArchive(tar.NewReader(r), &backendImporter{b: b, validate: validate}, &summary)
+	if err != nil {
+		rollback(b, summary)
+		return Summary{}, err
+	}
+	return summary, nil
+}
+
+// Verify reads a whole tar archive produced by Export without creating anything, it fails like Import would on an
+// invalid or truncated archive, a data hash mismatch or a version rejected by validate
+//
+// The existence of the archived models isn't checked. The returned summary lists the archived models and versions.
+func Verify(r io.Reader, validate VersionValidator) (Summary, error) {
+	summary := Summary{}
+	err := readArchive(tar.NewReader(r), &archiveVerifier{validate: validate, modelIDs: map[string]bool{}}, &summary)
+	if err != nil {
+		return Summary{}, err
+	}
+	return summary, nil
+}
+
+// archiveVisitor handles the entries of an archive in order
+type archiveVisitor interface {
+	visitModel(entry modelEntry) (backend.ModelInfo, error)
+	visitVersion(entry versionEntry, data io.Reader) (backend.VersionInfo, error)
+}
+
+func readArchive(tr *tar.Reader, visitor archiveVisitor, summary *Summary) error {
+	var pendingVersion *versionEntry
+	var importedManifest *manifest
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return &InvalidArchiveError{Reason: "the archive is truncated"}
+			}
+			return &InvalidArchiveError{Reason: err.Error()}
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if importedManifest != nil {
+			return &InvalidArchiveError{Reason: fmt.Sprintf("unexpected %q after the manifest", header.Name)}
+		}
+
+		switch {
+		case pendingVersion != nil:
+			if !strings.HasSuffix(header.Name, ".data") {
+				return &InvalidArchiveError{Reason: fmt.Sprintf("expecting the data of version \"%d\" of model %q, found %q", pendingVersion.VersionNumber, pendingVersion.ModelID, header.Name)}
+			}
+			if err := modelIDs.CheckPathSafety(pendingVersion.ModelID); err != nil {
+				return &InvalidArchiveError{Reason: err.Error()}
+			}
+			versionInfo, err := visitor.visitVersion(*pendingVersion, tr)
+			if err != nil {
+				return err
+			}
+			summary.VersionInfos = append(summary.VersionInfos, versionInfo)
+			pendingVersion = nil
+		case header.Name == manifestEntryName:
+			importedManifest = &manifest{}
+			if err := readJSONEntry(tr, header, importedManifest); err != nil {
+				return err
+			}
+		case path.Base(header.Name) == modelEntryName:
+			entry := modelEntry{}
+			if err := readJSONEntry(tr, header, &entry); err != nil {
+				return err
+			}
+			if err := modelIDs.CheckPathSafety(entry.ModelID); err != nil {
+				return &InvalidArchiveError{Reason: err.Error()}
+			}
+			modelInfo, err := visitor.visitModel(entry)
+			if err != nil {
+				return err
+			}
+			summary.ModelInfos = append(summary.ModelInfos, modelInfo)
+		case path.Base(path.Dir(header.Name)) == versionsDirname && strings.HasSuffix(header.Name, ".json"):
+			pendingVersion = &versionEntry{}
+			if err := readJSONEntry(tr, header, pendingVersion); err != nil {
+				return err
+			}
+		default:
+			return &InvalidArchiveError{Reason: fmt.Sprintf("unexpected %q", header.Name)}
+		}
+	}
+
+	if importedManifest == nil {
+		return &InvalidArchiveError{Reason: "the manifest is missing, the archive is likely truncated"}
+	}
+	if importedManifest.FormatVersion != FormatVersion {
+		return &InvalidArchiveError{Reason: fmt.Sprintf("unsupported format version %d, expecting %d", importedManifest.FormatVersion, FormatVersion)}
+	}
+	if importedManifest.ModelsCount != len(summary.ModelInfos) || importedManifest.VersionsCount != len(summary.VersionInfos) {
+		return &InvalidArchiveError{Reason: fmt.Sprintf(
+			"the manifest lists %d models and %d versions, %d models and %d versions were found",
+			importedManifest.ModelsCount,
+			importedManifest.VersionsCount,
+			len(summary.ModelInfos),
+			len(summary.VersionInfos),
+		)}
+	}
+	return nil
+}
+
+// versionArgs are the arguments creating an archived version, its data is checked against the archived hash
+func (entry versionEntry) versionArgs() backend.VersionArgs {
+	return backend.VersionArgs{
+		CreationTimestamp: entry.CreationTimestamp,
+		Archived:          entry.Archived,
+		DataHash:          entry.DataHash,
+		UserData:          entry.UserData,
+	}
+}
+
+// backendImporter creates the archived models and versions in a backend
+type backendImporter struct {
+	b        backend.Backend
+	validate VersionValidator
+}
+
+func (i *backendImporter) visitModel(entry modelEntry) (backend.ModelInfo, error) {
+	hasModel, err := i.b.HasModel(entry.ModelID)
+	if err != nil {
+		return backend.ModelInfo{}, fmt.Errorf("unable to check the existence of model %q: %w", entry.ModelID, err)
+	}
+	if hasModel {
+		return backend.ModelInfo{}, &ExistingModelError{ModelID: entry.ModelID}
+	}
+	modelInfo, err := i.b.CreateOrUpdateModel(backend.ModelInfo{ModelID: entry.ModelID, UserData: entry.UserData})
+	if err != nil {
+		return backend.ModelInfo{}, fmt.Errorf("unable to create model %q: %w", entry.ModelID, err)
+	}
+	return modelInfo, nil
+}
+
+func (i *backendImporter) visitVersion(entry versionEntry, data io.Reader) (backend.VersionInfo, error) {
+	versionArgs := entry.versionArgs()
+	if i.validate != nil {
+		if err := i.validate(entry.ModelID, versionArgs); err != nil {
+			return backend.VersionInfo{}, err
+		}
+	}
+	writer, err := i.b.CreateOrUpdateModelVersionStream(entry.ModelID, versionArgs)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return backend.VersionInfo{}, &InvalidArchiveError{Reason: fmt.Sprintf("version \"%d\" of model %q precedes its model", entry.VersionNumber, entry.ModelID)}
+		}
+		return backend.VersionInfo{}, fmt.Errorf("unable to create version \"%d\" of model %q: %w", entry.VersionNumber, entry.ModelID, err)
+	}
+	if _, err := io.Copy(writer, data); err != nil {
+		_ = writer.Abort()
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return backend.VersionInfo{}, &InvalidArchiveError{Reason: "the archive is truncated"}
+		}
+		return backend.VersionInfo{}, fmt.Errorf("unable to write version \"%d\" of model %q: %w", entry.VersionNumber, entry.ModelID, err)
+	}
+	versionInfo, err := writer.Commit()
+	if err != nil {
+		return backend.VersionInfo{}, err
+	}
+	return versionInfo, nil
+}
+
+// archiveVerifier checks the archived models and versions without creating them
+type archiveVerifier struct {
+	validate VersionValidator
+	modelIDs map[string]bool
+}
+
+func (v *archiveVerifier) visitModel(entry modelEntry) (backend.ModelInfo, error) {
+	if v.modelIDs[entry.ModelID] {
+		return backend.ModelInfo{}, &InvalidArchiveError{Reason: fmt.Sprintf("model %q is archived twice", entry.ModelID)}
+	}
+	v.modelIDs[entry.ModelID] = true
+	return backend.ModelInfo{ModelID: entry.ModelID, UserData: entry.UserData}, nil
+}
+
+func (v *archiveVerifier) visitVersion(entry versionEntry, data io.Reader) (backend.VersionInfo, error) {
+	if !v.modelIDs[entry.ModelID] {
+		return backend.VersionInfo{}, &InvalidArchiveError{Reason: fmt.Sprintf("version \"%d\" of model %q precedes its model", entry.VersionNumber, entry.ModelID)}
+	}
+	versionArgs := entry.versionArgs()
+	if v.validate != nil {
+		if err := v.validate(entry.ModelID, versionArgs); err != nil {
+			return backend.VersionInfo{}, err
+		}
+	}
+	hasher, err := backend.CreateVersionHasher(versionArgs)
+	if err != nil {
+		return backend.VersionInfo{}, &InvalidArchiveError{Reason: err.Error()}
+	}
+	dataSize, err := io.Copy(hasher, data)
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return backend.VersionInfo{}, &InvalidArchiveError{Reason: "the archive is truncated"}
+		}
+		return backend.VersionInfo{}, fmt.Errorf("unable to read version \"%d\" of model %q: %w", entry.VersionNumber, entry.ModelID, err)
+	}
+	dataHash := hasher.Hash()
+	if versionArgs.DataHash != "" && dataHash != versionArgs.DataHash {
+		return backend.VersionInfo{}, &backend.DataHashMismatchError{ModelID: entry.ModelID, ExpectedDataHash: versionArgs.DataHash, DataHash: dataHash}
+	}
+	return backend.VersionInfo{
+		ModelID:           entry.ModelID,
+		VersionNumber:     entry.VersionNumber,
+		CreationTimestamp: entry.CreationTimestamp,
+		Archived:          entry.Archived,
+		DataHash:          dataHash,
+		DataSize:          int(dataSize),
+		UserData:          entry.UserData,
+	}, nil
+}
+
+// rollback deletes the models created by an import that failed, along with their versions
+func rollback(b backend.Backend, summary Summary) {
+	for _, modelInfo := range summary.ModelInfos {
+		if err := b.DeleteModel(modelInfo.ModelID); err != nil {
+			logrus.WithField("model_id", modelInfo.ModelID).WithError(err).Error("unable to rollback the import of a model")
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registryArchive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+var creationTimestamp = time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func createBackend(t *testing.T) backend.Backend {
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(b.Destroy)
+	return b
+}
+
+func createExportedBackend(t *testing.T) backend.Backend {
+	b := createBackend(t)
+	for _, modelID := range []string{"foo", "bar"} {
+		_, err := b.CreateOrUpdateModel(backend.ModelInfo{ModelID: modelID, UserData: map[string]string{"team": modelID}})
+		assert.NoError(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+			CreationTimestamp: creationTimestamp.Add(time.Duration(i) * time.Hour),
+			Archived:          i == 0,
+			DataHash:          backend.ComputeSHA256Hash(data[i:]),
+			Data:              data[i:],
+			UserData:          map[string]string{"step": string(rune('0' + i))},
+		})
+		assert.NoError(t, err)
+	}
+	return b
+}
+
+func TestExportImport(t *testing.T) {
+	exportedBackend := createExportedBackend(t)
+	archive := bytes.Buffer{}
+	summary, err := Export(exportedBackend, &archive, nil)
+	assert.NoError(t, err)
+	assert.Len(t, summary.ModelInfos, 2)
+	assert.Len(t, summary.VersionInfos, 3)
+
+	importedBackend := createBackend(t)
+	summary, err = Import(importedBackend, bytes.NewReader(archive.Bytes()), nil)
+	assert.NoError(t, err)
+	assert.Len(t, summary.ModelInfos, 2)
+	assert.Len(t, summary.VersionInfos, 3)
+
+	for _, modelID := range []string{"foo", "bar"} {
+		exportedModelInfo, err := exportedBackend.RetrieveModelInfo(modelID)
+		assert.NoError(t, err)
+		importedModelInfo, err := importedBackend.RetrieveModelInfo(modelID)
+		assert.NoError(t, err)
+		assert.Equal(t, exportedModelInfo, importedModelInfo)
+
+		exportedVersionInfos, err := exportedBackend.ListModelVersionInfos(modelID, 0, -1)
+		assert.NoError(t, err)
+		importedVersionInfos, err := importedBackend.ListModelVersionInfos(modelID, 0, -1)
+		assert.NoError(t, err)
+		assert.Len(t, importedVersionInfos, len(exportedVersionInfos))
+		for index, exportedVersionInfo := range exportedVersionInfos {
+			importedVersionInfo := importedVersionInfos[index]
+			assert.Equal(t, exportedVersionInfo.VersionNumber, importedVersionInfo.VersionNumber)
+			assert.True(t, exportedVersionInfo.CreationTimestamp.Equal(importedVersionInfo.CreationTimestamp))
+			assert.Equal(t, exportedVersionInfo.Archived, importedVersionInfo.Archived)
+			assert.Equal(t, exportedVersionInfo.DataHash, importedVersionInfo.DataHash)
+			assert.Equal(t, exportedVersionInfo.UserData, importedVersionInfo.UserData)
+
+			importedData, err := importedBackend.RetrieveModelVersionData(modelID, int(importedVersionInfo.VersionNumber))
+			assert.NoError(t, err)
+			assert.Equal(t, data[index:], importedData)
+		}
+	}
+
+	// Importing again fails as the models exist, the existing models are left untouched
+	_, err = Import(importedBackend, bytes.NewReader(archive.Bytes()), nil)
+	assert.IsType(t, &ExistingModelError{}, err)
+	versionInfos, err := importedBackend.ListModelVersionInfos("foo", 0, -1)
+	assert.NoError(t, err)
+	assert.Len(t, versionInfos, 3)
+}
+
+func TestExportModels(t *testing.T) {
+	exportedBackend := createExportedBackend(t)
+	archive := bytes.Buffer{}
+	summary, err := Export(exportedBackend, &archive, []string{"bar"})
+	assert.NoError(t, err)
+	assert.Equal(t, []backend.ModelInfo{{ModelID: "bar", UserData: map[string]string{"team": "bar"}}}, summary.ModelInfos)
+	assert.Empty(t, summary.VersionInfos)
+
+	_, err = Export(exportedBackend, &bytes.Buffer{}, []string{"baz"})
+	assert.IsType(t, &backend.UnknownModelError{}, err)
+}
+
+func TestImportRollback(t *testing.T) {
+	exportedBackend := createExportedBackend(t)
+	archive := bytes.Buffer{}
+	_, err := Export(exportedBackend, &archive, nil)
+	assert.NoError(t, err)
+
+	{
+		// Truncated archive
+		importedBackend := createBackend(t)
+		_, err = Import(importedBackend, bytes.NewReader(archive.Bytes()[:archive.Len()/2]), nil)
+		assert.IsType(t, &InvalidArchiveError{}, err)
+		modelInfos, err := importedBackend.ListModels(0, -1)
+		assert.NoError(t, err)
+		assert.Empty(t, modelInfos)
+	}
+	{
+		// Corrupted version data
+		corruptedArchive := bytes.Replace(archive.Bytes(), data[2:], bytes.ToUpper(data[2:]), 1)
+		assert.NotEqual(t, archive.Bytes(), corruptedArchive)
+		importedBackend := createBackend(t)
+		_, err = Import(importedBackend, bytes.NewReader(corruptedArchive), nil)
+		assert.IsType(t, &backend.DataHashMismatchError{}, err)
+		modelInfos, err := importedBackend.ListModels(0, -1)
+		assert.NoError(t, err)
+		assert.Empty(t, modelInfos)
+	}
+	{
+		// Version rejected by the validator
+		importedBackend := createBackend(t)
+		rejectionError := errors.New("rejected")
+		_, err = Import(importedBackend, bytes.NewReader(archive.Bytes()), func(modelID string, versionArgs backend.VersionArgs) error {
+			if versionArgs.UserData["step"] == "2" {
+				return rejectionError
+			}
+			return nil
+		})
+		assert.Equal(t, rejectionError, err)
+		modelInfos, err := importedBackend.ListModels(0, -1)
+		assert.NoError(t, err)
+		assert.Empty(t, modelInfos)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	exportedBackend := createExportedBackend(t)
+	archive := bytes.Buffer{}
+	_, err := Export(exportedBackend, &archive, nil)
+	assert.NoError(t, err)
+
+	summary, err := Verify(bytes.NewReader(archive.Bytes()), nil)
+	assert.NoError(t, err)
+	assert.Len(t, summary.ModelInfos, 2)
+	assert.Len(t, summary.VersionInfos, 3)
+	assert.Equal(t, backend.ComputeSHA256Hash(data[1:]), summary.VersionInfos[1].DataHash)
+	assert.Equal(t, len(data[1:]), summary.VersionInfos[1].DataSize)
+
+	_, err = Verify(bytes.NewReader(archive.Bytes()[:archive.Len()/2]), nil)
+	assert.IsType(t, &InvalidArchiveError{}, err)
+	corruptedArchive := bytes.Replace(archive.Bytes(), data[2:], bytes.ToUpper(data[2:]), 1)
+	_, err = Verify(bytes.NewReader(corruptedArchive), nil)
+	assert.IsType(t, &backend.DataHashMismatchError{}, err)
+	rejectionError := errors.New("rejected")
+	_, err = Verify(bytes.NewReader(archive.Bytes()), func(modelID string, versionArgs backend.VersionArgs) error {
+		return rejectionError
+	})
+	assert.Equal(t, rejectionError, err)
+}
+
+func TestImportUnsafeModelID(t *testing.T) {
+	archive := bytes.Buffer{}
+	tw := tar.NewWriter(&archive)
+	assert.NoError(t, writeJSONEntry(tw, path.Join(modelsDirname, "escaped", modelEntryName), creationTimestamp, modelEntry{ModelID: "../foo"}))
+	assert.NoError(t, writeJSONEntry(tw, manifestEntryName, creationTimestamp, manifest{FormatVersion: FormatVersion, ModelsCount: 1}))
+	assert.NoError(t, tw.Close())
+
+	parentDirname := t.TempDir()
+	rootDirname := path.Join(parentDirname, "root")
+	assert.NoError(t, os.Mkdir(rootDirname, 0o755))
+	b, err := fs.CreateBackend(rootDirname)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	// Nothing is written outside of the root directory of the backend
+	_, err = Import(b, bytes.NewReader(archive.Bytes()), nil)
+	assert.IsType(t, &InvalidArchiveError{}, err)
+	entries, err := os.ReadDir(parentDirname)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/cogment/cogment-model-registry/authorization"
+	"github.com/cogment/cogment-model-registry/configuration"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+	"github.com/cogment/cogment-model-registry/logging"
+	"github.com/cogment/cogment-model-registry/retention"
+)
+
+// reloader applies the reloadable settings of the configuration while the server runs, see configuration.IsReloadable
+type reloader struct {
+	filename             string
+	initial              *viper.Viper                       // Configuration the server started with
+	modelRegistryServers []*grpcservers.ModelRegistryServer // The default tenant's one, then the other tenants' ones
+	policies             *authorization.PolicyStore         // Nil when the authorization is disabled
+
+	mutex      sync.Mutex
+	collectors []*retention.Collector // Empty until the backends are ready or when the retention is disabled
+}
+
+func (r *reloader) addCollector(collector *retention.Collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.collectors = append(r.collectors, collector)
+}
+
+// reload loads the configuration again and applies its reloadable settings, nothing is applied if any of them is invalid
+func (r *reloader) reload() error {
+	current := viper.New()
+	err := configuration.Load(current, r.filename)
+	if err != nil {
+		return fmt.Errorf("unable to reload the configuration: %w", err)
+	}
+
+	reloadedSettings := []string{}
+	for _, key := range configuration.Changes(r.initial, current) {
+		if configuration.IsReloadable(key) {
+			reloadedSettings = append(reloadedSettings, key)
+		} else {
+			logrus.Warnf("COGMENT_MODEL_REGISTRY_%s changed, restart the server to apply it", key)
+		}
+	}
+
+	var policy *authorization.Policy
+	policyFilename := current.GetString("AUTHORIZATION_POLICY_FILE")
+	if r.policies != nil && policyFilename != "" {
+		policy, err = authorization.LoadPolicy(policyFilename)
+		if err != nil {
+			return fmt.Errorf("unable to reload the configuration: %w", err)
+		}
+	} else if (r.policies != nil) != (policyFilename != "") {
+		logrus.Warnf("COGMENT_MODEL_REGISTRY_AUTHORIZATION_POLICY_FILE can't enable or disable the authorization without a restart")
+	}
+
+	err = logging.Configure(logging.Configuration{
+		Level:  current.GetString("LOG_LEVEL"),
+		Format: current.GetString("LOG_FORMAT"),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to reload the configuration: %w", err)
+	}
+	if policy != nil {
+		r.policies.SetPolicy(policy)
+		logrus.Infof("Authorization policy reloaded from %q with %d tokens", policyFilename, len(policy.Tokens))
+	}
+	for _, modelRegistryServer := range r.modelRegistryServers {
+		modelRegistryServer.SetSentModelVersionDataChunkSize(current.GetInt("SENT_MODEL_VERSION_DATA_CHUNK_SIZE"))
+	}
+	r.mutex.Lock()
+	for _, collector := range r.collectors {
+		collector.SetDefaultPolicy(retention.Policy{
+			MaxAge:   current.GetDuration("RETENTION_MAX_AGE"),
+			MaxCount: current.GetInt("RETENTION_MAX_COUNT"),
+		})
+		collector.SetDryRun(current.GetBool("RETENTION_DRY_RUN"))
+	}
+	r.mutex.Unlock()
+
+	logrus.WithField("changed_settings", reloadedSettings).Info("Configuration reloaded")
+	return nil
+}
@@ -0,0 +1,457 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/client"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+)
+
+// Number of models or versions listed at once while walking the follower backend
+const pageSize = 100
+
+// Metrics published by every follower under `/debug/vars`
+var (
+	syncsMetric              = expvar.NewInt("replication_syncs")
+	appliedEventsMetric      = expvar.NewInt("replication_applied_events")
+	replicatedVersionsMetric = expvar.NewInt("replication_replicated_versions")
+	replicatedBytesMetric    = expvar.NewInt("replication_replicated_bytes")
+)
+
+type Configuration struct {
+	ResyncInterval   time.Duration // Delay between two full synchronizations while following, 0 only synchronizes when connecting
+	ReconnectBackoff time.Duration // Delay before following the primary again after a failure
+}
+
+// Publisher is notified of the changes applied by a follower to its backend, e.g. to notify the watchers of the follower
+type Publisher interface {
+	PublishModelEvent(eventType extensionsapi.ModelEventType, modelInfo backend.ModelInfo)
+	PublishVersionEvent(eventType extensionsapi.VersionEventType, versionInfo backend.VersionInfo)
+}
+
+// SyncReport counts the changes made by a full synchronization
+type SyncReport struct {
+	CreatedModels      int
+	UpdatedModels      int
+	DeletedModels      int
+	ReplicatedVersions int // Versions whose data was copied from the primary
+	UpdatedVersions    int
+	DeletedVersions    int
+}
+
+type Follower struct {
+	backend       backend.Backend
+	client        *client.Client
+	publisher     Publisher
+	configuration Configuration
+}
+
+// CreateFollower creates a follower replicating in a backend the models and versions of the primary the client is
+// connected to, the publisher is optional
+func CreateFollower(b backend.Backend, c *client.Client, publisher Publisher, configuration Configuration) *Follower {
+	return &Follower{
+		backend:       b,
+		client:        c,
+		publisher:     publisher,
+		configuration: configuration,
+	}
+}
+
+// Run follows the primary until the context is done, following it again after the configured backoff when it fails
+func (f *Follower) Run(ctx context.Context) {
+	for {
+		err := f.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logrus.WithError(err).Warn("Replication interrupted, following the primary again")
+		timer := time.NewTimer(f.configuration.ReconnectBackoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// follow watches the primary, synchronizes the whole registry then applies the changes as they are made
+func (f *Follower) follow(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Watching before synchronizing makes sure no change made in between is missed, applying an already synchronized
+	// change again is harmless
+	watcher, err := f.client.WatchRegistry(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to watch the primary: %w", err)
+	}
+	report, err := f.Sync(ctx)
+	if err != nil {
+		return err
+	}
+	logrus.WithFields(syncReportFields(report)).Info("Replication synchronized with the primary")
+
+	events := make(chan client.RegistryEvent)
+	go func() {
+		defer close(events)
+		for watcher.Next() {
+			select {
+			case events <- watcher.Event():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var resync <-chan time.Time
+	if f.configuration.ResyncInterval > 0 {
+		ticker := time.NewTicker(f.configuration.ResyncInterval)
+		defer ticker.Stop()
+		resync = ticker.C
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				if err := watcher.Err(); err != nil {
+					return fmt.Errorf("unable to watch the primary: %w", err)
+				}
+				return errors.New("the primary ended the watch")
+			}
+			if err := f.apply(ctx, event); err != nil {
+				return err
+			}
+			appliedEventsMetric.Add(1)
+		case <-resync:
+			report, err := f.Sync(ctx)
+			if err != nil {
+				return err
+			}
+			logrus.WithFields(syncReportFields(report)).Debug("Replication synchronized with the primary")
+		}
+	}
+}
+
+// Sync makes the backend match the primary: missing or different models and versions are replicated, and the ones
+// the primary no longer has are deleted
+func (f *Follower) Sync(ctx context.Context) (SyncReport, error) {
+	syncsMetric.Add(1)
+	report := SyncReport{}
+
+	primaryModelIDs := make(map[string]struct{})
+	models := f.client.Models(ctx)
+	for models.Next() {
+		modelInfo := models.ModelInfo()
+		primaryModelIDs[modelInfo.ModelID] = struct{}{}
+		existed, err := f.backend.HasModel(modelInfo.ModelID)
+		if err != nil {
+			return report, fmt.Errorf("unable to retrieve model %q: %w", modelInfo.ModelID, err)
+		}
+		changed, err := f.replicateModel(backend.ModelInfo{ModelID: modelInfo.ModelID, UserData: modelInfo.UserData})
+		if err != nil {
+			return report, err
+		}
+		if changed && existed {
+			report.UpdatedModels++
+		} else if changed {
+			report.CreatedModels++
+		}
+		if err := f.syncModelVersions(ctx, modelInfo.ModelID, &report); err != nil {
+			return report, err
+		}
+	}
+	if err := models.Err(); err != nil {
+		return report, fmt.Errorf("unable to retrieve the models of the primary: %w", err)
+	}
+
+	localModelIDs := []string{}
+	for modelOffset := 0; ; modelOffset += pageSize {
+		modelInfos, err := f.backend.ListModels(modelOffset, pageSize)
+		if err != nil {
+			return report, fmt.Errorf("unable to list models: %w", err)
+		}
+		for _, modelInfo := range modelInfos {
+			localModelIDs = append(localModelIDs, modelInfo.ModelID)
+		}
+		if len(modelInfos) < pageSize {
+			break
+		}
+	}
+	for _, modelID := range localModelIDs {
+		if _, ok := primaryModelIDs[modelID]; ok {
+			continue
+		}
+		if err := f.deleteModel(modelID); err != nil {
+			return report, err
+		}
+		report.DeletedModels++
+	}
+	return report, nil
+}
+
+func (f *Follower) syncModelVersions(ctx context.Context, modelID string, report *SyncReport) error {
+	primaryVersionNumbers := make(map[uint]struct{})
+	versions := f.client.Versions(ctx, modelID)
+	for versions.Next() {
+		versionInfo := versions.VersionInfo()
+		primaryVersionNumbers[versionInfo.VersionNumber] = struct{}{}
+		_, err := f.backend.RetrieveModelVersionInfo(modelID, int(versionInfo.VersionNumber))
+		existed := err == nil
+		changed, err := f.replicateVersion(ctx, versionInfo)
+		if err != nil {
+			return err
+		}
+		if changed && existed {
+			report.UpdatedVersions++
+		} else if changed {
+			report.ReplicatedVersions++
+		}
+	}
+	if err := versions.Err(); err != nil {
+		if isNotFound(err) {
+			// Deleted from the primary in between, the deletion is replicated with the other models
+			return nil
+		}
+		return fmt.Errorf("unable to retrieve the versions of model %q from the primary: %w", modelID, err)
+	}
+
+	localVersionInfos := []backend.VersionInfo{}
+	for initialVersionNumber := uint(0); ; {
+		versionInfos, err := f.backend.ListModelVersionInfos(modelID, initialVersionNumber, pageSize)
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				return nil
+			}
+			return fmt.Errorf("unable to list the versions of model %q: %w", modelID, err)
+		}
+		for _, versionInfo := range versionInfos {
+			localVersionInfos = append(localVersionInfos, versionInfo)
+			initialVersionNumber = versionInfo.VersionNumber + 1
+		}
+		if len(versionInfos) < pageSize {
+			break
+		}
+	}
+	for _, versionInfo := range localVersionInfos {
+		if _, ok := primaryVersionNumbers[versionInfo.VersionNumber]; ok {
+			continue
+		}
+		if err := f.deleteVersion(modelID, versionInfo.VersionNumber); err != nil {
+			return err
+		}
+		report.DeletedVersions++
+	}
+	return nil
+}
+
+func syncReportFields(report SyncReport) logrus.Fields {
+	return logrus.Fields{
+		"created_models":      report.CreatedModels,
+		"updated_models":      report.UpdatedModels,
+		"deleted_models":      report.DeletedModels,
+		"replicated_versions": report.ReplicatedVersions,
+		"updated_versions":    report.UpdatedVersions,
+		"deleted_versions":    report.DeletedVersions,
+	}
+}
+
+func isNotFound(err error) bool {
+	return status.Code(err) == codes.NotFound
+}
+
+func userDataEqual(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if otherValue, ok := b[key]; !ok || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Follower) publishModelEvent(eventType extensionsapi.ModelEventType, modelInfo backend.ModelInfo) {
+	if f.publisher != nil {
+		f.publisher.PublishModelEvent(eventType, modelInfo)
+	}
+}
+
+func (f *Follower) publishVersionEvent(eventType extensionsapi.VersionEventType, versionInfo backend.VersionInfo) {
+	if f.publisher != nil {
+		f.publisher.PublishVersionEvent(eventType, versionInfo)
+	}
+}
+
+// apply applies a change made to the primary to the backend
+func (f *Follower) apply(ctx context.Context, event client.RegistryEvent) error {
+	switch event.Type {
+	case client.ModelCreated, client.ModelUpdated:
+		_, err := f.replicateModel(backend.ModelInfo{ModelID: event.ModelInfo.ModelID, UserData: event.ModelInfo.UserData})
+		return err
+	case client.ModelDeleted:
+		return f.deleteModel(event.ModelInfo.ModelID)
+	case client.VersionCreated, client.VersionUpdated:
+		_, err := f.replicateVersion(ctx, event.VersionInfo)
+		return err
+	case client.VersionDeleted:
+		return f.deleteVersion(event.VersionInfo.ModelID, event.VersionInfo.VersionNumber)
+	}
+	return nil
+}
+
+// replicateModel creates or updates a model unless it is already up to date, it returns whether it changed anything
+func (f *Follower) replicateModel(modelInfo backend.ModelInfo) (bool, error) {
+	localModelInfo, err := f.backend.RetrieveModelInfo(modelInfo.ModelID)
+	existed := err == nil
+	if err != nil {
+		if !errors.As(err, new(*backend.UnknownModelError)) {
+			return false, fmt.Errorf("unable to retrieve model %q: %w", modelInfo.ModelID, err)
+		}
+	}
+	if existed && userDataEqual(localModelInfo.UserData, modelInfo.UserData) {
+		return false, nil
+	}
+	replicatedModelInfo, err := f.backend.CreateOrUpdateModel(modelInfo)
+	if err != nil {
+		return false, fmt.Errorf("unable to replicate model %q: %w", modelInfo.ModelID, err)
+	}
+	if existed {
+		f.publishModelEvent(extensionsapi.ModelEventType_MODEL_UPDATED, replicatedModelInfo)
+	} else {
+		f.publishModelEvent(extensionsapi.ModelEventType_MODEL_CREATED, replicatedModelInfo)
+	}
+	return true, nil
+}
+
+func (f *Follower) deleteModel(modelID string) error {
+	modelInfo, err := f.backend.RetrieveModelInfo(modelID)
+	if err != nil {
+		modelInfo = backend.ModelInfo{ModelID: modelID}
+	}
+	err = f.backend.DeleteModel(modelID)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return nil
+		}
+		return fmt.Errorf("unable to delete model %q: %w", modelID, err)
+	}
+	f.publishModelEvent(extensionsapi.ModelEventType_MODEL_DELETED, modelInfo)
+	return nil
+}
+
+// ensureModel creates the model of a version if it doesn't exist yet, it returns false if the primary no longer has it
+func (f *Follower) ensureModel(ctx context.Context, modelID string) (bool, error) {
+	hasModel, err := f.backend.HasModel(modelID)
+	if err != nil {
+		return false, fmt.Errorf("unable to retrieve model %q: %w", modelID, err)
+	}
+	if hasModel {
+		return true, nil
+	}
+	modelInfo, err := f.client.RetrieveModelInfo(ctx, modelID)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to retrieve model %q from the primary: %w", modelID, err)
+	}
+	_, err = f.replicateModel(backend.ModelInfo{ModelID: modelInfo.ModelID, UserData: modelInfo.UserData})
+	return err == nil, err
+}
+
+// replicateVersion creates a version with the same number, copying its data from the primary, or only updates whether
+// it is archived if the same data is already stored. It returns whether it changed anything.
+func (f *Follower) replicateVersion(ctx context.Context, versionInfo client.VersionInfo) (bool, error) {
+	hasModel, err := f.ensureModel(ctx, versionInfo.ModelID)
+	if err != nil || !hasModel {
+		return false, err
+	}
+
+	localVersionInfo, err := f.backend.RetrieveModelVersionInfo(versionInfo.ModelID, int(versionInfo.VersionNumber))
+	if err == nil && localVersionInfo.DataHash == versionInfo.DataHash && localVersionInfo.CreationTimestamp.Equal(versionInfo.CreationTimestamp) {
+		if localVersionInfo.Archived == versionInfo.Archived {
+			return false, nil
+		}
+		updatedVersionInfo, err := f.backend.UpdateModelVersionArchived(versionInfo.ModelID, int(versionInfo.VersionNumber), versionInfo.Archived)
+		if err != nil {
+			return false, fmt.Errorf("unable to update version \"%d\" of model %q: %w", versionInfo.VersionNumber, versionInfo.ModelID, err)
+		}
+		f.publishVersionEvent(extensionsapi.VersionEventType_VERSION_UPDATED, updatedVersionInfo)
+		return true, nil
+	}
+	if err != nil {
+		if !errors.As(err, new(*backend.UnknownModelVersionError)) {
+			return false, fmt.Errorf("unable to retrieve version \"%d\" of model %q: %w", versionInfo.VersionNumber, versionInfo.ModelID, err)
+		}
+	}
+
+	// The data is verified against the hash of the primary on commit
+	writer, err := f.backend.CreateOrUpdateModelVersionStream(versionInfo.ModelID, backend.VersionArgs{
+		VersionNumber:     versionInfo.VersionNumber,
+		CreationTimestamp: versionInfo.CreationTimestamp,
+		Archived:          versionInfo.Archived,
+		DataHash:          versionInfo.DataHash,
+		UserData:          versionInfo.UserData,
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to replicate version \"%d\" of model %q: %w", versionInfo.VersionNumber, versionInfo.ModelID, err)
+	}
+	dataSize, err := f.client.RetrieveVersionData(ctx, versionInfo.ModelID, int(versionInfo.VersionNumber), writer, false)
+	if err != nil {
+		_ = writer.Abort()
+		if isNotFound(err) {
+			// Deleted from the primary in between
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to retrieve version \"%d\" of model %q from the primary: %w", versionInfo.VersionNumber, versionInfo.ModelID, err)
+	}
+	replicatedVersionInfo, err := writer.Commit()
+	if err != nil {
+		return false, fmt.Errorf("unable to replicate version \"%d\" of model %q: %w", versionInfo.VersionNumber, versionInfo.ModelID, err)
+	}
+	replicatedVersionsMetric.Add(1)
+	replicatedBytesMetric.Add(dataSize)
+	f.publishVersionEvent(extensionsapi.VersionEventType_VERSION_CREATED, replicatedVersionInfo)
+	return true, nil
+}
+
+func (f *Follower) deleteVersion(modelID string, versionNumber uint) error {
+	versionInfo, err := f.backend.RetrieveModelVersionInfo(modelID, int(versionNumber))
+	if err == nil {
+		err = f.backend.DeleteModelVersion(modelID, int(versionNumber))
+	}
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("unable to delete version \"%d\" of model %q: %w", versionNumber, modelID, err)
+	}
+	f.publishVersionEvent(extensionsapi.VersionEventType_VERSION_DELETED, versionInfo)
+	return nil
+}
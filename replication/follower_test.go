@@ -0,0 +1,247 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/client"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+var creationTimestamp = time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// startPrimary starts a model registry server on a local port and returns a client connected to it
+func startPrimary(t *testing.T) (*client.Client, backend.Backend) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	t.Cleanup(server.Stop)
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	t.Cleanup(b.Destroy)
+	modelRegistryServer, err := grpcservers.RegisterModelRegistryServer(server, grpcservers.ModelRegistryServerConfiguration{
+		SentModelVersionDataChunkSize: 16,
+		HashAlgorithm:                 backend.SHA256HashAlgorithm,
+	})
+	assert.NoError(t, err)
+	modelRegistryServer.SetBackend(b)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	c, err := client.CreateClient(context.Background(), client.Configuration{Address: listener.Addr().String()})
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c, b
+}
+
+type publishedEvent struct {
+	modelEventType   extensionsapi.ModelEventType
+	versionEventType extensionsapi.VersionEventType
+	modelID          string
+	versionNumber    uint
+}
+
+type recordingPublisher struct {
+	mutex  sync.Mutex
+	events []publishedEvent
+}
+
+func (p *recordingPublisher) PublishModelEvent(eventType extensionsapi.ModelEventType, modelInfo backend.ModelInfo) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.events = append(p.events, publishedEvent{modelEventType: eventType, modelID: modelInfo.ModelID})
+}
+
+func (p *recordingPublisher) PublishVersionEvent(eventType extensionsapi.VersionEventType, versionInfo backend.VersionInfo) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.events = append(p.events, publishedEvent{versionEventType: eventType, modelID: versionInfo.ModelID, versionNumber: versionInfo.VersionNumber})
+}
+
+func (p *recordingPublisher) published(event publishedEvent) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, publishedEvent := range p.events {
+		if publishedEvent == event {
+			return true
+		}
+	}
+	return false
+}
+
+func createVersion(t *testing.T, b backend.Backend, modelID string, versionNumber uint, archived bool, data []byte) {
+	_, err := b.CreateOrUpdateModelVersion(modelID, backend.VersionArgs{
+		VersionNumber:     versionNumber,
+		CreationTimestamp: creationTimestamp,
+		Archived:          archived,
+		DataHash:          backend.ComputeSHA256Hash(data),
+		Data:              data,
+	})
+	assert.NoError(t, err)
+}
+
+func versionNumbers(t *testing.T, b backend.Backend, modelID string) []uint {
+	versionInfos, err := b.ListModelVersionInfos(modelID, 0, -1)
+	assert.NoError(t, err)
+	versionNumbers := []uint{}
+	for _, versionInfo := range versionInfos {
+		versionNumbers = append(versionNumbers, versionInfo.VersionNumber)
+	}
+	return versionNumbers
+}
+
+func TestSync(t *testing.T) {
+	c, primaryBackend := startPrimary(t)
+	_, err := primaryBackend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{"team": "a"}})
+	assert.NoError(t, err)
+	createVersion(t, primaryBackend, "foo", 1, true, data)
+	createVersion(t, primaryBackend, "foo", 2, false, data[:10])
+	createVersion(t, primaryBackend, "foo", 3, false, data[:20])
+	_, err = primaryBackend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "bar"})
+	assert.NoError(t, err)
+
+	followerBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer followerBackend.Destroy()
+	// Stale state: an unknown model, outdated user data, a different version and one the primary no longer has
+	_, err = followerBackend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "stale"})
+	assert.NoError(t, err)
+	_, err = followerBackend.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{"team": "b"}})
+	assert.NoError(t, err)
+	createVersion(t, followerBackend, "foo", 1, false, data)
+	createVersion(t, followerBackend, "foo", 2, false, data[:5])
+	createVersion(t, followerBackend, "foo", 4, false, data)
+
+	publisher := &recordingPublisher{}
+	follower := CreateFollower(followerBackend, c, publisher, Configuration{})
+	report, err := follower.Sync(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, SyncReport{
+		CreatedModels:      1,
+		UpdatedModels:      1,
+		DeletedModels:      1,
+		ReplicatedVersions: 1,
+		UpdatedVersions:    2,
+		DeletedVersions:    1,
+	}, report)
+
+	modelInfo, err := followerBackend.RetrieveModelInfo("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "a"}, modelInfo.UserData)
+	hasModel, err := followerBackend.HasModel("stale")
+	assert.NoError(t, err)
+	assert.False(t, hasModel)
+	hasModel, err = followerBackend.HasModel("bar")
+	assert.NoError(t, err)
+	assert.True(t, hasModel)
+
+	assert.Equal(t, []uint{1, 2, 3}, versionNumbers(t, followerBackend, "foo"))
+	versionInfo, err := followerBackend.RetrieveModelVersionInfo("foo", 1)
+	assert.NoError(t, err)
+	assert.True(t, versionInfo.Archived)
+	for versionNumber, versionData := range map[int][]byte{2: data[:10], 3: data[:20]} {
+		replicatedData, err := followerBackend.RetrieveModelVersionData("foo", versionNumber)
+		assert.NoError(t, err)
+		assert.Equal(t, versionData, replicatedData)
+	}
+	assert.True(t, publisher.published(publishedEvent{versionEventType: extensionsapi.VersionEventType_VERSION_UPDATED, modelID: "foo", versionNumber: 1}))
+	assert.True(t, publisher.published(publishedEvent{modelEventType: extensionsapi.ModelEventType_MODEL_DELETED, modelID: "stale"}))
+
+	// An up to date follower isn't changed
+	report, err = follower.Sync(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, SyncReport{}, report)
+}
+
+func TestRun(t *testing.T) {
+	c, _ := startPrimary(t)
+	ctx := context.Background()
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, client.ModelInfo{ModelID: "foo"}))
+	_, err := c.CreateVersion(ctx, "foo", client.VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	followerBackend, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer followerBackend.Destroy()
+	publisher := &recordingPublisher{}
+	follower := CreateFollower(followerBackend, c, publisher, Configuration{ReconnectBackoff: 10 * time.Millisecond})
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go follower.Run(runCtx)
+
+	hasVersions := func(modelID string, expectedVersionNumbers ...uint) func() bool {
+		return func() bool {
+			versionInfos, err := followerBackend.ListModelVersionInfos(modelID, 0, -1)
+			if err != nil || len(versionInfos) != len(expectedVersionNumbers) {
+				return false
+			}
+			for index, versionInfo := range versionInfos {
+				if versionInfo.VersionNumber != expectedVersionNumbers[index] {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	assert.Eventually(t, hasVersions("foo", 1), time.Second, 10*time.Millisecond)
+
+	// Changes made once the follower is synchronized are applied as they are made
+	_, err = c.CreateVersion(ctx, "foo", client.VersionArgs{UserData: map[string]string{"step": "10"}}, bytes.NewReader(data[:10]))
+	assert.NoError(t, err)
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, client.ModelInfo{ModelID: "bar"}))
+	_, err = c.CreateVersion(ctx, "bar", client.VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Eventually(t, hasVersions("foo", 1, 2), time.Second, 10*time.Millisecond)
+	assert.Eventually(t, hasVersions("bar", 1), time.Second, 10*time.Millisecond)
+	versionInfo, err := followerBackend.RetrieveModelVersionInfo("foo", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"step": "10"}, versionInfo.UserData)
+	assert.True(t, publisher.published(publishedEvent{versionEventType: extensionsapi.VersionEventType_VERSION_CREATED, modelID: "foo", versionNumber: 2}))
+
+	_, err = c.DeleteVersion(ctx, "foo", 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, c.DeleteModel(ctx, "bar"))
+	assert.Eventually(t, hasVersions("foo", 2), time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		hasModel, err := followerBackend.HasModel("bar")
+		return err == nil && !hasModel
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestReadOnly(t *testing.T) {
+	assert.NoError(t, checkReadOnly("/cogmentAPI.ModelRegistrySP/RetrieveVersionData"))
+	assert.NoError(t, checkReadOnly("/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/WatchRegistry"))
+	assert.NoError(t, checkReadOnly("/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(checkReadOnly("/cogmentAPI.ModelRegistrySP/CreateVersion")))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(checkReadOnly("/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/DeleteVersion")))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(checkReadOnly("/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/ImportRegistry")))
+}
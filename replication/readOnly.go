@@ -0,0 +1,54 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/authorization"
+)
+
+// checkReadOnly rejects the methods requiring another scope than read, the changes of a follower come from its primary
+func checkReadOnly(method string) error {
+	scope, ok := authorization.RequiredScope(method)
+	if ok && scope != authorization.ReadScope {
+		return status.Errorf(codes.FailedPrecondition, "method %q is not available on a follower, use the primary", method)
+	}
+	return nil
+}
+
+// ReadOnlyUnaryServerInterceptor rejects the unary RPCs changing the models or versions
+func ReadOnlyUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkReadOnly(info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// ReadOnlyStreamServerInterceptor rejects the streaming RPCs changing the models or versions
+func ReadOnlyStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkReadOnly(info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
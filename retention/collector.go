@@ -0,0 +1,369 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retention
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/sirupsen/logrus"
+)
+
+// Model user data keys overriding the retention policy of its versions
+const (
+	MaxAgeUserDataKey   = "cogment_model_registry.retention_max_age"
+	MaxCountUserDataKey = "cogment_model_registry.retention_max_count"
+)
+
+// Version user data key set on the versions locked by the registry, they are never collected
+const versionLockedUserDataKey = "cogment_model_registry.locked"
+
+// Number of models or versions listed at once while walking the backend
+const pageSize = 100
+
+var collectedVersionsMetric = expvar.NewInt("retention_collected_versions")
+
+// Policy defines which non-archived versions are kept, a zero value disables the corresponding limit. Locked versions
+// are always kept and don't count in the limits.
+type Policy struct {
+	MaxAge   time.Duration // Non-archived versions created before are deleted
+	MaxCount int           // Only the latest non-archived versions are kept
+}
+
+type Configuration struct {
+	Interval      time.Duration // Delay between two collections
+	DefaultPolicy Policy        // Policy of the models not overriding it
+	DryRun        bool          // Collections only report the versions beyond their policy without deleting them
+	// InUse tells whether a version is in use, e.g. leased by a consumer or depended upon by other versions, these
+	// versions are never collected. Every version is collectable when nil.
+	InUse func(modelID string, versionNumber uint) bool
+	// LockInUse, if defined, locks a model from the check of whether one of its versions is in use until the version
+	// is deleted, for it not to start being used in between
+	LockInUse func(modelID string) func()
+}
+
+// CollectedVersion is a version deleted by a collection, or that would be deleted in dry run mode
+type CollectedVersion struct {
+	ModelID       string
+	VersionNumber uint
+	DataSize      int
+}
+
+// CollectionReport summarizes one collection of the backend or of a model
+type CollectionReport struct {
+	DryRun            bool
+	CollectedVersions []CollectedVersion
+	ReclaimedBytes    int64 // Total size of the data of the collected versions
+}
+
+func (r *CollectionReport) add(versionInfo backend.VersionInfo) {
+	r.CollectedVersions = append(r.CollectedVersions, CollectedVersion{
+		ModelID:       versionInfo.ModelID,
+		VersionNumber: versionInfo.VersionNumber,
+		DataSize:      versionInfo.DataSize,
+	})
+	r.ReclaimedBytes += int64(versionInfo.DataSize)
+}
+
+// InvalidPolicyError is raised when a model user data defines an invalid retention policy
+type InvalidPolicyError struct {
+	ModelID string
+	Key     string
+	Value   string
+}
+
+func (e *InvalidPolicyError) Error() string {
+	return fmt.Sprintf("invalid retention policy for model %q, %q is %q", e.ModelID, e.Key, e.Value)
+}
+
+// ModelPolicy resolves the policy of a model from its user data, falling back to the default policy
+func ModelPolicy(modelInfo backend.ModelInfo, defaultPolicy Policy) (Policy, error) {
+	policy := defaultPolicy
+	if value, ok := modelInfo.UserData[MaxAgeUserDataKey]; ok {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge < 0 {
+			return Policy{}, &InvalidPolicyError{ModelID: modelInfo.ModelID, Key: MaxAgeUserDataKey, Value: value}
+		}
+		policy.MaxAge = maxAge
+	}
+	if value, ok := modelInfo.UserData[MaxCountUserDataKey]; ok {
+		maxCount, err := strconv.Atoi(value)
+		if err != nil || maxCount < 0 {
+			return Policy{}, &InvalidPolicyError{ModelID: modelInfo.ModelID, Key: MaxCountUserDataKey, Value: value}
+		}
+		policy.MaxCount = maxCount
+	}
+	return policy, nil
+}
+
+type Collector struct {
+	backend       backend.Backend
+	configuration Configuration
+	mutex         sync.Mutex      // Guards the default policy and dry run mode of the configuration and the pending models
+	pendingModels map[string]bool // Models having new versions, collected by Run as soon as possible
+	pending       chan struct{}   // Signals Run that models are pending
+}
+
+// CreateCollector creates a collector deleting the non-archived versions of a backend that are beyond their retention policy
+func CreateCollector(b backend.Backend, configuration Configuration) *Collector {
+	return &Collector{
+		backend:       b,
+		configuration: configuration,
+		pendingModels: make(map[string]bool),
+		pending:       make(chan struct{}, 1),
+	}
+}
+
+// VersionCreated schedules the collection of the model of a created version, the versions it pushes beyond the
+// retention policy are deleted by Run without waiting for the next collection
+func (c *Collector) VersionCreated(versionInfo backend.VersionInfo) {
+	c.mutex.Lock()
+	c.pendingModels[versionInfo.ModelID] = true
+	c.mutex.Unlock()
+	select {
+	case c.pending <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Collector) takePendingModels() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	modelIDs := make([]string, 0, len(c.pendingModels))
+	for modelID := range c.pendingModels {
+		modelIDs = append(modelIDs, modelID)
+	}
+	c.pendingModels = make(map[string]bool)
+	return modelIDs
+}
+
+// SetDefaultPolicy changes the policy of the models not overriding it, starting with the next collection
+func (c *Collector) SetDefaultPolicy(policy Policy) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.configuration.DefaultPolicy = policy
+}
+
+func (c *Collector) defaultPolicy() Policy {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.configuration.DefaultPolicy
+}
+
+// SetDryRun changes whether Collect and CollectModel delete the versions, starting with the next collection
+func (c *Collector) SetDryRun(dryRun bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.configuration.DryRun = dryRun
+}
+
+func (c *Collector) dryRun() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.configuration.DryRun
+}
+
+func logReport(log *logrus.Entry, report CollectionReport) {
+	if !report.DryRun {
+		log.WithField("collected_versions", len(report.CollectedVersions)).Info("Retention collection deleted non-archived versions")
+		return
+	}
+	for _, collectedVersion := range report.CollectedVersions {
+		log.WithFields(logrus.Fields{
+			"model_id":       collectedVersion.ModelID,
+			"version_number": collectedVersion.VersionNumber,
+			"data_size":      collectedVersion.DataSize,
+		}).Info("Retention collection would delete a non-archived version")
+	}
+}
+
+// Run collects the backend every configured interval, and the models having new versions as they are created, until
+// the context is done
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.configuration.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.pending:
+			for _, modelID := range c.takePendingModels() {
+				report, err := c.CollectModelReport(modelID, time.Now(), c.dryRun())
+				if err != nil {
+					logrus.WithField("model_id", modelID).WithError(err).Error("Retention collection failed")
+				} else if len(report.CollectedVersions) > 0 {
+					logReport(logrus.WithField("model_id", modelID), report)
+				}
+			}
+		case <-ticker.C:
+			report, err := c.CollectReport(time.Now(), c.dryRun())
+			if err != nil {
+				logrus.WithError(err).Error("Retention collection failed")
+			} else if len(report.CollectedVersions) > 0 {
+				logReport(logrus.NewEntry(logrus.StandardLogger()), report)
+			}
+		}
+	}
+}
+
+// Collect deletes the non-archived versions beyond their model's policy at the given time and returns how many were
+// deleted, or would be deleted in dry run mode
+//
+// The latest version of a model is never deleted.
+func (c *Collector) Collect(now time.Time) (int, error) {
+	report, err := c.CollectReport(now, c.dryRun())
+	return len(report.CollectedVersions), err
+}
+
+// CollectReport deletes the non-archived versions beyond their model's policy at the given time, or only reports them
+// when dryRun is set, regardless of the configured mode
+func (c *Collector) CollectReport(now time.Time, dryRun bool) (CollectionReport, error) {
+	report := CollectionReport{DryRun: dryRun}
+	defaultPolicy := c.defaultPolicy()
+	for modelOffset := 0; ; modelOffset += pageSize {
+		modelInfos, err := c.backend.ListModels(modelOffset, pageSize)
+		if err != nil {
+			return report, fmt.Errorf("unable to list models: %w", err)
+		}
+		for _, modelInfo := range modelInfos {
+			policy, err := ModelPolicy(modelInfo, defaultPolicy)
+			if err != nil {
+				logrus.WithField("model_id", modelInfo.ModelID).WithError(err).Warn("Retention collection skips a model")
+				continue
+			}
+			if err := c.collectModel(modelInfo.ModelID, policy, now, &report); err != nil {
+				return report, err
+			}
+		}
+		// Deleted versions don't shift the models, the offset stays valid
+		if len(modelInfos) < pageSize {
+			return report, nil
+		}
+	}
+}
+
+// CollectModel deletes the non-archived versions of a model beyond its policy at the given time and returns how many
+// were deleted, or would be deleted in dry run mode
+func (c *Collector) CollectModel(modelID string, now time.Time) (int, error) {
+	report, err := c.CollectModelReport(modelID, now, c.dryRun())
+	return len(report.CollectedVersions), err
+}
+
+// CollectModelReport deletes the non-archived versions of a model beyond its policy at the given time, or only reports
+// them when dryRun is set, regardless of the configured mode
+func (c *Collector) CollectModelReport(modelID string, now time.Time, dryRun bool) (CollectionReport, error) {
+	report := CollectionReport{DryRun: dryRun}
+	modelInfo, err := c.backend.RetrieveModelInfo(modelID)
+	if err != nil {
+		if errors.As(err, new(*backend.UnknownModelError)) {
+			return report, nil
+		}
+		return report, fmt.Errorf("unable to retrieve model %q: %w", modelID, err)
+	}
+	policy, err := ModelPolicy(modelInfo, c.defaultPolicy())
+	if err != nil {
+		logrus.WithField("model_id", modelID).WithError(err).Warn("Retention collection skips a model")
+		return report, nil
+	}
+	err = c.collectModel(modelID, policy, now, &report)
+	return report, err
+}
+
+func (c *Collector) collectModel(modelID string, policy Policy, now time.Time, report *CollectionReport) error {
+	if policy.MaxAge == 0 && policy.MaxCount == 0 {
+		return nil
+	}
+
+	collectableVersionInfos := []backend.VersionInfo{}
+	for initialVersionNumber := uint(0); ; {
+		versionInfos, err := c.backend.ListModelVersionInfos(modelID, initialVersionNumber, pageSize)
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				// Deleted during the collection
+				return nil
+			}
+			return fmt.Errorf("unable to list the versions of model %q: %w", modelID, err)
+		}
+		for _, versionInfo := range versionInfos {
+			if _, locked := versionInfo.UserData[versionLockedUserDataKey]; !versionInfo.Archived && !locked {
+				collectableVersionInfos = append(collectableVersionInfos, versionInfo)
+			}
+			initialVersionNumber = versionInfo.VersionNumber + 1
+		}
+		if len(versionInfos) < pageSize {
+			break
+		}
+	}
+	latestVersionNumber, err := c.latestVersionNumber(modelID)
+	if err != nil || latestVersionNumber == 0 {
+		return err
+	}
+
+	for index, versionInfo := range collectableVersionInfos {
+		if versionInfo.VersionNumber == latestVersionNumber {
+			continue
+		}
+		beyondMaxCount := policy.MaxCount > 0 && len(collectableVersionInfos)-index > policy.MaxCount
+		beyondMaxAge := policy.MaxAge > 0 && now.Sub(versionInfo.CreationTimestamp) > policy.MaxAge
+		if !beyondMaxCount && !beyondMaxAge {
+			continue
+		}
+		unlock := func() {}
+		if c.configuration.LockInUse != nil {
+			unlock = c.configuration.LockInUse(modelID)
+		}
+		if c.configuration.InUse != nil && c.configuration.InUse(modelID, versionInfo.VersionNumber) {
+			unlock()
+			logrus.WithFields(logrus.Fields{"model_id": modelID, "version_number": versionInfo.VersionNumber}).Warn("Retention collection skips a version in use")
+			continue
+		}
+		if report.DryRun {
+			unlock()
+			report.add(versionInfo)
+			continue
+		}
+		err := c.backend.DeleteModelVersion(modelID, int(versionInfo.VersionNumber))
+		unlock()
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelVersionError)) {
+				continue
+			}
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				return nil
+			}
+			return fmt.Errorf("unable to delete version \"%d\" of model %q: %w", versionInfo.VersionNumber, modelID, err)
+		}
+		report.add(versionInfo)
+		collectedVersionsMetric.Add(1)
+	}
+	return nil
+}
+
+func (c *Collector) latestVersionNumber(modelID string) (uint, error) {
+	versionInfo, err := c.backend.RetrieveModelVersionInfo(modelID, -1)
+	if err != nil {
+		if errors.Is(err, backend.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("unable to retrieve the latest version of model %q: %w", modelID, err)
+	}
+	return versionInfo.VersionNumber, nil
+}
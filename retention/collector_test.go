@@ -0,0 +1,235 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+var now = time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// createVersions creates versions of a model created every hour until `now`, the second one being archived
+func createVersions(t *testing.T, b backend.Backend, modelInfo backend.ModelInfo, count int) {
+	_, err := b.CreateOrUpdateModel(modelInfo)
+	assert.NoError(t, err)
+	for i := 0; i < count; i++ {
+		_, err := b.CreateOrUpdateModelVersion(modelInfo.ModelID, backend.VersionArgs{
+			CreationTimestamp: now.Add(-time.Duration(count-1-i) * time.Hour),
+			Archived:          i == 1,
+			DataHash:          backend.ComputeSHA256Hash(data),
+			Data:              data,
+		})
+		assert.NoError(t, err)
+	}
+}
+
+func versionNumbers(t *testing.T, b backend.Backend, modelID string) []uint {
+	versionInfos, err := b.ListModelVersionInfos(modelID, 0, -1)
+	assert.NoError(t, err)
+	versionNumbers := []uint{}
+	for _, versionInfo := range versionInfos {
+		versionNumbers = append(versionNumbers, versionInfo.VersionNumber)
+	}
+	return versionNumbers
+}
+
+func TestCollect(t *testing.T) {
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	createVersions(t, b, backend.ModelInfo{ModelID: "count"}, 5)
+	createVersions(t, b, backend.ModelInfo{ModelID: "age", UserData: map[string]string{MaxAgeUserDataKey: "90m", MaxCountUserDataKey: "0"}}, 5)
+	createVersions(t, b, backend.ModelInfo{ModelID: "invalid", UserData: map[string]string{MaxCountUserDataKey: "-1"}}, 5)
+
+	collector := CreateCollector(b, Configuration{Interval: time.Hour, DefaultPolicy: Policy{MaxCount: 2}})
+	collectedVersions, err := collector.Collect(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, collectedVersions)
+
+	// The latest 2 non-archived versions and the archived one are kept
+	assert.Equal(t, []uint{2, 4, 5}, versionNumbers(t, b, "count"))
+	// The non-archived versions created more than 90 minutes ago are deleted
+	assert.Equal(t, []uint{2, 4, 5}, versionNumbers(t, b, "age"))
+	// Models with an invalid policy are left untouched
+	assert.Equal(t, []uint{1, 2, 3, 4, 5}, versionNumbers(t, b, "invalid"))
+
+	collectedVersions, err = collector.Collect(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, collectedVersions)
+}
+
+func TestCollectKeepsLatestVersion(t *testing.T) {
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	createVersions(t, b, backend.ModelInfo{ModelID: "foo"}, 3)
+
+	collector := CreateCollector(b, Configuration{Interval: time.Hour, DefaultPolicy: Policy{MaxAge: time.Minute}})
+	collectedVersions, err := collector.Collect(now.Add(24 * time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, collectedVersions)
+	assert.Equal(t, []uint{2, 3}, versionNumbers(t, b, "foo"))
+}
+
+func TestCollectKeepsLockedVersions(t *testing.T) {
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	createVersions(t, b, backend.ModelInfo{ModelID: "foo"}, 5)
+	_, err = b.UpdateModelVersionUserData("foo", 1, map[string]string{versionLockedUserDataKey: "true"})
+	assert.NoError(t, err)
+
+	collector := CreateCollector(b, Configuration{Interval: time.Hour, DefaultPolicy: Policy{MaxCount: 1}})
+	collectedVersions, err := collector.Collect(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, collectedVersions)
+	// The locked version, the archived one and the latest one are kept
+	assert.Equal(t, []uint{1, 2, 5}, versionNumbers(t, b, "foo"))
+}
+
+func TestCollectKeepsVersionsInUse(t *testing.T) {
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	createVersions(t, b, backend.ModelInfo{ModelID: "foo"}, 5)
+
+	locked := false
+	collector := CreateCollector(b, Configuration{
+		Interval:      time.Hour,
+		DefaultPolicy: Policy{MaxCount: 1},
+		InUse: func(modelID string, versionNumber uint) bool {
+			assert.True(t, locked)
+			return modelID == "foo" && versionNumber == 3
+		},
+		// The model stays locked until the version is deleted
+		LockInUse: func(modelID string) func() {
+			assert.False(t, locked)
+			locked = true
+			return func() { locked = false }
+		},
+	})
+	collectedVersions, err := collector.Collect(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, collectedVersions)
+	assert.Equal(t, []uint{2, 3, 5}, versionNumbers(t, b, "foo"))
+	assert.False(t, locked)
+}
+
+func TestVersionCreated(t *testing.T) {
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	createVersions(t, b, backend.ModelInfo{ModelID: "foo", UserData: map[string]string{MaxCountUserDataKey: "2"}}, 4)
+	createVersions(t, b, backend.ModelInfo{ModelID: "bar", UserData: map[string]string{MaxCountUserDataKey: "2"}}, 4)
+
+	collectedVersions, err := CreateCollector(b, Configuration{Interval: time.Hour}).CollectModel("unknown", now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, collectedVersions)
+
+	// Only the model of the created version is collected, without waiting for the interval
+	collector := CreateCollector(b, Configuration{Interval: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go collector.Run(ctx)
+	versionInfo, err := b.RetrieveModelVersionInfo("foo", -1)
+	assert.NoError(t, err)
+	collector.VersionCreated(versionInfo)
+	assert.Eventually(t, func() bool {
+		return len(versionNumbers(t, b, "foo")) == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []uint{2, 3, 4}, versionNumbers(t, b, "foo"))
+	assert.Equal(t, []uint{1, 2, 3, 4}, versionNumbers(t, b, "bar"))
+}
+
+func TestSetDefaultPolicy(t *testing.T) {
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	createVersions(t, b, backend.ModelInfo{ModelID: "foo"}, 5)
+
+	collector := CreateCollector(b, Configuration{Interval: time.Hour})
+	collectedVersions, err := collector.Collect(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, collectedVersions)
+
+	collector.SetDefaultPolicy(Policy{MaxCount: 1})
+	collectedVersions, err = collector.Collect(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, collectedVersions)
+	assert.Equal(t, []uint{2, 5}, versionNumbers(t, b, "foo"))
+}
+
+func TestCollectReportDryRun(t *testing.T) {
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	createVersions(t, b, backend.ModelInfo{ModelID: "foo"}, 4)
+
+	collector := CreateCollector(b, Configuration{Interval: time.Hour, DefaultPolicy: Policy{MaxCount: 1}, DryRun: true})
+	collectedVersions, err := collector.Collect(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, collectedVersions)
+
+	// Dry runs only report the versions that would be deleted
+	report, err := collector.CollectReport(now, true)
+	assert.NoError(t, err)
+	assert.Equal(t, CollectionReport{
+		DryRun: true,
+		CollectedVersions: []CollectedVersion{
+			{ModelID: "foo", VersionNumber: 1, DataSize: len(data)},
+			{ModelID: "foo", VersionNumber: 3, DataSize: len(data)},
+		},
+		ReclaimedBytes: int64(2 * len(data)),
+	}, report)
+	assert.Equal(t, []uint{1, 2, 3, 4}, versionNumbers(t, b, "foo"))
+
+	report, err = collector.CollectModelReport("foo", now, false)
+	assert.NoError(t, err)
+	assert.False(t, report.DryRun)
+	assert.Len(t, report.CollectedVersions, 2)
+	assert.Equal(t, int64(2*len(data)), report.ReclaimedBytes)
+	assert.Equal(t, []uint{2, 4}, versionNumbers(t, b, "foo"))
+}
+
+func TestModelPolicy(t *testing.T) {
+	defaultPolicy := Policy{MaxAge: time.Hour, MaxCount: 10}
+
+	policy, err := ModelPolicy(backend.ModelInfo{ModelID: "foo"}, defaultPolicy)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultPolicy, policy)
+
+	policy, err = ModelPolicy(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{MaxAgeUserDataKey: "24h"}}, defaultPolicy)
+	assert.NoError(t, err)
+	assert.Equal(t, Policy{MaxAge: 24 * time.Hour, MaxCount: 10}, policy)
+
+	_, err = ModelPolicy(backend.ModelInfo{ModelID: "foo", UserData: map[string]string{MaxAgeUserDataKey: "tomorrow"}}, defaultPolicy)
+	assert.Error(t, err)
+	assert.IsType(t, &InvalidPolicyError{}, err)
+}
@@ -4,7 +4,8 @@ set -o errexit
 
 MODEL_REGISTRY_DIR="$(dirname "${BASH_SOURCE[0]}")/.."
 PROTOS_RELATIVE_PATH="grpcapi"
-API_PACKAGE="github.com/cogment/cogment-model-registry/${API_RELATIVE_PATH}"
+API_PACKAGE="github.com/cogment/cogment-model-registry/${PROTOS_RELATIVE_PATH}/cogment/api"
+EXTENSIONS_PROTOS_RELATIVE_PATH="api"
 
 cd "${MODEL_REGISTRY_DIR}"
 
@@ -38,3 +39,22 @@ protoc --go_out=${PROTOS_RELATIVE_PATH} --go-grpc_out=${PROTOS_RELATIVE_PATH} \
   --go_opt=Mcogment/api/model_registry.proto="${API_PACKAGE}" \
   --go-grpc_opt=Mcogment/api/model_registry.proto="${API_PACKAGE}" \
   cogment/api/model_registry.proto
+
+protoc --go_out=${PROTOS_RELATIVE_PATH} --go-grpc_out=${PROTOS_RELATIVE_PATH} \
+  --proto_path=${PROTOS_RELATIVE_PATH} \
+  --go_opt=paths=source_relative \
+  --go-grpc_opt=paths=source_relative \
+  --go_opt=Mcogment/api/common.proto="${API_PACKAGE}" \
+  --go-grpc_opt=Mcogment/api/common.proto="${API_PACKAGE}" \
+  --go_opt=Mcogment/api/discovery.proto="${API_PACKAGE}" \
+  --go-grpc_opt=Mcogment/api/discovery.proto="${API_PACKAGE}" \
+  cogment/api/common.proto cogment/api/discovery.proto
+
+protoc --go_out=${PROTOS_RELATIVE_PATH} --go-grpc_out=${PROTOS_RELATIVE_PATH} \
+  --proto_path=${PROTOS_RELATIVE_PATH} \
+  --proto_path=${EXTENSIONS_PROTOS_RELATIVE_PATH} \
+  --go_opt=paths=source_relative \
+  --go-grpc_opt=paths=source_relative \
+  --go_opt=Mcogment/api/model_registry.proto="${API_PACKAGE}" \
+  --go-grpc_opt=Mcogment/api/model_registry.proto="${API_PACKAGE}" \
+  extensions/model_registry_extensions.proto
@@ -0,0 +1,246 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scrubber
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/sirupsen/logrus"
+)
+
+// Number of models or versions listed at once while walking the backend
+const pageSize = 100
+
+// Metrics published by every scrubber under `/debug/vars`
+var (
+	scansMetric             = expvar.NewInt("scrubber_scans")
+	scannedVersionsMetric   = expvar.NewInt("scrubber_scanned_versions")
+	scannedBytesMetric      = expvar.NewInt("scrubber_scanned_bytes")
+	corruptedVersionsMetric = expvar.NewInt("scrubber_corrupted_versions")
+	missingVersionsMetric   = expvar.NewInt("scrubber_missing_versions")
+)
+
+type Configuration struct {
+	Interval          time.Duration // Delay between the start of two scans
+	MaxBytesPerSecond int64         // Maximum rate at which versions data is read, 0 means unlimited
+	WebhookURL        string        // If defined, each problem is POSTed as JSON to this URL
+}
+
+// ProblemKind is the kind of problem detected by the scrubber
+type ProblemKind string
+
+const (
+	CorruptedVersion ProblemKind = "corrupted" // The data doesn't match the hash of the version
+	MissingVersion   ProblemKind = "missing"   // The data can't be retrieved
+)
+
+// Problem describes a stored version whose data is corrupted or missing
+type Problem struct {
+	Kind          ProblemKind `json:"kind"`
+	ModelID       string      `json:"model_id"`
+	VersionNumber uint        `json:"version_number"`
+	DataHash      string      `json:"data_hash"`
+	Error         string      `json:"error,omitempty"`
+	DetectedAt    time.Time   `json:"detected_at"`
+}
+
+// ScanReport summarizes one scan of the backend
+type ScanReport struct {
+	ScannedVersions int
+	ScannedBytes    int64
+	Problems        []Problem
+}
+
+type Scrubber struct {
+	backend       backend.Backend
+	configuration Configuration
+	httpClient    *http.Client
+}
+
+// CreateScrubber creates a scrubber checking the data of the versions stored in a backend against their hash
+func CreateScrubber(b backend.Backend, configuration Configuration) *Scrubber {
+	return &Scrubber{
+		backend:       b,
+		configuration: configuration,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run scans the backend every configured interval until the context is done
+func (s *Scrubber) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.configuration.Interval)
+	defer ticker.Stop()
+	for {
+		report, err := s.Scan(ctx)
+		if err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Error("Scrubber scan failed")
+		} else if err == nil {
+			logrus.WithFields(logrus.Fields{
+				"scanned_versions": report.ScannedVersions,
+				"scanned_bytes":    report.ScannedBytes,
+				"problems":         len(report.Problems),
+			}).Info("Scrubber scan completed")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan checks every stored version once, respecting the configured rate
+func (s *Scrubber) Scan(ctx context.Context) (ScanReport, error) {
+	scansMetric.Add(1)
+	report := ScanReport{}
+	startTime := time.Now()
+	for modelOffset := 0; ; modelOffset += pageSize {
+		modelInfos, err := s.backend.ListModels(modelOffset, pageSize)
+		if err != nil {
+			return report, fmt.Errorf("unable to list models: %w", err)
+		}
+		for _, modelInfo := range modelInfos {
+			if err := s.scanModel(ctx, modelInfo.ModelID, startTime, &report); err != nil {
+				return report, err
+			}
+		}
+		if len(modelInfos) < pageSize {
+			return report, nil
+		}
+	}
+}
+
+func (s *Scrubber) scanModel(ctx context.Context, modelID string, startTime time.Time, report *ScanReport) error {
+	for initialVersionNumber := uint(0); ; {
+		versionInfos, err := s.backend.ListModelVersionInfos(modelID, initialVersionNumber, pageSize)
+		if err != nil {
+			if errors.As(err, new(*backend.UnknownModelError)) {
+				// Deleted during the scan
+				return nil
+			}
+			return fmt.Errorf("unable to list the versions of model %q: %w", modelID, err)
+		}
+		for _, versionInfo := range versionInfos {
+			if err := s.throttle(ctx, startTime, report.ScannedBytes); err != nil {
+				return err
+			}
+			problem, dataSize := s.scanVersion(versionInfo)
+			report.ScannedVersions++
+			report.ScannedBytes += int64(dataSize)
+			scannedVersionsMetric.Add(1)
+			scannedBytesMetric.Add(int64(dataSize))
+			if problem != nil {
+				report.Problems = append(report.Problems, *problem)
+				s.reportProblem(*problem)
+			}
+			initialVersionNumber = versionInfo.VersionNumber + 1
+		}
+		if len(versionInfos) < pageSize {
+			return nil
+		}
+	}
+}
+
+// scanVersion checks the data of a version, a problem is only reported if the version wasn't deleted or updated in between
+func (s *Scrubber) scanVersion(versionInfo backend.VersionInfo) (*Problem, int) {
+	data, err := s.backend.RetrieveModelVersionData(versionInfo.ModelID, int(versionInfo.VersionNumber))
+	problem := Problem{
+		ModelID:       versionInfo.ModelID,
+		VersionNumber: versionInfo.VersionNumber,
+		DataHash:      versionInfo.DataHash,
+	}
+	if err != nil {
+		problem.Kind = MissingVersion
+		problem.Error = err.Error()
+	} else {
+		matches, err := backend.VerifyDataHash(versionInfo.DataHash, data)
+		if err == nil && matches {
+			return nil, len(data)
+		}
+		problem.Kind = CorruptedVersion
+		if err != nil {
+			problem.Error = err.Error()
+		}
+	}
+
+	currentVersionInfo, err := s.backend.RetrieveModelVersionInfo(versionInfo.ModelID, int(versionInfo.VersionNumber))
+	if err != nil || currentVersionInfo.DataHash != versionInfo.DataHash || !currentVersionInfo.CreationTimestamp.Equal(versionInfo.CreationTimestamp) {
+		return nil, len(data)
+	}
+	problem.DetectedAt = time.Now()
+	return &problem, len(data)
+}
+
+// throttle waits until reading the scanned bytes since the start took at least the time allowed by the configured rate
+func (s *Scrubber) throttle(ctx context.Context, startTime time.Time, scannedBytes int64) error {
+	if s.configuration.MaxBytesPerSecond <= 0 {
+		return ctx.Err()
+	}
+	minimumDuration := time.Duration(float64(scannedBytes) / float64(s.configuration.MaxBytesPerSecond) * float64(time.Second))
+	wait := time.Until(startTime.Add(minimumDuration))
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (s *Scrubber) reportProblem(problem Problem) {
+	switch problem.Kind {
+	case CorruptedVersion:
+		corruptedVersionsMetric.Add(1)
+		logrus.WithFields(logrus.Fields{"model_id": problem.ModelID, "version_number": problem.VersionNumber, "data_hash": problem.DataHash}).Error("Scrubber detected version data not matching its hash")
+	case MissingVersion:
+		missingVersionsMetric.Add(1)
+		logrus.WithFields(logrus.Fields{"model_id": problem.ModelID, "version_number": problem.VersionNumber, "error": problem.Error}).Error("Scrubber is unable to retrieve the data of a version")
+	}
+
+	if s.configuration.WebhookURL == "" {
+		return
+	}
+	if err := s.postProblem(problem); err != nil {
+		logrus.WithError(err).Warn("Scrubber is unable to notify the webhook")
+	}
+}
+
+func (s *Scrubber) postProblem(problem Problem) error {
+	body, err := json.Marshal(problem)
+	if err != nil {
+		return fmt.Errorf("unable to serialize the problem: %w", err)
+	}
+	rep, err := s.httpClient.Post(s.configuration.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to post to %q: %w", s.configuration.WebhookURL, err)
+	}
+	defer rep.Body.Close()
+	if rep.StatusCode < 200 || rep.StatusCode >= 300 {
+		return fmt.Errorf("unable to post to %q: unexpected status %q", s.configuration.WebhookURL, rep.Status)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scrubber
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+func TestScan(t *testing.T) {
+	rootDirname := t.TempDir()
+	b, err := fs.CreateBackend(rootDirname)
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	for _, dataHash := range []string{backend.ComputeSHA256Hash(data), backend.ComputeSHA256Hash(data[:10]), backend.ComputeSHA256Hash(data)} {
+		_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+			CreationTimestamp: time.Now(),
+			Archived:          true,
+			DataHash:          dataHash,
+			Data:              data,
+		})
+		assert.NoError(t, err)
+	}
+	// Version 2 is corrupted, removing the data of version 3
+	err = os.Remove(filepath.Join(rootDirname, "foo", "foo-v000003.data"))
+	assert.NoError(t, err)
+
+	var mutex sync.Mutex
+	postedProblems := []Problem{}
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem := Problem{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&problem))
+		mutex.Lock()
+		defer mutex.Unlock()
+		postedProblems = append(postedProblems, problem)
+	}))
+	defer webhook.Close()
+
+	scrubber := CreateScrubber(b, Configuration{Interval: time.Hour, WebhookURL: webhook.URL})
+	report, err := scrubber.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.ScannedVersions)
+	assert.Equal(t, int64(2*len(data)), report.ScannedBytes)
+	assert.Len(t, report.Problems, 2)
+	assert.Equal(t, CorruptedVersion, report.Problems[0].Kind)
+	assert.Equal(t, uint(2), report.Problems[0].VersionNumber)
+	assert.Equal(t, MissingVersion, report.Problems[1].Kind)
+	assert.Equal(t, uint(3), report.Problems[1].VersionNumber)
+	assert.NotEmpty(t, report.Problems[1].Error)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Len(t, postedProblems, 2)
+	assert.Equal(t, "foo", postedProblems[0].ModelID)
+	assert.Equal(t, CorruptedVersion, postedProblems[0].Kind)
+}
+
+func TestScanRate(t *testing.T) {
+	b, err := fs.CreateBackend(t.TempDir())
+	assert.NoError(t, err)
+	defer b.Destroy()
+
+	_, err = b.CreateOrUpdateModel(backend.ModelInfo{ModelID: "foo"})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := b.CreateOrUpdateModelVersion("foo", backend.VersionArgs{
+			CreationTimestamp: time.Now(),
+			Archived:          true,
+			DataHash:          backend.ComputeSHA256Hash(data),
+			Data:              data,
+		})
+		assert.NoError(t, err)
+	}
+
+	// Reading the first 2 versions should take at least 200ms
+	scrubber := CreateScrubber(b, Configuration{Interval: time.Hour, MaxBytesPerSecond: int64(len(data) * 10)})
+	startTime := time.Now()
+	report, err := scrubber.Scan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.ScannedVersions)
+	assert.Empty(t, report.Problems)
+	assert.GreaterOrEqual(t, int64(time.Since(startTime)), int64(200*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = scrubber.Scan(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+	"github.com/cogment/cogment-model-registry/logging"
+	"github.com/cogment/cogment-model-registry/recovery"
+)
+
+// Default size of the data chunks sent by the registry, the default of COGMENT_MODEL_REGISTRY_SENT_MODEL_VERSION_DATA_CHUNK_SIZE
+const defaultSentModelVersionDataChunkSize = 1024 * 1024 * 5
+
+type Configuration struct {
+	Backend       backend.Backend                              // Storage of the models, the registry doesn't destroy it
+	ModelRegistry grpcservers.ModelRegistryServerConfiguration // Defaults to 5 MB sent chunks and SHA-256 hashes
+	ServerOptions []grpc.ServerOption                          // Options of the gRPC server created by Serve
+}
+
+// Registry is a model registry embedded in another Go service
+type Registry struct {
+	configuration       Configuration
+	modelRegistryServer *grpcservers.ModelRegistryServer // Registered on every gRPC server
+	mutex               sync.Mutex
+	grpcServer          *grpc.Server // Created by Serve, nil before
+	shutdown            bool
+}
+
+// CreateRegistry creates a registry storing its models in the configured backend
+func CreateRegistry(configuration Configuration) (*Registry, error) {
+	if configuration.Backend == nil {
+		return nil, fmt.Errorf("unable to create the registry: no backend defined")
+	}
+	if configuration.ModelRegistry.SentModelVersionDataChunkSize <= 0 {
+		configuration.ModelRegistry.SentModelVersionDataChunkSize = defaultSentModelVersionDataChunkSize
+	}
+	if configuration.ModelRegistry.HashAlgorithm.Name == "" {
+		configuration.ModelRegistry.HashAlgorithm = backend.SHA256HashAlgorithm
+	}
+	modelRegistryServer, err := grpcservers.CreateModelRegistryServer(configuration.ModelRegistry)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the registry: %w", err)
+	}
+	modelRegistryServer.SetBackend(configuration.Backend)
+	return &Registry{configuration: configuration, modelRegistryServer: modelRegistryServer}, nil
+}
+
+// Register registers the services of the registry on an existing gRPC server, stopping it is up to the caller
+//
+// The returned server, the same for every gRPC server, can be used to listen to the changes made to the models and
+// versions.
+func (r *Registry) Register(registrar grpc.ServiceRegistrar) (*grpcservers.ModelRegistryServer, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.shutdown {
+		return nil, fmt.Errorf("unable to register the registry: it is shut down")
+	}
+	r.modelRegistryServer.Register(registrar)
+	return r.modelRegistryServer, nil
+}
+
+// Serve serves the registry on its own gRPC server until Shutdown is called, it then returns nil
+func (r *Registry) Serve(listener net.Listener) error {
+	r.mutex.Lock()
+	if r.grpcServer != nil {
+		r.mutex.Unlock()
+		return fmt.Errorf("unable to serve the registry: it is already served")
+	}
+	if r.shutdown {
+		r.mutex.Unlock()
+		return fmt.Errorf("unable to serve the registry: it is shut down")
+	}
+	serverOptions := append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor(), recovery.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor(), recovery.StreamServerInterceptor()),
+	}, r.configuration.ServerOptions...)
+	grpcServer := grpc.NewServer(serverOptions...)
+	r.grpcServer = grpcServer
+	r.mutex.Unlock()
+
+	if _, err := r.Register(grpcServer); err != nil {
+		return err
+	}
+	if err := grpcServer.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return fmt.Errorf("unable to serve the registry: %w", err)
+	}
+	return nil
+}
+
+// Shutdown ends the ongoing watches and stops the server created by Serve once the in-flight calls finish, they are
+// canceled when the context is done first
+func (r *Registry) Shutdown(ctx context.Context) error {
+	r.mutex.Lock()
+	r.shutdown = true
+	grpcServer := r.grpcServer
+	r.mutex.Unlock()
+
+	// The watches never finish by themselves
+	r.modelRegistryServer.Shutdown()
+	if grpcServer == nil {
+		return nil
+	}
+	gracefullyStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(gracefullyStopped)
+	}()
+	select {
+	case <-gracefullyStopped:
+		return nil
+	case <-ctx.Done():
+		grpcServer.Stop()
+		return ctx.Err()
+	}
+}
+
+// PublishVersion creates a version of a model in process, see grpcservers.ModelRegistryServer.PublishVersion
+func (r *Registry) PublishVersion(ctx context.Context, modelID string, versionArgs grpcservers.PublishedVersionArgs, data io.Reader) (backend.VersionInfo, error) {
+	return r.modelRegistryServer.PublishVersion(ctx, modelID, versionArgs, data)
+}
+
+// SubscribeVersions subscribes in process to the versions of a model, see grpcservers.ModelRegistryServer.SubscribeVersions
+func (r *Registry) SubscribeVersions(ctx context.Context, modelID string) (*grpcservers.VersionSubscription, error) {
+	return r.modelRegistryServer.SubscribeVersions(ctx, modelID)
+}
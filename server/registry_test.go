@@ -0,0 +1,145 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	"github.com/cogment/cogment-model-registry/backend/fake"
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+)
+
+var data = []byte("Lorem ipsum dolor sit amet, consectetuer adipiscing elit.")
+
+func connect(t *testing.T, listener net.Listener) *client.Client {
+	c, err := client.CreateClient(context.Background(), client.Configuration{Address: listener.Addr().String()})
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestCreateRegistry(t *testing.T) {
+	_, err := CreateRegistry(Configuration{})
+	assert.Error(t, err)
+}
+
+func TestServe(t *testing.T) {
+	b := fake.CreateBackend()
+	registry, err := CreateRegistry(Configuration{Backend: b})
+	assert.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	served := make(chan error, 1)
+	go func() {
+		served <- registry.Serve(listener)
+	}()
+
+	c := connect(t, listener)
+	ctx := context.Background()
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, client.ModelInfo{ModelID: "foo"}))
+	_, err = c.CreateVersion(ctx, "foo", client.VersionArgs{}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	storedData, err := b.RetrieveModelVersionData("foo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, data, storedData)
+
+	// An ongoing watch doesn't prevent the graceful shutdown
+	watcher, err := c.WatchRegistry(ctx)
+	assert.NoError(t, err)
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	assert.NoError(t, registry.Shutdown(shutdownCtx))
+	assert.False(t, watcher.Next())
+	assert.Error(t, watcher.Err())
+	select {
+	case err := <-served:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Serve didn't return after the shutdown")
+	}
+
+	assert.Error(t, registry.Serve(listener))
+	_, err = registry.Register(grpc.NewServer())
+	assert.Error(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	registry, err := CreateRegistry(Configuration{Backend: fake.CreateBackend()})
+	assert.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	grpcServer := grpc.NewServer()
+	defer grpcServer.Stop()
+	_, err = registry.Register(grpcServer)
+	assert.NoError(t, err)
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+
+	c := connect(t, listener)
+	ctx := context.Background()
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, client.ModelInfo{ModelID: "foo"}))
+	modelInfo, err := c.RetrieveModelInfo(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", modelInfo.ModelID)
+
+	// The server isn't stopped by the registry
+	assert.NoError(t, registry.Shutdown(ctx))
+	_, err = c.RetrieveModelInfo(ctx, "foo")
+	assert.NoError(t, err)
+}
+
+func TestPublishVersion(t *testing.T) {
+	registry, err := CreateRegistry(Configuration{Backend: fake.CreateBackend()})
+	assert.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		_ = registry.Serve(listener)
+	}()
+	defer registry.Shutdown(context.Background())
+
+	c := connect(t, listener)
+	ctx := context.Background()
+	assert.NoError(t, c.CreateOrUpdateModel(ctx, client.ModelInfo{ModelID: "foo"}))
+	subscription, err := registry.SubscribeVersions(ctx, "foo")
+	assert.NoError(t, err)
+	defer subscription.Close()
+	watcher, err := c.WatchRegistry(ctx)
+	assert.NoError(t, err)
+
+	// The versions published in process are received by the subscribers in process and through the API
+	versionInfo, err := registry.PublishVersion(ctx, "foo", grpcservers.PublishedVersionArgs{UserData: map[string]string{"step": "1"}}, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), versionInfo.VersionNumber)
+	assert.True(t, subscription.Next())
+	assert.Equal(t, versionInfo, subscription.VersionInfo())
+	assert.True(t, watcher.Next())
+	assert.Equal(t, client.VersionCreated, watcher.Event().Type)
+	assert.Equal(t, uint(1), watcher.Event().VersionInfo.VersionNumber)
+
+	retrievedData := bytes.Buffer{}
+	_, err = c.RetrieveVersionData(ctx, "foo", 1, &retrievedData, true)
+	assert.NoError(t, err)
+	assert.Equal(t, data, retrievedData.Bytes())
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signature
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Version user data keys holding the signature of the version and the id of the key that produced it
+const (
+	SignatureUserDataKey = "cogment_model_registry.signature"
+	KeyIDUserDataKey     = "cogment_model_registry.signature_key_id"
+)
+
+// MissingSignatureError is raised when a version isn't signed while signatures are required
+type MissingSignatureError struct {
+	ModelID string
+}
+
+func (e *MissingSignatureError) Error() string {
+	return fmt.Sprintf("version of model %q is not signed, %q and %q user data are required", e.ModelID, SignatureUserDataKey, KeyIDUserDataKey)
+}
+
+// InvalidSignatureError is raised when the signature of a version can't be verified
+type InvalidSignatureError struct {
+	ModelID string
+	KeyID   string
+	Reason  string
+}
+
+func (e *InvalidSignatureError) Error() string {
+	return fmt.Sprintf("invalid signature for a version of model %q with key %q, %s", e.ModelID, e.KeyID, e.Reason)
+}
+
+// InvalidPublicKeysError is raised when parsing invalid public keys
+type InvalidPublicKeysError struct {
+	Reason string
+}
+
+func (e *InvalidPublicKeysError) Error() string {
+	return fmt.Sprintf("invalid signature public keys, %s", e.Reason)
+}
+
+// SignedMessage is the message signed for a version, its model id and data hash separated by a newline
+//
+// The registry checks the data of the version against its hash, the signature therefore covers the data.
+func SignedMessage(modelID string, dataHash string) []byte {
+	return []byte(modelID + "\n" + dataHash)
+}
+
+// Sign computes the base64 encoded signature of a version
+func Sign(privateKey ed25519.PrivateKey, modelID string, dataHash string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, SignedMessage(modelID, dataHash)))
+}
+
+// ParsePublicKeys parses a comma separated list of `<key id>:<base64 encoded ed25519 public key>`
+func ParsePublicKeys(spec string) (map[string]ed25519.PublicKey, error) {
+	publicKeys := make(map[string]ed25519.PublicKey)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		separatorIndex := strings.Index(entry, ":")
+		if separatorIndex <= 0 {
+			return nil, &InvalidPublicKeysError{Reason: fmt.Sprintf("entry %q is not formatted as `<key id>:<base64 encoded public key>`", entry)}
+		}
+		keyID := entry[:separatorIndex]
+		publicKey, err := base64.StdEncoding.DecodeString(entry[separatorIndex+1:])
+		if err != nil {
+			return nil, &InvalidPublicKeysError{Reason: fmt.Sprintf("key %q is not base64 encoded", keyID)}
+		}
+		if len(publicKey) != ed25519.PublicKeySize {
+			return nil, &InvalidPublicKeysError{Reason: fmt.Sprintf("key %q is %d bytes long, expecting %d", keyID, len(publicKey), ed25519.PublicKeySize)}
+		}
+		if _, ok := publicKeys[keyID]; ok {
+			return nil, &InvalidPublicKeysError{Reason: fmt.Sprintf("key %q is defined twice", keyID)}
+		}
+		publicKeys[keyID] = ed25519.PublicKey(publicKey)
+	}
+	return publicKeys, nil
+}
+
+// Verifier verifies the ed25519 signatures of the versions against trusted public keys
+type Verifier struct {
+	publicKeys map[string]ed25519.PublicKey
+	required   bool
+}
+
+// CreateVerifier creates a verifier trusting the given public keys indexed by their id,
+// unsigned versions are rejected if signatures are required.
+func CreateVerifier(publicKeys map[string]ed25519.PublicKey, required bool) *Verifier {
+	return &Verifier{
+		publicKeys: publicKeys,
+		required:   required,
+	}
+}
+
+// Verify checks the signature found in the user data of a version, if any
+func (v *Verifier) Verify(modelID string, dataHash string, userData map[string]string) error {
+	encodedSignature, hasSignature := userData[SignatureUserDataKey]
+	keyID, hasKeyID := userData[KeyIDUserDataKey]
+	if !hasSignature && !hasKeyID {
+		if v.required {
+			return &MissingSignatureError{ModelID: modelID}
+		}
+		return nil
+	}
+	if !hasSignature || !hasKeyID {
+		return &InvalidSignatureError{ModelID: modelID, KeyID: keyID, Reason: fmt.Sprintf("both %q and %q user data are required", SignatureUserDataKey, KeyIDUserDataKey)}
+	}
+	if dataHash == "" {
+		return &InvalidSignatureError{ModelID: modelID, KeyID: keyID, Reason: "signed versions require a data hash"}
+	}
+	publicKey, ok := v.publicKeys[keyID]
+	if !ok {
+		return &InvalidSignatureError{ModelID: modelID, KeyID: keyID, Reason: "unknown key"}
+	}
+	signature, err := base64.StdEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return &InvalidSignatureError{ModelID: modelID, KeyID: keyID, Reason: "signature is not base64 encoded"}
+	}
+	if !ed25519.Verify(publicKey, SignedMessage(modelID, dataHash), signature) {
+		return &InvalidSignatureError{ModelID: modelID, KeyID: keyID, Reason: "signature doesn't match"}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signature
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	verifier := CreateVerifier(map[string]ed25519.PublicKey{"trainer": publicKey}, false)
+
+	signature := Sign(privateKey, "foo", "hash")
+	assert.NoError(t, verifier.Verify("foo", "hash", map[string]string{SignatureUserDataKey: signature, KeyIDUserDataKey: "trainer"}))
+	assert.NoError(t, verifier.Verify("foo", "hash", map[string]string{}))
+
+	for _, userData := range []map[string]string{
+		{SignatureUserDataKey: signature},
+		{SignatureUserDataKey: signature, KeyIDUserDataKey: "unknown"},
+		{SignatureUserDataKey: "not base64", KeyIDUserDataKey: "trainer"},
+		{SignatureUserDataKey: Sign(privateKey, "bar", "hash"), KeyIDUserDataKey: "trainer"},
+	} {
+		err := verifier.Verify("foo", "hash", userData)
+		assert.IsType(t, &InvalidSignatureError{}, err, userData)
+	}
+	err = verifier.Verify("foo", "", map[string]string{SignatureUserDataKey: Sign(privateKey, "foo", ""), KeyIDUserDataKey: "trainer"})
+	assert.IsType(t, &InvalidSignatureError{}, err)
+
+	requiringVerifier := CreateVerifier(map[string]ed25519.PublicKey{"trainer": publicKey}, true)
+	err = requiringVerifier.Verify("foo", "hash", map[string]string{})
+	assert.IsType(t, &MissingSignatureError{}, err)
+}
+
+func TestParsePublicKeys(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	publicKeys, err := ParsePublicKeys("trainer:" + base64.StdEncoding.EncodeToString(publicKey))
+	assert.NoError(t, err)
+	assert.Equal(t, publicKey, publicKeys["trainer"])
+
+	for _, spec := range []string{
+		"",
+		":" + base64.StdEncoding.EncodeToString(publicKey),
+		"trainer:not-base64",
+		"trainer:" + base64.StdEncoding.EncodeToString(publicKey[:16]),
+		"trainer:" + base64.StdEncoding.EncodeToString(publicKey) + ",trainer:" + base64.StdEncoding.EncodeToString(publicKey),
+	} {
+		_, err := ParsePublicKeys(spec)
+		assert.IsType(t, &InvalidPublicKeysError{}, err, spec)
+	}
+}
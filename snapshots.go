@@ -0,0 +1,70 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/registryArchive"
+)
+
+// parseServerFlags parses the flags the server accepts in place of their setting, i.e. `--restore-from`
+func parseServerFlags(args []string) (map[string]string, error) {
+	flags := pflag.NewFlagSet("server", pflag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	restoreFrom := flags.String("restore-from", "", "Snapshot file restored on startup, see COGMENT_MODEL_REGISTRY_RESTORE_FROM")
+	if err := flags.Parse(args); err != nil {
+		return nil, fmt.Errorf("%w\n\nFlags:\n%s", err, flags.FlagUsages())
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %q, the server only accepts flags", flags.Args())
+	}
+	return map[string]string{"RESTORE_FROM": *restoreFrom}, nil
+}
+
+// restoreSnapshot imports the snapshot file defined by RESTORE_FROM into a backend without any model, before the
+// registry serves requests
+func restoreSnapshot(settings *viper.Viper, b backend.Backend, log *logrus.Entry) {
+	filename := settings.GetString("RESTORE_FROM")
+	if filename == "" {
+		return
+	}
+	modelInfos, err := b.ListModels(0, 1)
+	if err != nil {
+		log.Fatalf("unable to list the models before restoring snapshot %q: %v", filename, err)
+	}
+	if len(modelInfos) > 0 {
+		log.Infof("Snapshot %q not restored, the registry already has models", filename)
+		return
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		log.Fatalf("unable to open snapshot %q: %v", filename, err)
+	}
+	defer file.Close()
+	summary, err := registryArchive.Import(b, bufio.NewReader(file), nil)
+	if err != nil {
+		log.Fatalf("unable to restore snapshot %q: %v", filename, err)
+	}
+	log.Infof("Snapshot %q restored with %d models and %d versions", filename, len(summary.ModelInfos), len(summary.VersionInfos))
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenants
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultTenant serves the RPCs not bound to any tenant
+const DefaultTenant = ""
+
+// Router dispatches the RPCs of services implemented once per tenant to the implementation of the tenant of each RPC
+//
+// Each tenant has its own implementations, e.g. a model registry server with its own backend, watches and uploads.
+type Router struct {
+	resolve      func(ctx context.Context) string
+	services     map[string]*routedService
+	serviceNames []string // In registration order
+}
+
+type routedService struct {
+	desc            *grpc.ServiceDesc
+	implementations map[string]interface{} // By tenant
+}
+
+// CreateRouter creates a router resolving the tenant of each RPC from its context, e.g. from its metadata
+//
+// The tenant of unary RPCs is resolved before the interceptors are called, it can't rely on values they add to the context.
+func CreateRouter(resolve func(ctx context.Context) string) *Router {
+	return &Router{
+		resolve:  resolve,
+		services: map[string]*routedService{},
+	}
+}
+
+// tenantRegistrar collects the services of a tenant
+type tenantRegistrar struct {
+	router *Router
+	tenant string
+}
+
+func (r *tenantRegistrar) RegisterService(desc *grpc.ServiceDesc, implementation interface{}) {
+	service, ok := r.router.services[desc.ServiceName]
+	if !ok {
+		service = &routedService{desc: desc, implementations: map[string]interface{}{}}
+		r.router.services[desc.ServiceName] = service
+		r.router.serviceNames = append(r.router.serviceNames, desc.ServiceName)
+	}
+	service.implementations[r.tenant] = implementation
+}
+
+// Registrar is where the services of a tenant are registered, e.g. by `grpcservers.RegisterModelRegistryServer`
+func (r *Router) Registrar(tenant string) grpc.ServiceRegistrar {
+	return &tenantRegistrar{router: r, tenant: tenant}
+}
+
+func (s *routedService) implementation(tenant string) (interface{}, error) {
+	implementation, ok := s.implementations[tenant]
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "tenant %q is not served by %q", tenant, s.desc.ServiceName)
+	}
+	return implementation, nil
+}
+
+// RegisterServices registers the routed services on a server, every service needs to be implemented for the default tenant
+func (r *Router) RegisterServices(server grpc.ServiceRegistrar) error {
+	for _, serviceName := range r.serviceNames {
+		service := r.services[serviceName]
+		defaultImplementation, ok := service.implementations[DefaultTenant]
+		if !ok {
+			return fmt.Errorf("unable to route service %q, it isn't implemented for the default tenant", serviceName)
+		}
+
+		desc := *service.desc
+		desc.Methods = make([]grpc.MethodDesc, 0, len(service.desc.Methods))
+		for _, method := range service.desc.Methods {
+			handler := method.Handler
+			desc.Methods = append(desc.Methods, grpc.MethodDesc{
+				MethodName: method.MethodName,
+				Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+					implementation, err := service.implementation(r.resolve(ctx))
+					if err != nil {
+						return nil, err
+					}
+					return handler(implementation, ctx, dec, interceptor)
+				},
+			})
+		}
+		desc.Streams = make([]grpc.StreamDesc, 0, len(service.desc.Streams))
+		for _, stream := range service.desc.Streams {
+			handler := stream.Handler
+			desc.Streams = append(desc.Streams, grpc.StreamDesc{
+				StreamName:    stream.StreamName,
+				ServerStreams: stream.ServerStreams,
+				ClientStreams: stream.ClientStreams,
+				Handler: func(srv interface{}, stream grpc.ServerStream) error {
+					implementation, err := service.implementation(r.resolve(stream.Context()))
+					if err != nil {
+						return err
+					}
+					return handler(implementation, stream)
+				},
+			})
+		}
+		server.RegisterService(&desc, defaultImplementation)
+	}
+	return nil
+}
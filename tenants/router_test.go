@@ -0,0 +1,128 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenants
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cogment/cogment-model-registry/authorization"
+	"github.com/cogment/cogment-model-registry/backend"
+	"github.com/cogment/cogment-model-registry/backend/fs"
+	"github.com/cogment/cogment-model-registry/client"
+	"github.com/cogment/cogment-model-registry/grpcservers"
+)
+
+// startServer starts a model registry server serving the default tenant and the given ones, each with its own backend
+func startServer(t *testing.T, policies *authorization.PolicyStore, tenants ...string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(authorization.UnaryServerInterceptorFromStore(policies)),
+		grpc.ChainStreamInterceptor(authorization.StreamServerInterceptorFromStore(policies)),
+	)
+	t.Cleanup(server.Stop)
+	router := CreateRouter(policies.Tenant)
+	for _, tenant := range append([]string{DefaultTenant}, tenants...) {
+		b, err := fs.CreateBackend(t.TempDir())
+		assert.NoError(t, err)
+		t.Cleanup(b.Destroy)
+		modelRegistryServer, err := grpcservers.RegisterModelRegistryServer(router.Registrar(tenant), grpcservers.ModelRegistryServerConfiguration{
+			SentModelVersionDataChunkSize: 16,
+			HashAlgorithm:                 backend.SHA256HashAlgorithm,
+		})
+		assert.NoError(t, err)
+		modelRegistryServer.SetBackend(b)
+	}
+	assert.NoError(t, router.RegisterServices(server))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return listener.Addr().String()
+}
+
+func createClient(t *testing.T, address string, token string) *client.Client {
+	c, err := client.CreateClient(context.Background(), client.Configuration{Address: address, Token: token})
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRouter(t *testing.T) {
+	policy, err := authorization.CreatePolicy(map[string][]authorization.Permission{
+		"admin": {{Scopes: []authorization.Scope{authorization.ReadScope, authorization.WriteScope, authorization.DeleteScope}}},
+	}, []authorization.Token{
+		{Name: "default", SHA256: authorization.HashToken("default_token"), Roles: []string{"admin"}},
+		{Name: "a", SHA256: authorization.HashToken("a_token"), Roles: []string{"admin"}, Tenant: "Customer_A"},
+		{Name: "b", SHA256: authorization.HashToken("b_token"), Roles: []string{"admin"}, Tenant: "customer_b"},
+		{Name: "c", SHA256: authorization.HashToken("c_token"), Roles: []string{"admin"}, Tenant: "customer_c"},
+	})
+	assert.NoError(t, err)
+	address := startServer(t, authorization.CreatePolicyStore(policy), "customer_a", "customer_b")
+	ctx := context.Background()
+	defaultClient := createClient(t, address, "default_token")
+	aClient := createClient(t, address, "a_token")
+	bClient := createClient(t, address, "b_token")
+
+	// Unary RPCs
+	assert.NoError(t, aClient.CreateOrUpdateModel(ctx, client.ModelInfo{ModelID: "foo", UserData: map[string]string{"tenant": "a"}}))
+	assert.NoError(t, bClient.CreateOrUpdateModel(ctx, client.ModelInfo{ModelID: "foo", UserData: map[string]string{"tenant": "b"}}))
+	modelInfo, err := aClient.RetrieveModelInfo(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", modelInfo.UserData["tenant"])
+	modelInfo, err = bClient.RetrieveModelInfo(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", modelInfo.UserData["tenant"])
+	_, err = defaultClient.RetrieveModelInfo(ctx, "foo")
+	assert.Error(t, err)
+
+	// Streaming RPCs
+	_, err = aClient.CreateVersion(ctx, "foo", client.VersionArgs{}, bytes.NewReader([]byte("Lorem ipsum dolor sit amet")))
+	assert.NoError(t, err)
+	_, err = bClient.CreateVersion(ctx, "foo", client.VersionArgs{}, bytes.NewReader([]byte("consectetuer adipiscing elit")))
+	assert.NoError(t, err)
+	data := bytes.Buffer{}
+	_, err = aClient.RetrieveVersionData(ctx, "foo", 1, &data, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "Lorem ipsum dolor sit amet", data.String())
+	data.Reset()
+	_, err = bClient.RetrieveVersionData(ctx, "foo", 1, &data, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "consectetuer adipiscing elit", data.String())
+
+	// A tenant without a server
+	cClient := createClient(t, address, "c_token")
+	_, err = cClient.RetrieveModelInfo(ctx, "foo")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Unknown tokens are routed to the default tenant, where they are rejected
+	unknownClient := createClient(t, address, "unknown_token")
+	_, err = unknownClient.RetrieveModelInfo(ctx, "foo")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestUnroutedService(t *testing.T) {
+	router := CreateRouter(func(ctx context.Context) string { return DefaultTenant })
+	_, err := grpcservers.RegisterModelRegistryServer(router.Registrar("customer_a"), grpcservers.ModelRegistryServerConfiguration{})
+	assert.NoError(t, err)
+	assert.Error(t, router.RegisterServices(grpc.NewServer()))
+}
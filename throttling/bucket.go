@@ -0,0 +1,81 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package throttling
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket limiting a rate in bytes per second, allowing bursts of up to one second of traffic
+//
+// Reservations larger than the available tokens are accepted, the next ones then wait until the debt is repaid. This
+// way a message larger than the burst is never rejected.
+type bucket struct {
+	rate float64 // Bytes per second
+
+	mutex    sync.Mutex
+	tokens   float64
+	lastTime time.Time
+}
+
+func createBucket(bytesPerSecond int64, now time.Time) *bucket {
+	return &bucket{
+		rate:     float64(bytesPerSecond),
+		tokens:   float64(bytesPerSecond),
+		lastTime: now,
+	}
+}
+
+// reserve takes n tokens at a given time and returns how long to wait before using them
+func (b *bucket) reserve(n int, now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if elapsed := now.Sub(b.lastTime); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+		b.lastTime = now
+	}
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// idle tells whether the bucket is full at a given time, it then doesn't limit anything
+func (b *bucket) idle(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.tokens+now.Sub(b.lastTime).Seconds()*b.rate >= b.rate
+}
+
+// wait waits for the duration returned by a reservation, unless the context is done first
+func wait(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
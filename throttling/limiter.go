@@ -0,0 +1,175 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package throttling
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Unary method receiving version data, the other uploads are client streams
+const appendChunkMethod = "/cogmentModelRegistryAPI.ModelRegistryExtensionsSP/AppendChunk"
+
+// Metrics published under `/debug/vars`
+var (
+	rejectedUploadsMetric  = expvar.NewInt("throttling_rejected_uploads")
+	throttledUploadsMetric = expvar.NewInt("throttling_throttled_messages")
+)
+
+// Configuration defines the upload limits, a zero value disables the corresponding limit
+type Configuration struct {
+	MaxConcurrentUploads    int   // Uploading streams beyond are rejected
+	MaxBytesPerSecond       int64 // Rate at which data is received from all the clients
+	MaxClientBytesPerSecond int64 // Rate at which data is received from each client
+}
+
+type Limiter struct {
+	configuration Configuration
+	uploads       chan struct{} // Semaphore of the ongoing uploading streams
+	bucket        *bucket
+
+	mutex         sync.Mutex // Guards the buckets of the clients
+	clientBuckets map[string]*bucket
+}
+
+// CreateLimiter creates a limiter of the uploads received by a server
+func CreateLimiter(configuration Configuration) *Limiter {
+	l := &Limiter{
+		configuration: configuration,
+		clientBuckets: make(map[string]*bucket),
+	}
+	if configuration.MaxConcurrentUploads > 0 {
+		l.uploads = make(chan struct{}, configuration.MaxConcurrentUploads)
+	}
+	if configuration.MaxBytesPerSecond > 0 {
+		l.bucket = createBucket(configuration.MaxBytesPerSecond, time.Now())
+	}
+	return l
+}
+
+// clientAddress identifies the client of a request by the host of its peer, a client opening several connections shares its limit
+func clientAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	address := p.Addr.String()
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+func (l *Limiter) clientBucket(client string, now time.Time) *bucket {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	b, ok := l.clientBuckets[client]
+	if !ok {
+		// Full buckets don't limit anything, they are recreated when needed
+		for otherClient, otherBucket := range l.clientBuckets {
+			if otherBucket.idle(now) {
+				delete(l.clientBuckets, otherClient)
+			}
+		}
+		b = createBucket(l.configuration.MaxClientBytesPerSecond, now)
+		l.clientBuckets[client] = b
+	}
+	return b
+}
+
+// throttle waits until receiving size bytes from the request's client respects the configured rates
+func (l *Limiter) throttle(ctx context.Context, size int) error {
+	now := time.Now()
+	delay := time.Duration(0)
+	if l.bucket != nil {
+		delay = l.bucket.reserve(size, now)
+	}
+	if l.configuration.MaxClientBytesPerSecond > 0 {
+		if clientDelay := l.clientBucket(clientAddress(ctx), now).reserve(size, now); clientDelay > delay {
+			delay = clientDelay
+		}
+	}
+	if delay > 0 {
+		throttledUploadsMetric.Add(1)
+	}
+	if err := wait(ctx, delay); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
+
+func (l *Limiter) throttled() bool {
+	return l.bucket != nil || l.configuration.MaxClientBytesPerSecond > 0
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	limiter *Limiter
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if message, ok := m.(proto.Message); ok {
+		return s.limiter.throttle(s.Context(), proto.Size(message))
+	}
+	return nil
+}
+
+// UnaryServerInterceptor throttles the chunks appended to uploads
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if info.FullMethod == appendChunkMethod && l.throttled() {
+			if message, ok := req.(proto.Message); ok {
+				if err := l.throttle(ctx, proto.Size(message)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor caps the number of concurrent uploading streams and throttles the messages they receive
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !info.IsClientStream {
+			return handler(srv, stream)
+		}
+		if l.uploads != nil {
+			select {
+			case l.uploads <- struct{}{}:
+				defer func() { <-l.uploads }()
+			default:
+				rejectedUploadsMetric.Add(1)
+				return status.Errorf(codes.ResourceExhausted, "unable to accept an upload, %d uploads are already ongoing", l.configuration.MaxConcurrentUploads)
+			}
+		}
+		if l.throttled() {
+			stream = &serverStream{ServerStream: stream, limiter: l}
+		}
+		return handler(srv, stream)
+	}
+}
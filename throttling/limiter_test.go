@@ -0,0 +1,101 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package throttling
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestBucket(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	b := createBucket(1000, now)
+	// Bursts of up to one second are immediate
+	assert.Equal(t, time.Duration(0), b.reserve(1000, now))
+	assert.Equal(t, 500*time.Millisecond, b.reserve(500, now))
+	assert.False(t, b.idle(now.Add(time.Second)))
+	// Messages larger than the burst are accepted and delay the next ones
+	assert.Equal(t, 1500*time.Millisecond, b.reserve(2000, now.Add(time.Second)))
+	assert.True(t, b.idle(now.Add(5*time.Second)))
+	assert.Equal(t, time.Duration(0), b.reserve(1000, now.Add(10*time.Second)))
+}
+
+func contextFromAddress(address string) context.Context {
+	addr, _ := net.ResolveTCPAddr("tcp", address)
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+}
+
+func TestThrottle(t *testing.T) {
+	l := CreateLimiter(Configuration{MaxClientBytesPerSecond: 10000})
+	ctx := contextFromAddress("127.0.0.1:4000")
+	assert.NoError(t, l.throttle(ctx, 10000))
+
+	startTime := time.Now()
+	assert.NoError(t, l.throttle(contextFromAddress("127.0.0.1:4001"), 1000))
+	assert.GreaterOrEqual(t, time.Since(startTime), 90*time.Millisecond)
+
+	// Other clients have their own limit
+	startTime = time.Now()
+	assert.NoError(t, l.throttle(contextFromAddress("127.0.0.2:4000"), 10000))
+	assert.Less(t, time.Since(startTime), 50*time.Millisecond)
+
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, codes.Canceled, status.Code(l.throttle(cancelledCtx, 10000)))
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+}
+
+func (s *testServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestMaxConcurrentUploads(t *testing.T) {
+	interceptor := CreateLimiter(Configuration{MaxConcurrentUploads: 1}).StreamServerInterceptor()
+	uploadInfo := &grpc.StreamServerInfo{FullMethod: "/cogmentAPI.ModelRegistrySP/CreateVersion", IsClientStream: true}
+	downloadInfo := &grpc.StreamServerInfo{FullMethod: "/cogmentAPI.ModelRegistrySP/RetrieveVersionData", IsServerStream: true}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- interceptor(nil, &testServerStream{}, uploadInfo, func(srv interface{}, stream grpc.ServerStream) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	handler := func(srv interface{}, stream grpc.ServerStream) error { return nil }
+	err := interceptor(nil, &testServerStream{}, uploadInfo, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	// Downloads aren't capped
+	assert.NoError(t, interceptor(nil, &testServerStream{}, downloadInfo, handler))
+
+	close(release)
+	assert.NoError(t, <-done)
+	assert.NoError(t, interceptor(nil, &testServerStream{}, uploadInfo, handler))
+}
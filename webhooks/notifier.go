@@ -0,0 +1,322 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+	"github.com/sirupsen/logrus"
+)
+
+// Headers of the requests POSTed to the webhooks
+const (
+	EventTypeHeader = "X-Cogment-Model-Registry-Event"
+	// SignatureHeader holds `sha256=<hex encoded HMAC-SHA256 of the body>` when a secret is configured
+	SignatureHeader = "X-Cogment-Model-Registry-Signature"
+)
+
+// Number of events waiting to be delivered to each webhook, the events published when it is full are dropped
+const queueSize = 1000
+
+// Metrics published by every notifier under `/debug/vars`
+var (
+	deliveredEventsMetric = expvar.NewInt("webhooks_delivered_events")
+	failedEventsMetric    = expvar.NewInt("webhooks_failed_events")
+	droppedEventsMetric   = expvar.NewInt("webhooks_dropped_events")
+)
+
+// EventType is the kind of change notified to the webhooks
+type EventType string
+
+const (
+	ModelCreated   EventType = "model_created"
+	ModelUpdated   EventType = "model_updated"
+	ModelDeleted   EventType = "model_deleted"
+	VersionCreated EventType = "version_created"
+	VersionUpdated EventType = "version_updated" // The version was archived, unarchived or its user data changed
+	VersionDeleted EventType = "version_deleted"
+)
+
+var eventTypes = []EventType{ModelCreated, ModelUpdated, ModelDeleted, VersionCreated, VersionUpdated, VersionDeleted}
+
+// ModelInfo is the model of a model event
+type ModelInfo struct {
+	ModelID  string            `json:"model_id"`
+	UserData map[string]string `json:"user_data,omitempty"`
+}
+
+// VersionInfo is the version of a version event
+type VersionInfo struct {
+	ModelID           string            `json:"model_id"`
+	VersionNumber     uint              `json:"version_number"`
+	CreationTimestamp time.Time         `json:"creation_timestamp"`
+	Archived          bool              `json:"archived"`
+	DataHash          string            `json:"data_hash"`
+	DataSize          int               `json:"data_size"`
+	UserData          map[string]string `json:"user_data,omitempty"`
+}
+
+// Event is the JSON body POSTed to the webhooks, ModelInfo is defined for the model events and VersionInfo for the
+// version events
+type Event struct {
+	Type        EventType    `json:"type"`
+	Tenant      string       `json:"tenant,omitempty"`
+	ModelInfo   *ModelInfo   `json:"model_info,omitempty"`
+	VersionInfo *VersionInfo `json:"version_info,omitempty"`
+	PublishedAt time.Time    `json:"published_at"`
+}
+
+type Configuration struct {
+	URLs        []string      // Webhooks every event is POSTed to
+	Secret      string        // If defined, the requests are signed with HMAC-SHA256, see SignatureHeader
+	EventTypes  []EventType   // Notified events, every event if empty
+	Tenant      string        // Tenant of the notified registry, empty for the default one
+	MaxAttempts int           // Number of deliveries attempted for each event before it is dropped
+	Backoff     time.Duration // Delay before retrying a failed delivery, doubled after each attempt
+}
+
+// ParseURLs parses a comma separated list of webhook URLs
+func ParseURLs(value string) ([]string, error) {
+	urls := []string{}
+	for _, rawURL := range strings.Split(value, ",") {
+		rawURL = strings.TrimSpace(rawURL)
+		if rawURL == "" {
+			continue
+		}
+		parsedURL, err := url.Parse(rawURL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return nil, fmt.Errorf("invalid webhook URL %q, expecting an http or https URL", rawURL)
+		}
+		urls = append(urls, rawURL)
+	}
+	return urls, nil
+}
+
+// ParseEventTypes parses a comma separated list of event types, an empty list selects every event
+func ParseEventTypes(value string) ([]EventType, error) {
+	parsedEventTypes := []EventType{}
+	for _, rawEventType := range strings.Split(value, ",") {
+		rawEventType = strings.TrimSpace(rawEventType)
+		if rawEventType == "" {
+			continue
+		}
+		known := false
+		for _, eventType := range eventTypes {
+			if EventType(rawEventType) == eventType {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown webhook event type %q, expecting one of %v", rawEventType, eventTypes)
+		}
+		parsedEventTypes = append(parsedEventTypes, EventType(rawEventType))
+	}
+	return parsedEventTypes, nil
+}
+
+// Sign computes the value of the SignatureHeader of a body, letting the webhooks check the requests come from the registry
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type Notifier struct {
+	configuration Configuration
+	eventTypes    map[EventType]bool // Nil when every event is notified
+	queues        []chan Event       // The events waiting to be delivered to each webhook
+	httpClient    *http.Client
+}
+
+// CreateNotifier creates a notifier POSTing the events it is published to the configured webhooks
+//
+// The events are queued until Run delivers them, in order for each webhook.
+func CreateNotifier(configuration Configuration) *Notifier {
+	if configuration.MaxAttempts < 1 {
+		configuration.MaxAttempts = 1
+	}
+	n := &Notifier{
+		configuration: configuration,
+		queues:        make([]chan Event, len(configuration.URLs)),
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+	}
+	if len(configuration.EventTypes) > 0 {
+		n.eventTypes = make(map[EventType]bool, len(configuration.EventTypes))
+		for _, eventType := range configuration.EventTypes {
+			n.eventTypes[eventType] = true
+		}
+	}
+	for index := range n.queues {
+		n.queues[index] = make(chan Event, queueSize)
+	}
+	return n
+}
+
+// ModelEvent queues the notification of a change made to a model, it doesn't block
+func (n *Notifier) ModelEvent(eventType extensionsapi.ModelEventType, modelInfo backend.ModelInfo) {
+	event := Event{
+		ModelInfo: &ModelInfo{ModelID: modelInfo.ModelID, UserData: modelInfo.UserData},
+	}
+	switch eventType {
+	case extensionsapi.ModelEventType_MODEL_CREATED:
+		event.Type = ModelCreated
+	case extensionsapi.ModelEventType_MODEL_UPDATED:
+		event.Type = ModelUpdated
+	case extensionsapi.ModelEventType_MODEL_DELETED:
+		event.Type = ModelDeleted
+	default:
+		return
+	}
+	n.publish(event)
+}
+
+// VersionEvent queues the notification of a change made to a version, it doesn't block
+func (n *Notifier) VersionEvent(eventType extensionsapi.VersionEventType, versionInfo backend.VersionInfo) {
+	event := Event{
+		VersionInfo: &VersionInfo{
+			ModelID:           versionInfo.ModelID,
+			VersionNumber:     versionInfo.VersionNumber,
+			CreationTimestamp: versionInfo.CreationTimestamp,
+			Archived:          versionInfo.Archived,
+			DataHash:          versionInfo.DataHash,
+			DataSize:          versionInfo.DataSize,
+			UserData:          versionInfo.UserData,
+		},
+	}
+	switch eventType {
+	case extensionsapi.VersionEventType_VERSION_CREATED:
+		event.Type = VersionCreated
+	case extensionsapi.VersionEventType_VERSION_UPDATED:
+		event.Type = VersionUpdated
+	case extensionsapi.VersionEventType_VERSION_DELETED:
+		event.Type = VersionDeleted
+	default:
+		return
+	}
+	n.publish(event)
+}
+
+func (n *Notifier) publish(event Event) {
+	if n.eventTypes != nil && !n.eventTypes[event.Type] {
+		return
+	}
+	event.Tenant = n.configuration.Tenant
+	event.PublishedAt = time.Now().UTC()
+	for index, queue := range n.queues {
+		select {
+		case queue <- event:
+		default:
+			droppedEventsMetric.Add(1)
+			logrus.WithFields(logrus.Fields{"url": n.configuration.URLs[index], "type": event.Type}).Warn("Webhook event dropped, too many events are waiting to be delivered")
+		}
+	}
+}
+
+// Run delivers the queued events until the context is done, each webhook is called from its own goroutine
+func (n *Notifier) Run(ctx context.Context) {
+	done := make(chan struct{})
+	for index := range n.queues {
+		go func(index int) {
+			defer func() { done <- struct{}{} }()
+			n.runWebhook(ctx, n.configuration.URLs[index], n.queues[index])
+		}(index)
+	}
+	for range n.queues {
+		<-done
+	}
+}
+
+func (n *Notifier) runWebhook(ctx context.Context, webhookURL string, queue <-chan Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-queue:
+			if err := n.deliver(ctx, webhookURL, event); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				failedEventsMetric.Add(1)
+				logrus.WithFields(logrus.Fields{"url": webhookURL, "type": event.Type}).WithError(err).Error("Webhook event dropped, unable to deliver it")
+				continue
+			}
+			deliveredEventsMetric.Add(1)
+		}
+	}
+}
+
+// deliver POSTs an event to a webhook, retrying with an exponential backoff while it fails with a server error
+func (n *Notifier) deliver(ctx context.Context, webhookURL string, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to serialize the event: %w", err)
+	}
+	backoff := n.configuration.Backoff
+	for attempt := 1; ; attempt++ {
+		retryable, err := n.post(ctx, webhookURL, event.Type, body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= n.configuration.MaxAttempts {
+			return err
+		}
+		logrus.WithFields(logrus.Fields{"url": webhookURL, "type": event.Type, "attempt": attempt}).WithError(err).Warn("Webhook delivery failed, retrying")
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// post sends a single request and returns whether it can be retried when it fails
+func (n *Notifier) post(ctx context.Context, webhookURL string, eventType EventType, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("unable to create the request to %q: %w", webhookURL, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventTypeHeader, string(eventType))
+	if n.configuration.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(n.configuration.Secret, body))
+	}
+	rep, err := n.httpClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("unable to post to %q: %w", webhookURL, err)
+	}
+	defer rep.Body.Close()
+	if rep.StatusCode < 200 || rep.StatusCode >= 300 {
+		retryable := rep.StatusCode >= 500 || rep.StatusCode == http.StatusTooManyRequests || rep.StatusCode == http.StatusRequestTimeout
+		return retryable, fmt.Errorf("unable to post to %q: unexpected status %q", webhookURL, rep.Status)
+	}
+	return true, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 AI Redefined Inc. <dev+cogment@ai-r.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cogment/cogment-model-registry/backend"
+	extensionsapi "github.com/cogment/cogment-model-registry/grpcapi/extensions"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingWebhook records the events it receives, failing the first requests with the given statuses
+type recordingWebhook struct {
+	mutex    sync.Mutex
+	statuses []int
+	events   []Event
+	attempts int
+}
+
+func (w *recordingWebhook) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.attempts++
+	if len(w.statuses) > 0 {
+		rw.WriteHeader(w.statuses[0])
+		w.statuses = w.statuses[1:]
+		return
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if req.Header.Get(SignatureHeader) != Sign("secret", body) {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	event := Event{}
+	if err := json.Unmarshal(body, &event); err != nil || req.Header.Get(EventTypeHeader) != string(event.Type) {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.events = append(w.events, event)
+}
+
+func (w *recordingWebhook) receivedEvents() []Event {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return append([]Event{}, w.events...)
+}
+
+func startNotifier(t *testing.T, configuration Configuration) *Notifier {
+	notifier := CreateNotifier(configuration)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go notifier.Run(ctx)
+	return notifier
+}
+
+func TestNotifier(t *testing.T) {
+	webhook := &recordingWebhook{statuses: []int{http.StatusServiceUnavailable, http.StatusInternalServerError}}
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+
+	notifier := startNotifier(t, Configuration{
+		URLs:        []string{server.URL},
+		Secret:      "secret",
+		EventTypes:  []EventType{VersionCreated, ModelDeleted},
+		Tenant:      "team_a",
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+	})
+	notifier.ModelEvent(extensionsapi.ModelEventType_MODEL_CREATED, backend.ModelInfo{ModelID: "foo"})
+	notifier.VersionEvent(extensionsapi.VersionEventType_VERSION_CREATED, backend.VersionInfo{ModelID: "foo", VersionNumber: 1, DataHash: "hash", DataSize: 4})
+	notifier.ModelEvent(extensionsapi.ModelEventType_MODEL_DELETED, backend.ModelInfo{ModelID: "foo"})
+
+	// The first event is filtered out, the second one is delivered after two failed attempts
+	assert.Eventually(t, func() bool {
+		return len(webhook.receivedEvents()) == 2
+	}, time.Second, 10*time.Millisecond)
+	events := webhook.receivedEvents()
+	assert.Equal(t, VersionCreated, events[0].Type)
+	assert.Equal(t, "team_a", events[0].Tenant)
+	assert.Nil(t, events[0].ModelInfo)
+	assert.Equal(t, &VersionInfo{ModelID: "foo", VersionNumber: 1, DataHash: "hash", DataSize: 4, CreationTimestamp: events[0].VersionInfo.CreationTimestamp}, events[0].VersionInfo)
+	assert.Equal(t, ModelDeleted, events[1].Type)
+	assert.Equal(t, "foo", events[1].ModelInfo.ModelID)
+}
+
+func TestNotifierGivesUp(t *testing.T) {
+	webhook := &recordingWebhook{statuses: []int{http.StatusBadRequest, http.StatusBadGateway, http.StatusBadGateway}}
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+
+	notifier := startNotifier(t, Configuration{URLs: []string{server.URL}, Secret: "secret", MaxAttempts: 2, Backoff: time.Millisecond})
+	// Client errors aren't retried, server errors are retried up to the maximum number of attempts
+	notifier.ModelEvent(extensionsapi.ModelEventType_MODEL_CREATED, backend.ModelInfo{ModelID: "foo"})
+	notifier.ModelEvent(extensionsapi.ModelEventType_MODEL_CREATED, backend.ModelInfo{ModelID: "bar"})
+	notifier.ModelEvent(extensionsapi.ModelEventType_MODEL_CREATED, backend.ModelInfo{ModelID: "baz"})
+	assert.Eventually(t, func() bool {
+		return len(webhook.receivedEvents()) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "baz", webhook.receivedEvents()[0].ModelInfo.ModelID)
+	webhook.mutex.Lock()
+	defer webhook.mutex.Unlock()
+	assert.Equal(t, 4, webhook.attempts)
+}
+
+func TestParse(t *testing.T) {
+	urls, err := ParseURLs("https://ci.example.com/hook, http://localhost:8080/events,")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://ci.example.com/hook", "http://localhost:8080/events"}, urls)
+	_, err = ParseURLs("ci.example.com/hook")
+	assert.Error(t, err)
+
+	eventTypes, err := ParseEventTypes("version_created, version_updated")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{VersionCreated, VersionUpdated}, eventTypes)
+	eventTypes, err = ParseEventTypes("")
+	assert.NoError(t, err)
+	assert.Empty(t, eventTypes)
+	_, err = ParseEventTypes("version_archived")
+	assert.Error(t, err)
+}